@@ -13,8 +13,11 @@ import (
 	"time"
 
 	"github.com/breeze-rmm/agent/internal/audit"
+	"github.com/breeze-rmm/agent/internal/cmdpolicy"
+	"github.com/breeze-rmm/agent/internal/cmdsign"
 	"github.com/breeze-rmm/agent/internal/collectors"
 	"github.com/breeze-rmm/agent/internal/config"
+	"github.com/breeze-rmm/agent/internal/executor"
 	"github.com/breeze-rmm/agent/internal/heartbeat"
 	"github.com/breeze-rmm/agent/internal/ipc"
 	"github.com/breeze-rmm/agent/internal/logging"
@@ -99,6 +102,10 @@ func init() {
 }
 
 func main() {
+	// Sandboxed scripts start by re-executing the agent binary, which
+	// confines itself here before running the script's interpreter.
+	executor.SandboxInit()
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -441,6 +448,17 @@ func enrollDevice(enrollmentKey string) {
 		fmt.Printf("mTLS certificate issued (expires: %s)\n", enrollResp.Mtls.ExpiresAt)
 	}
 
+	// Pin the org command signing key
+	if enrollResp.CommandSigning != nil && enrollResp.CommandSigning.PublicKey != "" {
+		if _, err := cmdsign.ParsePublicKey(enrollResp.CommandSigning.PublicKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Enrollment failed: invalid command signing key: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.CommandSigningPublicKey = enrollResp.CommandSigning.PublicKey
+		cfg.RequireSignedCommands = enrollResp.CommandSigning.Required
+		fmt.Printf("Command signing key pinned (signatures required: %v)\n", cfg.RequireSignedCommands)
+	}
+
 	if err := config.SaveTo(cfg, cfgFile); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to save config: %v\n", err)
 		fmt.Fprintf(os.Stderr, "Agent ID: %s\n", cfg.AgentID)
@@ -472,6 +490,30 @@ func checkStatus() {
 	fmt.Printf("Heartbeat Interval: %d seconds\n", cfg.HeartbeatIntervalSeconds)
 	fmt.Printf("Metrics Interval: %d seconds\n", cfg.MetricsIntervalSeconds)
 	fmt.Printf("Enabled Collectors: %v\n", cfg.EnabledCollectors)
+	if cfg.CommandSigningPublicKey != "" {
+		if key, err := cmdsign.ParsePublicKey(cfg.CommandSigningPublicKey); err == nil {
+			fmt.Printf("Command Signing Key: %s (required: %v)\n", cmdsign.KeyID(key), cfg.RequireSignedCommands)
+		} else {
+			fmt.Printf("Command Signing Key: invalid (%v)\n", err)
+		}
+	} else if cfg.RequireSignedCommands {
+		fmt.Println("Command Signing Key: none pinned (high-risk commands will be rejected)")
+	}
+
+	policyPath := config.CommandPolicyPath()
+	policy, err := cmdpolicy.Load(policyPath)
+	if err != nil {
+		fmt.Printf("Command Policy: %v (all commands will be denied)\n", err)
+		return
+	}
+	if policy == nil {
+		fmt.Printf("Command Policy: none (%s not found, all commands allowed)\n", policyPath)
+		return
+	}
+	fmt.Printf("Command Policy: %s\n", policyPath)
+	for _, line := range policy.Describe() {
+		fmt.Printf("  %s\n", line)
+	}
 }
 
 // runUserHelper starts the per-user session helper process.
@@ -21,6 +21,10 @@ var log = logging.L("audit")
 const (
 	EventCommandReceived = "command_received"
 	EventCommandExecuted = "command_executed"
+	EventCommandInterrupted = "command_interrupted"
+	EventCommandRejected = "command_rejected"
+	EventCommandDenied = "command_denied"
+	EventCommandConsent = "command_consent"
 	EventScriptExecution = "script_execution"
 	EventServiceAction   = "service_action"
 	EventFileModification = "file_modification"
@@ -37,6 +41,10 @@ var criticalEvents = map[string]bool{
 	EventAgentStart:   true,
 	EventAgentStop:    true,
 	EventConfigChange: true,
+	EventCommandInterrupted: true,
+	EventCommandRejected: true,
+	EventCommandDenied: true,
+	EventCommandConsent: true,
 }
 
 // Entry is a single audit log record.
@@ -9,10 +9,12 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/breeze-rmm/agent/internal/backup/providers"
+	"github.com/breeze-rmm/agent/internal/schedule"
 )
 
 const (
@@ -26,13 +28,42 @@ const (
 type BackupConfig struct {
 	Provider  providers.BackupProvider
 	Paths     []string
-	Schedule  time.Duration
-	Retention int
+	Schedules []ScheduleEntry
+	Retention RetentionPolicy
+
+	// Include and Exclude are glob patterns filtering files under Paths
+	// (see fileFilter). Files larger than MaxFileSize bytes are skipped
+	// when it is positive.
+	Include     []string
+	Exclude     []string
+	MaxFileSize int64
+
+	// Encryptor enables client-side encryption when non-nil.
+	Encryptor *Encryptor
+	// KeyEscrow, if set, is stored alongside the backups so the org can
+	// recover the master key.
+	KeyEscrow *KeyEscrow
+
+	// VerifySampleSize, when positive, re-reads that many randomly chosen
+	// files from each scheduled snapshot and checks them against the
+	// manifest.
+	VerifySampleSize int
+
+	// PreHooks run before files are read; if one fails the backup is
+	// aborted. PostHooks always run once the pre hooks have started, so
+	// they should tolerate partially completed pre hooks.
+	PreHooks   []BackupHook
+	PostHooks  []BackupHook
+	HookRunner HookRunner
+	// SnapshotMount, when enabled, makes the backup read from a snapshot
+	// mounted by the pre hooks instead of the live files.
+	SnapshotMount SnapshotMount
 }
 
 // BackupJob tracks the state of a backup run.
 type BackupJob struct {
 	ID            string
+	Mode          string
 	StartedAt     time.Time
 	CompletedAt   time.Time
 	Snapshot      *Snapshot
@@ -40,6 +71,12 @@ type BackupJob struct {
 	BytesBackedUp int64
 	Status        string
 	Error         error
+	// Verification holds the sampled post-backup verification result, if
+	// one was run.
+	Verification *VerifyResult
+	// HookResults holds the pre- and post-backup hook outcomes in the order
+	// they ran.
+	HookResults []HookResult
 }
 
 // BackupManager orchestrates scheduled and on-demand backups.
@@ -52,12 +89,16 @@ type BackupManager struct {
 	stopCh           chan struct{}
 	doneCh           chan struct{}
 	lastSnapshotTime time.Time
+	escrowStored     bool
+
+	isMountPoint func(dir string) (bool, error)
 }
 
 // NewBackupManager creates a new BackupManager.
 func NewBackupManager(config BackupConfig) *BackupManager {
 	return &BackupManager{
-		config: config,
+		config:       config,
+		isMountPoint: isMountPoint,
 	}
 }
 
@@ -66,12 +107,18 @@ func (m *BackupManager) GetProvider() providers.BackupProvider {
 	return m.config.Provider
 }
 
+// GetEncryptor returns the configured encryptor, or nil when backups are
+// not encrypted.
+func (m *BackupManager) GetEncryptor() *Encryptor {
+	return m.config.Encryptor
+}
+
 // Start begins scheduled backups.
 func (m *BackupManager) Start() error {
 	if m.config.Provider == nil {
 		return errors.New("backup provider is required")
 	}
-	if m.config.Schedule <= 0 {
+	if len(m.config.Schedules) == 0 {
 		log.Printf("[backup] backup schedule disabled")
 		return nil
 	}
@@ -86,7 +133,11 @@ func (m *BackupManager) Start() error {
 	m.doneCh = make(chan struct{})
 	m.mu.Unlock()
 
-	log.Printf("[backup] starting backup manager (schedule=%v)", m.config.Schedule)
+	specs := make([]string, 0, len(m.config.Schedules))
+	for _, entry := range m.config.Schedules {
+		specs = append(specs, entry.Spec)
+	}
+	log.Printf("[backup] starting backup manager (schedule=%q, retention: %s)", strings.Join(specs, "; "), m.config.Retention)
 	go m.runScheduler()
 	return nil
 }
@@ -111,8 +162,18 @@ func (m *BackupManager) Stop() {
 	log.Printf("[backup] backup manager stopped")
 }
 
-// RunBackup triggers an immediate backup run.
+// RunBackup triggers an immediate incremental backup run.
 func (m *BackupManager) RunBackup() (*BackupJob, error) {
+	return m.RunBackupWithMode(BackupModeIncremental)
+}
+
+// RunBackupWithMode triggers an immediate backup run. A full run backs up
+// every file that passes the filters; an incremental run only backs up
+// files modified since the previous snapshot.
+func (m *BackupManager) RunBackupWithMode(mode string) (*BackupJob, error) {
+	if mode != BackupModeFull && mode != BackupModeIncremental {
+		return nil, fmt.Errorf("invalid backup mode %q", mode)
+	}
 	if m.config.Provider == nil {
 		return nil, errors.New("backup provider is required")
 	}
@@ -135,11 +196,45 @@ func (m *BackupManager) RunBackup() (*BackupJob, error) {
 
 	job := &BackupJob{
 		ID:        newJobID(),
+		Mode:      mode,
 		StartedAt: time.Now().UTC(),
 		Status:    jobStatusRunning,
 	}
 
+	if err := m.runHooks(job, HookPhasePre, m.config.PreHooks); err != nil {
+		job.Status = jobStatusFailed
+		job.Error = fmt.Errorf("backup aborted: %w", err)
+		if postErr := m.runHooks(job, HookPhasePost, m.config.PostHooks); postErr != nil {
+			job.Error = errors.Join(job.Error, postErr)
+		}
+		job.CompletedAt = time.Now().UTC()
+		return job, job.Error
+	}
+
+	err := m.runJob(job)
+	if postErr := m.runHooks(job, HookPhasePost, m.config.PostHooks); postErr != nil {
+		job.Error = errors.Join(job.Error, postErr)
+		if err != nil {
+			err = errors.Join(err, postErr)
+		}
+	}
+	return job, err
+}
+
+// runJob collects and uploads the files for a job whose pre hooks have
+// succeeded.
+func (m *BackupManager) runJob(job *BackupJob) error {
+	if err := m.checkSnapshotMount(); err != nil {
+		job.Status = jobStatusFailed
+		job.CompletedAt = time.Now().UTC()
+		job.Error = err
+		return err
+	}
+
 	cutoff := m.lastSnapshotTime
+	if job.Mode == BackupModeFull {
+		cutoff = time.Time{}
+	}
 	files, scanErr := m.collectBackupFiles(cutoff)
 	if scanErr != nil {
 		log.Printf("[backup] backup file scan completed with errors: %v", scanErr)
@@ -148,10 +243,24 @@ func (m *BackupManager) RunBackup() (*BackupJob, error) {
 		job.Status = jobStatusSkipped
 		job.CompletedAt = time.Now().UTC()
 		job.Error = scanErr
-		return job, scanErr
+		return scanErr
+	}
+
+	if m.config.KeyEscrow != nil && !m.escrowStored {
+		if err := StoreKeyEscrow(m.config.Provider, m.config.KeyEscrow); err != nil {
+			log.Printf("[backup] failed to store key escrow: %v", err)
+		} else {
+			m.escrowStored = true
+		}
 	}
 
-	snapshot, snapErr := CreateSnapshot(m.config.Provider, files)
+	// Without an earlier snapshot every file is included, so the snapshot
+	// is a full one and can anchor later incrementals.
+	mode := job.Mode
+	if cutoff.IsZero() {
+		mode = BackupModeFull
+	}
+	snapshot, snapErr := CreateSnapshot(m.config.Provider, files, mode, m.config.Encryptor)
 	job.CompletedAt = time.Now().UTC()
 	job.Snapshot = snapshot
 	if snapshot != nil {
@@ -160,8 +269,8 @@ func (m *BackupManager) RunBackup() (*BackupJob, error) {
 	}
 
 	retentionErr := error(nil)
-	if snapshot != nil && m.config.Retention > 0 {
-		retentionErr = DeleteSnapshot(m.config.Provider, m.config.Retention)
+	if snapshot != nil && !m.config.Retention.IsZero() {
+		retentionErr = DeleteSnapshot(m.config.Provider, m.config.Retention, m.config.Encryptor)
 		if retentionErr != nil {
 			log.Printf("[backup] failed to enforce snapshot retention: %v", retentionErr)
 		}
@@ -174,45 +283,108 @@ func (m *BackupManager) RunBackup() (*BackupJob, error) {
 		combinedErr := errors.Join(scanErr, snapErr)
 		job.Status = jobStatusFailed
 		job.Error = combinedErr
-		return job, combinedErr
+		return combinedErr
 	}
 
 	job.Status = jobStatusCompleted
 	job.Error = errors.Join(scanErr, retentionErr)
-	return job, nil
+	return nil
 }
 
 func (m *BackupManager) runScheduler() {
 	defer close(m.doneCh)
-	if _, err := m.RunBackup(); err != nil {
-		log.Printf("[backup] initial scheduled backup failed: %v", err)
-	}
 
-	ticker := time.NewTicker(m.config.Schedule)
-	defer ticker.Stop()
+	// Interval schedules keep their historical behaviour of running once at
+	// startup; calendar schedules wait for their first slot.
+	for _, entry := range m.config.Schedules {
+		if _, ok := entry.Schedule.(schedule.Interval); ok {
+			if _, err := m.runScheduledBackup(entry.Mode); err != nil {
+				log.Printf("[backup] initial scheduled backup failed: %v", err)
+			}
+			break
+		}
+	}
 
 	for {
+		next, mode := nextScheduledRun(m.config.Schedules, time.Now())
+		if next.IsZero() {
+			log.Printf("[backup] backup schedule has no upcoming runs")
+			<-m.stopCh
+			return
+		}
+		log.Printf("[backup] next %s backup at %s", mode, next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
 		select {
 		case <-m.stopCh:
+			timer.Stop()
 			return
-		case <-ticker.C:
-			if _, err := m.RunBackup(); err != nil {
-				log.Printf("[backup] scheduled backup failed: %v", err)
+		case <-timer.C:
+			if _, err := m.runScheduledBackup(mode); err != nil {
+				log.Printf("[backup] scheduled %s backup failed: %v", mode, err)
 			}
 		}
 	}
 }
 
+// runScheduledBackup runs a backup and, if configured, a sampled
+// verification of the snapshot it produced.
+func (m *BackupManager) runScheduledBackup(mode string) (*BackupJob, error) {
+	job, err := m.RunBackupWithMode(mode)
+	if err != nil || job == nil || job.Snapshot == nil || m.config.VerifySampleSize <= 0 {
+		return job, err
+	}
+
+	result, verifyErr := VerifySnapshot(m.config.Provider, m.config.Encryptor, job.Snapshot.ID, m.config.VerifySampleSize)
+	job.Verification = result
+	switch {
+	case verifyErr != nil:
+		log.Printf("[backup] sampled verification of %s failed: %v", job.Snapshot.ID, verifyErr)
+	case !result.Passed():
+		log.Printf("[backup] sampled verification of %s found %d problems (missing=%d corrupt=%d truncated=%d)",
+			job.Snapshot.ID, len(result.Issues), result.Missing, result.Corrupt, result.Truncated)
+	default:
+		log.Printf("[backup] sampled verification of %s passed (%d files)", job.Snapshot.ID, result.FilesChecked)
+	}
+	return job, nil
+}
+
 type backupFile struct {
-	sourcePath   string
+	sourcePath string
+	// readPath is where the content is read from; it differs from
+	// sourcePath when reading from a snapshot mount.
+	readPath     string
 	snapshotPath string
 	size         int64
 	modTime      time.Time
+	mode         os.FileMode
+	uid          *int
+	gid          *int
+}
+
+func newBackupFile(sourcePath, readPath, snapshotPath string, info os.FileInfo) backupFile {
+	uid, gid := fileOwner(info)
+	return backupFile{
+		sourcePath:   sourcePath,
+		readPath:     readPath,
+		snapshotPath: snapshotPath,
+		size:         info.Size(),
+		modTime:      info.ModTime(),
+		mode:         info.Mode(),
+		uid:          uid,
+		gid:          gid,
+	}
 }
 
 func (m *BackupManager) collectBackupFiles(cutoff time.Time) ([]backupFile, error) {
+	filter, err := newFileFilter(m.config.Include, m.config.Exclude, m.config.MaxFileSize)
+	if err != nil {
+		return nil, err
+	}
+
 	var files []backupFile
 	var errs []error
+	oversized := 0
 	seen := make(map[string]struct{})
 
 	for idx, root := range m.config.Paths {
@@ -221,9 +393,10 @@ func (m *BackupManager) collectBackupFiles(cutoff time.Time) ([]backupFile, erro
 			continue
 		}
 		cleanRoot := filepath.Clean(root)
-		info, err := os.Stat(cleanRoot)
+		readRoot := m.config.SnapshotMount.readPath(cleanRoot)
+		info, err := os.Stat(readRoot)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to stat backup path %s: %w", cleanRoot, err))
+			errs = append(errs, fmt.Errorf("failed to stat backup path %s: %w", readRoot, err))
 			continue
 		}
 
@@ -233,27 +406,33 @@ func (m *BackupManager) collectBackupFiles(cutoff time.Time) ([]backupFile, erro
 				continue
 			}
 			relPath := filepath.Base(cleanRoot)
+			if include, tooLarge := filter.includeFile(relPath, info.Size()); !include {
+				if tooLarge {
+					oversized++
+				}
+				continue
+			}
 			snapshotPath := filepath.ToSlash(filepath.Join(rootLabel, relPath))
 			if _, exists := seen[snapshotPath]; exists {
 				log.Printf("[backup] duplicate backup path skipped: %s", snapshotPath)
 				continue
 			}
 			seen[snapshotPath] = struct{}{}
-			files = append(files, backupFile{
-				sourcePath:   cleanRoot,
-				snapshotPath: snapshotPath,
-				size:         info.Size(),
-				modTime:      info.ModTime(),
-			})
+			files = append(files, newBackupFile(cleanRoot, readRoot, snapshotPath, info))
 			continue
 		}
 
-		err = filepath.WalkDir(cleanRoot, func(path string, entry fs.DirEntry, walkErr error) error {
+		err = filepath.WalkDir(readRoot, func(path string, entry fs.DirEntry, walkErr error) error {
 			if walkErr != nil {
 				errs = append(errs, fmt.Errorf("walk error for %s: %w", path, walkErr))
 				return nil
 			}
 			if entry.IsDir() {
+				if path != readRoot {
+					if rel, relErr := filepath.Rel(readRoot, path); relErr == nil && filter.skipDir(filepath.ToSlash(rel)) {
+						return filepath.SkipDir
+					}
+				}
 				return nil
 			}
 			if entry.Type()&os.ModeSymlink != 0 {
@@ -267,30 +446,35 @@ func (m *BackupManager) collectBackupFiles(cutoff time.Time) ([]backupFile, erro
 			if !info.Mode().IsRegular() || !shouldIncludeFile(info.ModTime(), cutoff) {
 				return nil
 			}
-			relPath, err := filepath.Rel(cleanRoot, path)
+			relPath, err := filepath.Rel(readRoot, path)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("failed to resolve relative path for %s: %w", path, err))
 				return nil
 			}
+			if include, tooLarge := filter.includeFile(filepath.ToSlash(relPath), info.Size()); !include {
+				if tooLarge {
+					oversized++
+				}
+				return nil
+			}
 			snapshotPath := filepath.ToSlash(filepath.Join(rootLabel, relPath))
 			if _, exists := seen[snapshotPath]; exists {
 				log.Printf("[backup] duplicate backup path skipped: %s", snapshotPath)
 				return nil
 			}
 			seen[snapshotPath] = struct{}{}
-			files = append(files, backupFile{
-				sourcePath:   path,
-				snapshotPath: snapshotPath,
-				size:         info.Size(),
-				modTime:      info.ModTime(),
-			})
+			files = append(files, newBackupFile(filepath.Join(cleanRoot, relPath), path, snapshotPath, info))
 			return nil
 		})
 		if err != nil {
-			errs = append(errs, fmt.Errorf("backup walk failed for %s: %w", cleanRoot, err))
+			errs = append(errs, fmt.Errorf("backup walk failed for %s: %w", readRoot, err))
 		}
 	}
 
+	if oversized > 0 {
+		log.Printf("[backup] skipped %d files larger than %d bytes", oversized, m.config.MaxFileSize)
+	}
+
 	sort.Slice(files, func(i, j int) bool {
 		return files[i].snapshotPath < files[j].snapshotPath
 	})
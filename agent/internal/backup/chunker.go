@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	// Chunk size bounds for content-defined chunking. The average is a
+	// target, not a guarantee: cut points depend only on file content so an
+	// insert near the start of a file shifts at most a couple of chunks.
+	minChunkSize = 256 * 1024
+	avgChunkSize = 1024 * 1024
+	maxChunkSize = 4 * 1024 * 1024
+
+	// Normalized chunking masks (FastCDC level 2): a stricter mask below the
+	// average size and a looser one above it keep chunk sizes clustered
+	// around avgChunkSize.
+	chunkMaskSmall = uint64(1<<22-1) << (64 - 22)
+	chunkMaskLarge = uint64(1<<18-1) << (64 - 18)
+)
+
+// gearTable holds the per-byte values for the rolling gear hash. It is
+// generated from a fixed seed so cut points are stable across agent versions
+// and machines; changing it would defeat deduplication against existing
+// chunk stores.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x42726565_7a654344) // "BreezeCD"
+	for i := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker splits a stream into content-defined chunks.
+type Chunker struct {
+	reader io.Reader
+	buf    []byte
+	start  int
+	end    int
+	eof    bool
+}
+
+// NewChunker creates a Chunker reading from r.
+func NewChunker(r io.Reader) *Chunker {
+	return &Chunker{
+		reader: r,
+		buf:    make([]byte, maxChunkSize),
+	}
+}
+
+// Next returns the next chunk. The returned slice is only valid until the
+// next call to Next. It returns io.EOF when the stream is exhausted.
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+
+	data := c.buf[c.start:c.end]
+	cut := findCutPoint(data)
+	chunk := data[:cut]
+	c.start += cut
+	return chunk, nil
+}
+
+// fill tops the buffer up to maxChunkSize bytes unless the reader is done.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= maxChunkSize {
+		return nil
+	}
+	if c.start > 0 {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+	}
+	for c.end < len(c.buf) {
+		n, err := c.reader.Read(c.buf[c.end:])
+		c.end += n
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findCutPoint returns the length of the first chunk in data.
+func findCutPoint(data []byte) int {
+	n := len(data)
+	if n <= minChunkSize {
+		return n
+	}
+	if n > maxChunkSize {
+		n = maxChunkSize
+	}
+	normal := avgChunkSize
+	if n < normal {
+		normal = n
+	}
+
+	var fp uint64
+	i := minChunkSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&chunkMaskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&chunkMaskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,307 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+const chunkRootDir = "chunks"
+
+// ChunkRef identifies a stored chunk by its content hash.
+type ChunkRef struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// ChunkStore stores content-addressed chunks through a BackupProvider.
+// Chunks are gzip-compressed before upload and keyed by the SHA-256 of
+// their uncompressed content, so identical data is only stored once no
+// matter how many files or snapshots reference it. With an Encryptor,
+// chunks are additionally sealed and keyed by an HMAC instead.
+type ChunkStore struct {
+	provider  providers.BackupProvider
+	encryptor *Encryptor
+
+	mu     sync.Mutex
+	known  map[string]struct{}
+	loaded bool
+}
+
+// NewChunkStore creates a ChunkStore backed by provider. encryptor may be
+// nil to store plaintext chunks.
+func NewChunkStore(provider providers.BackupProvider, encryptor *Encryptor) *ChunkStore {
+	return &ChunkStore{
+		provider:  provider,
+		encryptor: encryptor,
+		known:     make(map[string]struct{}),
+	}
+}
+
+// Put stores data as a chunk unless a chunk with the same hash already
+// exists. It reports whether the chunk was uploaded.
+func (s *ChunkStore) Put(data []byte) (ChunkRef, bool, error) {
+	ref := ChunkRef{
+		Hash: s.chunkID(data),
+		Size: int64(len(data)),
+	}
+
+	if err := s.load(); err != nil {
+		return ref, false, err
+	}
+	s.mu.Lock()
+	_, exists := s.known[ref.Hash]
+	s.mu.Unlock()
+	if exists {
+		return ref, false, nil
+	}
+
+	tempPath, err := s.writeChunkObject(ref.Hash, data)
+	if err != nil {
+		return ref, false, err
+	}
+	defer os.Remove(tempPath)
+
+	if err := s.provider.Upload(tempPath, chunkKey(ref.Hash)); err != nil {
+		return ref, false, fmt.Errorf("failed to upload chunk %s: %w", ref.Hash, err)
+	}
+
+	s.mu.Lock()
+	s.known[ref.Hash] = struct{}{}
+	s.mu.Unlock()
+	return ref, true, nil
+}
+
+// Get downloads a chunk and verifies its content against the hash.
+func (s *ChunkStore) Get(hash string) ([]byte, error) {
+	if !isChunkHash(hash) {
+		return nil, fmt.Errorf("invalid chunk hash %q", hash)
+	}
+
+	tempFile, err := os.CreateTemp("", "backup-chunk-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp chunk: %w", err)
+	}
+	tempPath := tempFile.Name()
+	_ = tempFile.Close()
+	defer os.Remove(tempPath)
+
+	if err := s.provider.Download(chunkKey(hash), tempPath); err != nil {
+		return nil, fmt.Errorf("failed to download chunk %s: %w", hash, err)
+	}
+
+	object, err := os.ReadFile(tempPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", hash, err)
+	}
+	return s.openChunkObject(hash, object)
+}
+
+// List returns the hashes of all chunks in the store.
+func (s *ChunkStore) List() ([]string, error) {
+	items, err := s.provider.List(chunkRootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	hashes := make([]string, 0, len(items))
+	for _, item := range items {
+		hash := path.Base(item)
+		if isChunkHash(hash) {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// Delete removes a chunk from the store.
+func (s *ChunkStore) Delete(hash string) error {
+	if !isChunkHash(hash) {
+		return fmt.Errorf("invalid chunk hash %q", hash)
+	}
+	if err := s.provider.Delete(chunkKey(hash)); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.known, hash)
+	s.mu.Unlock()
+	return nil
+}
+
+// load populates the known-chunk index from the provider once.
+func (s *ChunkStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return nil
+	}
+
+	items, err := s.provider.List(chunkRootDir)
+	if err != nil {
+		return fmt.Errorf("failed to list chunks: %w", err)
+	}
+	for _, item := range items {
+		hash := path.Base(item)
+		if isChunkHash(hash) {
+			s.known[hash] = struct{}{}
+		}
+	}
+	s.loaded = true
+	return nil
+}
+
+// storeFileChunks splits the file at sourcePath into chunks and stores any
+// that are not already present. It returns the chunk list, the SHA-256 of
+// the whole file and the number of bytes that had to be uploaded.
+func storeFileChunks(store *ChunkStore, sourcePath string) ([]ChunkRef, string, int64, error) {
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+
+	var refs []ChunkRef
+	var uploaded int64
+	fileHash := sha256.New()
+	chunker := NewChunker(io.TeeReader(file, fileHash))
+	for {
+		data, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", uploaded, fmt.Errorf("failed to read source file: %w", err)
+		}
+		ref, stored, err := store.Put(data)
+		if err != nil {
+			return nil, "", uploaded, err
+		}
+		if stored {
+			uploaded += ref.Size
+		}
+		refs = append(refs, ref)
+	}
+	return refs, hex.EncodeToString(fileHash.Sum(nil)), uploaded, nil
+}
+
+func chunkKey(hash string) string {
+	return path.Join(chunkRootDir, hash[:2], hash)
+}
+
+func isChunkHash(value string) bool {
+	if len(value) != sha256.Size*2 {
+		return false
+	}
+	return strings.Trim(value, "0123456789abcdef") == ""
+}
+
+func (s *ChunkStore) chunkID(data []byte) string {
+	if s.encryptor != nil {
+		return s.encryptor.chunkID(data)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeChunkObject compresses (and, with an encryptor, seals) a chunk into a
+// temp file ready for upload.
+func (s *ChunkStore) writeChunkObject(hash string, data []byte) (string, error) {
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	_, err := gzipWriter.Write(data)
+	closeErr := gzipWriter.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to compress chunk: %w", err)
+	}
+
+	object := compressed.Bytes()
+	if s.encryptor != nil {
+		object, err = s.encryptor.sealChunk(hash, object)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt chunk: %w", err)
+		}
+	}
+
+	tempFile, err := os.CreateTemp("", "backup-chunk-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp chunk: %w", err)
+	}
+	tempPath := tempFile.Name()
+	_, err = tempFile.Write(object)
+	closeErr = tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to write temp chunk: %w", err)
+	}
+	return tempPath, nil
+}
+
+// openChunkObject decrypts (when needed), decompresses and verifies a
+// downloaded chunk object.
+func (s *ChunkStore) openChunkObject(hash string, object []byte) ([]byte, error) {
+	encrypted := isEncryptedChunk(object)
+	compressed := object
+	if encrypted {
+		if s.encryptor == nil {
+			return nil, fmt.Errorf("%w: chunk %s", ErrEncryptionKeyRequired, hash)
+		}
+		var err error
+		compressed, err = s.encryptor.openChunk(hash, object)
+		if err != nil {
+			return nil, err
+		}
+	} else if s.encryptor != nil && !s.encryptor.allowPlaintext {
+		return nil, fmt.Errorf("%w: chunk %s", ErrUnencryptedData, hash)
+	}
+
+	data, err := decompressChunk(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk %s: %w", hash, err)
+	}
+
+	var actual string
+	if encrypted {
+		actual = s.encryptor.chunkID(data)
+	} else {
+		sum := sha256.Sum256(data)
+		actual = hex.EncodeToString(sum[:])
+	}
+	if actual != hash {
+		return nil, fmt.Errorf("chunk %s failed hash verification", hash)
+	}
+	return data, nil
+}
+
+func decompressChunk(compressed []byte) ([]byte, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	// A valid chunk never exceeds maxChunkSize; read one extra byte so an
+	// oversized payload is detected instead of silently truncated.
+	data, err := io.ReadAll(io.LimitReader(gzipReader, maxChunkSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxChunkSize {
+		return nil, errors.New("chunk exceeds maximum size")
+	}
+	return data, nil
+}
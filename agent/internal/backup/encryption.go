@@ -0,0 +1,480 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+const (
+	masterKeySize = 32
+
+	keyEscrowRootDir        = "keys"
+	encryptedManifestFormat = "breeze-encrypted-manifest-v1"
+	escrowAlgorithm         = "RSA-OAEP-256"
+
+	// restoreKeyLabel is the OAEP label for master keys wrapped to an
+	// agent's restore key, kept distinct from escrow wrapping so one
+	// ciphertext cannot stand in for the other.
+	restoreKeyLabel = "breeze-backup-restore-v1"
+	restoreKeyBits  = 3072
+)
+
+// encryptedChunkMagic prefixes every encrypted chunk object so restores can
+// tell encrypted and plaintext chunks apart without consulting the manifest.
+var encryptedChunkMagic = []byte("BZE1")
+
+var (
+	// ErrEncryptionKeyRequired is returned when encrypted backup data is read
+	// without an encryption key.
+	ErrEncryptionKeyRequired = errors.New("backup is encrypted and no encryption key is configured")
+	// ErrWrongEncryptionKey is returned when encrypted backup data cannot be
+	// decrypted with the configured key.
+	ErrWrongEncryptionKey = errors.New("backup encryption key does not match")
+	// ErrUnencryptedData is returned when a plaintext manifest or chunk is
+	// read while encryption is enabled and plaintext data is not allowed.
+	ErrUnencryptedData = errors.New("backup data is not encrypted")
+)
+
+// Encryptor encrypts backup chunks and manifests with keys derived from a
+// single master key.
+//
+// Chunk content is sealed with a master-derived key and addressed by an HMAC
+// of its plaintext, so deduplication keeps working across snapshots without
+// exposing plaintext hashes. Each manifest is sealed with a random
+// per-snapshot data key that is itself wrapped with the master key.
+type Encryptor struct {
+	keyID    string
+	chunkKey []byte
+	idKey    []byte
+	wrapKey  []byte
+
+	// allowPlaintext accepts unencrypted manifests and chunks on read.
+	allowPlaintext bool
+}
+
+// KeyEscrow is a master key wrapped with an org escrow public key. Only the
+// holder of the matching private key can recover the master key, so the
+// record can be stored alongside backups and reported to the server.
+type KeyEscrow struct {
+	KeyID                string    `json:"keyId"`
+	Algorithm            string    `json:"algorithm"`
+	WrappedKey           string    `json:"wrappedKey"`
+	EscrowKeyFingerprint string    `json:"escrowKeyFingerprint"`
+	CreatedAt            time.Time `json:"createdAt"`
+	// RestorePublicKey is the PEM public key of the agent's restore key.
+	// To read another key's snapshots on this agent, the escrow holder
+	// wraps that master key to it with WrapMasterKeyForRestore.
+	RestorePublicKey string `json:"restorePublicKey,omitempty"`
+}
+
+// encryptedManifest is the on-store form of an encrypted snapshot manifest.
+// Only the snapshot ID and timestamp are visible without the key, which is
+// enough for listing and retention.
+type encryptedManifest struct {
+	Format     string    `json:"format"`
+	SnapshotID string    `json:"snapshotId"`
+	Timestamp  time.Time `json:"timestamp"`
+	KeyID      string    `json:"keyId"`
+	WrappedKey string    `json:"wrappedKey"`
+	Ciphertext string    `json:"ciphertext"`
+}
+
+// NewEncryptor derives backup keys from a 32-byte master key.
+func NewEncryptor(masterKey []byte) (*Encryptor, error) {
+	if len(masterKey) != masterKeySize {
+		return nil, fmt.Errorf("backup master key must be %d bytes, got %d", masterKeySize, len(masterKey))
+	}
+
+	derive := func(info string) ([]byte, error) {
+		return hkdf.Key(sha256.New, masterKey, nil, info, 32)
+	}
+	chunkKey, err := derive("breeze-backup-chunk-v1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive chunk key: %w", err)
+	}
+	idKey, err := derive("breeze-backup-chunk-id-v1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive chunk id key: %w", err)
+	}
+	wrapKey, err := derive("breeze-backup-key-wrap-v1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key wrapping key: %w", err)
+	}
+
+	return &Encryptor{
+		keyID:    masterKeyID(masterKey),
+		chunkKey: chunkKey,
+		idKey:    idKey,
+		wrapKey:  wrapKey,
+	}, nil
+}
+
+// AllowPlaintext controls whether unencrypted manifests and chunks written
+// before encryption was enabled may still be read. It is off by default:
+// plaintext objects carry no authentication, so anyone able to write to the
+// backup store could otherwise substitute their own manifests.
+func (e *Encryptor) AllowPlaintext(allow bool) {
+	e.allowPlaintext = allow
+}
+
+// KeyID returns a stable, non-secret identifier for the master key.
+func (e *Encryptor) KeyID() string {
+	return e.keyID
+}
+
+// DecodeMasterKey parses a base64-encoded master key.
+func DecodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 backup master key: %w", err)
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("backup master key must decode to %d bytes", masterKeySize)
+	}
+	return key, nil
+}
+
+// LoadOrCreateMasterKey reads the master key stored at keyPath, generating
+// and persisting a new one if the file does not exist.
+func LoadOrCreateMasterKey(keyPath string) ([]byte, error) {
+	data, err := os.ReadFile(keyPath)
+	if err == nil {
+		return DecodeMasterKey(string(data))
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read backup master key: %w", err)
+	}
+
+	key := make([]byte, masterKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate backup master key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup key directory: %w", err)
+	}
+
+	tempPath := keyPath + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(base64.StdEncoding.EncodeToString(key)), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write backup master key: %w", err)
+	}
+	if err := os.Rename(tempPath, keyPath); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to persist backup master key: %w", err)
+	}
+	return key, nil
+}
+
+// EscrowMasterKey wraps masterKey with the PEM-encoded RSA public key.
+func EscrowMasterKey(masterKey []byte, publicKeyPEM string) (*KeyEscrow, error) {
+	publicKey, der, err := parseRSAPublicKeyPEM(publicKeyPEM, "escrow")
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, masterKey, []byte(escrowAlgorithm))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap master key for escrow: %w", err)
+	}
+	fingerprint := sha256.Sum256(der)
+
+	return &KeyEscrow{
+		KeyID:                masterKeyID(masterKey),
+		Algorithm:            escrowAlgorithm,
+		WrappedKey:           base64.StdEncoding.EncodeToString(wrapped),
+		EscrowKeyFingerprint: hex.EncodeToString(fingerprint[:]),
+		CreatedAt:            time.Now().UTC(),
+	}, nil
+}
+
+// parseRSAPublicKeyPEM parses a PKIX or PKCS#1 RSA public key of at least
+// 2048 bits. what names the key in errors.
+func parseRSAPublicKeyPEM(publicKeyPEM, what string) (*rsa.PublicKey, []byte, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, nil, fmt.Errorf("%s public key is not valid PEM", what)
+	}
+
+	var publicKey *rsa.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s public key: %w", what, err)
+		}
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s public key must be an RSA key", what)
+		}
+		publicKey = rsaKey
+	case "RSA PUBLIC KEY":
+		parsed, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s public key: %w", what, err)
+		}
+		publicKey = parsed
+	default:
+		return nil, nil, fmt.Errorf("unsupported %s key type %q", what, block.Type)
+	}
+	if publicKey.N.BitLen() < 2048 {
+		return nil, nil, fmt.Errorf("%s public key must be at least 2048 bits", what)
+	}
+	return publicKey, block.Bytes, nil
+}
+
+// LoadOrCreateRestoreKey reads the agent's RSA restore key from keyPath,
+// generating and persisting one if the file does not exist. Master keys
+// for restores are delivered wrapped to it, so they never travel in the
+// clear.
+func LoadOrCreateRestoreKey(keyPath string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("backup restore key is not valid PEM")
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse backup restore key: %w", err)
+		}
+		key, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("backup restore key must be an RSA key")
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read backup restore key: %w", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, restoreKeyBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate backup restore key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode backup restore key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create backup key directory: %w", err)
+	}
+	tempPath := keyPath + ".tmp"
+	if err := os.WriteFile(tempPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write backup restore key: %w", err)
+	}
+	if err := os.Rename(tempPath, keyPath); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("failed to persist backup restore key: %w", err)
+	}
+	return key, nil
+}
+
+// RestorePublicKeyPEM returns the PEM public half of a restore key.
+func RestorePublicKeyPEM(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode backup restore public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// WrapMasterKeyForRestore wraps masterKey to an agent's restore public key,
+// returning the base64 value a restore command carries.
+func WrapMasterKeyForRestore(masterKey []byte, restorePublicKeyPEM string) (string, error) {
+	publicKey, _, err := parseRSAPublicKeyPEM(restorePublicKeyPEM, "restore")
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, masterKey, []byte(restoreKeyLabel))
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap master key for restore: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// UnwrapMasterKeyForRestore recovers a master key wrapped to key.
+func UnwrapMasterKeyForRestore(key *rsa.PrivateKey, wrapped string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimSpace(wrapped))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64 wrapped backup key: %w", err)
+	}
+	masterKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, ciphertext, []byte(restoreKeyLabel))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrapped key was not wrapped to this agent's restore key", ErrWrongEncryptionKey)
+	}
+	if len(masterKey) != masterKeySize {
+		return nil, fmt.Errorf("backup master key must be %d bytes, got %d", masterKeySize, len(masterKey))
+	}
+	return masterKey, nil
+}
+
+// StoreKeyEscrow uploads the escrow record to keys/<keyId>.json so anyone
+// holding the escrow private key can recover the master key from the backup
+// store alone.
+func StoreKeyEscrow(provider providers.BackupProvider, escrow *KeyEscrow) error {
+	if provider == nil {
+		return errors.New("backup provider is required")
+	}
+	tempFile, err := os.CreateTemp("", "backup-escrow-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create escrow record: %w", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+
+	encodeErr := json.NewEncoder(tempFile).Encode(escrow)
+	closeErr := tempFile.Close()
+	if encodeErr != nil {
+		return fmt.Errorf("failed to encode escrow record: %w", encodeErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close escrow record: %w", closeErr)
+	}
+
+	key := path.Join(keyEscrowRootDir, escrow.KeyID+".json")
+	if err := provider.Upload(tempPath, key); err != nil {
+		return fmt.Errorf("failed to upload escrow record: %w", err)
+	}
+	return nil
+}
+
+// chunkID returns the storage address for a plaintext chunk.
+func (e *Encryptor) chunkID(data []byte) string {
+	mac := hmac.New(sha256.New, e.idKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sealChunk encrypts a compressed chunk. The chunk address is bound as
+// additional data so chunks cannot be swapped between addresses.
+func (e *Encryptor) sealChunk(hash string, compressed []byte) ([]byte, error) {
+	sealed, err := sealAESGCM(e.chunkKey, compressed, []byte(hash))
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, encryptedChunkMagic...), sealed...), nil
+}
+
+// openChunk decrypts an encrypted chunk object.
+func (e *Encryptor) openChunk(hash string, object []byte) ([]byte, error) {
+	plain, err := openAESGCM(e.chunkKey, object[len(encryptedChunkMagic):], []byte(hash))
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %s could not be decrypted", ErrWrongEncryptionKey, hash)
+	}
+	return plain, nil
+}
+
+// sealManifest encrypts manifest JSON under a fresh per-snapshot data key.
+func (e *Encryptor) sealManifest(snapshot *Snapshot, manifestJSON []byte) (*encryptedManifest, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate snapshot data key: %w", err)
+	}
+	aad := []byte(snapshot.ID)
+
+	wrappedKey, err := sealAESGCM(e.wrapKey, dataKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := sealAESGCM(dataKey, manifestJSON, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedManifest{
+		Format:     encryptedManifestFormat,
+		SnapshotID: snapshot.ID,
+		Timestamp:  snapshot.Timestamp,
+		KeyID:      e.keyID,
+		WrappedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// openManifest decrypts an encrypted manifest and returns the manifest JSON.
+func (e *Encryptor) openManifest(envelope *encryptedManifest) ([]byte, error) {
+	if envelope.KeyID != "" && envelope.KeyID != e.keyID {
+		return nil, fmt.Errorf("%w: snapshot %s was encrypted with key %s, configured key is %s",
+			ErrWrongEncryptionKey, envelope.SnapshotID, envelope.KeyID, e.keyID)
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(envelope.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key in manifest: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest ciphertext: %w", err)
+	}
+	aad := []byte(envelope.SnapshotID)
+
+	dataKey, err := openAESGCM(e.wrapKey, wrappedKey, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: snapshot %s data key could not be unwrapped", ErrWrongEncryptionKey, envelope.SnapshotID)
+	}
+	plain, err := openAESGCM(dataKey, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s manifest failed authentication: %w", envelope.SnapshotID, err)
+	}
+	return plain, nil
+}
+
+func isEncryptedChunk(object []byte) bool {
+	return bytes.HasPrefix(object, encryptedChunkMagic)
+}
+
+func masterKeyID(masterKey []byte) string {
+	sum := sha256.Sum256(append([]byte("breeze-backup-key-id-v1:"), masterKey...))
+	return hex.EncodeToString(sum[:8])
+}
+
+func sealAESGCM(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GCM: %w", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func openAESGCM(key, sealed, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GCM: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, aad)
+}
@@ -0,0 +1,217 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+func newTestEncryptor(t *testing.T) (*Encryptor, []byte) {
+	t.Helper()
+	masterKey, err := LoadOrCreateMasterKey(filepath.Join(t.TempDir(), "backup_master.key"))
+	if err != nil {
+		t.Fatalf("failed to create master key: %v", err)
+	}
+	encryptor, err := NewEncryptor(masterKey)
+	if err != nil {
+		t.Fatalf("failed to create encryptor: %v", err)
+	}
+	return encryptor, masterKey
+}
+
+func TestEncryptedSnapshotRoundTrip(t *testing.T) {
+	srcDir := t.TempDir()
+	storeDir := t.TempDir()
+	provider := providers.NewLocalProvider(storeDir)
+	encryptor, _ := newTestEncryptor(t)
+
+	content := []byte("quarterly payroll figures that must not leave the endpoint in clear text")
+	if err := os.WriteFile(filepath.Join(srcDir, "payroll-secret.csv"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}, Encryptor: encryptor})
+	job, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	// Neither file content nor source paths may appear in the store.
+	err = filepath.WalkDir(storeDir, func(path string, entry os.DirEntry, walkErr error) error {
+		if walkErr != nil || entry.IsDir() {
+			return walkErr
+		}
+		raw, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return readErr
+		}
+		if bytes.Contains(raw, []byte("payroll")) {
+			t.Errorf("plaintext leaked into %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restoreDir := t.TempDir()
+	result, err := RestoreSnapshot(provider, encryptor, job.Snapshot.ID, restoreDir, nil)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if result.FilesRestored != 1 || len(result.Errors) > 0 {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+	restored, err := os.ReadFile(filepath.Join(restoreDir, "files", "path_0", "payroll-secret.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, content) {
+		t.Fatal("restored content does not match source")
+	}
+}
+
+func TestEncryptedSnapshotRejectsMissingOrWrongKey(t *testing.T) {
+	srcDir := t.TempDir()
+	provider := providers.NewLocalProvider(t.TempDir())
+	encryptor, _ := newTestEncryptor(t)
+	otherEncryptor, _ := newTestEncryptor(t)
+
+	if err := os.WriteFile(filepath.Join(srcDir, "data.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}, Encryptor: encryptor})
+	job, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	if _, err := RestoreSnapshot(provider, nil, job.Snapshot.ID, t.TempDir(), nil); !errors.Is(err, ErrEncryptionKeyRequired) {
+		t.Fatalf("expected ErrEncryptionKeyRequired, got %v", err)
+	}
+	if _, err := RestoreSnapshot(provider, otherEncryptor, job.Snapshot.ID, t.TempDir(), nil); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Fatalf("expected ErrWrongEncryptionKey, got %v", err)
+	}
+
+	// Listing without the key still shows the snapshot header.
+	snapshots, err := ListSnapshots(provider, nil)
+	if !errors.Is(err, ErrEncryptionKeyRequired) {
+		t.Fatalf("expected list to report missing key, got %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != job.Snapshot.ID || !snapshots[0].Encrypted {
+		t.Fatalf("expected encrypted snapshot header, got %+v", snapshots)
+	}
+}
+
+func TestEncryptorRejectsPlaintextSnapshotUnlessAllowed(t *testing.T) {
+	srcDir := t.TempDir()
+	provider := providers.NewLocalProvider(t.TempDir())
+	encryptor, _ := newTestEncryptor(t)
+
+	if err := os.WriteFile(filepath.Join(srcDir, "data.txt"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A snapshot written without encryption, as an attacker with write
+	// access to the store (or an agent before encryption was enabled) would.
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}})
+	job, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+
+	if _, err := RestoreSnapshot(provider, encryptor, job.Snapshot.ID, t.TempDir(), nil); !errors.Is(err, ErrUnencryptedData) {
+		t.Fatalf("expected ErrUnencryptedData, got %v", err)
+	}
+	store := NewChunkStore(provider, encryptor)
+	if _, err := store.Get(job.Snapshot.Files[0].Chunks[0].Hash); !errors.Is(err, ErrUnencryptedData) {
+		t.Fatalf("expected plaintext chunk to be rejected, got %v", err)
+	}
+
+	encryptor.AllowPlaintext(true)
+	result, err := RestoreSnapshot(provider, encryptor, job.Snapshot.ID, t.TempDir(), nil)
+	if err != nil || result.FilesRestored != 1 {
+		t.Fatalf("expected legacy restore to succeed, got %+v, %v", result, err)
+	}
+}
+
+func TestEscrowMasterKeyUnwrapsWithPrivateKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	encryptor, masterKey := newTestEncryptor(t)
+	escrow, err := EscrowMasterKey(masterKey, publicPEM)
+	if err != nil {
+		t.Fatalf("escrow failed: %v", err)
+	}
+	if escrow.KeyID != encryptor.KeyID() {
+		t.Fatalf("escrow key id %s does not match encryptor %s", escrow.KeyID, encryptor.KeyID())
+	}
+	if strings.Contains(escrow.WrappedKey, base64.StdEncoding.EncodeToString(masterKey)) {
+		t.Fatal("escrow record contains the plaintext master key")
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(escrow.WrappedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, wrapped, []byte(escrowAlgorithm))
+	if err != nil {
+		t.Fatalf("failed to unwrap escrowed key: %v", err)
+	}
+	if !bytes.Equal(unwrapped, masterKey) {
+		t.Fatal("unwrapped key does not match master key")
+	}
+}
+
+func TestRestoreKeyUnwrapsOnlyKeysWrappedToIt(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "backup_restore_key.pem")
+	restoreKey, err := LoadOrCreateRestoreKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadOrCreateRestoreKey(keyPath)
+	if err != nil || !reloaded.Equal(restoreKey) {
+		t.Fatalf("restore key not persisted: %v", err)
+	}
+	publicPEM, err := RestorePublicKeyPEM(restoreKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, masterKey := newTestEncryptor(t)
+	wrapped, err := WrapMasterKeyForRestore(masterKey, publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := UnwrapMasterKeyForRestore(restoreKey, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, masterKey) {
+		t.Fatalf("unwrap = %v, %v", unwrapped, err)
+	}
+
+	// An escrow record wrapped to the same key pair is not a restore key.
+	escrow, err := EscrowMasterKey(masterKey, publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnwrapMasterKeyForRestore(restoreKey, escrow.WrappedKey); !errors.Is(err, ErrWrongEncryptionKey) {
+		t.Fatalf("expected ErrWrongEncryptionKey for an escrow record, got %v", err)
+	}
+}
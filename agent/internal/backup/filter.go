@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// fileFilter decides which files under a backup root are included.
+//
+// Patterns use path.Match syntax. A pattern without a slash is matched
+// against every path element, so "node_modules" skips the directory wherever
+// it appears and "*.tmp" matches any file with that extension. A pattern
+// with a slash is matched against the path relative to the backup root,
+// where a "**" element matches any number of directories.
+type fileFilter struct {
+	include     []string
+	exclude     []string
+	maxFileSize int64
+}
+
+func newFileFilter(include, exclude []string, maxFileSize int64) (*fileFilter, error) {
+	for _, pattern := range append(append([]string(nil), include...), exclude...) {
+		for _, elem := range strings.Split(pattern, "/") {
+			if _, err := path.Match(elem, ""); err != nil {
+				return nil, fmt.Errorf("invalid backup pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return &fileFilter{
+		include:     include,
+		exclude:     exclude,
+		maxFileSize: maxFileSize,
+	}, nil
+}
+
+// skipDir reports whether the directory at rel (slash-separated, relative
+// to the backup root) is excluded and need not be walked.
+func (f *fileFilter) skipDir(rel string) bool {
+	return matchAnyPattern(f.exclude, rel)
+}
+
+// includeFile reports whether the file at rel should be backed up. The
+// second return value is true when the file was skipped only because it
+// exceeds the size limit.
+func (f *fileFilter) includeFile(rel string, size int64) (bool, bool) {
+	if matchAnyPattern(f.exclude, rel) {
+		return false, false
+	}
+	if len(f.include) > 0 && !matchAnyPattern(f.include, rel) {
+		return false, false
+	}
+	if f.maxFileSize > 0 && size > f.maxFileSize {
+		return false, true
+	}
+	return true, false
+}
+
+func matchAnyPattern(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern, rel string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, elem := range elems {
+			if ok, _ := path.Match(pattern, elem); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return matchElems(strings.Split(pattern, "/"), elems)
+}
+
+// matchElems matches path elements against pattern elements, treating a
+// "**" pattern element as zero or more path elements.
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
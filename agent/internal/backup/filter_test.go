@@ -0,0 +1,59 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCollectBackupFilesAppliesFilters(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]int{
+		"report.docx":                   10,
+		"~$report.docx":                 1,
+		"scratch.tmp":                   1,
+		"app/node_modules/lib/index.js": 1,
+		"app/src/main.js":               1,
+		"app/build/out.bin":             1,
+		"video/big.mp4":                 4096,
+	}
+	for rel, size := range files {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mgr := NewBackupManager(BackupConfig{
+		Paths:       []string{root},
+		Exclude:     []string{"node_modules", "*.tmp", "~$*", "app/build/**"},
+		MaxFileSize: 1024,
+	})
+	collected, err := mgr.collectBackupFiles(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range collected {
+		got = append(got, file.snapshotPath)
+	}
+	sort.Strings(got)
+	want := []string{"path_0/app/src/main.js", "path_0/report.docx"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("collected %v, want %v", got, want)
+	}
+
+	mgr.config.Include = []string{"*.js"}
+	collected, err = mgr.collectBackupFiles(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collected) != 1 || collected[0].snapshotPath != "path_0/app/src/main.js" {
+		t.Fatalf("include filter collected %v", collected)
+	}
+}
@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	HookPhasePre  = "pre"
+	HookPhasePost = "post"
+)
+
+// BackupHook is a script run before or after a backup to make the data
+// application-consistent, e.g. flush and freeze a database, take an LVM or
+// filesystem snapshot and mount it, then unmount and thaw afterwards.
+type BackupHook struct {
+	Name       string
+	ScriptType string
+	Script     string
+	// Timeout of zero uses the runner's default.
+	Timeout time.Duration
+	RunAs   string
+}
+
+// HookResult records the outcome of one hook run.
+type HookResult struct {
+	Name        string    `json:"name"`
+	Phase       string    `json:"phase"`
+	ExitCode    int       `json:"exitCode"`
+	Stdout      string    `json:"stdout,omitempty"`
+	Stderr      string    `json:"stderr,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	TimedOut    bool      `json:"timedOut,omitempty"`
+	StartedAt   time.Time `json:"startedAt"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// Failed reports whether the hook timed out, could not run or exited
+// non-zero.
+func (r HookResult) Failed() bool {
+	return r.TimedOut || r.Error != "" || r.ExitCode != 0
+}
+
+func (r HookResult) failure() string {
+	switch {
+	case r.TimedOut:
+		return "timed out"
+	case r.Error != "":
+		return r.Error
+	default:
+		return fmt.Sprintf("exited with code %d", r.ExitCode)
+	}
+}
+
+// HookRunner executes a hook script. params describe the backup job and
+// are exposed to the script by the runner (the script executor makes them
+// available as BREEZE_PARAM_* environment variables).
+type HookRunner func(hook BackupHook, params map[string]string) HookResult
+
+// SnapshotMount redirects backup reads to a mounted volume snapshot. Files
+// under Source are read from the same relative path below MountPoint, while
+// the manifest keeps their original paths so restores go back to the live
+// location. An empty Source means the snapshot is of the filesystem root.
+type SnapshotMount struct {
+	Source     string
+	MountPoint string
+}
+
+// Enabled reports whether reads are redirected.
+func (s SnapshotMount) Enabled() bool {
+	return s.MountPoint != ""
+}
+
+// readPath returns the path a file at path should be read from.
+func (s SnapshotMount) readPath(path string) string {
+	if !s.Enabled() {
+		return path
+	}
+	source := s.Source
+	if source == "" {
+		source = string(filepath.Separator)
+		if vol := filepath.VolumeName(path); vol != "" {
+			source = vol + source
+		}
+	}
+	rel, err := filepath.Rel(filepath.Clean(source), filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(s.MountPoint, rel)
+}
+
+// runHooks runs the hooks for a phase, appending their results to the job.
+// Pre hooks stop at the first failure; post hooks all run so that every
+// cleanup step gets a chance.
+func (m *BackupManager) runHooks(job *BackupJob, phase string, hooks []BackupHook) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	if m.config.HookRunner == nil {
+		return fmt.Errorf("%s-backup hooks are configured but no hook runner is available", phase)
+	}
+
+	params := map[string]string{
+		"backup_job_id": job.ID,
+		"backup_mode":   job.Mode,
+		"backup_phase":  phase,
+	}
+	if m.config.SnapshotMount.Enabled() {
+		params["snapshot_mount_point"] = m.config.SnapshotMount.MountPoint
+		params["snapshot_source"] = m.config.SnapshotMount.Source
+	}
+	if phase == HookPhasePost {
+		params["backup_status"] = job.Status
+	}
+
+	var errs []error
+	for idx, hook := range hooks {
+		name := hook.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", phase, idx+1)
+			hook.Name = name
+		}
+		result := m.config.HookRunner(hook, params)
+		result.Name = name
+		result.Phase = phase
+		job.HookResults = append(job.HookResults, result)
+		if !result.Failed() {
+			log.Printf("[backup] %s-backup hook %q completed", phase, name)
+			continue
+		}
+
+		err := fmt.Errorf("%s-backup hook %q %s", phase, name, result.failure())
+		log.Printf("[backup] %v", err)
+		if phase == HookPhasePre {
+			return err
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// checkSnapshotMount verifies that the pre hooks left a snapshot mounted.
+// Reading the live files instead would silently defeat the hooks.
+func (m *BackupManager) checkSnapshotMount() error {
+	if !m.config.SnapshotMount.Enabled() {
+		return nil
+	}
+	info, err := os.Stat(m.config.SnapshotMount.MountPoint)
+	if err != nil {
+		return fmt.Errorf("snapshot mount point unavailable: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("snapshot mount point %s is not a directory", m.config.SnapshotMount.MountPoint)
+	}
+	// The directory exists whether or not a pre hook mounted anything.
+	mounted, err := m.isMountPoint(m.config.SnapshotMount.MountPoint)
+	if err != nil {
+		return fmt.Errorf("snapshot mount point unavailable: %w", err)
+	}
+	if !mounted {
+		return fmt.Errorf("nothing is mounted at snapshot mount point %s", m.config.SnapshotMount.MountPoint)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+// fakeHookRunner records hook invocations and fails the named hooks.
+type fakeHookRunner struct {
+	calls  []string
+	params []map[string]string
+	fail   map[string]HookResult
+	// onRun, if set, is called for each hook before its result is returned.
+	onRun func(hook BackupHook)
+}
+
+func (f *fakeHookRunner) run(hook BackupHook, params map[string]string) HookResult {
+	f.calls = append(f.calls, params["backup_phase"]+":"+hook.Name)
+	f.params = append(f.params, params)
+	if f.onRun != nil {
+		f.onRun(hook)
+	}
+	if result, ok := f.fail[hook.Name]; ok {
+		return result
+	}
+	return HookResult{}
+}
+
+func TestRunBackupReadsFromSnapshotMount(t *testing.T) {
+	liveDir := t.TempDir()
+	mountDir := t.TempDir()
+	dataDir := filepath.Join(liveDir, "db")
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "data.db"), []byte("live, mid-write"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pre hook stands in for freezing the database and mounting a
+	// consistent snapshot of liveDir at mountDir.
+	mounted := false
+	runner := &fakeHookRunner{onRun: func(hook BackupHook) {
+		if hook.Name != "snapshot" {
+			return
+		}
+		mounted = true
+		if err := os.MkdirAll(filepath.Join(mountDir, "db"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(mountDir, "db", "data.db"), []byte("consistent"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}}
+	provider := providers.NewLocalProvider(t.TempDir())
+	mgr := NewBackupManager(BackupConfig{
+		Provider:      provider,
+		Paths:         []string{dataDir},
+		PreHooks:      []BackupHook{{Name: "freeze"}, {Name: "snapshot"}},
+		PostHooks:     []BackupHook{{Name: "thaw"}},
+		HookRunner:    runner.run,
+		SnapshotMount: SnapshotMount{Source: liveDir, MountPoint: mountDir},
+	})
+	mgr.isMountPoint = func(dir string) (bool, error) { return mounted && dir == mountDir, nil }
+
+	job, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	if got := strings.Join(runner.calls, ","); got != "pre:freeze,pre:snapshot,post:thaw" {
+		t.Fatalf("hooks ran as %s", got)
+	}
+	if len(job.HookResults) != 3 || job.HookResults[2].Phase != HookPhasePost {
+		t.Fatalf("unexpected hook results %+v", job.HookResults)
+	}
+	if runner.params[0]["snapshot_mount_point"] != mountDir || runner.params[2]["backup_status"] != jobStatusCompleted {
+		t.Fatalf("unexpected hook params %+v", runner.params)
+	}
+
+	if len(job.Snapshot.Files) != 1 || job.Snapshot.Files[0].SourcePath != filepath.Join(dataDir, "data.db") {
+		t.Fatalf("manifest should record the live path, got %+v", job.Snapshot.Files)
+	}
+	restoreDir := t.TempDir()
+	if _, err := RestoreSnapshot(provider, nil, job.Snapshot.ID, restoreDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(restoreDir, "files", "path_0", "data.db")); got != "consistent" {
+		t.Fatalf("backed up %q, want the snapshot copy", got)
+	}
+}
+
+func TestRunBackupAbortsWhenPreHookFails(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runner := &fakeHookRunner{fail: map[string]HookResult{
+		"freeze": {ExitCode: -1, TimedOut: true},
+		"thaw":   {ExitCode: 3},
+	}}
+	provider := providers.NewLocalProvider(t.TempDir())
+	mgr := NewBackupManager(BackupConfig{
+		Provider:   provider,
+		Paths:      []string{srcDir},
+		PreHooks:   []BackupHook{{Name: "freeze"}, {Name: "snapshot"}},
+		PostHooks:  []BackupHook{{Name: "thaw"}, {Name: "cleanup"}},
+		HookRunner: runner.run,
+	})
+
+	job, err := mgr.RunBackup()
+	if err == nil || !strings.Contains(err.Error(), `pre-backup hook "freeze" timed out`) {
+		t.Fatalf("expected a pre-hook timeout error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `post-backup hook "thaw" exited with code 3`) {
+		t.Fatalf("expected the post-hook failure to be reported, got %v", err)
+	}
+	if job.Status != jobStatusFailed || job.Snapshot != nil {
+		t.Fatalf("expected a failed job without a snapshot, got %+v", job)
+	}
+	if got := strings.Join(runner.calls, ","); got != "pre:freeze,post:thaw,post:cleanup" {
+		t.Fatalf("hooks ran as %s", got)
+	}
+	if !job.HookResults[0].TimedOut || !job.HookResults[1].Failed() || job.HookResults[2].Failed() {
+		t.Fatalf("unexpected hook results %+v", job.HookResults)
+	}
+	if snapshots, _ := ListSnapshots(provider, nil); len(snapshots) != 0 {
+		t.Fatalf("expected no snapshots, found %d", len(snapshots))
+	}
+}
+
+func TestRunBackupFailsWhenSnapshotMountMissing(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewBackupManager(BackupConfig{
+		Provider:      providers.NewLocalProvider(t.TempDir()),
+		Paths:         []string{srcDir},
+		SnapshotMount: SnapshotMount{MountPoint: filepath.Join(t.TempDir(), "not-mounted")},
+	})
+	job, err := mgr.RunBackup()
+	if err == nil || job.Status != jobStatusFailed {
+		t.Fatalf("expected the backup to fail rather than read live files, got %+v, %v", job, err)
+	}
+}
+
+func TestRunBackupFailsWhenNothingIsMounted(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The mount point exists, but the pre hook never mounted a snapshot.
+	mountDir := filepath.Join(t.TempDir(), "snapshot")
+	if err := os.MkdirAll(mountDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewBackupManager(BackupConfig{
+		Provider:      providers.NewLocalProvider(t.TempDir()),
+		Paths:         []string{srcDir},
+		SnapshotMount: SnapshotMount{MountPoint: mountDir},
+	})
+	job, err := mgr.RunBackup()
+	if err == nil || !strings.Contains(err.Error(), "nothing is mounted") || job.Status != jobStatusFailed {
+		t.Fatalf("expected the backup to fail on an unmounted directory, got %+v, %v", job, err)
+	}
+}
+
+func TestIsMountPoint(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.VolumeName(dir) + string(filepath.Separator)
+	if mounted, err := isMountPoint(root); err != nil || !mounted {
+		t.Fatalf("isMountPoint(%s) = %v, %v; want true", root, mounted, err)
+	}
+	plain := filepath.Join(dir, "plain")
+	if err := os.Mkdir(plain, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if mounted, err := isMountPoint(plain); err != nil || mounted {
+		t.Fatalf("isMountPoint(%s) = %v, %v; want false", plain, mounted, err)
+	}
+}
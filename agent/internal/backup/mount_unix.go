@@ -0,0 +1,68 @@
+//go:build !windows
+
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// isMountPoint reports whether a filesystem is mounted at dir: its device
+// differs from its parent's, it is the root, or mountinfo lists it (which
+// also catches bind mounts from the same device).
+func isMountPoint(dir string) (bool, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false, err
+	}
+	var self, parent syscall.Stat_t
+	if err := syscall.Stat(dir, &self); err != nil {
+		return false, fmt.Errorf("stat %s: %w", dir, err)
+	}
+	if err := syscall.Stat(filepath.Dir(dir), &parent); err != nil {
+		return false, fmt.Errorf("stat %s: %w", filepath.Dir(dir), err)
+	}
+	if self.Dev != parent.Dev || self.Ino == parent.Ino {
+		return true, nil
+	}
+
+	mountinfo, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		// Not Linux, or /proc is unavailable.
+		return false, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(mountinfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 5 && unescapeMountinfo(fields[4]) == dir {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// unescapeMountinfo decodes the octal escapes mountinfo uses for spaces,
+// tabs, newlines and backslashes.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package backup
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// isMountPoint reports whether dir is a volume root or a reparse point,
+// which is how shadow copies and volume mount points are exposed.
+func isMountPoint(dir string) (bool, error) {
+	dir = filepath.Clean(dir)
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return false, err
+	}
+	attrs, err := windows.GetFileAttributes(name)
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", dir, err)
+	}
+	if attrs&windows.FILE_ATTRIBUTE_REPARSE_POINT != 0 {
+		return true, nil
+	}
+	volume := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumePathName(name, &volume[0], uint32(len(volume))); err != nil {
+		return false, fmt.Errorf("volume of %s: %w", dir, err)
+	}
+	root := strings.TrimSuffix(windows.UTF16ToString(volume), `\`)
+	return strings.EqualFold(root, strings.TrimSuffix(dir, `\`)), nil
+}
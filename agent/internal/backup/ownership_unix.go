@@ -0,0 +1,27 @@
+//go:build !windows
+
+package backup
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the numeric owner and group of a file.
+func fileOwner(info os.FileInfo) (uid, gid *int) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, nil
+	}
+	u, g := int(stat.Uid), int(stat.Gid)
+	return &u, &g
+}
+
+// restoreOwner applies recorded ownership. Only root can give files away,
+// so it is a no-op for unprivileged restores.
+func restoreOwner(localPath string, uid, gid *int) error {
+	if uid == nil || gid == nil || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(localPath, *uid, *gid)
+}
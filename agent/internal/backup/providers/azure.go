@@ -0,0 +1,449 @@
+package providers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	azureAPIVersion       = "2021-08-06"
+	defaultAzureBlockSize = 8 * 1024 * 1024
+	// azureMaxBlocks is the service limit on blocks per blob.
+	azureMaxBlocks = 50000
+)
+
+// AzureBlobConfig configures an AzureBlobProvider. Either AccountKey
+// (base64, Shared Key auth) or SASToken is required. Endpoint defaults to
+// https://<account>.blob.core.windows.net and may point at an
+// Azure-compatible service such as Azurite.
+type AzureBlobConfig struct {
+	AccountName string
+	AccountKey  string
+	SASToken    string
+	Container   string
+	Endpoint    string
+	BlockSize   int64
+}
+
+// AzureBlobProvider stores backups as block blobs. Files larger than one
+// block are uploaded with Put Block / Put Block List using block IDs derived
+// from the file, so a retried upload only sends blocks the service has not
+// already staged.
+type AzureBlobProvider struct {
+	account   string
+	key       []byte
+	sasQuery  url.Values
+	container string
+	endpoint  *url.URL
+	blockSize int64
+	client    *http.Client
+}
+
+// azureStatusError is an unexpected HTTP status from the blob service.
+type azureStatusError struct {
+	Operation string
+	Code      int
+	ErrorCode string
+}
+
+func (e *azureStatusError) Error() string {
+	if e.ErrorCode != "" {
+		return fmt.Sprintf("azure blob %s: status %d (%s)", e.Operation, e.Code, e.ErrorCode)
+	}
+	return fmt.Sprintf("azure blob %s: status %d", e.Operation, e.Code)
+}
+
+// Unwrap maps 404 to os.ErrNotExist.
+func (e *azureStatusError) Unwrap() error {
+	if e.Code == http.StatusNotFound {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// NewAzureBlobProvider creates an AzureBlobProvider.
+func NewAzureBlobProvider(cfg AzureBlobConfig) (*AzureBlobProvider, error) {
+	if cfg.AccountName == "" || cfg.Container == "" {
+		return nil, errors.New("azure account name and container are required")
+	}
+	p := &AzureBlobProvider{
+		account:   cfg.AccountName,
+		container: cfg.Container,
+		blockSize: cfg.BlockSize,
+		client:    newHTTPClient(),
+	}
+	if p.blockSize <= 0 {
+		p.blockSize = defaultAzureBlockSize
+	}
+
+	switch {
+	case cfg.AccountKey != "":
+		key, err := base64.StdEncoding.DecodeString(cfg.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure account key: %w", err)
+		}
+		p.key = key
+	case cfg.SASToken != "":
+		query, err := url.ParseQuery(strings.TrimPrefix(cfg.SASToken, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure sas token: %w", err)
+		}
+		p.sasQuery = query
+	default:
+		return nil, errors.New("azure account key or sas token is required")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.AccountName)
+	}
+	endpointURL, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid azure endpoint: %w", err)
+	}
+	p.endpoint = endpointURL
+	return p, nil
+}
+
+// Upload sends a local file to blob storage.
+func (p *AzureBlobProvider) Upload(localPath, remotePath string) error {
+	if localPath == "" {
+		return errors.New("local source path is required")
+	}
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if info.Size() <= p.blockSize {
+			err = p.putBlob(key, file, info.Size())
+		} else {
+			err = p.putBlocks(key, file, info)
+		}
+		if err == nil || !isRetryableHTTPError(err) || attempt == uploadAttempts {
+			break
+		}
+		log.Printf("[backup] azure upload of %s interrupted, resuming (attempt %d): %v", key, attempt+1, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload file to azure: %w", err)
+	}
+	return nil
+}
+
+func (p *AzureBlobProvider) putBlob(key string, file *os.File, size int64) error {
+	resp, err := p.do(http.MethodPut, key, nil, map[string]string{"x-ms-blob-type": "BlockBlob"}, io.NewSectionReader(file, 0, size), size)
+	if err != nil {
+		return err
+	}
+	return expectAzureStatus(resp, "put blob", http.StatusCreated)
+}
+
+// putBlocks stages the file's blocks, skipping any already staged by an
+// earlier attempt, then commits the block list.
+func (p *AzureBlobProvider) putBlocks(key string, file *os.File, info os.FileInfo) error {
+	blockCount := (info.Size() + p.blockSize - 1) / p.blockSize
+	if blockCount > azureMaxBlocks {
+		return fmt.Errorf("file needs %d blocks, more than the service limit of %d", blockCount, azureMaxBlocks)
+	}
+
+	staged, err := p.uncommittedBlocks(key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	fingerprint := uploadFingerprint(info)
+	blockIDs := make([]string, blockCount)
+	skipped := 0
+	for i := range blockIDs {
+		offset := int64(i) * p.blockSize
+		length := min(p.blockSize, info.Size()-offset)
+		blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%08d", fingerprint, i)))
+		blockIDs[i] = blockID
+		if staged[blockID] == length {
+			skipped++
+			continue
+		}
+
+		query := url.Values{"comp": {"block"}, "blockid": {blockID}}
+		resp, err := p.do(http.MethodPut, key, query, nil, io.NewSectionReader(file, offset, length), length)
+		if err != nil {
+			return err
+		}
+		if err := expectAzureStatus(resp, "put block", http.StatusCreated); err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		log.Printf("[backup] azure upload of %s resumed, %d of %d blocks already staged", key, skipped, blockCount)
+	}
+
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for _, blockID := range blockIDs {
+		body.WriteString("<Latest>" + blockID + "</Latest>")
+	}
+	body.WriteString("</BlockList>")
+	resp, err := p.do(http.MethodPut, key, url.Values{"comp": {"blocklist"}}, map[string]string{"Content-Type": "application/xml"}, bytes.NewReader(body.Bytes()), int64(body.Len()))
+	if err != nil {
+		return err
+	}
+	return expectAzureStatus(resp, "put block list", http.StatusCreated)
+}
+
+// uncommittedBlocks returns the staged block IDs and sizes for a blob.
+func (p *AzureBlobProvider) uncommittedBlocks(key string) (map[string]int64, error) {
+	resp, err := p.do(http.MethodGet, key, url.Values{"comp": {"blocklist"}, "blocklisttype": {"uncommitted"}}, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, expectAzureStatus(resp, "get block list", http.StatusOK)
+	}
+	defer drainBody(resp)
+
+	var list struct {
+		Blocks []struct {
+			Name string `xml:"Name"`
+			Size int64  `xml:"Size"`
+		} `xml:"UncommittedBlocks>Block"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 16*1024*1024)).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse azure block list: %w", err)
+	}
+	staged := make(map[string]int64, len(list.Blocks))
+	for _, block := range list.Blocks {
+		staged[block.Name] = block.Size
+	}
+	return staged, nil
+}
+
+// Download retrieves a blob.
+func (p *AzureBlobProvider) Download(remotePath, localPath string) error {
+	if localPath == "" {
+		return errors.New("local destination path is required")
+	}
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	resp, err := p.do(http.MethodGet, key, nil, nil, nil, 0)
+	if err != nil {
+		return fmt.Errorf("failed to download azure blob: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download azure blob: %w", expectAzureStatus(resp, "get blob", http.StatusOK))
+	}
+	defer drainBody(resp)
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local destination file: %w", err)
+	}
+	_, copyErr := io.Copy(file, resp.Body)
+	closeErr := file.Close()
+	if copyErr != nil {
+		return fmt.Errorf("failed to write azure blob to local file: %w", copyErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close local destination file: %w", closeErr)
+	}
+	return nil
+}
+
+// List lists blobs under the given prefix.
+func (p *AzureBlobProvider) List(prefix string) ([]string, error) {
+	if prefix != "" {
+		key, err := cleanRemotePath(prefix)
+		if err != nil {
+			return nil, err
+		}
+		prefix = key + "/"
+	}
+
+	keys := []string{}
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		resp, err := p.do(http.MethodGet, "", query, nil, nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list azure blobs: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to list azure blobs: %w", expectAzureStatus(resp, "list blobs", http.StatusOK))
+		}
+
+		var page struct {
+			Names      []string `xml:"Blobs>Blob>Name"`
+			NextMarker string   `xml:"NextMarker"`
+		}
+		err = xml.NewDecoder(io.LimitReader(resp.Body, 64*1024*1024)).Decode(&page)
+		drainBody(resp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse azure blob listing: %w", err)
+		}
+		keys = append(keys, page.Names...)
+		if page.NextMarker == "" {
+			return keys, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+// Delete removes a blob.
+func (p *AzureBlobProvider) Delete(remotePath string) error {
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	resp, err := p.do(http.MethodDelete, key, nil, nil, nil, 0)
+	if err != nil {
+		return fmt.Errorf("failed to delete azure blob: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		drainBody(resp)
+		return nil
+	}
+	if err := expectAzureStatus(resp, "delete blob", http.StatusAccepted); err != nil {
+		return fmt.Errorf("failed to delete azure blob: %w", err)
+	}
+	return nil
+}
+
+// do sends a signed request for a blob (or the container when key is
+// empty).
+func (p *AzureBlobProvider) do(method, key string, query url.Values, headers map[string]string, body io.Reader, length int64) (*http.Response, error) {
+	u := *p.endpoint
+	u.Path = p.endpoint.Path + "/" + p.container
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = ""
+	values := url.Values{}
+	for name, v := range query {
+		values[name] = v
+	}
+	for name, v := range p.sasQuery {
+		values[name] = v
+	}
+	u.RawQuery = values.Encode()
+
+	if body == nil || length == 0 {
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if p.key != nil {
+		req.Header.Set("Authorization", "SharedKey "+p.account+":"+azureSharedKeySignature(p.account, p.key, req, query))
+	}
+	return p.client.Do(req)
+}
+
+// azureSharedKeySignature computes the Shared Key signature for req.
+// query holds the operation parameters (not the SAS token).
+func azureSharedKeySignature(account string, key []byte, req *http.Request, query url.Values) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonicalHeaders strings.Builder
+	for _, name := range msHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	canonicalResource := "/" + account + req.URL.EscapedPath()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		canonicalResource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date (x-ms-date is used instead)
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	}, "\n") + "\n" + canonicalHeaders.String() + canonicalResource
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// expectAzureStatus closes resp and returns an error unless it has the
+// expected status.
+func expectAzureStatus(resp *http.Response, operation string, expected int) error {
+	defer drainBody(resp)
+	if resp.StatusCode == expected {
+		return nil
+	}
+	return &azureStatusError{
+		Operation: operation,
+		Code:      resp.StatusCode,
+		ErrorCode: resp.Header.Get("x-ms-error-code"),
+	}
+}
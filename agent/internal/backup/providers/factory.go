@@ -0,0 +1,128 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// New creates a provider of the given kind ("local", "s3", "sftp", "webdav"
+// or "azure") from a generic settings map, as read from the
+// backup_provider_settings config block. An empty kind means local.
+//
+// Recognized settings:
+//
+//	local:  path
+//	s3:     bucket, region, access_key, secret_key, session_token, endpoint,
+//	        part_size_mb, state_dir, bandwidth_limit_kbps
+//	sftp:   host, port, username, password, private_key, private_key_file,
+//	        private_key_passphrase, host_key_fingerprint, known_hosts_file,
+//	        base_path, timeout
+//	webdav: url, username, password
+//	azure:  account, account_key, sas_token, container, endpoint, block_size_mb
+func New(kind string, settings map[string]string) (BackupProvider, error) {
+	switch kind {
+	case "", "local":
+		if settings["path"] == "" {
+			return nil, errors.New("local backup provider requires path")
+		}
+		return NewLocalProvider(settings["path"]), nil
+	case "s3":
+		return newS3FromSettings(settings)
+	case "sftp":
+		return newSFTPFromSettings(settings)
+	case "webdav":
+		return NewWebDAVProvider(WebDAVConfig{
+			URL:      settings["url"],
+			Username: settings["username"],
+			Password: settings["password"],
+		})
+	case "azure":
+		cfg := AzureBlobConfig{
+			AccountName: settings["account"],
+			AccountKey:  settings["account_key"],
+			SASToken:    settings["sas_token"],
+			Container:   settings["container"],
+			Endpoint:    settings["endpoint"],
+		}
+		if value := settings["block_size_mb"]; value != "" {
+			mb, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || mb <= 0 || mb > 4000 {
+				return nil, fmt.Errorf("invalid azure block_size_mb %q", value)
+			}
+			cfg.BlockSize = mb * 1024 * 1024
+		}
+		return NewAzureBlobProvider(cfg)
+	default:
+		return nil, fmt.Errorf("unknown backup provider %q", kind)
+	}
+}
+
+func newS3FromSettings(settings map[string]string) (*S3Provider, error) {
+	if settings["bucket"] == "" {
+		return nil, errors.New("s3 backup provider requires bucket")
+	}
+	provider := NewS3Provider(
+		settings["bucket"],
+		settings["region"],
+		settings["access_key"],
+		settings["secret_key"],
+		settings["session_token"],
+	)
+	provider.Endpoint = settings["endpoint"]
+	provider.StateDir = settings["state_dir"]
+	if value := settings["part_size_mb"]; value != "" {
+		mb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || mb*1024*1024 < MinS3PartSize || mb > 5*1024 {
+			return nil, fmt.Errorf("invalid s3 part_size_mb %q (must be 5-5120)", value)
+		}
+		provider.PartSize = mb * 1024 * 1024
+	}
+	if value := settings["bandwidth_limit_kbps"]; value != "" {
+		kbps, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || kbps < 0 {
+			return nil, fmt.Errorf("invalid s3 bandwidth_limit_kbps %q", value)
+		}
+		provider.BandwidthLimit = kbps * 1000 / 8
+	}
+	return provider, nil
+}
+
+func newSFTPFromSettings(settings map[string]string) (*SFTPProvider, error) {
+	cfg := SFTPConfig{
+		Host:                 settings["host"],
+		Username:             settings["username"],
+		Password:             settings["password"],
+		PrivateKeyPassphrase: settings["private_key_passphrase"],
+		HostKeyFingerprint:   settings["host_key_fingerprint"],
+		KnownHostsFile:       settings["known_hosts_file"],
+		BasePath:             settings["base_path"],
+	}
+	if value := settings["port"]; value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid sftp port %q", value)
+		}
+		cfg.Port = port
+	}
+	if value := settings["timeout"]; value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sftp timeout %q: %w", value, err)
+		}
+		cfg.Timeout = timeout
+	}
+	switch {
+	case settings["private_key"] != "":
+		cfg.PrivateKey = []byte(settings["private_key"])
+	case settings["private_key_file"] != "":
+		key, err := os.ReadFile(settings["private_key_file"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sftp private key: %w", err)
+		}
+		cfg.PrivateKey = key
+	}
+	return NewSFTPProvider(cfg)
+}
@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// uploadAttempts is how many times the network providers try an upload,
+	// resuming from what the server already has on each retry.
+	uploadAttempts = 3
+	// partialUploadSuffix marks in-progress uploads; they are hidden from
+	// List and renamed into place once complete.
+	partialUploadSuffix = ".partial"
+)
+
+// cleanRemotePath normalizes a provider-relative object key and rejects keys
+// that would escape the provider root.
+func cleanRemotePath(remotePath string) (string, error) {
+	if remotePath == "" {
+		return "", errors.New("remote path is required")
+	}
+	normalized := strings.ReplaceAll(remotePath, "\\", "/")
+	for _, elem := range strings.Split(normalized, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("path traversal detected: %q", remotePath)
+		}
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+normalized), "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("invalid remote path %q", remotePath)
+	}
+	return cleaned, nil
+}
+
+// uploadFingerprint identifies a particular version of a local file so an
+// interrupted upload is only resumed from the same content.
+func uploadFingerprint(info os.FileInfo) string {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(info.Size()))
+	binary.BigEndian.PutUint64(buf[8:], uint64(info.ModTime().UnixNano()))
+	sum := sha256.Sum256(buf[:])
+	return hex.EncodeToString(sum[:8])
+}
+
+// partialUploadPath returns where an in-progress upload of info to
+// remotePath is staged.
+func partialUploadPath(remotePath string, info os.FileInfo) string {
+	return remotePath + "." + uploadFingerprint(info) + partialUploadSuffix
+}
+
+func isPartialUpload(name string) bool {
+	return strings.HasSuffix(name, partialUploadSuffix)
+}
+
+// newHTTPClient returns a client for the HTTP-based providers. There is no
+// overall timeout because uploads of large files can legitimately take a
+// long time; a stalled server is caught by the header timeout instead.
+func newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 2 * time.Minute
+	return &http.Client{Transport: transport}
+}
+
+// httpDoer is satisfied by *http.Client and the AWS SDK's HTTP clients.
+type httpDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// throttledHTTPClient limits the rate at which request bodies are sent, so
+// backups do not saturate a slow uplink. Responses are not throttled.
+type throttledHTTPClient struct {
+	client  httpDoer
+	limiter *rate.Limiter
+}
+
+// newThrottledHTTPClient wraps client with an upload limit in bytes per
+// second.
+func newThrottledHTTPClient(client httpDoer, bytesPerSecond int64) *throttledHTTPClient {
+	// Allow bursts of up to one second of traffic, but never less than a
+	// typical read so a single Read never exceeds the burst.
+	burst := int(max(bytesPerSecond, 32*1024))
+	return &throttledHTTPClient{
+		client:  client,
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), burst),
+	}
+}
+
+func (c *throttledHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &throttledReader{ctx: req.Context(), body: req.Body, limiter: c.limiter}
+	}
+	return c.client.Do(req)
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	body    io.ReadCloser
+	limiter *rate.Limiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err := r.body.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.body.Close()
+}
@@ -1,27 +1,65 @@
 package providers
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awscfg "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-const multipartUploadThreshold = 100 * 1024 * 1024 // 100 MB
+const (
+	defaultS3PartSize = 8 * 1024 * 1024
+	// MinS3PartSize is the smallest part S3 accepts for all but the last
+	// part of a multipart upload.
+	MinS3PartSize = 5 * 1024 * 1024
+	maxS3Parts    = 10000
+)
 
-// S3Provider is a stub for S3-compatible backup storage.
+// S3Provider stores backups in S3-compatible object storage.
+//
+// Files larger than PartSize are streamed as multipart uploads, one part in
+// memory at a time. When StateDir is set the upload ID is persisted there,
+// so an upload interrupted by a network failure or agent restart resumes on
+// the next attempt: parts the service already holds with a matching MD5 are
+// skipped. Keys ending in ".gz" are gzip-compressed on the fly, matching
+// LocalProvider.
+//
+// Endpoint, PartSize, StateDir and BandwidthLimit must be set before first
+// use.
 type S3Provider struct {
-	Bucket          string
-	Region          string
+	Bucket string
+	Region string
+	// Endpoint overrides the AWS endpoint for S3-compatible services and
+	// switches to path-style addressing.
+	Endpoint string
+	// PartSize is the multipart part size in bytes (default 8 MiB).
+	PartSize int64
+	// StateDir holds persisted multipart upload state. When empty,
+	// interrupted uploads are aborted instead of resumed.
+	StateDir string
+	// BandwidthLimit caps upload throughput in bytes per second (0 means
+	// unlimited).
+	BandwidthLimit int64
+
 	accessKeyID     string
 	secretAccessKey string
 	sessionToken    string
@@ -29,6 +67,16 @@ type S3Provider struct {
 	clientMu        sync.Mutex
 }
 
+// s3UploadState is the persisted record of an in-progress multipart upload.
+type s3UploadState struct {
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	UploadID    string `json:"uploadId"`
+	Fingerprint string `json:"fingerprint"`
+	PartSize    int64  `json:"partSize"`
+	Compressed  bool   `json:"compressed"`
+}
+
 // NewS3Provider creates a new S3Provider.
 func NewS3Provider(bucket, region, accessKeyID, secretAccessKey, sessionToken string) *S3Provider {
 	return &S3Provider{
@@ -48,8 +96,9 @@ func (s *S3Provider) Upload(localPath, remotePath string) error {
 	if localPath == "" {
 		return errors.New("local source path is required")
 	}
-	if remotePath == "" {
-		return errors.New("remote path is required")
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
 	}
 
 	client, err := s.getClient()
@@ -68,37 +117,278 @@ func (s *S3Provider) Upload(localPath, remotePath string) error {
 		return fmt.Errorf("failed to stat source file: %w", err)
 	}
 
+	compressed := strings.HasSuffix(key, ".gz")
+	var source io.Reader = file
+	if compressed {
+		reader := compressStream(file)
+		defer reader.Close()
+		source = reader
+	}
+
 	ctx := context.Background()
-	input := &s3.PutObjectInput{
-		Bucket: aws.String(s.Bucket),
-		Key:    aws.String(remotePath),
-		Body:   file,
+	partSize := s.partSize()
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(source, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("failed to read source file: %w", err)
 	}
-	if info.Size() > multipartUploadThreshold {
-		uploader := manager.NewUploader(client)
-		if _, err := uploader.Upload(ctx, input); err != nil {
-			return fmt.Errorf("failed to upload file to s3 with multipart upload: %w", err)
+	if int64(n) < partSize {
+		// Small enough for a single request; drop any stale multipart state.
+		if state := s.loadUploadState(key); state != nil {
+			s.abortUpload(ctx, client, state)
+		}
+		sum := md5.Sum(buf[:n])
+		if _, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:     aws.String(s.Bucket),
+			Key:        aws.String(key),
+			Body:       bytes.NewReader(buf[:n]),
+			ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		}); err != nil {
+			return fmt.Errorf("failed to upload file to s3: %w", err)
 		}
 		return nil
 	}
 
-	if _, err := client.PutObject(ctx, input); err != nil {
-		return fmt.Errorf("failed to upload file to s3: %w", err)
+	fingerprint := uploadFingerprint(info)
+	if err := s.multipartUpload(ctx, client, key, fingerprint, compressed, source, buf); err != nil {
+		return fmt.Errorf("failed to upload file to s3 with multipart upload: %w", err)
 	}
 	return nil
 }
 
-// Download retrieves a file from S3.
+// multipartUpload streams source to key, starting with the already-read
+// first part in buf.
+func (s *S3Provider) multipartUpload(ctx context.Context, client *s3.Client, key, fingerprint string, compressed bool, source io.Reader, buf []byte) error {
+	state, uploaded, err := s.resumeUpload(ctx, client, key, fingerprint, compressed)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(s.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create multipart upload: %w", err)
+		}
+		state = &s3UploadState{
+			Bucket:      s.Bucket,
+			Key:         key,
+			UploadID:    aws.ToString(created.UploadId),
+			Fingerprint: fingerprint,
+			PartSize:    int64(len(buf)),
+			Compressed:  compressed,
+		}
+		if err := s.saveUploadState(state); err != nil {
+			log.Printf("[backup] failed to persist s3 upload state for %s, upload will not resume after a restart: %v", key, err)
+		}
+	}
+
+	var parts []types.CompletedPart
+	skipped := 0
+	part := buf
+	for number := int32(1); ; number++ {
+		if number > maxS3Parts {
+			s.failUpload(ctx, client, state)
+			return fmt.Errorf("file needs more than %d parts; increase the part size", maxS3Parts)
+		}
+
+		sum := md5.Sum(part)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		if existing, ok := uploaded[number]; ok && aws.ToString(existing.ETag) == etag && aws.ToInt64(existing.Size) == int64(len(part)) {
+			skipped++
+		} else {
+			resp, err := client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:     aws.String(s.Bucket),
+				Key:        aws.String(key),
+				UploadId:   aws.String(state.UploadID),
+				PartNumber: aws.Int32(number),
+				Body:       bytes.NewReader(part),
+				ContentMD5: aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+			})
+			if err != nil {
+				s.failUpload(ctx, client, state)
+				return fmt.Errorf("failed to upload part %d: %w", number, err)
+			}
+			if resp.ETag != nil {
+				etag = *resp.ETag
+			}
+		}
+		parts = append(parts, types.CompletedPart{ETag: aws.String(etag), PartNumber: aws.Int32(number)})
+
+		n, err := io.ReadFull(source, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.failUpload(ctx, client, state)
+			return fmt.Errorf("failed to read source file: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+		part = buf[:n]
+	}
+	if skipped > 0 {
+		log.Printf("[backup] s3 upload of %s resumed, %d of %d parts already uploaded", key, skipped, len(parts))
+	}
+
+	if _, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.Bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(state.UploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		s.failUpload(ctx, client, state)
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	s.removeUploadState(key)
+	return nil
+}
+
+// resumeUpload returns the persisted upload for key and the parts S3
+// already holds for it, or a nil state when there is nothing to resume.
+func (s *S3Provider) resumeUpload(ctx context.Context, client *s3.Client, key, fingerprint string, compressed bool) (*s3UploadState, map[int32]types.Part, error) {
+	state := s.loadUploadState(key)
+	if state == nil {
+		return nil, nil, nil
+	}
+	if state.Bucket != s.Bucket || state.Fingerprint != fingerprint || state.PartSize != s.partSize() || state.Compressed != compressed {
+		// The source or settings changed since the upload began.
+		s.abortUpload(ctx, client, state)
+		return nil, nil, nil
+	}
+
+	uploaded := make(map[int32]types.Part)
+	paginator := s3.NewListPartsPaginator(client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(state.UploadID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			var noSuchUpload *types.NoSuchUpload
+			if errors.As(err, &noSuchUpload) {
+				// Completed, aborted or expired by a lifecycle rule.
+				s.removeUploadState(key)
+				return nil, nil, nil
+			}
+			return nil, nil, fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+		for _, part := range page.Parts {
+			if part.PartNumber != nil {
+				uploaded[*part.PartNumber] = part
+			}
+		}
+	}
+	return state, uploaded, nil
+}
+
+// failUpload leaves a persisted upload in place for a later resume, or
+// aborts it when state is not persisted so parts are not left behind.
+func (s *S3Provider) failUpload(ctx context.Context, client *s3.Client, state *s3UploadState) {
+	if s.StateDir == "" {
+		s.abortUpload(ctx, client, state)
+	}
+}
+
+func (s *S3Provider) abortUpload(ctx context.Context, client *s3.Client, state *s3UploadState) {
+	if _, err := client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(state.Bucket),
+		Key:      aws.String(state.Key),
+		UploadId: aws.String(state.UploadID),
+	}); err != nil {
+		var noSuchUpload *types.NoSuchUpload
+		if !errors.As(err, &noSuchUpload) {
+			log.Printf("[backup] failed to abort s3 multipart upload of %s: %v", state.Key, err)
+		}
+	}
+	s.removeUploadState(state.Key)
+}
+
+func (s *S3Provider) uploadStatePath(key string) string {
+	sum := sha256.Sum256([]byte(s.Bucket + "/" + key))
+	return filepath.Join(s.StateDir, hex.EncodeToString(sum[:16])+".json")
+}
+
+func (s *S3Provider) loadUploadState(key string) *s3UploadState {
+	if s.StateDir == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.uploadStatePath(key))
+	if err != nil {
+		return nil
+	}
+	var state s3UploadState
+	if err := json.Unmarshal(data, &state); err != nil || state.Key != key || state.UploadID == "" {
+		return nil
+	}
+	return &state
+}
+
+func (s *S3Provider) saveUploadState(state *s3UploadState) error {
+	if s.StateDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(s.StateDir, 0o700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	path := s.uploadStatePath(state.Key)
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+func (s *S3Provider) removeUploadState(key string) {
+	if s.StateDir == "" {
+		return
+	}
+	if err := os.Remove(s.uploadStatePath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[backup] failed to remove s3 upload state for %s: %v", key, err)
+	}
+}
+
+func (s *S3Provider) partSize() int64 {
+	if s.PartSize > 0 {
+		return s.PartSize
+	}
+	return defaultS3PartSize
+}
+
+// compressStream returns a reader of the gzip-compressed content of src.
+// The output is deterministic for a given input, which lets a resumed
+// upload match the parts sent before the interruption.
+func compressStream(src io.Reader) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		gzipWriter := gzip.NewWriter(writer)
+		_, err := io.Copy(gzipWriter, src)
+		if closeErr := gzipWriter.Close(); err == nil {
+			err = closeErr
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
+
+// Download retrieves a file from S3. Objects with a ".gz" key are
+// decompressed; objects stored uncompressed under such a key by older
+// agents are copied as-is.
 func (s *S3Provider) Download(remotePath, localPath string) error {
 	if s.Bucket == "" || s.Region == "" {
 		return errors.New("s3 bucket and region are required")
 	}
-	if remotePath == "" {
-		return errors.New("remote path is required")
-	}
 	if localPath == "" {
 		return errors.New("local destination path is required")
 	}
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
 
 	client, err := s.getClient()
 	if err != nil {
@@ -108,13 +398,32 @@ func (s *S3Provider) Download(remotePath, localPath string) error {
 	ctx := context.Background()
 	resp, err := client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.Bucket),
-		Key:    aws.String(remotePath),
+		Key:    aws.String(key),
 	})
 	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return fmt.Errorf("failed to get s3 object: %w", errors.Join(os.ErrNotExist, err))
+		}
 		return fmt.Errorf("failed to get s3 object: %w", err)
 	}
 	defer resp.Body.Close()
 
+	var body io.Reader = resp.Body
+	if strings.HasSuffix(key, ".gz") {
+		buffered := bufio.NewReader(resp.Body)
+		if magic, _ := buffered.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			gzipReader, err := gzip.NewReader(buffered)
+			if err != nil {
+				return fmt.Errorf("failed to create gzip reader: %w", err)
+			}
+			defer gzipReader.Close()
+			body = io.LimitReader(gzipReader, maxDecompressSize)
+		} else {
+			body = buffered
+		}
+	}
+
 	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
@@ -123,7 +432,7 @@ func (s *S3Provider) Download(remotePath, localPath string) error {
 	if err != nil {
 		return fmt.Errorf("failed to create local destination file: %w", err)
 	}
-	_, copyErr := io.Copy(file, resp.Body)
+	_, copyErr := io.Copy(file, body)
 	closeErr := file.Close()
 	if copyErr != nil {
 		return fmt.Errorf("failed to write s3 object to local file: %w", copyErr)
@@ -135,11 +444,18 @@ func (s *S3Provider) Download(remotePath, localPath string) error {
 	return nil
 }
 
-// List lists objects in the bucket with the given prefix.
+// List lists objects in the bucket under the given prefix.
 func (s *S3Provider) List(prefix string) ([]string, error) {
 	if s.Bucket == "" || s.Region == "" {
 		return nil, errors.New("s3 bucket and region are required")
 	}
+	if prefix != "" {
+		key, err := cleanRemotePath(prefix)
+		if err != nil {
+			return nil, err
+		}
+		prefix = key + "/"
+	}
 
 	client, err := s.getClient()
 	if err != nil {
@@ -173,8 +489,9 @@ func (s *S3Provider) Delete(remotePath string) error {
 	if s.Bucket == "" || s.Region == "" {
 		return errors.New("s3 bucket and region are required")
 	}
-	if remotePath == "" {
-		return errors.New("remote path is required")
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
 	}
 
 	client, err := s.getClient()
@@ -184,7 +501,7 @@ func (s *S3Provider) Delete(remotePath string) error {
 
 	if _, err := client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
 		Bucket: aws.String(s.Bucket),
-		Key:    aws.String(remotePath),
+		Key:    aws.String(key),
 	}); err != nil {
 		return fmt.Errorf("failed to delete s3 object: %w", err)
 	}
@@ -201,6 +518,10 @@ func (s *S3Provider) getClient() (*s3.Client, error) {
 
 	options := []func(*awscfg.LoadOptions) error{
 		awscfg.WithRegion(s.Region),
+		// Parts are already protected by Content-MD5; flexible checksums
+		// are not supported by every S3-compatible service.
+		awscfg.WithRequestChecksumCalculation(aws.RequestChecksumCalculationWhenRequired),
+		awscfg.WithResponseChecksumValidation(aws.ResponseChecksumValidationWhenRequired),
 	}
 	if s.accessKeyID != "" && s.secretAccessKey != "" {
 		options = append(options, awscfg.WithCredentialsProvider(
@@ -213,6 +534,14 @@ func (s *S3Provider) getClient() (*s3.Client, error) {
 		return nil, fmt.Errorf("failed to load aws config: %w", err)
 	}
 
-	s.client = s3.NewFromConfig(cfg)
+	s.client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if s.Endpoint != "" {
+			o.BaseEndpoint = aws.String(s.Endpoint)
+			o.UsePathStyle = true
+		}
+		if s.BandwidthLimit > 0 {
+			o.HTTPClient = newThrottledHTTPClient(o.HTTPClient, s.BandwidthLimit)
+		}
+	})
 	return s.client, nil
 }
@@ -0,0 +1,261 @@
+package providers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testS3Server implements the subset of the S3 REST API (path-style) used by
+// S3Provider.
+type testS3Server struct {
+	*httptest.Server
+	bucket string
+
+	mu          sync.Mutex
+	objects     map[string][]byte
+	uploads     map[string]map[int][]byte
+	nextID      int
+	uploadParts int
+	// denyFromPart rejects uploads of this part number and later while set.
+	denyFromPart int
+}
+
+func startTestS3Server(t *testing.T) *testS3Server {
+	t.Helper()
+	server := &testS3Server{
+		bucket:  "backups",
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *testS3Server) provider(stateDir string) *S3Provider {
+	provider := NewS3Provider(s.bucket, "us-east-1", "AKIDTEST", "secret", "")
+	provider.Endpoint = s.URL
+	provider.PartSize = 64 * 1024
+	provider.StateDir = stateDir
+	return provider
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func s3ETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *testS3Server) handle(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != s.bucket {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploadID := query.Get("uploadId")
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, query.Get("prefix"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		id := "upload-" + strconv.Itoa(s.nextID)
+		s.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, key, id)
+	case uploadID != "" && s.uploads[uploadID] == nil:
+		s3Error(w, http.StatusNotFound, "NoSuchUpload")
+	case r.Method == http.MethodPut && uploadID != "":
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		if s.denyFromPart > 0 && number >= s.denyFromPart {
+			s3Error(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		sum := md5.Sum(data)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			s3Error(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+		s.uploads[uploadID][number] = data
+		s.uploadParts++
+		w.Header().Set("ETag", s3ETag(data))
+	case r.Method == http.MethodGet && uploadID != "":
+		numbers := make([]int, 0, len(s.uploads[uploadID]))
+		for number := range s.uploads[uploadID] {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var body bytes.Buffer
+		body.WriteString("<ListPartsResult><IsTruncated>false</IsTruncated>")
+		for _, number := range numbers {
+			data := s.uploads[uploadID][number]
+			fmt.Fprintf(&body, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag><Size>%d</Size></Part>", number, s3ETag(data), len(data))
+		}
+		body.WriteString("</ListPartsResult>")
+		w.Write(body.Bytes())
+	case r.Method == http.MethodPost && uploadID != "":
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			s3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var object []byte
+		for _, part := range complete.Parts {
+			data, ok := s.uploads[uploadID][part.PartNumber]
+			if !ok || s3ETag(data) != part.ETag {
+				s3Error(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			object = append(object, data...)
+		}
+		s.objects[key] = object
+		delete(s.uploads, uploadID)
+		fmt.Fprintf(w, "<CompleteMultipartUploadResult><Key>%s</Key><ETag>\"x\"</ETag></CompleteMultipartUploadResult>", key)
+	case r.Method == http.MethodDelete && uploadID != "":
+		delete(s.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = data
+		w.Header().Set("ETag", s3ETag(data))
+	case r.Method == http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Error(w, http.StatusBadRequest, "NotImplemented")
+	}
+}
+
+func (s *testS3Server) list(w http.ResponseWriter, prefix string) {
+	keys := []string{}
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<ListBucketResult><Name>%s</Name><KeyCount>%d</KeyCount><IsTruncated>false</IsTruncated>", s.bucket, len(keys))
+	for _, key := range keys {
+		fmt.Fprintf(&body, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(s.objects[key]))
+	}
+	body.WriteString("</ListBucketResult>")
+	w.Write(body.Bytes())
+}
+
+func TestS3ProviderContract(t *testing.T) {
+	server := startTestS3Server(t)
+	exerciseProvider(t, server.provider(t.TempDir()))
+}
+
+func TestS3ProviderResumesUploadAfterRestart(t *testing.T) {
+	server := startTestS3Server(t)
+	stateDir := t.TempDir()
+	source, data := writeTestFile(t, 10*64*1024)
+
+	// Random data does not compress, so the gzip stream spans 11 parts.
+	server.denyFromPart = 4
+	if err := server.provider(stateDir).Upload(source, "big/file.bin.gz"); err == nil {
+		t.Fatal("expected the first upload to fail")
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 1 {
+		t.Fatalf("expected persisted upload state, found %d entries", len(entries))
+	}
+
+	// A fresh provider stands in for a restarted agent.
+	server.denyFromPart = 0
+	server.uploadParts = 0
+	provider := server.provider(stateDir)
+	if err := provider.Upload(source, "big/file.bin.gz"); err != nil {
+		t.Fatalf("resumed upload: %v", err)
+	}
+	if server.uploadParts != 8 {
+		t.Fatalf("expected only the 8 missing parts to be sent, got %d", server.uploadParts)
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Fatalf("expected upload state to be removed, found %d entries", len(entries))
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(server.objects["big/file.bin.gz"]))
+	if err != nil {
+		t.Fatalf("stored object is not gzip: %v", err)
+	}
+	stored, err := io.ReadAll(gzipReader)
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Fatalf("stored object does not match source: %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "out.bin")
+	if err := provider.Download("big/file.bin.gz", dest); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, data) {
+		t.Fatal("downloaded content does not match source")
+	}
+}
+
+func TestS3ProviderDownloadsLegacyUncompressedObjects(t *testing.T) {
+	server := startTestS3Server(t)
+	server.objects["snapshots/old/file.gz"] = []byte("stored before transparent compression")
+
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := server.provider("").Download("snapshots/old/file.gz", dest); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != "stored before transparent compression" {
+		t.Fatalf("unexpected content %q", got)
+	}
+}
+
+func TestS3ProviderThrottlesUploads(t *testing.T) {
+	server := startTestS3Server(t)
+	provider := server.provider("")
+	provider.PartSize = 1024 * 1024
+	provider.BandwidthLimit = 256 * 1024
+
+	source, _ := writeTestFile(t, 768*1024)
+	start := time.Now()
+	if err := provider.Upload(source, "throttled.bin"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	// One second of burst, then 512 KiB at 256 KiB/s.
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Fatalf("upload took %v, expected throttling to slow it to about 2s", elapsed)
+	}
+}
@@ -0,0 +1,426 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPConfig configures an SFTPProvider. The server's host key must be
+// pinned with HostKeyFingerprint ("SHA256:...") or KnownHostsFile.
+type SFTPConfig struct {
+	Host                 string
+	Port                 int
+	Username             string
+	Password             string
+	PrivateKey           []byte
+	PrivateKeyPassphrase string
+	HostKeyFingerprint   string
+	KnownHostsFile       string
+	BasePath             string
+	Timeout              time.Duration
+}
+
+// SFTPProvider stores backups on an SSH server over SFTP. Uploads are
+// staged in a partial file that is resumed after a dropped connection and
+// renamed into place once complete.
+type SFTPProvider struct {
+	addr     string
+	basePath string
+	config   *ssh.ClientConfig
+
+	mu       sync.Mutex
+	conn     *ssh.Client
+	client   *sftp.Client
+	madeDirs map[string]bool
+}
+
+// NewSFTPProvider creates an SFTPProvider. The connection is established
+// lazily on first use.
+func NewSFTPProvider(cfg SFTPConfig) (*SFTPProvider, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("sftp host is required")
+	}
+	if cfg.Username == "" {
+		return nil, errors.New("sftp username is required")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 22
+	}
+
+	var auth []ssh.AuthMethod
+	if len(cfg.PrivateKey) > 0 {
+		var signer ssh.Signer
+		var err error
+		if cfg.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(cfg.PrivateKey, []byte(cfg.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(cfg.PrivateKey)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("sftp password or private key is required")
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case cfg.HostKeyFingerprint != "":
+		expected := cfg.HostKeyFingerprint
+		hostKeyCallback = func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if actual := ssh.FingerprintSHA256(key); actual != expected {
+				return fmt.Errorf("sftp host key mismatch: got %s, want %s", actual, expected)
+			}
+			return nil
+		}
+	case cfg.KnownHostsFile != "":
+		callback, err := knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sftp known hosts: %w", err)
+		}
+		hostKeyCallback = callback
+	default:
+		return nil, errors.New("sftp host key fingerprint or known hosts file is required")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	basePath := cfg.BasePath
+	if basePath == "" {
+		basePath = "."
+	}
+
+	return &SFTPProvider{
+		addr:     net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		basePath: path.Clean(basePath),
+		config: &ssh.ClientConfig{
+			User:            cfg.Username,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         timeout,
+		},
+		madeDirs: make(map[string]bool),
+	}, nil
+}
+
+// Upload sends a local file to the SFTP server, resuming a previously
+// interrupted upload of the same file.
+func (p *SFTPProvider) Upload(localPath, remotePath string) error {
+	if localPath == "" {
+		return errors.New("local source path is required")
+	}
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	target := p.remote(key)
+	partial := partialUploadPath(target, info)
+	for attempt := 1; ; attempt++ {
+		err = p.withClient(func(client *sftp.Client) error {
+			if err := p.mkdirAll(client, path.Dir(target)); err != nil {
+				return err
+			}
+			return p.uploadPartial(client, file, info.Size(), partial, target)
+		})
+		if err == nil || !isSFTPTransportError(err) || attempt == uploadAttempts {
+			break
+		}
+		log.Printf("[backup] sftp upload of %s interrupted, resuming (attempt %d): %v", key, attempt+1, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload file to sftp: %w", err)
+	}
+	return nil
+}
+
+func (p *SFTPProvider) uploadPartial(client *sftp.Client, file *os.File, size int64, partial, target string) error {
+	var offset int64
+	if existing, err := client.Stat(partial); err == nil && existing.Size() <= size {
+		offset = existing.Size()
+	}
+
+	if offset < size || size == 0 {
+		flags := os.O_WRONLY | os.O_CREATE
+		if offset == 0 {
+			flags |= os.O_TRUNC
+		}
+		remote, err := client.OpenFile(partial, flags)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			_ = remote.Close()
+			return err
+		}
+		if _, err := remote.Seek(offset, io.SeekStart); err != nil {
+			_ = remote.Close()
+			return err
+		}
+		// Writes are sequential (the client's default), so after a
+		// dropped connection the partial file's size is exactly what
+		// the server stored and resuming from it leaves no holes.
+		_, writeErr := remote.ReadFrom(file)
+		closeErr := remote.Close()
+		if writeErr != nil {
+			return writeErr
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+	}
+
+	uploaded, err := client.Stat(partial)
+	if err != nil {
+		return err
+	}
+	if uploaded.Size() != size {
+		return fmt.Errorf("uploaded size %d does not match source size %d", uploaded.Size(), size)
+	}
+	return p.rename(client, partial, target)
+}
+
+// rename moves oldPath to newPath, replacing newPath if the server supports
+// POSIX rename semantics and removing it first otherwise.
+func (p *SFTPProvider) rename(client *sftp.Client, oldPath, newPath string) error {
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(oldPath, newPath)
+	}
+	if err := client.Remove(newPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return client.Rename(oldPath, newPath)
+}
+
+// Download retrieves a file from the SFTP server.
+func (p *SFTPProvider) Download(remotePath, localPath string) error {
+	if localPath == "" {
+		return errors.New("local destination path is required")
+	}
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	err = p.withClient(func(client *sftp.Client) error {
+		remote, err := client.Open(p.remote(key))
+		if err != nil {
+			return err
+		}
+		defer remote.Close()
+
+		file, err := os.Create(localPath)
+		if err != nil {
+			return fmt.Errorf("failed to create local destination file: %w", err)
+		}
+		_, copyErr := remote.WriteTo(file)
+		closeErr := file.Close()
+		if copyErr != nil {
+			return copyErr
+		}
+		return closeErr
+	})
+	if err != nil {
+		return fmt.Errorf("failed to download sftp file %s: %w", key, err)
+	}
+	return nil
+}
+
+// List enumerates files under the given prefix.
+func (p *SFTPProvider) List(prefix string) ([]string, error) {
+	root := p.basePath
+	if prefix != "" {
+		key, err := cleanRemotePath(prefix)
+		if err != nil {
+			return nil, err
+		}
+		root = p.remote(key)
+	}
+
+	results := []string{}
+	err := p.withClient(func(client *sftp.Client) error {
+		results = results[:0]
+		return p.walk(client, root, &results)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sftp files: %w", err)
+	}
+	return results, nil
+}
+
+func (p *SFTPProvider) walk(client *sftp.Client, dir string, results *[]string) error {
+	entries, err := client.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		full := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if err := p.walk(client, full, results); err != nil {
+				return err
+			}
+			continue
+		}
+		if isPartialUpload(entry.Name()) {
+			continue
+		}
+		*results = append(*results, p.relative(full))
+	}
+	return nil
+}
+
+// Delete removes a file from the SFTP server.
+func (p *SFTPProvider) Delete(remotePath string) error {
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	err = p.withClient(func(client *sftp.Client) error {
+		return client.Remove(p.remote(key))
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete sftp file: %w", err)
+	}
+	return nil
+}
+
+// Close closes the SSH connection, if open.
+func (p *SFTPProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resetLocked()
+	return nil
+}
+
+func (p *SFTPProvider) remote(key string) string {
+	return path.Join(p.basePath, key)
+}
+
+func (p *SFTPProvider) relative(full string) string {
+	if p.basePath == "." {
+		return full
+	}
+	rel := full[len(p.basePath):]
+	if len(rel) > 0 && rel[0] == '/' {
+		rel = rel[1:]
+	}
+	return rel
+}
+
+func (p *SFTPProvider) mkdirAll(client *sftp.Client, dir string) error {
+	if dir == "." || dir == "/" || p.madeDirs[dir] {
+		return nil
+	}
+	info, err := client.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s exists and is not a directory", dir)
+		}
+		p.madeDirs[dir] = true
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := p.mkdirAll(client, path.Dir(dir)); err != nil {
+		return err
+	}
+	if err := client.Mkdir(dir); err != nil {
+		// Another writer may have created it in the meantime.
+		if info, statErr := client.Stat(dir); statErr != nil || !info.IsDir() {
+			return err
+		}
+	}
+	p.madeDirs[dir] = true
+	return nil
+}
+
+// withClient runs fn with a connected client, dropping the connection when
+// fn fails at the transport level so the next call reconnects.
+func (p *SFTPProvider) withClient(fn func(*sftp.Client) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client == nil {
+		if err := p.connectLocked(); err != nil {
+			return err
+		}
+	}
+	err := fn(p.client)
+	if err != nil && isSFTPTransportError(err) {
+		p.resetLocked()
+	}
+	return err
+}
+
+func (p *SFTPProvider) connectLocked() error {
+	conn, err := ssh.Dial("tcp", p.addr, p.config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to sftp server: %w", err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start sftp subsystem: %w", err)
+	}
+	p.conn = conn
+	p.client = client
+	return nil
+}
+
+func (p *SFTPProvider) resetLocked() {
+	if p.client != nil {
+		_ = p.client.Close()
+	}
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.client = nil
+	p.conn = nil
+	p.madeDirs = make(map[string]bool)
+}
+
+// isSFTPTransportError reports whether err came from the connection rather
+// than a server status reply or a local file.
+func isSFTPTransportError(err error) bool {
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) ||
+		errors.Is(err, sftp.ErrSSHFxNoConnection) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
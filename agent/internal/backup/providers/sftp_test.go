@@ -0,0 +1,277 @@
+package providers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSFTPServer is an in-process SSH server exposing a directory over
+// SFTP.
+type testSFTPServer struct {
+	root        string
+	addr        string
+	fingerprint string
+
+	// dropAfter closes the first connection once the server has received
+	// this many bytes, simulating a network failure mid-upload.
+	dropAfter     int64
+	dropped       atomic.Bool
+	bytesReceived atomic.Int64
+}
+
+func startTestSFTPServer(t *testing.T, dropAfter int64) *testSFTPServer {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &testSFTPServer{
+		root:        t.TempDir(),
+		addr:        listener.Addr().String(),
+		fingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+		dropAfter:   dropAfter,
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.handleConn(conn, config)
+		}
+	}()
+	return server
+}
+
+func (s *testSFTPServer) provider(t *testing.T, fingerprint string) *SFTPProvider {
+	t.Helper()
+	host, portText, _ := net.SplitHostPort(s.addr)
+	port, _ := net.LookupPort("tcp", portText)
+	provider, err := NewSFTPProvider(SFTPConfig{
+		Host:               host,
+		Port:               port,
+		Username:           "backup",
+		Password:           "secret",
+		HostKeyFingerprint: fingerprint,
+		BasePath:           "store",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { provider.Close() })
+	return provider
+}
+
+func (s *testSFTPServer) handleConn(netConn net.Conn, config *ssh.ServerConfig) {
+	conn, channels, requests, err := ssh.NewServerConn(netConn, config)
+	if err != nil {
+		netConn.Close()
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range channelRequests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				go func() {
+					server, err := sftp.NewServer(&droppingChannel{Channel: channel, server: s, conn: conn}, sftp.WithServerWorkingDirectory(s.root))
+					if err == nil {
+						server.Serve()
+						server.Close()
+					}
+					channel.Close()
+					conn.Close()
+				}()
+			}
+		}()
+	}
+}
+
+// droppingChannel counts the bytes the server receives and closes the
+// connection once the server's dropAfter limit is first exceeded.
+type droppingChannel struct {
+	ssh.Channel
+	server *testSFTPServer
+	conn   ssh.Conn
+}
+
+func (c *droppingChannel) Read(p []byte) (int, error) {
+	n, err := c.Channel.Read(p)
+	received := c.server.bytesReceived.Add(int64(n))
+	if c.server.dropAfter > 0 && received > c.server.dropAfter && c.server.dropped.CompareAndSwap(false, true) {
+		c.conn.Close()
+		return 0, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func writeTestFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "source.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+// exerciseProvider runs the BackupProvider contract against provider.
+func exerciseProvider(t *testing.T, provider BackupProvider) {
+	t.Helper()
+
+	source, data := writeTestFile(t, 200*1024+7)
+	emptySource := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(emptySource, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{"snapshots/s1/manifest.json", "chunks/ab/abcdef", "chunks/cd/cdef01"}
+	for _, key := range keys {
+		if err := provider.Upload(source, key); err != nil {
+			t.Fatalf("upload %s: %v", key, err)
+		}
+	}
+	if err := provider.Upload(emptySource, "chunks/ef/empty"); err != nil {
+		t.Fatalf("upload empty: %v", err)
+	}
+	// Re-uploading replaces the existing object.
+	if err := provider.Upload(source, keys[0]); err != nil {
+		t.Fatalf("re-upload: %v", err)
+	}
+
+	listed, err := provider.List("chunks")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	sort.Strings(listed)
+	want := []string{"chunks/ab/abcdef", "chunks/cd/cdef01", "chunks/ef/empty"}
+	if len(listed) != len(want) {
+		t.Fatalf("list returned %v, want %v", listed, want)
+	}
+	for i := range want {
+		if listed[i] != want[i] {
+			t.Fatalf("list returned %v, want %v", listed, want)
+		}
+	}
+	if missing, err := provider.List("nothing-here"); err != nil || len(missing) != 0 {
+		t.Fatalf("expected empty list for missing prefix, got %v %v", missing, err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "nested", "out.bin")
+	if err := provider.Download(keys[1], dest); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded content does not match upload")
+	}
+	if err := provider.Download("chunks/zz/missing", dest); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for missing object, got %v", err)
+	}
+
+	if err := provider.Delete(keys[1]); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := provider.Delete(keys[1]); err != nil {
+		t.Fatalf("deleting a missing object should succeed, got %v", err)
+	}
+	listed, err = provider.List("chunks")
+	if err != nil || len(listed) != 2 {
+		t.Fatalf("expected 2 objects after delete, got %v %v", listed, err)
+	}
+
+	if err := provider.Upload(source, "../escape"); err == nil {
+		t.Fatal("expected traversal to be rejected")
+	}
+}
+
+func TestSFTPProviderContract(t *testing.T) {
+	server := startTestSFTPServer(t, 0)
+	exerciseProvider(t, server.provider(t, server.fingerprint))
+}
+
+func TestSFTPProviderResumesInterruptedUpload(t *testing.T) {
+	const size = 1024 * 1024
+	server := startTestSFTPServer(t, size/3)
+	provider := server.provider(t, server.fingerprint)
+
+	source, data := writeTestFile(t, size)
+	if err := provider.Upload(source, "big/file.bin"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if !server.dropped.Load() {
+		t.Fatal("expected the first connection to be dropped")
+	}
+	// Resuming re-sends at most the write in flight plus protocol
+	// overhead, not the whole file.
+	if received := server.bytesReceived.Load(); received > size+size/10 {
+		t.Fatalf("upload was restarted rather than resumed: %d bytes received for %d", received, size)
+	}
+	got, err := os.ReadFile(filepath.Join(server.root, "store", "big", "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("resumed upload content does not match source")
+	}
+}
+
+func TestSFTPProviderRejectsUnknownHostKey(t *testing.T) {
+	server := startTestSFTPServer(t, 0)
+	provider := server.provider(t, "SHA256:not-the-server-key")
+	if _, err := provider.List(""); err == nil {
+		t.Fatal("expected host key mismatch to fail")
+	}
+}
@@ -0,0 +1,470 @@
+package providers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// webdavPartialUpdateFeature is advertised in the DAV header by servers
+	// (SabreDAV, Nextcloud) that accept PATCH with X-Update-Range, which is
+	// how interrupted uploads are resumed.
+	webdavPartialUpdateFeature = "sabredav-partialupdate"
+	webdavPartialUpdateType    = "application/x-sabredav-partialupdate"
+)
+
+// WebDAVConfig configures a WebDAVProvider.
+type WebDAVConfig struct {
+	URL      string
+	Username string
+	Password string
+}
+
+// WebDAVProvider stores backups on a WebDAV server. Uploads are written to
+// a partial resource and moved into place; servers that support partial
+// updates resume interrupted uploads instead of restarting them.
+type WebDAVProvider struct {
+	baseURL  *url.URL
+	username string
+	password string
+	client   *http.Client
+
+	mu            sync.Mutex
+	madeDirs      map[string]bool
+	partialUpdate *bool
+}
+
+// webdavStatusError is an unexpected HTTP status from the server.
+type webdavStatusError struct {
+	Method string
+	Key    string
+	Code   int
+}
+
+func (e *webdavStatusError) Error() string {
+	return fmt.Sprintf("webdav %s %s: unexpected status %d", e.Method, e.Key, e.Code)
+}
+
+// Unwrap maps 404 to os.ErrNotExist.
+func (e *webdavStatusError) Unwrap() error {
+	if e.Code == http.StatusNotFound {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// NewWebDAVProvider creates a WebDAVProvider rooted at cfg.URL.
+func NewWebDAVProvider(cfg WebDAVConfig) (*WebDAVProvider, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("webdav url is required")
+	}
+	baseURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav url: %w", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported webdav url scheme %q", baseURL.Scheme)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	return &WebDAVProvider{
+		baseURL:  baseURL,
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   newHTTPClient(),
+		madeDirs: make(map[string]bool),
+	}, nil
+}
+
+// Upload sends a local file to the WebDAV server.
+func (p *WebDAVProvider) Upload(localPath, remotePath string) error {
+	if localPath == "" {
+		return errors.New("local source path is required")
+	}
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	if err := p.mkcolAll(path.Dir(key)); err != nil {
+		return fmt.Errorf("failed to create webdav collection: %w", err)
+	}
+	partial := partialUploadPath(key, info)
+	for attempt := 1; ; attempt++ {
+		err = p.uploadPartial(file, info.Size(), partial)
+		if err == nil || !isRetryableHTTPError(err) || attempt == uploadAttempts {
+			break
+		}
+		log.Printf("[backup] webdav upload of %s interrupted, retrying (attempt %d): %v", key, attempt+1, err)
+	}
+	if err == nil {
+		err = p.move(partial, key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to upload file to webdav: %w", err)
+	}
+	return nil
+}
+
+func (p *WebDAVProvider) uploadPartial(file *os.File, size int64, partial string) error {
+	var offset int64
+	if size > 0 && p.supportsPartialUpdate() {
+		if existing, err := p.size(partial); err == nil && existing <= size {
+			offset = existing
+		}
+	}
+	if offset == size && size > 0 {
+		return nil
+	}
+	// A section reader keeps the client from closing file between attempts.
+	var body io.Reader = io.NewSectionReader(file, offset, size-offset)
+	if size == 0 {
+		body = http.NoBody
+	}
+	req, err := p.newRequest(http.MethodPut, partial, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size - offset
+	if offset > 0 {
+		req.Method = http.MethodPatch
+		req.Header.Set("Content-Type", webdavPartialUpdateType)
+		req.Header.Set("X-Update-Range", fmt.Sprintf("bytes=%d-%d", offset, size-1))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return &webdavStatusError{Method: req.Method, Key: partial, Code: resp.StatusCode}
+	}
+
+	uploaded, err := p.size(partial)
+	if err != nil {
+		return err
+	}
+	if uploaded != size {
+		return fmt.Errorf("uploaded size %d does not match source size %d", uploaded, size)
+	}
+	return nil
+}
+
+// Download retrieves a file from the WebDAV server.
+func (p *WebDAVProvider) Download(remotePath, localPath string) error {
+	if localPath == "" {
+		return errors.New("local destination path is required")
+	}
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	req, err := p.newRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download webdav file: %w", err)
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download webdav file: %w", &webdavStatusError{Method: req.Method, Key: key, Code: resp.StatusCode})
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	file, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local destination file: %w", err)
+	}
+	_, copyErr := io.Copy(file, resp.Body)
+	closeErr := file.Close()
+	if copyErr != nil {
+		return fmt.Errorf("failed to write webdav file to local file: %w", copyErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("failed to close local destination file: %w", closeErr)
+	}
+	return nil
+}
+
+// List enumerates files under the given prefix using depth-1 PROPFIND
+// requests, since many servers disable infinite-depth listings.
+func (p *WebDAVProvider) List(prefix string) ([]string, error) {
+	root := ""
+	if prefix != "" {
+		key, err := cleanRemotePath(prefix)
+		if err != nil {
+			return nil, err
+		}
+		root = key
+	}
+
+	results := []string{}
+	pending := []string{root}
+	for len(pending) > 0 {
+		dir := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		entries, err := p.propfind(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list webdav files: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.key == strings.TrimSuffix(dir, "/") {
+				continue
+			}
+			if entry.isDir {
+				pending = append(pending, entry.key)
+				continue
+			}
+			if !isPartialUpload(entry.key) {
+				results = append(results, entry.key)
+			}
+		}
+	}
+	return results, nil
+}
+
+// Delete removes a file from the WebDAV server.
+func (p *WebDAVProvider) Delete(remotePath string) error {
+	key, err := cleanRemotePath(remotePath)
+	if err != nil {
+		return err
+	}
+	req, err := p.newRequest(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete webdav file: %w", err)
+	}
+	defer drainBody(resp)
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusAccepted, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("failed to delete webdav file: %w", &webdavStatusError{Method: req.Method, Key: key, Code: resp.StatusCode})
+	}
+}
+
+func (p *WebDAVProvider) resourceURL(key string) string {
+	u := *p.baseURL
+	u.Path = p.baseURL.Path + key
+	u.RawPath = ""
+	return u.String()
+}
+
+func (p *WebDAVProvider) newRequest(method, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, p.resourceURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if p.username != "" || p.password != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	return req, nil
+}
+
+func (p *WebDAVProvider) do(method, key string, headers map[string]string, body io.Reader) (*http.Response, error) {
+	req, err := p.newRequest(method, key, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return p.client.Do(req)
+}
+
+// size returns the size of a resource via HEAD.
+func (p *WebDAVProvider) size(key string) (int64, error) {
+	resp, err := p.do(http.MethodHead, key, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return 0, &webdavStatusError{Method: http.MethodHead, Key: key, Code: resp.StatusCode}
+	}
+	if resp.ContentLength < 0 {
+		return strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	}
+	return resp.ContentLength, nil
+}
+
+func (p *WebDAVProvider) move(from, to string) error {
+	resp, err := p.do("MOVE", from, map[string]string{
+		"Destination": p.resourceURL(to),
+		"Overwrite":   "T",
+	}, nil)
+	if err != nil {
+		return err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return &webdavStatusError{Method: "MOVE", Key: from, Code: resp.StatusCode}
+	}
+	return nil
+}
+
+// supportsPartialUpdate checks (once) whether the server advertises the
+// partial update extension.
+func (p *WebDAVProvider) supportsPartialUpdate() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.partialUpdate != nil {
+		return *p.partialUpdate
+	}
+	supported := false
+	if resp, err := p.do(http.MethodOptions, "", nil, nil); err == nil {
+		drainBody(resp)
+		for _, feature := range strings.Split(strings.Join(resp.Header.Values("DAV"), ","), ",") {
+			if strings.EqualFold(strings.TrimSpace(feature), webdavPartialUpdateFeature) {
+				supported = true
+			}
+		}
+		p.partialUpdate = &supported
+	}
+	return supported
+}
+
+func (p *WebDAVProvider) mkcolAll(dir string) error {
+	if dir == "." || dir == "" {
+		return nil
+	}
+	p.mu.Lock()
+	made := p.madeDirs[dir]
+	p.mu.Unlock()
+	if made {
+		return nil
+	}
+	if err := p.mkcolAll(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	resp, err := p.do("MKCOL", dir+"/", nil, nil)
+	if err != nil {
+		return err
+	}
+	drainBody(resp)
+	// 405 means the collection already exists.
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+		return &webdavStatusError{Method: "MKCOL", Key: dir, Code: resp.StatusCode}
+	}
+	p.mu.Lock()
+	p.madeDirs[dir] = true
+	p.mu.Unlock()
+	return nil
+}
+
+type webdavEntry struct {
+	key   string
+	isDir bool
+}
+
+type webdavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const webdavPropfindBody = `<?xml version="1.0" encoding="utf-8"?><D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/></D:prop></D:propfind>`
+
+// propfind lists the direct children of a collection.
+func (p *WebDAVProvider) propfind(dir string) ([]webdavEntry, error) {
+	key := dir
+	if key != "" {
+		key += "/"
+	}
+	resp, err := p.do("PROPFIND", key, map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	}, strings.NewReader(webdavPropfindBody))
+	if err != nil {
+		return nil, err
+	}
+	defer drainBody(resp)
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, &webdavStatusError{Method: "PROPFIND", Key: dir, Code: resp.StatusCode}
+	}
+
+	var status webdavMultistatus
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 64*1024*1024)).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to parse webdav listing: %w", err)
+	}
+	entries := make([]webdavEntry, 0, len(status.Responses))
+	for _, response := range status.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			continue
+		}
+		hrefPath := href.Path
+		if !strings.HasPrefix(hrefPath, p.baseURL.Path) {
+			continue
+		}
+		entry := webdavEntry{key: strings.Trim(strings.TrimPrefix(hrefPath, p.baseURL.Path), "/")}
+		for _, propstat := range response.Propstat {
+			if propstat.Prop.ResourceType.Collection != nil {
+				entry.isDir = true
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// isRetryableHTTPError reports whether an upload error is worth retrying:
+// network failures and server-side (5xx) errors.
+func isRetryableHTTPError(err error) bool {
+	var webdavErr *webdavStatusError
+	if errors.As(err, &webdavErr) {
+		return webdavErr.Code >= 500
+	}
+	var azureErr *azureStatusError
+	if errors.As(err, &azureErr) {
+		return azureErr.Code >= 500
+	}
+	var pathErr *os.PathError
+	return !errors.As(err, &pathErr)
+}
+
+func drainBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// testWebDAVServer serves a temp directory with x/net/webdav, adding the
+// SabreDAV partial update extension and optional failure injection.
+type testWebDAVServer struct {
+	*httptest.Server
+	root string
+
+	// failAfter makes the first PUT store this many bytes and then drop the
+	// connection.
+	failAfter     int64
+	failed        atomic.Bool
+	bytesReceived atomic.Int64
+}
+
+func startTestWebDAVServer(t *testing.T, failAfter int64) *testWebDAVServer {
+	t.Helper()
+	server := &testWebDAVServer{root: t.TempDir(), failAfter: failAfter}
+	handler := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.Dir(server.root),
+		LockSystem: webdav.NewMemLS(),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "backup" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodOptions:
+			w.Header().Set("DAV", "1, 2, "+webdavPartialUpdateFeature)
+			w.WriteHeader(http.StatusOK)
+		case http.MethodPatch:
+			server.patch(w, r)
+		case http.MethodPut:
+			if server.failAfter > 0 && server.failed.CompareAndSwap(false, true) {
+				server.failPut(w, r)
+				return
+			}
+			r.Body = countingBody{r.Body, &server.bytesReceived}
+			handler.ServeHTTP(w, r)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *testWebDAVServer) localPath(r *http.Request) string {
+	return filepath.Join(s.root, filepath.FromSlash(strings.TrimPrefix(r.URL.Path, "/dav/")))
+}
+
+func (s *testWebDAVServer) patch(w http.ResponseWriter, r *http.Request) {
+	var start, end int64
+	if _, err := fmt.Sscanf(r.Header.Get("X-Update-Range"), "bytes=%d-%d", &start, &end); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	file, err := os.OpenFile(s.localPath(r), os.O_WRONLY, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	n, err := io.Copy(io.NewOffsetWriter(file, start), r.Body)
+	s.bytesReceived.Add(n)
+	if err != nil || n != end-start+1 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *testWebDAVServer) failPut(w http.ResponseWriter, r *http.Request) {
+	file, err := os.Create(s.localPath(r))
+	if err == nil {
+		n, _ := io.CopyN(file, r.Body, s.failAfter)
+		s.bytesReceived.Add(n)
+		file.Close()
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	count *atomic.Int64
+}
+
+func (b countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.count.Add(int64(n))
+	return n, err
+}
+
+func (s *testWebDAVServer) provider(t *testing.T) *WebDAVProvider {
+	t.Helper()
+	provider, err := NewWebDAVProvider(WebDAVConfig{URL: s.URL + "/dav", Username: "backup", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestWebDAVProviderContract(t *testing.T) {
+	server := startTestWebDAVServer(t, 0)
+	exerciseProvider(t, server.provider(t))
+}
+
+func TestWebDAVProviderResumesInterruptedUpload(t *testing.T) {
+	const size = 1024 * 1024
+	server := startTestWebDAVServer(t, size/3)
+	provider := server.provider(t)
+
+	source, data := writeTestFile(t, size)
+	if err := provider.Upload(source, "big/file.bin"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if !server.failed.Load() {
+		t.Fatal("expected the first upload to be interrupted")
+	}
+	if received := server.bytesReceived.Load(); received != size {
+		t.Fatalf("upload was restarted rather than resumed: %d bytes received for %d", received, size)
+	}
+	got, err := os.ReadFile(filepath.Join(server.root, "big", "file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("resumed upload content does not match source")
+	}
+	listed, err := provider.List("big")
+	if err != nil || len(listed) != 1 || listed[0] != "big/file.bin" {
+		t.Fatalf("expected only the completed file to be listed, got %v %v", listed, err)
+	}
+}
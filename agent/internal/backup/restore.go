@@ -0,0 +1,514 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+// Conflict policies for files that already exist at the restore destination.
+const (
+	ConflictOverwrite   = "overwrite"
+	ConflictSkip        = "skip"
+	ConflictKeepBoth    = "keep-both"
+	ConflictOnlyIfNewer = "only-if-newer"
+)
+
+// restoreProgressInterval limits how often progress callbacks fire.
+const restoreProgressInterval = 500 * time.Millisecond
+
+// RestoreOptions controls a snapshot restore.
+type RestoreOptions struct {
+	SnapshotID string
+	// TargetPath is the directory files are restored under, at their path
+	// relative to the snapshot root. When empty, files are restored to
+	// their original location.
+	TargetPath string
+	// SelectedPaths limits the restore to these files or directories, given
+	// either as snapshot-relative paths or as original source paths.
+	SelectedPaths []string
+	// ConflictPolicy decides what happens to existing files (default
+	// ConflictOverwrite).
+	ConflictPolicy string
+	// Progress, when set, receives periodic progress updates.
+	Progress func(RestoreProgress)
+}
+
+// RestoreProgress reports how far a running restore has got.
+type RestoreProgress struct {
+	SnapshotID  string  `json:"snapshotId"`
+	CurrentFile string  `json:"currentFile,omitempty"`
+	FilesDone   int     `json:"filesDone"`
+	TotalFiles  int     `json:"totalFiles"`
+	BytesDone   int64   `json:"bytesDone"`
+	TotalBytes  int64   `json:"totalBytes"`
+	Percent     float64 `json:"percent"`
+}
+
+// RestoreResult summarizes a snapshot restore.
+type RestoreResult struct {
+	SnapshotID     string   `json:"snapshotId"`
+	TargetPath     string   `json:"targetPath,omitempty"`
+	ConflictPolicy string   `json:"conflictPolicy"`
+	FilesRestored  int      `json:"filesRestored"`
+	FilesSkipped   int      `json:"filesSkipped"`
+	BytesRestored  int64    `json:"bytesRestored"`
+	TotalFiles     int      `json:"totalFiles"`
+	Errors         []string `json:"errors,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// RestoreSnapshot restores files from a snapshot into targetPath. Files are
+// placed at their path relative to the snapshot root (for example
+// "files/path_0/report.docx"). When selectedPaths is non-empty only those
+// paths are restored. Encrypted snapshots are decrypted with encryptor.
+func RestoreSnapshot(provider providers.BackupProvider, encryptor *Encryptor, snapshotID, targetPath string, selectedPaths []string) (*RestoreResult, error) {
+	if targetPath == "" {
+		return nil, errors.New("target path is required")
+	}
+	return RestoreSnapshotWithOptions(provider, encryptor, RestoreOptions{
+		SnapshotID:    snapshotID,
+		TargetPath:    targetPath,
+		SelectedPaths: selectedPaths,
+	})
+}
+
+// RestoreSnapshotWithOptions restores the point-in-time state of a snapshot
+// (see PointInTimeSnapshot). Each file is written to a temporary file next
+// to its destination and renamed into place, so an interrupted restore never
+// leaves a half-written file where an original used to be. Recorded
+// permissions, ownership (when running as root) and modification times are
+// reapplied.
+func RestoreSnapshotWithOptions(provider providers.BackupProvider, encryptor *Encryptor, opts RestoreOptions) (*RestoreResult, error) {
+	policy := opts.ConflictPolicy
+	if policy == "" {
+		policy = ConflictOverwrite
+	}
+	if !IsValidConflictPolicy(policy) {
+		return nil, fmt.Errorf("invalid conflict policy %q", opts.ConflictPolicy)
+	}
+
+	snapshot, err := PointInTimeSnapshot(provider, encryptor, opts.SnapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := snapshot.Files
+	if len(opts.SelectedPaths) > 0 {
+		var filtered []SnapshotFile
+		for _, file := range files {
+			if isSelected(file, opts.SelectedPaths) {
+				filtered = append(filtered, file)
+			}
+		}
+		files = filtered
+	}
+
+	result := &RestoreResult{
+		SnapshotID:     snapshot.ID,
+		TargetPath:     opts.TargetPath,
+		ConflictPolicy: policy,
+		TotalFiles:     len(files),
+	}
+	progress := RestoreProgress{SnapshotID: snapshot.ID, TotalFiles: len(files)}
+	for _, file := range files {
+		progress.TotalBytes += file.Size
+	}
+	var lastReport time.Time
+	report := func(force bool) {
+		if opts.Progress == nil || (!force && time.Since(lastReport) < restoreProgressInterval) {
+			return
+		}
+		lastReport = time.Now()
+		if progress.TotalBytes > 0 {
+			progress.Percent = float64(progress.BytesDone) * 100 / float64(progress.TotalBytes)
+		} else if progress.TotalFiles > 0 {
+			progress.Percent = float64(progress.FilesDone) * 100 / float64(progress.TotalFiles)
+		}
+		opts.Progress(progress)
+	}
+	report(true)
+
+	store := NewChunkStore(provider, encryptor)
+	for _, file := range files {
+		rel := snapshotRelPath(file)
+		progress.CurrentFile = file.SourcePath
+		fileStart := progress.BytesDone
+
+		restored, err := restoreOne(provider, store, file, rel, opts.TargetPath, policy, result, func(n int64) {
+			progress.BytesDone += n
+			report(false)
+		})
+		// Count skipped and failed files as done so progress reaches 100%.
+		progress.BytesDone = fileStart + file.Size
+		progress.FilesDone++
+		report(false)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("restore %s: %v", rel, err))
+			continue
+		}
+		if !restored {
+			result.FilesSkipped++
+			continue
+		}
+		result.FilesRestored++
+		result.BytesRestored += file.Size
+	}
+	progress.CurrentFile = ""
+	report(true)
+	return result, nil
+}
+
+// IsValidConflictPolicy reports whether policy is a known conflict policy.
+func IsValidConflictPolicy(policy string) bool {
+	switch policy {
+	case ConflictOverwrite, ConflictSkip, ConflictKeepBoth, ConflictOnlyIfNewer:
+		return true
+	}
+	return false
+}
+
+// restoreOne restores a single file, applying the conflict policy. It
+// reports false when the file was skipped.
+func restoreOne(provider providers.BackupProvider, store *ChunkStore, file SnapshotFile, rel, targetPath, policy string, result *RestoreResult, onBytes func(int64)) (bool, error) {
+	var localPath string
+	if targetPath != "" {
+		var err error
+		localPath, err = restoreDestination(targetPath, rel)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		localPath = filepath.Clean(file.SourcePath)
+		if !filepath.IsAbs(localPath) {
+			return false, fmt.Errorf("original path %q is not absolute on this system", file.SourcePath)
+		}
+	}
+
+	localPath, skip, err := resolveConflict(localPath, file, policy)
+	if err != nil || skip {
+		return false, err
+	}
+	if err := restoreFile(provider, store, file, localPath, onBytes); err != nil {
+		return false, err
+	}
+	if err := restoreOwner(localPath, file.UID, file.GID); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("restore ownership of %s: %v", localPath, err))
+	}
+	return true, nil
+}
+
+// resolveConflict applies policy when localPath already exists, returning
+// the path to write to or skip=true.
+func resolveConflict(localPath string, file SnapshotFile, policy string) (string, bool, error) {
+	info, err := os.Lstat(localPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return localPath, false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check destination: %w", err)
+	}
+	if info.IsDir() {
+		return "", false, fmt.Errorf("destination %s is a directory", localPath)
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return "", true, nil
+	case ConflictOnlyIfNewer:
+		if !file.ModTime.After(info.ModTime()) {
+			return "", true, nil
+		}
+		return localPath, false, nil
+	case ConflictKeepBoth:
+		renamed, err := keepBothPath(localPath)
+		return renamed, false, err
+	default:
+		return localPath, false, nil
+	}
+}
+
+// keepBothPath returns a free name next to localPath, such as
+// "report.restored.docx" or "report.restored-2.docx".
+func keepBothPath(localPath string) (string, error) {
+	ext := filepath.Ext(localPath)
+	base := strings.TrimSuffix(localPath, ext)
+	for i := 1; i <= 1000; i++ {
+		candidate := base + ".restored" + ext
+		if i > 1 {
+			candidate = fmt.Sprintf("%s.restored-%d%s", base, i, ext)
+		}
+		if _, err := os.Lstat(candidate); errors.Is(err, os.ErrNotExist) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name to keep both copies of %s", localPath)
+}
+
+// restoreFile writes a single snapshot file to localPath via a temporary
+// file in the same directory, reporting bytes written to onBytes.
+func restoreFile(provider providers.BackupProvider, store *ChunkStore, file SnapshotFile, localPath string, onBytes func(int64)) error {
+	dir := filepath.Dir(localPath)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	tempFile, err := os.CreateTemp(dir, "."+filepath.Base(localPath)+".restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			_ = os.Remove(tempPath)
+		}
+	}()
+
+	if !file.IsChunked() {
+		_ = tempFile.Close()
+		if err := provider.Download(file.BackupPath, tempPath); err != nil {
+			return err
+		}
+		if info, err := os.Stat(tempPath); err == nil {
+			onBytes(info.Size())
+		}
+	} else {
+		for _, chunk := range file.Chunks {
+			data, getErr := store.Get(chunk.Hash)
+			if getErr != nil {
+				err = getErr
+				break
+			}
+			n, writeErr := tempFile.Write(data)
+			onBytes(int64(n))
+			if writeErr != nil {
+				err = fmt.Errorf("failed to write destination file: %w", writeErr)
+				break
+			}
+		}
+		closeErr := tempFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if perm := file.Mode.Perm(); perm != 0 {
+		if err := os.Chmod(tempPath, perm); err != nil {
+			return fmt.Errorf("failed to set permissions: %w", err)
+		}
+	}
+	if !file.ModTime.IsZero() {
+		_ = os.Chtimes(tempPath, file.ModTime, file.ModTime)
+	}
+	if err := os.Rename(tempPath, localPath); err != nil {
+		return fmt.Errorf("failed to move restored file into place: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// restoreDestination resolves rel under targetPath, rejecting paths that
+// would escape it.
+func restoreDestination(targetPath, rel string) (string, error) {
+	base := filepath.Clean(targetPath)
+	localPath := filepath.Join(base, filepath.FromSlash(rel))
+	if localPath != base && !strings.HasPrefix(localPath, base+string(filepath.Separator)) {
+		return "", fmt.Errorf("snapshot path %q resolves outside target", rel)
+	}
+	return localPath, nil
+}
+
+// snapshotRelPath returns the file's path relative to its snapshot root,
+// such as "files/path_0/report.docx".
+func snapshotRelPath(file SnapshotFile) string {
+	parts := strings.SplitN(file.BackupPath, "/", 3)
+	if len(parts) == 3 && parts[0] == snapshotRootDir {
+		return parts[2]
+	}
+	return file.BackupPath
+}
+
+// isSelected reports whether file matches one of the selected paths, either
+// exactly or as a directory prefix, by snapshot-relative or source path.
+func isSelected(file SnapshotFile, selectedPaths []string) bool {
+	rel := snapshotRelPath(file)
+	source := filepath.ToSlash(file.SourcePath)
+	for _, selected := range selectedPaths {
+		selected = filepath.ToSlash(selected)
+		if selected == "" {
+			continue
+		}
+		if selected == rel || selected == source {
+			return true
+		}
+		prefix := strings.TrimSuffix(selected, "/") + "/"
+		if strings.HasPrefix(rel, prefix) || strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PointInTimeSnapshot returns the files as they were when snapshotID was
+// taken. For an incremental snapshot that is its own files plus the latest
+// earlier version of every other file, back to the most recent full
+// snapshot. Deletions are not recorded, so a file removed between snapshots
+// still appears.
+func PointInTimeSnapshot(provider providers.BackupProvider, encryptor *Encryptor, snapshotID string) (*Snapshot, error) {
+	target, err := GetSnapshot(provider, snapshotID, encryptor)
+	if err != nil {
+		return nil, err
+	}
+	if target.Mode == BackupModeFull {
+		return target, nil
+	}
+
+	snapshots, listErr := ListSnapshots(provider, encryptor)
+	if listErr != nil && len(snapshots) == 0 {
+		return nil, listErr
+	}
+	index := -1
+	for i := range snapshots {
+		if snapshots[i].ID == target.ID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		if listErr != nil {
+			return nil, fmt.Errorf("snapshot %s missing from the snapshot listing: %w", target.ID, listErr)
+		}
+		return nil, fmt.Errorf("snapshot %s missing from the snapshot listing", target.ID)
+	}
+
+	merged := *target
+	merged.Files = append([]SnapshotFile(nil), target.Files...)
+	seen := make(map[string]bool, len(target.Files))
+	for _, file := range target.Files {
+		seen[snapshotRelPath(file)] = true
+	}
+	for i := index - 1; i >= 0; i-- {
+		earlier := snapshots[i]
+		if len(earlier.Files) == 0 {
+			return nil, fmt.Errorf("snapshot %s needed for point-in-time restore could not be read: %w", earlier.ID, listErr)
+		}
+		for _, file := range earlier.Files {
+			rel := snapshotRelPath(file)
+			if seen[rel] {
+				continue
+			}
+			seen[rel] = true
+			merged.Files = append(merged.Files, file)
+			merged.Size += file.Size
+		}
+		if earlier.Mode == BackupModeFull {
+			return &merged, nil
+		}
+	}
+	return nil, fmt.Errorf("no full snapshot precedes incremental snapshot %s", target.ID)
+}
+
+// SnapshotEntry is a file or directory in a snapshot browse listing. Path is
+// the original source path (slash-separated) and can be passed back as a
+// selected path to restore it.
+type SnapshotEntry struct {
+	Name      string      `json:"name"`
+	Path      string      `json:"path"`
+	IsDir     bool        `json:"isDir"`
+	Size      int64       `json:"size"`
+	FileCount int         `json:"fileCount,omitempty"`
+	ModTime   time.Time   `json:"modTime,omitempty"`
+	Mode      os.FileMode `json:"mode,omitempty"`
+}
+
+// BrowseSnapshot lists the entries directly below dir in the snapshot's
+// source tree. An empty dir lists the backed-up roots.
+func BrowseSnapshot(snapshot *Snapshot, dir string) ([]SnapshotEntry, error) {
+	entries := make(map[string]*SnapshotEntry)
+	var order []string
+	add := func(key string, entry SnapshotEntry) *SnapshotEntry {
+		existing, ok := entries[key]
+		if !ok {
+			existing = &entry
+			entries[key] = existing
+			order = append(order, key)
+		}
+		return existing
+	}
+
+	dir = filepath.ToSlash(dir)
+	prefix := dir
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	for _, file := range snapshot.Files {
+		source := filepath.ToSlash(file.SourcePath)
+		if dir == "" {
+			root := sourceRoot(file)
+			entry := add(root, SnapshotEntry{Name: root, Path: root, IsDir: true})
+			entry.Size += file.Size
+			entry.FileCount++
+			continue
+		}
+		if !strings.HasPrefix(source, prefix) {
+			continue
+		}
+		name, _, nested := strings.Cut(source[len(prefix):], "/")
+		if !nested {
+			add(name, SnapshotEntry{
+				Name:    name,
+				Path:    source,
+				Size:    file.Size,
+				ModTime: file.ModTime,
+				Mode:    file.Mode,
+			})
+			continue
+		}
+		entry := add(name+"/", SnapshotEntry{Name: name, Path: prefix + name, IsDir: true})
+		entry.Size += file.Size
+		entry.FileCount++
+		if file.ModTime.After(entry.ModTime) {
+			entry.ModTime = file.ModTime
+		}
+	}
+	if dir != "" && len(order) == 0 {
+		return nil, fmt.Errorf("path %q not found in snapshot %s: %w", dir, snapshot.ID, os.ErrNotExist)
+	}
+
+	result := make([]SnapshotEntry, 0, len(order))
+	for _, key := range order {
+		result = append(result, *entries[key])
+	}
+	// Directories first, then by name.
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].IsDir != result[j].IsDir {
+			return result[i].IsDir
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// sourceRoot returns the backup path a file was collected under, derived by
+// removing its path below the root label from the source path.
+func sourceRoot(file SnapshotFile) string {
+	source := filepath.ToSlash(file.SourcePath)
+	rel := strings.TrimPrefix(snapshotRelPath(file), snapshotFilesDir+"/")
+	if _, below, ok := strings.Cut(rel, "/"); ok && strings.HasSuffix(source, "/"+below) {
+		if root := strings.TrimSuffix(source, "/"+below); root != "" {
+			return root
+		}
+		return "/"
+	}
+	return path.Dir(source)
+}
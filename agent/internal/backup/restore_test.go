@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+// twoSnapshotFixture backs up a.txt and b.txt, then changes a.txt and runs
+// an incremental backup that only contains it.
+func twoSnapshotFixture(t *testing.T) (provider providers.BackupProvider, srcDir string, first, second *BackupJob) {
+	t.Helper()
+	srcDir = t.TempDir()
+	provider = providers.NewLocalProvider(t.TempDir())
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a version 1"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(srcDir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "docs", "b.txt"), []byte("b version 1"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}})
+	first, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("first backup failed: %v", err)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("a version 2"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(srcDir, "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	second, err = mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("second backup failed: %v", err)
+	}
+	if len(second.Snapshot.Files) != 1 {
+		t.Fatalf("expected incremental snapshot with 1 file, got %d", len(second.Snapshot.Files))
+	}
+	return provider, srcDir, first, second
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRestoreIncrementalSnapshotIsPointInTime(t *testing.T) {
+	provider, _, _, second := twoSnapshotFixture(t)
+
+	restoreDir := t.TempDir()
+	result, err := RestoreSnapshot(provider, nil, second.Snapshot.ID, restoreDir, nil)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if result.FilesRestored != 2 || len(result.Errors) > 0 {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+	if got := readFile(t, filepath.Join(restoreDir, "files", "path_0", "a.txt")); got != "a version 2" {
+		t.Fatalf("a.txt = %q, want the version from the incremental snapshot", got)
+	}
+	if got := readFile(t, filepath.Join(restoreDir, "files", "path_0", "docs", "b.txt")); got != "b version 1" {
+		t.Fatalf("b.txt = %q, want the version carried from the earlier snapshot", got)
+	}
+}
+
+func TestPruningMiddleIncrementalKeepsLaterRestorePoint(t *testing.T) {
+	// a.txt changes only in the second snapshot, which is then pruned.
+	provider, srcDir, first, second := twoSnapshotFixture(t)
+
+	later := time.Now().Add(2 * time.Minute)
+	bPath := filepath.Join(srcDir, "docs", "b.txt")
+	if err := os.WriteFile(bPath, []byte("b version 2"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(bPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}})
+	mgr.lastSnapshotTime = second.Snapshot.Timestamp
+	third, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("third backup failed: %v", err)
+	}
+
+	snapshots, err := ListSnapshots(provider, nil)
+	if err != nil || len(snapshots) != 3 {
+		t.Fatalf("expected 3 snapshots, got %d: %v", len(snapshots), err)
+	}
+	keep := map[string]bool{first.Snapshot.ID: true, third.Snapshot.ID: true}
+	if err := pruneSnapshots(provider, snapshots, keep, nil, nil); err != nil {
+		t.Fatalf("prune failed: %v", err)
+	}
+	if _, err := GetSnapshot(provider, second.Snapshot.ID, nil); err == nil {
+		t.Fatal("expected the middle snapshot to be deleted")
+	}
+
+	restoreDir := t.TempDir()
+	result, err := RestoreSnapshot(provider, nil, third.Snapshot.ID, restoreDir, nil)
+	if err != nil || result.FilesRestored != 2 || len(result.Errors) > 0 {
+		t.Fatalf("unexpected restore result: %+v, %v", result, err)
+	}
+	if got := readFile(t, filepath.Join(restoreDir, "files", "path_0", "a.txt")); got != "a version 2" {
+		t.Fatalf("a.txt = %q, want the version from the pruned snapshot", got)
+	}
+	if got := readFile(t, filepath.Join(restoreDir, "files", "path_0", "docs", "b.txt")); got != "b version 2" {
+		t.Fatalf("b.txt = %q, want the version from the restored snapshot", got)
+	}
+
+	restoreDir = t.TempDir()
+	if _, err := RestoreSnapshot(provider, nil, first.Snapshot.ID, restoreDir, nil); err != nil {
+		t.Fatalf("restore of first snapshot failed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(restoreDir, "files", "path_0", "a.txt")); got != "a version 1" {
+		t.Fatalf("a.txt = %q, want the version from the first snapshot", got)
+	}
+}
+
+// hidingProvider leaves manifests under hidden prefixes out of listings, as
+// a partial listing from a flaky store would.
+type hidingProvider struct {
+	providers.BackupProvider
+	hidden string
+}
+
+func (p hidingProvider) List(prefix string) ([]string, error) {
+	items, err := p.BackupProvider.List(prefix)
+	var kept []string
+	for _, item := range items {
+		if !strings.Contains(item, p.hidden) {
+			kept = append(kept, item)
+		}
+	}
+	return kept, err
+}
+
+func TestPointInTimeSnapshotRequiresCompleteChain(t *testing.T) {
+	provider, _, first, second := twoSnapshotFixture(t)
+
+	hiding := hidingProvider{BackupProvider: provider, hidden: second.Snapshot.ID}
+	if _, err := PointInTimeSnapshot(hiding, nil, second.Snapshot.ID); err == nil || !strings.Contains(err.Error(), "missing from the snapshot listing") {
+		t.Fatalf("expected an error for an unlisted target, got %v", err)
+	}
+
+	if err := provider.Delete(path.Join(snapshotRootDir, first.Snapshot.ID, snapshotManifestKey)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PointInTimeSnapshot(provider, nil, second.Snapshot.ID); err == nil || !strings.Contains(err.Error(), "no full snapshot") {
+		t.Fatalf("expected an error without a full base snapshot, got %v", err)
+	}
+}
+
+func TestRestoreToOriginalLocationConflictPolicies(t *testing.T) {
+	provider, srcDir, first, _ := twoSnapshotFixture(t)
+	aPath := filepath.Join(srcDir, "a.txt")
+	bPath := filepath.Join(srcDir, "docs", "b.txt")
+
+	restore := func(policy string) *RestoreResult {
+		t.Helper()
+		result, err := RestoreSnapshotWithOptions(provider, nil, RestoreOptions{
+			SnapshotID:     first.Snapshot.ID,
+			ConflictPolicy: policy,
+		})
+		if err != nil {
+			t.Fatalf("%s restore failed: %v", policy, err)
+		}
+		if len(result.Errors) > 0 {
+			t.Fatalf("%s restore errors: %v", policy, result.Errors)
+		}
+		return result
+	}
+
+	// a.txt on disk is newer than the first snapshot's copy.
+	if result := restore(ConflictOnlyIfNewer); result.FilesRestored != 0 || result.FilesSkipped != 2 {
+		t.Fatalf("only-if-newer: unexpected result %+v", result)
+	}
+	if result := restore(ConflictSkip); result.FilesSkipped != 2 {
+		t.Fatalf("skip: unexpected result %+v", result)
+	}
+	if got := readFile(t, aPath); got != "a version 2" {
+		t.Fatalf("skip policies changed a.txt to %q", got)
+	}
+
+	if result := restore(ConflictKeepBoth); result.FilesRestored != 2 {
+		t.Fatalf("keep-both: unexpected result %+v", result)
+	}
+	if got := readFile(t, aPath); got != "a version 2" {
+		t.Fatalf("keep-both replaced a.txt with %q", got)
+	}
+	if got := readFile(t, filepath.Join(srcDir, "a.restored.txt")); got != "a version 1" {
+		t.Fatalf("a.restored.txt = %q", got)
+	}
+	restore(ConflictKeepBoth)
+	if _, err := os.Stat(filepath.Join(srcDir, "a.restored-2.txt")); err != nil {
+		t.Fatalf("expected a second kept copy: %v", err)
+	}
+
+	if err := os.Remove(bPath); err != nil {
+		t.Fatal(err)
+	}
+	if result := restore(ConflictOverwrite); result.FilesRestored != 2 {
+		t.Fatalf("overwrite: unexpected result %+v", result)
+	}
+	if got := readFile(t, aPath); got != "a version 1" {
+		t.Fatalf("overwrite left a.txt as %q", got)
+	}
+	if got := readFile(t, bPath); got != "b version 1" {
+		t.Fatalf("b.txt = %q", got)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(bPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o640 {
+			t.Fatalf("b.txt restored with mode %v, want 0640", info.Mode().Perm())
+		}
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(srcDir, ".*.restore-*"))
+	if len(leftovers) > 0 {
+		t.Fatalf("temporary restore files left behind: %v", leftovers)
+	}
+
+	if _, err := RestoreSnapshotWithOptions(provider, nil, RestoreOptions{SnapshotID: first.Snapshot.ID, ConflictPolicy: "merge"}); err == nil {
+		t.Fatal("expected an invalid conflict policy to be rejected")
+	}
+}
+
+func TestRestoreSelectedDirectoryReportsProgress(t *testing.T) {
+	provider, srcDir, _, second := twoSnapshotFixture(t)
+
+	var events []RestoreProgress
+	restoreDir := t.TempDir()
+	result, err := RestoreSnapshotWithOptions(provider, nil, RestoreOptions{
+		SnapshotID:    second.Snapshot.ID,
+		TargetPath:    restoreDir,
+		SelectedPaths: []string{filepath.ToSlash(filepath.Join(srcDir, "docs"))},
+		Progress:      func(p RestoreProgress) { events = append(events, p) },
+	})
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if result.TotalFiles != 1 || result.FilesRestored != 1 {
+		t.Fatalf("expected only docs/b.txt to be restored, got %+v", result)
+	}
+	if len(events) < 2 {
+		t.Fatalf("expected start and completion progress events, got %d", len(events))
+	}
+	last := events[len(events)-1]
+	if last.FilesDone != 1 || last.Percent != 100 {
+		t.Fatalf("final progress event %+v, want 1 file and 100%%", last)
+	}
+}
+
+func TestBrowseSnapshot(t *testing.T) {
+	provider, srcDir, _, second := twoSnapshotFixture(t)
+	snapshot, err := PointInTimeSnapshot(provider, nil, second.Snapshot.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := BrowseSnapshot(snapshot, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.ToSlash(srcDir)
+	if len(roots) != 1 || roots[0].Path != root || !roots[0].IsDir || roots[0].FileCount != 2 {
+		t.Fatalf("unexpected roots %+v", roots)
+	}
+
+	entries, err := BrowseSnapshot(snapshot, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected docs/ and a.txt, got %+v", entries)
+	}
+	if !entries[0].IsDir || entries[0].Name != "docs" || entries[0].Path != root+"/docs" || entries[0].FileCount != 1 {
+		t.Fatalf("unexpected directory entry %+v", entries[0])
+	}
+	if entries[1].IsDir || entries[1].Name != "a.txt" || entries[1].Size != int64(len("a version 2")) {
+		t.Fatalf("unexpected file entry %+v", entries[1])
+	}
+
+	if _, err := BrowseSnapshot(snapshot, root+"/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for a missing directory, got %v", err)
+	}
+}
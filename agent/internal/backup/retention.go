@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy is a grandfather-father-son retention policy. Last keeps
+// the most recent snapshots regardless of age; Daily, Weekly, Monthly and
+// Yearly each keep the newest snapshot in that many distinct calendar
+// periods. A snapshot kept by any rule is retained.
+type RetentionPolicy struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+}
+
+// IsZero reports whether the policy keeps nothing, which disables pruning.
+func (p RetentionPolicy) IsZero() bool {
+	return p.Last <= 0 && p.Daily <= 0 && p.Weekly <= 0 && p.Monthly <= 0 && p.Yearly <= 0
+}
+
+// String returns a compact description of the policy for logs.
+func (p RetentionPolicy) String() string {
+	return fmt.Sprintf("last=%d daily=%d weekly=%d monthly=%d yearly=%d", p.Last, p.Daily, p.Weekly, p.Monthly, p.Yearly)
+}
+
+// retainedSnapshotIDs returns the IDs of the snapshots the policy keeps.
+func (p RetentionPolicy) retainedSnapshotIDs(snapshots []Snapshot) map[string]bool {
+	newestFirst := append([]Snapshot(nil), snapshots...)
+	sort.SliceStable(newestFirst, func(i, j int) bool {
+		return newestFirst[i].Timestamp.After(newestFirst[j].Timestamp)
+	})
+
+	rules := []struct {
+		keep   int
+		period func(time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+
+	keep := make(map[string]bool)
+	for i, snapshot := range newestFirst {
+		if i < p.Last {
+			keep[snapshot.ID] = true
+		}
+	}
+	for _, rule := range rules {
+		remaining := rule.keep
+		lastPeriod := ""
+		for _, snapshot := range newestFirst {
+			if remaining <= 0 {
+				break
+			}
+			period := rule.period(snapshot.Timestamp.Local())
+			if period == lastPeriod {
+				continue
+			}
+			lastPeriod = period
+			keep[snapshot.ID] = true
+			remaining--
+		}
+	}
+	return keep
+}
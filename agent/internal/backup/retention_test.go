@@ -0,0 +1,44 @@
+package backup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyGFS(t *testing.T) {
+	// Two snapshots a day for 120 days, newest on 2026-06-30.
+	newest := time.Date(2026, 6, 30, 20, 0, 0, 0, time.Local)
+	var snapshots []Snapshot
+	for day := 0; day < 120; day++ {
+		for _, hour := range []int{8, 20} {
+			ts := time.Date(newest.Year(), newest.Month(), newest.Day()-day, hour, 0, 0, 0, time.Local)
+			snapshots = append(snapshots, Snapshot{ID: fmt.Sprintf("s-%03d-%02d", day, hour), Timestamp: ts})
+		}
+	}
+
+	policy := RetentionPolicy{Last: 3, Daily: 7, Weekly: 4, Monthly: 3}
+	keep := policy.retainedSnapshotIDs(snapshots)
+
+	// Last 3: day0@20, day0@08, day1@20. Daily adds days 1-6 (day0 overlaps).
+	for _, id := range []string{"s-000-20", "s-000-08", "s-001-20", "s-006-20"} {
+		if !keep[id] {
+			t.Errorf("expected %s to be kept", id)
+		}
+	}
+	if keep["s-007-20"] && keep["s-007-08"] {
+		t.Error("day 7 should keep at most its newest snapshot")
+	}
+	// Monthly keeps the newest snapshot of June, May and April.
+	for _, id := range []string{"s-030-20", "s-061-20"} { // 2026-05-31, 2026-04-30
+		if !keep[id] {
+			t.Errorf("expected month-end snapshot %s to be kept", id)
+		}
+	}
+	if keep["s-119-20"] {
+		t.Error("oldest snapshot should have been pruned")
+	}
+	if len(keep) > 3+7+4+3 {
+		t.Errorf("kept %d snapshots, more than the policy allows", len(keep))
+	}
+}
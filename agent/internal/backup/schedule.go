@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/schedule"
+)
+
+// Backup run modes. Incremental runs only capture files modified since the
+// previous snapshot; full runs capture everything that passes the filters.
+const (
+	BackupModeIncremental = "incremental"
+	BackupModeFull        = "full"
+)
+
+// Schedule computes backup run times.
+type Schedule = schedule.Schedule
+
+// ScheduleEntry pairs a schedule with the kind of backup it triggers.
+type ScheduleEntry struct {
+	Spec     string
+	Schedule Schedule
+	Mode     string
+}
+
+// ParseSchedule parses a backup schedule specification. Several entries may
+// be separated by ";" and each entry may end with "full" or "incremental"
+// (the default). An entry is one of:
+//
+//   - a Go duration such as "24h", run at that interval
+//   - a five-field cron expression ("0 22 * * 1-5"); the day-of-week field
+//     also accepts "0#1" (first Sunday) and "5L" (last Friday)
+//   - a calendar phrase such as "weekdays at 22:00", "daily at 01:30",
+//     "sunday at 03:00", "monthly on day 15 at 02:00" or
+//     "first sunday monthly at 02:00"
+//
+// For example "weekdays at 22:00; first sunday monthly at 02:00 full".
+func ParseSchedule(spec string) ([]ScheduleEntry, error) {
+	var entries []ScheduleEntry
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		entry, err := parseScheduleEntry(part)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("backup schedule is empty")
+	}
+	return entries, nil
+}
+
+func parseScheduleEntry(spec string) (ScheduleEntry, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	entry := ScheduleEntry{Spec: spec, Mode: BackupModeIncremental}
+	if last := fields[len(fields)-1]; last == BackupModeFull || last == BackupModeIncremental {
+		entry.Mode = last
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return entry, fmt.Errorf("invalid backup schedule %q: missing schedule", spec)
+	}
+
+	sched, err := schedule.Parse(strings.Join(fields, " "))
+	if err != nil {
+		return entry, fmt.Errorf("invalid backup schedule %q: %w", spec, err)
+	}
+	entry.Schedule = sched
+	return entry, nil
+}
+
+// nextScheduledRun returns the earliest upcoming run across entries. When
+// several entries fire at the same time a full run wins.
+func nextScheduledRun(entries []ScheduleEntry, after time.Time) (time.Time, string) {
+	var next time.Time
+	mode := BackupModeIncremental
+	for _, entry := range entries {
+		t := entry.Schedule.Next(after)
+		if t.IsZero() {
+			continue
+		}
+		switch {
+		case next.IsZero() || t.Before(next):
+			next, mode = t, entry.Mode
+		case t.Equal(next) && entry.Mode == BackupModeFull:
+			mode = BackupModeFull
+		}
+	}
+	return next, mode
+}
@@ -0,0 +1,60 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleNextRuns(t *testing.T) {
+	loc := time.Local
+	// Friday 2026-01-09 23:00 local.
+	from := time.Date(2026, 1, 9, 23, 0, 0, 0, loc)
+
+	tests := []struct {
+		spec string
+		want time.Time
+		mode string
+	}{
+		{"weekdays at 22:00", time.Date(2026, 1, 12, 22, 0, 0, 0, loc), BackupModeIncremental},
+		{"0 22 * * 1-5", time.Date(2026, 1, 12, 22, 0, 0, 0, loc), BackupModeIncremental},
+		{"first sunday monthly at 02:00 full", time.Date(2026, 2, 1, 2, 0, 0, 0, loc), BackupModeFull},
+		{"0 2 * * sun#1 full", time.Date(2026, 2, 1, 2, 0, 0, 0, loc), BackupModeFull},
+		{"last friday monthly at 18:30", time.Date(2026, 1, 30, 18, 30, 0, 0, loc), BackupModeIncremental},
+		{"monthly on day 15 at 03:00", time.Date(2026, 1, 15, 3, 0, 0, 0, loc), BackupModeIncremental},
+		{"every day at 01:15", time.Date(2026, 1, 10, 1, 15, 0, 0, loc), BackupModeIncremental},
+		{"saturdays at 09:00", time.Date(2026, 1, 10, 9, 0, 0, 0, loc), BackupModeIncremental},
+		{"*/45 * * * *", time.Date(2026, 1, 9, 23, 45, 0, 0, loc), BackupModeIncremental},
+		{"@weekly", time.Date(2026, 1, 11, 0, 0, 0, 0, loc), BackupModeIncremental},
+		{"6h", from.Add(6 * time.Hour), BackupModeIncremental},
+	}
+	for _, tc := range tests {
+		entries, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.spec, err)
+		}
+		got, mode := nextScheduledRun(entries, from)
+		if !got.Equal(tc.want) || mode != tc.mode {
+			t.Errorf("%q: next run %v (%s), want %v (%s)", tc.spec, got, mode, tc.want, tc.mode)
+		}
+	}
+}
+
+func TestParseScheduleFullWinsOnCollision(t *testing.T) {
+	entries, err := ParseSchedule("daily at 02:00; first sunday monthly at 02:00 full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 1, 31, 12, 0, 0, 0, time.Local)
+	got, mode := nextScheduledRun(entries, from)
+	if !got.Equal(time.Date(2026, 2, 1, 2, 0, 0, 0, time.Local)) || mode != BackupModeFull {
+		t.Fatalf("expected full run on 2026-02-01 02:00, got %v (%s)", got, mode)
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"", "sometimes", "60 * * * *", "0 25 * * *", "weekdays at 25:00", "second monthly", "-1h"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
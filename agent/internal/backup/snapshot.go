@@ -23,22 +23,45 @@ const (
 
 // Snapshot represents a point-in-time backup.
 type Snapshot struct {
-	ID        string         `json:"id"`
-	Timestamp time.Time      `json:"timestamp"`
-	Files     []SnapshotFile `json:"files"`
-	Size      int64          `json:"size"`
+	ID           string         `json:"id"`
+	Timestamp    time.Time      `json:"timestamp"`
+	Files        []SnapshotFile `json:"files"`
+	Size         int64          `json:"size"`
+	Mode         string         `json:"mode,omitempty"`
+	UploadedSize int64          `json:"uploadedSize,omitempty"`
+	Encrypted    bool           `json:"encrypted,omitempty"`
+	KeyID        string         `json:"keyId,omitempty"`
 }
 
 // SnapshotFile captures metadata for a backed up file.
+// Files written by chunked snapshots list their content in Chunks and use
+// BackupPath only as a logical name; older snapshots stored each file as a
+// single object at BackupPath. SHA256 is the hex digest of the whole file
+// content and is empty for snapshots written before it was recorded. Mode,
+// UID and GID are likewise absent from older snapshots; UID and GID are not
+// recorded on Windows.
 type SnapshotFile struct {
-	SourcePath string    `json:"sourcePath"`
-	BackupPath string    `json:"backupPath"`
-	Size       int64     `json:"size"`
-	ModTime    time.Time `json:"modTime"`
+	SourcePath string      `json:"sourcePath"`
+	BackupPath string      `json:"backupPath"`
+	Size       int64       `json:"size"`
+	ModTime    time.Time   `json:"modTime"`
+	Mode       os.FileMode `json:"mode,omitempty"`
+	UID        *int        `json:"uid,omitempty"`
+	GID        *int        `json:"gid,omitempty"`
+	SHA256     string      `json:"sha256,omitempty"`
+	Chunks     []ChunkRef  `json:"chunks"`
 }
 
-// CreateSnapshot creates a new snapshot and uploads files via the provider.
-func CreateSnapshot(provider providers.BackupProvider, files []backupFile) (*Snapshot, error) {
+// IsChunked reports whether the file content is stored in the chunk store.
+func (f SnapshotFile) IsChunked() bool {
+	return f.Chunks != nil
+}
+
+// CreateSnapshot creates a new snapshot, storing file content as
+// deduplicated chunks via the provider. mode records whether the snapshot
+// is full or incremental. When encryptor is non-nil both the chunks and the
+// manifest are encrypted before upload.
+func CreateSnapshot(provider providers.BackupProvider, files []backupFile, mode string, encryptor *Encryptor) (*Snapshot, error) {
 	if provider == nil {
 		return nil, errors.New("backup provider is required")
 	}
@@ -49,36 +72,57 @@ func CreateSnapshot(provider providers.BackupProvider, files []backupFile) (*Sna
 	snapshot := &Snapshot{
 		ID:        newSnapshotID(),
 		Timestamp: time.Now().UTC(),
+		Mode:      mode,
 	}
 
 	prefix := path.Join(snapshotRootDir, snapshot.ID)
+	if encryptor != nil {
+		snapshot.Encrypted = true
+		snapshot.KeyID = encryptor.KeyID()
+	}
+	store := NewChunkStore(provider, encryptor)
 	var errs []error
 
 	for _, file := range files {
 		backupPath := path.Join(prefix, snapshotFilesDir, file.snapshotPath)
-		backupPath = ensureGzipExtension(backupPath)
 
-		if err := provider.Upload(file.sourcePath, backupPath); err != nil {
+		chunks, fileHash, uploaded, err := storeFileChunks(store, file.readPath)
+		snapshot.UploadedSize += uploaded
+		if err != nil {
 			err = fmt.Errorf("failed to upload %s: %w", file.sourcePath, err)
 			errs = append(errs, err)
 			log.Printf("[backup] upload failed: %s: %v", file.sourcePath, err)
 			continue
 		}
+		if chunks == nil {
+			chunks = []ChunkRef{}
+		}
+		// Record what was actually stored; the file may have changed size
+		// since it was scanned.
+		var size int64
+		for _, chunk := range chunks {
+			size += chunk.Size
+		}
 
 		snapshot.Files = append(snapshot.Files, SnapshotFile{
 			SourcePath: file.sourcePath,
 			BackupPath: backupPath,
-			Size:       file.size,
+			Size:       size,
 			ModTime:    file.modTime,
+			Mode:       file.mode,
+			UID:        file.uid,
+			GID:        file.gid,
+			SHA256:     fileHash,
+			Chunks:     chunks,
 		})
-		snapshot.Size += file.size
+		snapshot.Size += size
 	}
 
 	if len(snapshot.Files) == 0 {
 		return nil, errors.Join(errs...)
 	}
 
-	manifestPath, manifestErr := writeSnapshotManifest(snapshot)
+	manifestPath, manifestErr := writeSnapshotManifest(snapshot, encryptor)
 	if manifestErr != nil {
 		return snapshot, manifestErr
 	}
@@ -92,8 +136,11 @@ func CreateSnapshot(provider providers.BackupProvider, files []backupFile) (*Sna
 	return snapshot, nil
 }
 
-// ListSnapshots returns snapshots available from the provider.
-func ListSnapshots(provider providers.BackupProvider) ([]Snapshot, error) {
+// ListSnapshots returns snapshots available from the provider. Encrypted
+// snapshots that cannot be decrypted with encryptor are still listed with
+// their ID and timestamp, and the decryption failure is reported in the
+// returned error.
+func ListSnapshots(provider providers.BackupProvider, encryptor *Encryptor) ([]Snapshot, error) {
 	if provider == nil {
 		return nil, errors.New("backup provider is required")
 	}
@@ -111,49 +158,16 @@ func ListSnapshots(provider providers.BackupProvider) ([]Snapshot, error) {
 			continue
 		}
 
-		tempFile, err := os.CreateTemp("", "snapshot-manifest-*.json")
+		snapshot, err := downloadManifest(provider, item, encryptor)
 		if err != nil {
-			err = fmt.Errorf("failed to create temp manifest: %w", err)
-			errs = append(errs, err)
-			log.Printf("[backup] snapshot manifest temp file failed: %v", err)
-			continue
-		}
-		tempPath := tempFile.Name()
-		_ = tempFile.Close()
-
-		if err := provider.Download(item, tempPath); err != nil {
-			os.Remove(tempPath)
-			err = fmt.Errorf("failed to download manifest %s: %w", item, err)
 			errs = append(errs, err)
-			log.Printf("[backup] snapshot manifest download failed: %s: %v", item, err)
-			continue
-		}
-
-		manifestFile, err := os.Open(tempPath)
-		if err != nil {
-			os.Remove(tempPath)
-			err = fmt.Errorf("failed to open manifest %s: %w", tempPath, err)
-			errs = append(errs, err)
-			log.Printf("[backup] snapshot manifest open failed: %s: %v", item, err)
-			continue
-		}
-		var snapshot Snapshot
-		if err := json.NewDecoder(manifestFile).Decode(&snapshot); err != nil {
-			_ = manifestFile.Close()
-			os.Remove(tempPath)
-			err = fmt.Errorf("failed to decode manifest %s: %w", item, err)
-			errs = append(errs, err)
-			log.Printf("[backup] snapshot manifest decode failed: %s: %v", item, err)
-			continue
-		}
-		if err := manifestFile.Close(); err != nil {
-			err = fmt.Errorf("failed to close manifest %s: %w", item, err)
-			errs = append(errs, err)
-			log.Printf("[backup] snapshot manifest close failed: %s: %v", item, err)
+			log.Printf("[backup] snapshot manifest load failed: %s: %v", item, err)
+			if snapshot == nil {
+				continue
+			}
 		}
-		os.Remove(tempPath)
 
-		snapshots = append(snapshots, snapshot)
+		snapshots = append(snapshots, *snapshot)
 	}
 
 	sort.Slice(snapshots, func(i, j int) bool {
@@ -166,49 +180,190 @@ func ListSnapshots(provider providers.BackupProvider) ([]Snapshot, error) {
 	return snapshots, errors.Join(errs...)
 }
 
-// DeleteSnapshot prunes snapshots beyond the retention count.
-func DeleteSnapshot(provider providers.BackupProvider, retention int) error {
-	if retention <= 0 {
+// DeleteSnapshot prunes snapshots the retention policy does not keep and
+// then garbage-collects chunks that no remaining snapshot references. The
+// files of a pruned snapshot are folded into the incremental snapshot after
+// it so that every kept restore point stays complete.
+func DeleteSnapshot(provider providers.BackupProvider, retention RetentionPolicy, encryptor *Encryptor) error {
+	if retention.IsZero() {
 		return nil
 	}
-	snapshots, err := ListSnapshots(provider)
+	snapshots, err := ListSnapshots(provider, encryptor)
 	if err != nil && len(snapshots) == 0 {
 		return err
 	}
-	if len(snapshots) <= retention {
-		return err
-	}
 
+	return pruneSnapshots(provider, snapshots, retention.retainedSnapshotIDs(snapshots), encryptor, err)
+}
+
+// pruneSnapshots deletes the snapshots not in keep, oldest first, and then
+// garbage-collects chunks. listErr is the error from listing snapshots; a
+// partial listing limits what can be pruned safely.
+func pruneSnapshots(provider providers.BackupProvider, snapshots []Snapshot, keep map[string]bool, encryptor *Encryptor, listErr error) error {
 	var errs []error
+	var retained []Snapshot
+	for i, snapshot := range snapshots {
+		if keep[snapshot.ID] {
+			retained = append(retained, snapshot)
+			continue
+		}
+		// A later incremental snapshot is restored through this one, so its
+		// files move forward before it goes. Without a complete listing the
+		// next snapshot seen may not be the real successor.
+		if i+1 < len(snapshots) && snapshots[i+1].Mode != BackupModeFull {
+			if listErr != nil {
+				retained = append(retained, snapshot)
+				continue
+			}
+			if foldErr := foldIntoSuccessor(provider, snapshot, &snapshots[i+1], encryptor); foldErr != nil {
+				errs = append(errs, foldErr)
+				log.Printf("[backup] snapshot prune skipped: %s: %v", snapshot.ID, foldErr)
+				retained = append(retained, snapshot)
+				continue
+			}
+		}
+		if delErr := deleteSnapshotObjects(provider, snapshot.ID); delErr != nil {
+			errs = append(errs, delErr)
+			// Keep its chunks: a partially deleted snapshot may still
+			// have a manifest that references them.
+			retained = append(retained, snapshot)
+		}
+	}
+
+	// Only collect garbage when every manifest was readable and decrypted;
+	// otherwise an unreadable manifest's chunks would look unreferenced.
+	if listErr == nil {
+		if gcErr := collectChunkGarbage(provider, retained); gcErr != nil {
+			errs = append(errs, gcErr)
+		}
+	}
+
+	return errors.Join(listErr, errors.Join(errs...))
+}
+
+// foldIntoSuccessor copies the files of a snapshot about to be pruned into
+// the incremental snapshot that follows it, unless the successor already
+// has a newer version, and uploads the successor's updated manifest. Folding
+// a full snapshot makes the successor full.
+func foldIntoSuccessor(provider providers.BackupProvider, pruned Snapshot, successor *Snapshot, encryptor *Encryptor) error {
+	// Snapshots are never written empty; an empty one is a manifest that
+	// could not be decrypted.
+	if len(pruned.Files) == 0 || len(successor.Files) == 0 {
+		return fmt.Errorf("snapshot %s or %s could not be read", pruned.ID, successor.ID)
+	}
 
-	toDelete := snapshots[:len(snapshots)-retention]
-	for _, snapshot := range toDelete {
-		prefix := path.Join(snapshotRootDir, snapshot.ID)
-		items, listErr := provider.List(prefix)
-		if listErr != nil {
-			listErr = fmt.Errorf("failed to list snapshot %s: %w", snapshot.ID, listErr)
-			errs = append(errs, listErr)
-			log.Printf("[backup] snapshot list failed: %s: %v", snapshot.ID, listErr)
+	merged := *successor
+	merged.Files = append([]SnapshotFile(nil), successor.Files...)
+	seen := make(map[string]bool, len(successor.Files))
+	for _, file := range successor.Files {
+		seen[snapshotRelPath(file)] = true
+	}
+	for _, file := range pruned.Files {
+		rel := snapshotRelPath(file)
+		if seen[rel] {
 			continue
 		}
+		// Single-object files live under the pruned snapshot's own prefix
+		// and would be deleted with it.
+		if !file.IsChunked() {
+			return fmt.Errorf("snapshot %s has unchunked files still needed by %s", pruned.ID, successor.ID)
+		}
+		seen[rel] = true
+		merged.Files = append(merged.Files, file)
+		merged.Size += file.Size
+	}
+	if pruned.Mode == BackupModeFull {
+		merged.Mode = BackupModeFull
+	}
+	if encryptor != nil {
+		merged.Encrypted = true
+		merged.KeyID = encryptor.KeyID()
+	}
+
+	manifestPath, err := writeSnapshotManifest(&merged, encryptor)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(manifestPath)
+	if err := provider.Upload(manifestPath, path.Join(snapshotRootDir, merged.ID, snapshotManifestKey)); err != nil {
+		return fmt.Errorf("failed to upload snapshot manifest %s: %w", merged.ID, err)
+	}
+	*successor = merged
+	return nil
+}
+
+// GetSnapshot loads and, if needed, decrypts the manifest for a single
+// snapshot.
+func GetSnapshot(provider providers.BackupProvider, snapshotID string, encryptor *Encryptor) (*Snapshot, error) {
+	if provider == nil {
+		return nil, errors.New("backup provider is required")
+	}
+	if snapshotID == "" || strings.ContainsAny(snapshotID, "/\\") || snapshotID == "." || snapshotID == ".." {
+		return nil, fmt.Errorf("invalid snapshot id %q", snapshotID)
+	}
+	snapshot, err := downloadManifest(provider, path.Join(snapshotRootDir, snapshotID, snapshotManifestKey), encryptor)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func deleteSnapshotObjects(provider providers.BackupProvider, snapshotID string) error {
+	prefix := path.Join(snapshotRootDir, snapshotID)
+	items, listErr := provider.List(prefix)
+	if listErr != nil {
+		listErr = fmt.Errorf("failed to list snapshot %s: %w", snapshotID, listErr)
+		log.Printf("[backup] snapshot list failed: %s: %v", snapshotID, listErr)
+		return listErr
+	}
+
+	var errs []error
+	for _, item := range items {
+		if delErr := provider.Delete(item); delErr != nil {
+			delErr = fmt.Errorf("failed to delete %s: %w", item, delErr)
+			errs = append(errs, delErr)
+			log.Printf("[backup] snapshot delete failed: %s: %v", item, delErr)
+		}
+	}
+	return errors.Join(errs...)
+}
 
-		for _, item := range items {
-			if delErr := provider.Delete(item); delErr != nil {
-				delErr = fmt.Errorf("failed to delete %s: %w", item, delErr)
-				errs = append(errs, delErr)
-				log.Printf("[backup] snapshot delete failed: %s: %v", item, delErr)
+// collectChunkGarbage deletes chunks that none of the given snapshots
+// reference.
+func collectChunkGarbage(provider providers.BackupProvider, snapshots []Snapshot) error {
+	referenced := make(map[string]struct{})
+	for _, snapshot := range snapshots {
+		for _, file := range snapshot.Files {
+			for _, chunk := range file.Chunks {
+				referenced[chunk.Hash] = struct{}{}
 			}
 		}
 	}
 
-	return errors.Join(err, errors.Join(errs...))
-}
+	store := NewChunkStore(provider, nil)
+	hashes, err := store.List()
+	if err != nil {
+		return err
+	}
 
-func ensureGzipExtension(p string) string {
-	if strings.HasSuffix(p, ".gz") {
-		return p
+	var errs []error
+	removed := 0
+	for _, hash := range hashes {
+		if _, ok := referenced[hash]; ok {
+			continue
+		}
+		if delErr := store.Delete(hash); delErr != nil {
+			delErr = fmt.Errorf("failed to delete chunk %s: %w", hash, delErr)
+			errs = append(errs, delErr)
+			log.Printf("[backup] chunk delete failed: %s: %v", hash, delErr)
+			continue
+		}
+		removed++
 	}
-	return p + ".gz"
+	if removed > 0 {
+		log.Printf("[backup] garbage collected %d unreferenced chunks", removed)
+	}
+	return errors.Join(errs...)
 }
 
 func isManifestPath(item string) bool {
@@ -216,13 +371,75 @@ func isManifestPath(item string) bool {
 	return strings.HasSuffix(item, "/"+snapshotManifestKey) || path.Base(item) == snapshotManifestKey
 }
 
-func writeSnapshotManifest(snapshot *Snapshot) (string, error) {
+// downloadManifest fetches and decodes a snapshot manifest. If the manifest
+// is encrypted and cannot be opened, the returned snapshot carries only the
+// unencrypted header fields alongside the error.
+func downloadManifest(provider providers.BackupProvider, key string, encryptor *Encryptor) (*Snapshot, error) {
+	tempFile, err := os.CreateTemp("", "snapshot-manifest-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp manifest: %w", err)
+	}
+	tempPath := tempFile.Name()
+	_ = tempFile.Close()
+	defer os.Remove(tempPath)
+
+	if err := provider.Download(key, tempPath); err != nil {
+		return nil, fmt.Errorf("failed to download manifest %s: %w", key, err)
+	}
+
+	data, err := os.ReadFile(tempPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest %s: %w", tempPath, err)
+	}
+
+	var envelope encryptedManifest
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %w", key, err)
+	}
+	if envelope.Format == encryptedManifestFormat {
+		header := &Snapshot{
+			ID:        envelope.SnapshotID,
+			Timestamp: envelope.Timestamp,
+			Encrypted: true,
+			KeyID:     envelope.KeyID,
+		}
+		if encryptor == nil {
+			return header, fmt.Errorf("%w: snapshot %s", ErrEncryptionKeyRequired, envelope.SnapshotID)
+		}
+		data, err = encryptor.openManifest(&envelope)
+		if err != nil {
+			return header, err
+		}
+	} else if encryptor != nil && !encryptor.allowPlaintext {
+		return nil, fmt.Errorf("%w: manifest %s", ErrUnencryptedData, key)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %w", key, err)
+	}
+	return &snapshot, nil
+}
+
+func writeSnapshotManifest(snapshot *Snapshot, encryptor *Encryptor) (string, error) {
+	var payload any = snapshot
+	if encryptor != nil {
+		manifestJSON, err := json.Marshal(snapshot)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode snapshot manifest: %w", err)
+		}
+		payload, err = encryptor.sealManifest(snapshot, manifestJSON)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt snapshot manifest: %w", err)
+		}
+	}
+
 	tempFile, err := os.CreateTemp("", "snapshot-manifest-*.json")
 	if err != nil {
 		return "", fmt.Errorf("failed to create snapshot manifest: %w", err)
 	}
 	encoder := json.NewEncoder(tempFile)
-	if err := encoder.Encode(snapshot); err != nil {
+	if err := encoder.Encode(payload); err != nil {
 		_ = tempFile.Close()
 		return "", fmt.Errorf("failed to encode snapshot manifest: %w", err)
 	}
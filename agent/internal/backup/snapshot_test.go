@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+func randomBytes(seed uint64, size int) []byte {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(rng.Uint32())
+	}
+	return data
+}
+
+func chunkHashes(t *testing.T, data []byte) []string {
+	t.Helper()
+	chunker := NewChunker(bytes.NewReader(data))
+	var hashes []string
+	for {
+		chunk, err := chunker.Next()
+		if err != nil {
+			break
+		}
+		sum := sha256.Sum256(chunk)
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	return hashes
+}
+
+func TestChunkerBoundsAndReassembly(t *testing.T) {
+	data := randomBytes(1, 9*1024*1024+123)
+	chunker := NewChunker(bytes.NewReader(data))
+
+	var rebuilt []byte
+	for {
+		chunk, err := chunker.Next()
+		if err != nil {
+			break
+		}
+		if len(chunk) > maxChunkSize {
+			t.Fatalf("chunk of %d bytes exceeds max %d", len(chunk), maxChunkSize)
+		}
+		rebuilt = append(rebuilt, chunk...)
+	}
+	if !bytes.Equal(rebuilt, data) {
+		t.Fatal("reassembled chunks do not match input")
+	}
+}
+
+func TestChunkerBoundariesSurviveInsert(t *testing.T) {
+	data := randomBytes(2, 12*1024*1024)
+	shifted := append([]byte("inserted header bytes"), data...)
+
+	original := chunkHashes(t, data)
+	changed := chunkHashes(t, shifted)
+
+	known := make(map[string]bool, len(original))
+	for _, h := range original {
+		known[h] = true
+	}
+	shared := 0
+	for _, h := range changed {
+		if known[h] {
+			shared++
+		}
+	}
+	if shared < len(original)-2 {
+		t.Fatalf("expected most chunks to be shared after insert, got %d of %d", shared, len(original))
+	}
+}
+
+func TestSnapshotDeduplicatesAndRestores(t *testing.T) {
+	srcDir := t.TempDir()
+	provider := providers.NewLocalProvider(t.TempDir())
+
+	content := randomBytes(3, 6*1024*1024)
+	srcFile := filepath.Join(srcDir, "mailbox.pst")
+	if err := os.WriteFile(srcFile, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "empty.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}})
+	first, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("first backup failed: %v", err)
+	}
+	if first.Snapshot.UploadedSize != int64(len(content)) {
+		t.Fatalf("expected first backup to upload %d bytes, got %d", len(content), first.Snapshot.UploadedSize)
+	}
+
+	// Touch the file so the incremental scan picks it up again unchanged.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(srcFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	second, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("second backup failed: %v", err)
+	}
+	if second.Snapshot.UploadedSize != 0 {
+		t.Fatalf("expected unchanged file to upload nothing, got %d bytes", second.Snapshot.UploadedSize)
+	}
+
+	restoreDir := t.TempDir()
+	result, err := RestoreSnapshot(provider, nil, first.Snapshot.ID, restoreDir, nil)
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if len(result.Errors) > 0 || result.FilesRestored != 2 {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+	restored, err := os.ReadFile(filepath.Join(restoreDir, "files", "path_0", "mailbox.pst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, content) {
+		t.Fatal("restored content does not match source")
+	}
+	if info, err := os.Stat(filepath.Join(restoreDir, "files", "path_0", "empty.txt")); err != nil || info.Size() != 0 {
+		t.Fatalf("expected empty file to be restored, got %v %v", info, err)
+	}
+}
+
+func TestDeleteSnapshotCollectsUnreferencedChunks(t *testing.T) {
+	srcDir := t.TempDir()
+	provider := providers.NewLocalProvider(t.TempDir())
+	srcFile := filepath.Join(srcDir, "db.bin")
+
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}})
+	for i := range 3 {
+		if err := os.WriteFile(srcFile, randomBytes(uint64(10+i), 2*1024*1024), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		later := time.Now().Add(time.Duration(i+1) * time.Minute)
+		if err := os.Chtimes(srcFile, later, later); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mgr.RunBackup(); err != nil {
+			t.Fatalf("backup %d failed: %v", i, err)
+		}
+	}
+
+	if err := DeleteSnapshot(provider, RetentionPolicy{Last: 1}, nil); err != nil {
+		t.Fatalf("delete snapshot failed: %v", err)
+	}
+
+	snapshots, err := ListSnapshots(provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 {
+		t.Fatalf("expected 1 snapshot after pruning, got %d", len(snapshots))
+	}
+
+	referenced := make(map[string]bool)
+	for _, file := range snapshots[0].Files {
+		for _, chunk := range file.Chunks {
+			referenced[chunk.Hash] = true
+		}
+	}
+	stored, err := NewChunkStore(provider, nil).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(referenced) {
+		t.Fatalf("expected %d chunks after gc, found %d", len(referenced), len(stored))
+	}
+	for _, hash := range stored {
+		if !referenced[hash] {
+			t.Fatalf("unreferenced chunk %s survived gc", hash)
+		}
+	}
+}
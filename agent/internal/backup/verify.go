@@ -0,0 +1,205 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+// Verification problem kinds reported in VerifyIssue.Problem.
+const (
+	VerifyProblemMissing   = "missing"
+	VerifyProblemCorrupt   = "corrupt"
+	VerifyProblemTruncated = "truncated"
+)
+
+// VerifyIssue describes a snapshot file that failed verification.
+type VerifyIssue struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// VerifyResult summarizes a snapshot verification.
+type VerifyResult struct {
+	SnapshotID    string        `json:"snapshotId"`
+	TotalFiles    int           `json:"totalFiles"`
+	FilesChecked  int           `json:"filesChecked"`
+	FilesVerified int           `json:"filesVerified"`
+	BytesChecked  int64         `json:"bytesChecked"`
+	Sampled       bool          `json:"sampled"`
+	Missing       int           `json:"missing"`
+	Corrupt       int           `json:"corrupt"`
+	Truncated     int           `json:"truncated"`
+	Issues        []VerifyIssue `json:"issues,omitempty"`
+}
+
+// Passed reports whether every checked file verified.
+func (r *VerifyResult) Passed() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *VerifyResult) addIssue(rel, problem, detail string) {
+	r.Issues = append(r.Issues, VerifyIssue{Path: rel, Problem: problem, Detail: detail})
+	switch problem {
+	case VerifyProblemMissing:
+		r.Missing++
+	case VerifyProblemTruncated:
+		r.Truncated++
+	default:
+		r.Corrupt++
+	}
+}
+
+// verifyFailure is a per-file verification failure.
+type verifyFailure struct {
+	problem string
+	detail  string
+}
+
+func (f *verifyFailure) Error() string {
+	return f.problem + ": " + f.detail
+}
+
+// VerifySnapshot streams a snapshot's content back from the provider and
+// checks every file against the sizes and hashes recorded in its manifest.
+// When sampleSize is positive only that many randomly chosen files are
+// checked. Problems with individual files are reported in the result; the
+// returned error is reserved for failures that prevent verification, such
+// as an unreadable manifest or a missing encryption key.
+func VerifySnapshot(provider providers.BackupProvider, encryptor *Encryptor, snapshotID string, sampleSize int) (*VerifyResult, error) {
+	snapshot, err := GetSnapshot(provider, snapshotID, encryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{
+		SnapshotID: snapshot.ID,
+		TotalFiles: len(snapshot.Files),
+	}
+	files := snapshot.Files
+	if sampleSize > 0 && sampleSize < len(files) {
+		result.Sampled = true
+		sampled := make([]SnapshotFile, 0, sampleSize)
+		for _, idx := range rand.Perm(len(files))[:sampleSize] {
+			sampled = append(sampled, files[idx])
+		}
+		files = sampled
+	}
+
+	store := NewChunkStore(provider, encryptor)
+	storedChunks, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	present := make(map[string]struct{}, len(storedChunks))
+	for _, hash := range storedChunks {
+		present[hash] = struct{}{}
+	}
+
+	prefix := path.Join(snapshotRootDir, snapshot.ID) + "/"
+	for _, file := range files {
+		rel := strings.TrimPrefix(file.BackupPath, prefix)
+		result.FilesChecked++
+
+		var checked int64
+		if file.IsChunked() {
+			checked, err = verifyChunkedFile(store, present, file)
+		} else {
+			checked, err = verifyLegacyFile(provider, file)
+		}
+		result.BytesChecked += checked
+
+		var failure *verifyFailure
+		switch {
+		case err == nil:
+			result.FilesVerified++
+		case errors.As(err, &failure):
+			result.addIssue(rel, failure.problem, failure.detail)
+		case errors.Is(err, ErrEncryptionKeyRequired), errors.Is(err, ErrWrongEncryptionKey):
+			return result, err
+		default:
+			result.addIssue(rel, VerifyProblemCorrupt, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// verifyChunkedFile re-reads every chunk of file and checks the reassembled
+// content against the recorded size and hash.
+func verifyChunkedFile(store *ChunkStore, present map[string]struct{}, file SnapshotFile) (int64, error) {
+	for _, chunk := range file.Chunks {
+		if _, ok := present[chunk.Hash]; !ok {
+			return 0, &verifyFailure{VerifyProblemMissing, fmt.Sprintf("chunk %s not found", chunk.Hash)}
+		}
+	}
+
+	fileHash := sha256.New()
+	var read int64
+	for _, chunk := range file.Chunks {
+		data, err := store.Get(chunk.Hash)
+		if err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return read, &verifyFailure{VerifyProblemTruncated, err.Error()}
+			}
+			return read, err
+		}
+		if int64(len(data)) != chunk.Size {
+			return read, &verifyFailure{VerifyProblemCorrupt, fmt.Sprintf("chunk %s is %d bytes, expected %d", chunk.Hash, len(data), chunk.Size)}
+		}
+		fileHash.Write(data)
+		read += int64(len(data))
+	}
+	return read, checkFileContent(file, read, hex.EncodeToString(fileHash.Sum(nil)))
+}
+
+// verifyLegacyFile downloads a single-object file from an older snapshot.
+func verifyLegacyFile(provider providers.BackupProvider, file SnapshotFile) (int64, error) {
+	tempFile, err := os.CreateTemp("", "backup-verify-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+	_ = tempFile.Close()
+
+	if err := provider.Download(file.BackupPath, tempPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, &verifyFailure{VerifyProblemMissing, err.Error()}
+		}
+		return 0, err
+	}
+
+	content, err := os.Open(tempPath)
+	if err != nil {
+		return 0, err
+	}
+	defer content.Close()
+	fileHash := sha256.New()
+	read, err := io.Copy(fileHash, content)
+	if err != nil {
+		return read, err
+	}
+	return read, checkFileContent(file, read, hex.EncodeToString(fileHash.Sum(nil)))
+}
+
+func checkFileContent(file SnapshotFile, size int64, sum string) error {
+	if size < file.Size {
+		return &verifyFailure{VerifyProblemTruncated, fmt.Sprintf("read %d of %d bytes", size, file.Size)}
+	}
+	if size > file.Size {
+		return &verifyFailure{VerifyProblemCorrupt, fmt.Sprintf("read %d bytes, expected %d", size, file.Size)}
+	}
+	if file.SHA256 != "" && sum != file.SHA256 {
+		return &verifyFailure{VerifyProblemCorrupt, "content hash mismatch"}
+	}
+	return nil
+}
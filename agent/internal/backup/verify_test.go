@@ -0,0 +1,79 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/breeze-rmm/agent/internal/backup/providers"
+)
+
+func TestVerifySnapshotReportsDamagedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	storeDir := t.TempDir()
+	provider := providers.NewLocalProvider(storeDir)
+
+	names := []string{"a.bin", "b.bin", "c.bin"}
+	for i, name := range names {
+		if err := os.WriteFile(filepath.Join(srcDir, name), randomBytes(uint64(20+i), 300*1024), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := NewBackupManager(BackupConfig{Provider: provider, Paths: []string{srcDir}})
+	job, err := mgr.RunBackup()
+	if err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	for _, file := range job.Snapshot.Files {
+		if len(file.SHA256) != 64 {
+			t.Fatalf("expected sha256 for %s, got %q", file.BackupPath, file.SHA256)
+		}
+	}
+
+	result, err := VerifySnapshot(provider, nil, job.Snapshot.ID, 0)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !result.Passed() || result.FilesVerified != len(names) {
+		t.Fatalf("expected clean verification, got %+v", result)
+	}
+
+	sampled, err := VerifySnapshot(provider, nil, job.Snapshot.ID, 1)
+	if err != nil {
+		t.Fatalf("sampled verify failed: %v", err)
+	}
+	if !sampled.Sampled || sampled.FilesChecked != 1 {
+		t.Fatalf("expected one sampled file, got %+v", sampled)
+	}
+
+	// Damage each file's first chunk in a different way.
+	chunkPath := func(idx int) string {
+		return filepath.Join(storeDir, filepath.FromSlash(chunkKey(job.Snapshot.Files[idx].Chunks[0].Hash)))
+	}
+	if err := os.Remove(chunkPath(0)); err != nil {
+		t.Fatal(err)
+	}
+	object, err := os.ReadFile(chunkPath(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(chunkPath(1), object[:len(object)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	object, err = os.ReadFile(chunkPath(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	object[len(object)/2] ^= 0xff
+	if err := os.WriteFile(chunkPath(2), object, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = VerifySnapshot(provider, nil, job.Snapshot.ID, 0)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if result.Missing != 1 || result.Truncated != 1 || result.Corrupt != 1 || result.FilesVerified != 0 {
+		t.Fatalf("expected one missing, truncated and corrupt file, got %+v", result)
+	}
+}
@@ -0,0 +1,331 @@
+// Package cmdjournal records the lifecycle of server commands on disk so a
+// command is executed at most once, even across agent restarts, and commands
+// cut short by a crash or restart can be reported instead of forgotten.
+package cmdjournal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/logging"
+)
+
+var log = logging.L("cmdjournal")
+
+// State is the lifecycle state of a journaled command.
+type State string
+
+const (
+	StateReceived    State = "received"
+	StateRunning     State = "running"
+	StateCompleted   State = "completed"
+	StateInterrupted State = "interrupted"
+
+	// stateReleased marks a claim given up by Release. It is only ever
+	// written to the file; loading it forgets the command.
+	stateReleased State = "released"
+)
+
+const (
+	// Retention is how long finished commands are remembered for
+	// deduplication.
+	Retention = 7 * 24 * time.Hour
+
+	maxRecords = 10000
+
+	// compactSlack is the number of superseded lines tolerated in the file
+	// before it is rewritten.
+	compactSlack = 1000
+)
+
+// Record is the journaled state of one command. The journal file holds one
+// record per line; the last line for an ID wins.
+type Record struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type,omitempty"`
+	State        State     `json:"state"`
+	ResultStatus string    `json:"resultStatus,omitempty"`
+	ResultHash   string    `json:"resultHash,omitempty"`
+	ReceivedAt   time.Time `json:"receivedAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Finished reports whether the command reached a terminal state.
+func (r Record) Finished() bool {
+	return r.State == StateCompleted || r.State == StateInterrupted
+}
+
+// Journal is an append-only, fsynced log of command state transitions.
+type Journal struct {
+	path string
+
+	mu          sync.Mutex
+	file        *os.File
+	records     map[string]*Record
+	lines       int
+	interrupted []Record
+	now         func() time.Time
+}
+
+// Open loads the journal at path, creating it if needed. Commands that were
+// received or running when the agent last stopped are returned by
+// Interrupted.
+func Open(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create journal dir: %w", err)
+	}
+	j := &Journal{
+		path:    path,
+		records: make(map[string]*Record),
+		now:     time.Now,
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	for _, rec := range j.records {
+		if !rec.Finished() {
+			j.interrupted = append(j.interrupted, *rec)
+		}
+	}
+	sort.Slice(j.interrupted, func(a, b int) bool {
+		return j.interrupted[a].ReceivedAt.Before(j.interrupted[b].ReceivedAt)
+	})
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	if len(j.interrupted) > 0 {
+		log.Warn("found commands interrupted by agent restart", "count", len(j.interrupted))
+	}
+	return j, nil
+}
+
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.ID == "" {
+			// A torn final line from a crash mid-write; earlier lines are intact.
+			continue
+		}
+		if rec.State == stateReleased {
+			delete(j.records, rec.ID)
+			continue
+		}
+		j.records[rec.ID] = &rec
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	return nil
+}
+
+// compact rewrites the journal with one line per remembered command,
+// dropping finished commands past the retention period.
+func (j *Journal) compact() error {
+	cutoff := j.now().Add(-Retention)
+	live := make([]*Record, 0, len(j.records))
+	for id, rec := range j.records {
+		if rec.Finished() && rec.UpdatedAt.Before(cutoff) {
+			delete(j.records, id)
+			continue
+		}
+		live = append(live, rec)
+	}
+	sort.Slice(live, func(a, b int) bool { return live[a].UpdatedAt.Before(live[b].UpdatedAt) })
+	for len(live) > maxRecords {
+		// Oldest finished commands go first; unfinished ones are kept until
+		// they are resolved.
+		i := 0
+		for i < len(live) && !live[i].Finished() {
+			i++
+		}
+		if i == len(live) {
+			break
+		}
+		delete(j.records, live[i].ID)
+		live = append(live[:i], live[i+1:]...)
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range live {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.lines = len(live)
+	return nil
+}
+
+// appendLocked persists rec and updates the in-memory index.
+func (j *Journal) appendLocked(rec Record) error {
+	if rec.State == stateReleased {
+		delete(j.records, rec.ID)
+	} else {
+		j.records[rec.ID] = &rec
+	}
+	if j.file == nil {
+		return errors.New("journal is closed")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	j.lines++
+	if j.lines > len(j.records)+compactSlack {
+		if err := j.compact(); err != nil {
+			log.Warn("journal compaction failed", "error", err.Error())
+		}
+	}
+	return nil
+}
+
+// Begin records that a command was received. It returns false if the
+// command ID is already journaled, in which case the command must not be
+// executed again. The returned error reports a failure to persist the
+// record; the command is still claimed in memory.
+func (j *Journal) Begin(id, cmdType string) (bool, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, ok := j.records[id]; ok {
+		return false, nil
+	}
+	now := j.now().UTC()
+	return true, j.appendLocked(Record{ID: id, Type: cmdType, State: StateReceived, ReceivedAt: now, UpdatedAt: now})
+}
+
+// Release gives up a claim made by Begin for a command that was rejected
+// before it ran, so a later delivery of the same command can claim it.
+// Commands that have started running are not released.
+func (j *Journal) Release(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	rec, ok := j.records[id]
+	if !ok || rec.State != StateReceived {
+		return nil
+	}
+	return j.appendLocked(Record{ID: id, State: stateReleased, ReceivedAt: rec.ReceivedAt, UpdatedAt: j.now().UTC()})
+}
+
+// Running records that execution of a command has started.
+func (j *Journal) Running(id string) error {
+	return j.transition(id, StateRunning, "", nil)
+}
+
+// Complete records the outcome of a command along with a hash of its
+// serialized result.
+func (j *Journal) Complete(id, resultStatus string, result []byte) error {
+	return j.transition(id, StateCompleted, resultStatus, result)
+}
+
+// MarkInterrupted records that a command will never complete because the
+// agent stopped while it was in flight.
+func (j *Journal) MarkInterrupted(id string, result []byte) error {
+	return j.transition(id, StateInterrupted, string(StateInterrupted), result)
+}
+
+func (j *Journal) transition(id string, state State, resultStatus string, result []byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	rec := Record{ID: id, ReceivedAt: j.now().UTC()}
+	if existing, ok := j.records[id]; ok {
+		rec = *existing
+	}
+	rec.State = state
+	rec.UpdatedAt = j.now().UTC()
+	if result != nil {
+		sum := sha256.Sum256(result)
+		rec.ResultStatus = resultStatus
+		rec.ResultHash = hex.EncodeToString(sum[:])
+	}
+	return j.appendLocked(rec)
+}
+
+// Lookup returns the journaled record for a command.
+func (j *Journal) Lookup(id string) (Record, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	rec, ok := j.records[id]
+	if !ok {
+		return Record{}, false
+	}
+	return *rec, true
+}
+
+// Interrupted returns the commands that were in flight when the agent last
+// stopped, oldest first.
+func (j *Journal) Interrupted() []Record {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Record(nil), j.interrupted...)
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
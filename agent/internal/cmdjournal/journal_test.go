@@ -0,0 +1,129 @@
+package cmdjournal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.jsonl")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := j.Begin("cmd-1", "install_patches"); !ok || err != nil {
+		t.Fatalf("Begin(cmd-1) = %v, %v", ok, err)
+	}
+	if ok, _ := j.Begin("cmd-1", "install_patches"); ok {
+		t.Fatal("duplicate command was claimed twice")
+	}
+	j.Running("cmd-1")
+	j.Complete("cmd-1", "completed", []byte(`{"status":"completed"}`))
+
+	j.Begin("cmd-2", "reboot")
+	j.Running("cmd-2")
+	j.Begin("cmd-3", "software_uninstall")
+	j.Close()
+
+	// Simulate a crash in the middle of writing the next record.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString(`{"id":"cmd-4","sta`)
+	f.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	if ok, _ := j.Begin("cmd-1", "install_patches"); ok {
+		t.Fatal("completed command was claimed again after restart")
+	}
+	rec, ok := j.Lookup("cmd-1")
+	if !ok || rec.State != StateCompleted || rec.ResultStatus != "completed" || len(rec.ResultHash) != 64 {
+		t.Fatalf("cmd-1 record = %+v", rec)
+	}
+
+	interrupted := j.Interrupted()
+	if len(interrupted) != 2 || interrupted[0].ID != "cmd-2" || interrupted[0].State != StateRunning || interrupted[1].ID != "cmd-3" {
+		t.Fatalf("Interrupted() = %+v", interrupted)
+	}
+	j.MarkInterrupted("cmd-2", []byte(`{"status":"interrupted"}`))
+	if rec, _ := j.Lookup("cmd-2"); rec.State != StateInterrupted || rec.Type != "reboot" {
+		t.Fatalf("cmd-2 record = %+v", rec)
+	}
+	if _, ok := j.Lookup("cmd-4"); ok {
+		t.Fatal("torn record was loaded")
+	}
+}
+
+func TestJournalCompactionDropsExpiredCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.jsonl")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-Retention - time.Hour)
+	j.now = func() time.Time { return old }
+	j.Begin("old", "script")
+	j.Complete("old", "completed", []byte("{}"))
+	j.Begin("stuck", "script")
+	j.now = time.Now
+	j.Begin("new", "script")
+	j.Complete("new", "completed", []byte("{}"))
+
+	if err := j.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := j.Lookup("old"); ok {
+		t.Fatal("expired command kept after compaction")
+	}
+	if _, ok := j.Lookup("stuck"); !ok {
+		t.Fatal("unfinished command dropped by compaction")
+	}
+	j.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if _, ok := j.Lookup("new"); !ok || j.lines != 2 {
+		t.Fatalf("reopened journal has %d lines", j.lines)
+	}
+}
+
+func TestJournalReleaseAllowsRedelivery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.jsonl")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j.Begin("cmd-1", "script")
+	if err := j.Release("cmd-1"); err != nil {
+		t.Fatal(err)
+	}
+	j.Begin("cmd-2", "script")
+	j.Running("cmd-2")
+	j.Release("cmd-2")
+	j.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if len(j.Interrupted()) != 1 {
+		t.Fatalf("Interrupted() = %+v, want only cmd-2", j.Interrupted())
+	}
+	if ok, _ := j.Begin("cmd-1", "script"); !ok {
+		t.Fatal("released command could not be claimed again after restart")
+	}
+	if ok, _ := j.Begin("cmd-2", "script"); ok {
+		t.Fatal("running command was released")
+	}
+}
@@ -0,0 +1,282 @@
+// Package cmdpolicy implements the local command policy: a file on the
+// endpoint, outside the server's control, that allows, denies or requires
+// user consent for command types, optionally only within time windows.
+package cmdpolicy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Actions a rule can take.
+const (
+	ActionAllow   = "allow"
+	ActionDeny    = "deny"
+	ActionConsent = "consent"
+)
+
+// DefaultConsentTimeout is how long the logged-in user has to answer a
+// consent prompt before the command is denied.
+const DefaultConsentTimeout = 60 * time.Second
+
+// Window is a recurring local-time window. Start after End spans midnight
+// (e.g. 22:00-06:00). An empty Days list means every day.
+type Window struct {
+	Days  []string `yaml:"days,omitempty"`
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+
+	days       map[time.Weekday]bool
+	start, end int // minutes after midnight
+}
+
+// Rule applies an action to the command types it matches. Commands entries
+// are exact types or path.Match patterns such as "file_*". When Windows are
+// set, the rule's action only applies inside them; outside, matching
+// commands are denied.
+type Rule struct {
+	Commands              []string `yaml:"commands"`
+	Action                string   `yaml:"action"`
+	Windows               []Window `yaml:"windows,omitempty"`
+	ConsentTimeoutSeconds int      `yaml:"consent_timeout_seconds,omitempty"`
+	Reason                string   `yaml:"reason,omitempty"`
+}
+
+// Policy is the parsed policy file. Rules are evaluated in order and the
+// first match wins; unmatched commands get Default (allow if empty).
+type Policy struct {
+	Default string `yaml:"default,omitempty"`
+	Rules   []Rule `yaml:"rules"`
+
+	// Source is the file the policy was loaded from.
+	Source string `yaml:"-"`
+}
+
+// Decision is the outcome of evaluating a command against the policy.
+type Decision struct {
+	Action         string
+	Reason         string
+	Rule           int // index of the matching rule, -1 for the default
+	ConsentTimeout time.Duration
+}
+
+// Allowed reports whether the command may run without further checks.
+func (d Decision) Allowed() bool { return d.Action == ActionAllow }
+
+// Load reads the policy at path. A missing file returns nil and no error:
+// without a policy every command is allowed.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read command policy: %w", err)
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command policy %s: %w", path, err)
+	}
+	p.Source = path
+	return p, nil
+}
+
+// Parse parses and validates a policy document.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if p.Default == "" {
+		p.Default = ActionAllow
+	}
+	if !validAction(p.Default) {
+		return nil, fmt.Errorf("default action %q is not allow, deny or consent", p.Default)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if len(rule.Commands) == 0 {
+			return nil, fmt.Errorf("rule %d lists no commands", i)
+		}
+		for _, pattern := range rule.Commands {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid command pattern %q", i, pattern)
+			}
+		}
+		if !validAction(rule.Action) {
+			return nil, fmt.Errorf("rule %d: action %q is not allow, deny or consent", i, rule.Action)
+		}
+		if rule.ConsentTimeoutSeconds < 0 {
+			return nil, fmt.Errorf("rule %d: consent_timeout_seconds must not be negative", i)
+		}
+		for j := range rule.Windows {
+			if err := rule.Windows[j].parse(); err != nil {
+				return nil, fmt.Errorf("rule %d window %d: %w", i, j, err)
+			}
+		}
+	}
+	return &p, nil
+}
+
+func validAction(action string) bool {
+	return action == ActionAllow || action == ActionDeny || action == ActionConsent
+}
+
+func (w *Window) parse() error {
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return err
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return err
+	}
+	if len(w.Days) == 0 {
+		return nil
+	}
+	w.days = make(map[time.Weekday]bool, len(w.Days))
+	for _, name := range w.Days {
+		day, ok := parseWeekday(name)
+		if !ok {
+			return fmt.Errorf("invalid day %q", name)
+		}
+		w.days[day] = true
+	}
+	return nil
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseWeekday accepts full or three-letter weekday names in any case.
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// Contains reports whether t (in local time) falls inside the window. For
+// windows spanning midnight, the day is the one on which the window started.
+func (w Window) Contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case w.start <= w.end:
+		if minutes < w.start || minutes >= w.end {
+			return false
+		}
+	case minutes >= w.start:
+	case minutes < w.end:
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+	return w.days == nil || w.days[day]
+}
+
+func (w Window) String() string {
+	days := "daily"
+	if len(w.Days) > 0 {
+		days = strings.Join(w.Days, ",")
+	}
+	return fmt.Sprintf("%s %s-%s", days, w.Start, w.End)
+}
+
+// Matches reports whether the rule applies to cmdType.
+func (r Rule) Matches(cmdType string) bool {
+	for _, pattern := range r.Commands {
+		if ok, _ := path.Match(pattern, cmdType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate decides whether cmdType may run at now. A nil policy allows
+// everything.
+func (p *Policy) Evaluate(cmdType string, now time.Time) Decision {
+	if p == nil {
+		return Decision{Action: ActionAllow, Rule: -1}
+	}
+	for i, rule := range p.Rules {
+		if !rule.Matches(cmdType) {
+			continue
+		}
+		decision := Decision{Action: rule.Action, Rule: i, Reason: rule.Reason}
+		if len(rule.Windows) > 0 && !rule.inWindow(now) {
+			decision.Action = ActionDeny
+			decision.Reason = fmt.Sprintf("%s is only permitted during %s", cmdType, rule.windowList())
+		}
+		if decision.Action == ActionConsent {
+			decision.ConsentTimeout = DefaultConsentTimeout
+			if rule.ConsentTimeoutSeconds > 0 {
+				decision.ConsentTimeout = time.Duration(rule.ConsentTimeoutSeconds) * time.Second
+			}
+		}
+		if decision.Action == ActionDeny && decision.Reason == "" {
+			decision.Reason = fmt.Sprintf("%s is denied by local command policy", cmdType)
+		}
+		return decision
+	}
+
+	decision := Decision{Action: p.Default, Rule: -1}
+	switch p.Default {
+	case ActionDeny:
+		decision.Reason = fmt.Sprintf("%s is not allowed by local command policy", cmdType)
+	case ActionConsent:
+		decision.ConsentTimeout = DefaultConsentTimeout
+	}
+	return decision
+}
+
+func (r Rule) inWindow(now time.Time) bool {
+	for _, w := range r.Windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) windowList() string {
+	parts := make([]string, len(r.Windows))
+	for i, w := range r.Windows {
+		parts[i] = w.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Describe returns a human-readable summary of the effective policy, one
+// line per rule, for the status command.
+func (p *Policy) Describe() []string {
+	if p == nil {
+		return []string{"no local command policy (all commands allowed)"}
+	}
+	lines := make([]string, 0, len(p.Rules)+1)
+	for i, rule := range p.Rules {
+		line := fmt.Sprintf("%d. %s: %s", i+1, rule.Action, strings.Join(rule.Commands, ", "))
+		if len(rule.Windows) > 0 {
+			line += " (during " + rule.windowList() + ")"
+		}
+		if rule.Action == ActionConsent && rule.ConsentTimeoutSeconds > 0 {
+			line += fmt.Sprintf(" [consent timeout %ds]", rule.ConsentTimeoutSeconds)
+		}
+		lines = append(lines, line)
+	}
+	return append(lines, "default: "+p.Default)
+}
@@ -0,0 +1,110 @@
+package cmdpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const clinicPolicy = `
+default: allow
+rules:
+  - commands: [start_desktop, desktop_stream_start]
+    action: consent
+    consent_timeout_seconds: 30
+  - commands: [terminal_start, "registry_*"]
+    action: deny
+    reason: disabled on clinical workstations
+  - commands: [install_patches]
+    action: allow
+    windows:
+      - days: [sat, Sunday]
+        start: "22:00"
+        end: "04:00"
+  - commands: ["file_*"]
+    action: deny
+`
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(clinicPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saturdayNight := time.Date(2026, 10, 17, 23, 0, 0, 0, time.Local)
+	sundayMorning := time.Date(2026, 10, 18, 3, 30, 0, 0, time.Local)
+	mondayMorning := time.Date(2026, 10, 19, 3, 30, 0, 0, time.Local)
+
+	cases := []struct {
+		cmd    string
+		at     time.Time
+		action string
+		reason string
+	}{
+		{"start_desktop", saturdayNight, ActionConsent, ""},
+		{"terminal_start", saturdayNight, ActionDeny, "disabled on clinical workstations"},
+		{"registry_set", saturdayNight, ActionDeny, "disabled on clinical workstations"},
+		{"file_read", saturdayNight, ActionDeny, "denied by local command policy"},
+		{"install_patches", saturdayNight, ActionAllow, ""},
+		{"install_patches", sundayMorning, ActionAllow, ""},
+		// Sunday's window runs into Monday morning.
+		{"install_patches", mondayMorning, ActionAllow, ""},
+		{"install_patches", time.Date(2026, 10, 20, 3, 30, 0, 0, time.Local), ActionDeny, "only permitted during sat,Sunday 22:00-04:00"},
+		{"install_patches", time.Date(2026, 10, 17, 12, 0, 0, 0, time.Local), ActionDeny, "only permitted"},
+		{"collect_software", saturdayNight, ActionAllow, ""},
+	}
+	for _, tc := range cases {
+		d := p.Evaluate(tc.cmd, tc.at)
+		if d.Action != tc.action || !strings.Contains(d.Reason, tc.reason) {
+			t.Errorf("%s at %s: got %s %q, want %s %q", tc.cmd, tc.at.Format("Mon 15:04"), d.Action, d.Reason, tc.action, tc.reason)
+		}
+	}
+	if d := p.Evaluate("start_desktop", saturdayNight); d.ConsentTimeout != 30*time.Second {
+		t.Errorf("consent timeout = %s", d.ConsentTimeout)
+	}
+
+	var none *Policy
+	if d := none.Evaluate("terminal_start", saturdayNight); !d.Allowed() {
+		t.Errorf("nil policy should allow everything, got %+v", d)
+	}
+}
+
+func TestParseRejectsInvalidPolicies(t *testing.T) {
+	for _, doc := range []string{
+		"default: maybe",
+		"rules: [{commands: [script], action: block}]",
+		"rules: [{action: deny}]",
+		"rules: [{commands: ['[a-'], action: deny}]",
+		"rules: [{commands: [script], action: allow, windows: [{start: '25:00', end: '01:00'}]}]",
+		"rules: [{commands: [script], action: allow, windows: [{days: [someday], start: '01:00', end: '02:00'}]}]",
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("expected %q to be rejected", doc)
+		}
+	}
+}
+
+func TestLoadAndDescribe(t *testing.T) {
+	dir := t.TempDir()
+	if p, err := Load(filepath.Join(dir, "missing.yaml")); p != nil || err != nil {
+		t.Fatalf("missing policy: %v, %v", p, err)
+	}
+
+	path := filepath.Join(dir, "command_policy.yaml")
+	os.WriteFile(path, []byte(clinicPolicy), 0600)
+	p, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(p.Describe(), "\n")
+	for _, want := range []string{
+		"1. consent: start_desktop, desktop_stream_start [consent timeout 30s]",
+		"3. allow: install_patches (during sat,Sunday 22:00-04:00)",
+		"default: allow",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Describe() missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+// Package cmdsched runs server-defined commands on the agent's own schedule,
+// so recurring maintenance and one-shot deferred work happen even while the
+// agent is offline. Jobs persist across restarts; runs missed while the agent
+// was stopped are either caught up once at startup or skipped.
+package cmdsched
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/logging"
+	"github.com/breeze-rmm/agent/internal/schedule"
+)
+
+var log = logging.L("cmdsched")
+
+const (
+	// MaxJobs bounds the number of scheduled jobs an agent keeps.
+	MaxJobs = 200
+
+	// MaxJitter bounds the random delay added to each run.
+	MaxJitter = 6 * time.Hour
+
+	runIDPrefix = "sched:"
+)
+
+// Job is a command the agent runs on a schedule. Exactly one of Schedule
+// (a cron expression, calendar phrase or interval) and RunAt (a one-shot
+// time) is set.
+type Job struct {
+	ID             string         `json:"id"`
+	CommandType    string         `json:"commandType"`
+	CommandPayload map[string]any `json:"commandPayload,omitempty"`
+	Schedule       string         `json:"schedule,omitempty"`
+	RunAt          time.Time      `json:"runAt"`
+	// RunIfMissed runs the job once at startup if a run came due while the
+	// agent was stopped; otherwise missed runs are skipped.
+	RunIfMissed   bool      `json:"runIfMissed,omitempty"`
+	JitterSeconds int       `json:"jitterSeconds,omitempty"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+
+	// Due is the nominal time of the next run and NextRun the same time
+	// with jitter applied. Both are persisted so a restart neither re-rolls
+	// the jitter nor loses track of a missed run.
+	Due        time.Time `json:"due"`
+	NextRun    time.Time `json:"nextRun"`
+	LastRun    time.Time `json:"lastRun"`
+	LastStatus string    `json:"lastStatus,omitempty"`
+	RunCount   int       `json:"runCount"`
+
+	sched schedule.Schedule
+}
+
+// Run identifies one execution of a job.
+type Run struct {
+	// ID is unique per job and nominal run time, so it doubles as the
+	// command ID for journaling and deduplication.
+	ID          string
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	// Missed is set for a catch-up run of an occurrence that came due while
+	// the agent was stopped.
+	Missed bool
+}
+
+// RunID returns the ID of the run of jobID scheduled at due.
+func RunID(jobID string, due time.Time) string {
+	return runIDPrefix + jobID + ":" + strconv.FormatInt(due.Unix(), 10)
+}
+
+// ParseRunID returns the job ID and nominal run time encoded in a run ID
+// created by RunID.
+func ParseRunID(id string) (string, time.Time, bool) {
+	rest, ok := strings.CutPrefix(id, runIDPrefix)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	i := strings.LastIndexByte(rest, ':')
+	if i <= 0 {
+		return "", time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(rest[i+1:], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return rest[:i], time.Unix(unix, 0), true
+}
+
+// RunFunc executes a job run and returns its result status.
+type RunFunc func(job Job, run Run) string
+
+// Validate checks a job definition and resolves its schedule.
+func (j *Job) Validate() error {
+	if j.ID == "" {
+		return errors.New("job id is required")
+	}
+	if strings.ContainsAny(j.ID, ":/\\") {
+		return fmt.Errorf("job id %q must not contain ':', '/' or '\\'", j.ID)
+	}
+	if j.CommandType == "" {
+		return errors.New("command type is required")
+	}
+	switch {
+	case j.Schedule != "" && !j.RunAt.IsZero():
+		return errors.New("set either a schedule or runAt, not both")
+	case j.Schedule != "":
+		sched, err := schedule.Parse(j.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid schedule %q: %w", j.Schedule, err)
+		}
+		j.sched = sched
+	case j.RunAt.IsZero():
+		return errors.New("a schedule or runAt is required")
+	}
+	if j.JitterSeconds < 0 || time.Duration(j.JitterSeconds)*time.Second > MaxJitter {
+		return fmt.Errorf("jitterSeconds must be between 0 and %d", int(MaxJitter/time.Second))
+	}
+	return nil
+}
+
+// OneShot reports whether the job runs only once.
+func (j *Job) OneShot() bool { return j.Schedule == "" }
+
+func (j *Job) expired(at time.Time) bool {
+	return !j.ExpiresAt.IsZero() && at.After(j.ExpiresAt)
+}
+
+// advance sets Due and NextRun to the first occurrence after t. It returns
+// false if the job has no further runs.
+func (j *Job) advance(t time.Time) bool {
+	var due time.Time
+	if j.OneShot() {
+		if j.RunCount == 0 && j.Due.IsZero() {
+			due = j.RunAt
+		}
+	} else {
+		due = j.sched.Next(t)
+	}
+	if due.IsZero() || j.expired(due) {
+		j.Due, j.NextRun = time.Time{}, time.Time{}
+		return false
+	}
+	j.Due = due
+	j.NextRun = due
+	if j.JitterSeconds > 0 {
+		j.NextRun = due.Add(rand.N(time.Duration(j.JitterSeconds) * time.Second))
+	}
+	return true
+}
+
+// Scheduler owns the persisted job list and fires runs when they come due.
+type Scheduler struct {
+	path string
+	run  RunFunc
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running map[string]bool
+	wake    chan struct{}
+	now     func() time.Time
+}
+
+// Open loads the jobs stored at path. Jobs that fail to load are dropped.
+func Open(path string, run RunFunc) (*Scheduler, error) {
+	s := &Scheduler{
+		path:    path,
+		run:     run,
+		jobs:    make(map[string]*Job),
+		running: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+		now:     time.Now,
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read scheduled jobs: %w", err)
+	}
+	if len(data) == 0 {
+		return s, nil
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduled jobs: %w", err)
+	}
+	for _, job := range jobs {
+		if err := job.Validate(); err != nil {
+			log.Warn("dropping invalid scheduled job", "jobId", job.ID, "error", err.Error())
+			continue
+		}
+		s.jobs[job.ID] = job
+	}
+	return s, nil
+}
+
+// Add schedules a job, replacing any job with the same ID.
+func (s *Scheduler) Add(job Job) (Job, error) {
+	if err := job.Validate(); err != nil {
+		return Job{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.jobs[job.ID]
+	if !exists && len(s.jobs) >= MaxJobs {
+		return Job{}, fmt.Errorf("agent already has the maximum of %d scheduled jobs", MaxJobs)
+	}
+	now := s.now()
+	job.CreatedAt = now.UTC()
+	job.Due, job.NextRun, job.LastRun = time.Time{}, time.Time{}, time.Time{}
+	job.LastStatus, job.RunCount = "", 0
+	if job.OneShot() && job.RunAt.Before(now) {
+		// A one-shot time in the past runs as soon as possible.
+		job.RunAt = now
+	}
+	if !job.advance(now) {
+		return Job{}, errors.New("job has no runs before it expires")
+	}
+	s.jobs[job.ID] = &job
+	if err := s.saveLocked(); err != nil {
+		if exists {
+			s.jobs[job.ID] = previous
+		} else {
+			delete(s.jobs, job.ID)
+		}
+		return Job{}, err
+	}
+	s.signal()
+	return job, nil
+}
+
+// Remove cancels a job. It returns false if no job has the ID. A run already
+// in progress is not interrupted.
+func (s *Scheduler) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return false, nil
+	}
+	delete(s.jobs, id)
+	if err := s.saveLocked(); err != nil {
+		s.jobs[id] = job
+		return false, err
+	}
+	s.signal()
+	return true, nil
+}
+
+// List returns the scheduled jobs ordered by next run.
+func (s *Scheduler) List() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].NextRun.Before(jobs[b].NextRun) })
+	return jobs
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run fires due jobs until stop is closed. Runs that came due while the
+// agent was stopped are handled first: caught up once if the job allows it,
+// otherwise skipped.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	s.catchUp()
+	for {
+		wait := s.fireDue()
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			fire = timer.C
+		}
+		select {
+		case <-stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-s.wake:
+		case <-fire:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// catchUp resolves runs that came due before the scheduler started.
+func (s *Scheduler) catchUp() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	changed := false
+	for id, job := range s.jobs {
+		if job.NextRun.IsZero() || job.NextRun.After(now) {
+			continue
+		}
+		changed = true
+		missed := job.Due
+		if job.expired(missed) {
+			log.Info("scheduled job expired", "jobId", id)
+			delete(s.jobs, id)
+			continue
+		}
+		if job.RunIfMissed {
+			log.Info("running scheduled job missed while agent was stopped", "jobId", id, "due", missed)
+			s.startLocked(job, Run{ID: RunID(id, missed), ScheduledAt: missed, StartedAt: now, Missed: true})
+			continue
+		}
+		log.Info("skipping scheduled run missed while agent was stopped", "jobId", id, "due", missed)
+		if !job.advance(now) {
+			delete(s.jobs, id)
+		}
+	}
+	if changed {
+		if err := s.saveLocked(); err != nil {
+			log.Warn("failed to save scheduled jobs", "error", err.Error())
+		}
+	}
+}
+
+// fireDue starts every due job and returns the delay until the next one, or
+// -1 if nothing is scheduled.
+func (s *Scheduler) fireDue() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	changed := false
+	var next time.Time
+	for id, job := range s.jobs {
+		if job.NextRun.IsZero() {
+			continue
+		}
+		if job.NextRun.After(now) {
+			if next.IsZero() || job.NextRun.Before(next) {
+				next = job.NextRun
+			}
+			continue
+		}
+		changed = true
+		if job.expired(job.Due) {
+			log.Info("scheduled job expired", "jobId", id)
+			delete(s.jobs, id)
+			continue
+		}
+		s.startLocked(job, Run{ID: RunID(id, job.Due), ScheduledAt: job.Due, StartedAt: now})
+		if !job.NextRun.IsZero() && (next.IsZero() || job.NextRun.Before(next)) {
+			next = job.NextRun
+		}
+	}
+	if changed {
+		if err := s.saveLocked(); err != nil {
+			log.Warn("failed to save scheduled jobs", "error", err.Error())
+		}
+	}
+	if next.IsZero() {
+		return -1
+	}
+	return max(next.Sub(now), 0)
+}
+
+// startLocked launches a run and advances the job to its next occurrence.
+// One-shot jobs are removed once started. A job still running from its
+// previous occurrence skips this one rather than overlapping.
+func (s *Scheduler) startLocked(job *Job, run Run) {
+	if s.running[job.ID] {
+		log.Warn("scheduled job still running, skipping occurrence", "jobId", job.ID, "due", run.ScheduledAt)
+	} else {
+		job.RunCount++
+		job.LastRun = run.StartedAt.UTC()
+		s.running[job.ID] = true
+		go s.execute(*job, run)
+	}
+	if !job.advance(run.StartedAt) {
+		delete(s.jobs, job.ID)
+	}
+}
+
+func (s *Scheduler) execute(job Job, run Run) {
+	status := s.run(job, run)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, job.ID)
+	if current, ok := s.jobs[job.ID]; ok && current.CreatedAt.Equal(job.CreatedAt) {
+		current.LastStatus = status
+		if err := s.saveLocked(); err != nil {
+			log.Warn("failed to save scheduled jobs", "error", err.Error())
+		}
+	}
+}
+
+func (s *Scheduler) saveLocked() error {
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal scheduled jobs: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create scheduled jobs dir: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write scheduled jobs: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write scheduled jobs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package cmdsched
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type recorder chan Run
+
+func (r recorder) run(_ Job, run Run) string {
+	r <- run
+	return "completed"
+}
+
+func (r recorder) next(t *testing.T) Run {
+	t.Helper()
+	select {
+	case run := <-r:
+		return run
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for scheduled run")
+		return Run{}
+	}
+}
+
+func (r recorder) none(t *testing.T) {
+	t.Helper()
+	select {
+	case run := <-r:
+		t.Fatalf("unexpected run %s", run.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func openAt(t *testing.T, path string, now time.Time, rec recorder) *Scheduler {
+	t.Helper()
+	s, err := Open(path, rec.run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestRecurringJobFiresAndAdvances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	rec := make(recorder, 4)
+	start := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local) // Monday
+	s := openAt(t, path, start, rec)
+
+	job, err := s.Add(Job{ID: "cleanup", CommandType: "script", Schedule: "0 22 * * 1-5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 3, 2, 22, 0, 0, 0, time.Local)
+	if !job.NextRun.Equal(want) {
+		t.Fatalf("next run %v, want %v", job.NextRun, want)
+	}
+	if wait := s.fireDue(); wait != 14*time.Hour {
+		t.Fatalf("wait %v, want 14h", wait)
+	}
+	rec.none(t)
+
+	s.now = func() time.Time { return want.Add(time.Second) }
+	s.fireDue()
+	run := rec.next(t)
+	if run.ID != RunID("cleanup", want) || run.Missed {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	if id, due, ok := ParseRunID(run.ID); !ok || id != "cleanup" || !due.Equal(want) {
+		t.Fatalf("ParseRunID(%q) = %q, %v, %v", run.ID, id, due, ok)
+	}
+	jobs := s.List()
+	if len(jobs) != 1 || jobs[0].RunCount != 1 || !jobs[0].NextRun.Equal(want.AddDate(0, 0, 1)) {
+		t.Fatalf("unexpected job state %+v", jobs)
+	}
+}
+
+func TestMissedRunsAtStartup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	rec := make(recorder, 4)
+	start := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	s := openAt(t, path, start, rec)
+
+	if _, err := s.Add(Job{ID: "catch-up", CommandType: "cis_benchmark", Schedule: "daily at 09:00", RunIfMissed: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Job{ID: "skip", CommandType: "cis_benchmark", Schedule: "daily at 09:00"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(Job{ID: "once", CommandType: "patch_scan", RunAt: start.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent was stopped across the 09:00 slot and restarts at 12:00.
+	restart := start.Add(4 * time.Hour)
+	s = openAt(t, path, restart, rec)
+	s.catchUp()
+
+	run := rec.next(t)
+	if run.ID != RunID("catch-up", start.Add(time.Hour)) || !run.Missed {
+		t.Fatalf("unexpected catch-up run %+v", run)
+	}
+	rec.none(t)
+
+	jobs := s.List()
+	if len(jobs) != 2 {
+		t.Fatalf("expected the missed one-shot job to be dropped, got %+v", jobs)
+	}
+	tomorrow := time.Date(2026, 3, 3, 9, 0, 0, 0, time.Local)
+	for _, job := range jobs {
+		if !job.NextRun.Equal(tomorrow) {
+			t.Errorf("job %s next run %v, want %v", job.ID, job.NextRun, tomorrow)
+		}
+	}
+}
+
+func TestJobExpiryAndValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	rec := make(recorder, 4)
+	start := time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local)
+	s := openAt(t, path, start, rec)
+
+	if _, err := s.Add(Job{ID: "late", CommandType: "script", Schedule: "@monthly", ExpiresAt: start.Add(24 * time.Hour)}); err == nil {
+		t.Fatal("expected a job with no runs before expiry to be rejected")
+	}
+	for _, job := range []Job{
+		{CommandType: "script", Schedule: "@daily"},
+		{ID: "a:b", CommandType: "script", Schedule: "@daily"},
+		{ID: "x", Schedule: "@daily"},
+		{ID: "x", CommandType: "script"},
+		{ID: "x", CommandType: "script", Schedule: "@daily", RunAt: start},
+		{ID: "x", CommandType: "script", Schedule: "sometimes"},
+		{ID: "x", CommandType: "script", Schedule: "@daily", JitterSeconds: -1},
+	} {
+		if _, err := s.Add(job); err == nil {
+			t.Errorf("expected %+v to be rejected", job)
+		}
+	}
+
+	if _, err := s.Add(Job{ID: "hourly", CommandType: "script", Schedule: "@hourly", JitterSeconds: 600, ExpiresAt: start.Add(90 * time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	job := s.List()[0]
+	if job.NextRun.Before(job.Due) || job.NextRun.Sub(job.Due) >= 10*time.Minute {
+		t.Fatalf("jitter out of range: due %v, next %v", job.Due, job.NextRun)
+	}
+
+	s.now = func() time.Time { return job.NextRun }
+	s.fireDue()
+	rec.next(t)
+	if jobs := s.List(); len(jobs) != 0 {
+		t.Fatalf("expected job to be dropped after its last run before expiry, got %+v", jobs)
+	}
+	if removed, _ := s.Remove("hourly"); removed {
+		t.Fatal("expected removed job to be gone")
+	}
+}
+
+func TestRemoveKeepsJobWhenSaveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	rec := make(recorder, 4)
+	s := openAt(t, path, time.Date(2026, 3, 2, 8, 0, 0, 0, time.Local), rec)
+
+	if _, err := s.Add(Job{ID: "cleanup", CommandType: "script", Schedule: "@daily"}); err != nil {
+		t.Fatal(err)
+	}
+	// A directory in place of the temp file makes the save fail.
+	if err := os.Mkdir(path+".tmp", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := s.Remove("cleanup"); err == nil || removed {
+		t.Fatalf("Remove = %v, %v; want a save error", removed, err)
+	}
+	if jobs := s.List(); len(jobs) != 1 || jobs[0].ID != "cleanup" {
+		t.Fatalf("expected job to survive a failed remove, got %+v", jobs)
+	}
+}
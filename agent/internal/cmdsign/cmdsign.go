@@ -0,0 +1,250 @@
+// Package cmdsign verifies detached Ed25519 signatures on server commands
+// against an organization signing key pinned at enrollment, so a
+// compromised server cannot issue high-risk commands on its own.
+package cmdsign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// messageVersion prefixes the signed message so the format can evolve.
+	messageVersion = "breeze-command-v1"
+
+	// ClockSkew is the tolerance applied to IssuedAt and ExpiresAt.
+	ClockSkew = 5 * time.Minute
+
+	// MaxValidity bounds how long a signature may be valid, which in turn
+	// bounds how long nonces must be remembered.
+	MaxValidity = 24 * time.Hour
+)
+
+var (
+	ErrNoKey            = errors.New("no command signing key pinned")
+	ErrUnsigned         = errors.New("command is not signed")
+	ErrBadSignature     = errors.New("command signature is invalid")
+	ErrExpired          = errors.New("command signature has expired")
+	ErrNotYetValid      = errors.New("command signature is not yet valid")
+	ErrValidityTooLong  = errors.New("command signature validity exceeds 24h")
+	ErrReplayed         = errors.New("command nonce has already been used")
+	ErrMissingNonce     = errors.New("command signature has no nonce")
+	ErrKeyMismatch      = errors.New("command signed with an unknown key")
+	ErrMalformedPayload = errors.New("command payload cannot be canonicalized")
+)
+
+// Signature is the detached signature the server attaches to a command.
+type Signature struct {
+	KeyID     string    `json:"keyId,omitempty"`
+	Nonce     string    `json:"nonce"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Value is the base64-encoded Ed25519 signature over Message.
+	Value string `json:"value"`
+}
+
+// Message returns the bytes covered by a command signature:
+//
+//	breeze-command-v1\n<agentId>\n<commandId>\n<type>\n<nonce>\n
+//	<issuedAt RFC3339>\n<expiresAt RFC3339>\n<hex sha256 of payload>
+//
+// The payload is hashed in canonical JSON form: object keys sorted, no
+// insignificant whitespace, HTML characters not escaped.
+func Message(agentID, commandID, cmdType string, payload map[string]any, sig *Signature) ([]byte, error) {
+	canonical, err := CanonicalJSON(payload)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(canonical)
+	msg := strings.Join([]string{
+		messageVersion,
+		agentID,
+		commandID,
+		cmdType,
+		sig.Nonce,
+		sig.IssuedAt.UTC().Format(time.RFC3339),
+		sig.ExpiresAt.UTC().Format(time.RFC3339),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	return []byte(msg), nil
+}
+
+// CanonicalJSON encodes a payload with sorted object keys. A nil payload
+// encodes as {}.
+func CanonicalJSON(payload map[string]any) ([]byte, error) {
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedPayload, err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// ParsePublicKey accepts an Ed25519 public key as a PEM "PUBLIC KEY" block
+// or as the base64 encoding of the raw 32-byte key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, errors.New("signing key is not an Ed25519 key")
+		}
+		return edKey, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signing key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("signing key has %d bytes, want %d", len(raw), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// KeyID returns the identifier of a public key: the first 16 hex digits of
+// its SHA-256.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Verifier checks command signatures and remembers nonces until their
+// signatures expire so a signed command cannot be replayed.
+type Verifier struct {
+	key       ed25519.PublicKey
+	agentID   string
+	noncePath string
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	now    func() time.Time
+}
+
+// NewVerifier returns a Verifier for commands addressed to agentID. Used
+// nonces are persisted to noncePath so replay protection survives restarts;
+// an empty path keeps them in memory only. A nil key rejects every command.
+func NewVerifier(key ed25519.PublicKey, agentID, noncePath string) (*Verifier, error) {
+	v := &Verifier{
+		key:       key,
+		agentID:   agentID,
+		noncePath: noncePath,
+		nonces:    make(map[string]time.Time),
+		now:       time.Now,
+	}
+	if noncePath == "" {
+		return v, nil
+	}
+	data, err := os.ReadFile(noncePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read nonce store: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &v.nonces); err != nil {
+			// A corrupt store would otherwise block every signed command.
+			// Signatures are short-lived, so the replay window is bounded.
+			v.nonces = make(map[string]time.Time)
+		}
+	}
+	return v, nil
+}
+
+// Verify checks that sig is a valid, current, unused signature for the
+// command. On success the nonce is recorded as used.
+func (v *Verifier) Verify(commandID, cmdType string, payload map[string]any, sig *Signature) error {
+	if v.key == nil {
+		return ErrNoKey
+	}
+	if sig == nil || sig.Value == "" {
+		return ErrUnsigned
+	}
+	if sig.Nonce == "" {
+		return ErrMissingNonce
+	}
+	if sig.KeyID != "" && sig.KeyID != KeyID(v.key) {
+		return ErrKeyMismatch
+	}
+
+	now := v.now()
+	if sig.ExpiresAt.Sub(sig.IssuedAt) > MaxValidity {
+		return ErrValidityTooLong
+	}
+	if now.After(sig.ExpiresAt.Add(ClockSkew)) {
+		return ErrExpired
+	}
+	if sig.IssuedAt.After(now.Add(ClockSkew)) {
+		return ErrNotYetValid
+	}
+
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return ErrBadSignature
+	}
+	msg, err := Message(v.agentID, commandID, cmdType, payload, sig)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(v.key, msg, value) {
+		return ErrBadSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, used := v.nonces[sig.Nonce]; used {
+		return ErrReplayed
+	}
+	for nonce, expires := range v.nonces {
+		if now.After(expires.Add(ClockSkew)) {
+			delete(v.nonces, nonce)
+		}
+	}
+	v.nonces[sig.Nonce] = sig.ExpiresAt
+	if err := v.saveLocked(); err != nil {
+		// The command is rejected, so its nonce must stay usable for a retry.
+		delete(v.nonces, sig.Nonce)
+		return err
+	}
+	return nil
+}
+
+func (v *Verifier) saveLocked() error {
+	if v.noncePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(v.nonces)
+	if err != nil {
+		return fmt.Errorf("failed to marshal nonce store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(v.noncePath), 0700); err != nil {
+		return fmt.Errorf("failed to create nonce store dir: %w", err)
+	}
+	tmp := v.noncePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write nonce store: %w", err)
+	}
+	if err := os.Rename(tmp, v.noncePath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write nonce store: %w", err)
+	}
+	return nil
+}
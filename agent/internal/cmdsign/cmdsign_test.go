@@ -0,0 +1,142 @@
+package cmdsign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sign(t *testing.T, priv ed25519.PrivateKey, commandID, cmdType string, payload map[string]any, sig *Signature) *Signature {
+	t.Helper()
+	msg, err := Message("agent-1", commandID, cmdType, payload, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.Value = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, msg))
+	return sig
+}
+
+func TestVerifierAcceptsSignedCommandOnce(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	noncePath := filepath.Join(t.TempDir(), "nonces.json")
+	v, err := NewVerifier(pub, "agent-1", noncePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := map[string]any{"script": "echo <hi>", "timeout": 30.0, "env": map[string]any{"B": "2", "A": "1"}}
+	now := time.Now()
+	sig := sign(t, priv, "cmd-1", "script", payload, &Signature{
+		KeyID:     KeyID(pub),
+		Nonce:     "n-1",
+		IssuedAt:  now,
+		ExpiresAt: now.Add(10 * time.Minute),
+	})
+	if err := v.Verify("cmd-1", "script", payload, sig); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	// Replay under a fresh verifier: the nonce store survives restarts.
+	v, _ = NewVerifier(pub, "agent-1", noncePath)
+	if err := v.Verify("cmd-1", "script", payload, sig); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("replay: got %v", err)
+	}
+
+	tampered := map[string]any{"script": "rm -rf /", "timeout": 30.0, "env": map[string]any{"A": "1", "B": "2"}}
+	sig2 := *sig
+	sig2.Nonce = "n-2"
+	if err := v.Verify("cmd-1", "script", tampered, &sig2); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("tampered payload: got %v", err)
+	}
+	if err := v.Verify("cmd-2", "script", payload, sig); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("signature moved to another command: got %v", err)
+	}
+}
+
+func TestVerifierKeepsNonceWhenStoreWriteFails(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	dir := t.TempDir()
+	v, err := NewVerifier(pub, "agent-1", filepath.Join(dir, "nonces.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A file where the store directory should be makes every save fail.
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.WriteFile(blocked, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	v.noncePath = filepath.Join(blocked, "nonces.json")
+
+	payload := map[string]any{"script": "echo hi"}
+	now := time.Now()
+	sig := sign(t, priv, "cmd-1", "script", payload, &Signature{
+		Nonce:     "n-1",
+		IssuedAt:  now,
+		ExpiresAt: now.Add(10 * time.Minute),
+	})
+	if err := v.Verify("cmd-1", "script", payload, sig); err == nil {
+		t.Fatal("expected the nonce store write to fail")
+	}
+
+	v.noncePath = filepath.Join(dir, "nonces.json")
+	if err := v.Verify("cmd-1", "script", payload, sig); err != nil {
+		t.Fatalf("retry after a failed save rejected: %v", err)
+	}
+}
+
+func TestVerifierRejections(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	v, _ := NewVerifier(pub, "agent-1", "")
+	now := time.Now()
+
+	expired := sign(t, priv, "c", "script", nil, &Signature{Nonce: "a", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-30 * time.Minute)})
+	future := sign(t, priv, "c", "script", nil, &Signature{Nonce: "b", IssuedAt: now.Add(time.Hour), ExpiresAt: now.Add(2 * time.Hour)})
+	tooLong := sign(t, priv, "c", "script", nil, &Signature{Nonce: "c", IssuedAt: now, ExpiresAt: now.Add(48 * time.Hour)})
+	otherKey := sign(t, priv, "c", "script", nil, &Signature{KeyID: "0000000000000000", Nonce: "d", IssuedAt: now, ExpiresAt: now.Add(time.Minute)})
+
+	cases := []struct {
+		name string
+		sig  *Signature
+		want error
+	}{
+		{"unsigned", nil, ErrUnsigned},
+		{"expired", expired, ErrExpired},
+		{"not yet valid", future, ErrNotYetValid},
+		{"validity too long", tooLong, ErrValidityTooLong},
+		{"unknown key", otherKey, ErrKeyMismatch},
+		{"no nonce", &Signature{Value: "x"}, ErrMissingNonce},
+	}
+	for _, tc := range cases {
+		if err := v.Verify("c", "script", nil, tc.sig); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	noKey, _ := NewVerifier(nil, "agent-1", "")
+	if err := noKey.Verify("c", "script", nil, expired); !errors.Is(err, ErrNoKey) {
+		t.Errorf("no key: got %v", err)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	for _, s := range []string{pemKey, base64.StdEncoding.EncodeToString(pub)} {
+		key, err := ParsePublicKey(s)
+		if err != nil || !key.Equal(pub) {
+			t.Fatalf("ParsePublicKey(%q) = %v, %v", s, key, err)
+		}
+	}
+	if _, err := ParsePublicKey("c2hvcnQ="); err == nil {
+		t.Fatal("expected short key to be rejected")
+	}
+}
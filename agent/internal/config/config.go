@@ -19,6 +19,16 @@ type PolicyConfigStateProbe struct {
 	ConfigKey string `mapstructure:"config_key"`
 }
 
+// BackupHook is a script run before or after each backup, for example to
+// flush and freeze a database or to create and remove a volume snapshot.
+type BackupHook struct {
+	Name           string `mapstructure:"name"`
+	ScriptType     string `mapstructure:"script_type"`
+	Script         string `mapstructure:"script"`
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"`
+	RunAs          string `mapstructure:"run_as"`
+}
+
 type Config struct {
 	AgentID                  string   `mapstructure:"agent_id"`
 	ServerURL                string   `mapstructure:"server_url"`
@@ -39,6 +49,48 @@ type Config struct {
 	BackupS3AccessKey        string   `mapstructure:"backup_s3_access_key"`
 	BackupS3SecretKey        string   `mapstructure:"backup_s3_secret_key"`
 
+	// BackupProviderSettings holds provider-specific settings (for example
+	// host, username and host_key_fingerprint for sftp). The legacy
+	// backup_s3_* and backup_local_path keys fill in missing entries.
+	BackupProviderSettings map[string]string `mapstructure:"backup_provider_settings"`
+
+	// Client-side backup encryption. The master key is generated on first
+	// use and, when an escrow public key (PEM) is set, wrapped to it and
+	// stored alongside the backups for org-side recovery.
+	BackupEncryptionEnabled         bool   `mapstructure:"backup_encryption_enabled"`
+	BackupEncryptionKeyFile         string `mapstructure:"backup_encryption_key_file"`
+	BackupEncryptionEscrowPublicKey string `mapstructure:"backup_encryption_escrow_public_key"`
+	// BackupEncryptionAllowPlaintext lets restores and retention read
+	// unencrypted snapshots written before encryption was turned on. Leave
+	// it off once those snapshots have aged out.
+	BackupEncryptionAllowPlaintext bool `mapstructure:"backup_encryption_allow_plaintext"`
+
+	// BackupVerifySampleSize is the number of files re-read and checked
+	// after each scheduled backup (0 disables sampled verification).
+	BackupVerifySampleSize int `mapstructure:"backup_verify_sample_size"`
+
+	// Backup file selection. Glob patterns apply below each backup path;
+	// BackupMaxFileSizeMB of 0 means no size limit.
+	BackupInclude       []string `mapstructure:"backup_include"`
+	BackupExclude       []string `mapstructure:"backup_exclude"`
+	BackupMaxFileSizeMB int64    `mapstructure:"backup_max_file_size_mb"`
+
+	// Grandfather-father-son retention. When all are zero the legacy
+	// BackupRetention count is used as the number of recent snapshots kept.
+	BackupRetentionDaily   int `mapstructure:"backup_retention_daily"`
+	BackupRetentionWeekly  int `mapstructure:"backup_retention_weekly"`
+	BackupRetentionMonthly int `mapstructure:"backup_retention_monthly"`
+	BackupRetentionYearly  int `mapstructure:"backup_retention_yearly"`
+
+	// Application-consistent backups. A failing pre hook aborts the backup;
+	// post hooks always run afterwards. When BackupSnapshotMountPoint is
+	// set, files under BackupSnapshotSource (default: the filesystem root)
+	// are read from the same relative path below the mount point.
+	BackupPreHooks           []BackupHook `mapstructure:"backup_pre_hooks"`
+	BackupPostHooks          []BackupHook `mapstructure:"backup_post_hooks"`
+	BackupSnapshotMountPoint string       `mapstructure:"backup_snapshot_mount_point"`
+	BackupSnapshotSource     string       `mapstructure:"backup_snapshot_source"`
+
 	// Logging configuration
 	LogLevel         string `mapstructure:"log_level"`
 	LogFormat        string `mapstructure:"log_format"`
@@ -56,6 +108,10 @@ type Config struct {
 	AuditMaxSizeMB  int  `mapstructure:"audit_max_size_mb"`
 	AuditMaxBackups int  `mapstructure:"audit_max_backups"`
 
+	// Outbox: durable queue of command results and telemetry that could not
+	// be delivered, replayed once the server is reachable again.
+	OutboxMaxSizeMB int `mapstructure:"outbox_max_size_mb"`
+
 	// User helper configuration
 	UserHelperEnabled bool   `mapstructure:"user_helper_enabled"`
 	IPCSocketPath     string `mapstructure:"ipc_socket_path"`
@@ -70,6 +126,7 @@ type Config struct {
 	PatchMaintenanceDays       []string `mapstructure:"patch_maintenance_days"`  // ["monday",...] empty=all
 	PatchRebootMaxPerDay       int      `mapstructure:"patch_reboot_max_per_day"`
 	PatchAutoAcceptEula        bool     `mapstructure:"patch_auto_accept_eula"`
+	PatchSnapshotBeforeInstall bool     `mapstructure:"patch_snapshot_before_install"` // Linux: btrfs/LVM root snapshot per patch job
 
 	// Policy state telemetry probes for registry/config checks.
 	PolicyRegistryStateProbes []PolicyRegistryStateProbe `mapstructure:"policy_registry_state_probes"`
@@ -83,6 +140,12 @@ type Config struct {
 	MtlsKeyPEM      string `mapstructure:"mtls_key_pem"`
 	MtlsCertExpires string `mapstructure:"mtls_cert_expires"`
 
+	// Signed commands: Ed25519 org key pinned at enrollment. When required,
+	// high-risk commands without a valid signature from this key are
+	// rejected. Never changed by server config updates.
+	CommandSigningPublicKey string `mapstructure:"command_signing_public_key"`
+	RequireSignedCommands   bool   `mapstructure:"require_signed_commands"`
+
 	// IsService is a runtime flag set when the agent is running as a system service
 	// (Windows SCM, macOS launchd, Linux systemd). It is not persisted to config.
 	IsService bool `mapstructure:"-"`
@@ -120,6 +183,7 @@ func Default() *Config {
 		AuditEnabled:             true,
 		AuditMaxSizeMB:           50,
 		AuditMaxBackups:          3,
+		OutboxMaxSizeMB:          50,
 
 		AutoUpdate:                 true,
 		PatchExcludeFeatureUpdates: true,
@@ -140,7 +204,7 @@ func Load(cfgFile string) (*Config, error) {
 	} else {
 		viper.SetConfigName("agent")
 		viper.SetConfigType("yaml")
-		viper.AddConfigPath(configDir())
+		viper.AddConfigPath(ConfigDir())
 		viper.AddConfigPath(".")
 	}
 
@@ -213,6 +277,8 @@ func SaveTo(cfg *Config, cfgFile string) error {
 	viper.Set("log_level", cfg.LogLevel)
 	viper.Set("log_shipping_level", cfg.LogShippingLevel)
 	viper.Set("auto_update", cfg.AutoUpdate)
+	viper.Set("command_signing_public_key", cfg.CommandSigningPublicKey)
+	viper.Set("require_signed_commands", cfg.RequireSignedCommands)
 	// Write auth_token to agent.yaml so the Breeze Helper (which may not
 	// have root privileges to read secrets.yaml) can discover the token.
 	if cfg.AuthToken != "" {
@@ -229,8 +295,8 @@ func SaveTo(cfg *Config, cfgFile string) error {
 			}
 		}
 	} else {
-		cfgPath = filepath.Join(configDir(), "agent.yaml")
-		if err := os.MkdirAll(configDir(), 0750); err != nil {
+		cfgPath = filepath.Join(ConfigDir(), "agent.yaml")
+		if err := os.MkdirAll(ConfigDir(), 0750); err != nil {
 			return err
 		}
 	}
@@ -315,7 +381,7 @@ func SaveTo(cfg *Config, cfgFile string) error {
 	return nil
 }
 
-// GetDataDir returns the platform-specific data directory for the agent
+// GetDataDir returns the platform-specific data directory for the agent.
 func GetDataDir() string {
 	switch runtime.GOOS {
 	case "windows":
@@ -333,7 +399,7 @@ func GetDataDir() string {
 // Safe to call on every startup — it is a no-op if permissions are already
 // correct or the paths don't exist yet.
 func FixConfigPermissions() {
-	dir := configDir()
+	dir := ConfigDir()
 	if info, err := os.Stat(dir); err == nil && info.IsDir() {
 		if err := os.Chmod(dir, 0750); err != nil {
 			log.Warn("Failed to fix config directory permissions", "dir", dir, "error", err.Error())
@@ -355,10 +421,18 @@ func FixConfigPermissions() {
 }
 
 func secretsFilePath() string {
-	return filepath.Join(configDir(), "secrets.yaml")
+	return filepath.Join(ConfigDir(), "secrets.yaml")
+}
+
+// CommandPolicyPath returns the path of the local command policy file. It
+// is fixed so that neither the server nor agent.yaml can redirect it.
+func CommandPolicyPath() string {
+	return filepath.Join(ConfigDir(), "command_policy.yaml")
 }
 
-func configDir() string {
+// ConfigDir returns the platform-specific directory holding agent.yaml and
+// the agent's secrets.
+func ConfigDir() string {
 	switch runtime.GOOS {
 	case "windows":
 		return filepath.Join(os.Getenv("ProgramData"), "Breeze")
@@ -27,6 +27,14 @@ var knownCollectors = map[string]bool{
 	"reliability": true,
 }
 
+var knownBackupProviders = map[string]bool{
+	"local":  true,
+	"s3":     true,
+	"sftp":   true,
+	"webdav": true,
+	"azure":  true,
+}
+
 var validLogLevels = map[string]bool{
 	"debug":   true,
 	"info":    true,
@@ -134,6 +142,28 @@ func (c *Config) ValidateTiered() ValidationResult {
 		result.Warnings = append(result.Warnings, fmt.Errorf("log_format %q is not valid (use text or json)", c.LogFormat))
 	}
 
+	if c.BackupProvider != "" && !knownBackupProviders[c.BackupProvider] {
+		result.Warnings = append(result.Warnings, fmt.Errorf("backup_provider %q is not valid (use local, s3, sftp, webdav or azure)", c.BackupProvider))
+	}
+
+	for _, hooks := range []struct {
+		key   string
+		hooks *[]BackupHook
+	}{{"backup_pre_hooks", &c.BackupPreHooks}, {"backup_post_hooks", &c.BackupPostHooks}} {
+		valid := make([]BackupHook, 0, len(*hooks.hooks))
+		for idx, hook := range *hooks.hooks {
+			if strings.TrimSpace(hook.Script) == "" {
+				result.Warnings = append(result.Warnings, fmt.Errorf("%s[%d] has no script; entry ignored", hooks.key, idx))
+				continue
+			}
+			if hook.TimeoutSeconds < 0 {
+				hook.TimeoutSeconds = 0
+			}
+			valid = append(valid, hook)
+		}
+		*hooks.hooks = valid
+	}
+
 	// Clamp concurrency settings to safe range.
 	// These are warnings (not fatals) because the value is auto-corrected.
 	if c.MaxConcurrentCommands < 1 {
@@ -152,6 +182,19 @@ func (c *Config) ValidateTiered() ValidationResult {
 		c.CommandQueueSize = 10000
 	}
 
+	if c.RequireSignedCommands && c.CommandSigningPublicKey == "" {
+		result.Warnings = append(result.Warnings, fmt.Errorf("require_signed_commands is set but no command_signing_public_key is pinned; high-risk commands will be rejected"))
+	}
+
+	// 0 uses the outbox default size.
+	if c.OutboxMaxSizeMB < 0 {
+		result.Warnings = append(result.Warnings, fmt.Errorf("outbox_max_size_mb %d is negative, using default", c.OutboxMaxSizeMB))
+		c.OutboxMaxSizeMB = 0
+	} else if c.OutboxMaxSizeMB > 1024 {
+		result.Warnings = append(result.Warnings, fmt.Errorf("outbox_max_size_mb %d exceeds maximum 1024, clamped to 1024", c.OutboxMaxSizeMB))
+		c.OutboxMaxSizeMB = 1024
+	}
+
 	// Patch management validation
 	if c.PatchMinDiskSpaceGB != 0 {
 		if c.PatchMinDiskSpaceGB < 0.5 {
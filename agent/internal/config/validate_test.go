@@ -119,6 +119,18 @@ func TestValidateTieredUnknownCollectorIsWarning(t *testing.T) {
 	}
 }
 
+func TestValidateTieredUnknownBackupProviderIsWarning(t *testing.T) {
+	cfg := Default()
+	cfg.BackupProvider = "ftp"
+	result := cfg.ValidateTiered()
+	if result.HasFatals() {
+		t.Fatal("unknown backup provider should not be fatal")
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0].Error(), "ftp") {
+		t.Fatalf("expected warning about unknown backup provider, got %v", result.Warnings)
+	}
+}
+
 func TestValidateTieredUnknownLogLevelIsWarning(t *testing.T) {
 	cfg := Default()
 	cfg.LogLevel = "verbose"
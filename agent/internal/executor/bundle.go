@@ -0,0 +1,283 @@
+package executor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxAttachments is the maximum number of attachments per script.
+	MaxAttachments = 32
+
+	// MaxAttachmentSize is the maximum size of a single attachment.
+	MaxAttachmentSize = 512 * 1024 * 1024 // 512MB
+
+	// MaxArtifacts is the maximum number of files uploaded per execution.
+	MaxArtifacts = 50
+
+	// MaxArtifactSize is the maximum size of a single artifact.
+	MaxArtifactSize = 256 * 1024 * 1024 // 256MB
+
+	attachmentDownloadTimeout = 15 * time.Minute
+)
+
+// Attachment is a file downloaded into the execution's working directory
+// before the script starts. The download is rejected unless its SHA-256
+// matches.
+type Attachment struct {
+	// Name is the destination path, relative to the working directory.
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Size, if set, must match the downloaded size.
+	Size       int64 `json:"size,omitempty"`
+	Executable bool  `json:"executable,omitempty"`
+}
+
+// Artifact is a file collected from the working directory after the script
+// exits.
+type Artifact struct {
+	// Name is the file's slash-separated path relative to the working
+	// directory.
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Uploaded bool   `json:"uploaded"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ArtifactUploadFunc uploads one artifact. content is valid only for the
+// duration of the call.
+type ArtifactUploadFunc func(artifact Artifact, content io.Reader) error
+
+// validateBundle checks attachment and artifact declarations before any
+// work is done.
+func validateBundle(script ScriptExecution) error {
+	if len(script.Attachments) > MaxAttachments {
+		return fmt.Errorf("too many attachments: %d (max %d)", len(script.Attachments), MaxAttachments)
+	}
+	seen := make(map[string]bool, len(script.Attachments))
+	for _, a := range script.Attachments {
+		name := filepath.Clean(filepath.FromSlash(a.Name))
+		if a.Name == "" || !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid attachment name %q", a.Name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate attachment %q", a.Name)
+		}
+		seen[name] = true
+		if !strings.HasPrefix(a.URL, "https://") && !strings.HasPrefix(a.URL, "http://") {
+			return fmt.Errorf("attachment %q has an invalid URL", a.Name)
+		}
+		if sum, err := hex.DecodeString(a.SHA256); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("attachment %q requires a SHA-256 checksum", a.Name)
+		}
+		if a.Size < 0 || a.Size > MaxAttachmentSize {
+			return fmt.Errorf("attachment %q size %d is out of range", a.Name, a.Size)
+		}
+	}
+	for _, pattern := range script.Artifacts {
+		if pattern == "" || !filepath.IsLocal(filepath.FromSlash(pattern)) {
+			return fmt.Errorf("invalid artifact pattern %q", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid artifact pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// fetchAttachments downloads each attachment into dir, verifying its
+// checksum before it becomes visible under its final name.
+func (e *Executor) fetchAttachments(dir string, attachments []Attachment) error {
+	for _, a := range attachments {
+		if err := e.fetchAttachment(dir, a); err != nil {
+			return fmt.Errorf("failed to fetch attachment %s: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+func (e *Executor) fetchAttachment(dir string, a Attachment) error {
+	dest := filepath.Join(dir, filepath.Clean(filepath.FromSlash(a.Name)))
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), attachmentDownloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d from download URL", resp.StatusCode)
+	}
+
+	tmp := dest + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(resp.Body, MaxAttachmentSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if n > MaxAttachmentSize {
+		return fmt.Errorf("file exceeds maximum size of %d bytes", MaxAttachmentSize)
+	}
+	if a.Size > 0 && n != a.Size {
+		return fmt.Errorf("size mismatch: expected %d bytes, got %d", a.Size, n)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, a.SHA256) {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", a.SHA256, actual)
+	}
+
+	mode := os.FileMode(0600)
+	if a.Executable {
+		mode = 0700
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return fmt.Errorf("set permissions: %w", err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return fmt.Errorf("rename file: %w", err)
+	}
+	return nil
+}
+
+// collectArtifacts returns the regular files in dir matching patterns. A
+// pattern matching a directory collects the files beneath it. Symlinks are
+// skipped, including symlinked directories a pattern would pass through, so
+// a script cannot upload files from outside dir.
+func collectArtifacts(dir string, patterns []string) ([]string, error) {
+	found := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifact pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if throughSymlink(dir, match) {
+				continue
+			}
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					found[path] = true
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to collect artifacts: %w", err)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(found))
+	for path := range found {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// throughSymlink reports whether any directory between dir and path is a
+// symlink. The final element is left to the caller.
+func throughSymlink(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return true
+	}
+	parent := dir
+	parts := strings.Split(rel, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if err != nil || info.Mode()&fs.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadArtifacts collects and uploads the script's declared artifacts.
+// Failures are recorded per artifact rather than failing the execution.
+func uploadArtifacts(dir string, script ScriptExecution) []Artifact {
+	paths, err := collectArtifacts(dir, script.Artifacts)
+	if err != nil {
+		log.Warn("artifact collection failed", "executionId", script.ID, "error", err)
+		return []Artifact{{Error: err.Error()}}
+	}
+
+	artifacts := make([]Artifact, 0, len(paths))
+	for i, path := range paths {
+		rel, _ := filepath.Rel(dir, path)
+		artifact := Artifact{Name: filepath.ToSlash(rel)}
+		if i >= MaxArtifacts {
+			artifact.Error = fmt.Sprintf("exceeds the limit of %d artifacts", MaxArtifacts)
+		} else if err := uploadArtifact(path, &artifact, script.UploadArtifact); err != nil {
+			artifact.Error = err.Error()
+		}
+		if artifact.Error != "" {
+			log.Warn("artifact not uploaded", "executionId", script.ID, "artifact", artifact.Name, "error", artifact.Error)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	return artifacts
+}
+
+func uploadArtifact(path string, artifact *Artifact, upload ArtifactUploadFunc) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open artifact: %w", err)
+	}
+	defer f.Close()
+
+	// Hash first so the checksum can accompany the upload.
+	hash := sha256.New()
+	n, err := io.Copy(hash, io.LimitReader(f, MaxArtifactSize+1))
+	if err != nil {
+		return fmt.Errorf("read artifact: %w", err)
+	}
+	if n > MaxArtifactSize {
+		return fmt.Errorf("exceeds maximum size of %d bytes", MaxArtifactSize)
+	}
+	artifact.Size = n
+	artifact.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if upload == nil {
+		return fmt.Errorf("no artifact upload configured")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("read artifact: %w", err)
+	}
+	if err := upload(*artifact, io.LimitReader(f, n)); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	artifact.Uploaded = true
+	return nil
+}
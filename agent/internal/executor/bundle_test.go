@@ -0,0 +1,133 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serveAttachment(t *testing.T, body string) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	sum := sha256.Sum256([]byte(body))
+	return server, hex.EncodeToString(sum[:])
+}
+
+func TestExecuteWithAttachmentsAndArtifacts(t *testing.T) {
+	if !IsScriptTypeAvailableOnPlatform(ScriptTypeBash) {
+		t.Skip("bash not available")
+	}
+	server, sum := serveAttachment(t, "echo from-tool\n")
+
+	uploaded := map[string]string{}
+	e := newTestExecutor()
+	result, err := e.Execute(ScriptExecution{
+		ID:          "exec-bundle",
+		ScriptType:  ScriptTypeBash,
+		Script:      "pwd; mkdir reports; bash lib/tool.sh > reports/out.txt; ln -s /etc/hostname reports/link; echo log > run.log",
+		Timeout:     10,
+		Attachments: []Attachment{{Name: "lib/tool.sh", URL: server.URL + "/tool.sh", SHA256: strings.ToUpper(sum)}},
+		Artifacts:   []string{"reports", "*.log", "missing/*"},
+		UploadArtifact: func(a Artifact, content io.Reader) error {
+			data, _ := io.ReadAll(content)
+			uploaded[a.Name] = string(data)
+			return nil
+		},
+	})
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("execution failed: %v %+v", err, result)
+	}
+	workDir := strings.TrimSpace(result.Stdout)
+
+	if uploaded["reports/out.txt"] != "from-tool\n" || uploaded["run.log"] != "log\n" || len(uploaded) != 2 {
+		t.Fatalf("unexpected uploads (symlinks must be skipped): %v", uploaded)
+	}
+	for _, a := range result.Artifacts {
+		sum := sha256.Sum256([]byte(uploaded[a.Name]))
+		if !a.Uploaded || a.SHA256 != hex.EncodeToString(sum[:]) || a.Size != int64(len(uploaded[a.Name])) {
+			t.Fatalf("unexpected artifact record: %+v", a)
+		}
+	}
+	if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+		t.Fatalf("working directory %s not removed: %v", workDir, err)
+	}
+}
+
+func TestExecuteRejectsAttachmentChecksumMismatch(t *testing.T) {
+	if !IsScriptTypeAvailableOnPlatform(ScriptTypeBash) {
+		t.Skip("bash not available")
+	}
+	server, _ := serveAttachment(t, "tampered")
+
+	e := newTestExecutor()
+	result, err := e.Execute(ScriptExecution{
+		ID:          "exec-mismatch",
+		ScriptType:  ScriptTypeBash,
+		Script:      "echo should-not-run",
+		Timeout:     10,
+		Attachments: []Attachment{{Name: "data.bin", URL: server.URL, SHA256: strings.Repeat("0", 64)}},
+	})
+	if err == nil || !strings.Contains(result.Error, "checksum mismatch") || result.Stdout != "" {
+		t.Fatalf("expected checksum failure before the script ran: %v %+v", err, result)
+	}
+}
+
+func TestValidateBundle(t *testing.T) {
+	sum := strings.Repeat("a", 64)
+	tests := []struct {
+		name   string
+		script ScriptExecution
+		want   string
+	}{
+		{"escaping attachment", ScriptExecution{Attachments: []Attachment{{Name: "../x", URL: "https://h/x", SHA256: sum}}}, "invalid attachment name"},
+		{"absolute attachment", ScriptExecution{Attachments: []Attachment{{Name: "/etc/x", URL: "https://h/x", SHA256: sum}}}, "invalid attachment name"},
+		{"missing checksum", ScriptExecution{Attachments: []Attachment{{Name: "x", URL: "https://h/x"}}}, "SHA-256"},
+		{"bad scheme", ScriptExecution{Attachments: []Attachment{{Name: "x", URL: "file:///etc/passwd", SHA256: sum}}}, "invalid URL"},
+		{"duplicate", ScriptExecution{Attachments: []Attachment{{Name: "x", URL: "https://h/x", SHA256: sum}, {Name: "./x", URL: "https://h/y", SHA256: sum}}}, "duplicate"},
+		{"escaping artifact", ScriptExecution{Artifacts: []string{"../*"}}, "invalid artifact pattern"},
+		{"valid", ScriptExecution{Attachments: []Attachment{{Name: "a/b", URL: "https://h/x", SHA256: sum}}, Artifacts: []string{"out/*.zip"}}, ""},
+	}
+	for _, tt := range tests {
+		err := validateBundle(tt.script)
+		if (tt.want == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCollectArtifactsSkipsSymlinksOutsideDir(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "reports"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "reports", "out.txt"), []byte("ok"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "reports", "secret.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := collectArtifacts(dir, []string{"reports", "reports/*", "escape", "escape/*", "*/secret.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != filepath.Join(dir, "reports", "out.txt") {
+		t.Fatalf("unexpected artifacts %v", paths)
+	}
+}
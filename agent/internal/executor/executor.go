@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
@@ -27,38 +28,69 @@ const (
 
 	// MaxOutputSize is the maximum size of stdout/stderr to capture
 	MaxOutputSize = 1024 * 1024 // 1MB
+
+	// stdinWriteTimeout bounds how long WriteInput waits for a script to
+	// read its input.
+	stdinWriteTimeout = 10 * time.Second
 )
 
 // ScriptExecution represents a script to be executed
 type ScriptExecution struct {
-	ID         string            `json:"id"`
-	ScriptID   string            `json:"scriptId"`
-	ScriptType string            `json:"scriptType"`
-	Script     string            `json:"script"`
+	ID         string `json:"id"`
+	ScriptID   string `json:"scriptId"`
+	ScriptType string `json:"scriptType"`
+	Script     string `json:"script"`
+	// Parameters are substituted into {{name}} placeholders in the script
+	// text. Deprecated: use Params, which are not substituted.
 	Parameters map[string]string `json:"parameters,omitempty"`
-	Timeout    int               `json:"timeout"`
-	RunAs      string            `json:"runAs,omitempty"`
+	// Params are typed parameters passed through the environment or the
+	// language's own parameter binding.
+	Params  []Param `json:"params,omitempty"`
+	Timeout int     `json:"timeout"`
+	RunAs   string  `json:"runAs,omitempty"`
+	// Interactive connects the script's standard input so WriteInput can
+	// send it data while it runs.
+	Interactive bool `json:"interactive,omitempty"`
+	// Attachments are downloaded into the working directory before the
+	// script starts.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Artifacts are glob patterns, relative to the working directory, for
+	// files uploaded with UploadArtifact after the script exits.
+	Artifacts []string `json:"artifacts,omitempty"`
+	// Sandbox, if set, confines the script to the given profile.
+	Sandbox *Sandbox `json:"sandbox,omitempty"`
+
+	// OnOutput, if set, receives stdout and stderr as they are produced.
+	OnOutput OutputFunc `json:"-"`
+	// UploadArtifact receives each file matching Artifacts.
+	UploadArtifact ArtifactUploadFunc `json:"-"`
 }
 
 // ScriptResult represents the result of a script execution
 type ScriptResult struct {
-	ExecutionID     string   `json:"executionId"`
-	ExitCode        int      `json:"exitCode"`
-	Stdout          string   `json:"stdout"`
-	Stderr          string   `json:"stderr"`
-	Error           string   `json:"error,omitempty"`
-	StartedAt       string   `json:"startedAt"`
-	CompletedAt     string   `json:"completedAt"`
-	TruncatedFields []string `json:"truncatedFields,omitempty"`
+	ExecutionID     string     `json:"executionId"`
+	ExitCode        int        `json:"exitCode"`
+	Stdout          string     `json:"stdout"`
+	Stderr          string     `json:"stderr"`
+	Error           string     `json:"error,omitempty"`
+	StartedAt       string     `json:"startedAt"`
+	CompletedAt     string     `json:"completedAt"`
+	TruncatedFields []string   `json:"truncatedFields,omitempty"`
+	TimedOut        bool       `json:"timedOut,omitempty"`
+	Artifacts       []Artifact `json:"artifacts,omitempty"`
+	// LimitHits lists the sandbox budgets the script ran into.
+	LimitHits []LimitHit `json:"limitHits,omitempty"`
 }
 
 // Executor handles script execution with security controls
 type Executor struct {
-	config    *config.Config
-	workDir   string
-	validator *SecurityValidator
-	running   map[string]*runningExecution
-	mu        sync.Mutex
+	config     *config.Config
+	workDir    string
+	dataDir    string
+	httpClient *http.Client
+	validator  *SecurityValidator
+	running    map[string]*runningExecution
+	mu         sync.Mutex
 }
 
 // runningExecution tracks a running script execution
@@ -67,23 +99,30 @@ type runningExecution struct {
 	cancel     context.CancelFunc
 	startedAt  time.Time
 	scriptType string
+
+	stdinMu     sync.Mutex
+	stdin       *os.File // nil once closed
+	interactive bool
 }
 
 // New creates a new Executor instance
 func New(cfg *config.Config) *Executor {
 	workDir := os.TempDir()
-	if dir := config.GetDataDir(); dir != "" {
-		scriptDir := dir + "/scripts"
+	dataDir := config.GetDataDir()
+	if dataDir != "" {
+		scriptDir := dataDir + "/scripts"
 		if err := os.MkdirAll(scriptDir, 0700); err == nil {
 			workDir = scriptDir
 		}
 	}
 
 	return &Executor{
-		config:    cfg,
-		workDir:   workDir,
-		validator: NewSecurityValidator(SecurityLevelStrict),
-		running:   make(map[string]*runningExecution),
+		config:     cfg,
+		workDir:    workDir,
+		dataDir:    dataDir,
+		httpClient: http.DefaultClient,
+		validator:  NewSecurityValidator(SecurityLevelStrict),
+		running:    make(map[string]*runningExecution),
 	}
 }
 
@@ -119,7 +158,7 @@ func (e *Executor) Execute(script ScriptExecution) (*ScriptResult, error) {
 	scriptContent := SubstituteParameters(script.Script, script.Parameters)
 
 	// Validate script content for security (after parameter substitution)
-	if err := e.validateScript(scriptContent); err != nil {
+	if err := e.validateScript(script.ScriptType, scriptContent); err != nil {
 		log.Warn("script validation failed", "executionId", script.ID, "error", err)
 		result.ExitCode = -1
 		result.Error = fmt.Sprintf("script validation failed: %v", err)
@@ -127,6 +166,25 @@ func (e *Executor) Execute(script ScriptExecution) (*ScriptResult, error) {
 		return result, err
 	}
 
+	if err := validateParams(script.Params); err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+		return result, err
+	}
+	if err := validateSandbox(script); err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+		return result, err
+	}
+	if err := validateBundle(script); err != nil {
+		result.ExitCode = -1
+		result.Error = err.Error()
+		result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+		return result, err
+	}
+
 	// Write script to temp file
 	scriptPath, err := WriteScriptFile(scriptContent, script.ScriptType)
 	if err != nil {
@@ -162,18 +220,57 @@ func (e *Executor) Execute(script ScriptExecution) (*ScriptResult, error) {
 	}
 
 	args := append(shellArgs, scriptPath)
+	args = append(args, paramArgs(script.ScriptType, script.Params)...)
 	cmd := exec.CommandContext(ctx, shellCmd, args...)
 
-	// Set working directory
-	cmd.Dir = e.workDir
+	// Each execution gets its own working directory, holding its
+	// attachments and artifacts, removed once artifacts are uploaded.
+	execDir, err := os.MkdirTemp(e.workDir, "exec-*")
+	if err != nil {
+		result.ExitCode = -1
+		result.Error = fmt.Sprintf("failed to create working directory: %v", err)
+		result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+		return result, err
+	}
+	defer func() {
+		if err := os.RemoveAll(execDir); err != nil {
+			log.Warn("failed to remove working directory", "executionId", script.ID, "dir", execDir, "error", err)
+		}
+	}()
+	if err := e.fetchAttachments(execDir, script.Attachments); err != nil {
+		log.Error("failed to fetch attachments", "executionId", script.ID, "error", err)
+		result.ExitCode = -1
+		result.Error = err.Error()
+		result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+		return result, err
+	}
+	cmd.Dir = execDir
 
-	// Set up output capture with size limits
+	// Kill the whole process group on timeout or cancellation; killing only
+	// the shell leaves children holding the output pipes open.
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = 5 * time.Second
+
+	// Set up output capture with size limits, streaming it live if requested
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &limitedWriter{buf: &stdout, limit: MaxOutputSize}
-	cmd.Stderr = &limitedWriter{buf: &stderr, limit: MaxOutputSize}
+	stdoutWriter := &limitedWriter{buf: &stdout, limit: MaxOutputSize}
+	stderrWriter := &limitedWriter{buf: &stderr, limit: MaxOutputSize}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+	secrets := secretParams(script.Params)
+	var stream *outputStream
+	if script.OnOutput != nil {
+		var redactor *streamRedactor
+		if len(secrets) > 0 {
+			redactor = newStreamRedactor(secrets)
+		}
+		stream = newOutputStream(script.ID, script.OnOutput, redactor)
+		cmd.Stdout = stream.writer("stdout", stdoutWriter)
+		cmd.Stderr = stream.writer("stderr", stderrWriter)
+	}
 
 	// Configure environment
-	cmd.Env = e.buildEnvironment(script)
+	cmd.Env = append(e.buildEnvironment(script), "BREEZE_WORK_DIR="+execDir)
 
 	// Set process group so children are killed on timeout
 	setProcessGroup(cmd)
@@ -189,14 +286,44 @@ func (e *Executor) Execute(script ScriptExecution) (*ScriptResult, error) {
 		}
 	}
 
+	execution := &runningExecution{
+		cmd:         cmd,
+		cancel:      cancel,
+		startedAt:   startTime,
+		scriptType:  script.ScriptType,
+		interactive: script.Interactive,
+	}
+
+	// Interactive scripts read stdin from a pipe fed by WriteInput; others
+	// get the null device.
+	if script.Interactive {
+		stdinReader, stdinWriter, err := os.Pipe()
+		if err != nil {
+			result.ExitCode = -1
+			result.Error = fmt.Sprintf("failed to create stdin pipe: %v", err)
+			result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+			return result, err
+		}
+		defer stdinReader.Close()
+		cmd.Stdin = stdinReader
+		execution.stdin = stdinWriter
+	}
+
+	var sandbox *sandboxRun
+	if script.Sandbox != nil {
+		sandbox, err = applySandbox(cmd, script.Sandbox, execDir, scriptPath, e.dataDir)
+		if err != nil {
+			log.Error("failed to set up sandbox", "executionId", script.ID, "error", err)
+			result.ExitCode = -1
+			result.Error = fmt.Sprintf("failed to set up sandbox: %v", err)
+			result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+			return result, err
+		}
+	}
+
 	// Track running execution
 	e.mu.Lock()
-	e.running[script.ID] = &runningExecution{
-		cmd:        cmd,
-		cancel:     cancel,
-		startedAt:  startTime,
-		scriptType: script.ScriptType,
-	}
+	e.running[script.ID] = execution
 	e.mu.Unlock()
 
 	// Execute the script
@@ -206,15 +333,21 @@ func (e *Executor) Execute(script ScriptExecution) (*ScriptResult, error) {
 	e.mu.Lock()
 	delete(e.running, script.ID)
 	e.mu.Unlock()
+	execution.closeInput()
+	if stream != nil {
+		stream.close()
+	}
+	result.LimitHits = sandbox.finish()
 
 	// Process results
-	result.Stdout = stdout.String()
-	result.Stderr = stderr.String()
+	result.Stdout = redactSecrets(stdout.String(), secrets)
+	result.Stderr = redactSecrets(stderr.String(), secrets)
+	if len(script.Artifacts) > 0 {
+		result.Artifacts = uploadArtifacts(execDir, script)
+	}
 	result.CompletedAt = time.Now().UTC().Format(time.RFC3339)
 
 	// Record truncation in both a structured field and human-readable notice
-	stdoutWriter := cmd.Stdout.(*limitedWriter)
-	stderrWriter := cmd.Stderr.(*limitedWriter)
 	if stdoutWriter.truncated {
 		result.TruncatedFields = append(result.TruncatedFields, "stdout")
 		result.Stderr += "\n[breeze: stdout truncated at 1MB]"
@@ -226,12 +359,9 @@ func (e *Executor) Execute(script ScriptExecution) (*ScriptResult, error) {
 
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			// Kill the entire process group on timeout
-			if killErr := killProcessGroup(cmd); killErr != nil {
-				log.Warn("failed to kill process group", "executionId", script.ID, "error", killErr)
-			}
 			log.Warn("execution timed out", "executionId", script.ID, "timeoutSeconds", timeout)
 			result.ExitCode = -1
+			result.TimedOut = true
 			result.Error = fmt.Sprintf("execution timed out after %d seconds", timeout)
 		} else if exitErr, ok := err.(*exec.ExitError); ok {
 			result.ExitCode = exitErr.ExitCode()
@@ -272,6 +402,57 @@ func (e *Executor) Cancel(executionID string) error {
 	return nil
 }
 
+// WriteInput sends data to the standard input of a running interactive
+// script. With eof set, standard input is closed after data is written.
+func (e *Executor) WriteInput(executionID string, data []byte, eof bool) error {
+	e.mu.Lock()
+	running, exists := e.running[executionID]
+	e.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("execution %s not found or already completed", executionID)
+	}
+	if !running.interactive {
+		return fmt.Errorf("execution %s does not accept input", executionID)
+	}
+
+	running.stdinMu.Lock()
+	defer running.stdinMu.Unlock()
+	if running.stdin == nil {
+		return fmt.Errorf("input for execution %s is closed", executionID)
+	}
+	if len(data) > 0 {
+		// A script that stops reading would otherwise block the caller once
+		// the pipe buffer fills. Deadlines are unsupported on Windows pipes.
+		_ = running.stdin.SetWriteDeadline(time.Now().Add(stdinWriteTimeout))
+		if _, err := running.stdin.Write(data); err != nil {
+			return fmt.Errorf("failed to write script input: %w", err)
+		}
+	}
+	if eof {
+		err := running.stdin.Close()
+		running.stdin = nil
+		if err != nil {
+			return fmt.Errorf("failed to close script input: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *runningExecution) closeInput() {
+	r.stdinMu.Lock()
+	defer r.stdinMu.Unlock()
+	if r.stdin != nil {
+		r.stdin.Close()
+		r.stdin = nil
+	}
+}
+
+// Analyze reports what the security policy finds in a script without
+// running it
+func (e *Executor) Analyze(scriptType, content string) []Finding {
+	return e.validator.ValidateWithDetails(scriptType, content)
+}
+
 // ListRunning returns a list of currently running execution IDs
 func (e *Executor) ListRunning() []string {
 	e.mu.Lock()
@@ -292,7 +473,7 @@ func (e *Executor) GetRunningCount() int {
 }
 
 // validateScript performs security validation on script content
-func (e *Executor) validateScript(content string) error {
+func (e *Executor) validateScript(scriptType, content string) error {
 	if content == "" {
 		return fmt.Errorf("script content is empty")
 	}
@@ -302,8 +483,8 @@ func (e *Executor) validateScript(content string) error {
 		return fmt.Errorf("script content exceeds maximum size of %d bytes", MaxScriptSize)
 	}
 
-	// Use the SecurityValidator for comprehensive pattern checking
-	return e.validator.Validate(content)
+	// Parse the script and apply the security policy to the commands it runs
+	return e.validator.Validate(scriptType, content)
 }
 
 // buildEnvironment creates the environment variables for script execution
@@ -321,6 +502,7 @@ func (e *Executor) buildEnvironment(script ScriptExecution) []string {
 		envKey := "BREEZE_PARAM_" + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
 		env = append(env, envKey+"="+value)
 	}
+	env = append(env, paramEnv(script.Params)...)
 
 	return env
 }
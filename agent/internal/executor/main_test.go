@@ -0,0 +1,13 @@
+package executor
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain lets the test binary act as the sandbox init process, as the
+// agent binary does in production.
+func TestMain(m *testing.M) {
+	SandboxInit()
+	os.Exit(m.Run())
+}
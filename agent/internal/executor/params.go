@@ -0,0 +1,236 @@
+package executor
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/breeze-rmm/agent/internal/secmem"
+)
+
+// ParamType is the declared type of a script parameter.
+type ParamType string
+
+// Parameter types
+const (
+	ParamString ParamType = "string"
+	ParamInt    ParamType = "int"
+	ParamBool   ParamType = "bool"
+	ParamEnum   ParamType = "enum"
+	ParamSecret ParamType = "secret"
+)
+
+const (
+	// MaxParams is the maximum number of typed parameters per script.
+	MaxParams = 64
+
+	// MaxParamValueSize is the maximum size of one parameter value.
+	MaxParamValueSize = 32 * 1024
+
+	// minRedactLength is the shortest secret redacted from output; shorter
+	// values would mangle unrelated output without protecting much.
+	minRedactLength = 4
+)
+
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,63}$`)
+
+// Param is a typed script parameter. Unlike Parameters, typed parameters
+// are never substituted into the script text. Every script receives them as
+// BREEZE_PARAM_<NAME> environment variables; PowerShell scripts also get
+// non-secret parameters as named arguments, so a param() block binds them.
+type Param struct {
+	Name string    `json:"name"`
+	Type ParamType `json:"type"`
+	// Value holds the value of non-secret parameters.
+	Value string `json:"value,omitempty"`
+	// Secret holds the value of secret parameters. It is never written to
+	// disk, passed on a command line or returned in output.
+	Secret *secmem.SecureString `json:"secret,omitempty"`
+	// Allowed lists the permitted values of an enum parameter.
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// NewParam builds a typed parameter from its declared type and raw value,
+// normalizing int and bool values. Secret values are moved into secure
+// memory.
+func NewParam(name string, typ ParamType, value string, allowed []string) (Param, error) {
+	p := Param{Name: name, Type: typ, Allowed: allowed}
+	switch typ {
+	case ParamString, ParamEnum:
+		p.Value = value
+	case ParamInt:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("parameter %s: %q is not an integer", name, value)
+		}
+		p.Value = strconv.FormatInt(n, 10)
+	case ParamBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return p, fmt.Errorf("parameter %s: %q is not a boolean", name, value)
+		}
+		p.Value = strconv.FormatBool(b)
+	case ParamSecret:
+		p.Secret = secmem.NewSecureString(value)
+	default:
+		return p, fmt.Errorf("parameter %s: unknown type %q", name, typ)
+	}
+	return p, p.validate()
+}
+
+func (p Param) validate() error {
+	if !paramNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid parameter name %q", p.Name)
+	}
+	value := p.Value
+	switch p.Type {
+	case ParamString:
+	case ParamInt:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("parameter %s: %q is not an integer", p.Name, value)
+		}
+	case ParamBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("parameter %s: %q is not a boolean", p.Name, value)
+		}
+	case ParamEnum:
+		if !slices.Contains(p.Allowed, value) {
+			return fmt.Errorf("parameter %s: %q is not one of %s", p.Name, value, strings.Join(p.Allowed, ", "))
+		}
+	case ParamSecret:
+		if value != "" {
+			return fmt.Errorf("parameter %s: secret value must be held in secure memory", p.Name)
+		}
+		value = p.Secret.Reveal()
+	default:
+		return fmt.Errorf("parameter %s: unknown type %q", p.Name, p.Type)
+	}
+	if len(value) > MaxParamValueSize {
+		return fmt.Errorf("parameter %s exceeds maximum size of %d bytes", p.Name, MaxParamValueSize)
+	}
+	if strings.ContainsRune(value, 0) {
+		return fmt.Errorf("parameter %s contains a NUL byte", p.Name)
+	}
+	return nil
+}
+
+// validateParams checks typed parameters and rejects duplicate names,
+// including names that collide once mapped to environment variables.
+func validateParams(params []Param) error {
+	if len(params) > MaxParams {
+		return fmt.Errorf("too many parameters: %d (max %d)", len(params), MaxParams)
+	}
+	seen := make(map[string]bool, len(params))
+	for _, p := range params {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		key := paramEnvName(p.Name)
+		if seen[key] {
+			return fmt.Errorf("duplicate parameter %s", p.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// paramEnvName returns the environment variable holding a parameter.
+func paramEnvName(name string) string {
+	return "BREEZE_PARAM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// paramEnv returns the environment entries for typed parameters.
+func paramEnv(params []Param) []string {
+	env := make([]string, 0, len(params))
+	for _, p := range params {
+		value := p.Value
+		if p.Type == ParamSecret {
+			value = p.Secret.Reveal()
+		}
+		env = append(env, paramEnvName(p.Name)+"="+value)
+	}
+	return env
+}
+
+// paramArgs returns language-native arguments for typed parameters. Only
+// PowerShell binds named arguments; secrets are left to the environment so
+// they do not appear in the process list.
+func paramArgs(scriptType string, params []Param) []string {
+	if !strings.EqualFold(scriptType, ScriptTypePowerShell) {
+		return nil
+	}
+	var args []string
+	for _, p := range params {
+		switch p.Type {
+		case ParamSecret:
+			continue
+		case ParamBool:
+			args = append(args, "-"+p.Name+":$"+p.Value)
+		default:
+			args = append(args, "-"+p.Name, p.Value)
+		}
+	}
+	return args
+}
+
+// secretParams returns the secret values among params.
+func secretParams(params []Param) []*secmem.SecureString {
+	var secrets []*secmem.SecureString
+	for _, p := range params {
+		if p.Type == ParamSecret && p.Secret != nil {
+			secrets = append(secrets, p.Secret)
+		}
+	}
+	return secrets
+}
+
+// redactSecrets replaces each occurrence of a secret value in output.
+func redactSecrets(output string, secrets []*secmem.SecureString) string {
+	for _, s := range secrets {
+		if value := s.Reveal(); len(value) >= minRedactLength {
+			output = strings.ReplaceAll(output, value, "[REDACTED]")
+		}
+	}
+	return output
+}
+
+// streamRedactor redacts secrets from output that arrives in pieces. The
+// tail of each stream, one byte shorter than the longest secret, is held
+// back so a secret split across two pieces is still caught.
+type streamRedactor struct {
+	secrets []*secmem.SecureString
+	keep    int
+	carry   map[string]string
+}
+
+func newStreamRedactor(secrets []*secmem.SecureString) *streamRedactor {
+	r := &streamRedactor{secrets: secrets, carry: make(map[string]string)}
+	for _, s := range secrets {
+		if n := len(s.Reveal()); n >= minRedactLength && n-1 > r.keep {
+			r.keep = n - 1
+		}
+	}
+	return r
+}
+
+// redact returns the redacted output of stream that is safe to send. With
+// final set, the held-back tail is released as well.
+func (r *streamRedactor) redact(stream string, data []byte, final bool) []byte {
+	text := redactSecrets(r.carry[stream]+string(data), r.secrets)
+	cut := len(text)
+	if !final {
+		cut = max(0, len(text)-r.keep)
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	if cut < len(text) {
+		r.carry[stream] = text[cut:]
+	} else {
+		delete(r.carry, stream)
+	}
+	return []byte(text[:cut])
+}
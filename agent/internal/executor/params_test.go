@@ -0,0 +1,131 @@
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/breeze-rmm/agent/internal/secmem"
+)
+
+func TestNewParamNormalizesAndValidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     ParamType
+		value   string
+		allowed []string
+		want    string
+		wantErr string
+	}{
+		{"count", ParamInt, " 42 ", nil, "42", ""},
+		{"count", ParamInt, "4; rm -rf /", nil, "", "not an integer"},
+		{"force", ParamBool, "TRUE", nil, "true", ""},
+		{"force", ParamBool, "yes", nil, "", "not a boolean"},
+		{"mode", ParamEnum, "fast", []string{"fast", "slow"}, "fast", ""},
+		{"mode", ParamEnum, "turbo", []string{"fast", "slow"}, "", "not one of"},
+		{"site", ParamString, "it's \"quoted\" $(id)", nil, "it's \"quoted\" $(id)", ""},
+		{"site", ParamString, "a\x00b", nil, "", "NUL"},
+		{"bad-name", ParamString, "x", nil, "", "invalid parameter name"},
+		{"site", "float", "1.5", nil, "", "unknown type"},
+	}
+	for _, tt := range tests {
+		p, err := NewParam(tt.name, tt.typ, tt.value, tt.allowed)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s %s %q: got error %v, want %q", tt.name, tt.typ, tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || p.Value != tt.want {
+			t.Errorf("%s %s %q: got %q, %v", tt.name, tt.typ, tt.value, p.Value, err)
+		}
+	}
+
+	secret, err := NewParam("token", ParamSecret, "s3cr3t-value", nil)
+	if err != nil || secret.Value != "" || secret.Secret.Reveal() != "s3cr3t-value" {
+		t.Fatalf("secret parameter not held in secure memory: %+v, %v", secret, err)
+	}
+}
+
+func TestValidateParamsRejectsEnvironmentCollisions(t *testing.T) {
+	err := validateParams([]Param{
+		{Name: "Site", Type: ParamString, Value: "a"},
+		{Name: "SITE", Type: ParamString, Value: "b"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("expected duplicate parameter error, got %v", err)
+	}
+}
+
+func TestParamArgsBindsPowerShellWithoutSecrets(t *testing.T) {
+	params := []Param{
+		{Name: "Count", Type: ParamInt, Value: "3"},
+		{Name: "Force", Type: ParamBool, Value: "false"},
+		{Name: "Token", Type: ParamSecret, Secret: secmem.NewSecureString("hidden")},
+	}
+	want := []string{"-Count", "3", "-Force:$false"}
+	if got := paramArgs(ScriptTypePowerShell, params); !reflect.DeepEqual(got, want) {
+		t.Fatalf("paramArgs = %q, want %q", got, want)
+	}
+	if got := paramArgs(ScriptTypeBash, params); got != nil {
+		t.Fatalf("bash should not receive arguments, got %q", got)
+	}
+}
+
+func TestExecuteWithTypedParamsRedactsSecrets(t *testing.T) {
+	if !IsScriptTypeAvailableOnPlatform(ScriptTypeBash) {
+		t.Skip("bash not available")
+	}
+
+	var streamed chunkRecorder
+	e := newTestExecutor()
+	result, err := e.Execute(ScriptExecution{
+		ID:         "exec-typed",
+		ScriptType: ScriptTypeBash,
+		// Placeholders are left alone for typed parameters.
+		Script: `echo "site={{site}} env=$BREEZE_PARAM_SITE count=$BREEZE_PARAM_COUNT"; echo "token=$BREEZE_PARAM_TOKEN" >&2; grep -c "$BREEZE_PARAM_TOKEN" "$0"`,
+		Params: []Param{
+			{Name: "site", Type: ParamString, Value: "a'b;$(id)"},
+			{Name: "count", Type: ParamInt, Value: "7"},
+			{Name: "token", Type: ParamSecret, Secret: secmem.NewSecureString("hunter2-pass")},
+		},
+		Timeout:  10,
+		OnOutput: streamed.record,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Stdout != "site={{site}} env=a'b;$(id) count=7\n0\n" {
+		t.Fatalf("unexpected stdout: %q", result.Stdout)
+	}
+	if result.Stderr != "token=[REDACTED]\n" {
+		t.Fatalf("secret not redacted from stderr: %q", result.Stderr)
+	}
+	if out, _ := streamed.streams(); strings.Contains(out["stderr"], "hunter2-pass") {
+		t.Fatalf("secret streamed unredacted: %q", out["stderr"])
+	}
+}
+
+func TestSanitizeOutputRedactsSecrets(t *testing.T) {
+	secrets := []*secmem.SecureString{secmem.NewSecureString("Tr0ub4dor"), secmem.NewSecureString("abc")}
+	got := SanitizeOutput("login Tr0ub4dor ok abc", secrets...)
+	if got != "login [REDACTED] ok abc" {
+		t.Fatalf("SanitizeOutput = %q", got)
+	}
+}
+
+func TestOutputStreamRedactsSecretSplitAcrossWrites(t *testing.T) {
+	var rec chunkRecorder
+	secrets := []*secmem.SecureString{secmem.NewSecureString("hunter2-pass")}
+	s := &outputStream{executionID: "x", emit: rec.record, redactor: newStreamRedactor(secrets)}
+
+	s.append("stdout", []byte("token=hunter"))
+	s.flushLocked(false)
+	s.flushLocked(false)
+	s.append("stdout", []byte("2-pass done"))
+	s.flushLocked(false)
+	s.flushLocked(true)
+	if out, _ := rec.streams(); out["stdout"] != "token=[REDACTED] done" {
+		t.Fatalf("streamed %q", out["stdout"])
+	}
+}
@@ -0,0 +1,70 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxSandboxMemoryMB caps the memory budget a sandbox may request.
+	MaxSandboxMemoryMB = 64 * 1024
+
+	// MaxSandboxProcesses caps the process budget a sandbox may request.
+	MaxSandboxProcesses = 4096
+)
+
+// Sandbox is an opt-in confinement profile for less-trusted scripts. On
+// Linux the script runs in private mount, PID, IPC and UTS namespaces with a
+// read-only view of the filesystem (its working directory and a private /tmp
+// stay writable), no capabilities, a seccomp deny-list for kernel-level
+// operations and, when set, cgroup v2 budgets. Other platforms refuse to run
+// sandboxed scripts rather than run them unconfined.
+type Sandbox struct {
+	// Network keeps the host network. Without it the script only has a
+	// private loopback interface.
+	Network bool `json:"network,omitempty"`
+	// MemoryMB is the memory budget in megabytes, swap excluded.
+	MemoryMB int `json:"memoryMb,omitempty"`
+	// CPUPercent is the CPU budget as a percentage of one core; 200 allows
+	// two full cores.
+	CPUPercent int `json:"cpuPercent,omitempty"`
+	// MaxProcesses caps the number of processes and threads.
+	MaxProcesses int `json:"maxProcesses,omitempty"`
+}
+
+// hasLimits reports whether the profile declares any cgroup budget.
+func (s *Sandbox) hasLimits() bool {
+	return s.MemoryMB > 0 || s.CPUPercent > 0 || s.MaxProcesses > 0
+}
+
+func (s *Sandbox) validate() error {
+	switch {
+	case s.MemoryMB < 0 || s.MemoryMB > MaxSandboxMemoryMB:
+		return fmt.Errorf("sandbox memory budget %dMB is out of range", s.MemoryMB)
+	case s.CPUPercent < 0 || s.CPUPercent > 100*1024:
+		return fmt.Errorf("sandbox CPU budget %d%% is out of range", s.CPUPercent)
+	case s.MaxProcesses < 0 || s.MaxProcesses > MaxSandboxProcesses:
+		return fmt.Errorf("sandbox process budget %d is out of range", s.MaxProcesses)
+	}
+	return nil
+}
+
+// validateSandbox checks a script's sandbox profile against the rest of the
+// execution. Switching users needs setuid, which the sandbox forbids.
+func validateSandbox(script ScriptExecution) error {
+	if script.Sandbox == nil {
+		return nil
+	}
+	if runAs := strings.TrimSpace(script.RunAs); runAs != "" && !strings.EqualFold(runAs, "system") {
+		return fmt.Errorf("runAs %q is not supported for sandboxed scripts", runAs)
+	}
+	return script.Sandbox.validate()
+}
+
+// LimitHit records a sandbox budget the script ran into. Count is the
+// number of times the kernel enforced it: OOM kills for memory, refused
+// forks for processes and throttled periods for CPU.
+type LimitHit struct {
+	Limit string `json:"limit"` // memory, processes or cpu
+	Count uint64 `json:"count"`
+}
@@ -0,0 +1,165 @@
+//go:build linux
+
+package executor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sandboxCgroupParent is the cgroup, directly below the cgroup v2 root,
+// holding one child cgroup per sandboxed execution with budgets.
+const sandboxCgroupParent = "breeze-sandbox"
+
+// sandboxCgroup is the cgroup of one sandboxed execution. dir is held open
+// so the script can be started directly inside it.
+type sandboxCgroup struct {
+	path string
+	dir  *os.File
+}
+
+// newSandboxCgroup creates a cgroup applying the profile's budgets. It fails
+// rather than run the script without the budgets it asked for.
+func newSandboxCgroup(name string, sb *Sandbox) (*sandboxCgroup, error) {
+	root, err := cgroup2Root()
+	if err != nil {
+		return nil, err
+	}
+
+	limits := map[string]string{}
+	var controllers []string
+	if sb.MemoryMB > 0 {
+		controllers = append(controllers, "memory")
+		limits["memory.max"] = strconv.FormatInt(int64(sb.MemoryMB)*1024*1024, 10)
+		limits["memory.swap.max"] = "0"
+	}
+	if sb.CPUPercent > 0 {
+		// The quota is per 100ms period, so 1% of a core is 1000us.
+		controllers = append(controllers, "cpu")
+		limits["cpu.max"] = fmt.Sprintf("%d 100000", sb.CPUPercent*1000)
+	}
+	if sb.MaxProcesses > 0 {
+		controllers = append(controllers, "pids")
+		limits["pids.max"] = strconv.Itoa(sb.MaxProcesses)
+	}
+
+	parent := filepath.Join(root, sandboxCgroupParent)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox cgroup: %w", err)
+	}
+	if err := enableControllers(root, parent, controllers); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(parent, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox cgroup: %w", err)
+	}
+	cg := &sandboxCgroup{path: path}
+	for file, value := range limits {
+		err := os.WriteFile(filepath.Join(path, file), []byte(value), 0644)
+		if err != nil && !(file == "memory.swap.max" && os.IsNotExist(err)) {
+			cg.remove()
+			return nil, fmt.Errorf("failed to set sandbox %s: %w", file, err)
+		}
+	}
+	if cg.dir, err = os.Open(path); err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("failed to open sandbox cgroup: %w", err)
+	}
+	return cg, nil
+}
+
+// cgroup2Root returns the mount point of the cgroup v2 hierarchy.
+func cgroup2Root() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", fmt.Errorf("failed to read mountinfo: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The filesystem type follows the "-" separator.
+		fields := strings.Fields(scanner.Text())
+		sep := slices.Index(fields, "-")
+		if sep >= 0 && sep+1 < len(fields) && fields[sep+1] == "cgroup2" {
+			return unescapeMountPath(fields[4]), nil
+		}
+	}
+	return "", fmt.Errorf("sandbox resource limits require cgroup v2")
+}
+
+// enableControllers delegates controllers from the root through parent to
+// the per-execution cgroups.
+func enableControllers(root, parent string, controllers []string) error {
+	for _, dir := range []string{root, parent} {
+		available, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+		if err != nil {
+			return fmt.Errorf("failed to read cgroup controllers: %w", err)
+		}
+		for _, c := range controllers {
+			if !slices.Contains(strings.Fields(string(available)), c) {
+				return fmt.Errorf("cgroup controller %s is not available for sandbox limits", c)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+c), 0644); err != nil {
+				return fmt.Errorf("failed to enable cgroup controller %s: %w", c, err)
+			}
+		}
+	}
+	return nil
+}
+
+// limitHits reads the cgroup's event counters.
+func (cg *sandboxCgroup) limitHits() []LimitHit {
+	var hits []LimitHit
+	for _, counter := range []struct{ limit, file, key string }{
+		{"memory", "memory.events", "oom_kill"},
+		{"processes", "pids.events", "max"},
+		{"cpu", "cpu.stat", "nr_throttled"},
+	} {
+		if n := readCgroupCounter(filepath.Join(cg.path, counter.file), counter.key); n > 0 {
+			hits = append(hits, LimitHit{Limit: counter.limit, Count: n})
+		}
+	}
+	return hits
+}
+
+// readCgroupCounter returns the value of key in a flat-keyed cgroup file,
+// or 0 if the file or key is missing.
+func readCgroupCounter(path, key string) uint64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, " "); ok && k == key {
+			n, _ := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// remove kills anything left in the cgroup and deletes it.
+func (cg *sandboxCgroup) remove() {
+	if cg.dir != nil {
+		cg.dir.Close()
+	}
+	// cgroup.kill needs Linux 5.14; on older kernels the process group kill
+	// has already reached everything that did not start a new session.
+	_ = os.WriteFile(filepath.Join(cg.path, "cgroup.kill"), []byte("1"), 0644)
+	var err error
+	for range 20 {
+		if err = os.Remove(cg.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	log.Warn("failed to remove sandbox cgroup", "path", cg.path, "error", err)
+}
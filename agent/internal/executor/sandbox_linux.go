@@ -0,0 +1,421 @@
+//go:build linux
+
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/breeze-rmm/agent/internal/config"
+)
+
+// sandboxInitArg0 marks a re-execution of the agent that sets up the
+// sandbox and then executes the script's interpreter.
+const sandboxInitArg0 = "breeze-sandbox-init"
+
+// The interpreter runs as nobody so that root-only files on the read-only
+// host filesystem, such as /etc/shadow and ssh keys, stay unreadable.
+const (
+	sandboxUID = 65534
+	sandboxGID = 65534
+)
+
+// sandboxConfig is passed from the agent to the sandbox init process.
+type sandboxConfig struct {
+	WorkDir string `json:"workDir"`
+	Script  string `json:"script"`
+	Network bool   `json:"network"`
+	TmpfsMB int    `json:"tmpfsMb"`
+	// Hide lists directories holding agent state, such as credentials and
+	// backup keys, that are covered with an empty tmpfs.
+	Hide []string `json:"hide,omitempty"`
+}
+
+// sandboxRun tracks the resources of one sandboxed execution.
+type sandboxRun struct {
+	cgroup *sandboxCgroup
+}
+
+// applySandbox rewrites cmd to start through the sandbox init process in
+// fresh namespaces and, if the profile sets budgets, a dedicated cgroup.
+// dataDir is the agent data directory, hidden from the script.
+// cmd must already have its SysProcAttr configured.
+func applySandbox(cmd *exec.Cmd, sb *Sandbox, workDir, scriptPath, dataDir string) (*sandboxRun, error) {
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	if err := seccompSupported(); err != nil {
+		return nil, err
+	}
+
+	tmpfsMB := 512
+	if sb.MemoryMB > 0 {
+		tmpfsMB = sb.MemoryMB
+	}
+	cfg, err := json.Marshal(sandboxConfig{
+		WorkDir: workDir,
+		Script:  scriptPath,
+		Network: sb.Network,
+		TmpfsMB: tmpfsMB,
+		Hide:    agentStateDirs(dataDir),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sandbox config: %w", err)
+	}
+
+	run := &sandboxRun{}
+	if sb.hasLimits() {
+		cg, err := newSandboxCgroup(filepath.Base(workDir), sb)
+		if err != nil {
+			return nil, err
+		}
+		run.cgroup = cg
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(cg.dir.Fd())
+	}
+
+	// The unprivileged interpreter must be able to read its script and
+	// write its working directory, including fetched attachments.
+	if err := chownTree(workDir, sandboxUID, sandboxGID); err != nil {
+		return nil, err
+	}
+	if err := os.Chown(scriptPath, sandboxUID, sandboxGID); err != nil {
+		return nil, fmt.Errorf("failed to hand script to sandbox user: %w", err)
+	}
+
+	cmd.Args = append([]string{sandboxInitArg0, string(cfg), cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	cmd.SysProcAttr.Cloneflags |= unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWIPC | unix.CLONE_NEWUTS
+	if !sb.Network {
+		cmd.SysProcAttr.Cloneflags |= unix.CLONE_NEWNET
+	}
+	return run, nil
+}
+
+// agentStateDirs returns the directories a sandboxed script must not read.
+// The defaults are listed even when configuration points elsewhere, since
+// an earlier install may have left state there.
+func agentStateDirs(dataDir string) []string {
+	var dirs []string
+	for _, dir := range []string{"/etc/breeze", "/var/lib/breeze", config.ConfigDir(), dataDir} {
+		if abs, err := filepath.Abs(dir); err == nil && !slices.Contains(dirs, abs) {
+			dirs = append(dirs, abs)
+		}
+	}
+	return dirs
+}
+
+// finish reports the budgets the script hit and releases its cgroup.
+func (r *sandboxRun) finish() []LimitHit {
+	if r == nil || r.cgroup == nil {
+		return nil
+	}
+	hits := r.cgroup.limitHits()
+	r.cgroup.remove()
+	return hits
+}
+
+// SandboxInit must be called at the start of main. When the process was
+// started as a sandbox init process it confines itself and executes the
+// script's interpreter, never returning; otherwise it returns immediately.
+func SandboxInit() {
+	if len(os.Args) < 4 || os.Args[0] != sandboxInitArg0 {
+		return
+	}
+	// Capabilities, no_new_privs and seccomp filters are per-thread; they
+	// carry over to the interpreter only from the thread calling execve.
+	runtime.LockOSThread()
+
+	var cfg sandboxConfig
+	if err := json.Unmarshal([]byte(os.Args[1]), &cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "breeze sandbox: invalid config: %v\n", err)
+		os.Exit(126)
+	}
+	if err := enterSandbox(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "breeze sandbox: %v\n", err)
+		os.Exit(126)
+	}
+	err := unix.Exec(os.Args[2], os.Args[3:], os.Environ())
+	fmt.Fprintf(os.Stderr, "breeze sandbox: exec %s: %v\n", os.Args[2], err)
+	os.Exit(127)
+}
+
+// enterSandbox runs in the init process, inside the new namespaces. The
+// order matters: paths that are about to be hidden are opened first,
+// privileges are dropped only once mounting is done, and seccomp comes
+// last because it blocks mount and setuid.
+func enterSandbox(cfg sandboxConfig) error {
+	script, err := os.OpenFile(cfg.Script, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open script: %w", err)
+	}
+	defer script.Close()
+	workDir, err := os.OpenFile(cfg.WorkDir, unix.O_PATH|unix.O_CLOEXEC|unix.O_DIRECTORY, 0)
+	if err != nil {
+		return fmt.Errorf("open working directory: %w", err)
+	}
+	defer workDir.Close()
+	devices := make(map[string]*os.File)
+	for _, name := range []string{"null", "zero", "full", "random", "urandom", "tty"} {
+		if f, err := os.OpenFile("/dev/"+name, unix.O_PATH|unix.O_CLOEXEC, 0); err == nil {
+			devices[name] = f
+			defer f.Close()
+		}
+	}
+
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	if err := remountAllReadOnly(); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+	if err := setupDev(devices); err != nil {
+		return err
+	}
+	tmpfsOpts := fmt.Sprintf("mode=1777,size=%dm", cfg.TmpfsMB)
+	for _, dir := range []string{"/tmp", "/var/tmp"} {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+		if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, tmpfsOpts); err != nil {
+			return fmt.Errorf("mount %s: %w", dir, err)
+		}
+	}
+	// The working directory usually lives under the data directory, so it
+	// is bound back in after the state directories are hidden.
+	for _, dir := range cfg.Hide {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+		if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=755,size=1m"); err != nil {
+			return fmt.Errorf("hide %s: %w", dir, err)
+		}
+	}
+	if err := bindFD(workDir, cfg.WorkDir, unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+		return err
+	}
+	if err := bindFD(script, cfg.Script, unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+		return err
+	}
+	if !cfg.Network {
+		// sysfs shows the network devices of the namespace it was mounted
+		// in, so a fresh one hides the host's interfaces.
+		if err := unix.Mount("sysfs", "/sys", "sysfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("mount /sys: %w", err)
+		}
+		if err := loopbackUp(); err != nil {
+			return err
+		}
+	}
+
+	// Entering the working directory first means it stays usable even when
+	// a parent directory is not searchable by the sandbox user.
+	if err := os.Chdir(cfg.WorkDir); err != nil {
+		return fmt.Errorf("enter working directory: %w", err)
+	}
+	if err := dropPrivileges(sandboxUID, sandboxGID); err != nil {
+		return err
+	}
+	return installSeccomp()
+}
+
+// remountAllReadOnly makes every mount visible in the namespace read-only,
+// nosuid and nodev, keeping each mount's other flags.
+func remountAllReadOnly() error {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return fmt.Errorf("read mountinfo: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		target := unescapeMountPath(fields[4])
+		flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV)
+		for _, opt := range strings.Split(fields[5], ",") {
+			flags |= mountOptionFlags[opt]
+		}
+		if err := unix.Mount("", target, "", flags, ""); err != nil && !errors.Is(err, unix.ENOENT) {
+			return fmt.Errorf("remount %s read-only: %w", target, err)
+		}
+	}
+	return nil
+}
+
+// mountOptionFlags maps per-mount options from mountinfo to the flags that
+// must be repeated when remounting.
+var mountOptionFlags = map[string]uintptr{
+	"noexec":      unix.MS_NOEXEC,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"strictatime": unix.MS_STRICTATIME,
+}
+
+// unescapeMountPath decodes the octal escapes mountinfo uses for spaces,
+// tabs, newlines and backslashes.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// setupDev replaces /dev with a tmpfs holding only harmless devices. Every
+// other mount is nodev, so block devices cannot be opened from anywhere.
+func setupDev(devices map[string]*os.File) error {
+	if err := unix.Mount("tmpfs", "/dev", "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, "mode=755,size=1m"); err != nil {
+		return fmt.Errorf("mount /dev: %w", err)
+	}
+	for name, f := range devices {
+		if err := bindFD(f, "/dev/"+name, unix.MS_NOSUID|unix.MS_NOEXEC); err != nil {
+			return err
+		}
+	}
+	for name, target := range map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(target, "/dev/"+name); err != nil {
+			return fmt.Errorf("create /dev/%s: %w", name, err)
+		}
+	}
+	if err := os.Mkdir("/dev/shm", 01777); err != nil {
+		return fmt.Errorf("create /dev/shm: %w", err)
+	}
+	if err := unix.Mount("tmpfs", "/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "mode=1777,size=64m"); err != nil {
+		return fmt.Errorf("mount /dev/shm: %w", err)
+	}
+	return nil
+}
+
+// bindFD bind-mounts the file or directory open as f onto target, creating
+// the mount point if a tmpfs now hides it, then applies flags.
+func bindFD(f *os.File, target string, flags uintptr) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", f.Name(), err)
+	}
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("create mount point %s: %w", target, err)
+		}
+		if fi.IsDir() {
+			err = os.Mkdir(target, 0700)
+		} else {
+			var mp *os.File
+			if mp, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+				mp.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("create mount point %s: %w", target, err)
+		}
+	}
+
+	source := "/proc/self/fd/" + strconv.Itoa(int(f.Fd()))
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", target, err)
+	}
+	if err := unix.Mount("", target, "", unix.MS_REMOUNT|unix.MS_BIND|flags, ""); err != nil {
+		return fmt.Errorf("remount %s: %w", target, err)
+	}
+	return nil
+}
+
+// loopbackUp brings up the loopback interface of a new network namespace.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("loopback socket: %w", err)
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return fmt.Errorf("loopback: %w", err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("loopback flags: %w", err)
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return fmt.Errorf("bring up loopback: %w", err)
+	}
+	return nil
+}
+
+// chownTree gives dir and everything below it to uid and gid.
+func chownTree(dir string, uid, gid int) error {
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hand working directory to sandbox user: %w", err)
+	}
+	return nil
+}
+
+// dropPrivileges switches to uid and gid with no supplementary groups and
+// empties every capability set. The bounding set has to be emptied while
+// CAP_SETPCAP is still held, and the ids switched while CAP_SETUID is.
+func dropPrivileges(uid, gid int) error {
+	last := 63
+	if data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap"); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			last = n
+		}
+	}
+	for c := 0; c <= last; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+			return fmt.Errorf("drop capability %d: %w", c, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+		return fmt.Errorf("clear ambient capabilities: %w", err)
+	}
+	if err := unix.Setgroups(nil); err != nil {
+		return fmt.Errorf("drop supplementary groups: %w", err)
+	}
+	if err := unix.Setresgid(gid, gid, gid); err != nil {
+		return fmt.Errorf("switch to gid %d: %w", gid, err)
+	}
+	if err := unix.Setresuid(uid, uid, uid); err != nil {
+		return fmt.Errorf("switch to uid %d: %w", uid, err)
+	}
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capset(&hdr, &data[0]); err != nil {
+		return fmt.Errorf("drop capabilities: %w", err)
+	}
+	return nil
+}
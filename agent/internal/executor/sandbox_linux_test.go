@@ -0,0 +1,201 @@
+//go:build linux
+
+package executor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runSeccompFilter evaluates the subset of classic BPF used by
+// buildSeccompFilter.
+func runSeccompFilter(t *testing.T, prog []unix.SockFilter, arch, nr uint32) uint32 {
+	t.Helper()
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		switch ins.Code {
+		case bpfLoadWord:
+			acc = map[uint32]uint32{seccompDataNr: nr, seccompDataArch: arch}[ins.K]
+		case bpfJumpEq, bpfJumpGE:
+			match := acc == ins.K
+			if ins.Code == bpfJumpGE {
+				match = acc >= ins.K
+			}
+			if match {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfReturn:
+			return ins.K
+		default:
+			t.Fatalf("unexpected opcode %#x", ins.Code)
+		}
+	}
+	t.Fatal("filter fell off the end")
+	return 0
+}
+
+func TestBuildSeccompFilter(t *testing.T) {
+	const arch = 0xc000003e
+	prog := buildSeccompFilter(arch, []uint32{165, 272, 308}, 0x40000000)
+	deny := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+
+	for _, tt := range []struct {
+		arch, nr, want uint32
+	}{
+		{arch, 165, deny},
+		{arch, 272, deny},
+		{arch, 308, deny},
+		{arch, 0, unix.SECCOMP_RET_ALLOW},
+		{arch, 59, unix.SECCOMP_RET_ALLOW},
+		{arch, 0x40000000 + 165, deny},
+		{0x40000003, 21, unix.SECCOMP_RET_KILL_PROCESS},
+	} {
+		if got := runSeccompFilter(t, prog, tt.arch, tt.nr); got != tt.want {
+			t.Errorf("arch %#x syscall %d: got %#x, want %#x", tt.arch, tt.nr, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	if got := unescapeMountPath(`/mnt/my\040disk\134x`); got != `/mnt/my disk\x` {
+		t.Fatalf("unescapeMountPath = %q", got)
+	}
+}
+
+func requireSandbox(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("sandbox requires root")
+	}
+	if err := seccompSupported(); err != nil {
+		t.Skip(err)
+	}
+}
+
+func TestExecuteSandboxed(t *testing.T) {
+	requireSandbox(t)
+
+	e := newTestExecutor()
+	result, err := e.Execute(ScriptExecution{
+		ID:         "exec-sandbox",
+		ScriptType: ScriptTypeBash,
+		Script: strings.Join([]string{
+			`touch /etc/breeze-sandbox-test 2>/dev/null && echo etc-writable`,
+			`echo data > out.txt && echo workdir-writable`,
+			`touch /tmp/scratch && echo tmp-writable`,
+			`ls /sys/class/net | tr '\n' ' '; echo`,
+			`grep CapEff /proc/self/status`,
+			`id -u`,
+			`cat /etc/shadow >/dev/null 2>&1 && echo shadow-readable`,
+			`echo "pid $$"`,
+			`ls /dev/sda /dev/mem 2>/dev/null | wc -l`,
+			`unshare -m true 2>/dev/null && echo unshare-allowed`,
+			`(exec 3<>/dev/tcp/1.1.1.1/53) 2>/dev/null && echo network-reachable`,
+			`exit 0`,
+		}, "\n"),
+		Timeout:   10,
+		Sandbox:   &Sandbox{},
+		Artifacts: []string{"out.txt"},
+		UploadArtifact: func(Artifact, io.Reader) error {
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Fatalf("exit code %d, stderr: %s", result.ExitCode, result.Stderr)
+	}
+	want := "workdir-writable\ntmp-writable\nlo \nCapEff:\t0000000000000000\n65534\npid 1\n0\n"
+	if result.Stdout != want {
+		t.Fatalf("unexpected sandbox view:\n%s\nwant:\n%s\nstderr: %s", result.Stdout, want, result.Stderr)
+	}
+	if len(result.Artifacts) != 1 || !result.Artifacts[0].Uploaded {
+		t.Fatalf("artifact written in the sandbox was not collected: %+v", result.Artifacts)
+	}
+	if _, err := os.Stat("/etc/breeze-sandbox-test"); err == nil {
+		os.Remove("/etc/breeze-sandbox-test")
+		t.Fatal("sandboxed script wrote to the host filesystem")
+	}
+}
+
+func TestExecuteSandboxedHidesAgentState(t *testing.T) {
+	requireSandbox(t)
+	// t.TempDir is under /tmp, which the sandbox replaces anyway.
+	dataDir, err := os.MkdirTemp(".", "testdata-state-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dataDir) })
+	if dataDir, err = filepath.Abs(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "backup.key"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := newTestExecutor()
+	e.dataDir = dataDir
+	result, err := e.Execute(ScriptExecution{
+		ID:         "exec-sandbox-hide",
+		ScriptType: ScriptTypeBash,
+		Script: strings.Join([]string{
+			`cat ` + filepath.Join(dataDir, "backup.key") + ` 2>/dev/null && echo data-readable`,
+			`ls -A /etc/breeze /var/lib/breeze 2>/dev/null | grep -v -e '^/' -e '^$' -e '^scripts$'`,
+			`echo data > out.txt && echo workdir-writable`,
+			`exit 0`,
+		}, "\n"),
+		Timeout: 10,
+		Sandbox: &Sandbox{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Stdout != "workdir-writable\n" {
+		t.Fatalf("agent state visible in the sandbox:\n%s\nstderr: %s", result.Stdout, result.Stderr)
+	}
+}
+
+func TestExecuteSandboxedMemoryLimit(t *testing.T) {
+	requireSandbox(t)
+	root, err := cgroup2Root()
+	if err != nil {
+		t.Skip(err)
+	}
+	if data, err := os.ReadFile(root + "/cgroup.controllers"); err != nil || !strings.Contains(string(data), "memory") {
+		t.Skip("cgroup v2 memory controller not available")
+	}
+
+	e := newTestExecutor()
+	result, err := e.Execute(ScriptExecution{
+		ID:         "exec-sandbox-oom",
+		ScriptType: ScriptTypeBash,
+		Script:     `x=$(head -c 200000000 /dev/zero | tr '\0' a); echo survived`,
+		Timeout:    30,
+		Sandbox:    &Sandbox{MemoryMB: 32},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.LimitHits) == 0 || result.LimitHits[0].Limit != "memory" {
+		t.Fatalf("expected a memory limit hit, got %+v (stdout %q)", result.LimitHits, result.Stdout)
+	}
+}
+
+func TestSandboxRejectsRunAs(t *testing.T) {
+	err := validateSandbox(ScriptExecution{RunAs: "alice", Sandbox: &Sandbox{}})
+	if err == nil || !strings.Contains(err.Error(), "not supported for sandboxed scripts") {
+		t.Fatalf("expected runAs to be rejected, got %v", err)
+	}
+	if err := validateSandbox(ScriptExecution{Sandbox: &Sandbox{MemoryMB: -1}}); err == nil {
+		t.Fatal("expected a negative budget to be rejected")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package executor
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+type sandboxRun struct{}
+
+// applySandbox refuses sandboxed scripts; running them unconfined would
+// defeat the purpose of asking for a sandbox.
+func applySandbox(_ *exec.Cmd, _ *Sandbox, _, _, _ string) (*sandboxRun, error) {
+	return nil, fmt.Errorf("sandboxed execution is not supported on %s", runtime.GOOS)
+}
+
+func (r *sandboxRun) finish() []LimitHit { return nil }
+
+// SandboxInit must be called at the start of main. Sandboxing is Linux-only,
+// so it does nothing here.
+func SandboxInit() {}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Classic BPF opcodes used by the seccomp filter.
+const (
+	bpfLoadWord = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+	bpfJumpEq   = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+	bpfJumpGE   = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+	bpfReturn   = unix.BPF_RET | unix.BPF_K
+
+	// Offsets into struct seccomp_data.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+)
+
+// seccompSupported reports whether a deny-list exists for this
+// architecture.
+func seccompSupported() error {
+	if seccompAuditArch == 0 {
+		return fmt.Errorf("sandboxed execution is not supported on this architecture")
+	}
+	return nil
+}
+
+// buildSeccompFilter returns a filter failing the denied syscalls with
+// EPERM. Syscalls from another ABI than arch, which could bypass the
+// deny-list, kill the process. Syscall numbers at or above abiLimit, if set,
+// also fail; on amd64 they select the x32 ABI.
+func buildSeccompFilter(arch uint32, denied []uint32, abiLimit uint32) []unix.SockFilter {
+	deny := uint32(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+	prog := []unix.SockFilter{
+		{Code: bpfLoadWord, K: seccompDataArch},
+		{Code: bpfJumpEq, Jt: 1, K: arch},
+		{Code: bpfReturn, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: bpfLoadWord, K: seccompDataNr},
+	}
+	// Each check jumps past the remaining checks and the allow to deny.
+	remaining := len(denied)
+	if abiLimit != 0 {
+		prog = append(prog, unix.SockFilter{Code: bpfJumpGE, Jt: uint8(remaining + 1), K: abiLimit})
+	}
+	for i, nr := range denied {
+		prog = append(prog, unix.SockFilter{Code: bpfJumpEq, Jt: uint8(remaining - i), K: nr})
+	}
+	return append(prog,
+		unix.SockFilter{Code: bpfReturn, K: unix.SECCOMP_RET_ALLOW},
+		unix.SockFilter{Code: bpfReturn, K: deny},
+	)
+}
+
+// installSeccomp sets no_new_privs and loads the deny-list for the calling
+// thread, which then passes it on through execve.
+func installSeccomp() error {
+	if err := seccompSupported(); err != nil {
+		return err
+	}
+	prog := buildSeccompFilter(seccompAuditArch, seccompDenied, seccompABILimit)
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	fprog := unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&fprog)), 0, 0); err != nil {
+		return fmt.Errorf("install seccomp filter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package executor
+
+import "golang.org/x/sys/unix"
+
+const (
+	seccompAuditArch uint32 = unix.AUDIT_ARCH_X86_64
+
+	// seccompABILimit is the first x32 syscall number. x32 shares the
+	// x86-64 audit arch, so it is refused by number.
+	seccompABILimit uint32 = 0x40000000
+)
@@ -0,0 +1,8 @@
+package executor
+
+import "golang.org/x/sys/unix"
+
+const (
+	seccompAuditArch uint32 = unix.AUDIT_ARCH_AARCH64
+	seccompABILimit  uint32 = 0
+)
@@ -0,0 +1,11 @@
+//go:build linux && !amd64 && !arm64
+
+package executor
+
+// No deny-list is maintained for this architecture, so sandboxed scripts
+// are refused.
+var (
+	seccompAuditArch uint32
+	seccompABILimit  uint32
+	seccompDenied    []uint32
+)
@@ -3,7 +3,11 @@ package executor
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/breeze-rmm/agent/internal/scriptast"
+	"github.com/breeze-rmm/agent/internal/secmem"
 )
 
 // SecurityLevel defines the level of security validation
@@ -12,186 +16,121 @@ type SecurityLevel int
 const (
 	// SecurityLevelNone disables security validation (not recommended)
 	SecurityLevelNone SecurityLevel = iota
-	// SecurityLevelBasic performs basic pattern matching
+	// SecurityLevelBasic blocks destructive operations
 	SecurityLevelBasic
-	// SecurityLevelStrict performs strict validation
+	// SecurityLevelStrict also blocks risky operations such as persistence,
+	// credential access and running downloaded code
 	SecurityLevelStrict
 )
 
-// SecurityValidator validates script content for potentially dangerous operations
-type SecurityValidator struct {
-	level    SecurityLevel
-	patterns []*dangerPattern
+// Severity ranks a security finding
+type Severity string
+
+const (
+	// SeverityCritical findings destroy systems or data and are blocked at
+	// SecurityLevelBasic and above
+	SeverityCritical Severity = "critical"
+	// SeverityHigh findings are risky operations blocked at SecurityLevelStrict
+	SeverityHigh Severity = "high"
+	// SeverityWarning findings, such as commands that cannot be resolved
+	// before the script runs, are reported but never block
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a policy rule matched by a script
+type Finding struct {
+	Rule        string   `json:"rule"`
+	Description string   `json:"description"`
+	Severity    Severity `json:"severity"`
+	Line        int      `json:"line"`
+	Column      int      `json:"column"`
+	// Command is the resolved command that matched, if any
+	Command string `json:"command,omitempty"`
+	// Blocked reports whether the finding stops execution at the
+	// validator's level
+	Blocked bool `json:"blocked"`
 }
 
-type dangerPattern struct {
-	regex       *regexp.Regexp
-	description string
-	level       SecurityLevel
+func (f Finding) String() string {
+	return fmt.Sprintf("%s at line %d, column %d (%s)", f.Description, f.Line, f.Column, f.Rule)
+}
+
+// SecurityValidator checks scripts for potentially dangerous operations.
+// Shell, PowerShell and batch scripts are parsed so policy applies to the
+// commands they actually run, after quoting, aliases, wrappers such as sudo
+// and literal nested code have been resolved.
+type SecurityValidator struct {
+	level SecurityLevel
 }
 
 // NewSecurityValidator creates a new security validator with the specified level
 func NewSecurityValidator(level SecurityLevel) *SecurityValidator {
-	v := &SecurityValidator{
-		level:    level,
-		patterns: make([]*dangerPattern, 0),
-	}
-	v.initPatterns()
-	return v
+	return &SecurityValidator{level: level}
 }
 
-// initPatterns initializes the dangerous pattern list
-func (v *SecurityValidator) initPatterns() {
-	// Basic level patterns - clearly dangerous operations
-	basicPatterns := []struct {
-		pattern string
-		desc    string
-	}{
-		// Unix dangerous patterns
-		{`rm\s+-[rR]f?\s+/\s*$`, "recursive delete on root directory"},
-		{`rm\s+-[rR]f?\s+/\*`, "recursive delete on root wildcard"},
-		{`rm\s+-[rR]f?\s+/[a-z]+\s*$`, "recursive delete on system directory"},
-		{`mkfs\s+`, "filesystem format command"},
-		{`dd\s+.*of=/dev/[hs]d`, "direct disk write to block device"},
-		{`>\s*/dev/[hs]d`, "redirect to block device"},
-		{`chmod\s+-[rR]\s+[0-7]*777\s+/`, "dangerous recursive chmod on root"},
-		{`chown\s+-[rR]\s+.*\s+/\s*$`, "dangerous recursive chown on root"},
-		{`:\s*\(\s*\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`, "fork bomb pattern"},
-		{`/dev/null\s*>\s*/etc/passwd`, "attempt to destroy passwd file"},
-		{`echo\s+.*>\s*/etc/shadow`, "attempt to modify shadow file"},
-
-		// Windows dangerous patterns
-		{`format\s+[a-zA-Z]:`, "disk format command"},
-		{`del\s+/[fFsS]\s+[a-zA-Z]:\\Windows`, "Windows system file deletion"},
-		{`rd\s+/[sS]\s+/[qQ]\s+[a-zA-Z]:\\Windows`, "Windows directory deletion"},
-		{`rd\s+/[sS]\s+/[qQ]\s+[a-zA-Z]:\\Program`, "Program Files deletion"},
-		{`attrib\s+.*[a-zA-Z]:\\Windows`, "modify Windows file attributes"},
-
-		// PowerShell dangerous patterns
-		{`Remove-Item\s+-Recurse\s+-Force\s+[A-Z]:\\Windows`, "PowerShell Windows deletion"},
-		{`Remove-Item\s+-Recurse\s+-Force\s+/`, "PowerShell root deletion"},
-		{`Format-Volume`, "PowerShell volume format"},
-		{`Clear-Disk`, "PowerShell disk clear"},
-		{`Initialize-Disk`, "PowerShell disk initialize"},
-	}
-
-	// Strict level patterns - potentially risky operations
-	strictPatterns := []struct {
-		pattern string
-		desc    string
-	}{
-		// Network exfiltration patterns
-		{`curl\s+.*\|\s*bash`, "remote code execution via curl"},
-		{`wget\s+.*\|\s*bash`, "remote code execution via wget"},
-		{`curl\s+.*\|\s*sh`, "remote code execution via curl"},
-		{`wget\s+.*\|\s*sh`, "remote code execution via wget"},
-		{`Invoke-WebRequest.*\|\s*Invoke-Expression`, "PowerShell remote execution"},
-		{`IEX\s*\(\s*\(New-Object`, "PowerShell download cradle"},
-		{`DownloadString\s*\(`, "PowerShell download string"},
-
-		// Credential access patterns
-		{`mimikatz`, "credential dumping tool"},
-		{`sekurlsa`, "credential extraction"},
-		{`lsadump`, "LSA dump"},
-		{`Get-Credential`, "PowerShell credential prompt"},
-		{`ConvertTo-SecureString`, "PowerShell secure string (may be legitimate)"},
-
-		// Persistence patterns
-		{`schtasks\s+/create`, "scheduled task creation"},
-		{`at\s+\d+:\d+`, "at job creation"},
-		{`crontab\s+-[el]`, "crontab modification"},
-		{`Register-ScheduledTask`, "PowerShell scheduled task"},
-		{`New-Service`, "PowerShell service creation"},
-
-		// Privilege escalation patterns
-		{`setuid`, "setuid manipulation"},
-		{`setgid`, "setgid manipulation"},
-		{`chmod\s+[0-7]*[4-7][0-7]{2}`, "setuid/setgid chmod"},
-
-		// Registry modification (Windows)
-		{`reg\s+add\s+HKLM`, "HKLM registry modification"},
-		{`Set-ItemProperty\s+.*HKLM`, "PowerShell HKLM modification"},
-		{`New-ItemProperty\s+.*HKLM`, "PowerShell HKLM property creation"},
-
-		// System modification
-		{`visudo`, "sudoers modification"},
-		{`/etc/sudoers`, "sudoers file access"},
-		{`passwd\s+-d`, "password removal"},
-		{`usermod\s+-[aG].*sudo`, "sudo group modification"},
-		{`net\s+localgroup\s+administrators`, "Windows admin group modification"},
-	}
-
-	// Add basic patterns
-	for _, p := range basicPatterns {
-		regex, err := regexp.Compile("(?i)" + p.pattern)
-		if err != nil {
-			log.Warn("failed to compile security pattern", "pattern", p.pattern, "error", err)
-			continue
-		}
-		v.patterns = append(v.patterns, &dangerPattern{
-			regex:       regex,
-			description: p.desc,
-			level:       SecurityLevelBasic,
-		})
-	}
-
-	// Add strict patterns
-	for _, p := range strictPatterns {
-		regex, err := regexp.Compile("(?i)" + p.pattern)
-		if err != nil {
-			log.Warn("failed to compile security pattern", "pattern", p.pattern, "error", err)
-			continue
-		}
-		v.patterns = append(v.patterns, &dangerPattern{
-			regex:       regex,
-			description: p.desc,
-			level:       SecurityLevelStrict,
-		})
+// blocks reports whether f stops execution at the validator's level
+func (v *SecurityValidator) blocks(f Finding) bool {
+	switch f.Severity {
+	case SeverityCritical:
+		return v.level >= SecurityLevelBasic
+	case SeverityHigh:
+		return v.level >= SecurityLevelStrict
 	}
+	return false
 }
 
-// Validate checks the script content for dangerous patterns
-func (v *SecurityValidator) Validate(content string) error {
-	if v.level == SecurityLevelNone {
-		return nil
-	}
-
-	// Check each pattern
-	for _, p := range v.patterns {
-		if p.level > v.level {
-			continue
-		}
-
-		if p.regex.MatchString(content) {
-			return fmt.Errorf("potentially dangerous pattern detected: %s", p.description)
+// Validate returns an error describing the first finding that blocks the
+// script at the validator's level
+func (v *SecurityValidator) Validate(scriptType, content string) error {
+	for _, f := range v.ValidateWithDetails(scriptType, content) {
+		if f.Blocked {
+			return fmt.Errorf("potentially dangerous command: %s", f)
 		}
 	}
-
 	return nil
 }
 
-// ValidateWithDetails returns all matching dangerous patterns
-func (v *SecurityValidator) ValidateWithDetails(content string) []string {
+// ValidateWithDetails returns every finding in the script in source order,
+// including those that do not block at the validator's level
+func (v *SecurityValidator) ValidateWithDetails(scriptType, content string) []Finding {
 	if v.level == SecurityLevelNone {
 		return nil
 	}
 
-	var matches []string
-	for _, p := range v.patterns {
-		if p.level > v.level {
-			continue
+	var findings []Finding
+	if lang, ok := scriptLanguage(scriptType); ok {
+		findings = analyzeScript(scriptast.Parse(lang, content))
+	} else {
+		findings = matchTextRules(content)
+	}
+	for i := range findings {
+		findings[i].Blocked = v.blocks(findings[i])
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
 		}
+		return findings[i].Column < findings[j].Column
+	})
+	return findings
+}
 
-		if p.regex.MatchString(content) {
-			matches = append(matches, p.description)
-		}
+// scriptLanguage maps a script type to the parser for it
+func scriptLanguage(scriptType string) (string, bool) {
+	switch strings.ToLower(scriptType) {
+	case ScriptTypeBash:
+		return scriptast.Shell, true
+	case ScriptTypePowerShell:
+		return scriptast.PowerShell, true
+	case ScriptTypeCMD:
+		return scriptast.Batch, true
 	}
-
-	return matches
+	return "", false
 }
 
-// SanitizeOutput removes potentially sensitive information from script output
-func SanitizeOutput(output string) string {
+// SanitizeOutput removes potentially sensitive information from script output,
+// including any occurrence of the given secret values
+func SanitizeOutput(output string, secrets ...*secmem.SecureString) string {
 	// Patterns to redact
 	redactPatterns := []struct {
 		regex       *regexp.Regexp
@@ -211,7 +150,7 @@ func SanitizeOutput(output string) string {
 		{regexp.MustCompile(`eyJ[a-zA-Z0-9_-]*\.eyJ[a-zA-Z0-9_-]*\.[a-zA-Z0-9_-]*`), "[JWT_REDACTED]"},
 	}
 
-	result := output
+	result := redactSecrets(output, secrets)
 	for _, p := range redactPatterns {
 		result = p.regex.ReplaceAllString(result, p.replacement)
 	}
@@ -0,0 +1,656 @@
+package executor
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/breeze-rmm/agent/internal/scriptast"
+)
+
+// commandRule flags commands by what they do rather than how they are
+// written
+type commandRule struct {
+	id          string
+	description string
+	severity    Severity
+	match       func(c *scriptast.Command) bool
+}
+
+var commandRules = []commandRule{
+	// Destructive operations
+	{"recursive-delete-system", "recursive delete of a system directory", SeverityCritical, recursiveDeleteSystem},
+	{"delete-windows-system-files", "deletion of Windows system files", SeverityCritical, deleteWindowsSystemFiles},
+	{"filesystem-format", "filesystem format command", SeverityCritical, filesystemFormat},
+	{"disk-clear", "disk clear or initialize", SeverityCritical, commandIs("clear-disk", "initialize-disk")},
+	{"block-device-write", "direct write to a block device", SeverityCritical, blockDeviceWrite},
+	{"recursive-permission-system", "recursive permission change on a system directory", SeverityCritical, recursivePermissionSystem},
+	{"windows-attributes", "attribute change on Windows system files", SeverityCritical, windowsAttributes},
+	{"fork-bomb", "fork bomb", SeverityCritical, forkBomb},
+	{"account-database-write", "write to the account database", SeverityCritical, writesTo(accountDatabase)},
+
+	// Risky operations
+	{"remote-code-execution", "execution of downloaded code", SeverityHigh, remoteCodeExecution},
+	{"credential-dumping", "credential dumping", SeverityHigh, credentialDumping},
+	{"credential-prompt", "interactive credential prompt", SeverityHigh, commandIs("get-credential")},
+	{"scheduled-task", "scheduled task creation", SeverityHigh, scheduledTask},
+	{"cron-job", "cron job installation", SeverityHigh, cronJob},
+	{"service-creation", "service creation", SeverityHigh, serviceCreation},
+	{"setuid-bit", "setuid/setgid chmod", SeverityHigh, setuidBit},
+	{"registry-hklm", "HKLM registry modification", SeverityHigh, registryHKLM},
+	{"sudoers-modification", "sudoers modification", SeverityHigh, sudoersModification},
+	{"password-removal", "password removal", SeverityHigh, passwordRemoval},
+	{"sudo-group-membership", "addition to a sudo group", SeverityHigh, sudoGroupMembership},
+	{"admin-group-membership", "addition to the Windows administrators group", SeverityHigh, adminGroupMembership},
+
+	// Constructs that cannot be checked before the script runs
+	{"plaintext-secure-string", "secure string created from plain text", SeverityWarning, plaintextSecureString},
+	{"dynamic-command", "command name only known at run time", SeverityWarning, func(c *scriptast.Command) bool { return c.Dynamic }},
+	{"dynamic-code", "evaluation of code only known at run time", SeverityWarning, dynamicCode},
+}
+
+// methodRules flag .NET methods called from PowerShell
+var methodRules = map[string]commandRule{
+	"downloadstring": {id: "download-string", description: "PowerShell download string", severity: SeverityHigh},
+	"downloaddata":   {id: "download-string", description: "PowerShell download string", severity: SeverityHigh},
+}
+
+// analyzeScript applies policy to a parsed script
+func analyzeScript(script *scriptast.Script) []Finding {
+	var findings []Finding
+	for _, c := range script.Commands {
+		for _, rule := range commandRules {
+			if rule.match(c) {
+				findings = append(findings, Finding{
+					Rule:        rule.id,
+					Description: rule.description,
+					Severity:    rule.severity,
+					Line:        c.Pos.Line,
+					Column:      c.Pos.Column,
+					Command:     c.Name,
+				})
+			}
+		}
+	}
+	for _, m := range script.Methods {
+		if rule, ok := methodRules[strings.ToLower(m.Text)]; ok {
+			findings = append(findings, Finding{
+				Rule:        rule.id,
+				Description: rule.description,
+				Severity:    rule.severity,
+				Line:        m.Pos.Line,
+				Column:      m.Pos.Column,
+			})
+		}
+	}
+	for _, e := range script.Errors {
+		findings = append(findings, Finding{
+			Rule:        "parse-error",
+			Description: "script could not be fully analyzed: " + e.Message,
+			Severity:    SeverityWarning,
+			Line:        e.Pos.Line,
+			Column:      e.Pos.Column,
+		})
+	}
+	return findings
+}
+
+// cmdName returns the lower-cased command name
+func cmdName(c *scriptast.Command) string {
+	return strings.ToLower(c.Name)
+}
+
+func commandIs(names ...string) func(c *scriptast.Command) bool {
+	return func(c *scriptast.Command) bool {
+		n := cmdName(c)
+		for _, want := range names {
+			if n == want {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// literalArgs returns the text of the arguments known before run time
+func literalArgs(c *scriptast.Command) []string {
+	var args []string
+	for _, a := range c.Args {
+		if !a.Dynamic {
+			args = append(args, a.Text)
+		}
+	}
+	return args
+}
+
+// switchArgs splits Windows-style switches such as /s/q into lower-cased
+// names, returning them with the remaining literal arguments
+func switchArgs(c *scriptast.Command) (switches map[string]bool, operands []string) {
+	switches = map[string]bool{}
+	for _, a := range literalArgs(c) {
+		if strings.HasPrefix(a, "/") && !strings.Contains(a, `\`) {
+			for _, s := range strings.Split(a[1:], "/") {
+				switches[strings.ToLower(s)] = true
+			}
+			continue
+		}
+		operands = append(operands, a)
+	}
+	return switches, operands
+}
+
+// psParam reports whether c has a PowerShell parameter that abbreviates
+// full to at least min characters
+func psParam(c *scriptast.Command, full string, min int) bool {
+	for _, a := range literalArgs(c) {
+		if len(a) < 2 || a[0] != '-' {
+			continue
+		}
+		p := strings.ToLower(a[1:])
+		if len(p) >= min && strings.HasPrefix(full, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// operands returns literal arguments that are not options
+func operands(c *scriptast.Command) []string {
+	var ops []string
+	for _, w := range c.Operands() {
+		if !w.Dynamic {
+			ops = append(ops, w.Text)
+		}
+	}
+	return ops
+}
+
+func anyOperand(c *scriptast.Command, match func(string) bool) bool {
+	for _, op := range operands(c) {
+		if match(op) {
+			return true
+		}
+	}
+	return false
+}
+
+var unixSystemDirs = map[string]bool{
+	"/": true, "/bin": true, "/boot": true, "/dev": true, "/etc": true,
+	"/home": true, "/lib": true, "/lib32": true, "/lib64": true, "/opt": true,
+	"/proc": true, "/root": true, "/sbin": true, "/srv": true, "/sys": true,
+	"/usr": true, "/usr/bin": true, "/usr/lib": true, "/usr/local": true,
+	"/usr/sbin": true, "/var": true, "/var/lib": true,
+	"/Applications": true, "/Library": true, "/System": true, "/Users": true,
+	"/private": true,
+}
+
+// unixSystemDir reports whether p is a top-level system directory or all
+// of its contents
+func unixSystemDir(p string) bool {
+	if !strings.HasPrefix(p, "/") {
+		return false
+	}
+	return unixSystemDirs[path.Clean(strings.TrimRight(p, "*"))]
+}
+
+var windowsSystemDirs = map[string]bool{
+	`c:`: true, `c:\windows`: true, `c:\program files`: true,
+	`c:\program files (x86)`: true, `c:\programdata`: true, `c:\users`: true,
+}
+
+// windowsPath lower-cases p with backslashes and the drive letter as c:
+func windowsPath(p string) (string, bool) {
+	p = strings.ToLower(strings.ReplaceAll(p, "/", `\`))
+	p = strings.TrimPrefix(p, `filesystem::`)
+	if len(p) < 2 || p[1] != ':' || p[0] < 'a' || p[0] > 'z' {
+		return "", false
+	}
+	return "c" + p[1:], true
+}
+
+// windowsSystemDir reports whether p is a Windows system directory or its
+// contents, or anything under System32
+func windowsSystemDir(p string) bool {
+	p, ok := windowsPath(p)
+	if !ok {
+		return false
+	}
+	p = strings.TrimRight(p, `\*.`)
+	if windowsSystemDirs[p] {
+		return true
+	}
+	for _, dir := range []string{`c:\windows\system32`, `c:\windows\syswow64`} {
+		if p == dir || strings.HasPrefix(p, dir+`\`) {
+			return true
+		}
+	}
+	return false
+}
+
+func systemDir(p string) bool {
+	return unixSystemDir(p) || windowsSystemDir(p)
+}
+
+func recursiveDeleteSystem(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "rm":
+		if c.HasLongFlag("--no-preserve-root") {
+			return true
+		}
+		recursive := c.HasShortFlag('r') || c.HasShortFlag('R') || c.HasLongFlag("--recursive")
+		return recursive && anyOperand(c, unixSystemDir)
+	case "rd", "rmdir":
+		switches, ops := switchArgs(c)
+		if !switches["s"] {
+			return false
+		}
+		for _, op := range ops {
+			if windowsSystemDir(op) {
+				return true
+			}
+		}
+	case "remove-item":
+		return psParam(c, "recurse", 1) && anyOperand(c, systemDir)
+	}
+	return false
+}
+
+func deleteWindowsSystemFiles(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "del", "erase":
+		_, ops := switchArgs(c)
+		for _, op := range ops {
+			if windowsSystemDir(op) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var driveLetter = regexp.MustCompile(`^[A-Za-z]:\\?$`)
+
+func filesystemFormat(c *scriptast.Command) bool {
+	switch n := cmdName(c); {
+	case n == "mkfs" || strings.HasPrefix(n, "mkfs.") || n == "mke2fs" || n == "mkswap" || n == "wipefs" || n == "newfs":
+		return true
+	case n == "format":
+		_, ops := switchArgs(c)
+		for _, op := range ops {
+			if driveLetter.MatchString(op) {
+				return true
+			}
+		}
+	case n == "format-volume":
+		return true
+	case n == "diskutil":
+		ops := operands(c)
+		return len(ops) > 0 && (strings.HasPrefix(strings.ToLower(ops[0]), "erase") || strings.EqualFold(ops[0], "zeroDisk") || strings.EqualFold(ops[0], "secureErase"))
+	}
+	return false
+}
+
+var blockDevicePath = regexp.MustCompile(`^/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk|rdisk|md|dm-|mapper/)|^\\\\\.\\physicaldrive`)
+
+func blockDevice(p string) bool {
+	return blockDevicePath.MatchString(strings.ToLower(p))
+}
+
+func blockDeviceWrite(c *scriptast.Command) bool {
+	if writesTo(blockDevice)(c) {
+		return true
+	}
+	if cmdName(c) == "shred" {
+		return anyOperand(c, blockDevice)
+	}
+	return false
+}
+
+// writesTo returns a matcher for commands writing to a file matching
+// target, by redirection or as the destination of common file commands
+func writesTo(target func(string) bool) func(c *scriptast.Command) bool {
+	return func(c *scriptast.Command) bool {
+		for _, r := range c.Redirects {
+			if strings.Contains(r.Op, ">") && !r.Target.Dynamic && target(r.Target.Text) {
+				return true
+			}
+		}
+		switch cmdName(c) {
+		case "tee":
+			return anyOperand(c, target)
+		case "cp", "mv", "install", "ln":
+			ops := operands(c)
+			return len(ops) > 1 && target(ops[len(ops)-1])
+		case "dd":
+			for _, a := range literalArgs(c) {
+				if of, ok := strings.CutPrefix(a, "of="); ok && target(of) {
+					return true
+				}
+			}
+		case "sed":
+			return (c.HasShortFlag('i') || c.HasLongFlag("--in-place")) && anyOperand(c, target)
+		}
+		return false
+	}
+}
+
+func accountDatabase(p string) bool {
+	switch p {
+	case "/etc/passwd", "/etc/shadow", "/etc/group", "/etc/gshadow":
+		return true
+	}
+	return false
+}
+
+func recursivePermissionSystem(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "chmod", "chown", "chgrp":
+		recursive := c.HasShortFlag('R') || c.HasLongFlag("--recursive")
+		return recursive && anyOperand(c, unixSystemDir)
+	}
+	return false
+}
+
+func windowsAttributes(c *scriptast.Command) bool {
+	if cmdName(c) != "attrib" {
+		return false
+	}
+	_, ops := switchArgs(c)
+	for _, op := range ops {
+		if windowsSystemDir(op) {
+			return true
+		}
+	}
+	return false
+}
+
+// forkBomb matches a function piping into itself, as in :(){ :|:& };:
+func forkBomb(c *scriptast.Command) bool {
+	return c.Function != "" && c.Name == c.Function && c.PipedFrom != nil && c.PipedFrom.Name == c.Function
+}
+
+var downloaders = map[string]bool{
+	"curl": true, "wget": true, "fetch": true, "invoke-webrequest": true,
+	"invoke-restmethod": true, "start-bitstransfer": true,
+}
+
+// interpreters run code read from their input or arguments
+var interpreters = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true,
+	"python": true, "python3": true, "perl": true, "ruby": true, "php": true,
+	"node": true, "eval": true, "source": true, ".": true,
+	"invoke-expression": true, "powershell": true, "pwsh": true,
+}
+
+// downloads reports whether c fetches remote content
+func downloads(c *scriptast.Command) bool {
+	if downloaders[cmdName(c)] {
+		return true
+	}
+	return cmdName(c) == "new-object" && anyOperand(c, func(op string) bool {
+		return strings.Contains(strings.ToLower(op), "webclient")
+	})
+}
+
+func remoteCodeExecution(c *scriptast.Command) bool {
+	if !interpreters[cmdName(c)] {
+		return false
+	}
+	for from := c.PipedFrom; from != nil; from = from.PipedFrom {
+		if downloads(from) {
+			return true
+		}
+	}
+	for _, a := range c.Args {
+		for _, sub := range a.Commands {
+			if downloads(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var credentialTools = []string{"mimikatz", "sekurlsa", "lsadump"}
+
+// outputCommands only print their arguments
+var outputCommands = map[string]bool{
+	"echo": true, "printf": true, "write-host": true, "write-output": true,
+	"write-verbose": true, "write-warning": true, "write-error": true,
+	"write-information": true, "write-debug": true, "out-host": true,
+}
+
+func credentialDumping(c *scriptast.Command) bool {
+	n := cmdName(c)
+	if outputCommands[n] {
+		return false
+	}
+	words := append([]string{n}, literalArgs(c)...)
+	for _, w := range words {
+		lower := strings.ToLower(w)
+		for _, tool := range credentialTools {
+			if strings.Contains(lower, tool) {
+				return true
+			}
+		}
+	}
+	joined := strings.ToLower(strings.Join(words, " "))
+	switch n {
+	case "procdump", "procdump64":
+		return strings.Contains(joined, "lsass")
+	case "rundll32":
+		return strings.Contains(joined, "comsvcs") && strings.Contains(joined, "minidump")
+	case "reg":
+		ops := operands(c)
+		if len(ops) > 1 && strings.EqualFold(ops[0], "save") {
+			key := strings.ToLower(ops[1])
+			return strings.HasSuffix(key, `\sam`) || strings.HasSuffix(key, `\security`)
+		}
+	}
+	return false
+}
+
+func plaintextSecureString(c *scriptast.Command) bool {
+	return cmdName(c) == "convertto-securestring" && psParam(c, "asplaintext", 2)
+}
+
+func scheduledTask(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "schtasks":
+		switches, _ := switchArgs(c)
+		return switches["create"]
+	case "at":
+		return len(c.Args) > 0
+	case "register-scheduledtask":
+		return true
+	}
+	return false
+}
+
+func cronPath(p string) bool {
+	return strings.HasPrefix(p, "/etc/cron") || strings.HasPrefix(p, "/var/spool/cron")
+}
+
+func cronJob(c *scriptast.Command) bool {
+	if cmdName(c) == "crontab" {
+		// Listing and removal do not install jobs.
+		return !c.HasShortFlag('l') && !c.HasShortFlag('r')
+	}
+	return writesTo(cronPath)(c)
+}
+
+func serviceCreation(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "new-service":
+		return true
+	case "sc":
+		ops := operands(c)
+		return len(ops) > 0 && strings.EqualFold(ops[0], "create") ||
+			len(ops) > 1 && strings.EqualFold(ops[1], "create")
+	}
+	return false
+}
+
+var numericSetuid = regexp.MustCompile(`^[0-7]?[2-7][0-7]{3}$`)
+
+// setuidBit matches chmod setting the setuid or setgid bit, numerically as
+// in 4755 or symbolically as in u+s
+func setuidBit(c *scriptast.Command) bool {
+	if cmdName(c) != "chmod" {
+		return false
+	}
+	for _, a := range literalArgs(c) {
+		if numericSetuid.MatchString(a) {
+			return true
+		}
+		for _, clause := range strings.Split(a, ",") {
+			if i := strings.IndexAny(clause, "+="); i >= 0 && strings.ContainsRune(clause[i:], 's') &&
+				strings.Trim(clause[:i], "ugoa") == "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hklmKey(p string) bool {
+	p = strings.ToLower(strings.TrimPrefix(strings.ToLower(p), "registry::"))
+	return strings.HasPrefix(p, "hklm") || strings.HasPrefix(p, "hkey_local_machine")
+}
+
+func registryHKLM(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "reg":
+		ops := operands(c)
+		if len(ops) < 2 {
+			return false
+		}
+		switch strings.ToLower(ops[0]) {
+		case "add", "delete", "import", "restore", "load", "copy":
+			return hklmKey(ops[1])
+		}
+	case "set-itemproperty", "new-itemproperty", "remove-itemproperty", "new-item", "set-item", "remove-item":
+		return anyOperand(c, hklmKey)
+	}
+	return false
+}
+
+func sudoersPath(p string) bool {
+	return strings.HasPrefix(p, "/etc/sudoers")
+}
+
+func sudoersModification(c *scriptast.Command) bool {
+	return cmdName(c) == "visudo" || writesTo(sudoersPath)(c)
+}
+
+func passwordRemoval(c *scriptast.Command) bool {
+	return cmdName(c) == "passwd" && (c.HasShortFlag('d') || c.HasLongFlag("--delete"))
+}
+
+var sudoGroups = map[string]bool{"sudo": true, "wheel": true, "admin": true}
+
+func privilegedGroupList(list string) bool {
+	for _, g := range strings.Split(list, ",") {
+		if sudoGroups[strings.ToLower(g)] {
+			return true
+		}
+	}
+	return false
+}
+
+func sudoGroupMembership(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "usermod":
+		return (c.HasShortFlag('G') || c.HasLongFlag("--groups")) && anyOperand(c, privilegedGroupList)
+	case "gpasswd":
+		return (c.HasShortFlag('a') || c.HasShortFlag('M')) && anyOperand(c, privilegedGroupList)
+	case "adduser", "addgroup":
+		ops := operands(c)
+		return len(ops) == 2 && privilegedGroupList(ops[1])
+	case "dseditgroup":
+		return anyOperand(c, privilegedGroupList) && c.HasShortFlag('a')
+	}
+	return false
+}
+
+func adminGroupMembership(c *scriptast.Command) bool {
+	switch cmdName(c) {
+	case "net", "net1":
+		switches, ops := switchArgs(c)
+		if !switches["add"] || len(ops) < 2 {
+			return false
+		}
+		group := strings.ToLower(ops[1])
+		return strings.EqualFold(ops[0], "localgroup") && group == "administrators" ||
+			strings.EqualFold(ops[0], "group") && (group == "domain admins" || group == "enterprise admins")
+	case "add-localgroupmember":
+		return anyOperand(c, func(op string) bool { return strings.EqualFold(op, "administrators") })
+	}
+	return false
+}
+
+func dynamicCode(c *scriptast.Command) bool {
+	if remoteCodeExecution(c) {
+		return false
+	}
+	_, code, ok := c.EmbeddedCode()
+	if !ok {
+		return false
+	}
+	for _, w := range code {
+		if w.Dynamic {
+			return true
+		}
+	}
+	return false
+}
+
+// textRule is a line pattern used for languages without a parser
+type textRule struct {
+	id          string
+	pattern     *regexp.Regexp
+	description string
+	severity    Severity
+}
+
+var textRules = []textRule{
+	{"recursive-delete-system", regexp.MustCompile(`(?i)rm\s+-[rR]f?\s+/([a-z]+|\*)?(\s|["']|$)`), "recursive delete of a system directory", SeverityCritical},
+	{"filesystem-format", regexp.MustCompile(`(?i)mkfs(\.\w+)?\s+`), "filesystem format command", SeverityCritical},
+	{"block-device-write", regexp.MustCompile(`(?i)dd\s+.*of=/dev/[hs]d`), "direct write to a block device", SeverityCritical},
+	{"block-device-write", regexp.MustCompile(`>\s*/dev/[hs]d`), "direct write to a block device", SeverityCritical},
+	{"fork-bomb", regexp.MustCompile(`:\s*\(\s*\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`), "fork bomb", SeverityCritical},
+	{"account-database-write", regexp.MustCompile(`>\s*/etc/(passwd|shadow)`), "write to the account database", SeverityCritical},
+	{"filesystem-format", regexp.MustCompile(`(?i)format\s+[a-z]:`), "filesystem format command", SeverityCritical},
+	{"remote-code-execution", regexp.MustCompile(`(?i)(curl|wget)\s+.*\|\s*(ba)?sh`), "execution of downloaded code", SeverityHigh},
+	{"credential-dumping", regexp.MustCompile(`(?i)mimikatz|sekurlsa|lsadump`), "credential dumping", SeverityHigh},
+	{"scheduled-task", regexp.MustCompile(`(?i)schtasks\s+/create`), "scheduled task creation", SeverityHigh},
+	{"cron-job", regexp.MustCompile(`(?i)crontab\s+-e`), "cron job installation", SeverityHigh},
+	{"registry-hklm", regexp.MustCompile(`(?i)reg\s+add\s+HKLM`), "HKLM registry modification", SeverityHigh},
+	{"sudoers-modification", regexp.MustCompile(`visudo|/etc/sudoers`), "sudoers modification", SeverityHigh},
+	{"password-removal", regexp.MustCompile(`passwd\s+-d`), "password removal", SeverityHigh},
+	{"sudo-group-membership", regexp.MustCompile(`usermod\s+-a?G\s*\S*\bsudo\b`), "addition to a sudo group", SeverityHigh},
+	{"admin-group-membership", regexp.MustCompile(`(?i)net\s+localgroup\s+administrators\s+.*/add`), "addition to the Windows administrators group", SeverityHigh},
+}
+
+// matchTextRules applies textRules to each line outside # comments, for
+// languages such as Python that embed shell commands in strings
+func matchTextRules(content string) []Finding {
+	var findings []Finding
+	for i, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, rule := range textRules {
+			if loc := rule.pattern.FindStringIndex(line); loc != nil {
+				findings = append(findings, Finding{
+					Rule:        rule.id,
+					Description: rule.description,
+					Severity:    rule.severity,
+					Line:        i + 1,
+					Column:      len([]rune(line[:loc[0]])) + 1,
+				})
+			}
+		}
+	}
+	return findings
+}
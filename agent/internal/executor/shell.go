@@ -137,7 +137,9 @@ func CleanupScript(path string) {
 	}
 }
 
-// SubstituteParameters replaces parameter placeholders in script content
+// SubstituteParameters replaces parameter placeholders in script content.
+// Values are inserted verbatim, so they can break quoting; typed Params are
+// passed through the environment instead and never substituted.
 // Placeholders are in the format {{paramName}} or ${{paramName}}
 func SubstituteParameters(content string, params map[string]string) string {
 	if params == nil {
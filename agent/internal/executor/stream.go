@@ -0,0 +1,191 @@
+package executor
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// MaxStreamSize is the maximum amount of output streamed live for one
+	// execution. The aggregate in ScriptResult is capped separately at
+	// MaxOutputSize.
+	MaxStreamSize = 16 * 1024 * 1024 // 16MB
+
+	streamFlushInterval = 250 * time.Millisecond
+	streamChunkSize     = 32 * 1024
+)
+
+// OutputChunk is a piece of script output streamed while the script runs.
+// Seq increases by one per chunk across both streams, so the receiver can
+// restore ordering and detect dropped chunks.
+type OutputChunk struct {
+	ExecutionID string `json:"executionId"`
+	Seq         uint64 `json:"seq"`
+	Stream      string `json:"stream"` // stdout or stderr
+	Data        string `json:"data"`
+	// Truncated is set on the last chunk sent once MaxStreamSize is reached.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// OutputFunc receives streamed output in sequence order. It is called with
+// the stream's lock held and must not block.
+type OutputFunc func(OutputChunk)
+
+type pendingOutput struct {
+	stream string
+	data   []byte
+	// stale marks a partial line held back by the previous flush; it is
+	// sent on the next flush even without a trailing newline.
+	stale bool
+}
+
+// outputStream batches writes from a script's stdout and stderr into
+// chunks, preferring line boundaries so redaction patterns are not split.
+type outputStream struct {
+	executionID string
+	emit        OutputFunc
+	// redactor, if set, removes secrets before output is sent.
+	redactor *streamRedactor
+
+	mu        sync.Mutex
+	pending   []pendingOutput
+	seq       uint64
+	sent      int
+	truncated bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newOutputStream(executionID string, emit OutputFunc, redactor *streamRedactor) *outputStream {
+	s := &outputStream{
+		executionID: executionID,
+		emit:        emit,
+		redactor:    redactor,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *outputStream) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flushLocked(false)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// close sends any remaining output. No writes may follow.
+func (s *outputStream) close() {
+	close(s.stop)
+	<-s.done
+	s.mu.Lock()
+	s.flushLocked(true)
+	s.mu.Unlock()
+}
+
+// writer returns a writer for the named stream that also writes to next.
+func (s *outputStream) writer(stream string, next io.Writer) io.Writer {
+	return &streamWriter{stream: stream, out: s, next: next}
+}
+
+type streamWriter struct {
+	stream string
+	out    *outputStream
+	next   io.Writer
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	n, err := w.next.Write(p)
+	w.out.append(w.stream, p)
+	return n, err
+}
+
+func (s *outputStream) append(stream string, p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.truncated || len(p) == 0 {
+		return
+	}
+	if last := len(s.pending) - 1; last >= 0 && s.pending[last].stream == stream {
+		s.pending[last].data = append(s.pending[last].data, p...)
+	} else {
+		s.pending = append(s.pending, pendingOutput{stream: stream, data: append([]byte(nil), p...)})
+	}
+	if len(s.pending[len(s.pending)-1].data) >= streamChunkSize {
+		s.flushLocked(false)
+	}
+}
+
+// flushLocked sends pending output. Unless final, a trailing partial line is
+// held back for one flush interval in case the rest of the line follows.
+func (s *outputStream) flushLocked(final bool) {
+	for i, p := range s.pending {
+		data := p.data
+		if !final && !p.stale && i == len(s.pending)-1 && len(data) < streamChunkSize {
+			cut := bytes.LastIndexByte(data, '\n') + 1
+			s.output(p.stream, data[:cut])
+			if rest := data[cut:]; len(rest) > 0 {
+				s.pending = []pendingOutput{{stream: p.stream, data: append([]byte(nil), rest...), stale: true}}
+				return
+			}
+			break
+		}
+		s.output(p.stream, data)
+	}
+	s.pending = nil
+	if final && s.redactor != nil {
+		for _, stream := range []string{"stdout", "stderr"} {
+			s.send(stream, s.redactor.redact(stream, nil, true))
+		}
+	}
+}
+
+// output sends data after redacting any secrets.
+func (s *outputStream) output(stream string, data []byte) {
+	if s.redactor != nil {
+		data = s.redactor.redact(stream, data, false)
+	}
+	s.send(stream, data)
+}
+
+// send emits data in chunks of at most streamChunkSize, split on UTF-8
+// boundaries, stopping once MaxStreamSize has been sent.
+func (s *outputStream) send(stream string, data []byte) {
+	for len(data) > 0 && !s.truncated {
+		n := min(len(data), streamChunkSize)
+		for n < len(data) && n > 0 && !utf8.RuneStart(data[n]) {
+			n--
+		}
+		if n == 0 {
+			n = min(len(data), streamChunkSize)
+		}
+		if remaining := MaxStreamSize - s.sent; n >= remaining {
+			n = remaining
+			s.truncated = true
+		}
+		s.seq++
+		s.sent += n
+		s.emit(OutputChunk{
+			ExecutionID: s.executionID,
+			Seq:         s.seq,
+			Stream:      stream,
+			Data:        string(data[:n]),
+			Truncated:   s.truncated,
+		})
+		data = data[n:]
+	}
+}
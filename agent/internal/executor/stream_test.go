@@ -0,0 +1,127 @@
+package executor
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+type chunkRecorder struct {
+	mu     sync.Mutex
+	chunks []OutputChunk
+}
+
+func (r *chunkRecorder) record(chunk OutputChunk) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chunks = append(r.chunks, chunk)
+}
+
+func (r *chunkRecorder) streams() (map[string]string, []OutputChunk) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := map[string]string{}
+	for _, c := range r.chunks {
+		out[c.Stream] += c.Data
+	}
+	return out, append([]OutputChunk(nil), r.chunks...)
+}
+
+func TestExecuteStreamsOutputInSequence(t *testing.T) {
+	if !IsScriptTypeAvailableOnPlatform(ScriptTypeBash) {
+		t.Skip("bash not available")
+	}
+
+	var rec chunkRecorder
+	e := newTestExecutor()
+	result, err := e.Execute(ScriptExecution{
+		ID:         "exec-stream",
+		ScriptType: ScriptTypeBash,
+		Script:     "echo one; sleep 0.4; echo two >&2; echo three",
+		Timeout:    10,
+		OnOutput:   rec.record,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, chunks := rec.streams()
+	if out["stdout"] != "one\nthree\n" || out["stderr"] != "two\n" {
+		t.Fatalf("unexpected streamed output: %q", out)
+	}
+	for i, c := range chunks {
+		if c.Seq != uint64(i+1) || c.ExecutionID != "exec-stream" {
+			t.Fatalf("chunk %d has seq %d, execution %q", i, c.Seq, c.ExecutionID)
+		}
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected output before the sleep to stream separately, got %d chunk(s)", len(chunks))
+	}
+	if result.Stdout != "one\nthree\n" || result.Stderr != "two\n" {
+		t.Fatalf("aggregate output missing from result: %+v", result)
+	}
+}
+
+func TestExecuteInteractiveInput(t *testing.T) {
+	if !IsScriptTypeAvailableOnPlatform(ScriptTypeBash) {
+		t.Skip("bash not available")
+	}
+
+	e := newTestExecutor()
+	go func() {
+		for i := 0; i < 100; i++ {
+			if err := e.WriteInput("exec-stdin", []byte("hello\n"), true); err == nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	result, err := e.Execute(ScriptExecution{
+		ID:          "exec-stdin",
+		ScriptType:  ScriptTypeBash,
+		Script:      "read line; echo \"got $line\"; cat",
+		Timeout:     10,
+		Interactive: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "got hello\n" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if err := e.WriteInput("exec-stdin", []byte("late"), false); err == nil {
+		t.Fatal("expected input to a finished execution to fail")
+	}
+}
+
+func TestOutputStreamChunking(t *testing.T) {
+	var rec chunkRecorder
+	s := &outputStream{executionID: "x", emit: rec.record}
+
+	// A partial line is held back for one flush, then sent.
+	s.append("stdout", []byte("line\npart"))
+	s.flushLocked(false)
+	if out, _ := rec.streams(); out["stdout"] != "line\n" {
+		t.Fatalf("first flush sent %q", out["stdout"])
+	}
+	s.flushLocked(false)
+	if out, _ := rec.streams(); out["stdout"] != "line\npart" {
+		t.Fatalf("stale partial line not sent: %q", out["stdout"])
+	}
+
+	// Large writes are split into valid UTF-8 chunks.
+	big := strings.Repeat("é", streamChunkSize)
+	s.append("stderr", []byte(big))
+	s.flushLocked(true)
+	out, chunks := rec.streams()
+	if out["stderr"] != big {
+		t.Fatal("large output was not streamed intact")
+	}
+	for _, c := range chunks {
+		if len(c.Data) > streamChunkSize || !utf8.ValidString(c.Data) {
+			t.Fatalf("chunk %d is %d bytes, valid UTF-8 %v", c.Seq, len(c.Data), utf8.ValidString(c.Data))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package heartbeat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/executor"
+)
+
+// artifactUploadTimeout bounds a single artifact upload. Artifacts can be
+// far larger than API request bodies, so the client's timeout is replaced.
+const artifactUploadTimeout = 15 * time.Minute
+
+// decodeAttachments converts the attachments payload field into executor
+// attachments.
+func decodeAttachments(raw any) ([]executor.Attachment, error) {
+	var attachments []executor.Attachment
+	if err := decodePayloadObject(raw, &attachments); err != nil {
+		return nil, fmt.Errorf("invalid attachments: %w", err)
+	}
+	return attachments, nil
+}
+
+// decodePayloadObject converts a structured payload field into dst by way
+// of its JSON encoding.
+func decodePayloadObject(raw, dst any) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// artifactUploader returns an upload function that streams each artifact of
+// a script execution to the server. Artifacts are not queued in the outbox;
+// the working directory is removed once the execution finishes, so a failed
+// upload is reported in the command result instead.
+func (h *Heartbeat) artifactUploader(commandID string) executor.ArtifactUploadFunc {
+	return func(artifact executor.Artifact, content io.Reader) error {
+		ctx, cancel := context.WithTimeout(context.Background(), artifactUploadTimeout)
+		defer cancel()
+
+		endpoint := h.config.ServerURL + h.agentPath("commands/"+url.PathEscape(commandID)+"/artifacts") +
+			"?name=" + url.QueryEscape(artifact.Name)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, content)
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.ContentLength = artifact.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Authorization", h.authHeader())
+		req.Header.Set("X-Artifact-SHA256", artifact.SHA256)
+
+		client := *h.client
+		client.Timeout = artifactUploadTimeout
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("HTTP request: %w", err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("server returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
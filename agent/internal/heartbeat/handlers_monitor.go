@@ -1,16 +1,13 @@
 package heartbeat
 
 import (
-	"context"
-	"crypto/tls"
 	"fmt"
-	"io"
 	"net"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/breeze-rmm/agent/internal/discovery"
+	"github.com/breeze-rmm/agent/internal/monitoring"
 	"github.com/breeze-rmm/agent/internal/remote/tools"
 )
 
@@ -164,99 +161,28 @@ func handleNetworkHttpCheck(_ *Heartbeat, cmd Command) tools.CommandResult {
 	}
 
 	monitorId := tools.GetPayloadString(cmd.Payload, "monitorId", "")
-	method := tools.GetPayloadString(cmd.Payload, "method", "GET")
-	expectedStatus := tools.GetPayloadInt(cmd.Payload, "expectedStatus", 200)
-	expectedBody := tools.GetPayloadString(cmd.Payload, "expectedBody", "")
-	verifySsl := tools.GetPayloadBool(cmd.Payload, "verifySsl", true)
-	followRedirects := tools.GetPayloadBool(cmd.Payload, "followRedirects", true)
-	timeout := time.Duration(tools.GetPayloadInt(cmd.Payload, "timeout", 10)) * time.Second
-
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: !verifySsl,
-		},
-	}
-
-	client := &http.Client{
-		Timeout:   timeout,
-		Transport: transport,
-	}
-
-	if !followRedirects {
-		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		}
-	}
-
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		return tools.NewSuccessResult(map[string]any{
-			"monitorId":  monitorId,
-			"status":     "offline",
-			"responseMs": 0,
-			"error":      fmt.Sprintf("invalid request: %v", err),
-		}, time.Since(start).Milliseconds())
-	}
-
-	req.Header.Set("User-Agent", "BreezeRMM-Monitor/1.0")
-
-	reqStart := time.Now()
-	resp, err := client.Do(req)
-	if err != nil {
-		return tools.NewSuccessResult(map[string]any{
-			"monitorId":  monitorId,
-			"status":     "offline",
-			"responseMs": float64(time.Since(reqStart).Microseconds()) / 1000.0,
-			"error":      err.Error(),
-		}, time.Since(start).Milliseconds())
-	}
-	defer resp.Body.Close()
-
-	responseMs := float64(time.Since(reqStart).Microseconds()) / 1000.0
-
-	result := map[string]any{
-		"monitorId":  monitorId,
-		"status":     "online",
-		"responseMs": responseMs,
-		"statusCode": resp.StatusCode,
-	}
-
-	var errors []string
-
-	// Check status code
-	if resp.StatusCode != expectedStatus {
-		result["status"] = "degraded"
-		errors = append(errors, fmt.Sprintf("expected status %d, got %d", expectedStatus, resp.StatusCode))
-	}
-
-	// Check body match if specified
-	if expectedBody != "" {
-		bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20)) // 1MB limit
-		if err != nil {
-			result["status"] = "degraded"
-			errors = append(errors, fmt.Sprintf("failed to read body: %v", err))
-		} else {
-			bodyMatch := strings.Contains(string(bodyBytes), expectedBody)
-			result["bodyMatch"] = bodyMatch
-			if !bodyMatch {
-				result["status"] = "degraded"
-				errors = append(errors, "expected body content not found")
-			}
-		}
-	}
-
-	if len(errors) > 0 {
-		result["error"] = strings.Join(errors, "; ")
+	probe := monitoring.ProbeHTTP(monitoring.HTTPProbe{
+		URL:             url,
+		Method:          tools.GetPayloadString(cmd.Payload, "method", "GET"),
+		ExpectedStatus:  tools.GetPayloadInt(cmd.Payload, "expectedStatus", 200),
+		ExpectedBody:    tools.GetPayloadString(cmd.Payload, "expectedBody", ""),
+		VerifyTLS:       tools.GetPayloadBool(cmd.Payload, "verifySsl", true),
+		FollowRedirects: tools.GetPayloadBool(cmd.Payload, "followRedirects", true),
+		Timeout:         time.Duration(tools.GetPayloadInt(cmd.Payload, "timeout", 10)) * time.Second,
+	})
+
+	result := probeResultMap(monitorId, probe)
+	if probe.Status == monitoring.ProbeOffline {
+		return tools.NewSuccessResult(result, time.Since(start).Milliseconds())
+	}
+	result["statusCode"] = probe.StatusCode
+	if probe.BodyMatch != nil {
+		result["bodyMatch"] = *probe.BodyMatch
+	}
+	if probe.CertDaysRemaining != nil {
+		result["sslExpiry"] = probe.CertExpiry.Format(time.RFC3339)
+		result["sslDaysRemaining"] = *probe.CertDaysRemaining
 	}
-
-	// Check SSL expiry if TLS was used
-	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
-		cert := resp.TLS.PeerCertificates[0]
-		daysUntilExpiry := int(time.Until(cert.NotAfter).Hours() / 24)
-		result["sslExpiry"] = cert.NotAfter.Format(time.RFC3339)
-		result["sslDaysRemaining"] = daysUntilExpiry
-	}
-
 	return tools.NewSuccessResult(result, time.Since(start).Milliseconds())
 }
 
@@ -269,106 +195,41 @@ func handleNetworkDnsCheck(_ *Heartbeat, cmd Command) tools.CommandResult {
 	}
 
 	monitorId := tools.GetPayloadString(cmd.Payload, "monitorId", "")
-	recordType := tools.GetPayloadString(cmd.Payload, "recordType", "A")
-	expectedValue := tools.GetPayloadString(cmd.Payload, "expectedValue", "")
-	nameserver := tools.GetPayloadString(cmd.Payload, "nameserver", "")
-	timeout := time.Duration(tools.GetPayloadInt(cmd.Payload, "timeout", 5)) * time.Second
-
-	resolver := &net.Resolver{
-		PreferGo: true,
-	}
-
-	if nameserver != "" {
-		if !strings.Contains(nameserver, ":") {
-			nameserver = nameserver + ":53"
-		}
-		resolver.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{Timeout: timeout}
-			return d.DialContext(ctx, "udp", nameserver)
-		}
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	lookupStart := time.Now()
-	var records []string
-	var lookupErr error
-
-	switch strings.ToUpper(recordType) {
-	case "A", "AAAA":
-		ips, err := resolver.LookupIPAddr(ctx, hostname)
-		lookupErr = err
-		for _, ip := range ips {
-			if recordType == "A" && ip.IP.To4() != nil {
-				records = append(records, ip.IP.String())
-			} else if recordType == "AAAA" && ip.IP.To4() == nil {
-				records = append(records, ip.IP.String())
-			}
-		}
-	case "MX":
-		mxs, err := resolver.LookupMX(ctx, hostname)
-		lookupErr = err
-		for _, mx := range mxs {
-			records = append(records, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
-		}
-	case "CNAME":
-		cname, err := resolver.LookupCNAME(ctx, hostname)
-		lookupErr = err
-		if cname != "" {
-			records = append(records, cname)
-		}
-	case "TXT":
-		txts, err := resolver.LookupTXT(ctx, hostname)
-		lookupErr = err
-		records = txts
-	case "NS":
-		nss, err := resolver.LookupNS(ctx, hostname)
-		lookupErr = err
-		for _, ns := range nss {
-			records = append(records, ns.Host)
-		}
-	default:
-		return tools.NewSuccessResult(map[string]any{
-			"monitorId":  monitorId,
-			"status":     "offline",
-			"responseMs": 0,
-			"error":      fmt.Sprintf("unsupported record type: %s", recordType),
-		}, time.Since(start).Milliseconds())
-	}
-
-	responseMs := float64(time.Since(lookupStart).Microseconds()) / 1000.0
-
-	if lookupErr != nil {
-		return tools.NewSuccessResult(map[string]any{
-			"monitorId":  monitorId,
-			"status":     "offline",
-			"responseMs": responseMs,
-			"error":      lookupErr.Error(),
-		}, time.Since(start).Milliseconds())
+	var expected []string
+	if value := tools.GetPayloadString(cmd.Payload, "expectedValue", ""); value != "" {
+		expected = []string{value}
+	}
+	probe := monitoring.ProbeDNS(monitoring.DNSProbe{
+		Hostname:   hostname,
+		RecordType: tools.GetPayloadString(cmd.Payload, "recordType", "A"),
+		Nameserver: tools.GetPayloadString(cmd.Payload, "nameserver", ""),
+		Expected:   expected,
+		Timeout:    time.Duration(tools.GetPayloadInt(cmd.Payload, "timeout", 5)) * time.Second,
+	})
+
+	result := probeResultMap(monitorId, probe)
+	if probe.Status == monitoring.ProbeOffline {
+		return tools.NewSuccessResult(result, time.Since(start).Milliseconds())
+	}
+	result["records"] = probe.Records
+	if probe.Matched != nil {
+		result["matched"] = *probe.Matched
 	}
+	return tools.NewSuccessResult(result, time.Since(start).Milliseconds())
+}
 
+// probeResultMap returns the fields common to every network check result.
+func probeResultMap(monitorId string, probe monitoring.ProbeResult) map[string]any {
 	result := map[string]any{
 		"monitorId":  monitorId,
-		"status":     "online",
-		"responseMs": responseMs,
-		"records":    records,
+		"status":     probe.Status,
+		"responseMs": probe.ResponseMs,
 	}
-
-	if expectedValue != "" {
-		matched := false
-		for _, r := range records {
-			if strings.Contains(r, expectedValue) {
-				matched = true
-				break
-			}
-		}
-		result["matched"] = matched
-		if !matched {
-			result["status"] = "degraded"
-			result["error"] = fmt.Sprintf("expected value %q not found in records", expectedValue)
-		}
+	switch {
+	case probe.Error != "":
+		result["error"] = probe.Error
+	case len(probe.Failures) > 0:
+		result["error"] = strings.Join(probe.Failures, "; ")
 	}
-
-	return tools.NewSuccessResult(result, time.Since(start).Milliseconds())
+	return result
 }
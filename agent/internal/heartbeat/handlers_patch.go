@@ -3,9 +3,6 @@ package heartbeat
 import (
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/breeze-rmm/agent/internal/backup"
@@ -25,6 +22,8 @@ func init() {
 	handlerRegistry[tools.CmdBackupList] = handleBackupList
 	handlerRegistry[tools.CmdBackupStop] = handleBackupStop
 	handlerRegistry[tools.CmdBackupRestore] = handleBackupRestore
+	handlerRegistry[tools.CmdBackupVerify] = handleBackupVerify
+	handlerRegistry[tools.CmdBackupBrowse] = handleBackupBrowse
 }
 
 func handlePatchScan(h *Heartbeat, cmd Command) tools.CommandResult {
@@ -81,6 +80,9 @@ func handleInstallPatches(h *Heartbeat, cmd Command) tools.CommandResult {
 			log.Warn("preflight failed", "check", check.Name, "message", check.Message)
 		}
 	}
+	for _, warning := range pfResult.Warnings {
+		log.Warn("preflight warning", "warning", warning)
+	}
 	if !pfResult.OK {
 		return tools.NewErrorResult(pfResult.FirstError(), time.Since(start).Milliseconds())
 	}
@@ -224,23 +226,33 @@ func rebootStateToMap(state patching.RebootState) map[string]any {
 	return stateMap
 }
 
-func handleBackupRun(h *Heartbeat, _ Command) tools.CommandResult {
+func handleBackupRun(h *Heartbeat, cmd Command) tools.CommandResult {
 	start := time.Now()
 	if h.backupMgr == nil {
 		return tools.NewErrorResult(fmt.Errorf("backup not configured"), time.Since(start).Milliseconds())
 	}
-	job, err := h.backupMgr.RunBackup()
+	mode := tools.GetPayloadString(cmd.Payload, "mode", backup.BackupModeIncremental)
+	job, err := h.backupMgr.RunBackupWithMode(mode)
 	if err != nil && job == nil {
 		return tools.NewErrorResult(err, time.Since(start).Milliseconds())
 	}
 	jobResult := map[string]any{
 		"jobId":  job.ID,
+		"mode":   job.Mode,
 		"status": job.Status,
 	}
 	if job.Snapshot != nil {
 		jobResult["snapshotId"] = job.Snapshot.ID
 		jobResult["filesBackedUp"] = job.FilesBackedUp
 		jobResult["bytesBackedUp"] = job.BytesBackedUp
+		jobResult["bytesUploaded"] = job.Snapshot.UploadedSize
+		jobResult["encrypted"] = job.Snapshot.Encrypted
+		if job.Snapshot.KeyID != "" {
+			jobResult["keyId"] = job.Snapshot.KeyID
+		}
+	}
+	if len(job.HookResults) > 0 {
+		jobResult["hookResults"] = job.HookResults
 	}
 	if job.Error != nil {
 		jobResult["warning"] = job.Error.Error()
@@ -253,7 +265,7 @@ func handleBackupList(h *Heartbeat, _ Command) tools.CommandResult {
 	if h.backupMgr == nil {
 		return tools.NewErrorResult(fmt.Errorf("backup not configured"), time.Since(start).Milliseconds())
 	}
-	snapshots, err := backup.ListSnapshots(h.backupMgr.GetProvider())
+	snapshots, err := backup.ListSnapshots(h.backupMgr.GetProvider(), h.backupMgr.GetEncryptor())
 	if err != nil && len(snapshots) == 0 {
 		return tools.NewErrorResult(err, time.Since(start).Milliseconds())
 	}
@@ -282,71 +294,146 @@ func handleBackupRestore(h *Heartbeat, cmd Command) tools.CommandResult {
 	if snapshotId == "" {
 		return tools.NewErrorResult(fmt.Errorf("snapshotId is required"), time.Since(start).Milliseconds())
 	}
+	// Without a targetPath files go back to their original location, which
+	// must be requested explicitly.
 	targetPath := tools.GetPayloadString(cmd.Payload, "targetPath", "")
-	if targetPath == "" {
-		return tools.NewErrorResult(fmt.Errorf("targetPath is required"), time.Since(start).Milliseconds())
+	if targetPath == "" && !tools.GetPayloadBool(cmd.Payload, "restoreToOriginal", false) {
+		return tools.NewErrorResult(fmt.Errorf("targetPath is required unless restoreToOriginal is set"), time.Since(start).Milliseconds())
+	}
+	conflictPolicy := tools.GetPayloadString(cmd.Payload, "conflictPolicy", backup.ConflictOverwrite)
+	if !backup.IsValidConflictPolicy(conflictPolicy) {
+		return tools.NewErrorResult(fmt.Errorf("invalid conflictPolicy %q (use overwrite, skip, keep-both or only-if-newer)", conflictPolicy), time.Since(start).Milliseconds())
 	}
 	selectedPaths := tools.GetPayloadStringSlice(cmd.Payload, "selectedPaths")
 
-	// List files from the snapshot prefix
-	provider := h.backupMgr.GetProvider()
-	prefix := "snapshots/" + snapshotId + "/"
-	files, err := provider.List(prefix)
+	encryptor, err := restoreEncryptor(h, cmd)
 	if err != nil {
-		return tools.NewErrorResult(fmt.Errorf("failed to list snapshot files: %w", err), time.Since(start).Milliseconds())
-	}
-	if len(files) == 0 {
-		return tools.NewErrorResult(fmt.Errorf("no files found in snapshot %s", snapshotId), time.Since(start).Milliseconds())
+		return tools.NewErrorResult(err, time.Since(start).Milliseconds())
 	}
 
-	// Filter by selectedPaths if specified
-	if len(selectedPaths) > 0 {
-		selectedSet := make(map[string]bool, len(selectedPaths))
-		for _, sp := range selectedPaths {
-			selectedSet[sp] = true
-		}
-		var filtered []string
-		for _, f := range files {
-			// Strip the prefix to get relative path
-			rel := strings.TrimPrefix(f, prefix)
-			if selectedSet[rel] {
-				filtered = append(filtered, f)
-			}
-		}
-		files = filtered
-	}
-
-	// Download each file
-	var filesRestored int
-	var bytesRestored int64
-	var errors []string
-	for _, remotePath := range files {
-		rel := strings.TrimPrefix(remotePath, prefix)
-		localPath := filepath.Join(targetPath, rel)
-		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
-			errors = append(errors, fmt.Sprintf("mkdir %s: %v", filepath.Dir(localPath), err))
-			continue
-		}
-		if err := provider.Download(remotePath, localPath); err != nil {
-			errors = append(errors, fmt.Sprintf("download %s: %v", remotePath, err))
-			continue
-		}
-		info, _ := os.Stat(localPath)
-		if info != nil {
-			bytesRestored += info.Size()
+	opts := backup.RestoreOptions{
+		SnapshotID:     snapshotId,
+		TargetPath:     targetPath,
+		SelectedPaths:  selectedPaths,
+		ConflictPolicy: conflictPolicy,
+	}
+	if h.wsClient != nil {
+		opts.Progress = func(progress backup.RestoreProgress) {
+			_ = h.wsClient.SendBackupProgress(cmd.ID, progress)
 		}
-		filesRestored++
+	}
+
+	restoreResult, err := backup.RestoreSnapshotWithOptions(h.backupMgr.GetProvider(), encryptor, opts)
+	if err != nil {
+		return tools.NewErrorResult(fmt.Errorf("failed to restore snapshot: %w", err), time.Since(start).Milliseconds())
+	}
+	if restoreResult.TotalFiles == 0 {
+		return tools.NewErrorResult(fmt.Errorf("no files found in snapshot %s", snapshotId), time.Since(start).Milliseconds())
 	}
 
 	result := map[string]any{
-		"snapshotId":    snapshotId,
-		"targetPath":    targetPath,
-		"filesRestored": filesRestored,
-		"bytesRestored": bytesRestored,
-		"totalFiles":    len(files),
+		"snapshotId":     restoreResult.SnapshotID,
+		"targetPath":     restoreResult.TargetPath,
+		"conflictPolicy": restoreResult.ConflictPolicy,
+		"filesRestored":  restoreResult.FilesRestored,
+		"filesSkipped":   restoreResult.FilesSkipped,
+		"bytesRestored":  restoreResult.BytesRestored,
+		"totalFiles":     restoreResult.TotalFiles,
+	}
+	if len(restoreResult.Errors) > 0 {
+		result["errors"] = restoreResult.Errors
 	}
-	if len(errors) > 0 {
-		result["errors"] = errors
+	if len(restoreResult.Warnings) > 0 {
+		result["warnings"] = restoreResult.Warnings
 	}
 	return tools.NewSuccessResult(result, time.Since(start).Milliseconds())
 }
+
+// restoreEncryptor returns the encryptor for reading snapshots. Snapshots
+// written with a master key this agent no longer holds (e.g. after a
+// reinstall) need that key wrapped to the agent's restore key, whose public
+// half is in the agent's escrow record, so the server can relay it without
+// ever seeing the key itself.
+func restoreEncryptor(h *Heartbeat, cmd Command) (*backup.Encryptor, error) {
+	if tools.GetPayloadString(cmd.Payload, "encryptionKey", "") != "" {
+		return nil, fmt.Errorf("plaintext encryptionKey is not accepted; send the key wrapped to the agent's restore key as wrappedEncryptionKey")
+	}
+	wrappedKey := tools.GetPayloadString(cmd.Payload, "wrappedEncryptionKey", "")
+	if wrappedKey == "" {
+		return h.backupMgr.GetEncryptor(), nil
+	}
+	if h.backupRestoreKey == nil {
+		return nil, fmt.Errorf("wrappedEncryptionKey requires backup encryption to be enabled on this agent")
+	}
+	masterKey, err := backup.UnwrapMasterKeyForRestore(h.backupRestoreKey, wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptor, err := backup.NewEncryptor(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	encryptor.AllowPlaintext(h.config.BackupEncryptionAllowPlaintext)
+	return encryptor, nil
+}
+
+func handleBackupBrowse(h *Heartbeat, cmd Command) tools.CommandResult {
+	start := time.Now()
+	if h.backupMgr == nil {
+		return tools.NewErrorResult(fmt.Errorf("backup not configured"), time.Since(start).Milliseconds())
+	}
+
+	snapshotId := tools.GetPayloadString(cmd.Payload, "snapshotId", "")
+	if snapshotId == "" {
+		return tools.NewErrorResult(fmt.Errorf("snapshotId is required"), time.Since(start).Milliseconds())
+	}
+	dir := tools.GetPayloadString(cmd.Payload, "path", "")
+
+	encryptor, err := restoreEncryptor(h, cmd)
+	if err != nil {
+		return tools.NewErrorResult(err, time.Since(start).Milliseconds())
+	}
+	snapshot, err := backup.PointInTimeSnapshot(h.backupMgr.GetProvider(), encryptor, snapshotId)
+	if err != nil {
+		return tools.NewErrorResult(fmt.Errorf("failed to load snapshot: %w", err), time.Since(start).Milliseconds())
+	}
+	entries, err := backup.BrowseSnapshot(snapshot, dir)
+	if err != nil {
+		return tools.NewErrorResult(err, time.Since(start).Milliseconds())
+	}
+
+	return tools.NewSuccessResult(map[string]any{
+		"snapshotId": snapshot.ID,
+		"timestamp":  snapshot.Timestamp,
+		"path":       dir,
+		"entries":    entries,
+	}, time.Since(start).Milliseconds())
+}
+
+func handleBackupVerify(h *Heartbeat, cmd Command) tools.CommandResult {
+	start := time.Now()
+	if h.backupMgr == nil {
+		return tools.NewErrorResult(fmt.Errorf("backup not configured"), time.Since(start).Milliseconds())
+	}
+
+	snapshotId := tools.GetPayloadString(cmd.Payload, "snapshotId", "")
+	if snapshotId == "" {
+		return tools.NewErrorResult(fmt.Errorf("snapshotId is required"), time.Since(start).Milliseconds())
+	}
+	sampleSize := tools.GetPayloadInt(cmd.Payload, "sampleSize", 0)
+
+	verifyResult, err := backup.VerifySnapshot(h.backupMgr.GetProvider(), h.backupMgr.GetEncryptor(), snapshotId, sampleSize)
+	if err != nil {
+		return tools.NewErrorResult(fmt.Errorf("failed to verify snapshot: %w", err), time.Since(start).Milliseconds())
+	}
+
+	result := tools.NewSuccessResult(verifyResult, time.Since(start).Milliseconds())
+	if !verifyResult.Passed() {
+		// Keep the per-file report in stdout but mark the command failed.
+		result.Status = "failed"
+		result.ExitCode = 1
+		result.Error = fmt.Sprintf("snapshot %s failed verification: %d missing, %d corrupt, %d truncated",
+			verifyResult.SnapshotID, verifyResult.Missing, verifyResult.Corrupt, verifyResult.Truncated)
+	}
+	return result
+}
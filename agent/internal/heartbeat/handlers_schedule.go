@@ -0,0 +1,107 @@
+package heartbeat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/cmdsched"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+func init() {
+	handlerRegistry[tools.CmdScheduleCommand] = handleScheduleCommand
+	handlerRegistry[tools.CmdScheduleList] = handleScheduleList
+	handlerRegistry[tools.CmdScheduleCancel] = handleScheduleCancel
+}
+
+// handleScheduleCommand adds or replaces an agent-side scheduled job. The
+// job runs commandType with commandPayload on a recurring schedule (cron
+// expression, calendar phrase or interval) or once at runAt.
+func handleScheduleCommand(h *Heartbeat, cmd Command) tools.CommandResult {
+	start := time.Now()
+	if h.scheduler == nil {
+		return tools.NewErrorResult(fmt.Errorf("command scheduler is not available"), time.Since(start).Milliseconds())
+	}
+
+	commandType, errResult := tools.RequirePayloadString(cmd.Payload, "commandType")
+	if errResult != nil {
+		return *errResult
+	}
+	if isEphemeralCommand(commandType) || strings.HasPrefix(commandType, "schedule_") {
+		return tools.NewErrorResult(fmt.Errorf("command type %s cannot be scheduled", commandType), time.Since(start).Milliseconds())
+	}
+	if _, ok := handlerRegistry[commandType]; !ok {
+		return tools.NewErrorResult(fmt.Errorf("unknown command type: %s", commandType), time.Since(start).Milliseconds())
+	}
+
+	job := cmdsched.Job{
+		ID:            tools.GetPayloadString(cmd.Payload, "jobId", cmd.ID),
+		CommandType:   commandType,
+		Schedule:      tools.GetPayloadString(cmd.Payload, "schedule", ""),
+		RunIfMissed:   tools.GetPayloadBool(cmd.Payload, "runIfMissed", false),
+		JitterSeconds: tools.GetPayloadInt(cmd.Payload, "jitterSeconds", 0),
+	}
+	if payload, ok := cmd.Payload["commandPayload"].(map[string]any); ok {
+		// Jobs are stored on disk, where secrets must never be written.
+		if hasSecretParams(payload) {
+			return tools.NewErrorResult(fmt.Errorf("secret parameters cannot be scheduled"), time.Since(start).Milliseconds())
+		}
+		job.CommandPayload = payload
+	}
+	for _, field := range []struct {
+		key string
+		dst *time.Time
+	}{{"runAt", &job.RunAt}, {"expiresAt", &job.ExpiresAt}} {
+		value := tools.GetPayloadString(cmd.Payload, field.key, "")
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return tools.NewErrorResult(fmt.Errorf("invalid %s %q: want RFC3339", field.key, value), time.Since(start).Milliseconds())
+		}
+		*field.dst = parsed
+	}
+
+	scheduled, err := h.scheduler.Add(job)
+	if err != nil {
+		return tools.NewErrorResult(fmt.Errorf("failed to schedule job: %w", err), time.Since(start).Milliseconds())
+	}
+	log.Info("scheduled command job", "jobId", scheduled.ID, "commandType", scheduled.CommandType, "nextRun", scheduled.NextRun)
+	return tools.NewSuccessResult(scheduled, time.Since(start).Milliseconds())
+}
+
+// handleScheduleList returns the agent's scheduled jobs, soonest first.
+func handleScheduleList(h *Heartbeat, _ Command) tools.CommandResult {
+	start := time.Now()
+	if h.scheduler == nil {
+		return tools.NewErrorResult(fmt.Errorf("command scheduler is not available"), time.Since(start).Milliseconds())
+	}
+	jobs := h.scheduler.List()
+	return tools.NewSuccessResult(map[string]any{
+		"jobs":  jobs,
+		"count": len(jobs),
+	}, time.Since(start).Milliseconds())
+}
+
+// handleScheduleCancel removes a scheduled job. A run in progress finishes.
+func handleScheduleCancel(h *Heartbeat, cmd Command) tools.CommandResult {
+	start := time.Now()
+	if h.scheduler == nil {
+		return tools.NewErrorResult(fmt.Errorf("command scheduler is not available"), time.Since(start).Milliseconds())
+	}
+	jobID, errResult := tools.RequirePayloadString(cmd.Payload, "jobId")
+	if errResult != nil {
+		return *errResult
+	}
+	removed, err := h.scheduler.Remove(jobID)
+	if err != nil {
+		return tools.NewErrorResult(fmt.Errorf("failed to cancel job: %w", err), time.Since(start).Milliseconds())
+	}
+	if !removed {
+		return tools.NewErrorResult(fmt.Errorf("no scheduled job %s", jobID), time.Since(start).Milliseconds())
+	}
+	log.Info("cancelled scheduled command job", "jobId", jobID)
+	return tools.NewSuccessResult(map[string]any{"jobId": jobID, "cancelled": true}, time.Since(start).Milliseconds())
+}
@@ -3,6 +3,7 @@ package heartbeat
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,8 +18,13 @@ func init() {
 	handlerRegistry[tools.CmdRunScript] = handleScript
 	handlerRegistry[tools.CmdScriptCancel] = handleScriptCancel
 	handlerRegistry[tools.CmdScriptListRunning] = handleScriptListRunning
+	handlerRegistry[tools.CmdScriptInput] = handleScriptInput
+	handlerRegistry[tools.CmdScriptAnalyze] = handleScriptAnalyze
 }
 
+// maxScriptInputSize caps a single script_input message.
+const maxScriptInputSize = 64 * 1024
+
 func handleScript(h *Heartbeat, cmd Command) tools.CommandResult {
 	start := time.Now()
 	script := executor.ScriptExecution{
@@ -28,8 +34,37 @@ func handleScript(h *Heartbeat, cmd Command) tools.CommandResult {
 		Script:     tools.GetPayloadString(cmd.Payload, "content", ""),
 		Timeout:    tools.GetPayloadInt(cmd.Payload, "timeoutSeconds", 300),
 		RunAs:      tools.GetPayloadString(cmd.Payload, "runAs", ""),
+		// Interactive input is opt-in per script so it is covered by the
+		// command signature in signed command mode.
+		Interactive: tools.GetPayloadBool(cmd.Payload, "interactive", false),
+		Artifacts:   tools.GetPayloadStringSlice(cmd.Payload, "artifacts"),
+	}
+	if raw, ok := cmd.Payload["attachments"]; ok {
+		attachments, err := decodeAttachments(raw)
+		if err != nil {
+			return tools.NewErrorResult(err, time.Since(start).Milliseconds())
+		}
+		script.Attachments = attachments
+	}
+	if raw, ok := cmd.Payload["sandbox"].(map[string]any); ok {
+		var sandbox executor.Sandbox
+		if err := decodePayloadObject(raw, &sandbox); err != nil {
+			return tools.NewErrorResult(fmt.Errorf("invalid sandbox: %w", err), time.Since(start).Milliseconds())
+		}
+		script.Sandbox = &sandbox
+	}
+	if len(script.Artifacts) > 0 {
+		script.UploadArtifact = h.artifactUploader(cmd.ID)
 	}
 	script.RunAs = strings.TrimSpace(script.RunAs)
+	if h.wsClient != nil {
+		script.OnOutput = func(chunk executor.OutputChunk) {
+			chunk.Data = executor.SanitizeOutput(chunk.Data)
+			if err := h.wsClient.SendScriptOutput(cmd.ID, chunk); err != nil {
+				log.Debug("script output chunk dropped", "executionId", cmd.ID, "seq", chunk.Seq, "error", err.Error())
+			}
+		}
+	}
 	if params, ok := cmd.Payload["parameters"].(map[string]any); ok {
 		script.Parameters = make(map[string]string, len(params))
 		for k, v := range params {
@@ -38,6 +73,14 @@ func handleScript(h *Heartbeat, cmd Command) tools.CommandResult {
 			}
 		}
 	}
+	if raw, ok := cmd.Payload["params"]; ok {
+		params, err := decodeParams(raw)
+		defer zeroParams(params)
+		if err != nil {
+			return tools.NewErrorResult(err, time.Since(start).Milliseconds())
+		}
+		script.Params = params
+	}
 	if script.Script == "" {
 		return tools.CommandResult{
 			Status:     "failed",
@@ -49,6 +92,9 @@ func handleScript(h *Heartbeat, cmd Command) tools.CommandResult {
 	// Phase 3: If runAs is specified and a user helper is connected, forward via IPC
 	if script.RunAs != "" && h.sessionBroker != nil {
 		if session := resolveRunAsSession(h.sessionBroker, script.RunAs); session != nil {
+			if len(script.Params) > 0 || len(script.Attachments) > 0 || len(script.Artifacts) > 0 || script.Sandbox != nil {
+				return tools.NewErrorResult(fmt.Errorf("typed parameters, attachments, artifacts and sandboxing are not supported for scripts run through the user helper"), time.Since(start).Milliseconds())
+			}
 			return h.executeViaUserHelper(session, cmd, script.Timeout)
 		}
 		if !strings.EqualFold(script.RunAs, "system") && !strings.EqualFold(script.RunAs, "elevated") {
@@ -65,9 +111,19 @@ func handleScript(h *Heartbeat, cmd Command) tools.CommandResult {
 	if scriptResult.ExitCode != 0 {
 		status = "failed"
 	}
-	if scriptResult.Error != "" && strings.Contains(scriptResult.Error, "timed out") {
+	if scriptResult.TimedOut {
 		status = "timeout"
 	}
+	// Artifact failures and sandbox limit hits are reported alongside the
+	// output, like truncation.
+	for _, artifact := range scriptResult.Artifacts {
+		if artifact.Error != "" {
+			scriptResult.Stderr += fmt.Sprintf("\n[breeze: artifact %s not uploaded: %s]", artifact.Name, artifact.Error)
+		}
+	}
+	for _, hit := range scriptResult.LimitHits {
+		scriptResult.Stderr += fmt.Sprintf("\n[breeze: sandbox %s limit hit %d time(s)]", hit.Limit, hit.Count)
+	}
 	return tools.CommandResult{
 		Status:     status,
 		ExitCode:   scriptResult.ExitCode,
@@ -78,6 +134,65 @@ func handleScript(h *Heartbeat, cmd Command) tools.CommandResult {
 	}
 }
 
+// decodeParams converts the params payload field, a list of
+// {name, type, value, allowed} objects, into typed parameters. Secret values
+// go straight into secure memory; the caller zeroes them after the run.
+func decodeParams(raw any) ([]executor.Param, error) {
+	list, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid params: expected a list")
+	}
+	params := make([]executor.Param, 0, len(list))
+	for _, item := range list {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return params, fmt.Errorf("invalid params: expected objects")
+		}
+		var value string
+		switch v := obj["value"].(type) {
+		case string:
+			value = v
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			value = strconv.FormatBool(v)
+		case nil:
+		default:
+			return params, fmt.Errorf("invalid value for parameter %v", obj["name"])
+		}
+		param, err := executor.NewParam(
+			tools.GetPayloadString(obj, "name", ""),
+			executor.ParamType(tools.GetPayloadString(obj, "type", string(executor.ParamString))),
+			value,
+			tools.GetPayloadStringSlice(obj, "allowed"),
+		)
+		// Appended even when invalid so the caller zeroes its secret.
+		params = append(params, param)
+		if err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
+
+func zeroParams(params []executor.Param) {
+	for _, p := range params {
+		p.Secret.Zero()
+	}
+}
+
+// hasSecretParams reports whether a script payload carries secret
+// parameters.
+func hasSecretParams(payload map[string]any) bool {
+	list, _ := payload["params"].([]any)
+	for _, item := range list {
+		if obj, ok := item.(map[string]any); ok && tools.GetPayloadString(obj, "type", "") == string(executor.ParamSecret) {
+			return true
+		}
+	}
+	return false
+}
+
 func resolveRunAsSession(broker *sessionbroker.Broker, runAs string) *sessionbroker.Session {
 	target := strings.TrimSpace(runAs)
 	if target == "" || strings.EqualFold(target, "system") || strings.EqualFold(target, "elevated") {
@@ -120,6 +235,30 @@ func handleScriptCancel(h *Heartbeat, cmd Command) tools.CommandResult {
 	}, time.Since(start).Milliseconds())
 }
 
+// handleScriptInput writes to the standard input of a running interactive
+// script. Set eof to close its input.
+func handleScriptInput(h *Heartbeat, cmd Command) tools.CommandResult {
+	start := time.Now()
+	executionID, errResult := tools.RequirePayloadString(cmd.Payload, "executionId")
+	if errResult != nil {
+		errResult.DurationMs = time.Since(start).Milliseconds()
+		return *errResult
+	}
+	data := tools.GetPayloadString(cmd.Payload, "data", "")
+	if len(data) > maxScriptInputSize {
+		return tools.NewErrorResult(fmt.Errorf("input exceeds %d bytes", maxScriptInputSize), time.Since(start).Milliseconds())
+	}
+	eof := tools.GetPayloadBool(cmd.Payload, "eof", false)
+	if err := h.executor.WriteInput(executionID, []byte(data), eof); err != nil {
+		return tools.NewErrorResult(err, time.Since(start).Milliseconds())
+	}
+	return tools.NewSuccessResult(map[string]any{
+		"executionId": executionID,
+		"bytes":       len(data),
+		"eof":         eof,
+	}, time.Since(start).Milliseconds())
+}
+
 func handleScriptListRunning(h *Heartbeat, _ Command) tools.CommandResult {
 	start := time.Now()
 	running := h.executor.ListRunning()
@@ -129,6 +268,32 @@ func handleScriptListRunning(h *Heartbeat, _ Command) tools.CommandResult {
 	}, time.Since(start).Milliseconds())
 }
 
+// handleScriptAnalyze reports the security findings for a script without
+// running it, so the console can show them while the script is edited.
+func handleScriptAnalyze(h *Heartbeat, cmd Command) tools.CommandResult {
+	start := time.Now()
+	content := tools.GetPayloadString(cmd.Payload, "content", "")
+	if content == "" {
+		return tools.NewErrorResult(fmt.Errorf("content is required"), time.Since(start).Milliseconds())
+	}
+	if len(content) > executor.MaxScriptSize {
+		return tools.NewErrorResult(fmt.Errorf("script content exceeds maximum size of %d bytes", executor.MaxScriptSize), time.Since(start).Milliseconds())
+	}
+
+	findings := h.executor.Analyze(tools.GetPayloadString(cmd.Payload, "language", "bash"), content)
+	if findings == nil {
+		findings = []executor.Finding{}
+	}
+	blocked := false
+	for _, f := range findings {
+		blocked = blocked || f.Blocked
+	}
+	return tools.NewSuccessResult(map[string]any{
+		"findings": findings,
+		"blocked":  blocked,
+	}, time.Since(start).Milliseconds())
+}
+
 // executeViaUserHelper forwards a script command to a user helper via IPC
 // and translates the response back to a tools.CommandResult.
 func (h *Heartbeat) executeViaUserHelper(session *sessionbroker.Session, cmd Command, timeoutSeconds int) tools.CommandResult {
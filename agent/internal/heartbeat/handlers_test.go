@@ -41,7 +41,7 @@ var allCommandTypes = []string{
 
 	// handlers_script.go init()
 	tools.CmdScript, tools.CmdRunScript,
-	tools.CmdScriptCancel, tools.CmdScriptListRunning,
+	tools.CmdScriptCancel, tools.CmdScriptListRunning, tools.CmdScriptInput, tools.CmdScriptAnalyze,
 
 	// handlers_patch.go init()
 	tools.CmdPatchScan, tools.CmdInstallPatches, tools.CmdRollbackPatches,
@@ -62,6 +62,7 @@ var allCommandTypes = []string{
 
 	// handlers_patch.go init() — backup
 	tools.CmdBackupRun, tools.CmdBackupList, tools.CmdBackupStop, tools.CmdBackupRestore,
+	tools.CmdBackupVerify, tools.CmdBackupBrowse,
 
 	// handlers_user.go init()
 	CmdNotifyUser, CmdTrayUpdate,
@@ -83,6 +84,9 @@ var allCommandTypes = []string{
 
 	// handlers_peripheral.go init()
 	tools.CmdPeripheralPolicySync,
+
+	// handlers_schedule.go init()
+	tools.CmdScheduleCommand, tools.CmdScheduleList, tools.CmdScheduleCancel,
 }
 
 func TestHandlerRegistryCompleteness(t *testing.T) {
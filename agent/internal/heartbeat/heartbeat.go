@@ -2,6 +2,7 @@ package heartbeat
 
 import (
 	"context"
+	"crypto/rsa"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -24,6 +25,9 @@ import (
 	"github.com/breeze-rmm/agent/internal/backup"
 	"github.com/breeze-rmm/agent/internal/helper"
 	"github.com/breeze-rmm/agent/internal/backup/providers"
+	"github.com/breeze-rmm/agent/internal/cmdjournal"
+	"github.com/breeze-rmm/agent/internal/cmdsched"
+	"github.com/breeze-rmm/agent/internal/cmdsign"
 	"github.com/breeze-rmm/agent/internal/collectors"
 	"github.com/breeze-rmm/agent/internal/config"
 	"github.com/breeze-rmm/agent/internal/executor"
@@ -34,6 +38,7 @@ import (
 	"github.com/breeze-rmm/agent/internal/logging"
 	"github.com/breeze-rmm/agent/internal/mgmtdetect"
 	"github.com/breeze-rmm/agent/internal/monitoring"
+	"github.com/breeze-rmm/agent/internal/outbox"
 	"github.com/breeze-rmm/agent/internal/mtls"
 	"github.com/breeze-rmm/agent/internal/patching"
 	"github.com/breeze-rmm/agent/internal/peripheral"
@@ -64,6 +69,7 @@ type HeartbeatPayload struct {
 	DeviceRole       string                    `json:"deviceRole,omitempty"`
 	HealthStatus     map[string]any            `json:"healthStatus,omitempty"`
 	DroppedLogs      int64                     `json:"droppedLogs,omitempty"`
+	OutboxDepth      int                       `json:"outboxDepth,omitempty"`
 	HelperVersion    string                    `json:"helperVersion,omitempty"`
 }
 
@@ -86,13 +92,19 @@ type HelperSettings struct {
 }
 
 type Command struct {
-	ID      string         `json:"id"`
-	Type    string         `json:"type"`
-	Payload map[string]any `json:"payload"`
+	ID        string             `json:"id"`
+	Type      string             `json:"type"`
+	Payload   map[string]any     `json:"payload"`
+	Signature *cmdsign.Signature `json:"signature,omitempty"`
+
+	// scheduled marks a run of an agent-side scheduled job, whose signature
+	// was verified when the job was scheduled.
+	scheduled bool
 }
 
 type Heartbeat struct {
 	config                *config.Config
+	dataDir               string
 	secureToken           *secmem.SecureString
 	client                *http.Client
 	stopChan              chan struct{}
@@ -116,6 +128,7 @@ type Heartbeat struct {
 	terminalMgr           *terminal.Manager
 	executor              *executor.Executor
 	backupMgr             *backup.BackupManager
+	backupRestoreKey      *rsa.PrivateKey
 	rebootMgr             *patching.RebootManager
 	securityScanner       *security.SecurityScanner
 	wsClient              *websocket.Client
@@ -158,6 +171,21 @@ type Heartbeat struct {
 	// Service & process monitoring
 	monitor *monitoring.Monitor
 
+	// Durable queue of results and telemetry awaiting delivery
+	outbox *outbox.Outbox
+
+	// On-disk record of command state for restart-safe deduplication
+	journal *cmdjournal.Journal
+
+	// Signature verification for high-risk commands (nil when not required)
+	cmdVerifier *cmdsign.Verifier
+
+	// Local command policy that the server cannot override
+	cmdPolicy *commandPolicy
+
+	// Agent-side schedule of deferred and recurring commands
+	scheduler *cmdsched.Scheduler
+
 	// Cached device role classification (computed once at startup)
 	cachedDeviceRole string
 }
@@ -167,6 +195,12 @@ func New(cfg *config.Config) *Heartbeat {
 }
 
 func NewWithVersion(cfg *config.Config, version string, token *secmem.SecureString, tlsCfg *tls.Config) *Heartbeat {
+	return newHeartbeat(cfg, version, token, tlsCfg, config.GetDataDir())
+}
+
+// newHeartbeat keeps the agent's journal, outbox, schedule and keys under
+// dataDir.
+func newHeartbeat(cfg *config.Config, version string, token *secmem.SecureString, tlsCfg *tls.Config, dataDir string) *Heartbeat {
 	ftToken := token
 	if ftToken == nil && cfg.AuthToken != "" {
 		ftToken = secmem.NewSecureString(cfg.AuthToken)
@@ -186,6 +220,7 @@ func NewWithVersion(cfg *config.Config, version string, token *secmem.SecureStri
 
 	h := &Heartbeat{
 		config:       cfg,
+		dataDir:      dataDir,
 		secureToken:  ftToken,
 		client:       httpClient,
 		stopChan:     make(chan struct{}),
@@ -194,7 +229,7 @@ func NewWithVersion(cfg *config.Config, version string, token *secmem.SecureStri
 		softwareCol:  collectors.NewSoftwareCollector(),
 		inventoryCol: collectors.NewInventoryCollector(),
 		changeTrackerCol: collectors.NewChangeTrackerCollector(
-			filepath.Join(config.GetDataDir(), "change_tracker_snapshot.json"),
+			filepath.Join(dataDir, "change_tracker_snapshot.json"),
 		),
 		sessionCol:      collectors.NewSessionCollector(),
 		policyStateCol:  collectors.NewPolicyStateCollector(),
@@ -216,6 +251,7 @@ func NewWithVersion(cfg *config.Config, version string, token *secmem.SecureStri
 		retryCfg:        httputil.DefaultRetryConfig(),
 		seenCommands:    make(map[string]time.Time),
 	}
+	h.patchMgr.SetDataDir(dataDir)
 	h.accepting.Store(true)
 	h.isService = cfg.IsService
 	h.isHeadless = cfg.IsHeadless
@@ -276,6 +312,13 @@ func NewWithVersion(cfg *config.Config, version string, token *secmem.SecureStri
 	// Initialize service & process monitoring
 	h.monitor = monitoring.New(h.sendMonitoringResults)
 
+	// Initialize the outbox for results that cannot be delivered immediately
+	h.openOutbox(cfg)
+	h.openJournal()
+	h.initCommandVerifier(cfg)
+	h.cmdPolicy = newCommandPolicy()
+	h.openScheduler()
+
 	// Trigger wallpaper crash recovery (restores wallpaper if agent crashed mid-session)
 	_ = desktop.GetWallpaperManager()
 
@@ -334,41 +377,69 @@ func NewWithVersion(cfg *config.Config, version string, token *secmem.SecureStri
 
 	// Initialize backup manager if enabled
 	if cfg.BackupEnabled && len(cfg.BackupPaths) > 0 {
-		var backupProvider providers.BackupProvider
-		switch cfg.BackupProvider {
-		case "s3":
-			backupProvider = providers.NewS3Provider(
-				cfg.BackupS3Bucket,
-				cfg.BackupS3Region,
-				cfg.BackupS3AccessKey,
-				cfg.BackupS3SecretKey,
-				"",
-			)
-		default:
-			localPath := cfg.BackupLocalPath
-			if localPath == "" {
-				localPath = config.GetDataDir() + "/backups"
-			}
-			backupProvider = providers.NewLocalProvider(localPath)
+		backupProvider, providerErr := newBackupProvider(cfg)
+		if providerErr != nil {
+			log.Error("failed to initialize backup provider, backups disabled",
+				"provider", cfg.BackupProvider, "error", providerErr.Error())
+		}
+		scheduleSpec := cfg.BackupSchedule
+		if scheduleSpec == "" {
+			scheduleSpec = "24h"
 		}
-		schedule, parseErr := time.ParseDuration(cfg.BackupSchedule)
-		if parseErr != nil && cfg.BackupSchedule != "" {
+		schedules, parseErr := backup.ParseSchedule(scheduleSpec)
+		if parseErr != nil {
 			log.Warn("invalid backup schedule, using default 24h",
 				"schedule", cfg.BackupSchedule, "error", parseErr)
+			schedules, _ = backup.ParseSchedule("24h")
+		}
+		retention := backup.RetentionPolicy{
+			Daily:   cfg.BackupRetentionDaily,
+			Weekly:  cfg.BackupRetentionWeekly,
+			Monthly: cfg.BackupRetentionMonthly,
+			Yearly:  cfg.BackupRetentionYearly,
+		}
+		if retention.IsZero() {
+			retention.Last = cfg.BackupRetention
+			if retention.Last <= 0 {
+				retention.Last = 7
+			}
 		}
-		if schedule <= 0 {
-			schedule = 24 * time.Hour
-		}
-		retention := cfg.BackupRetention
-		if retention <= 0 {
-			retention = 7
+		var encryptor *backup.Encryptor
+		var keyEscrow *backup.KeyEscrow
+		var keyErr error
+		if cfg.BackupEncryptionEnabled {
+			encryptor, keyEscrow, h.backupRestoreKey, keyErr = loadBackupEncryption(cfg, h.dataDir)
+		}
+		if keyErr != nil {
+			// Never fall back to plaintext backups when encryption was requested.
+			log.Error("failed to initialize backup encryption, backups disabled", "error", keyErr.Error())
+		} else if providerErr == nil {
+			if encryptor != nil && keyEscrow == nil {
+				log.Warn("backup encryption enabled without an escrow key; losing the master key makes backups unrecoverable")
+			}
+			h.backupMgr = backup.NewBackupManager(backup.BackupConfig{
+				Provider:  backupProvider,
+				Paths:     cfg.BackupPaths,
+				Schedules: schedules,
+				Retention: retention,
+				Encryptor: encryptor,
+				KeyEscrow: keyEscrow,
+
+				Include:     cfg.BackupInclude,
+				Exclude:     cfg.BackupExclude,
+				MaxFileSize: cfg.BackupMaxFileSizeMB * 1024 * 1024,
+
+				VerifySampleSize: cfg.BackupVerifySampleSize,
+
+				PreHooks:   backupHooks(cfg.BackupPreHooks),
+				PostHooks:  backupHooks(cfg.BackupPostHooks),
+				HookRunner: backupHookRunner(h.executor),
+				SnapshotMount: backup.SnapshotMount{
+					Source:     cfg.BackupSnapshotSource,
+					MountPoint: cfg.BackupSnapshotMountPoint,
+				},
+			})
 		}
-		h.backupMgr = backup.NewBackupManager(backup.BackupConfig{
-			Provider:  backupProvider,
-			Paths:     cfg.BackupPaths,
-			Schedule:  schedule,
-			Retention: retention,
-		})
 	}
 
 	// For direct mode (non-service), notify API when WebRTC peer drops.
@@ -471,6 +542,127 @@ func (h *Heartbeat) SCMSessionCh() chan<- sessionbroker.SCMSessionEvent {
 	return h.scmSessionCh
 }
 
+// newBackupProvider builds the configured backup provider from the
+// backup_provider_settings block, filling in the legacy S3 and local path
+// keys when the block does not set them.
+func newBackupProvider(cfg *config.Config) (providers.BackupProvider, error) {
+	settings := make(map[string]string, len(cfg.BackupProviderSettings)+5)
+	for key, value := range cfg.BackupProviderSettings {
+		settings[key] = value
+	}
+	legacy := map[string]string{
+		"bucket":     cfg.BackupS3Bucket,
+		"region":     cfg.BackupS3Region,
+		"access_key": cfg.BackupS3AccessKey,
+		"secret_key": cfg.BackupS3SecretKey,
+		"path":       cfg.BackupLocalPath,
+	}
+	for key, value := range legacy {
+		if settings[key] == "" && value != "" {
+			settings[key] = value
+		}
+	}
+	switch cfg.BackupProvider {
+	case "", "local":
+		if settings["path"] == "" {
+			settings["path"] = config.GetDataDir() + "/backups"
+		}
+	case "s3":
+		// Lets interrupted multipart uploads resume after a restart.
+		if settings["state_dir"] == "" {
+			settings["state_dir"] = config.GetDataDir() + "/backup-uploads"
+		}
+	}
+	return providers.New(cfg.BackupProvider, settings)
+}
+
+func backupHooks(hooks []config.BackupHook) []backup.BackupHook {
+	out := make([]backup.BackupHook, 0, len(hooks))
+	for _, hook := range hooks {
+		out = append(out, backup.BackupHook{
+			Name:       hook.Name,
+			ScriptType: hook.ScriptType,
+			Script:     hook.Script,
+			Timeout:    time.Duration(hook.TimeoutSeconds) * time.Second,
+			RunAs:      hook.RunAs,
+		})
+	}
+	return out
+}
+
+// backupHookRunner runs backup hooks through the script executor, so they
+// get the same validation, timeouts and output limits as remote scripts.
+func backupHookRunner(scripts *executor.Executor) backup.HookRunner {
+	return func(hook backup.BackupHook, params map[string]string) backup.HookResult {
+		scriptType := hook.ScriptType
+		if scriptType == "" {
+			scriptType = "bash"
+			if runtime.GOOS == "windows" {
+				scriptType = "powershell"
+			}
+		}
+		started := time.Now()
+		result, err := scripts.Execute(executor.ScriptExecution{
+			ID:         fmt.Sprintf("backup-%s-%s-%s", params["backup_job_id"], params["backup_phase"], hook.Name),
+			ScriptID:   "backup-hook:" + hook.Name,
+			ScriptType: scriptType,
+			Script:     hook.Script,
+			Parameters: params,
+			Timeout:    int(hook.Timeout / time.Second),
+			RunAs:      hook.RunAs,
+		})
+		hookResult := backup.HookResult{
+			StartedAt:   started.UTC(),
+			CompletedAt: time.Now().UTC(),
+		}
+		if result != nil {
+			hookResult.ExitCode = result.ExitCode
+			hookResult.Stdout = executor.SanitizeOutput(result.Stdout)
+			hookResult.Stderr = executor.SanitizeOutput(result.Stderr)
+			hookResult.Error = result.Error
+			hookResult.TimedOut = result.TimedOut
+		}
+		if err != nil && hookResult.Error == "" {
+			hookResult.Error = err.Error()
+		}
+		return hookResult
+	}
+}
+
+// loadBackupEncryption loads (or creates) the backup master key and the
+// restore key, and when an escrow public key is configured, wraps the
+// master key to it.
+func loadBackupEncryption(cfg *config.Config, dataDir string) (*backup.Encryptor, *backup.KeyEscrow, *rsa.PrivateKey, error) {
+	keyFile := cfg.BackupEncryptionKeyFile
+	if keyFile == "" {
+		keyFile = filepath.Join(dataDir, "backup_master.key")
+	}
+	masterKey, err := backup.LoadOrCreateMasterKey(keyFile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encryptor, err := backup.NewEncryptor(masterKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encryptor.AllowPlaintext(cfg.BackupEncryptionAllowPlaintext)
+	restoreKey, err := backup.LoadOrCreateRestoreKey(filepath.Join(filepath.Dir(keyFile), "backup_restore_key.pem"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg.BackupEncryptionEscrowPublicKey == "" {
+		return encryptor, nil, restoreKey, nil
+	}
+	escrow, err := backup.EscrowMasterKey(masterKey, cfg.BackupEncryptionEscrowPublicKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if escrow.RestorePublicKey, err = backup.RestorePublicKeyPEM(restoreKey); err != nil {
+		return nil, nil, nil, err
+	}
+	return encryptor, escrow, restoreKey, nil
+}
+
 func (h *Heartbeat) Start() {
 	// Start session broker for user helpers
 	if h.sessionBroker != nil {
@@ -493,6 +685,17 @@ func (h *Heartbeat) Start() {
 		go lm.Start(ctx)
 	}
 
+	// Replay results and telemetry queued while the server was unreachable
+	if h.outbox != nil {
+		go h.outbox.Run(h.stopChan, h.sendOutboxEntry)
+	}
+	h.reportInterruptedCommands()
+
+	// Run agent-side scheduled jobs, catching up runs missed while stopped
+	if h.scheduler != nil {
+		go h.scheduler.Run(h.stopChan)
+	}
+
 	// Start backup scheduler if configured
 	if h.backupMgr != nil {
 		if err := h.backupMgr.Start(); err != nil {
@@ -655,6 +858,9 @@ func (h *Heartbeat) Stop() {
 			h.auditLog.Log(audit.EventAgentStop, "", nil)
 			h.auditLog.Close()
 		}
+		if h.journal != nil {
+			h.journal.Close()
+		}
 		if h.helperMgr != nil {
 			h.helperMgr.Shutdown()
 		}
@@ -664,14 +870,18 @@ func (h *Heartbeat) Stop() {
 	})
 }
 
-// sendMonitoringResults ships service/process check results to the API.
+// sendMonitoringResults ships service, process and metric check results to the API.
 func (h *Heartbeat) sendMonitoringResults(results []monitoring.CheckResult) {
 	if len(results) == 0 {
 		return
 	}
 
+	ingest := make([]monitoring.CheckResult, len(results))
+	for i, result := range results {
+		ingest[i] = result.IngestResult()
+	}
 	payload := map[string]any{
-		"results": results,
+		"results": ingest,
 	}
 
 	body, err := json.Marshal(payload)
@@ -680,24 +890,16 @@ func (h *Heartbeat) sendMonitoringResults(results []monitoring.CheckResult) {
 		return
 	}
 
-	url := fmt.Sprintf("%s/api/v1/agents/%s/monitoring-results", h.config.ServerURL, h.config.AgentID)
-	headers := http.Header{
-		"Content-Type":  {"application/json"},
-		"Authorization": {h.authHeader()},
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-
-	resp, err := httputil.Do(ctx, h.client, "PUT", url, body, headers, h.retryCfg)
+	queued, err := h.deliver(outbox.Entry{
+		Kind:   outbox.KindMonitoring,
+		Method: http.MethodPut,
+		Path:   h.agentPath("monitoring-results"),
+		Body:   body,
+	}, 15*time.Second)
 	if err != nil {
 		log.Warn("failed to send monitoring results", "error", err.Error(), "count", len(results))
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Warn("monitoring results returned non-OK status", "status", resp.StatusCode, "count", len(results))
+	} else if queued {
+		log.Debug("monitoring results queued in outbox", "count", len(results))
 	}
 }
 
@@ -747,26 +949,21 @@ func (h *Heartbeat) sendInventoryData(endpoint string, payload any, label string
 		return
 	}
 
-	url := fmt.Sprintf("%s/api/v1/agents/%s/%s", h.config.ServerURL, h.config.AgentID, endpoint)
-	headers := http.Header{
-		"Content-Type":  {"application/json"},
-		"Authorization": {h.authHeader()},
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	resp, err := httputil.Do(ctx, h.client, "PUT", url, body, headers, h.retryCfg)
-	if err != nil {
+	// Inventory is a full snapshot, so a newer one replaces any queued copy.
+	queued, err := h.deliver(outbox.Entry{
+		Key:    "inventory:" + endpoint,
+		Kind:   outbox.KindInventory,
+		Method: http.MethodPut,
+		Path:   h.agentPath(endpoint),
+		Body:   body,
+	}, 30*time.Second)
+	switch {
+	case err != nil:
 		log.Error("failed to send inventory", "label", label, "error", err.Error())
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+	case queued:
+		log.Debug("inventory queued in outbox", "label", label)
+	default:
 		log.Debug("inventory sent", "label", label)
-	} else {
-		log.Warn("inventory send failed", "label", label, "status", resp.StatusCode)
 	}
 }
 
@@ -1313,6 +1510,16 @@ func (h *Heartbeat) collectPatchInventory() ([]map[string]any, []map[string]any,
 	return h.collectPatchInventoryFromCollectors()
 }
 
+// scopedExternalIDProviders have local patch IDs that say more than the
+// package name, such as zypper's "patch:<name>" or flatpak's
+// "<app>//<branch>". Their patches report the provider-scoped ID as the
+// external ID so installs resolve to the exact patch rather than to the
+// server's name-based fallback.
+var scopedExternalIDProviders = map[string]bool{
+	"zypper":  true,
+	"flatpak": true,
+}
+
 func (h *Heartbeat) availablePatchesToMaps(patches []patching.AvailablePatch) []map[string]any {
 	items := make([]map[string]any, len(patches))
 	for i, p := range patches {
@@ -1333,6 +1540,10 @@ func (h *Heartbeat) availablePatchesToMaps(patches []patching.AvailablePatch) []
 				category = "homebrew"
 			}
 		}
+		externalID := p.KBNumber
+		if externalID == "" && scopedExternalIDProviders[p.Provider] && p.ID != p.Provider+":"+p.Title {
+			externalID = p.ID
+		}
 		items[i] = map[string]any{
 			"name":            p.Title,
 			"version":         p.Version,
@@ -1340,7 +1551,7 @@ func (h *Heartbeat) availablePatchesToMaps(patches []patching.AvailablePatch) []
 			"severity":        severity,
 			"description":     p.Description,
 			"source":          h.mapPatchProviderSource(p.Provider),
-			"externalId":      p.KBNumber,
+			"externalId":      externalID,
 			"kbNumber":        p.KBNumber,
 			"size":            p.Size,
 			"requiresRestart": p.RebootRequired,
@@ -1447,9 +1658,9 @@ func (h *Heartbeat) mapPatchProviderSource(provider string) string {
 		return "apple"
 	case "homebrew":
 		return "third_party"
-	case "chocolatey":
+	case "chocolatey", "snap", "flatpak":
 		return "third_party"
-	case "apt", "yum":
+	case "apt", "yum", "zypper", "pacman", "apk":
 		return "linux"
 	default:
 		return "custom"
@@ -1460,9 +1671,9 @@ func (h *Heartbeat) mapPatchProviderCategory(provider string) string {
 	switch provider {
 	case "windows-update", "apple-softwareupdate":
 		return "system"
-	case "homebrew", "chocolatey":
+	case "homebrew", "chocolatey", "snap", "flatpak":
 		return "application"
-	case "apt", "yum":
+	case "apt", "yum", "zypper", "pacman", "apk":
 		return "system"
 	default:
 		return "application"
@@ -1670,9 +1881,11 @@ func (h *Heartbeat) sendHeartbeat() {
 		payload.MetricsAvailable = &metricsAvailable
 	}
 
-	// Check for pending reboot
-	pendingReboot, _ := patching.DetectPendingReboot()
-	payload.PendingReboot = pendingReboot
+	// Report the cached pending reboot detection; detecting can take many
+	// seconds, too long to repeat on every heartbeat.
+	if h.rebootMgr != nil {
+		payload.PendingReboot = h.rebootMgr.PendingReboot()
+	}
 	if h.sessionCol != nil {
 		payload.LastUser = h.sessionCol.LastUser()
 	}
@@ -1689,6 +1902,11 @@ func (h *Heartbeat) sendHeartbeat() {
 		payload.DroppedLogs = dropped
 	}
 
+	// Report the backlog of results and telemetry awaiting delivery
+	if h.outbox != nil {
+		payload.OutboxDepth = h.outbox.Len()
+	}
+
 	// Attach IP history update when assignments changed since last heartbeat.
 	if ipUpdate, ipErr := h.collectIPHistory(); ipErr != nil {
 		log.Error("failed to collect ip history", "error", ipErr.Error())
@@ -1754,6 +1972,12 @@ func (h *Heartbeat) sendHeartbeat() {
 	// for the next attempt.
 	logging.CommitDroppedLogCount()
 
+	// The server is reachable again: replay the outbox without waiting for
+	// its backoff to expire.
+	if h.outbox != nil && payload.OutboxDepth > 0 {
+		h.outbox.Wake()
+	}
+
 	var response HeartbeatResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		log.Error("failed to decode heartbeat response", "error", err.Error())
@@ -1910,25 +2134,21 @@ func (h *Heartbeat) submitCommandResult(commandID string, result tools.CommandRe
 		return fmt.Errorf("failed to marshal result: %w", err)
 	}
 
-	url := fmt.Sprintf("%s/api/v1/agents/%s/commands/%s/result", h.config.ServerURL, h.config.AgentID, commandID)
-	headers := http.Header{
-		"Content-Type":  {"application/json"},
-		"Authorization": {h.authHeader()},
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	resp, err := httputil.Do(ctx, h.client, "POST", url, body, headers, h.retryCfg)
+	queued, err := h.deliver(outbox.Entry{
+		Key:    "command-result:" + commandID,
+		Kind:   outbox.KindCommandResult,
+		Method: http.MethodPost,
+		Path:   h.agentPath("commands/" + commandID + "/result"),
+		Body:   body,
+	}, 30*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return fmt.Errorf("submit result failed: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("submit result failed with status %d", resp.StatusCode)
+	if queued {
+		log.Warn("command result queued in outbox", logging.KeyCommandID, commandID, "status", result.Status)
+		return nil
 	}
-
 	log.Info("command completed", logging.KeyCommandID, commandID, "status", result.Status)
 	return nil
 }
@@ -1944,9 +2164,10 @@ func (h *Heartbeat) HandleCommand(wsCmd websocket.Command) websocket.CommandResu
 	}
 
 	cmd := Command{
-		ID:      wsCmd.ID,
-		Type:    wsCmd.Type,
-		Payload: wsCmd.Payload,
+		ID:        wsCmd.ID,
+		Type:      wsCmd.Type,
+		Payload:   wsCmd.Payload,
+		Signature: wsCmd.Signature,
 	}
 
 	result := h.executeCommand(cmd)
@@ -1954,6 +2175,7 @@ func (h *Heartbeat) HandleCommand(wsCmd websocket.Command) websocket.CommandResu
 	wsResult := websocket.CommandResult{
 		CommandID: cmd.ID,
 		Status:    result.Status,
+		Code:      result.Code,
 	}
 
 	if result.Error != "" {
@@ -1977,6 +2199,7 @@ func (h *Heartbeat) HandleCommand(wsCmd websocket.Command) websocket.CommandResu
 func isEphemeralCommand(cmdType string) bool {
 	switch cmdType {
 	case tools.CmdTerminalStart, tools.CmdTerminalData, tools.CmdTerminalResize, tools.CmdTerminalStop,
+		tools.CmdScriptInput,
 		tools.CmdStartDesktop, tools.CmdStopDesktop,
 		tools.CmdDesktopStreamStart, tools.CmdDesktopStreamStop, tools.CmdDesktopInput, tools.CmdDesktopConfig:
 		return true
@@ -2020,8 +2243,9 @@ func (h *Heartbeat) executeCommand(cmd Command) tools.CommandResult {
 	cmdLog := logging.WithCommand(log, cmd.ID, cmd.Type)
 
 	// Deduplicate: skip if we've already seen this command ID
-	// (can arrive via both WebSocket and heartbeat response)
-	if !h.markCommandSeen(cmd.ID) {
+	// (can arrive via both WebSocket and heartbeat response, and may be
+	// redelivered after a restart)
+	if !h.claimCommand(cmd) {
 		cmdLog.Debug("skipping duplicate command")
 		return tools.CommandResult{
 			Status: "duplicate",
@@ -2042,7 +2266,45 @@ func (h *Heartbeat) executeCommand(cmd Command) tools.CommandResult {
 		cmdLog.Warn("command requires elevated privileges but agent is not running as root")
 	}
 
+	// Signed command mode: reject unsigned, forged or replayed high-risk
+	// commands before they reach a handler. The claim is released so a
+	// correctly signed redelivery of the same command still runs.
+	if err := h.verifyCommand(cmd); err != nil {
+		cmdLog.Warn("rejected command with invalid signature", "error", err.Error())
+		if h.auditLog != nil {
+			h.auditLog.Log(audit.EventCommandRejected, cmd.ID, map[string]any{
+				"type":   cmd.Type,
+				"reason": err.Error(),
+			})
+		}
+		h.releaseCommand(cmd)
+		return tools.CommandResult{
+			Status: "failed",
+			Error:  "command rejected: " + err.Error(),
+		}
+	}
+
+	// Local command policy: allow/deny rules, time windows and user consent
+	// configured on the endpoint itself.
+	if err := h.checkCommandPolicy(cmd); err != nil {
+		cmdLog.Warn("command denied by local policy", "error", err.Error())
+		if h.auditLog != nil {
+			h.auditLog.Log(audit.EventCommandDenied, cmd.ID, map[string]any{
+				"type":   cmd.Type,
+				"reason": err.Error(),
+			})
+		}
+		result := tools.CommandResult{
+			Status: "failed",
+			Error:  err.Error(),
+			Code:   resultCodeDenied,
+		}
+		h.journalComplete(cmd, result)
+		return result
+	}
+
 	// Dispatch via handler registry
+	h.journalRunning(cmd)
 	result, handled := h.dispatchCommand(cmd)
 	if !handled {
 		result = tools.CommandResult{
@@ -2050,6 +2312,7 @@ func (h *Heartbeat) executeCommand(cmd Command) tools.CommandResult {
 			Error:  fmt.Sprintf("unknown command type: %s", cmd.Type),
 		}
 	}
+	h.journalComplete(cmd, result)
 
 	// Audit: command executed
 	if h.auditLog != nil {
@@ -2076,6 +2339,10 @@ func (h *Heartbeat) executePatchInstallCommand(payload map[string]any, rollback
 		return tools.NewErrorResult(fmt.Errorf("no patch providers available"), time.Since(start).Milliseconds())
 	}
 
+	if manifestID := tools.GetPayloadString(payload, "manifestId", ""); rollback && manifestID != "" {
+		return h.executeManifestRollback(manifestID, tools.GetPayloadBool(payload, "useSnapshot", false))
+	}
+
 	refs := h.patchRefsFromPayload(payload)
 	if len(refs) == 0 {
 		return tools.NewErrorResult(fmt.Errorf("no patches provided"), time.Since(start).Milliseconds())
@@ -2086,6 +2353,21 @@ func (h *Heartbeat) executePatchInstallCommand(payload map[string]any, rollback
 	failedCount := 0
 	rebootRequired := false
 
+	// Record installed versions (and optionally snapshot the root
+	// filesystem) so the job can be rolled back to exactly this state.
+	var tx *patching.Transaction
+	if !rollback {
+		tx = h.patchMgr.BeginTransaction()
+		if tools.GetPayloadBool(payload, "snapshot", h.config != nil && h.config.PatchSnapshotBeforeInstall) {
+			snapshot, err := patching.CreateSnapshot(tx.ID(), "Before patch job "+tx.ID())
+			if err != nil {
+				log.Warn("pre-patch snapshot failed", "error", err.Error())
+			} else {
+				tx.SetSnapshot(snapshot)
+			}
+		}
+	}
+
 	for _, ref := range refs {
 		installID, resolveErr := h.resolvePatchInstallID(ref)
 		if resolveErr != nil {
@@ -2099,7 +2381,7 @@ func (h *Heartbeat) executePatchInstallCommand(payload map[string]any, rollback
 		}
 
 		if rollback {
-			if err := h.patchMgr.Uninstall(installID); err != nil {
+			if err := h.patchMgr.RollbackPatch(installID); err != nil {
 				failedCount++
 				results = append(results, map[string]any{
 					"id":        ref.ID,
@@ -2151,10 +2433,25 @@ func (h *Heartbeat) executePatchInstallCommand(payload map[string]any, rollback
 	if rollback {
 		summary["rolledBackCount"] = successCount
 	}
+	if tx != nil {
+		manifest, err := tx.Commit()
+		if err != nil {
+			log.Warn("failed to save rollback manifest", "error", err.Error())
+		} else if manifest != nil {
+			summary["rollbackManifest"] = manifest
+		}
+	}
+
+	if successCount > 0 {
+		addServiceRestartSummary(summary, payload)
+	}
 
 	// Post-install rescan: trigger an immediate patch inventory so the
 	// dashboard reflects the new state without waiting up to 15 minutes.
 	if successCount > 0 {
+		if h.rebootMgr != nil {
+			h.rebootMgr.RefreshPendingReboot()
+		}
 		go func() {
 			log.Info("post-install patch rescan triggered", "successCount", successCount)
 			h.sendPatchInventory()
@@ -2176,6 +2473,116 @@ func (h *Heartbeat) executePatchInstallCommand(payload map[string]any, rollback
 	return tools.NewSuccessResult(summary, durationMs)
 }
 
+// executeManifestRollback reverts a patch job recorded in a rollback
+// manifest, restoring package versions or, with useSnapshot, the
+// filesystem snapshot taken before the job.
+func (h *Heartbeat) executeManifestRollback(manifestID string, useSnapshot bool) tools.CommandResult {
+	start := time.Now()
+	manifest, err := h.patchMgr.LoadRollbackManifest(manifestID)
+	if err != nil {
+		return tools.NewErrorResult(err, time.Since(start).Milliseconds())
+	}
+
+	if useSnapshot {
+		if manifest.Snapshot == nil {
+			return tools.NewErrorResult(fmt.Errorf("rollback manifest %s has no snapshot", manifestID), time.Since(start).Milliseconds())
+		}
+		if err := patching.RestoreSnapshot(*manifest.Snapshot); err != nil {
+			return tools.NewErrorResult(err, time.Since(start).Milliseconds())
+		}
+		return tools.NewSuccessResult(map[string]any{
+			"success":        true,
+			"manifestId":     manifestID,
+			"snapshot":       manifest.Snapshot,
+			"rebootRequired": true,
+		}, time.Since(start).Milliseconds())
+	}
+
+	results := make([]map[string]any, 0, len(manifest.Providers))
+	failedCount := 0
+	for _, result := range h.patchMgr.Rollback(manifest) {
+		if !result.Success {
+			failedCount++
+		}
+		results = append(results, map[string]any{
+			"provider": result.Provider,
+			"success":  result.Success,
+			"message":  result.Message,
+		})
+	}
+
+	summary := map[string]any{
+		"success":         failedCount == 0,
+		"manifestId":      manifestID,
+		"rolledBackCount": len(results) - failedCount,
+		"failedCount":     failedCount,
+		"results":         results,
+	}
+
+	if failedCount < len(results) {
+		addServiceRestartSummary(summary, nil)
+		if h.rebootMgr != nil {
+			h.rebootMgr.RefreshPendingReboot()
+		}
+		go func() {
+			log.Info("post-rollback patch rescan triggered", "manifestId", manifestID)
+			h.sendPatchInventory()
+		}()
+	}
+
+	durationMs := time.Since(start).Milliseconds()
+	if failedCount > 0 {
+		stdout, _ := json.Marshal(summary)
+		return tools.CommandResult{
+			Status:     "failed",
+			ExitCode:   1,
+			Stdout:     string(stdout),
+			Error:      fmt.Sprintf("%d provider rollbacks failed", failedCount),
+			DurationMs: durationMs,
+		}
+	}
+
+	return tools.NewSuccessResult(summary, durationMs)
+}
+
+// addServiceRestartSummary reports services still running code that a
+// patch operation replaced and, when the payload sets restartServices,
+// restarts them.
+func addServiceRestartSummary(summary map[string]any, payload map[string]any) {
+	stale := patching.FindStaleServices()
+	if len(stale) == 0 {
+		return
+	}
+
+	units := make([]string, 0, len(stale))
+	services := make([]map[string]any, 0, len(stale))
+	for _, service := range stale {
+		units = append(units, service.Unit)
+		services = append(services, map[string]any{
+			"unit":  service.Unit,
+			"pids":  service.PIDs,
+			"files": service.Files,
+		})
+	}
+	summary["servicesNeedingRestart"] = services
+
+	if !tools.GetPayloadBool(payload, "restartServices", false) {
+		return
+	}
+	restarts := make([]map[string]any, 0, len(units))
+	for _, result := range patching.RestartServices(units) {
+		if !result.Success {
+			log.Warn("service restart skipped or failed", "unit", result.Unit, "message", result.Message)
+		}
+		restarts = append(restarts, map[string]any{
+			"unit":    result.Unit,
+			"success": result.Success,
+			"message": result.Message,
+		})
+	}
+	summary["serviceRestarts"] = restarts
+}
+
 func (h *Heartbeat) patchRefsFromPayload(payload map[string]any) []patchCommandRef {
 	refs := make([]patchCommandRef, 0)
 	seen := map[string]struct{}{}
@@ -2288,14 +2695,17 @@ func (h *Heartbeat) providerForPatchRef(ref patchCommandRef) string {
 			return "homebrew"
 		}
 	case "linux":
-		if h.patchMgr.HasProvider("apt") {
-			return "apt"
-		}
-		if h.patchMgr.HasProvider("yum") {
-			return "yum"
+		for _, providerID := range []string{"apt", "yum", "zypper", "pacman", "apk"} {
+			if h.patchMgr.HasProvider(providerID) {
+				return providerID
+			}
 		}
 	case "third_party":
-		for _, providerID := range []string{"homebrew", "chocolatey", "apt", "yum"} {
+		flatpak := looksLikeFlatpakRef(patchLocalID(ref))
+		for _, providerID := range []string{"homebrew", "chocolatey", "snap", "flatpak", "apt", "yum"} {
+			if (providerID == "snap" && flatpak) || (providerID == "flatpak" && !flatpak) {
+				continue
+			}
 			if h.patchMgr.HasProvider(providerID) {
 				return providerID
 			}
@@ -2348,6 +2758,13 @@ func externalLooksLikeHomebrew(externalID string) bool {
 	return prefix == "homebrew" || prefix == "brew" || prefix == "cask"
 }
 
+// looksLikeFlatpakRef reports whether id has the shape of a flatpak ref,
+// such as org.mozilla.firefox//stable or app/org.mozilla.firefox/x86_64/stable.
+// Snap names never contain dots or slashes, so the two cannot be confused.
+func looksLikeFlatpakRef(id string) bool {
+	return strings.ContainsAny(id, "./")
+}
+
 func isSourcePrefix(prefix string) bool {
 	switch strings.ToLower(prefix) {
 	case "microsoft", "apple", "linux", "third_party", "custom":
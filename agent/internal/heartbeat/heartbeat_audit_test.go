@@ -11,7 +11,7 @@ func TestStopDoesNotPanicWhenAuditLoggerUnavailable(t *testing.T) {
 	cfg := config.Default()
 	cfg.AuditEnabled = false
 
-	h := New(cfg)
+	h := newHeartbeat(cfg, "0.1.0", nil, nil, t.TempDir())
 
 	defer func() {
 		if r := recover(); r != nil {
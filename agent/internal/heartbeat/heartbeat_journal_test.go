@@ -0,0 +1,88 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/breeze-rmm/agent/internal/cmdjournal"
+	"github.com/breeze-rmm/agent/internal/config"
+	"github.com/breeze-rmm/agent/internal/httputil"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+func TestInterruptedCommandsReportedAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "command_journal.jsonl")
+	j, err := cmdjournal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Begin("cmd-patch", tools.CmdInstallPatches)
+	j.Running("cmd-patch")
+	j.Close()
+
+	var reported map[string]tools.CommandResult
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result tools.CommandResult
+		json.NewDecoder(r.Body).Decode(&result)
+		reported = map[string]tools.CommandResult{r.URL.Path: result}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Restart: reopen the journal in a fresh agent.
+	j, err = cmdjournal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	h := &Heartbeat{
+		config:   &config.Config{ServerURL: server.URL, AgentID: "agent-1", AuthToken: "tok"},
+		client:   server.Client(),
+		retryCfg: httputil.RetryConfig{},
+		journal:  j,
+	}
+
+	h.reportInterruptedCommands()
+	result, ok := reported["/api/v1/agents/agent-1/commands/cmd-patch/result"]
+	if !ok || result.Status != "failed" || result.Code != resultCodeInterrupted {
+		t.Fatalf("interrupted command not reported: %+v", reported)
+	}
+	if rec, _ := j.Lookup("cmd-patch"); rec.State != cmdjournal.StateInterrupted {
+		t.Fatalf("journal state = %s", rec.State)
+	}
+
+	// A redelivery of the interrupted command must not run it again.
+	result = h.executeCommand(Command{ID: "cmd-patch", Type: tools.CmdInstallPatches})
+	if result.Status != "duplicate" {
+		t.Fatalf("redelivered command status = %q", result.Status)
+	}
+}
+
+func TestInterruptedCommandStaysPendingWhenReportRejected(t *testing.T) {
+	j, err := cmdjournal.Open(filepath.Join(t.TempDir(), "command_journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	j.Begin("cmd-patch", tools.CmdInstallPatches)
+	j.Running("cmd-patch")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid result", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	h := &Heartbeat{
+		config:   &config.Config{ServerURL: server.URL, AgentID: "agent-1", AuthToken: "tok"},
+		client:   server.Client(),
+		retryCfg: httputil.RetryConfig{},
+		journal:  j,
+	}
+
+	h.reportInterruptedCommands()
+	if rec, _ := j.Lookup("cmd-patch"); rec.State == cmdjournal.StateInterrupted {
+		t.Fatal("command marked interrupted although the server rejected the report")
+	}
+}
@@ -1,11 +1,16 @@
 package heartbeat
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/breeze-rmm/agent/internal/backup"
+	"github.com/breeze-rmm/agent/internal/config"
 	"github.com/breeze-rmm/agent/internal/patching"
 )
 
@@ -93,6 +98,25 @@ func TestResolvePatchInstallIDMapsLinuxSourceToApt(t *testing.T) {
 	}
 }
 
+func TestResolvePatchInstallIDRoutesThirdPartyByRefFormat(t *testing.T) {
+	h := &Heartbeat{patchMgr: patching.NewPatchManager(&heartbeatMockProvider{id: "snap"}, &heartbeatMockProvider{id: "flatpak"})}
+
+	for externalID, want := range map[string]string{
+		"org.mozilla.firefox//stable":           "flatpak:org.mozilla.firefox//stable",
+		"app/org.mozilla.firefox/x86_64/stable": "flatpak:app/org.mozilla.firefox/x86_64/stable",
+		"firefox":                               "snap:firefox",
+		"third_party:org.videolan.VLC//stable":  "flatpak:org.videolan.VLC//stable",
+	} {
+		installID, err := h.resolvePatchInstallID(patchCommandRef{ID: "platform-patch-id", Source: "third_party", ExternalID: externalID})
+		if err != nil {
+			t.Fatalf("%s: %v", externalID, err)
+		}
+		if installID != want {
+			t.Errorf("%s: got %s, want %s", externalID, installID, want)
+		}
+	}
+}
+
 func TestExecutePatchInstallCommandReportsPartialFailures(t *testing.T) {
 	provider := &heartbeatMockProvider{id: "apt"}
 	h := &Heartbeat{patchMgr: patching.NewPatchManager(provider)}
@@ -145,6 +169,57 @@ func TestExecutePatchRollbackCommandCallsProviderUninstall(t *testing.T) {
 	}
 }
 
+// heartbeatRestoringProvider can restore exact package versions.
+type heartbeatRestoringProvider struct {
+	heartbeatMockProvider
+	restored []patching.PackageChange
+}
+
+func (p *heartbeatRestoringProvider) RestoreVersions(changes []patching.PackageChange) error {
+	p.restored = append(p.restored, changes...)
+	return nil
+}
+
+func TestExecutePatchRollbackCommandRestoresManifest(t *testing.T) {
+	dataDir := t.TempDir()
+
+	manifest, _ := json.Marshal(patching.RollbackManifest{
+		ID: "rollback-20260302T101400Z-0a1b2c3d",
+		Providers: []patching.ProviderRollback{{
+			Provider: "apt",
+			Changes:  []patching.PackageChange{{Name: "openssl", From: "3.0.2-0ubuntu1.12", To: "3.0.2-0ubuntu1.15"}},
+		}},
+	})
+	if err := os.MkdirAll(filepath.Join(dataDir, "patch_rollback"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "patch_rollback", "rollback-20260302T101400Z-0a1b2c3d.json"), manifest, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &heartbeatRestoringProvider{heartbeatMockProvider: heartbeatMockProvider{id: "apt"}}
+	h := &Heartbeat{patchMgr: patching.NewPatchManager(provider)}
+	h.patchMgr.SetDataDir(dataDir)
+
+	result := h.executePatchInstallCommand(map[string]any{
+		"manifestId": "rollback-20260302T101400Z-0a1b2c3d",
+	}, true)
+	if result.Status != "completed" {
+		t.Fatalf("expected completed status, got %s: %s", result.Status, result.Error)
+	}
+	if len(provider.restored) != 1 || provider.restored[0].From != "3.0.2-0ubuntu1.12" {
+		t.Fatalf("expected openssl restored to 3.0.2-0ubuntu1.12, got %#v", provider.restored)
+	}
+	if len(provider.uninstallIDs) != 0 {
+		t.Fatalf("expected no uninstalls, got %#v", provider.uninstallIDs)
+	}
+
+	result = h.executePatchInstallCommand(map[string]any{"manifestId": "rollback-missing"}, true)
+	if result.Status == "completed" {
+		t.Fatalf("expected missing manifest to fail")
+	}
+}
+
 func TestInstalledPatchesToMapsOmitsUnknownInstalledAt(t *testing.T) {
 	h := &Heartbeat{}
 
@@ -196,3 +271,60 @@ func TestAvailablePatchesToMapsDerivesHomebrewCaskCategory(t *testing.T) {
 		t.Fatalf("expected second category homebrew, got %#v", got)
 	}
 }
+
+func TestAvailablePatchesToMapsScopesZypperAndFlatpakExternalIDs(t *testing.T) {
+	h := &Heartbeat{patchMgr: patching.NewPatchManager(&heartbeatMockProvider{id: "zypper"}, &heartbeatMockProvider{id: "flatpak"})}
+
+	items := h.availablePatchesToMaps([]patching.AvailablePatch{
+		{ID: "zypper:patch:SUSE-SLE-Module-Basesystem-15-SP5-2024-872", Provider: "zypper", Title: "SUSE-SLE-Module-Basesystem-15-SP5-2024-872"},
+		{ID: "zypper:openssl", Provider: "zypper", Title: "openssl"},
+		{ID: "flatpak:org.mozilla.firefox//stable", Provider: "flatpak", Title: "org.mozilla.firefox"},
+	})
+
+	want := []string{"zypper:patch:SUSE-SLE-Module-Basesystem-15-SP5-2024-872", "", "flatpak:org.mozilla.firefox//stable"}
+	for i, item := range items {
+		if item["externalId"] != want[i] {
+			t.Errorf("item %d: expected externalId %q, got %#v", i, want[i], item["externalId"])
+		}
+	}
+
+	installID, err := h.resolvePatchInstallID(patchCommandRef{ID: "platform-patch-id", Source: "linux", ExternalID: want[0]})
+	if err != nil || installID != want[0] {
+		t.Fatalf("expected %s, got %s (%v)", want[0], installID, err)
+	}
+}
+
+func TestRestoreEncryptorAcceptsOnlyWrappedKeys(t *testing.T) {
+	dir := t.TempDir()
+	encryptor, _, restoreKey, err := loadBackupEncryption(&config.Config{BackupEncryptionKeyFile: filepath.Join(dir, "backup_master.key")}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Heartbeat{config: &config.Config{}, backupRestoreKey: restoreKey}
+
+	otherKey, err := backup.LoadOrCreateMasterKey(filepath.Join(dir, "other.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := Command{Payload: map[string]any{"encryptionKey": base64.StdEncoding.EncodeToString(otherKey)}}
+	if _, err := restoreEncryptor(h, raw); err == nil || !strings.Contains(err.Error(), "not accepted") {
+		t.Fatalf("expected a raw key to be rejected, got %v", err)
+	}
+
+	publicPEM, err := backup.RestorePublicKeyPEM(restoreKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := backup.WrapMasterKeyForRestore(otherKey, publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := restoreEncryptor(h, Command{Payload: map[string]any{"wrappedEncryptionKey": wrapped}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := backup.NewEncryptor(otherKey)
+	if got.KeyID() != other.KeyID() || got.KeyID() == encryptor.KeyID() {
+		t.Fatalf("unwrapped key %s, want %s", got.KeyID(), other.KeyID())
+	}
+}
@@ -62,11 +62,11 @@ func TestProcessCommandSecurityThreatRemoveSubmitsCompletedResult(t *testing.T)
 	}))
 	defer ts.Close()
 
-	h := NewWithVersion(&config.Config{
+	h := newHeartbeat(&config.Config{
 		AgentID:   "agent-1",
 		ServerURL: ts.URL,
 		AuthToken: "token",
-	}, "test", nil, nil)
+	}, "test", nil, nil, t.TempDir())
 
 	h.processCommand(Command{
 		ID:   "cmd-1",
@@ -124,11 +124,11 @@ func TestProcessCommandSecurityThreatRestoreSubmitsFailedResult(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	h := NewWithVersion(&config.Config{
+	h := newHeartbeat(&config.Config{
 		AgentID:   "agent-1",
 		ServerURL: ts.URL,
 		AuthToken: "token",
-	}, "test", nil, nil)
+	}, "test", nil, nil, t.TempDir())
 
 	h.processCommand(Command{
 		ID:      "cmd-2",
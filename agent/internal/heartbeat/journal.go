@@ -0,0 +1,124 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/breeze-rmm/agent/internal/audit"
+	"github.com/breeze-rmm/agent/internal/cmdjournal"
+	"github.com/breeze-rmm/agent/internal/cmdsched"
+	"github.com/breeze-rmm/agent/internal/health"
+	"github.com/breeze-rmm/agent/internal/logging"
+	"github.com/breeze-rmm/agent/internal/outbox"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+// openJournal opens the on-disk command journal. Without it, deduplication
+// falls back to the in-memory window in markCommandSeen.
+func (h *Heartbeat) openJournal() {
+	j, err := cmdjournal.Open(filepath.Join(h.dataDir, "command_journal.jsonl"))
+	if err != nil {
+		log.Error("failed to open command journal, duplicate detection limited to memory", "error", err.Error())
+		h.healthMon.Update("command_journal", health.Degraded, err.Error())
+		return
+	}
+	h.journal = j
+}
+
+// journaled reports whether a command's lifecycle is recorded on disk.
+// Terminal and desktop session traffic is high-volume and meaningless after
+// a restart, so it only uses the in-memory window.
+func (h *Heartbeat) journaled(cmd Command) bool {
+	return h.journal != nil && !isEphemeralCommand(cmd.Type)
+}
+
+// claimCommand returns true if this is the first delivery of the command,
+// including deliveries seen before the agent last restarted.
+func (h *Heartbeat) claimCommand(cmd Command) bool {
+	if !h.journaled(cmd) {
+		return h.markCommandSeen(cmd.ID)
+	}
+	first, err := h.journal.Begin(cmd.ID, cmd.Type)
+	if err != nil {
+		log.Warn("failed to journal command", logging.KeyCommandID, cmd.ID, "error", err.Error())
+	}
+	return first
+}
+
+// releaseCommand undoes claimCommand for a command rejected before it ran,
+// so that a valid redelivery is not dropped as a duplicate.
+func (h *Heartbeat) releaseCommand(cmd Command) {
+	if !h.journaled(cmd) {
+		h.seenCommandsMu.Lock()
+		delete(h.seenCommands, cmd.ID)
+		h.seenCommandsMu.Unlock()
+		return
+	}
+	if err := h.journal.Release(cmd.ID); err != nil {
+		log.Warn("failed to release journaled command", logging.KeyCommandID, cmd.ID, "error", err.Error())
+	}
+}
+
+// journalRunning records that a claimed command has started executing.
+func (h *Heartbeat) journalRunning(cmd Command) {
+	if !h.journaled(cmd) {
+		return
+	}
+	if err := h.journal.Running(cmd.ID); err != nil {
+		log.Warn("failed to journal command start", logging.KeyCommandID, cmd.ID, "error", err.Error())
+	}
+}
+
+// journalComplete records the outcome of a command.
+func (h *Heartbeat) journalComplete(cmd Command, result tools.CommandResult) {
+	if !h.journaled(cmd) {
+		return
+	}
+	body, _ := json.Marshal(result)
+	if err := h.journal.Complete(cmd.ID, result.Status, body); err != nil {
+		log.Warn("failed to journal command result", logging.KeyCommandID, cmd.ID, "error", err.Error())
+	}
+}
+
+// resultCodeInterrupted marks the failed result of a command that was still
+// in flight when the agent stopped.
+const resultCodeInterrupted = "interrupted"
+
+// reportInterruptedCommands tells the server about commands that were still
+// in flight when the agent last stopped. A command is only marked as
+// interrupted once the report is sent or queued in the outbox, so a report
+// that failed or was rejected is retried on the next start.
+func (h *Heartbeat) reportInterruptedCommands() {
+	if h.journal == nil {
+		return
+	}
+	for _, rec := range h.journal.Interrupted() {
+		result := tools.CommandResult{
+			Status: "failed",
+			Error:  fmt.Sprintf("agent stopped while the command was %s", rec.State),
+			Code:   resultCodeInterrupted,
+		}
+		var err error
+		if jobID, due, ok := cmdsched.ParseRunID(rec.ID); ok {
+			err = h.submitScheduledRunResult(jobID, cmdsched.Run{ID: rec.ID, ScheduledAt: due, StartedAt: rec.ReceivedAt}, result)
+		} else {
+			err = h.submitCommandResult(rec.ID, result)
+		}
+		if err != nil {
+			log.Warn("failed to report interrupted command", logging.KeyCommandID, rec.ID, "permanent", outbox.IsPermanent(err), "error", err.Error())
+			continue
+		}
+		body, _ := json.Marshal(result)
+		if err := h.journal.MarkInterrupted(rec.ID, body); err != nil {
+			log.Warn("failed to journal interrupted command", logging.KeyCommandID, rec.ID, "error", err.Error())
+		}
+		log.Warn("reported interrupted command", logging.KeyCommandID, rec.ID, "type", rec.Type, "state", rec.State)
+		if h.auditLog != nil {
+			h.auditLog.Log(audit.EventCommandInterrupted, rec.ID, map[string]any{
+				"type":  rec.Type,
+				"state": rec.State,
+			})
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/config"
+	"github.com/breeze-rmm/agent/internal/health"
+	"github.com/breeze-rmm/agent/internal/httputil"
+	"github.com/breeze-rmm/agent/internal/logging"
+	"github.com/breeze-rmm/agent/internal/outbox"
+)
+
+// openOutbox opens the on-disk outbox under the data directory and routes
+// undeliverable log batches into it. Without an outbox, failed requests are
+// logged and dropped as before.
+func (h *Heartbeat) openOutbox(cfg *config.Config) {
+	maxBytes := int64(cfg.OutboxMaxSizeMB) * 1024 * 1024
+	ob, err := outbox.Open(filepath.Join(h.dataDir, "outbox"), maxBytes)
+	if err != nil {
+		log.Error("failed to open outbox, undeliverable results will be dropped", "error", err.Error())
+		h.healthMon.Update("outbox", health.Degraded, err.Error())
+		return
+	}
+	h.outbox = ob
+	logging.SetShipperSpool(h.spoolLogs)
+}
+
+// agentPath returns the API path for an agent-scoped endpoint. Outbox
+// entries store the path rather than the URL so replay follows server URL
+// changes.
+func (h *Heartbeat) agentPath(endpoint string) string {
+	return fmt.Sprintf("/api/v1/agents/%s/%s", h.config.AgentID, endpoint)
+}
+
+// deliver sends an API request, storing it in the outbox when the server
+// cannot be reached. While the outbox holds a backlog, new requests are
+// queued behind it so the server receives them in order. queued reports
+// whether the request was stored instead of sent.
+func (h *Heartbeat) deliver(entry outbox.Entry, timeout time.Duration) (queued bool, err error) {
+	if h.outbox != nil && h.outbox.Len() > 0 {
+		if err := h.outbox.Enqueue(entry); err != nil {
+			return false, fmt.Errorf("failed to queue request: %w", err)
+		}
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err = h.sendOutboxEntry(ctx, entry)
+	if err == nil || h.outbox == nil || outbox.IsPermanent(err) {
+		return false, err
+	}
+	if qerr := h.outbox.Enqueue(entry); qerr != nil {
+		return false, fmt.Errorf("%w (failed to queue request: %v)", err, qerr)
+	}
+	return true, nil
+}
+
+// sendOutboxEntry performs a stored request with the current credentials.
+// Client errors other than timeouts, rate limiting and authentication are
+// permanent: replaying the same request would be rejected again.
+func (h *Heartbeat) sendOutboxEntry(ctx context.Context, entry outbox.Entry) error {
+	headers := http.Header{
+		"Content-Type":  {"application/json"},
+		"Authorization": {h.authHeader()},
+	}
+	for k, v := range entry.Headers {
+		headers.Set(k, v)
+	}
+
+	resp, err := httputil.Do(ctx, h.client, entry.Method, h.config.ServerURL+entry.Path, entry.Body, headers, h.retryCfg)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch code := resp.StatusCode; {
+	case code >= http.StatusOK && code < http.StatusMultipleChoices:
+		return nil
+	case code == http.StatusUnauthorized, code == http.StatusRequestTimeout,
+		code == http.StatusTooManyRequests, code >= http.StatusInternalServerError:
+		return fmt.Errorf("server returned status %d", code)
+	default:
+		return outbox.Permanent(fmt.Errorf("server rejected request with status %d", code))
+	}
+}
+
+// spoolLogs stores a compressed log batch the shipper could not deliver.
+func (h *Heartbeat) spoolLogs(compressed []byte) bool {
+	err := h.outbox.Enqueue(outbox.Entry{
+		Kind:    outbox.KindLogs,
+		Method:  http.MethodPost,
+		Path:    h.agentPath("logs"),
+		Headers: map[string]string{"Content-Encoding": "gzip"},
+		Body:    compressed,
+	})
+	return err == nil
+}
@@ -0,0 +1,163 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/audit"
+	"github.com/breeze-rmm/agent/internal/cmdpolicy"
+	"github.com/breeze-rmm/agent/internal/config"
+	"github.com/breeze-rmm/agent/internal/health"
+	"github.com/breeze-rmm/agent/internal/ipc"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+// resultCodeDenied marks the failed result of a command rejected by the
+// local command policy, so the server can tell a policy decision from an
+// execution error.
+const resultCodeDenied = "denied"
+
+// sessionFollowUpCommands continue a remote session that was approved when
+// it started, so they are never prompted for consent themselves.
+var sessionFollowUpCommands = map[string]bool{
+	tools.CmdTerminalData:      true,
+	tools.CmdTerminalResize:    true,
+	tools.CmdTerminalStop:      true,
+	tools.CmdStopDesktop:       true,
+	tools.CmdDesktopStreamStop: true,
+	tools.CmdDesktopInput:      true,
+	tools.CmdDesktopConfig:     true,
+	tools.CmdScriptInput:       true,
+}
+
+// commandPolicy holds the local policy file, reloaded when it changes.
+type commandPolicy struct {
+	mu      sync.Mutex
+	path    string
+	policy  *cmdpolicy.Policy
+	modTime time.Time
+	loaded  bool
+}
+
+// current returns the policy, reloading the file if it was created,
+// modified or removed since the last call. An invalid file denies every
+// command until it is fixed.
+func (c *commandPolicy) current(h *Heartbeat) *cmdpolicy.Policy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var modTime time.Time
+	if info, err := os.Stat(c.path); err == nil {
+		modTime = info.ModTime()
+	}
+	if c.loaded && modTime.Equal(c.modTime) {
+		return c.policy
+	}
+	c.loaded = true
+	c.modTime = modTime
+
+	policy, err := cmdpolicy.Load(c.path)
+	switch {
+	case err != nil:
+		log.Error("invalid local command policy, denying all commands", "path", c.path, "error", err.Error())
+		h.healthMon.Update("command_policy", health.Unhealthy, err.Error())
+		policy = &cmdpolicy.Policy{
+			Default: cmdpolicy.ActionDeny,
+			Rules: []cmdpolicy.Rule{{
+				Commands: []string{"*"},
+				Action:   cmdpolicy.ActionDeny,
+				Reason:   "local command policy is invalid: " + err.Error(),
+			}},
+			Source: c.path,
+		}
+	case policy != nil:
+		log.Info("loaded local command policy", "path", c.path, "rules", len(policy.Rules), "default", policy.Default)
+		h.healthMon.Update("command_policy", health.Healthy, "")
+	}
+	c.policy = policy
+	return policy
+}
+
+// checkCommandPolicy applies the local command policy to cmd, prompting the
+// logged-in user when the policy requires consent. A nil error means the
+// command may run.
+func (h *Heartbeat) checkCommandPolicy(cmd Command) error {
+	if h.cmdPolicy == nil {
+		return nil
+	}
+	decision := h.cmdPolicy.current(h).Evaluate(cmd.Type, time.Now())
+	switch decision.Action {
+	case cmdpolicy.ActionAllow:
+		return nil
+	case cmdpolicy.ActionConsent:
+		if sessionFollowUpCommands[cmd.Type] {
+			return nil
+		}
+		granted, err := h.requestConsent(cmd, decision.ConsentTimeout)
+		if h.auditLog != nil {
+			details := map[string]any{"type": cmd.Type, "granted": granted}
+			if err != nil {
+				details["error"] = err.Error()
+			}
+			h.auditLog.Log(audit.EventCommandConsent, cmd.ID, details)
+		}
+		if err != nil {
+			return fmt.Errorf("%s requires user consent, which could not be obtained: %w", cmd.Type, err)
+		}
+		if !granted {
+			return fmt.Errorf("%s requires user consent, which was declined", cmd.Type)
+		}
+		return nil
+	default:
+		return errors.New(decision.Reason)
+	}
+}
+
+// requestConsent asks the user in a connected helper session to allow cmd.
+func (h *Heartbeat) requestConsent(cmd Command, timeout time.Duration) (bool, error) {
+	if h.sessionBroker == nil {
+		return false, errors.New("user helper not enabled")
+	}
+	session := h.sessionBroker.FindCapableSession("notify", "")
+	if session == nil {
+		sessions := h.sessionBroker.AllSessions()
+		if len(sessions) > 0 {
+			session = h.sessionBroker.SessionForIdentity(sessions[0].IdentityKey)
+		}
+	}
+	if session == nil {
+		return false, errors.New("no user is logged in")
+	}
+	if !session.HasScope("notify") {
+		return false, errors.New("session does not have notify scope")
+	}
+
+	req := ipc.ConsentRequest{
+		Title:          "Breeze remote support request",
+		Body:           fmt.Sprintf("Your IT administrator wants to run %q on this computer. Do you want to allow it?", cmd.Type),
+		CommandType:    cmd.Type,
+		TimeoutSeconds: int(timeout.Seconds()),
+	}
+	// Allow for the dialog to close itself before giving up on the helper.
+	resp, err := h.sessionBroker.SendCommandAndWait(session, cmd.ID+"-consent", ipc.TypeConsentRequest, req, timeout+10*time.Second)
+	if err != nil {
+		return false, err
+	}
+	if resp.Error != "" {
+		return false, errors.New(resp.Error)
+	}
+	var result ipc.ConsentResult
+	if err := json.Unmarshal(resp.Payload, &result); err != nil {
+		return false, fmt.Errorf("invalid consent result: %w", err)
+	}
+	return result.Granted, nil
+}
+
+// newCommandPolicy returns the policy holder for the local policy file.
+func newCommandPolicy() *commandPolicy {
+	return &commandPolicy{path: config.CommandPolicyPath()}
+}
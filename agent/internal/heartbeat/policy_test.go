@@ -0,0 +1,123 @@
+package heartbeat
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/health"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+func TestExecuteCommandEnforcesLocalPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "command_policy.yaml")
+	policy := `
+rules:
+  - commands: [terminal_start]
+    action: deny
+    reason: terminal disabled by clinic policy
+  - commands: [start_desktop]
+    action: consent
+`
+	if err := os.WriteFile(path, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	h := &Heartbeat{healthMon: health.NewMonitor(), cmdPolicy: &commandPolicy{path: path}}
+
+	result := h.executeCommand(Command{ID: "cmd-1", Type: tools.CmdTerminalStart})
+	if !isDenied(result) || result.Error != "terminal disabled by clinic policy" {
+		t.Fatalf("denied command: %+v", result)
+	}
+
+	// Consent cannot be obtained without a user helper.
+	result = h.executeCommand(Command{ID: "cmd-2", Type: tools.CmdStartDesktop})
+	if !isDenied(result) || !strings.Contains(result.Error, "requires user consent") {
+		t.Fatalf("consent command: %+v", result)
+	}
+
+	// Follow-up traffic of an approved session is not prompted again.
+	if err := h.checkCommandPolicy(Command{ID: "cmd-3", Type: tools.CmdTerminalData}); err != nil {
+		t.Fatalf("follow-up command: %v", err)
+	}
+
+	// An invalid edit takes effect immediately and fails closed.
+	os.WriteFile(path, []byte("rules: [{commands: [x], action: block}]"), 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	result = h.executeCommand(Command{ID: "cmd-4", Type: "collect_software"})
+	if !isDenied(result) || !strings.Contains(result.Error, "local command policy is invalid") {
+		t.Fatalf("invalid policy: %+v", result)
+	}
+
+	os.Remove(path)
+	result = h.executeCommand(Command{ID: "cmd-5", Type: "unknown_command_type"})
+	if isDenied(result) {
+		t.Fatalf("removed policy still enforced: %+v", result)
+	}
+}
+
+func isDenied(result tools.CommandResult) bool {
+	return result.Status == "failed" && result.Code == resultCodeDenied
+}
+
+// The API rejects results outside its schema with a 400, which the outbox
+// treats as permanent, so a denial it does not accept is silently lost.
+func TestDeniedResultMatchesServerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "command_policy.yaml")
+	if err := os.WriteFile(path, []byte("rules: [{commands: [terminal_start], action: deny}]"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	h := &Heartbeat{healthMon: health.NewMonitor(), cmdPolicy: &commandPolicy{path: path}}
+	denied := h.executeCommand(Command{ID: "cmd-1", Type: tools.CmdTerminalStart})
+
+	for _, schema := range []string{"routes/agents/schemas.ts", "routes/agentWs.ts"} {
+		src := readAPISource(t, schema)
+		statuses := commandResultEnum(t, src, "status")
+		codes := commandResultEnum(t, src, "code")
+		if !slices.Contains(statuses, denied.Status) || !slices.Contains(codes, denied.Code) {
+			t.Errorf("%s accepts status %v and code %v, denied result is %+v", schema, statuses, codes, denied)
+		}
+		if !slices.Contains(codes, resultCodeInterrupted) {
+			t.Errorf("%s does not accept code %q", schema, resultCodeInterrupted)
+		}
+	}
+}
+
+// readAPISource returns a file under apps/api/src, skipping the test when
+// the API is not part of the checkout.
+func readAPISource(t *testing.T, path string) string {
+	t.Helper()
+	src, err := os.ReadFile(filepath.Join("..", "..", "..", "apps", "api", "src", filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		t.Skip("API sources are not part of this checkout")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(src)
+}
+
+// commandResultEnum returns the values of a z.enum field of the command
+// result schema in a TypeScript source file.
+func commandResultEnum(t *testing.T, src, field string) []string {
+	t.Helper()
+	start := strings.Index(src, "commandResultSchema = z.object({")
+	if start < 0 {
+		t.Fatal("commandResultSchema not found")
+	}
+	block := src[start:]
+	block = block[:strings.Index(block, "});")]
+	match := regexp.MustCompile(`\n\s*` + field + `: z\.enum\(\[([^\]]*)\]\)`).FindStringSubmatch(block)
+	if match == nil {
+		t.Fatalf("no %s enum in commandResultSchema", field)
+	}
+	var values []string
+	for _, value := range strings.Split(match[1], ",") {
+		values = append(values, strings.Trim(strings.TrimSpace(value), `'"`))
+	}
+	return values
+}
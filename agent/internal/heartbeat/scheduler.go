@@ -0,0 +1,91 @@
+package heartbeat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/cmdsched"
+	"github.com/breeze-rmm/agent/internal/health"
+	"github.com/breeze-rmm/agent/internal/logging"
+	"github.com/breeze-rmm/agent/internal/outbox"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+// openScheduler loads the agent-side command schedule. Jobs start running
+// when Start launches the scheduler.
+func (h *Heartbeat) openScheduler() {
+	s, err := cmdsched.Open(filepath.Join(h.dataDir, "scheduled_jobs.json"), h.runScheduledJob)
+	if err != nil {
+		log.Error("failed to load scheduled jobs, agent-side scheduling disabled", "error", err.Error())
+		h.healthMon.Update("command_scheduler", health.Degraded, err.Error())
+		return
+	}
+	h.scheduler = s
+}
+
+// runScheduledJob executes one run of a scheduled job through the normal
+// command path, so the journal, local policy and audit log apply as they do
+// to server-pushed commands. The signature was checked when the job was
+// scheduled. The result is delivered, or queued in the outbox if the server
+// is unreachable.
+func (h *Heartbeat) runScheduledJob(job cmdsched.Job, run cmdsched.Run) string {
+	if !h.accepting.Load() {
+		log.Warn("skipping scheduled job, agent shutting down", "jobId", job.ID)
+		return "skipped"
+	}
+
+	result := h.executeCommand(Command{
+		ID:        run.ID,
+		Type:      job.CommandType,
+		Payload:   job.CommandPayload,
+		scheduled: true,
+	})
+	if result.Status == "duplicate" {
+		return result.Status
+	}
+	if err := h.submitScheduledRunResult(job.ID, run, result); err != nil {
+		log.Error("failed to submit scheduled job result", "jobId", job.ID, logging.KeyCommandID, run.ID, "error", err.Error())
+	}
+	return result.Status
+}
+
+// scheduledRunReport is the body posted for each scheduled job run.
+type scheduledRunReport struct {
+	RunID       string              `json:"runId"`
+	ScheduledAt time.Time           `json:"scheduledAt"`
+	StartedAt   time.Time           `json:"startedAt"`
+	Missed      bool                `json:"missed,omitempty"`
+	Result      tools.CommandResult `json:"result"`
+}
+
+func (h *Heartbeat) submitScheduledRunResult(jobID string, run cmdsched.Run, result tools.CommandResult) error {
+	body, err := json.Marshal(scheduledRunReport{
+		RunID:       run.ID,
+		ScheduledAt: run.ScheduledAt.UTC(),
+		StartedAt:   run.StartedAt.UTC(),
+		Missed:      run.Missed,
+		Result:      result,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal scheduled run: %w", err)
+	}
+
+	queued, err := h.deliver(outbox.Entry{
+		Key:    "scheduled-run:" + run.ID,
+		Kind:   outbox.KindCommandResult,
+		Method: http.MethodPost,
+		Path:   h.agentPath("scheduled-jobs/" + url.PathEscape(jobID) + "/runs"),
+		Body:   body,
+	}, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("submit scheduled run failed: %w", err)
+	}
+	if queued {
+		log.Info("scheduled job result queued in outbox", "jobId", jobID, logging.KeyCommandID, run.ID, "status", result.Status)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package heartbeat
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/breeze-rmm/agent/internal/cmdsched"
+	"github.com/breeze-rmm/agent/internal/cmdsign"
+	"github.com/breeze-rmm/agent/internal/config"
+	"github.com/breeze-rmm/agent/internal/health"
+	"github.com/breeze-rmm/agent/internal/httputil"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+func TestScheduleCommandRequiresSignatureForHighRiskJobs(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	verifier, err := cmdsign.NewVerifier(pub, "agent-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Heartbeat{cmdVerifier: verifier}
+
+	result := h.executeCommand(Command{
+		ID:   "cmd-1",
+		Type: tools.CmdScheduleCommand,
+		Payload: map[string]any{
+			"commandType":    tools.CmdScript,
+			"commandPayload": map[string]any{"content": "id"},
+			"schedule":       "@weekly",
+		},
+	})
+	if result.Status != "failed" || !strings.Contains(result.Error, cmdsign.ErrUnsigned.Error()) {
+		t.Fatalf("unsigned scheduled script: %+v", result)
+	}
+
+	// Runs of a job accepted earlier are not re-verified.
+	if err := h.verifyCommand(Command{ID: "sched:job:1", Type: tools.CmdScript, scheduled: true}); err != nil {
+		t.Fatalf("scheduled run was re-verified: %v", err)
+	}
+}
+
+func TestScheduledRunsHonourLocalPolicy(t *testing.T) {
+	dir := t.TempDir()
+	policyPath := filepath.Join(dir, "command_policy.yaml")
+	policy := "rules:\n  - commands: [collect_software]\n    action: deny\n"
+	if err := os.WriteFile(policyPath, []byte(policy), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var uploaded string
+	var report scheduledRunReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&report)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	h := &Heartbeat{
+		config:    &config.Config{ServerURL: server.URL, AgentID: "agent-1", AuthToken: "tok"},
+		client:    server.Client(),
+		retryCfg:  httputil.RetryConfig{},
+		healthMon: health.NewMonitor(),
+		cmdPolicy: &commandPolicy{path: policyPath},
+	}
+	h.accepting.Store(true)
+	scheduler, err := cmdsched.Open(filepath.Join(dir, "jobs.json"), h.runScheduledJob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.scheduler = scheduler
+
+	result := h.executeCommand(Command{
+		ID:      "cmd-1",
+		Type:    tools.CmdScheduleCommand,
+		Payload: map[string]any{"commandType": tools.CmdTerminalStart, "schedule": "@daily"},
+	})
+	if result.Status != "failed" || !strings.Contains(result.Error, "cannot be scheduled") {
+		t.Fatalf("ephemeral command was scheduled: %+v", result)
+	}
+
+	result = h.executeCommand(Command{
+		ID:      "cmd-2",
+		Type:    tools.CmdScheduleCommand,
+		Payload: map[string]any{"jobId": "inventory", "commandType": tools.CmdCollectSoftware, "schedule": "@daily"},
+	})
+	if result.Status != "completed" {
+		t.Fatalf("schedule_command failed: %+v", result)
+	}
+	job := scheduler.List()[0]
+
+	// The run is denied by policy and the outcome is uploaded for the job.
+	runID := cmdsched.RunID(job.ID, job.Due)
+	status := h.runScheduledJob(job, cmdsched.Run{ID: runID, ScheduledAt: job.Due})
+	if status != "failed" {
+		t.Fatalf("scheduled run status %q, want failed", status)
+	}
+	if uploaded != "/api/v1/agents/agent-1/scheduled-jobs/inventory/runs" || report.RunID != runID || report.Result.Code != resultCodeDenied {
+		t.Fatalf("unexpected upload to %s: %+v", uploaded, report)
+	}
+
+	result = h.executeCommand(Command{ID: "cmd-3", Type: tools.CmdScheduleCancel, Payload: map[string]any{"jobId": "inventory"}})
+	if result.Status != "completed" || len(scheduler.List()) != 0 {
+		t.Fatalf("schedule_cancel failed: %+v", result)
+	}
+}
+
+func TestScheduledRunReportMatchesServerRoute(t *testing.T) {
+	route := readAPISource(t, "routes/agents/scheduledJobs.ts")
+	if !strings.Contains(route, "'/:id/scheduled-jobs/:jobId/runs'") {
+		t.Fatal("API has no scheduled job runs route")
+	}
+	if !strings.Contains(readAPISource(t, "routes/agents/index.ts"), "agentRoutes.route('/', scheduledJobsRoutes)") {
+		t.Fatal("scheduled job runs route is not mounted")
+	}
+	start := strings.Index(route, "submitScheduledRunSchema = z.object({")
+	if start < 0 {
+		t.Fatal("submitScheduledRunSchema not found")
+	}
+	schema := route[start : start+strings.Index(route[start:], "});")]
+	fields := reflect.TypeFor[scheduledRunReport]()
+	for i := range fields.NumField() {
+		name, _, _ := strings.Cut(fields.Field(i).Tag.Get("json"), ",")
+		if !strings.Contains(schema, "\n  "+name+": ") {
+			t.Errorf("server schema does not accept %q", name)
+		}
+	}
+}
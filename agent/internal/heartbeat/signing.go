@@ -0,0 +1,71 @@
+package heartbeat
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+
+	"github.com/breeze-rmm/agent/internal/cmdsign"
+	"github.com/breeze-rmm/agent/internal/config"
+	"github.com/breeze-rmm/agent/internal/health"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+// signedCommandTypes are the high-risk commands that must carry a valid org
+// signature when signed command mode is enabled.
+var signedCommandTypes = map[string]bool{
+	tools.CmdScript:          true,
+	tools.CmdRunScript:       true,
+	tools.CmdFileWrite:       true,
+	tools.CmdRegistrySet:     true,
+	tools.CmdSoftwareInstall: true,
+	tools.CmdDevUpdate:       true,
+	tools.CmdComputerAction:  true,
+}
+
+// initCommandVerifier enables signed command mode when the config requires
+// it. A missing or unparseable pinned key leaves the verifier without a key,
+// so high-risk commands fail closed.
+func (h *Heartbeat) initCommandVerifier(cfg *config.Config) {
+	if !cfg.RequireSignedCommands {
+		return
+	}
+
+	var key ed25519.PublicKey
+	if cfg.CommandSigningPublicKey == "" {
+		log.Error("signed commands required but no signing key is pinned; high-risk commands will be rejected")
+		h.healthMon.Update("command_signing", health.Unhealthy, "no signing key pinned")
+	} else if parsed, err := cmdsign.ParsePublicKey(cfg.CommandSigningPublicKey); err != nil {
+		log.Error("invalid command signing key; high-risk commands will be rejected", "error", err.Error())
+		h.healthMon.Update("command_signing", health.Unhealthy, err.Error())
+	} else {
+		key = parsed
+		log.Info("signed command mode enabled", "keyId", cmdsign.KeyID(key))
+	}
+
+	verifier, err := cmdsign.NewVerifier(key, cfg.AgentID, filepath.Join(h.dataDir, "command_nonces.json"))
+	if err != nil {
+		log.Warn("failed to load command nonce store, replay protection limited to memory", "error", err.Error())
+		verifier, _ = cmdsign.NewVerifier(key, cfg.AgentID, "")
+	}
+	h.cmdVerifier = verifier
+}
+
+// requiresSignature reports whether cmd is high-risk. Scheduling a
+// high-risk command is itself high-risk: the runs of a scheduled job are not
+// verified again, since its signature will have expired by the time they
+// come due.
+func requiresSignature(cmd Command) bool {
+	if cmd.Type == tools.CmdScheduleCommand {
+		return signedCommandTypes[tools.GetPayloadString(cmd.Payload, "commandType", "")]
+	}
+	return signedCommandTypes[cmd.Type]
+}
+
+// verifyCommand returns an error if signed command mode is enabled and cmd
+// is a high-risk command without a valid, unexpired, unused signature.
+func (h *Heartbeat) verifyCommand(cmd Command) error {
+	if h.cmdVerifier == nil || cmd.scheduled || !requiresSignature(cmd) {
+		return nil
+	}
+	return h.cmdVerifier.Verify(cmd.ID, cmd.Type, cmd.Payload, cmd.Signature)
+}
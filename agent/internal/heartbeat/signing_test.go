@@ -0,0 +1,93 @@
+package heartbeat
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/cmdjournal"
+	"github.com/breeze-rmm/agent/internal/cmdsign"
+	"github.com/breeze-rmm/agent/internal/remote/tools"
+)
+
+func TestExecuteCommandRejectsUnsignedHighRiskCommands(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	verifier, err := cmdsign.NewVerifier(pub, "agent-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Heartbeat{cmdVerifier: verifier}
+
+	result := h.executeCommand(Command{
+		ID:      "cmd-1",
+		Type:    tools.CmdScript,
+		Payload: map[string]any{"content": "id"},
+	})
+	if result.Status != "failed" || !strings.Contains(result.Error, cmdsign.ErrUnsigned.Error()) {
+		t.Fatalf("unsigned script: %+v", result)
+	}
+
+	result = h.executeCommand(Command{
+		ID:        "cmd-2",
+		Type:      tools.CmdFileWrite,
+		Payload:   map[string]any{"path": "/etc/passwd"},
+		Signature: &cmdsign.Signature{Nonce: "n", Value: "AAAA"},
+	})
+	if result.Status != "failed" || !strings.Contains(result.Error, "command rejected") {
+		t.Fatalf("forged signature: %+v", result)
+	}
+
+	// Low-risk commands do not need a signature.
+	result = h.executeCommand(Command{ID: "cmd-3", Type: "unknown_command_type"})
+	if !strings.Contains(result.Error, "unknown command type") {
+		t.Fatalf("low-risk command was not dispatched: %+v", result)
+	}
+}
+
+func TestExecuteCommandRunsSignedRedeliveryAfterRejection(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	verifier, err := cmdsign.NewVerifier(pub, "agent-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	journal, err := cmdjournal.Open(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	h := &Heartbeat{cmdVerifier: verifier, journal: journal}
+
+	target := filepath.Join(dir, "out.txt")
+	cmd := Command{
+		ID:      "cmd-1",
+		Type:    tools.CmdFileWrite,
+		Payload: map[string]any{"path": target, "content": "signed"},
+	}
+	if result := h.executeCommand(cmd); !strings.Contains(result.Error, "command rejected") {
+		t.Fatalf("unsigned delivery: %+v", result)
+	}
+
+	now := time.Now()
+	cmd.Signature = &cmdsign.Signature{Nonce: "nonce-1", IssuedAt: now, ExpiresAt: now.Add(time.Minute)}
+	msg, err := cmdsign.Message("agent-1", cmd.ID, cmd.Type, cmd.Payload, cmd.Signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Signature.Value = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, msg))
+
+	if result := h.executeCommand(cmd); result.Status == "duplicate" || result.Status == "failed" {
+		t.Fatalf("signed redelivery: %+v", result)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "signed" {
+		t.Fatalf("signed command did not run: %q, %v", data, err)
+	}
+	if result := h.executeCommand(cmd); result.Status != "duplicate" {
+		t.Fatalf("second signed delivery should be a duplicate, got %+v", result)
+	}
+}
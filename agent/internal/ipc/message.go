@@ -32,6 +32,10 @@ const (
 	TypeSASRequest  = "sas_request"
 	TypeSASResponse = "sas_response"
 
+	// Local command policy consent prompts
+	TypeConsentRequest = "consent_request"
+	TypeConsentResult  = "consent_result"
+
 	// Desktop peer disconnected — helper notifies service when WebRTC drops
 	TypeDesktopPeerDisconnected = "desktop_peer_disconnected"
 )
@@ -116,6 +120,20 @@ type NotifyResult struct {
 	ActionClicked string `json:"actionClicked,omitempty"`
 }
 
+// ConsentRequest asks the logged-in user to allow a command required by the
+// local command policy to have consent.
+type ConsentRequest struct {
+	Title          string `json:"title"`
+	Body           string `json:"body"`
+	CommandType    string `json:"commandType"`
+	TimeoutSeconds int    `json:"timeoutSeconds"`
+}
+
+// ConsentResult is the user's answer to a ConsentRequest.
+type ConsentResult struct {
+	Granted bool `json:"granted"`
+}
+
 // TrayUpdate tells the user helper to update the system tray icon/menu.
 type TrayUpdate struct {
 	Status    string     `json:"status"`
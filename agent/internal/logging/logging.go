@@ -176,6 +176,18 @@ func SetShipperLevel(level string) bool {
 	return false
 }
 
+// SetShipperSpool installs a SpoolFunc on the active log shipper so batches
+// that cannot be delivered are persisted rather than dropped. No-op if the
+// shipper is not initialized.
+func SetShipperSpool(fn SpoolFunc) {
+	shipperMu.RLock()
+	defer shipperMu.RUnlock()
+
+	if globalShipper != nil {
+		globalShipper.SetSpool(fn)
+	}
+}
+
 // DroppedLogCount returns the number of log entries dropped since the last
 // commit. The counter is NOT reset; call CommitDroppedLogCount after a
 // successful heartbeat to clear it.
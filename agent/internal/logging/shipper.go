@@ -50,10 +50,15 @@ type Shipper struct {
 	wg           sync.WaitGroup
 	stopOnce     sync.Once
 	minLevel     slog.Level
-	mu           sync.RWMutex // protects minLevel
+	spool        SpoolFunc
+	mu           sync.RWMutex // protects minLevel and spool
 	droppedCount atomic.Int64
 }
 
+// SpoolFunc persists a gzip-compressed batch that could not be delivered so
+// it can be replayed later. It returns false if the batch was not stored.
+type SpoolFunc func(compressed []byte) bool
+
 // ShipperConfig configures the log shipper.
 type ShipperConfig struct {
 	ServerURL    string
@@ -116,6 +121,27 @@ func (s *Shipper) SetMinLevel(level string) {
 	s.minLevel = parseLevel(level)
 }
 
+// SetSpool installs a SpoolFunc that receives batches which failed with a
+// network or server error instead of counting them as dropped.
+func (s *Shipper) SetSpool(fn SpoolFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spool = fn
+}
+
+// spoolBatch hands an undeliverable batch to the spool, falling back to
+// counting its entries as dropped.
+func (s *Shipper) spoolBatch(compressed []byte, count int) {
+	s.mu.RLock()
+	spool := s.spool
+	s.mu.RUnlock()
+	if spool != nil && spool(compressed) {
+		fmt.Fprintf(os.Stderr, "[log-shipper] spooled %d entries for later delivery\n", count)
+		return
+	}
+	s.droppedCount.Add(int64(count))
+}
+
 // ShouldShip returns true if the given level meets the minimum threshold.
 func (s *Shipper) ShouldShip(level slog.Level) bool {
 	s.mu.RLock()
@@ -229,7 +255,7 @@ func (s *Shipper) shipBatch(entries []LogEntry) {
 				continue
 			}
 			fmt.Fprintf(os.Stderr, "[log-shipper] HTTP error (giving up after %d attempts): %v\n", shipRetryCount+1, err)
-			s.droppedCount.Add(int64(len(entries)))
+			s.spoolBatch(compressedBytes, len(entries))
 			return
 		}
 
@@ -245,7 +271,7 @@ func (s *Shipper) shipBatch(entries []LogEntry) {
 			}
 			fmt.Fprintf(os.Stderr, "[log-shipper] server returned %d (giving up after %d attempts): %s\n",
 				resp.StatusCode, shipRetryCount+1, string(body))
-			s.droppedCount.Add(int64(len(entries)))
+			s.spoolBatch(compressedBytes, len(entries))
 			return
 		}
 
@@ -289,3 +289,49 @@ func TestShipBatchURLFormat(t *testing.T) {
 		t.Fatalf("unexpected URL path: %s", receivedPath)
 	}
 }
+
+func TestShipBatchSpoolsOnServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	s := NewShipper(ShipperConfig{
+		ServerURL:  server.URL,
+		AgentID:    "abc-123",
+		AuthToken:  testToken("tok"),
+		HTTPClient: server.Client(),
+	})
+
+	var spooled [][]byte
+	s.SetSpool(func(compressed []byte) bool {
+		spooled = append(spooled, compressed)
+		return true
+	})
+	s.shipBatch([]LogEntry{{Message: "one"}, {Message: "two"}})
+
+	if len(spooled) != 1 {
+		t.Fatalf("expected the batch to be spooled once, got %d", len(spooled))
+	}
+	if dropped := s.DroppedLogCount(); dropped != 0 {
+		t.Fatalf("spooled entries counted as dropped: %d", dropped)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(spooled[0]))
+	if err != nil {
+		t.Fatalf("spooled batch is not gzip: %v", err)
+	}
+	defer gr.Close()
+	var payload struct {
+		Logs []LogEntry `json:"logs"`
+	}
+	if err := json.NewDecoder(gr).Decode(&payload); err != nil || len(payload.Logs) != 2 {
+		t.Fatalf("unexpected spooled payload: %+v, %v", payload, err)
+	}
+
+	// A full spool falls back to counting the entries as dropped.
+	s.SetSpool(func([]byte) bool { return false })
+	s.shipBatch([]LogEntry{{Message: "three"}})
+	if dropped := s.DroppedLogCount(); dropped != 1 {
+		t.Fatalf("expected 1 dropped entry, got %d", dropped)
+	}
+}
@@ -0,0 +1,281 @@
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+const tcpDialTimeout = 3 * time.Second
+
+var (
+	errNotFound   = errors.New("not found")
+	errPortClosed = errors.New("port not listening")
+)
+
+// metricSamplers maps each metric watch type to the function sampling it
+// for a watch name.
+var metricSamplers = map[WatchType]func(name string) (metricSample, error){
+	WatchTypeDiskFree:        sampleDiskFree,
+	WatchTypeInodes:          sampleInodes,
+	WatchTypeLoad:            sampleLoad,
+	WatchTypeMemoryPressure:  sampleMemoryPressure,
+	WatchTypeMemoryUsed:      sampleMemoryUsed,
+	WatchTypeFileDescriptors: sampleFileDescriptors,
+	WatchTypeTCPPort:         sampleTCPPort,
+	WatchTypeFileAge:         sampleFileAge,
+	WatchTypeFileSize:        sampleFileSize,
+}
+
+// checkMetric samples a metric watch and evaluates it against the watch's
+// levels and rate rules.
+func (m *Monitor) checkMetric(w WatchConfig, sample func(name string) (metricSample, error)) CheckResult {
+	reading, err := sample(w.Name)
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := w.WatchType + ":" + w.Name
+	state, ok := m.states[key]
+	if !ok {
+		state = &watchState{}
+		m.states[key] = state
+	}
+
+	if err != nil {
+		status := StatusError
+		switch {
+		case errors.Is(err, errNotFound), errors.Is(err, fs.ErrNotExist):
+			status = StatusNotFound
+		case errors.Is(err, errPortClosed):
+			status = StatusCritical
+			state.level = StatusCritical
+		}
+		return CheckResult{
+			Status:  status,
+			Details: map[string]any{"error": err.Error()},
+		}
+	}
+	return evaluateMetric(w, state, reading, now)
+}
+
+func sampleDiskFree(path string) (metricSample, error) {
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return metricSample{}, fmt.Errorf("failed to read disk usage for %s: %w", path, err)
+	}
+	if usage.Total == 0 {
+		return metricSample{}, fmt.Errorf("filesystem at %s reports zero size", path)
+	}
+	return metricSample{
+		value:  100 - usage.UsedPercent,
+		unit:   "percent",
+		growth: float64(usage.Used),
+		details: map[string]any{
+			"path":       usage.Path,
+			"fstype":     usage.Fstype,
+			"totalBytes": usage.Total,
+			"freeBytes":  usage.Free,
+			"usedBytes":  usage.Used,
+		},
+	}, nil
+}
+
+func sampleInodes(path string) (metricSample, error) {
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return metricSample{}, fmt.Errorf("failed to read inode usage for %s: %w", path, err)
+	}
+	if usage.InodesTotal == 0 {
+		return metricSample{}, fmt.Errorf("filesystem at %s does not report inode counts", path)
+	}
+	return metricSample{
+		value:  usage.InodesUsedPercent,
+		unit:   "percent",
+		growth: float64(usage.InodesUsed),
+		details: map[string]any{
+			"path":        usage.Path,
+			"fstype":      usage.Fstype,
+			"inodesTotal": usage.InodesTotal,
+			"inodesUsed":  usage.InodesUsed,
+			"inodesFree":  usage.InodesFree,
+		},
+	}, nil
+}
+
+func sampleLoad(window string) (metricSample, error) {
+	avg, err := load.Avg()
+	if err != nil {
+		return metricSample{}, fmt.Errorf("failed to read load average: %w", err)
+	}
+	var value float64
+	switch window {
+	case "", "1", "1m":
+		value = avg.Load1
+	case "5", "5m":
+		value = avg.Load5
+	case "15", "15m":
+		value = avg.Load15
+	default:
+		return metricSample{}, fmt.Errorf("unknown load window %q (use 1m, 5m or 15m)", window)
+	}
+	return metricSample{
+		value:  value,
+		unit:   "load",
+		growth: value,
+		details: map[string]any{
+			"load1":  avg.Load1,
+			"load5":  avg.Load5,
+			"load15": avg.Load15,
+		},
+	}, nil
+}
+
+func sampleMemoryPressure(string) (metricSample, error) {
+	// Pressure stall information is the kernel's own measure of time lost
+	// waiting on memory, unlike memory in use, which page cache inflates.
+	some, full, ok := memoryStall()
+	if !ok {
+		return metricSample{}, errors.New("memory pressure stall information is not available on this system; use memory_used")
+	}
+	return metricSample{
+		value:  some,
+		unit:   "percent",
+		growth: some,
+		details: map[string]any{
+			"stallSomeAvg10": some,
+			"stallFullAvg10": full,
+		},
+	}, nil
+}
+
+func sampleMemoryUsed(string) (metricSample, error) {
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		return metricSample{}, fmt.Errorf("failed to read memory usage: %w", err)
+	}
+	if vm.Total == 0 {
+		return metricSample{}, errors.New("system reports zero memory")
+	}
+	inUse := float64(vm.Total-vm.Available) / float64(vm.Total) * 100
+	details := map[string]any{
+		"totalBytes":     vm.Total,
+		"availableBytes": vm.Available,
+	}
+	if swap, err := mem.SwapMemory(); err == nil && swap.Total > 0 {
+		details["swapUsedPercent"] = swap.UsedPercent
+	}
+	return metricSample{
+		value:   inUse,
+		unit:    "percent",
+		growth:  inUse,
+		details: details,
+	}, nil
+}
+
+func sampleFileDescriptors(name string) (metricSample, error) {
+	if name == "" || strings.EqualFold(name, "system") {
+		open, limit, err := systemOpenFiles()
+		if err != nil {
+			return metricSample{}, err
+		}
+		details := map[string]any{}
+		if limit > 0 {
+			details["limit"] = limit
+		}
+		return metricSample{value: float64(open), unit: "count", growth: float64(open), details: details}, nil
+	}
+
+	procs, err := process.Processes()
+	if err != nil {
+		return metricSample{}, fmt.Errorf("failed to list processes: %w", err)
+	}
+	var total int64
+	matched := 0
+	for _, p := range procs {
+		pName, err := p.Name()
+		if err != nil || !matchesProcessName(pName, name) {
+			continue
+		}
+		fds, err := p.NumFDs()
+		if err != nil {
+			log.Warn("failed to count open files for process", "name", name, "pid", p.Pid, "error", err.Error())
+			continue
+		}
+		total += int64(fds)
+		matched++
+	}
+	if matched == 0 {
+		return metricSample{}, fmt.Errorf("process %s: %w", name, errNotFound)
+	}
+	return metricSample{
+		value:   float64(total),
+		unit:    "count",
+		growth:  float64(total),
+		details: map[string]any{"processes": matched},
+	}, nil
+}
+
+func sampleTCPPort(target string) (metricSample, error) {
+	address := target
+	if !strings.Contains(address, ":") {
+		address = net.JoinHostPort("localhost", address)
+	}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, tcpDialTimeout)
+	if err != nil {
+		return metricSample{}, fmt.Errorf("%w: %s: %v", errPortClosed, address, err)
+	}
+	conn.Close()
+	ms := float64(time.Since(start).Microseconds()) / 1000
+	return metricSample{
+		value:   ms,
+		unit:    "ms",
+		growth:  ms,
+		details: map[string]any{"address": address},
+	}, nil
+}
+
+func sampleFileAge(path string) (metricSample, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return metricSample{}, err
+	}
+	hours := time.Since(info.ModTime()).Hours()
+	return metricSample{
+		value:  hours,
+		unit:   "hours",
+		growth: hours,
+		details: map[string]any{
+			"modifiedAt": info.ModTime().UTC().Format(time.RFC3339),
+			"sizeBytes":  info.Size(),
+		},
+	}, nil
+}
+
+func sampleFileSize(path string) (metricSample, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return metricSample{}, err
+	}
+	if info.IsDir() {
+		return metricSample{}, fmt.Errorf("%s is a directory", path)
+	}
+	return metricSample{
+		value:  float64(info.Size()),
+		unit:   "bytes",
+		growth: float64(info.Size()),
+		details: map[string]any{
+			"modifiedAt": info.ModTime().UTC().Format(time.RFC3339),
+		},
+	}, nil
+}
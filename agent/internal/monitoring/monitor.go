@@ -13,7 +13,7 @@ var log = logging.L("monitoring")
 // SendResultsFunc is a callback that ships check results to the API.
 type SendResultsFunc func(results []CheckResult)
 
-// Monitor manages the lifecycle of service and process watches.
+// Monitor manages the lifecycle of service, process and metric watches.
 type Monitor struct {
 	mu          sync.RWMutex
 	config      MonitorConfig
@@ -28,6 +28,16 @@ type watchState struct {
 	consecutiveFailures int
 	lastRestartAttempt  time.Time
 	restartAttempts     int
+
+	// lastRun is the tick at which the watch last ran, for watches with
+	// their own interval.
+	lastRun time.Time
+
+	// Metric watches: the current threshold and rate levels (held for
+	// hysteresis) and the samples the rate is measured over.
+	level     CheckStatus
+	rateLevel CheckStatus
+	history   []rateSample
 }
 
 // New creates a new Monitor with the given results callback.
@@ -145,8 +155,13 @@ func (m *Monitor) runChecks() {
 	}
 
 	var results []CheckResult
+	now := time.Now()
 
 	for _, w := range watches {
+		if !m.due(w, now) {
+			continue
+		}
+
 		var result CheckResult
 
 		switch w.WatchType {
@@ -155,6 +170,14 @@ func (m *Monitor) runChecks() {
 		case WatchTypeProcess:
 			result = checkProcess(w.Name, w.CpuThresholdPercent, w.MemoryThresholdMb)
 		default:
+			if isSyntheticWatch(w.WatchType) {
+				result = checkSynthetic(w)
+				break
+			}
+			if sample, ok := metricSamplers[w.WatchType]; ok {
+				result = m.checkMetric(w, sample)
+				break
+			}
 			result = CheckResult{
 				WatchType: w.WatchType,
 				Name:      w.Name,
@@ -167,7 +190,8 @@ func (m *Monitor) runChecks() {
 		result.Name = w.Name
 
 		// Handle auto-restart (maybeAutoRestart sets AutoRestartSucceeded on result directly)
-		if result.Status != StatusRunning && w.AutoRestart {
+		restartable := w.WatchType == WatchTypeService || w.WatchType == WatchTypeProcess
+		if result.Status != StatusRunning && restartable && w.AutoRestart {
 			attempted, _ := m.maybeAutoRestart(w, &result)
 			result.AutoRestartAttempted = attempted
 		}
@@ -181,12 +205,17 @@ func (m *Monitor) runChecks() {
 			m.states[key] = state
 		}
 
-		if result.Status != StatusRunning {
+		if !isHealthy(result.Status) {
 			state.consecutiveFailures++
 		} else {
 			state.consecutiveFailures = 0
 			state.restartAttempts = 0
 		}
+		result.ConsecutiveFailures = state.consecutiveFailures
+		if isSyntheticWatch(w.WatchType) && result.Status == StatusCritical &&
+			state.consecutiveFailures < w.AlertAfterConsecutiveFailures {
+			result.Status = StatusWarning
+		}
 		m.mu.Unlock()
 
 		results = append(results, result)
@@ -197,6 +226,29 @@ func (m *Monitor) runChecks() {
 	}
 }
 
+// due reports whether a watch should run at this tick, recording the run
+// if so. Watches without their own interval run on every tick.
+func (m *Monitor) due(w WatchConfig, now time.Time) bool {
+	if w.IntervalSeconds <= 0 {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := w.WatchType + ":" + w.Name
+	state, ok := m.states[key]
+	if !ok {
+		state = &watchState{}
+		m.states[key] = state
+	}
+	// Allow a second of slack so ticker jitter does not skip a whole tick.
+	interval := time.Duration(w.IntervalSeconds)*time.Second - time.Second
+	if !state.lastRun.IsZero() && now.Sub(state.lastRun) < interval {
+		return false
+	}
+	state.lastRun = now
+	return true
+}
+
 func (m *Monitor) maybeAutoRestart(w WatchConfig, result *CheckResult) (attempted, succeeded bool) {
 	m.mu.Lock()
 	key := w.WatchType + ":" + w.Name
@@ -0,0 +1,397 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Probe statuses, matching the one-shot network check commands.
+const (
+	ProbeOnline   = "online"
+	ProbeOffline  = "offline"
+	ProbeDegraded = "degraded"
+)
+
+const maxProbeBody = 1 << 20 // 1MB
+
+// ProbeResult is the outcome of a synthetic HTTP, TLS or DNS probe. A probe
+// that could not reach its target is offline; one that did but failed an
+// assertion is degraded, with the reasons in Failures.
+type ProbeResult struct {
+	Status     string
+	ResponseMs float64
+	Error      string
+	Failures   []string
+
+	StatusCode int
+	BodyMatch  *bool
+
+	CertExpiry        time.Time
+	CertDaysRemaining *int
+	CertSubject       string
+	CertIssuer        string
+
+	Records []string
+	Matched *bool
+}
+
+func (r *ProbeResult) fail(format string, args ...any) {
+	r.Status = ProbeDegraded
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+func (r *ProbeResult) recordCertificate(state *tls.ConnectionState) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return
+	}
+	cert := state.PeerCertificates[0]
+	days := int(time.Until(cert.NotAfter).Hours() / 24)
+	r.CertExpiry = cert.NotAfter
+	r.CertDaysRemaining = &days
+	r.CertSubject = cert.Subject.CommonName
+	r.CertIssuer = cert.Issuer.CommonName
+}
+
+// HTTPProbe describes an HTTP(S) request and the response it expects.
+type HTTPProbe struct {
+	URL    string
+	Method string
+	// ExpectedStatus defaults to 200.
+	ExpectedStatus int
+	// ExpectedBody must appear in the body; BodyPattern must match it.
+	ExpectedBody    string
+	BodyPattern     *regexp.Regexp
+	VerifyTLS       bool
+	FollowRedirects bool
+	Timeout         time.Duration
+}
+
+// ProbeHTTP performs the request and checks the status code and body.
+func ProbeHTTP(p HTTPProbe) ProbeResult {
+	method := p.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	expectedStatus := p.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+
+	// Each probe gets its own transport, so keep-alive connections would
+	// only pile up idle between runs; they also belong in the measured
+	// response time.
+	client := &http.Client{
+		Timeout: p.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: !p.VerifyTLS,
+			},
+			DisableKeepAlives: true,
+		},
+	}
+	if !p.FollowRedirects {
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	req, err := http.NewRequest(method, p.URL, nil)
+	if err != nil {
+		return ProbeResult{Status: ProbeOffline, Error: fmt.Sprintf("invalid request: %v", err)}
+	}
+	req.Header.Set("User-Agent", "BreezeRMM-Monitor/1.0")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return ProbeResult{
+			Status:     ProbeOffline,
+			ResponseMs: float64(time.Since(start).Microseconds()) / 1000.0,
+			Error:      err.Error(),
+		}
+	}
+	defer resp.Body.Close()
+
+	result := ProbeResult{
+		Status:     ProbeOnline,
+		ResponseMs: float64(time.Since(start).Microseconds()) / 1000.0,
+		StatusCode: resp.StatusCode,
+	}
+	if resp.StatusCode != expectedStatus {
+		result.fail("expected status %d, got %d", expectedStatus, resp.StatusCode)
+	}
+
+	if p.ExpectedBody != "" || p.BodyPattern != nil {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+		if err != nil {
+			result.fail("failed to read body: %v", err)
+		} else {
+			match := true
+			if p.ExpectedBody != "" && !strings.Contains(string(body), p.ExpectedBody) {
+				match = false
+				result.fail("expected body content not found")
+			}
+			if p.BodyPattern != nil && !p.BodyPattern.Match(body) {
+				match = false
+				result.fail("body does not match %q", p.BodyPattern.String())
+			}
+			result.BodyMatch = &match
+		}
+	}
+
+	result.recordCertificate(resp.TLS)
+	return result
+}
+
+// TLSProbe describes a TLS handshake with host:port.
+type TLSProbe struct {
+	Address    string
+	ServerName string
+	VerifyTLS  bool
+	Timeout    time.Duration
+}
+
+// ProbeTLS performs the handshake and reports the server certificate.
+func ProbeTLS(p TLSProbe) ProbeResult {
+	address := p.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "443")
+	}
+	serverName := p.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(address)
+	}
+
+	dialer := &net.Dialer{Timeout: p.Timeout}
+	start := time.Now()
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: !p.VerifyTLS,
+	})
+	if err != nil {
+		return ProbeResult{
+			Status:     ProbeOffline,
+			ResponseMs: float64(time.Since(start).Microseconds()) / 1000.0,
+			Error:      err.Error(),
+		}
+	}
+	defer conn.Close()
+
+	result := ProbeResult{
+		Status:     ProbeOnline,
+		ResponseMs: float64(time.Since(start).Microseconds()) / 1000.0,
+	}
+	state := conn.ConnectionState()
+	result.recordCertificate(&state)
+	return result
+}
+
+// DNSProbe describes a DNS lookup and the answers it expects.
+type DNSProbe struct {
+	Hostname   string
+	RecordType string
+	// Nameserver, if set, is queried instead of the system resolver.
+	Nameserver string
+	// Expected values must each appear in at least one record.
+	Expected []string
+	Timeout  time.Duration
+}
+
+// ProbeDNS performs the lookup and checks the answers.
+func ProbeDNS(p DNSProbe) ProbeResult {
+	resolver := &net.Resolver{
+		PreferGo: true,
+	}
+	if nameserver := p.Nameserver; nameserver != "" {
+		if !strings.Contains(nameserver, ":") {
+			nameserver = nameserver + ":53"
+		}
+		resolver.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: p.Timeout}
+			return d.DialContext(ctx, "udp", nameserver)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	var records []string
+	var lookupErr error
+
+	recordType := strings.ToUpper(p.RecordType)
+	if recordType == "" {
+		recordType = "A"
+	}
+	switch recordType {
+	case "A", "AAAA":
+		ips, err := resolver.LookupIPAddr(ctx, p.Hostname)
+		lookupErr = err
+		for _, ip := range ips {
+			if (recordType == "A") == (ip.IP.To4() != nil) {
+				records = append(records, ip.IP.String())
+			}
+		}
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, p.Hostname)
+		lookupErr = err
+		for _, mx := range mxs {
+			records = append(records, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, p.Hostname)
+		lookupErr = err
+		if cname != "" {
+			records = append(records, cname)
+		}
+	case "TXT":
+		txts, err := resolver.LookupTXT(ctx, p.Hostname)
+		lookupErr = err
+		records = txts
+	case "NS":
+		nss, err := resolver.LookupNS(ctx, p.Hostname)
+		lookupErr = err
+		for _, ns := range nss {
+			records = append(records, ns.Host)
+		}
+	default:
+		return ProbeResult{Status: ProbeOffline, Error: fmt.Sprintf("unsupported record type: %s", p.RecordType)}
+	}
+
+	responseMs := float64(time.Since(start).Microseconds()) / 1000.0
+	if lookupErr != nil {
+		return ProbeResult{Status: ProbeOffline, ResponseMs: responseMs, Error: lookupErr.Error()}
+	}
+
+	result := ProbeResult{
+		Status:     ProbeOnline,
+		ResponseMs: responseMs,
+		Records:    records,
+	}
+	if len(p.Expected) > 0 {
+		matched := true
+		for _, expected := range p.Expected {
+			found := false
+			for _, record := range records {
+				if strings.Contains(record, expected) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				matched = false
+				result.fail("expected value %q not found in records", expected)
+			}
+		}
+		result.Matched = &matched
+	}
+	return result
+}
+
+const defaultProbeTimeout = 10 * time.Second
+
+func isSyntheticWatch(watchType WatchType) bool {
+	return watchType == WatchTypeHTTP || watchType == WatchTypeTLS || watchType == WatchTypeDNS
+}
+
+// checkSynthetic runs the probe for a synthetic watch and applies the
+// watch's assertions. Failures are reported as critical; runChecks softens
+// them to warning until enough consecutive failures have accumulated.
+func checkSynthetic(w WatchConfig) CheckResult {
+	timeout := defaultProbeTimeout
+	if w.TimeoutSeconds > 0 {
+		timeout = time.Duration(w.TimeoutSeconds) * time.Second
+	}
+	verifyTLS := w.VerifyTLS == nil || *w.VerifyTLS
+
+	var probe ProbeResult
+	switch w.WatchType {
+	case WatchTypeHTTP:
+		var pattern *regexp.Regexp
+		if w.BodyRegex != "" {
+			var err error
+			if pattern, err = regexp.Compile(w.BodyRegex); err != nil {
+				return CheckResult{
+					Status:  StatusError,
+					Details: map[string]any{"error": fmt.Sprintf("invalid body_regex: %v", err)},
+				}
+			}
+		}
+		probe = ProbeHTTP(HTTPProbe{
+			URL:             w.Name,
+			Method:          w.Method,
+			ExpectedStatus:  w.ExpectedStatus,
+			BodyPattern:     pattern,
+			VerifyTLS:       verifyTLS,
+			FollowRedirects: w.FollowRedirects == nil || *w.FollowRedirects,
+			Timeout:         timeout,
+		})
+	case WatchTypeTLS:
+		probe = ProbeTLS(TLSProbe{Address: w.Name, VerifyTLS: verifyTLS, Timeout: timeout})
+	case WatchTypeDNS:
+		probe = ProbeDNS(DNSProbe{
+			Hostname:   w.Name,
+			RecordType: w.RecordType,
+			Nameserver: w.Nameserver,
+			Expected:   w.ExpectedAnswers,
+			Timeout:    timeout,
+		})
+	}
+
+	if probe.Status != ProbeOffline {
+		if w.MaxResponseMs > 0 && probe.ResponseMs > w.MaxResponseMs {
+			probe.fail("response took %.0fms, limit is %.0fms", probe.ResponseMs, w.MaxResponseMs)
+		}
+		if w.MinCertDays > 0 && probe.CertDaysRemaining != nil && *probe.CertDaysRemaining < w.MinCertDays {
+			probe.fail("certificate expires in %d days, minimum is %d", *probe.CertDaysRemaining, w.MinCertDays)
+		}
+		if w.WatchType == WatchTypeTLS && probe.CertDaysRemaining == nil {
+			probe.fail("server presented no certificate")
+		}
+	}
+
+	details := map[string]any{"probeStatus": probe.Status}
+	if probe.Error != "" {
+		details["error"] = probe.Error
+	}
+	if len(probe.Failures) > 0 {
+		details["failures"] = probe.Failures
+	}
+	if probe.StatusCode != 0 {
+		details["statusCode"] = probe.StatusCode
+	}
+	if probe.BodyMatch != nil {
+		details["bodyMatch"] = *probe.BodyMatch
+	}
+	if probe.CertDaysRemaining != nil {
+		details["certExpiry"] = probe.CertExpiry.UTC().Format(time.RFC3339)
+		details["certDaysRemaining"] = *probe.CertDaysRemaining
+		details["certSubject"] = probe.CertSubject
+		details["certIssuer"] = probe.CertIssuer
+	}
+	if w.WatchType == WatchTypeDNS && probe.Status != ProbeOffline {
+		details["records"] = probe.Records
+	}
+
+	result := CheckResult{Status: StatusOK, Details: details}
+	if probe.Status != ProbeOnline {
+		result.Status = StatusCritical
+	}
+	value, unit := probe.ResponseMs, "ms"
+	if w.WatchType == WatchTypeTLS {
+		if probe.CertDaysRemaining == nil {
+			return result
+		}
+		value, unit = float64(*probe.CertDaysRemaining), "days"
+	}
+	result.Value = &value
+	result.Unit = unit
+	return result
+}
@@ -0,0 +1,157 @@
+package monitoring
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeHTTPAssertions(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"status":"healthy","version":"4.2"}`)
+	}))
+	defer server.Close()
+
+	watch := WatchConfig{
+		WatchType: WatchTypeHTTP,
+		Name:      server.URL + "/health",
+		BodyRegex: `"status":"healthy"`,
+		VerifyTLS: new(bool),
+	}
+	result := checkSynthetic(watch)
+	if result.Status != StatusOK || result.Unit != "ms" || result.Details["statusCode"] != 200 {
+		t.Fatalf("healthy endpoint: %+v", result)
+	}
+	if _, ok := result.Details["certDaysRemaining"]; !ok {
+		t.Fatalf("expected certificate details, got %+v", result.Details)
+	}
+
+	watch.BodyRegex = `"version":"5\.`
+	watch.MinCertDays = 100000
+	result = checkSynthetic(watch)
+	failures, _ := result.Details["failures"].([]string)
+	if result.Status != StatusCritical || len(failures) != 2 {
+		t.Fatalf("expected body and certificate failures, got %+v", result)
+	}
+
+	watch = WatchConfig{WatchType: WatchTypeHTTP, Name: server.URL + "/missing", VerifyTLS: new(bool)}
+	result = checkSynthetic(watch)
+	if result.Status != StatusCritical || !strings.Contains(fmt.Sprint(result.Details["failures"]), "expected status 200, got 404") {
+		t.Fatalf("missing page: %+v", result)
+	}
+
+	// The test server's certificate is self-signed, so verification fails.
+	watch = WatchConfig{WatchType: WatchTypeHTTP, Name: server.URL + "/health"}
+	result = checkSynthetic(watch)
+	if result.Status != StatusCritical || result.Details["probeStatus"] != ProbeOffline {
+		t.Fatalf("untrusted certificate: %+v", result)
+	}
+
+	watch = WatchConfig{WatchType: WatchTypeHTTP, Name: server.URL, BodyRegex: "("}
+	if result := checkSynthetic(watch); result.Status != StatusError {
+		t.Fatalf("invalid regex: %+v", result)
+	}
+}
+
+func TestProbeHTTPLeavesNoIdleConnections(t *testing.T) {
+	var open atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			open.Add(1)
+		case http.StateClosed, http.StateHijacked:
+			open.Add(-1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for range 5 {
+		if result := ProbeHTTP(HTTPProbe{URL: server.URL, Timeout: 5 * time.Second}); result.Status != ProbeOnline {
+			t.Fatalf("probe failed: %+v", result)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for open.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := open.Load(); n != 0 {
+		t.Fatalf("%d probe connections left open", n)
+	}
+}
+
+func TestSyntheticLevelsSurviveIngest(t *testing.T) {
+	warning := CheckResult{WatchType: WatchTypeHTTP, Name: "https://intranet", Status: StatusWarning}.IngestResult()
+	critical := CheckResult{WatchType: WatchTypeHTTP, Name: "https://intranet", Status: StatusCritical}.IngestResult()
+	if warning.Status != StatusError || critical.Status != StatusError {
+		t.Fatalf("failing probes should be sent as error, got %q and %q", warning.Status, critical.Status)
+	}
+	if warning.Details["level"] != StatusWarning || critical.Details["level"] != StatusCritical {
+		t.Fatalf("levels lost: %+v, %+v", warning.Details, critical.Details)
+	}
+	if ok := (CheckResult{WatchType: WatchTypeDNS, Status: StatusOK}).IngestResult(); ok.Status != StatusRunning {
+		t.Fatalf("passing probe should be sent as running, got %q", ok.Status)
+	}
+}
+
+func TestProbeTLSReportsCertificateDays(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "https://")
+	result := checkSynthetic(WatchConfig{WatchType: WatchTypeTLS, Name: address, VerifyTLS: new(bool), MinCertDays: 30})
+	if result.Status != StatusOK || result.Unit != "days" || result.Value == nil || *result.Value < 30 {
+		t.Fatalf("tls probe: %+v", result)
+	}
+}
+
+func TestSyntheticWatchConsecutiveFailures(t *testing.T) {
+	var results []CheckResult
+	m := New(func(r []CheckResult) { results = append(results, r...) })
+	m.config = MonitorConfig{Watches: []WatchConfig{{
+		WatchType:                     WatchTypeDNS,
+		Name:                          "example.invalid",
+		RecordType:                    "SRV",
+		AlertAfterConsecutiveFailures: 3,
+	}}}
+
+	var statuses []string
+	for i := 0; i < 4; i++ {
+		m.runChecks()
+		last := results[len(results)-1]
+		statuses = append(statuses, fmt.Sprintf("%s/%d", last.Status, last.ConsecutiveFailures))
+	}
+	if got := strings.Join(statuses, ","); got != "warning/1,warning/2,critical/3,critical/4" {
+		t.Fatalf("statuses = %s", got)
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	m := New(nil)
+	w := WatchConfig{WatchType: WatchTypeHTTP, Name: "https://intranet", IntervalSeconds: 300}
+	now := time.Now()
+	if !m.due(w, now) {
+		t.Fatal("first run should be due")
+	}
+	if m.due(w, now.Add(60*time.Second)) {
+		t.Fatal("watch ran before its interval")
+	}
+	if !m.due(w, now.Add(300*time.Second)) {
+		t.Fatal("watch not due after its interval")
+	}
+	if !m.due(WatchConfig{WatchType: WatchTypeService, Name: "sshd"}, now) {
+		t.Fatal("watches without an interval run on every tick")
+	}
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package monitoring
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemOpenFiles reads the allocated and maximum file handle counts from
+// /proc/sys/fs/file-nr.
+func systemOpenFiles() (open, limit int64, err error) {
+	data, err := os.ReadFile("/proc/sys/fs/file-nr")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read file-nr: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return 0, 0, fmt.Errorf("unexpected file-nr format %q", strings.TrimSpace(string(data)))
+	}
+	allocated, err1 := strconv.ParseInt(fields[0], 10, 64)
+	unused, err2 := strconv.ParseInt(fields[1], 10, 64)
+	limit, err3 := strconv.ParseInt(fields[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, 0, fmt.Errorf("unexpected file-nr format %q", strings.TrimSpace(string(data)))
+	}
+	return allocated - unused, limit, nil
+}
+
+// memoryStall returns the "some" and "full" 10-second memory pressure
+// averages from /proc/pressure/memory (kernel 4.20+ with PSI enabled).
+func memoryStall() (some, full float64, ok bool) {
+	data, err := os.ReadFile("/proc/pressure/memory")
+	if err != nil {
+		return 0, 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		value, found := strings.CutPrefix(fields[1], "avg10=")
+		if !found {
+			continue
+		}
+		avg, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "some":
+			some, ok = avg, true
+		case "full":
+			full = avg
+		}
+	}
+	return some, full, ok
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+
+package monitoring
+
+import (
+	"errors"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// systemOpenFiles sums the open descriptors of every process the agent can
+// inspect. There is no system-wide limit to report.
+func systemOpenFiles() (open, limit int64, err error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return 0, 0, err
+	}
+	counted := 0
+	for _, p := range procs {
+		fds, err := p.NumFDs()
+		if err != nil {
+			continue
+		}
+		open += int64(fds)
+		counted++
+	}
+	if counted == 0 {
+		return 0, 0, errors.New("open file counts are not available on this platform")
+	}
+	return open, 0, nil
+}
+
+// memoryStall is only available on Linux.
+func memoryStall() (some, full float64, ok bool) {
+	return 0, 0, false
+}
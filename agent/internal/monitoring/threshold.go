@@ -0,0 +1,134 @@
+package monitoring
+
+import (
+	"time"
+)
+
+// defaultRateWindow is the period rate-of-change rules measure over when
+// the watch does not set rate_window_seconds.
+const defaultRateWindow = time.Hour
+
+// metricSample is one reading taken by a metric watch.
+type metricSample struct {
+	value float64
+	unit  string
+	// growth is the quantity whose rate of change the rate rules measure,
+	// e.g. used bytes for a disk_free watch.
+	growth  float64
+	details map[string]any
+}
+
+type rateSample struct {
+	at    time.Time
+	value float64
+}
+
+// isHealthy reports whether a check status counts as passing.
+func isHealthy(status CheckStatus) bool {
+	return status == StatusRunning || status == StatusOK
+}
+
+// severity orders metric levels so the worse of two can be picked.
+func severity(status CheckStatus) int {
+	switch status {
+	case StatusCritical:
+		return 2
+	case StatusWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// breachLevel returns the level value is at given the thresholds. A level
+// that was already reached (prev) is held until the value recovers past its
+// threshold by more than hysteresis.
+func breachLevel(value float64, warning, critical *float64, hysteresis float64, lowerIsWorse bool, prev CheckStatus) CheckStatus {
+	sign := 1.0
+	if lowerIsWorse {
+		sign = -1
+	}
+	breached := func(threshold *float64, held bool) bool {
+		if threshold == nil {
+			return false
+		}
+		v, t := sign*value, sign*(*threshold)
+		return v >= t || (held && v > t-hysteresis)
+	}
+
+	switch {
+	case breached(critical, prev == StatusCritical):
+		return StatusCritical
+	case breached(warning, prev == StatusWarning || prev == StatusCritical):
+		return StatusWarning
+	default:
+		return StatusOK
+	}
+}
+
+// ratePerHour records value and returns its growth per hour across the
+// samples kept in window. No rate is reported until the samples span at
+// least half the window, so a short burst is not extrapolated into an
+// alarming hourly figure.
+func (s *watchState) ratePerHour(now time.Time, value float64, window time.Duration) (float64, bool) {
+	s.history = append(s.history, rateSample{at: now, value: value})
+	cutoff := now.Add(-window)
+	drop := 0
+	for drop < len(s.history)-1 && s.history[drop].at.Before(cutoff) {
+		drop++
+	}
+	s.history = s.history[drop:]
+
+	oldest := s.history[0]
+	elapsed := now.Sub(oldest.at)
+	if elapsed <= 0 || elapsed < window/2 {
+		return 0, false
+	}
+	return (value - oldest.value) / elapsed.Hours(), true
+}
+
+// evaluateMetric turns a sample into a check result, updating the watch's
+// level and rate history. The caller must hold m.mu.
+func evaluateMetric(w WatchConfig, state *watchState, sample metricSample, now time.Time) CheckResult {
+	level := breachLevel(sample.value, w.WarningThreshold, w.CriticalThreshold, w.Hysteresis,
+		w.WatchType == WatchTypeDiskFree, state.level)
+	state.level = level
+
+	value := sample.value
+	result := CheckResult{
+		Status:  level,
+		Value:   &value,
+		Unit:    sample.unit,
+		Details: sample.details,
+	}
+	if result.Details == nil {
+		result.Details = make(map[string]any)
+	}
+	if w.WarningThreshold != nil {
+		result.Details["warningThreshold"] = *w.WarningThreshold
+	}
+	if w.CriticalThreshold != nil {
+		result.Details["criticalThreshold"] = *w.CriticalThreshold
+	}
+
+	if w.RateWarningPerHour == nil && w.RateCriticalPerHour == nil {
+		return result
+	}
+	window := defaultRateWindow
+	if w.RateWindowSeconds > 0 {
+		window = time.Duration(w.RateWindowSeconds) * time.Second
+	}
+	rate, ok := state.ratePerHour(now, sample.growth, window)
+	if !ok {
+		return result
+	}
+	rateLevel := breachLevel(rate, w.RateWarningPerHour, w.RateCriticalPerHour, 0, false, state.rateLevel)
+	state.rateLevel = rateLevel
+	result.RatePerHour = &rate
+	result.Details["thresholdStatus"] = level
+	result.Details["rateStatus"] = rateLevel
+	if severity(rateLevel) > severity(level) {
+		result.Status = rateLevel
+	}
+	return result
+}
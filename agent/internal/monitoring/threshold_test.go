@@ -0,0 +1,178 @@
+package monitoring
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func float(v float64) *float64 { return &v }
+
+func TestBreachLevelHysteresis(t *testing.T) {
+	warning, critical := float(80), float(90)
+	steps := []struct {
+		value float64
+		want  CheckStatus
+	}{
+		{70, StatusOK},
+		{85, StatusWarning},
+		{91, StatusCritical},
+		{88, StatusCritical}, // held: within 5 of the critical threshold
+		{84, StatusWarning},
+		{76, StatusWarning}, // held: within 5 of the warning threshold
+		{74, StatusOK},
+	}
+	level := StatusOK
+	for _, step := range steps {
+		level = breachLevel(step.value, warning, critical, 5, false, level)
+		if level != step.want {
+			t.Fatalf("value %v: got %s, want %s", step.value, level, step.want)
+		}
+	}
+}
+
+func TestBreachLevelLowerIsWorse(t *testing.T) {
+	// Free disk space: 15% warns, 5% is critical.
+	warning, critical := float(15), float(5)
+	if got := breachLevel(20, warning, critical, 2, true, StatusOK); got != StatusOK {
+		t.Fatalf("20%% free: got %s", got)
+	}
+	if got := breachLevel(4, warning, critical, 2, true, StatusOK); got != StatusCritical {
+		t.Fatalf("4%% free: got %s", got)
+	}
+	if got := breachLevel(6, warning, critical, 2, true, StatusCritical); got != StatusCritical {
+		t.Fatalf("6%% free after critical: got %s, want critical held", got)
+	}
+	if got := breachLevel(16, warning, critical, 2, true, StatusWarning); got != StatusWarning {
+		t.Fatalf("16%% free after warning: got %s, want warning held", got)
+	}
+	if got := breachLevel(16, nil, nil, 2, true, StatusWarning); got != StatusOK {
+		t.Fatalf("no thresholds: got %s", got)
+	}
+}
+
+func TestEvaluateMetricRate(t *testing.T) {
+	const gb = 1 << 30
+	w := WatchConfig{
+		WatchType:          WatchTypeDiskFree,
+		Name:               "/data",
+		WarningThreshold:   float(10),
+		RateWarningPerHour: float(1 * gb),
+		RateWindowSeconds:  3600,
+	}
+	state := &watchState{}
+	start := time.Now()
+
+	// The first half hour only builds up history.
+	result := evaluateMetric(w, state, metricSample{value: 50, growth: 100 * gb}, start)
+	if result.Status != StatusOK || result.RatePerHour != nil {
+		t.Fatalf("first sample: %+v", result)
+	}
+	result = evaluateMetric(w, state, metricSample{value: 49, growth: 100.5 * gb}, start.Add(10*time.Minute))
+	if result.RatePerHour != nil {
+		t.Fatal("rate reported before half the window elapsed")
+	}
+
+	// 1 GB written in 40 minutes is 1.5 GB/h.
+	result = evaluateMetric(w, state, metricSample{value: 48, growth: 101 * gb}, start.Add(40*time.Minute))
+	if result.RatePerHour == nil || *result.RatePerHour != 1.5*gb {
+		t.Fatalf("unexpected rate %+v", result.RatePerHour)
+	}
+	if result.Status != StatusWarning || result.Details["thresholdStatus"] != StatusOK {
+		t.Fatalf("expected a rate warning with the threshold ok, got %+v", result)
+	}
+
+	// Samples older than the window are dropped: the disk stopped growing.
+	result = evaluateMetric(w, state, metricSample{value: 48, growth: 101 * gb}, start.Add(2*time.Hour))
+	if result.RatePerHour != nil || result.Status != StatusOK {
+		t.Fatalf("expected no rate once the window only holds one sample, got %+v", result)
+	}
+}
+
+func TestCheckMetricWatches(t *testing.T) {
+	m := New(nil)
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "backup.log")
+	if err := os.WriteFile(logPath, []byte("ok"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-27 * time.Hour)
+	if err := os.Chtimes(logPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	result := m.checkMetric(WatchConfig{WatchType: WatchTypeFileAge, Name: logPath, CriticalThreshold: float(26)}, sampleFileAge)
+	if result.Status != StatusCritical || result.Unit != "hours" || *result.Value < 26 {
+		t.Fatalf("stale file: %+v", result)
+	}
+	result = m.checkMetric(WatchConfig{WatchType: WatchTypeFileAge, Name: filepath.Join(dir, "missing.log")}, sampleFileAge)
+	if result.Status != StatusNotFound {
+		t.Fatalf("missing file: %+v", result)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	result = m.checkMetric(WatchConfig{WatchType: WatchTypeTCPPort, Name: address}, sampleTCPPort)
+	if result.Status != StatusOK || result.Unit != "ms" {
+		t.Fatalf("listening port: %+v", result)
+	}
+	listener.Close()
+	result = m.checkMetric(WatchConfig{WatchType: WatchTypeTCPPort, Name: address}, sampleTCPPort)
+	if result.Status != StatusCritical {
+		t.Fatalf("closed port: %+v", result)
+	}
+
+	result = m.checkMetric(WatchConfig{WatchType: WatchTypeDiskFree, Name: dir, WarningThreshold: float(100)}, sampleDiskFree)
+	if result.Status != StatusWarning || result.Details["totalBytes"] == nil {
+		t.Fatalf("disk free: %+v", result)
+	}
+}
+
+func TestIngestResultMapsLevels(t *testing.T) {
+	rate := 1.5
+	metric := CheckResult{
+		WatchType:           WatchTypeDiskFree,
+		Name:                "/data",
+		Status:              StatusWarning,
+		Value:               float(8),
+		Unit:                "percent",
+		RatePerHour:         &rate,
+		ConsecutiveFailures: 2,
+		Details:             map[string]any{"path": "/data"},
+	}
+	got := metric.IngestResult()
+	if got.Status != StatusError {
+		t.Fatalf("warning should be sent as error, got %q", got.Status)
+	}
+	want := map[string]any{
+		"path": "/data", "watchType": WatchTypeDiskFree, "level": StatusWarning,
+		"value": 8.0, "unit": "percent", "ratePerHour": 1.5, "consecutiveFailures": 2,
+	}
+	for key, value := range want {
+		if got.Details[key] != value {
+			t.Errorf("details[%q] = %v, want %v", key, got.Details[key], value)
+		}
+	}
+	if len(metric.Details) != 1 {
+		t.Error("IngestResult modified the original details")
+	}
+
+	metric.Status = StatusOK
+	if got := metric.IngestResult(); got.Status != StatusRunning || got.Details["level"] != StatusOK {
+		t.Fatalf("ok should be sent as running, got %+v", got)
+	}
+	metric.Status = StatusNotFound
+	if got := metric.IngestResult(); got.Status != StatusNotFound {
+		t.Fatalf("not_found should be sent unchanged, got %q", got.Status)
+	}
+
+	service := CheckResult{WatchType: WatchTypeService, Name: "sshd", Status: StatusStopped}
+	if got := service.IngestResult(); got.Status != StatusStopped || got.Details != nil {
+		t.Fatalf("service results should be sent unchanged, got %+v", got)
+	}
+}
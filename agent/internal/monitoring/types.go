@@ -6,6 +6,38 @@ type WatchType = string
 const (
 	WatchTypeService WatchType = "service"
 	WatchTypeProcess WatchType = "process"
+
+	// Metric watches compare a sampled value against warning and critical
+	// levels. Name selects what is sampled:
+	//   disk_free        mount point; value is free space in percent
+	//   inodes           mount point; value is inode use in percent
+	//   load             "1m", "5m" or "15m" (default 1m); load average
+	//   memory_pressure  ignored; percent of time some tasks stalled on memory
+	//                    over the last 10s (Linux pressure stall information)
+	//   memory_used      ignored; memory in use (total - available) in percent
+	//   file_descriptors "" or "system" for the system-wide count, else a
+	//                    process name whose open descriptors are summed
+	//   tcp_port         "port" or "host:port" (host defaults to localhost);
+	//                    value is connect time in ms, critical if not listening
+	//   file_age         file path; value is hours since last modification
+	//   file_size        file path; value is size in bytes
+	WatchTypeDiskFree        WatchType = "disk_free"
+	WatchTypeInodes          WatchType = "inodes"
+	WatchTypeLoad            WatchType = "load"
+	WatchTypeMemoryPressure  WatchType = "memory_pressure"
+	WatchTypeMemoryUsed      WatchType = "memory_used"
+	WatchTypeFileDescriptors WatchType = "file_descriptors"
+	WatchTypeTCPPort         WatchType = "tcp_port"
+	WatchTypeFileAge         WatchType = "file_age"
+	WatchTypeFileSize        WatchType = "file_size"
+
+	// Synthetic watches probe a service from this endpoint. Name is the
+	// URL (http), "host[:port]" (tls, port defaults to 443) or hostname
+	// (dns). Value is the response time in ms, or for tls the days until
+	// the certificate expires.
+	WatchTypeHTTP WatchType = "http"
+	WatchTypeTLS  WatchType = "tls"
+	WatchTypeDNS  WatchType = "dns"
 )
 
 // CheckStatus represents the result status of a monitoring check.
@@ -16,6 +48,12 @@ const (
 	StatusStopped  CheckStatus = "stopped"
 	StatusNotFound CheckStatus = "not_found"
 	StatusError    CheckStatus = "error"
+
+	// Metric and synthetic watch levels. IngestResult maps them onto the
+	// statuses above before results are sent.
+	StatusOK       CheckStatus = "ok"
+	StatusWarning  CheckStatus = "warning"
+	StatusCritical CheckStatus = "critical"
 )
 
 // MonitorConfig is the agent-side representation of the monitoring policy
@@ -29,7 +67,19 @@ type MonitorConfig struct {
 	Watches              []WatchConfig `json:"watches"`
 }
 
-// WatchConfig describes a single service or process to monitor.
+// WatchConfig describes a single service, process or metric to monitor.
+//
+// Metric watches use WarningThreshold and CriticalThreshold (either may be
+// omitted). For disk_free a value at or below a threshold breaches it; for
+// every other type a value at or above it does. Once breached, a level only
+// clears after the value recovers past the threshold by Hysteresis, which
+// keeps values hovering around a threshold from flapping.
+//
+// The rate rules compare how fast the watched quantity grows per hour,
+// measured over RateWindowSeconds (default one hour). Disk and inode
+// watches measure growth of used bytes and used inodes ("disk filling
+// faster than 1GB/h" is rate_warning_per_hour: 1073741824); other types
+// measure growth of their value.
 type WatchConfig struct {
 	WatchType                     WatchType `json:"watch_type"`
 	Name                          string    `json:"name"`
@@ -41,6 +91,32 @@ type WatchConfig struct {
 	CpuThresholdPercent           float64   `json:"cpu_threshold_percent,omitempty"`
 	MemoryThresholdMb             float64   `json:"memory_threshold_mb,omitempty"`
 	ThresholdDurationSeconds      int       `json:"threshold_duration_seconds,omitempty"`
+
+	WarningThreshold    *float64 `json:"warning_threshold,omitempty"`
+	CriticalThreshold   *float64 `json:"critical_threshold,omitempty"`
+	Hysteresis          float64  `json:"hysteresis,omitempty"`
+	RateWarningPerHour  *float64 `json:"rate_warning_per_hour,omitempty"`
+	RateCriticalPerHour *float64 `json:"rate_critical_per_hour,omitempty"`
+	RateWindowSeconds   int      `json:"rate_window_seconds,omitempty"`
+
+	// IntervalSeconds, when longer than the monitor's check interval, runs
+	// this watch less often.
+	IntervalSeconds int `json:"interval_seconds,omitempty"`
+
+	// Synthetic probe settings and assertions. A failed assertion is
+	// reported as warning until AlertAfterConsecutiveFailures probes in a
+	// row have failed, then as critical.
+	TimeoutSeconds  int      `json:"timeout_seconds,omitempty"`
+	Method          string   `json:"method,omitempty"`
+	ExpectedStatus  int      `json:"expected_status,omitempty"`
+	BodyRegex       string   `json:"body_regex,omitempty"`
+	MaxResponseMs   float64  `json:"max_response_ms,omitempty"`
+	MinCertDays     int      `json:"min_cert_days,omitempty"`
+	VerifyTLS       *bool    `json:"verify_tls,omitempty"`
+	FollowRedirects *bool    `json:"follow_redirects,omitempty"`
+	RecordType      string   `json:"record_type,omitempty"`
+	Nameserver      string   `json:"nameserver,omitempty"`
+	ExpectedAnswers []string `json:"expected_answers,omitempty"`
 }
 
 // CheckResult is sent back to the API for each watch item.
@@ -51,7 +127,51 @@ type CheckResult struct {
 	CpuPercent           float64        `json:"cpuPercent,omitempty"`
 	MemoryMb             float64        `json:"memoryMb,omitempty"`
 	Pid                  int            `json:"pid,omitempty"`
+	Value                *float64       `json:"value,omitempty"`
+	Unit                 string         `json:"unit,omitempty"`
+	RatePerHour          *float64       `json:"ratePerHour,omitempty"`
+	ConsecutiveFailures  int            `json:"consecutiveFailures,omitempty"`
 	Details              map[string]any `json:"details,omitempty"`
 	AutoRestartAttempted bool           `json:"autoRestartAttempted,omitempty"`
 	AutoRestartSucceeded *bool          `json:"autoRestartSucceeded,omitempty"`
 }
+
+// IngestResult adapts a result to the API's monitoring-results endpoint,
+// which stores only the service and process statuses and has no columns
+// for values. A metric or synthetic watch is sent as running when its
+// level is ok and as error when it is warning or critical, with the level,
+// watch type, value, unit, rate and consecutive failures kept in Details.
+// Service and process results are returned unchanged.
+func (r CheckResult) IngestResult() CheckResult {
+	if r.WatchType == WatchTypeService || r.WatchType == WatchTypeProcess {
+		return r
+	}
+
+	details := make(map[string]any, len(r.Details)+6)
+	for key, value := range r.Details {
+		details[key] = value
+	}
+	details["watchType"] = r.WatchType
+	details["level"] = r.Status
+	if r.Value != nil {
+		details["value"] = *r.Value
+	}
+	if r.Unit != "" {
+		details["unit"] = r.Unit
+	}
+	if r.RatePerHour != nil {
+		details["ratePerHour"] = *r.RatePerHour
+	}
+	if r.ConsecutiveFailures > 0 {
+		details["consecutiveFailures"] = r.ConsecutiveFailures
+	}
+	r.Details = details
+
+	switch r.Status {
+	case StatusOK:
+		r.Status = StatusRunning
+	case StatusWarning, StatusCritical:
+		r.Status = StatusError
+	}
+	return r
+}
@@ -0,0 +1,361 @@
+// Package outbox provides a durable, size-capped queue of API requests that
+// could not be delivered, replayed in order once the server is reachable.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/logging"
+)
+
+var log = logging.L("outbox")
+
+// Entry kinds. Command results are evicted last when the outbox is full;
+// telemetry can be recollected and is dropped first.
+const (
+	KindCommandResult = "command_result"
+	KindInventory     = "inventory"
+	KindMonitoring    = "monitoring"
+	KindLogs          = "logs"
+)
+
+const (
+	// DefaultMaxBytes caps the outbox when no size is configured.
+	DefaultMaxBytes = 50 * 1024 * 1024
+
+	initialBackoff = 5 * time.Second
+	maxBackoff     = 5 * time.Minute
+	sendTimeout    = 30 * time.Second
+	entryExt       = ".json"
+)
+
+// Entry is a stored API request. Authorization is deliberately not stored;
+// the sender adds the current token when the entry is replayed.
+type Entry struct {
+	// Key deduplicates entries: enqueueing an entry with the key of one
+	// already queued replaces it (e.g. "command-result:<id>").
+	Key       string            `json:"key,omitempty"`
+	Kind      string            `json:"kind"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      []byte            `json:"body,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// SendFunc delivers a stored entry. Errors wrapped with Permanent cause the
+// entry to be discarded; any other error is retried with backoff.
+type SendFunc func(ctx context.Context, entry Entry) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a delivery error that retrying cannot fix, such as the
+// server rejecting the request with a 4xx status.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+type record struct {
+	seq  uint64
+	key  string
+	kind string
+	size int64
+}
+
+// Outbox is a directory of pending entries, one file per entry, named by
+// sequence number so replay order survives restarts.
+type Outbox struct {
+	dir      string
+	maxBytes int64
+
+	mu        sync.Mutex
+	records   []record
+	nextSeq   uint64
+	total     int64
+	evicted   int64
+	runMu     sync.Mutex
+	wake      chan struct{}
+	lastError string
+}
+
+// Open loads the outbox stored in dir, creating the directory if needed.
+// Unreadable entries are discarded.
+func Open(dir string, maxBytes int64) (*Outbox, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create outbox dir: %w", err)
+	}
+	o := &Outbox{
+		dir:      dir,
+		maxBytes: maxBytes,
+		nextSeq:  1,
+		wake:     make(chan struct{}, 1),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox dir: %w", err)
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, entryExt) {
+			// Leftover temp files from an interrupted write.
+			if strings.HasSuffix(name, ".tmp") {
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, entryExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		entry, size, err := o.read(seq)
+		if err != nil {
+			log.Warn("discarding unreadable outbox entry", "file", name, "error", err.Error())
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		o.records = append(o.records, record{seq: seq, key: entry.Key, kind: entry.Kind, size: size})
+		o.total += size
+		if seq >= o.nextSeq {
+			o.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(o.records, func(i, j int) bool { return o.records[i].seq < o.records[j].seq })
+	if len(o.records) > 0 {
+		log.Info("loaded outbox backlog", "entries", len(o.records), "bytes", o.total)
+	}
+	return o, nil
+}
+
+func (o *Outbox) path(seq uint64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d%s", seq, entryExt))
+}
+
+func (o *Outbox) read(seq uint64) (Entry, int64, error) {
+	var entry Entry
+	data, err := os.ReadFile(o.path(seq))
+	if err != nil {
+		return entry, 0, err
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, 0, err
+	}
+	return entry, int64(len(data)), nil
+}
+
+// Enqueue stores an entry for later delivery. An entry with the same key
+// replaces the queued one; if the outbox is full, the oldest telemetry is
+// evicted first, then the oldest command results.
+func (o *Outbox) Enqueue(entry Entry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+	size := int64(len(data))
+	if size > o.maxBytes {
+		return fmt.Errorf("outbox entry of %d bytes exceeds the %d byte limit", size, o.maxBytes)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if entry.Key != "" {
+		for i, rec := range o.records {
+			if rec.key == entry.Key {
+				o.removeLocked(i)
+				break
+			}
+		}
+	}
+	for o.total+size > o.maxBytes && len(o.records) > 0 {
+		victim := 0
+		for i, rec := range o.records {
+			if rec.kind != KindCommandResult {
+				victim = i
+				break
+			}
+		}
+		log.Warn("outbox full, evicting entry", "kind", o.records[victim].kind, "key", o.records[victim].key)
+		o.removeLocked(victim)
+		o.evicted++
+	}
+
+	seq := o.nextSeq
+	tmp := o.path(seq) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	if err := os.Rename(tmp, o.path(seq)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	o.nextSeq++
+	o.records = append(o.records, record{seq: seq, key: entry.Key, kind: entry.Kind, size: size})
+	o.total += size
+
+	o.Wake()
+	return nil
+}
+
+func (o *Outbox) removeLocked(i int) {
+	rec := o.records[i]
+	if err := os.Remove(o.path(rec.seq)); err != nil && !os.IsNotExist(err) {
+		log.Warn("failed to remove outbox entry", "seq", rec.seq, "error", err.Error())
+	}
+	o.total -= rec.size
+	o.records = append(o.records[:i], o.records[i+1:]...)
+}
+
+// remove deletes the entry with seq if it is still queued (it may have been
+// replaced or evicted while it was being sent).
+func (o *Outbox) remove(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, rec := range o.records {
+		if rec.seq == seq {
+			o.removeLocked(i)
+			return
+		}
+	}
+}
+
+// Len returns the number of queued entries.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.records)
+}
+
+// Stats describes the outbox backlog for reporting in the heartbeat.
+type Stats struct {
+	Depth     int    `json:"depth"`
+	Bytes     int64  `json:"bytes"`
+	Evicted   int64  `json:"evicted,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Stats returns the current backlog.
+func (o *Outbox) Stats() Stats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return Stats{Depth: len(o.records), Bytes: o.total, Evicted: o.evicted, LastError: o.lastError}
+}
+
+// Wake makes a waiting Run retry immediately, e.g. after the server has
+// answered a heartbeat.
+func (o *Outbox) Wake() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Flush sends queued entries in order until the outbox is empty or a
+// delivery fails with a retryable error, which is returned.
+func (o *Outbox) Flush(ctx context.Context, send SendFunc) (int, error) {
+	o.runMu.Lock()
+	defer o.runMu.Unlock()
+
+	sent := 0
+	for {
+		o.mu.Lock()
+		if len(o.records) == 0 {
+			o.lastError = ""
+			o.mu.Unlock()
+			return sent, nil
+		}
+		rec := o.records[0]
+		o.mu.Unlock()
+
+		entry, _, err := o.read(rec.seq)
+		if err != nil {
+			log.Warn("discarding unreadable outbox entry", "seq", rec.seq, "error", err.Error())
+			o.remove(rec.seq)
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = send(sendCtx, entry)
+		cancel()
+		switch {
+		case err == nil:
+			o.remove(rec.seq)
+			sent++
+		case IsPermanent(err):
+			log.Warn("dropping outbox entry rejected by server", "kind", entry.Kind, "key", entry.Key, "error", err.Error())
+			o.remove(rec.seq)
+		default:
+			o.mu.Lock()
+			o.lastError = err.Error()
+			o.mu.Unlock()
+			return sent, err
+		}
+	}
+}
+
+// Run replays the outbox until stop is closed, backing off exponentially
+// while deliveries fail.
+func (o *Outbox) Run(stop <-chan struct{}, send SendFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	backoff := initialBackoff
+	for {
+		wait := time.Duration(-1)
+		if o.Len() > 0 {
+			sent, err := o.Flush(ctx, send)
+			if sent > 0 {
+				log.Info("replayed outbox entries", "sent", sent, "remaining", o.Len())
+			}
+			if err != nil {
+				wait = backoff + rand.N(backoff/2)
+				log.Debug("outbox delivery failed, backing off", "delay", wait, "error", err.Error())
+				backoff = min(backoff*2, maxBackoff)
+			} else {
+				backoff = initialBackoff
+			}
+		}
+
+		var timer <-chan time.Time
+		if wait >= 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case <-stop:
+			return
+		case <-o.wake:
+			backoff = initialBackoff
+		case <-timer:
+		}
+	}
+}
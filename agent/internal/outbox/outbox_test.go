@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOutboxReplaysInOrderAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	o, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		key := fmt.Sprintf("command-result:cmd-%d", i)
+		if err := o.Enqueue(Entry{Key: key, Kind: KindCommandResult, Method: "POST", Path: "/r", Body: []byte(fmt.Sprint(i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A newer result for the same command replaces the queued one.
+	if err := o.Enqueue(Entry{Key: "command-result:cmd-1", Kind: KindCommandResult, Method: "POST", Path: "/r", Body: []byte("1b")}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", reopened.Len())
+	}
+
+	var bodies []string
+	fail := true
+	send := func(_ context.Context, e Entry) error {
+		if string(e.Body) == "3" && fail {
+			fail = false
+			return errors.New("connection refused")
+		}
+		bodies = append(bodies, string(e.Body))
+		return nil
+	}
+	sent, err := reopened.Flush(context.Background(), send)
+	if err == nil || sent != 1 || reopened.Stats().LastError == "" {
+		t.Fatalf("Flush() = %d, %v; want one sent then a retryable error", sent, err)
+	}
+	if _, err := reopened.Flush(context.Background(), send); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(bodies, ","); got != "2,3,1b" {
+		t.Fatalf("replay order = %s", got)
+	}
+	if stats := reopened.Stats(); stats.Depth != 0 || stats.Bytes != 0 || stats.LastError != "" {
+		t.Fatalf("stats after flush = %+v", stats)
+	}
+}
+
+func TestOutboxDropsPermanentFailures(t *testing.T) {
+	o, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Enqueue(Entry{Kind: KindInventory, Method: "PUT", Path: "/a"})
+	o.Enqueue(Entry{Kind: KindInventory, Method: "PUT", Path: "/b"})
+
+	sent, err := o.Flush(context.Background(), func(_ context.Context, e Entry) error {
+		if e.Path == "/a" {
+			return Permanent(errors.New("400 bad request"))
+		}
+		return nil
+	})
+	if err != nil || sent != 1 || o.Len() != 0 {
+		t.Fatalf("Flush() = %d, %v with %d left", sent, err, o.Len())
+	}
+}
+
+func TestOutboxEvictsTelemetryFirst(t *testing.T) {
+	o, err := Open(t.TempDir(), 900)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(strings.Repeat("x", 100))
+	o.Enqueue(Entry{Key: "command-result:a", Kind: KindCommandResult, Method: "POST", Path: "/r", Body: body})
+	o.Enqueue(Entry{Kind: KindMonitoring, Method: "PUT", Path: "/m", Body: body})
+	o.Enqueue(Entry{Key: "command-result:b", Kind: KindCommandResult, Method: "POST", Path: "/r", Body: body})
+	if o.Len() != 3 {
+		t.Fatalf("Len() = %d before the cap is reached", o.Len())
+	}
+	o.Enqueue(Entry{Key: "command-result:c", Kind: KindCommandResult, Method: "POST", Path: "/r", Body: body})
+
+	var keys []string
+	o.Flush(context.Background(), func(_ context.Context, e Entry) error {
+		keys = append(keys, e.Key)
+		return nil
+	})
+	if got := strings.Join(keys, ","); got != "command-result:a,command-result:b,command-result:c" {
+		t.Fatalf("entries after eviction = %s", got)
+	}
+	if o.Stats().Evicted != 1 {
+		t.Fatalf("Evicted = %d", o.Stats().Evicted)
+	}
+
+	if err := o.Enqueue(Entry{Kind: KindLogs, Body: make([]byte, 1000)}); err == nil {
+		t.Fatal("expected an entry larger than the cap to be rejected")
+	}
+}
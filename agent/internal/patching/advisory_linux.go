@@ -0,0 +1,74 @@
+//go:build linux
+
+package patching
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cvePattern matches CVE identifiers in changelogs and advisories.
+var cvePattern = regexp.MustCompile(`CVE-\d{4}-\d{4,}`)
+
+// severityRank orders AvailablePatch severities so the most severe
+// advisory for a package wins.
+var severityRank = map[string]int{
+	"low":       1,
+	"moderate":  2,
+	"important": 3,
+	"critical":  4,
+}
+
+// moreSevere reports whether severity a outranks b.
+func moreSevere(a, b string) bool {
+	return severityRank[a] > severityRank[b]
+}
+
+// findCVEs returns the distinct CVE identifiers in text, sorted.
+func findCVEs(text string) []string {
+	return mergeCVEs(nil, cvePattern.FindAllString(text, -1))
+}
+
+// mergeCVEs adds the identifiers in more to cves, keeping them distinct
+// and sorted.
+func mergeCVEs(cves, more []string) []string {
+	seen := make(map[string]bool, len(cves)+len(more))
+	merged := make([]string, 0, len(cves)+len(more))
+	for _, cve := range append(append([]string{}, cves...), more...) {
+		cve = strings.ToUpper(cve)
+		if !seen[cve] {
+			seen[cve] = true
+			merged = append(merged, cve)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// describeAdvisory builds a patch description from a summary and the CVEs
+// the update fixes.
+func describeAdvisory(summary string, cves []string) string {
+	summary = strings.TrimSpace(summary)
+	if len(cves) == 0 {
+		return summary
+	}
+	fixes := "Fixes " + strings.Join(cves, ", ")
+	if summary == "" {
+		return fixes
+	}
+	return summary + "\n\n" + fixes
+}
+
+// isoDate normalizes a timestamp to an ISO 8601 date, returning "" when it
+// is not in one of the given layouts.
+func isoDate(value string, layouts ...string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format("2006-01-02")
+		}
+	}
+	return ""
+}
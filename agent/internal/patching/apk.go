@@ -0,0 +1,128 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ApkProvider integrates with apk on Alpine Linux.
+type ApkProvider struct{}
+
+// NewApkProvider creates a new ApkProvider.
+func NewApkProvider() *ApkProvider {
+	return &ApkProvider{}
+}
+
+// ID returns the provider identifier.
+func (a *ApkProvider) ID() string {
+	return "apk"
+}
+
+// Name returns the human-readable provider name.
+func (a *ApkProvider) Name() string {
+	return "APK"
+}
+
+// Scan refreshes the package indexes and returns available upgrades.
+func (a *ApkProvider) Scan() ([]AvailablePatch, error) {
+	// Containers often start without indexes; list works from whatever
+	// is cached if the refresh fails.
+	if output, err := cCommand("apk", "update", "--quiet").CombinedOutput(); err != nil {
+		log.Warn("apk update failed", "error", err.Error(), "output", strings.TrimSpace(string(output)))
+	}
+
+	output, err := cCommand("apk", "list", "--upgradable").Output()
+	if err != nil {
+		return nil, fmt.Errorf("apk list failed: %w", err)
+	}
+
+	return parseApkUpgradable(output), nil
+}
+
+// Install upgrades a single package.
+func (a *ApkProvider) Install(patchID string) (InstallResult, error) {
+	output, err := cCommand("apk", "upgrade", "--no-progress", patchID).CombinedOutput()
+	if err != nil {
+		return InstallResult{}, fmt.Errorf("apk upgrade failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return InstallResult{
+		PatchID:        patchID,
+		RebootRequired: strings.HasPrefix(patchID, "linux-"),
+		Message:        strings.TrimSpace(string(output)),
+	}, nil
+}
+
+// Uninstall removes a package.
+func (a *ApkProvider) Uninstall(patchID string) error {
+	output, err := cCommand("apk", "del", "--no-progress", patchID).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("apk del failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GetInstalled returns installed packages.
+func (a *ApkProvider) GetInstalled() ([]InstalledPatch, error) {
+	output, err := cCommand("apk", "info", "-v").Output()
+	if err != nil {
+		return nil, fmt.Errorf("apk info failed: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	installed := []InstalledPatch{}
+	for scanner.Scan() {
+		name, version := splitApkPackage(strings.TrimSpace(scanner.Text()))
+		if name == "" {
+			continue
+		}
+		installed = append(installed, InstalledPatch{
+			ID:      name,
+			Title:   name,
+			Version: version,
+		})
+	}
+	return installed, nil
+}
+
+// parseApkUpgradable parses apk list --upgradable lines such as
+// "busybox-1.36.1-r16 x86_64 {busybox} (GPL-2.0-only) [upgradable from: busybox-1.36.1-r15]".
+func parseApkUpgradable(output []byte) []AvailablePatch {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	patches := []AvailablePatch{}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.Contains(line, "[upgradable from:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		name, version := splitApkPackage(fields[0])
+		if name == "" {
+			continue
+		}
+		patches = append(patches, AvailablePatch{
+			ID:      name,
+			Title:   name,
+			Version: version,
+		})
+	}
+	return patches
+}
+
+// splitApkPackage splits "name-version-rrelease" into the name and
+// "version-rrelease".
+func splitApkPackage(pkg string) (string, string) {
+	release := strings.LastIndex(pkg, "-r")
+	if release <= 0 {
+		return "", ""
+	}
+	version := strings.LastIndex(pkg[:release], "-")
+	if version <= 0 {
+		return "", ""
+	}
+	return pkg[:version], pkg[version+1:]
+}
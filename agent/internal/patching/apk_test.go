@@ -0,0 +1,32 @@
+//go:build linux
+
+package patching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseApkUpgradable(t *testing.T) {
+	output := []byte(`busybox-1.36.1-r16 x86_64 {busybox} (GPL-2.0-only) [upgradable from: busybox-1.36.1-r15]
+libcrypto3-3.1.4-r6 x86_64 {openssl} (Apache-2.0) [upgradable from: libcrypto3-3.1.4-r5]
+musl-1.2.4-r2 x86_64 {musl} (MIT) [installed]
+`)
+	patches := parseApkUpgradable(output)
+	want := []AvailablePatch{
+		{ID: "busybox", Title: "busybox", Version: "1.36.1-r16"},
+		{ID: "libcrypto3", Title: "libcrypto3", Version: "3.1.4-r6"},
+	}
+	if !reflect.DeepEqual(patches, want) {
+		t.Fatalf("got %+v, want %+v", patches, want)
+	}
+}
+
+func TestSplitApkPackage(t *testing.T) {
+	if name, version := splitApkPackage("py3-cryptography-41.0.7-r0"); name != "py3-cryptography" || version != "41.0.7-r0" {
+		t.Fatalf("got %q %q", name, version)
+	}
+	if name, _ := splitApkPackage("WARNING"); name != "" {
+		t.Fatalf("expected no name, got %q", name)
+	}
+}
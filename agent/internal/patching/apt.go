@@ -5,11 +5,19 @@ package patching
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// aptArchivesDir is apt's package cache, which still holds the previous
+// version of an upgraded package unless it has been cleaned.
+const aptArchivesDir = "/var/cache/apt/archives"
+
 // AptProvider integrates with APT on Debian/Ubuntu systems.
 type AptProvider struct{}
 
@@ -28,31 +36,41 @@ func (a *AptProvider) Name() string {
 	return "APT"
 }
 
-// Scan returns available upgrades using apt.
+// Scan returns available upgrades using apt. Updates from a security
+// pocket are categorized as security, with CVEs and severity taken from
+// the changelog entries newer than the installed version.
 func (a *AptProvider) Scan() ([]AvailablePatch, error) {
 	output, err := exec.Command("apt", "list", "--upgradable").Output()
 	if err != nil {
 		return nil, fmt.Errorf("apt list failed: %w", err)
 	}
 
-	scanner := bufio.NewScanner(bytes.NewReader(output))
-	patches := []AvailablePatch{}
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "Listing") {
-			continue
+	upgrades := parseAptUpgradableList(output)
+	info := aptPackageInfo(upgrades)
+	changelogs := newAptChangelogCache()
+
+	patches := make([]AvailablePatch, 0, len(upgrades))
+	for _, upgrade := range upgrades {
+		patch := AvailablePatch{
+			ID:      upgrade.Name,
+			Title:   upgrade.Name,
+			Version: upgrade.Version,
 		}
+		pkg := info[upgrade.Name+"="+upgrade.Version]
+		patch.Size = pkg.Size
 
-		name, version := parseAptUpgradable(line)
-		if name == "" {
-			continue
+		var cves []string
+		if upgrade.IsSecurity() {
+			patch.Category = "security"
+			if entry, ok := changelogs.get(upgrade, pkg.Source); ok {
+				patch.Severity = entry.Severity
+				patch.ReleaseDate = entry.Date
+				cves = entry.CVEs
+			}
 		}
+		patch.Description = describeAdvisory(pkg.Summary, cves)
 
-		patches = append(patches, AvailablePatch{
-			ID:      name,
-			Title:   name,
-			Version: version,
-		})
+		patches = append(patches, patch)
 	}
 
 	return patches, nil
@@ -83,6 +101,23 @@ func (a *AptProvider) Uninstall(patchID string) error {
 	return nil
 }
 
+// RestoreVersions reinstalls the recorded earlier versions of packages
+// and removes packages a patch job added. Implements VersionRestorer.
+func (a *AptProvider) RestoreVersions(changes []PackageChange) error {
+	args := aptRestoreArgs(changes, aptArchivesDir)
+	if len(args) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command("apt-get", append([]string{"-y", "--allow-downgrades", "install"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("apt-get install failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
 // GetInstalled returns installed packages using dpkg-query.
 func (a *AptProvider) GetInstalled() ([]InstalledPatch, error) {
 	output, err := exec.Command("dpkg-query", "-W", "-f=${Package}\t${Version}\n").Output()
@@ -111,16 +146,269 @@ func (a *AptProvider) GetInstalled() ([]InstalledPatch, error) {
 	return installed, nil
 }
 
-func parseAptUpgradable(line string) (string, string) {
-	parts := strings.SplitN(line, " ", 2)
-	if len(parts) == 0 {
-		return "", ""
+// aptUpgrade is one line of apt list --upgradable.
+type aptUpgrade struct {
+	Name        string
+	Suites      []string // e.g. jammy-updates, jammy-security
+	Version     string
+	Arch        string
+	FromVersion string // installed version
+}
+
+// IsSecurity reports whether the upgrade comes from a security pocket.
+func (u aptUpgrade) IsSecurity() bool {
+	for _, suite := range u.Suites {
+		if suite == "security" || strings.HasSuffix(suite, "-security") || strings.HasSuffix(suite, "/updates") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAptUpgradableList(output []byte) []aptUpgrade {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	upgrades := []aptUpgrade{}
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "Listing") || strings.HasPrefix(line, "WARNING") {
+			continue
+		}
+		if upgrade, ok := parseAptUpgradable(line); ok {
+			upgrades = append(upgrades, upgrade)
+		}
+	}
+	return upgrades
+}
+
+// parseAptUpgradable parses a line such as
+// "openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]".
+func parseAptUpgradable(line string) (aptUpgrade, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return aptUpgrade{}, false
+	}
+
+	name, suites, ok := strings.Cut(fields[0], "/")
+	if !ok || name == "" {
+		return aptUpgrade{}, false
+	}
+
+	upgrade := aptUpgrade{
+		Name:    name,
+		Suites:  strings.Split(suites, ","),
+		Version: fields[1],
+	}
+	if len(fields) > 2 {
+		upgrade.Arch = fields[2]
+	}
+	if _, from, ok := strings.Cut(line, "[upgradable from: "); ok {
+		upgrade.FromVersion = strings.TrimSuffix(strings.TrimSpace(from), "]")
+	}
+	return upgrade, true
+}
+
+// aptPackage holds the apt-cache metadata for a candidate version.
+type aptPackage struct {
+	Source  string
+	Summary string
+	Size    int64
+}
+
+// aptPackageInfo looks up the candidate versions of upgrades in one
+// apt-cache call, keyed by name=version. Missing metadata is not an error.
+func aptPackageInfo(upgrades []aptUpgrade) map[string]aptPackage {
+	if len(upgrades) == 0 {
+		return nil
+	}
+	args := []string{"show", "--no-all-versions"}
+	for _, upgrade := range upgrades {
+		args = append(args, upgrade.Name+"="+upgrade.Version)
+	}
+	// apt-cache exits non-zero if any one package is missing but still
+	// prints the rest.
+	output, err := exec.Command("apt-cache", args...).Output()
+	if err != nil && len(output) == 0 {
+		log.Warn("apt-cache show failed", "error", err.Error())
+		return nil
+	}
+	return parseAptCacheShow(output)
+}
+
+// parseAptCacheShow parses apt-cache show stanzas, keyed by name=version.
+func parseAptCacheShow(output []byte) map[string]aptPackage {
+	packages := map[string]aptPackage{}
+	var name, version string
+	var pkg aptPackage
+	flush := func() {
+		if name != "" {
+			if pkg.Source == "" {
+				pkg.Source = name
+			}
+			packages[name+"="+version] = pkg
+		}
+		name, version, pkg = "", "", aptPackage{}
 	}
 
-	nameVersion := strings.SplitN(parts[0], "/", 2)
-	if len(nameVersion) != 2 {
-		return "", ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Package":
+			name = value
+		case "Version":
+			version = value
+		case "Source":
+			// "Source: openssl (3.0.2-0ubuntu1)" when the versions differ.
+			pkg.Source, _, _ = strings.Cut(value, " ")
+		case "Size":
+			pkg.Size, _ = strconv.ParseInt(value, 10, 64)
+		case "Description", "Description-en":
+			pkg.Summary = value
+		}
 	}
+	flush()
+	return packages
+}
+
+// aptChangelogTimeout bounds each changelog download.
+const aptChangelogTimeout = 30 * time.Second
 
-	return nameVersion[0], nameVersion[1]
+// aptChangelogEntry summarizes the changelog entries an upgrade brings in.
+type aptChangelogEntry struct {
+	CVEs     []string
+	Severity string
+	Date     string
+}
+
+// aptChangelogCache fetches each source package's changelog once, since
+// binary packages built from the same source share it.
+type aptChangelogCache struct {
+	texts   map[string]string
+	offline bool
+}
+
+func newAptChangelogCache() *aptChangelogCache {
+	return &aptChangelogCache{texts: map[string]string{}}
+}
+
+func (c *aptChangelogCache) get(upgrade aptUpgrade, source string) (aptChangelogEntry, bool) {
+	if source == "" {
+		source = upgrade.Name
+	}
+	text, ok := c.texts[source]
+	if !ok {
+		if c.offline {
+			return aptChangelogEntry{}, false
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), aptChangelogTimeout)
+		output, err := exec.CommandContext(ctx, "apt-get", "changelog", upgrade.Name+"="+upgrade.Version).Output()
+		timedOut := ctx.Err() != nil
+		cancel()
+		if err != nil {
+			log.Warn("apt-get changelog failed", "package", upgrade.Name, "error", err.Error())
+			// A timeout means the changelog server is unreachable, so
+			// don't wait on it for every other package.
+			c.offline = timedOut
+			return aptChangelogEntry{}, false
+		}
+		text = string(output)
+		c.texts[source] = text
+	}
+	return parseDebianChangelog(text, upgrade.FromVersion), true
+}
+
+// debianUrgencies maps changelog urgency to patch severity.
+var debianUrgencies = map[string]string{
+	"emergency": "critical",
+	"critical":  "critical",
+	"high":      "important",
+	"medium":    "moderate",
+	"low":       "low",
+}
+
+// parseDebianChangelog summarizes the entries above the installed version:
+// the CVEs they mention, the most severe urgency, and the date of the
+// newest entry. Only the newest entry is used when the installed version
+// does not appear.
+func parseDebianChangelog(text, installed string) aptChangelogEntry {
+	var entry aptChangelogEntry
+	newestOnly := installed == "" || !strings.Contains(text, "("+installed+")")
+	entries := 0
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var body strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			// Header: "openssl (3.0.2-0ubuntu1.15) jammy-security; urgency=medium"
+			open, close := strings.Index(line, "("), strings.Index(line, ")")
+			if open < 0 || close < open {
+				continue
+			}
+			if line[open+1:close] == installed || newestOnly && entries > 0 {
+				break
+			}
+			entries++
+			if _, urgency, ok := strings.Cut(line, "urgency="); ok {
+				urgency, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(urgency)), " ")
+				if severity := debianUrgencies[urgency]; moreSevere(severity, entry.Severity) {
+					entry.Severity = severity
+				}
+			}
+			continue
+		}
+		if entries == 0 {
+			continue
+		}
+		if trailer, ok := strings.CutPrefix(line, " -- "); ok {
+			// " -- Name <email>  Mon, 05 Feb 2024 10:00:00 +0000"
+			if entry.Date == "" {
+				if _, date, ok := strings.Cut(trailer, ">  "); ok {
+					entry.Date = isoDate(date, time.RFC1123Z, time.RFC1123)
+				}
+			}
+			continue
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+	}
+	if entries == 0 {
+		return aptChangelogEntry{}
+	}
+	entry.CVEs = findCVEs(body.String())
+	return entry
+}
+
+// aptRestoreArgs builds apt-get install arguments that revert changes:
+// the cached .deb of an earlier version when apt still has it, otherwise
+// "name=version" for apt to fetch, and "name-" to remove an added package.
+func aptRestoreArgs(changes []PackageChange, archives string) []string {
+	args := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if change.From == "" {
+			args = append(args, change.Name+"-")
+			continue
+		}
+		// apt escapes the epoch colon in cached file names.
+		pattern := filepath.Join(archives, change.Name+"_"+strings.ReplaceAll(change.From, ":", "%3a")+"_*.deb")
+		if debs, _ := filepath.Glob(pattern); len(debs) > 0 {
+			args = append(args, debs[0])
+			continue
+		}
+		args = append(args, change.Name+"="+change.From)
+	}
+	return args
 }
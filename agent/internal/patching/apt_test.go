@@ -0,0 +1,152 @@
+//go:build linux
+
+package patching
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseAptUpgradable(t *testing.T) {
+	upgrade, ok := parseAptUpgradable("openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]")
+	if !ok {
+		t.Fatal("expected line to parse")
+	}
+	want := aptUpgrade{
+		Name:        "openssl",
+		Suites:      []string{"jammy-updates", "jammy-security"},
+		Version:     "3.0.2-0ubuntu1.15",
+		Arch:        "amd64",
+		FromVersion: "3.0.2-0ubuntu1.14",
+	}
+	if !reflect.DeepEqual(upgrade, want) {
+		t.Fatalf("got %+v, want %+v", upgrade, want)
+	}
+	if !upgrade.IsSecurity() {
+		t.Fatal("expected security pocket")
+	}
+
+	upgrade, ok = parseAptUpgradable("vim/jammy-updates 2:8.2.3995-1ubuntu2.16 amd64 [upgradable from: 2:8.2.3995-1ubuntu2.15]")
+	if !ok || upgrade.IsSecurity() {
+		t.Fatalf("expected non-security upgrade, got %+v", upgrade)
+	}
+
+	if _, ok := parseAptUpgradable("Listing..."); ok {
+		t.Fatal("expected header to be rejected")
+	}
+}
+
+func TestParseAptUpgradableList(t *testing.T) {
+	output := []byte(`
+WARNING: apt does not have a stable CLI interface. Use with caution in scripts.
+
+Listing...
+libssl3/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]
+tzdata/jammy-updates 2024a-0ubuntu0.22.04 all [upgradable from: 2023c-0ubuntu0.22.04.2]
+`)
+	upgrades := parseAptUpgradableList(output)
+	if len(upgrades) != 2 || upgrades[0].Name != "libssl3" || upgrades[1].Version != "2024a-0ubuntu0.22.04" {
+		t.Fatalf("unexpected upgrades: %+v", upgrades)
+	}
+}
+
+func TestParseAptCacheShow(t *testing.T) {
+	output := []byte(`Package: libssl3
+Architecture: amd64
+Version: 3.0.2-0ubuntu1.15
+Priority: important
+Source: openssl
+Size: 1905336
+Description: Secure Sockets Layer toolkit - shared libraries
+ This package is part of the OpenSSL project's implementation.
+
+Package: tzdata
+Version: 2024a-0ubuntu0.22.04
+Size: 349396
+Description-en: time zone and daylight-saving time data
+`)
+	packages := parseAptCacheShow(output)
+	ssl := packages["libssl3=3.0.2-0ubuntu1.15"]
+	if ssl.Source != "openssl" || ssl.Size != 1905336 || ssl.Summary != "Secure Sockets Layer toolkit - shared libraries" {
+		t.Fatalf("unexpected libssl3 info: %+v", ssl)
+	}
+	tz := packages["tzdata=2024a-0ubuntu0.22.04"]
+	if tz.Source != "tzdata" || tz.Size != 349396 || tz.Summary == "" {
+		t.Fatalf("unexpected tzdata info: %+v", tz)
+	}
+}
+
+const opensslChangelog = `openssl (3.0.2-0ubuntu1.15) jammy-security; urgency=medium
+
+  * SECURITY UPDATE: denial of service via long DH keys
+    - debian/patches/CVE-2023-5678.patch: limit key length.
+    - CVE-2023-5678
+  * SECURITY UPDATE: POLY1305 MAC issue on PowerPC
+    - CVE-2023-6129
+
+ -- Marc Deslauriers <marc.deslauriers@ubuntu.com>  Mon, 05 Feb 2024 10:00:00 -0500
+
+openssl (3.0.2-0ubuntu1.14) jammy-security; urgency=high
+
+  * SECURITY UPDATE: excessive time spent checking DH keys
+    - CVE-2023-3817
+
+ -- Marc Deslauriers <marc.deslauriers@ubuntu.com>  Tue, 24 Oct 2023 08:00:00 -0400
+
+openssl (3.0.2-0ubuntu1.13) jammy-security; urgency=critical
+
+  * CVE-2023-0001
+`
+
+func TestParseDebianChangelog(t *testing.T) {
+	entry := parseDebianChangelog(opensslChangelog, "3.0.2-0ubuntu1.14")
+	want := aptChangelogEntry{
+		CVEs:     []string{"CVE-2023-5678", "CVE-2023-6129"},
+		Severity: "moderate",
+		Date:     "2024-02-05",
+	}
+	if !reflect.DeepEqual(entry, want) {
+		t.Fatalf("got %+v, want %+v", entry, want)
+	}
+
+	// Two versions behind: both newer entries count, and the most severe
+	// urgency wins.
+	entry = parseDebianChangelog(opensslChangelog, "3.0.2-0ubuntu1.13")
+	if entry.Severity != "important" || !reflect.DeepEqual(entry.CVEs, []string{"CVE-2023-3817", "CVE-2023-5678", "CVE-2023-6129"}) {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+
+	// An installed version missing from the changelog falls back to the
+	// newest entry rather than the whole history.
+	entry = parseDebianChangelog(opensslChangelog, "3.0.2-0ubuntu1.1")
+	if entry.Severity != "moderate" || len(entry.CVEs) != 2 {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestAptRestoreArgs(t *testing.T) {
+	archives := t.TempDir()
+	for _, name := range []string{"openssl_3.0.2-0ubuntu1.12_amd64.deb", "systemd_1%3a249.11-0ubuntu3.9_amd64.deb"} {
+		if err := os.WriteFile(filepath.Join(archives, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changes := []PackageChange{
+		{Name: "openssl", From: "3.0.2-0ubuntu1.12", To: "3.0.2-0ubuntu1.15"},
+		{Name: "systemd", From: "1:249.11-0ubuntu3.9", To: "1:249.11-0ubuntu3.12"},
+		{Name: "curl", From: "7.81.0-1ubuntu1.14", To: "7.81.0-1ubuntu1.16"},
+		{Name: "libnghttp2-14", To: "1.43.0-1ubuntu0.2"},
+	}
+	want := []string{
+		filepath.Join(archives, "openssl_3.0.2-0ubuntu1.12_amd64.deb"),
+		filepath.Join(archives, "systemd_1%3a249.11-0ubuntu3.9_amd64.deb"),
+		"curl=7.81.0-1ubuntu1.14",
+		"libnghttp2-14-",
+	}
+	if got := aptRestoreArgs(changes, archives); !reflect.DeepEqual(got, want) {
+		t.Fatalf("aptRestoreArgs() = %v, want %v", got, want)
+	}
+}
@@ -20,6 +20,23 @@ func NewDefaultManager(_ *config.Config) *PatchManager {
 	} else if _, err := exec.LookPath("yum"); err == nil {
 		providers = append(providers, NewYumProvider())
 	}
+	if _, err := exec.LookPath("zypper"); err == nil {
+		providers = append(providers, NewZypperProvider())
+	}
+	if _, err := exec.LookPath("pacman"); err == nil {
+		providers = append(providers, NewPacmanProvider())
+	}
+	if _, err := exec.LookPath("apk"); err == nil {
+		providers = append(providers, NewApkProvider())
+	}
+
+	// Application sandboxes are patched alongside the system packages.
+	if _, err := exec.LookPath("snap"); err == nil {
+		providers = append(providers, NewSnapProvider())
+	}
+	if _, err := exec.LookPath("flatpak"); err == nil {
+		providers = append(providers, NewFlatpakProvider())
+	}
 
 	return NewPatchManager(providers...)
 }
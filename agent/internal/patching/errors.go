@@ -4,7 +4,7 @@ import "fmt"
 
 // ErrPreflightFailed indicates a pre-flight check failed before patching could proceed.
 type ErrPreflightFailed struct {
-	Check   string // e.g. "disk_space", "battery", "service_health", "maintenance_window"
+	Check   string // e.g. "disk_space", "battery", "service_health", "package_lock", "maintenance_window"
 	Message string
 }
 
@@ -0,0 +1,151 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// flatpakRefSeparator separates the application ID from the branch in
+// patch IDs such as "org.freedesktop.Platform//23.08", the form flatpak
+// itself accepts.
+const flatpakRefSeparator = "//"
+
+// FlatpakProvider integrates with the system-wide Flatpak installation.
+type FlatpakProvider struct{}
+
+// NewFlatpakProvider creates a new FlatpakProvider.
+func NewFlatpakProvider() *FlatpakProvider {
+	return &FlatpakProvider{}
+}
+
+// ID returns the provider identifier.
+func (f *FlatpakProvider) ID() string {
+	return "flatpak"
+}
+
+// Name returns the human-readable provider name.
+func (f *FlatpakProvider) Name() string {
+	return "Flatpak"
+}
+
+// Scan returns applications and runtimes with updates.
+func (f *FlatpakProvider) Scan() ([]AvailablePatch, error) {
+	output, err := cCommand("flatpak", "remote-ls", "--system", "--updates",
+		"--columns=application,version,branch,origin,download-size").Output()
+	if err != nil {
+		return nil, fmt.Errorf("flatpak remote-ls failed: %w", err)
+	}
+
+	return parseFlatpakUpdates(output), nil
+}
+
+// Install updates an application or runtime.
+func (f *FlatpakProvider) Install(patchID string) (InstallResult, error) {
+	output, err := cCommand("flatpak", "update", "--system", "--noninteractive", "-y", patchID).CombinedOutput()
+	if err != nil {
+		return InstallResult{}, fmt.Errorf("flatpak update failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return InstallResult{
+		PatchID: patchID,
+		Message: strings.TrimSpace(string(output)),
+	}, nil
+}
+
+// Download pulls updates into the local repository without deploying
+// them. Implements DownloadableProvider.
+func (f *FlatpakProvider) Download(patchIDs []string, progress ProgressCallback) ([]DownloadResult, error) {
+	return downloadEach(patchIDs, progress, func(patchID string) error {
+		output, err := cCommand("flatpak", "update", "--system", "--noninteractive", "-y", "--no-deploy", patchID).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("flatpak update --no-deploy failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}), nil
+}
+
+// InstallWithProgress installs a patch and reports progress.
+// Implements DownloadableProvider.
+func (f *FlatpakProvider) InstallWithProgress(patchID string, progress ProgressCallback) (InstallResult, error) {
+	return installWithProgress(patchID, progress, f.Install)
+}
+
+// Uninstall removes an application or runtime.
+func (f *FlatpakProvider) Uninstall(patchID string) error {
+	output, err := cCommand("flatpak", "uninstall", "--system", "--noninteractive", "-y", patchID).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("flatpak uninstall failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GetInstalled returns installed applications and runtimes.
+func (f *FlatpakProvider) GetInstalled() ([]InstalledPatch, error) {
+	output, err := cCommand("flatpak", "list", "--system", "--columns=application,version,branch,origin").Output()
+	if err != nil {
+		return nil, fmt.Errorf("flatpak list failed: %w", err)
+	}
+
+	installed := []InstalledPatch{}
+	for _, row := range parseFlatpakColumns(output, 4) {
+		installed = append(installed, InstalledPatch{
+			ID:      flatpakRef(row[0], row[2]),
+			Title:   row[0],
+			Version: row[1],
+		})
+	}
+	return installed, nil
+}
+
+// parseFlatpakUpdates parses remote-ls --updates output with the columns
+// application, version, branch, origin and download-size.
+func parseFlatpakUpdates(output []byte) []AvailablePatch {
+	patches := []AvailablePatch{}
+	for _, row := range parseFlatpakColumns(output, 5) {
+		description := ""
+		if row[3] != "" {
+			description = "From remote " + row[3]
+		}
+		patches = append(patches, AvailablePatch{
+			ID:          flatpakRef(row[0], row[2]),
+			Title:       row[0],
+			Version:     row[1],
+			Description: description,
+			Size:        parseSize(row[4]),
+		})
+	}
+	return patches
+}
+
+// parseFlatpakColumns splits flatpak's tab-separated --columns output,
+// skipping the header flatpak prints when attached to a terminal.
+func parseFlatpakColumns(output []byte, columns int) [][]string {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	rows := [][]string{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		row := strings.Split(line, "\t")
+		if len(row) < columns || row[0] == "" || row[0] == "Application ID" {
+			continue
+		}
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func flatpakRef(application, branch string) string {
+	if branch == "" {
+		return application
+	}
+	return application + flatpakRefSeparator + branch
+}
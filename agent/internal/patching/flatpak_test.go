@@ -0,0 +1,21 @@
+//go:build linux
+
+package patching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFlatpakUpdates(t *testing.T) {
+	output := []byte("org.mozilla.firefox\t124.0.1\tstable\tflathub\t95.2 MB\n" +
+		"org.freedesktop.Platform\t23.08.15\t23.08\tflathub\t1.2 kB\n")
+	patches := parseFlatpakUpdates(output)
+	want := []AvailablePatch{
+		{ID: "org.mozilla.firefox//stable", Title: "org.mozilla.firefox", Version: "124.0.1", Description: "From remote flathub", Size: 95200000},
+		{ID: "org.freedesktop.Platform//23.08", Title: "org.freedesktop.Platform", Version: "23.08.15", Description: "From remote flathub", Size: 1200},
+	}
+	if !reflect.DeepEqual(patches, want) {
+		t.Fatalf("got %+v\nwant %+v", patches, want)
+	}
+}
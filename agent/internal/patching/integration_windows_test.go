@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/breeze-rmm/agent/internal/config"
 	"golang.org/x/sys/windows"
@@ -64,14 +65,14 @@ func TestIntegrationPreflightACPower(t *testing.T) {
 
 func TestIntegrationPreflightMaintenanceWindow(t *testing.T) {
 	// Test with a window that spans all day
-	check := checkMaintenanceWindow("00:00", "23:59", nil)
+	check := checkMaintenanceWindow("00:00", "23:59", nil, time.Now())
 	t.Logf("Maintenance (all-day): passed=%v, message=%q", check.Passed, check.Message)
 	if !check.Passed {
 		t.Error("00:00-23:59 should always pass")
 	}
 
 	// Test with a narrow past window
-	check = checkMaintenanceWindow("03:00", "03:01", nil)
+	check = checkMaintenanceWindow("03:00", "03:01", nil, time.Now())
 	t.Logf("Maintenance (narrow): passed=%v, message=%q", check.Passed, check.Message)
 	// Just log, don't assert — depends on time of day
 }
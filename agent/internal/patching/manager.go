@@ -4,14 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/breeze-rmm/agent/internal/config"
+	"github.com/breeze-rmm/agent/internal/logging"
 )
 
+var log = logging.L("patching")
+
 const patchIDSeparator = ":"
 
 // PatchManager coordinates patch providers.
 type PatchManager struct {
 	providers     []PatchProvider
 	providerIndex map[string]PatchProvider
+	rollbackDir   string
 }
 
 // NewPatchManager creates a PatchManager with the given providers.
@@ -24,9 +30,15 @@ func NewPatchManager(providers ...PatchProvider) *PatchManager {
 	return &PatchManager{
 		providers:     providers,
 		providerIndex: index,
+		rollbackDir:   rollbackManifestDir(config.GetDataDir()),
 	}
 }
 
+// SetDataDir moves rollback manifests under dataDir.
+func (m *PatchManager) SetDataDir(dataDir string) {
+	m.rollbackDir = rollbackManifestDir(dataDir)
+}
+
 // Scan aggregates available patches from all providers.
 func (m *PatchManager) Scan() ([]AvailablePatch, error) {
 	var patches []AvailablePatch
@@ -74,6 +86,9 @@ func (m *PatchManager) Install(patchID string) (InstallResult, error) {
 	} else if !strings.HasPrefix(result.PatchID, providerID+patchIDSeparator) {
 		result.PatchID = m.formatPatchID(providerID, result.PatchID)
 	}
+	if result.RebootRequired {
+		recordPendingReboot(result.PatchID)
+	}
 
 	return result, nil
 }
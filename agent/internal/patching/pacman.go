@@ -0,0 +1,278 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PacmanProvider integrates with pacman on Arch-based systems.
+//
+// Arch supports only full system upgrades, so Install refreshes the sync
+// databases and upgrades the whole system, which brings the package up to
+// the version Scan reported from checkupdates' fresh private databases.
+type PacmanProvider struct{}
+
+// NewPacmanProvider creates a new PacmanProvider.
+func NewPacmanProvider() *PacmanProvider {
+	return &PacmanProvider{}
+}
+
+// ID returns the provider identifier.
+func (p *PacmanProvider) ID() string {
+	return "pacman"
+}
+
+// Name returns the human-readable provider name.
+func (p *PacmanProvider) Name() string {
+	return "Pacman"
+}
+
+// Scan returns available upgrades.
+func (p *PacmanProvider) Scan() ([]AvailablePatch, error) {
+	var output []byte
+	var err error
+	if _, lookErr := exec.LookPath("checkupdates"); lookErr == nil {
+		// checkupdates exits 2 when there are no updates.
+		output, err = cCommand("checkupdates").Output()
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+			return []AvailablePatch{}, nil
+		}
+	} else {
+		// pacman -Qu exits 1 when there are no updates.
+		output, err = cCommand("pacman", "-Qu").Output()
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && len(output) == 0 {
+			return []AvailablePatch{}, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pacman update check failed: %w", err)
+	}
+
+	patches := parsePacmanUpdates(output)
+	if len(patches) == 0 {
+		return patches, nil
+	}
+
+	args := []string{"-Si"}
+	for _, patch := range patches {
+		args = append(args, patch.ID)
+	}
+	// -Si fails if any package is missing from the sync databases but
+	// still prints the rest.
+	info, infoErr := cCommand("pacman", args...).Output()
+	if infoErr != nil && len(info) == 0 {
+		log.Warn("pacman -Si failed", "error", infoErr.Error())
+		return patches, nil
+	}
+	details := parsePacmanInfo(info)
+	for i := range patches {
+		if pkg, ok := details[patches[i].ID]; ok {
+			patches[i].Description = pkg.Description
+			patches[i].Size = pkg.Size
+			patches[i].ReleaseDate = pkg.BuildDate
+		}
+	}
+
+	return patches, nil
+}
+
+// Install refreshes the sync databases and upgrades the system, failing
+// if the package is still out of date afterwards, for example because it
+// is listed in IgnorePkg.
+func (p *PacmanProvider) Install(patchID string) (InstallResult, error) {
+	output, err := cCommand("pacman", "-Syu", "--noconfirm", "--needed", patchID).CombinedOutput()
+	if err != nil {
+		return InstallResult{}, fmt.Errorf("pacman -Syu failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// pacman -Qu exits 1 with no output once nothing is pending.
+	pending, _ := cCommand("pacman", "-Qu", patchID).Output()
+	if version, ok := pacmanPendingVersion(pending, patchID); ok {
+		return InstallResult{}, fmt.Errorf("pacman left %s out of date, %s is still available: %s", patchID, version, strings.TrimSpace(string(output)))
+	}
+
+	rebootRequired := false
+	for _, name := range append(pacmanUpgraded(output), patchID) {
+		// Kernel and init upgrades take effect on the next boot.
+		if pacmanNeedsReboot(name) {
+			rebootRequired = true
+			break
+		}
+	}
+	return InstallResult{
+		PatchID:        patchID,
+		RebootRequired: rebootRequired,
+		Message:        strings.TrimSpace(string(output)),
+	}, nil
+}
+
+// Download fetches packages into the pacman cache without installing them.
+// Implements DownloadableProvider.
+func (p *PacmanProvider) Download(patchIDs []string, progress ProgressCallback) ([]DownloadResult, error) {
+	return downloadEach(patchIDs, progress, func(patchID string) error {
+		output, err := cCommand("pacman", "-Sw", "--noconfirm", patchID).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("pacman -Sw failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}), nil
+}
+
+// InstallWithProgress installs a patch and reports progress.
+// Implements DownloadableProvider.
+func (p *PacmanProvider) InstallWithProgress(patchID string, progress ProgressCallback) (InstallResult, error) {
+	return installWithProgress(patchID, progress, p.Install)
+}
+
+// Uninstall removes a package.
+func (p *PacmanProvider) Uninstall(patchID string) error {
+	output, err := cCommand("pacman", "-R", "--noconfirm", patchID).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("pacman -R failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GetInstalled returns installed packages.
+func (p *PacmanProvider) GetInstalled() ([]InstalledPatch, error) {
+	output, err := cCommand("pacman", "-Q").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pacman -Q failed: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	installed := []InstalledPatch{}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		installed = append(installed, InstalledPatch{
+			ID:      fields[0],
+			Title:   fields[0],
+			Version: fields[1],
+		})
+	}
+	return installed, nil
+}
+
+// pacmanNeedsReboot reports whether upgrading the package replaces the
+// running kernel or init system.
+func pacmanNeedsReboot(name string) bool {
+	switch {
+	case name == "systemd", name == "linux":
+		return true
+	case strings.HasPrefix(name, "linux-api-headers"), strings.HasPrefix(name, "linux-firmware"):
+		return false
+	default:
+		// linux-lts, linux-zen and other kernel flavours.
+		return strings.HasPrefix(name, "linux-") && !strings.HasSuffix(name, "-headers") && !strings.HasSuffix(name, "-docs")
+	}
+}
+
+// parsePacmanUpdates parses "name old -> new" lines from checkupdates or
+// pacman -Qu, skipping packages marked [ignored].
+func parsePacmanUpdates(output []byte) []AvailablePatch {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	patches := []AvailablePatch{}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] != "->" {
+			continue
+		}
+		if len(fields) > 4 && fields[4] == "[ignored]" {
+			continue
+		}
+		patches = append(patches, AvailablePatch{
+			ID:      fields[0],
+			Title:   fields[0],
+			Version: fields[3],
+		})
+	}
+	return patches
+}
+
+// pacmanPendingVersion returns the version pacman -Qu still offers for
+// the named package.
+func pacmanPendingVersion(output []byte, name string) (string, bool) {
+	for _, patch := range parsePacmanUpdates(output) {
+		if patch.ID == name {
+			return patch.Version, true
+		}
+	}
+	return "", false
+}
+
+// pacmanUpgraded returns the packages a pacman -Syu run upgraded or
+// installed, from its "(1/3) upgrading name" progress lines.
+func pacmanUpgraded(output []byte) []string {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	var names []string
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "(") {
+			continue
+		}
+		if fields[1] == "upgrading" || fields[1] == "installing" {
+			names = append(names, fields[2])
+		}
+	}
+	return names
+}
+
+type pacmanPackage struct {
+	Description string
+	Size        int64
+	BuildDate   string
+}
+
+// pacmanDateLayouts are the C-locale forms of pacman's Build Date field.
+var pacmanDateLayouts = []string{
+	"Mon 02 Jan 2006 03:04:05 PM MST",
+	"Mon 2 Jan 2006 03:04:05 PM MST",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+// parsePacmanInfo parses pacman -Si output, keyed by package name.
+func parsePacmanInfo(output []byte) map[string]pacmanPackage {
+	packages := map[string]pacmanPackage{}
+	var name string
+	var pkg pacmanPackage
+	flush := func() {
+		if name != "" {
+			packages[name] = pkg
+		}
+		name, pkg = "", pacmanPackage{}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, " : ")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Name":
+			name = value
+		case "Description":
+			pkg.Description = value
+		case "Download Size":
+			pkg.Size = parseSize(value)
+		case "Build Date":
+			pkg.BuildDate = isoDate(value, pacmanDateLayouts...)
+		}
+	}
+	flush()
+	return packages
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package patching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePacmanUpdates(t *testing.T) {
+	output := []byte(`linux 6.7.6.arch1-1 -> 6.7.9.arch1-1
+openssl 3.2.1-1 -> 3.2.1-2
+firefox 123.0-1 -> 123.0.1-1 [ignored]
+`)
+	patches := parsePacmanUpdates(output)
+	want := []AvailablePatch{
+		{ID: "linux", Title: "linux", Version: "6.7.9.arch1-1"},
+		{ID: "openssl", Title: "openssl", Version: "3.2.1-2"},
+	}
+	if !reflect.DeepEqual(patches, want) {
+		t.Fatalf("got %+v, want %+v", patches, want)
+	}
+}
+
+func TestParsePacmanInfo(t *testing.T) {
+	output := []byte(`Repository      : core
+Name            : openssl
+Version         : 3.2.1-2
+Description     : The Open Source toolkit for Secure Sockets Layer and Transport Layer Security
+Download Size   : 4.71 MiB
+Installed Size  : 11.45 MiB
+Build Date      : Sat 02 Mar 2024 10:15:42 AM UTC
+
+Repository      : core
+Name            : linux
+Version         : 6.7.9.arch1-1
+Download Size   : 137.20 MiB
+Build Date      : Wed 06 Mar 2024 08:00:00 PM UTC
+`)
+	packages := parsePacmanInfo(output)
+	if p := packages["openssl"]; p.Size != 4938792 || p.BuildDate != "2024-03-02" || p.Description == "" {
+		t.Fatalf("unexpected openssl: %+v", p)
+	}
+	if p := packages["linux"]; p.BuildDate != "2024-03-06" {
+		t.Fatalf("unexpected linux: %+v", p)
+	}
+}
+
+func TestPacmanNeedsReboot(t *testing.T) {
+	for name, want := range map[string]bool{
+		"linux":             true,
+		"linux-lts":         true,
+		"systemd":           true,
+		"linux-headers":     false,
+		"linux-firmware":    false,
+		"linux-api-headers": false,
+		"openssl":           false,
+	} {
+		if got := pacmanNeedsReboot(name); got != want {
+			t.Errorf("pacmanNeedsReboot(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPacmanInstallOutput(t *testing.T) {
+	output := []byte(`:: Synchronizing package databases...
+ core is up to date
+:: Starting full system upgrade...
+(2/2) checking keys in keyring                     [######################] 100%
+:: Processing package changes...
+(1/2) upgrading openssl                            [######################] 100%
+(2/2) upgrading linux                              [######################] 100%
+`)
+	if got := pacmanUpgraded(output); !reflect.DeepEqual(got, []string{"openssl", "linux"}) {
+		t.Fatalf("pacmanUpgraded = %v", got)
+	}
+
+	pending := []byte("openssl 3.2.1-1 -> 3.2.1-2\n")
+	if version, ok := pacmanPendingVersion(pending, "openssl"); !ok || version != "3.2.1-2" {
+		t.Fatalf("pacmanPendingVersion = %q, %v", version, ok)
+	}
+	if _, ok := pacmanPendingVersion(nil, "openssl"); ok {
+		t.Fatal("expected nothing pending after a clean upgrade")
+	}
+}
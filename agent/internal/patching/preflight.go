@@ -0,0 +1,109 @@
+package patching
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PreflightOptions configures which pre-flight checks to run before patching.
+type PreflightOptions struct {
+	CheckServiceHealth bool
+	CheckDiskSpace     bool
+	MinDiskSpaceGB     float64
+	CheckACPower       bool
+	CheckPackageLocks  bool // Linux: no other package manager run in progress
+	CheckHeldPackages  bool // Linux: warn about packages pinned against upgrade
+	CheckMaintWindow   bool
+	MaintenanceStart   string   // "HH:MM"
+	MaintenanceEnd     string   // "HH:MM"
+	MaintenanceDays    []string // ["monday", ...] empty=all
+}
+
+// PreflightResult captures the outcome of all pre-flight checks.
+type PreflightResult struct {
+	OK       bool
+	Checks   []PreflightCheck
+	Warnings []string
+}
+
+// PreflightCheck is one individual check result.
+type PreflightCheck struct {
+	Name    string
+	Passed  bool
+	Message string
+}
+
+// add records a check, clearing OK if it failed.
+func (r *PreflightResult) add(check PreflightCheck) {
+	r.Checks = append(r.Checks, check)
+	if !check.Passed {
+		r.OK = false
+	}
+}
+
+// FirstError returns the first failed check as an ErrPreflightFailed, or nil if all passed.
+func (r PreflightResult) FirstError() error {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return &ErrPreflightFailed{Check: check.Name, Message: check.Message}
+		}
+	}
+	return nil
+}
+
+// checkMaintenanceWindow verifies current time falls within the configured maintenance window.
+// Handles overnight windows (e.g. 22:00-06:00).
+func checkMaintenanceWindow(startStr, endStr string, days []string, now time.Time) PreflightCheck {
+	check := PreflightCheck{Name: "maintenance_window"}
+
+	startTime, err := time.Parse("15:04", startStr)
+	if err != nil {
+		check.Message = fmt.Sprintf("invalid maintenance start time %q: %v", startStr, err)
+		return check
+	}
+	endTime, err := time.Parse("15:04", endStr)
+	if err != nil {
+		check.Message = fmt.Sprintf("invalid maintenance end time %q: %v", endStr, err)
+		return check
+	}
+
+	// Check day-of-week if days are specified
+	if len(days) > 0 {
+		todayName := strings.ToLower(now.Weekday().String())
+		dayAllowed := false
+		for _, d := range days {
+			if strings.ToLower(d) == todayName {
+				dayAllowed = true
+				break
+			}
+		}
+		if !dayAllowed {
+			check.Message = fmt.Sprintf("today (%s) is not in maintenance days", todayName)
+			return check
+		}
+	}
+
+	// Compare time-of-day only (hours and minutes)
+	nowMinutes := now.Hour()*60 + now.Minute()
+	startMinutes := startTime.Hour()*60 + startTime.Minute()
+	endMinutes := endTime.Hour()*60 + endTime.Minute()
+
+	var inWindow bool
+	if startMinutes <= endMinutes {
+		// Same-day window (e.g. 02:00 - 06:00)
+		inWindow = nowMinutes >= startMinutes && nowMinutes < endMinutes
+	} else {
+		// Overnight window (e.g. 22:00 - 06:00)
+		inWindow = nowMinutes >= startMinutes || nowMinutes < endMinutes
+	}
+
+	if !inWindow {
+		check.Message = fmt.Sprintf("current time %s is outside maintenance window %s-%s", now.Format("15:04"), startStr, endStr)
+		return check
+	}
+
+	check.Passed = true
+	check.Message = fmt.Sprintf("within maintenance window %s-%s", startStr, endStr)
+	return check
+}
@@ -0,0 +1,386 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"golang.org/x/sys/unix"
+
+	"github.com/breeze-rmm/agent/internal/config"
+)
+
+const (
+	powerSupplyDir = "/sys/class/power_supply"
+	pacmanConfPath = "/etc/pacman.conf"
+
+	// bootMinFreeMB is the space a separate /boot needs for a new kernel
+	// and its initramfs.
+	bootMinFreeMB = 150
+
+	// packageLockWait is how long to wait for another package manager run,
+	// such as unattended-upgrades, to release its lock.
+	packageLockWait = 30 * time.Second
+)
+
+// lockKind is how a package manager holds its lock file.
+type lockKind int
+
+const (
+	lockFcntl    lockKind = iota // POSIX record lock (dpkg, rpm)
+	lockFlock                    // flock(2) (apk)
+	lockPIDFile                  // file holding the owner's PID (zypper)
+	lockPresence                 // held while the file exists (pacman)
+)
+
+type packageLock struct {
+	path string
+	kind lockKind
+}
+
+// packageLocks are the lock files of the package managers the agent drives.
+var packageLocks = []packageLock{
+	{"/var/lib/dpkg/lock-frontend", lockFcntl},
+	{"/var/lib/dpkg/lock", lockFcntl},
+	{"/var/cache/apt/archives/lock", lockFcntl},
+	{"/var/lib/rpm/.rpm.lock", lockFcntl},
+	{"/usr/lib/sysimage/rpm/.rpm.lock", lockFcntl},
+	{"/lib/apk/db/lock", lockFlock},
+	{"/run/zypp.pid", lockPIDFile},
+	{"/var/lib/pacman/db.lck", lockPresence},
+}
+
+// PreflightOptionsFromConfig builds PreflightOptions from config fields.
+func PreflightOptionsFromConfig(cfg *config.Config) PreflightOptions {
+	return PreflightOptions{
+		CheckDiskSpace:    cfg.PatchMinDiskSpaceGB > 0,
+		MinDiskSpaceGB:    cfg.PatchMinDiskSpaceGB,
+		CheckACPower:      cfg.PatchRequireACPower,
+		CheckPackageLocks: true,
+		CheckHeldPackages: true,
+		CheckMaintWindow:  cfg.PatchMaintenanceStart != "" && cfg.PatchMaintenanceEnd != "",
+		MaintenanceStart:  cfg.PatchMaintenanceStart,
+		MaintenanceEnd:    cfg.PatchMaintenanceEnd,
+		MaintenanceDays:   cfg.PatchMaintenanceDays,
+	}
+}
+
+// RunPreflight runs all enabled pre-flight checks and returns a combined result.
+// If any check fails, OK is false and the first failure is returned as the error check.
+func RunPreflight(opts PreflightOptions) PreflightResult {
+	result := PreflightResult{OK: true}
+
+	if opts.CheckMaintWindow {
+		result.add(checkMaintenanceWindow(opts.MaintenanceStart, opts.MaintenanceEnd, opts.MaintenanceDays, time.Now()))
+	}
+
+	if opts.CheckDiskSpace {
+		result.add(checkDiskSpace(opts.MinDiskSpaceGB))
+		result.add(checkBootSpace())
+	}
+
+	if opts.CheckACPower {
+		result.add(checkACPower(powerSupplyDir))
+	}
+
+	if opts.CheckHeldPackages {
+		held := heldPackages()
+		check := checkHeldPackages(held)
+		result.add(check)
+		if len(held) > 0 {
+			result.Warnings = append(result.Warnings, check.Message)
+		}
+	}
+
+	// Last, since it may wait for another package manager to finish.
+	if opts.CheckPackageLocks && result.OK {
+		result.add(checkPackageLocks(packageLocks, packageLockWait))
+	}
+
+	return result
+}
+
+// CreateRestorePoint is a no-op on Linux.
+func CreateRestorePoint(_ string) error {
+	return nil
+}
+
+// checkDiskSpace verifies /var, which holds the package caches, has at
+// least minGB free space.
+func checkDiskSpace(minGB float64) PreflightCheck {
+	check := PreflightCheck{Name: "disk_space"}
+
+	usage, err := disk.Usage("/var")
+	if err != nil {
+		check.Message = fmt.Sprintf("failed to check disk space on /var: %v", err)
+		return check
+	}
+
+	freeGB := float64(usage.Free) / (1024 * 1024 * 1024)
+	if freeGB < minGB {
+		check.Message = fmt.Sprintf("insufficient disk space: %.1f GB free on /var, minimum %.1f GB required", freeGB, minGB)
+		return check
+	}
+
+	check.Passed = true
+	check.Message = fmt.Sprintf("%.1f GB free on /var", freeGB)
+	return check
+}
+
+// checkBootSpace verifies a separate /boot partition, usually small, has
+// room for a kernel update.
+func checkBootSpace() PreflightCheck {
+	check := PreflightCheck{Name: "boot_space", Passed: true}
+
+	var boot, root unix.Stat_t
+	if err := unix.Stat("/boot", &boot); err != nil {
+		check.Message = "no /boot directory"
+		return check
+	}
+	if err := unix.Stat("/", &root); err == nil && boot.Dev == root.Dev {
+		check.Message = "/boot is on the root filesystem"
+		return check
+	}
+
+	usage, err := disk.Usage("/boot")
+	if err != nil {
+		check.Passed = false
+		check.Message = fmt.Sprintf("failed to check disk space on /boot: %v", err)
+		return check
+	}
+
+	freeMB := usage.Free / (1024 * 1024)
+	if freeMB < bootMinFreeMB {
+		check.Passed = false
+		check.Message = fmt.Sprintf("insufficient space on /boot: %d MB free, minimum %d MB required", freeMB, bootMinFreeMB)
+		return check
+	}
+
+	check.Message = fmt.Sprintf("%d MB free on /boot", freeMB)
+	return check
+}
+
+// checkACPower verifies the machine is on AC power (not battery) using the
+// power supplies under dir. Machines without a system battery always pass.
+func checkACPower(dir string) PreflightCheck {
+	check := PreflightCheck{Name: "battery", Passed: true}
+
+	entries, _ := os.ReadDir(dir)
+	hasBattery, onAC := false, false
+	capacity := ""
+	discharging := false
+	for _, entry := range entries {
+		supply := filepath.Join(dir, entry.Name())
+		switch readSysfs(supply, "type") {
+		case "Mains", "USB":
+			if readSysfs(supply, "online") == "1" {
+				onAC = true
+			}
+		case "Battery":
+			// Mice, keyboards and other peripherals report scope Device.
+			if readSysfs(supply, "scope") == "Device" {
+				continue
+			}
+			hasBattery = true
+			if readSysfs(supply, "status") == "Discharging" {
+				discharging = true
+				capacity = readSysfs(supply, "capacity")
+			}
+		}
+	}
+
+	switch {
+	case !hasBattery:
+		check.Message = "no battery detected"
+	case onAC || !discharging:
+		check.Message = "AC power connected"
+	default:
+		check.Passed = false
+		check.Message = fmt.Sprintf("running on battery power (battery: %s%%)", capacity)
+	}
+	return check
+}
+
+func readSysfs(dir, attr string) string {
+	data, err := os.ReadFile(filepath.Join(dir, attr))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// checkPackageLocks verifies no other package manager run holds one of
+// locks, waiting up to wait for a holder to finish.
+func checkPackageLocks(locks []packageLock, wait time.Duration) PreflightCheck {
+	check := PreflightCheck{Name: "package_lock"}
+
+	deadline := time.Now().Add(wait)
+	for {
+		lock, pid, held := firstHeldLock(locks)
+		if !held {
+			check.Passed = true
+			check.Message = "no package manager lock held"
+			return check
+		}
+		if !time.Now().Before(deadline) {
+			check.Message = fmt.Sprintf("%s is held by %s", lock.path, describeLockHolder(pid))
+			return check
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func firstHeldLock(locks []packageLock) (packageLock, int, bool) {
+	for _, lock := range locks {
+		if pid, held := lockHolder(lock); held {
+			return lock, pid, true
+		}
+	}
+	return packageLock{}, 0, false
+}
+
+// lockHolder reports whether lock is held and, when known, by which PID.
+func lockHolder(lock packageLock) (int, bool) {
+	switch lock.kind {
+	case lockPresence:
+		_, err := os.Stat(lock.path)
+		return 0, err == nil
+	case lockPIDFile:
+		data, err := os.ReadFile(lock.path)
+		if err != nil {
+			return 0, false
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil || pid <= 0 {
+			return 0, false
+		}
+		// The PID file outlives a crashed owner.
+		if err := unix.Kill(pid, 0); err != nil && !errors.Is(err, unix.EPERM) {
+			return 0, false
+		}
+		return pid, true
+	}
+
+	f, err := os.Open(lock.path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	if lock.kind == lockFlock {
+		// Probe with a shared lock, released at once, since flock locks
+		// cannot be queried.
+		if err := unix.Flock(int(f.Fd()), unix.LOCK_SH|unix.LOCK_NB); err != nil {
+			return 0, errors.Is(err, unix.EWOULDBLOCK)
+		}
+		unix.Flock(int(f.Fd()), unix.LOCK_UN)
+		return 0, false
+	}
+
+	// An open file description lock query sees record locks held by any
+	// process, including this one.
+	flock := unix.Flock_t{Type: unix.F_WRLCK}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_OFD_GETLK, &flock); err != nil || flock.Type == unix.F_UNLCK {
+		return 0, false
+	}
+	return max(int(flock.Pid), 0), true
+}
+
+func describeLockHolder(pid int) string {
+	if pid <= 0 {
+		return "another process"
+	}
+	if comm := readSysfs(fmt.Sprintf("/proc/%d", pid), "comm"); comm != "" {
+		return fmt.Sprintf("%s (pid %d)", comm, pid)
+	}
+	return fmt.Sprintf("pid %d", pid)
+}
+
+// checkHeldPackages reports packages pinned against upgrades. Holds are
+// deliberate, so the check always passes; installs simply skip them.
+func checkHeldPackages(held []string) PreflightCheck {
+	check := PreflightCheck{Name: "held_packages", Passed: true}
+	if len(held) == 0 {
+		check.Message = "no held packages"
+		return check
+	}
+	check.Message = fmt.Sprintf("%d held packages will not be upgraded: %s", len(held), strings.Join(held, ", "))
+	return check
+}
+
+// heldPackages lists packages held by apt-mark, the dnf/yum versionlock
+// plugin or pacman's IgnorePkg.
+func heldPackages() []string {
+	var held []string
+
+	if _, err := exec.LookPath("apt-mark"); err == nil {
+		if output, err := cCommand("apt-mark", "showhold").Output(); err == nil {
+			held = append(held, strings.Fields(string(output))...)
+		}
+	}
+
+	for _, mgr := range []string{"dnf", "yum"} {
+		if _, err := exec.LookPath(mgr); err != nil {
+			continue
+		}
+		// Fails when the versionlock plugin is not installed.
+		if output, err := cCommand(mgr, "-q", "versionlock", "list").Output(); err == nil {
+			held = append(held, parseVersionlockList(output)...)
+		}
+		break
+	}
+
+	if data, err := os.ReadFile(pacmanConfPath); err == nil {
+		held = append(held, parsePacmanIgnorePkg(data)...)
+	}
+
+	return held
+}
+
+// parseVersionlockList parses versionlock list output: NEVRA patterns
+// such as "nginx-1:1.20.1-14.el9.*" from dnf4 and yum, or "Package name:"
+// entries from dnf5.
+func parseVersionlockList(output []byte) []string {
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, ok := strings.CutPrefix(line, "Package name:"); ok {
+			names = append(names, strings.TrimSpace(name))
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.Contains(line, " ") {
+			continue
+		}
+		pattern := strings.TrimSuffix(strings.TrimPrefix(line, "!"), ".*")
+		if name := rpmPackageName(pattern); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parsePacmanIgnorePkg returns the packages named by IgnorePkg lines in
+// pacman.conf.
+func parsePacmanIgnorePkg(conf []byte) []string {
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(conf))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || strings.TrimSpace(key) != "IgnorePkg" {
+			continue
+		}
+		names = append(names, strings.Fields(value)...)
+	}
+	return names
+}
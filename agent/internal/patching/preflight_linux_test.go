@@ -0,0 +1,126 @@
+//go:build linux
+
+package patching
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func writePowerSupply(t *testing.T, dir, name string, attrs map[string]string) {
+	t.Helper()
+	supply := filepath.Join(dir, name)
+	if err := os.MkdirAll(supply, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for attr, value := range attrs {
+		if err := os.WriteFile(filepath.Join(supply, attr), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCheckACPower(t *testing.T) {
+	t.Run("no battery", func(t *testing.T) {
+		dir := t.TempDir()
+		writePowerSupply(t, dir, "hidpp_battery_0", map[string]string{"type": "Battery", "scope": "Device", "status": "Discharging"})
+		if check := checkACPower(dir); !check.Passed || check.Message != "no battery detected" {
+			t.Fatalf("unexpected check: %+v", check)
+		}
+	})
+
+	t.Run("on battery", func(t *testing.T) {
+		dir := t.TempDir()
+		writePowerSupply(t, dir, "AC", map[string]string{"type": "Mains", "online": "0"})
+		writePowerSupply(t, dir, "BAT0", map[string]string{"type": "Battery", "status": "Discharging", "capacity": "41"})
+		check := checkACPower(dir)
+		if check.Passed || !strings.Contains(check.Message, "41%") {
+			t.Fatalf("unexpected check: %+v", check)
+		}
+	})
+
+	t.Run("charging", func(t *testing.T) {
+		dir := t.TempDir()
+		writePowerSupply(t, dir, "AC", map[string]string{"type": "Mains", "online": "1"})
+		writePowerSupply(t, dir, "BAT0", map[string]string{"type": "Battery", "status": "Charging", "capacity": "80"})
+		if check := checkACPower(dir); !check.Passed {
+			t.Fatalf("unexpected check: %+v", check)
+		}
+	})
+}
+
+func TestLockHolder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lock")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kind := range []lockKind{lockFcntl, lockFlock} {
+		if _, held := lockHolder(packageLock{path, kind}); held {
+			t.Fatalf("kind %d: unlocked file reported held", kind)
+		}
+	}
+
+	holder, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	flock := unix.Flock_t{Type: unix.F_WRLCK}
+	if err := unix.FcntlFlock(holder.Fd(), unix.F_OFD_SETLK, &flock); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Flock(int(holder.Fd()), unix.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []lockKind{lockFcntl, lockFlock} {
+		if _, held := lockHolder(packageLock{path, kind}); !held {
+			t.Fatalf("kind %d: locked file reported free", kind)
+		}
+	}
+
+	pidFile := filepath.Join(dir, "zypp.pid")
+	os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	if pid, held := lockHolder(packageLock{pidFile, lockPIDFile}); !held || pid != os.Getpid() {
+		t.Fatalf("live PID file: pid=%d held=%v", pid, held)
+	}
+	os.WriteFile(pidFile, []byte("2147483646\n"), 0644)
+	if _, held := lockHolder(packageLock{pidFile, lockPIDFile}); held {
+		t.Fatal("stale PID file reported held")
+	}
+
+	if _, held := lockHolder(packageLock{filepath.Join(dir, "db.lck"), lockPresence}); held {
+		t.Fatal("missing presence lock reported held")
+	}
+
+	check := checkPackageLocks([]packageLock{{path, lockFlock}}, 0)
+	if check.Passed || !strings.Contains(check.Message, path) {
+		t.Fatalf("unexpected check: %+v", check)
+	}
+}
+
+func TestParseVersionlockList(t *testing.T) {
+	dnf4 := "Last metadata expiration check: 0:12:01 ago on Tue 03 Mar 2026.\nnginx-1:1.20.1-14.el9.*\n!kernel-0:5.14.0-362.el9.*\n"
+	if got, want := parseVersionlockList([]byte(dnf4)), []string{"nginx", "kernel"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("dnf4 = %v, want %v", got, want)
+	}
+
+	dnf5 := "# Added by 'versionlock add' command on 2026-03-03 10:00:00\nPackage name: postgresql-server\nevr = 15.6-1.el9\n"
+	if got, want := parseVersionlockList([]byte(dnf5)), []string{"postgresql-server"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("dnf5 = %v, want %v", got, want)
+	}
+}
+
+func TestParsePacmanIgnorePkg(t *testing.T) {
+	conf := "[options]\n#IgnorePkg   = example\nIgnorePkg = linux linux-headers\nIgnorePkg=nvidia\n"
+	if got, want := parsePacmanIgnorePkg([]byte(conf)), []string{"linux", "linux-headers", "nvidia"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("parsePacmanIgnorePkg() = %v, want %v", got, want)
+	}
+}
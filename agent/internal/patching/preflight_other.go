@@ -1,51 +1,114 @@
-//go:build !windows
+//go:build !windows && !linux
 
 package patching
 
-import "github.com/breeze-rmm/agent/internal/config"
-
-// PreflightOptions configures which pre-flight checks to run before patching.
-type PreflightOptions struct {
-	CheckServiceHealth bool
-	CheckDiskSpace     bool
-	MinDiskSpaceGB     float64
-	CheckACPower       bool
-	CheckMaintWindow   bool
-	MaintenanceStart   string
-	MaintenanceEnd     string
-	MaintenanceDays    []string
-}
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
 
-// PreflightResult captures the outcome of all pre-flight checks.
-type PreflightResult struct {
-	OK       bool
-	Checks   []PreflightCheck
-	Warnings []string
-}
+	"github.com/shirou/gopsutil/v3/disk"
 
-// PreflightCheck is one individual check result.
-type PreflightCheck struct {
-	Name    string
-	Passed  bool
-	Message string
-}
+	"github.com/breeze-rmm/agent/internal/config"
+)
+
+// pmsetBatteryPattern matches the charge in pmset -g batt output, e.g.
+// "-InternalBattery-0 (id=1234)	87%; discharging; 4:12 remaining".
+var pmsetBatteryPattern = regexp.MustCompile(`InternalBattery.*?\t(\d+)%`)
 
 // PreflightOptionsFromConfig builds PreflightOptions from config fields.
 func PreflightOptionsFromConfig(cfg *config.Config) PreflightOptions {
-	return PreflightOptions{}
+	return PreflightOptions{
+		CheckDiskSpace:   cfg.PatchMinDiskSpaceGB > 0,
+		MinDiskSpaceGB:   cfg.PatchMinDiskSpaceGB,
+		CheckACPower:     cfg.PatchRequireACPower,
+		CheckMaintWindow: cfg.PatchMaintenanceStart != "" && cfg.PatchMaintenanceEnd != "",
+		MaintenanceStart: cfg.PatchMaintenanceStart,
+		MaintenanceEnd:   cfg.PatchMaintenanceEnd,
+		MaintenanceDays:  cfg.PatchMaintenanceDays,
+	}
 }
 
-// RunPreflight on non-Windows always returns OK.
-func RunPreflight(_ PreflightOptions) PreflightResult {
-	return PreflightResult{OK: true}
-}
+// RunPreflight runs all enabled pre-flight checks and returns a combined result.
+// If any check fails, OK is false and the first failure is returned as the error check.
+func RunPreflight(opts PreflightOptions) PreflightResult {
+	result := PreflightResult{OK: true}
 
-// FirstError returns nil on non-Windows (no checks run).
-func (r PreflightResult) FirstError() error {
-	return nil
+	if opts.CheckDiskSpace {
+		result.add(checkDiskSpace(opts.MinDiskSpaceGB))
+	}
+
+	if opts.CheckACPower {
+		result.add(checkACPower())
+	}
+
+	if opts.CheckMaintWindow {
+		result.add(checkMaintenanceWindow(opts.MaintenanceStart, opts.MaintenanceEnd, opts.MaintenanceDays, time.Now()))
+	}
+
+	return result
 }
 
 // CreateRestorePoint is a no-op on non-Windows.
 func CreateRestorePoint(_ string) error {
 	return nil
 }
+
+// checkDiskSpace verifies the root volume has at least minGB free space.
+func checkDiskSpace(minGB float64) PreflightCheck {
+	check := PreflightCheck{Name: "disk_space"}
+
+	usage, err := disk.Usage("/")
+	if err != nil {
+		check.Message = fmt.Sprintf("failed to check disk space on /: %v", err)
+		return check
+	}
+
+	freeGB := float64(usage.Free) / (1024 * 1024 * 1024)
+	if freeGB < minGB {
+		check.Message = fmt.Sprintf("insufficient disk space: %.1f GB free, minimum %.1f GB required", freeGB, minGB)
+		return check
+	}
+
+	check.Passed = true
+	check.Message = fmt.Sprintf("%.1f GB free on /", freeGB)
+	return check
+}
+
+// checkACPower verifies the machine is on AC power (not battery) using
+// pmset. Machines without pmset or a battery always pass.
+func checkACPower() PreflightCheck {
+	check := PreflightCheck{Name: "battery", Passed: true}
+
+	if _, err := exec.LookPath("pmset"); err != nil {
+		check.Message = "no battery detected"
+		return check
+	}
+	output, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		check.Passed = false
+		check.Message = fmt.Sprintf("failed to get power status: %v", err)
+		return check
+	}
+	return pmsetPowerCheck(string(output))
+}
+
+// pmsetPowerCheck interprets pmset -g batt output, whose first line names
+// the power source: "Now drawing from 'AC Power'" or "'Battery Power'".
+func pmsetPowerCheck(output string) PreflightCheck {
+	check := PreflightCheck{Name: "battery", Passed: true}
+
+	match := pmsetBatteryPattern.FindStringSubmatch(output)
+	switch {
+	case match == nil:
+		check.Message = "no battery detected"
+	case !strings.Contains(output, "'Battery Power'"):
+		check.Message = "AC power connected"
+	default:
+		check.Passed = false
+		check.Message = fmt.Sprintf("running on battery power (battery: %s%%)", match[1])
+	}
+	return check
+}
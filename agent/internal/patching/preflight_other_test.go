@@ -0,0 +1,24 @@
+//go:build !windows && !linux
+
+package patching
+
+import "testing"
+
+func TestPmsetPowerCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{"desktop", "Now drawing from 'AC Power'\n", true},
+		{"charging", "Now drawing from 'AC Power'\n -InternalBattery-0 (id=4587619)\t93%; charging; 0:40 remaining present: true\n", true},
+		{"on battery", "Now drawing from 'Battery Power'\n -InternalBattery-0 (id=4587619)\t62%; discharging; 3:12 remaining present: true\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if check := pmsetPowerCheck(tt.output); check.Passed != tt.want {
+				t.Fatalf("Passed = %v, want %v (%s)", check.Passed, tt.want, check.Message)
+			}
+		})
+	}
+}
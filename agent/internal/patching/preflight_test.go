@@ -0,0 +1,58 @@
+package patching
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckMaintenanceWindow(t *testing.T) {
+	// 2026-03-04 is a Wednesday.
+	at := func(clock string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", "2026-03-04 "+clock, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		days       []string
+		now        time.Time
+		want       bool
+	}{
+		{"inside same-day window", "02:00", "06:00", nil, at("03:30"), true},
+		{"end is exclusive", "02:00", "06:00", nil, at("06:00"), false},
+		{"overnight before midnight", "22:00", "04:00", nil, at("23:15"), true},
+		{"overnight after midnight", "22:00", "04:00", nil, at("01:00"), true},
+		{"overnight outside", "22:00", "04:00", nil, at("12:00"), false},
+		{"allowed day", "00:00", "23:59", []string{"Wednesday"}, at("09:00"), true},
+		{"other day", "00:00", "23:59", []string{"saturday", "sunday"}, at("09:00"), false},
+		{"invalid start", "2am", "06:00", nil, at("03:00"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checkMaintenanceWindow(tt.start, tt.end, tt.days, tt.now)
+			if check.Passed != tt.want {
+				t.Fatalf("Passed = %v, want %v (%s)", check.Passed, tt.want, check.Message)
+			}
+		})
+	}
+}
+
+func TestPreflightResultFirstError(t *testing.T) {
+	result := PreflightResult{OK: true}
+	result.add(PreflightCheck{Name: "disk_space", Passed: true})
+	if !result.OK || result.FirstError() != nil {
+		t.Fatalf("passing checks should leave result OK: %+v", result)
+	}
+
+	result.add(PreflightCheck{Name: "package_lock", Message: "held"})
+	result.add(PreflightCheck{Name: "battery", Message: "on battery"})
+	err, ok := result.FirstError().(*ErrPreflightFailed)
+	if result.OK || !ok || err.Check != "package_lock" {
+		t.Fatalf("FirstError() = %v, OK = %v", result.FirstError(), result.OK)
+	}
+}
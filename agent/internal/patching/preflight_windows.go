@@ -5,7 +5,6 @@ package patching
 import (
 	"fmt"
 	"os"
-	"strings"
 	"time"
 	"unsafe"
 
@@ -17,32 +16,6 @@ import (
 	"github.com/breeze-rmm/agent/internal/config"
 )
 
-// PreflightOptions configures which pre-flight checks to run before patching.
-type PreflightOptions struct {
-	CheckServiceHealth bool
-	CheckDiskSpace     bool
-	MinDiskSpaceGB     float64
-	CheckACPower       bool
-	CheckMaintWindow   bool
-	MaintenanceStart   string   // "HH:MM"
-	MaintenanceEnd     string   // "HH:MM"
-	MaintenanceDays    []string // ["monday", ...] empty=all
-}
-
-// PreflightResult captures the outcome of all pre-flight checks.
-type PreflightResult struct {
-	OK       bool
-	Checks   []PreflightCheck
-	Warnings []string
-}
-
-// PreflightCheck is one individual check result.
-type PreflightCheck struct {
-	Name    string
-	Passed  bool
-	Message string
-}
-
 // PreflightOptionsFromConfig builds PreflightOptions from config fields.
 func PreflightOptionsFromConfig(cfg *config.Config) PreflightOptions {
 	return PreflightOptions{
@@ -63,50 +36,24 @@ func RunPreflight(opts PreflightOptions) PreflightResult {
 	result := PreflightResult{OK: true}
 
 	if opts.CheckServiceHealth {
-		check := checkWUServiceHealth()
-		result.Checks = append(result.Checks, check)
-		if !check.Passed {
-			result.OK = false
-		}
+		result.add(checkWUServiceHealth())
 	}
 
 	if opts.CheckDiskSpace {
-		check := checkDiskSpace(opts.MinDiskSpaceGB)
-		result.Checks = append(result.Checks, check)
-		if !check.Passed {
-			result.OK = false
-		}
+		result.add(checkDiskSpace(opts.MinDiskSpaceGB))
 	}
 
 	if opts.CheckACPower {
-		check := checkACPower()
-		result.Checks = append(result.Checks, check)
-		if !check.Passed {
-			result.OK = false
-		}
+		result.add(checkACPower())
 	}
 
 	if opts.CheckMaintWindow {
-		check := checkMaintenanceWindow(opts.MaintenanceStart, opts.MaintenanceEnd, opts.MaintenanceDays)
-		result.Checks = append(result.Checks, check)
-		if !check.Passed {
-			result.OK = false
-		}
+		result.add(checkMaintenanceWindow(opts.MaintenanceStart, opts.MaintenanceEnd, opts.MaintenanceDays, time.Now()))
 	}
 
 	return result
 }
 
-// FirstError returns the first failed check as an ErrPreflightFailed, or nil if all passed.
-func (r PreflightResult) FirstError() error {
-	for _, check := range r.Checks {
-		if !check.Passed {
-			return &ErrPreflightFailed{Check: check.Name, Message: check.Message}
-		}
-	}
-	return nil
-}
-
 // checkWUServiceHealth ensures the Windows Update service (wuauserv) is running.
 // If stopped, it attempts to start it and waits up to 30 seconds.
 func checkWUServiceHealth() PreflightCheck {
@@ -256,64 +203,6 @@ func checkACPower() PreflightCheck {
 	return check
 }
 
-// checkMaintenanceWindow verifies current time falls within the configured maintenance window.
-// Handles overnight windows (e.g. 22:00-06:00).
-func checkMaintenanceWindow(startStr, endStr string, days []string) PreflightCheck {
-	check := PreflightCheck{Name: "maintenance_window"}
-
-	startTime, err := time.Parse("15:04", startStr)
-	if err != nil {
-		check.Message = fmt.Sprintf("invalid maintenance start time %q: %v", startStr, err)
-		return check
-	}
-	endTime, err := time.Parse("15:04", endStr)
-	if err != nil {
-		check.Message = fmt.Sprintf("invalid maintenance end time %q: %v", endStr, err)
-		return check
-	}
-
-	now := time.Now()
-
-	// Check day-of-week if days are specified
-	if len(days) > 0 {
-		todayName := strings.ToLower(now.Weekday().String())
-		dayAllowed := false
-		for _, d := range days {
-			if strings.ToLower(d) == todayName {
-				dayAllowed = true
-				break
-			}
-		}
-		if !dayAllowed {
-			check.Message = fmt.Sprintf("today (%s) is not in maintenance days", todayName)
-			return check
-		}
-	}
-
-	// Compare time-of-day only (hours and minutes)
-	nowMinutes := now.Hour()*60 + now.Minute()
-	startMinutes := startTime.Hour()*60 + startTime.Minute()
-	endMinutes := endTime.Hour()*60 + endTime.Minute()
-
-	var inWindow bool
-	if startMinutes <= endMinutes {
-		// Same-day window (e.g. 02:00 - 06:00)
-		inWindow = nowMinutes >= startMinutes && nowMinutes < endMinutes
-	} else {
-		// Overnight window (e.g. 22:00 - 06:00)
-		inWindow = nowMinutes >= startMinutes || nowMinutes < endMinutes
-	}
-
-	if !inWindow {
-		check.Message = fmt.Sprintf("current time %s is outside maintenance window %s-%s", now.Format("15:04"), startStr, endStr)
-		return check
-	}
-
-	check.Passed = true
-	check.Message = fmt.Sprintf("within maintenance window %s-%s", startStr, endStr)
-	return check
-}
-
 // CreateRestorePoint creates a Windows System Restore point.
 // Best-effort: returns error but callers should not block on failure.
 func CreateRestorePoint(description string) error {
@@ -0,0 +1,125 @@
+//go:build linux
+
+package patching
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// cCommand builds a command that runs in the C locale, so its output can
+// be parsed regardless of the system language.
+func cCommand(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	return cmd
+}
+
+// installWithProgress reports the start and end of a single install
+// around install.
+func installWithProgress(patchID string, progress ProgressCallback, install func(string) (InstallResult, error)) (InstallResult, error) {
+	if progress != nil {
+		progress(ProgressEvent{
+			Phase:       "installing",
+			PatchID:     patchID,
+			CurrentItem: 1,
+			TotalItems:  1,
+			Message:     fmt.Sprintf("Installing update %s", patchID),
+		})
+	}
+
+	result, err := install(patchID)
+
+	if progress != nil {
+		msg := "Install completed"
+		if err != nil {
+			msg = fmt.Sprintf("Install failed: %v", err)
+		}
+		progress(ProgressEvent{
+			Phase:       "installing",
+			PatchID:     patchID,
+			Percent:     100,
+			CurrentItem: 1,
+			TotalItems:  1,
+			Message:     msg,
+		})
+	}
+
+	return result, err
+}
+
+// downloadEach downloads patches one at a time so each gets its own
+// result, reporting progress by item.
+func downloadEach(patchIDs []string, progress ProgressCallback, download func(string) error) []DownloadResult {
+	results := make([]DownloadResult, 0, len(patchIDs))
+	for i, patchID := range patchIDs {
+		if progress != nil {
+			progress(ProgressEvent{
+				Phase:       "downloading",
+				PatchID:     patchID,
+				Percent:     float64(i) * 100 / float64(len(patchIDs)),
+				CurrentItem: i + 1,
+				TotalItems:  len(patchIDs),
+				Message:     fmt.Sprintf("Downloading %s", patchID),
+			})
+		}
+
+		result := DownloadResult{PatchID: patchID, Success: true, Message: "downloaded"}
+		if err := download(patchID); err != nil {
+			result.Success = false
+			result.Message = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	if progress != nil && len(patchIDs) > 0 {
+		progress(ProgressEvent{
+			Phase:       "downloading",
+			Percent:     100,
+			CurrentItem: len(patchIDs),
+			TotalItems:  len(patchIDs),
+			Message:     fmt.Sprintf("Downloaded %d updates", len(patchIDs)),
+		})
+	}
+
+	return results
+}
+
+// sizeUnits are the suffixes package tools use for sizes, in bytes.
+var sizeUnits = map[string]float64{
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+}
+
+// parseSize parses a human-readable size such as "272MB", "56.3 MB" or
+// "1.23 MiB", returning 0 when it is not understood. Callers run tools
+// with LC_ALL=C so the decimal separator is a point.
+func parseSize(value string) int64 {
+	value = strings.TrimSpace(value)
+	end := 0
+	for end < len(value) && (value[end] >= '0' && value[end] <= '9' || value[end] == '.') {
+		end++
+	}
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil {
+		return 0
+	}
+	unit := strings.TrimSpace(value[end:])
+	if unit == "" {
+		return int64(number)
+	}
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0
+	}
+	return int64(number * multiplier)
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package patching
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	for value, want := range map[string]int64{
+		"272MB":    272000000,
+		"56.3 MB":  56300000,
+		"1.5 GiB":  1610612736,
+		"512":      512,
+		"12 bytes": 0,
+		"":         0,
+	} {
+		if got := parseSize(value); got != want {
+			t.Errorf("parseSize(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestDownloadEachReportsPerPatchResults(t *testing.T) {
+	var events []ProgressEvent
+	results := downloadEach([]string{"a", "b"}, func(e ProgressEvent) { events = append(events, e) }, func(id string) error {
+		if id == "b" {
+			return errTestDownload
+		}
+		return nil
+	})
+	if len(results) != 2 || !results[0].Success || results[1].Success || results[1].Message != errTestDownload.Error() {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if len(events) != 3 || events[2].Percent != 100 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+var errTestDownload = errors.New("download failed")
@@ -0,0 +1,414 @@
+package patching
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+
+	"github.com/breeze-rmm/agent/internal/config"
+)
+
+// rebootDetectInterval is how long a pending reboot detection is reused.
+// Detection can run needs-restarting, which takes many seconds.
+const rebootDetectInterval = 15 * time.Minute
+
+// missedRebootDelay is how long after start-up the agent waits before a
+// restored reboot whose time passed while the agent was not running.
+const missedRebootDelay = time.Minute
+
+// RebootState tracks the current reboot scheduling state.
+type RebootState struct {
+	PendingReboot    bool      `json:"pendingReboot"`
+	RebootScheduled  bool      `json:"rebootScheduled"`
+	ScheduledAt      time.Time `json:"scheduledAt,omitempty"`
+	Deadline         time.Time `json:"deadline,omitempty"`
+	Reason           string    `json:"reason,omitempty"`
+	NotifiedUser     bool      `json:"notifiedUser"`
+	NotificationSent time.Time `json:"notificationSent,omitempty"`
+	Source           string    `json:"source"` // "patch_install", "manual", "policy"
+}
+
+// savedReboot is a scheduled reboot as persisted across agent restarts.
+type savedReboot struct {
+	RebootState
+	SavedAt time.Time `json:"savedAt"`
+}
+
+// NotifyFunc is called to send a notification to the logged-in user.
+type NotifyFunc func(title, body, urgency string)
+
+// RebootManager handles reboot scheduling, notification, and execution.
+type RebootManager struct {
+	mu               sync.Mutex
+	state            RebootState
+	scheduledTimer   *time.Timer
+	notifyTimers     []*time.Timer
+	notifyFn         NotifyFunc
+	rebootFn         func() error
+	detectFn         func() (bool, []string)
+	stopChan         chan struct{}
+	stopped          bool
+	maxRebootsPerDay int
+	rebootHistory    []time.Time
+	historyPath      string
+	statePath        string
+
+	// Cached pending reboot detection, refreshed in the background.
+	detectedPending bool
+	detectedAt      time.Time
+	detecting       bool
+}
+
+// NewRebootManager creates a new RebootManager with circuit breaker protection.
+func NewRebootManager(notifyFn NotifyFunc, maxRebootsPerDay int) *RebootManager {
+	return newRebootManager(notifyFn, maxRebootsPerDay, config.GetDataDir())
+}
+
+func newRebootManager(notifyFn NotifyFunc, maxRebootsPerDay int, dataDir string) *RebootManager {
+	if maxRebootsPerDay <= 0 {
+		maxRebootsPerDay = 3
+	}
+	rm := &RebootManager{
+		notifyFn:         notifyFn,
+		rebootFn:         systemReboot,
+		detectFn:         DetectPendingReboot,
+		stopChan:         make(chan struct{}),
+		maxRebootsPerDay: maxRebootsPerDay,
+		historyPath:      filepath.Join(dataDir, "reboot_history.json"),
+		statePath:        filepath.Join(dataDir, "reboot_state.json"),
+	}
+	rm.loadRebootHistory()
+	rm.restoreSchedule(lastBootTime())
+	return rm
+}
+
+// State returns the current reboot state.
+func (r *RebootManager) State() RebootState {
+	// Detection can take many seconds, so it must not hold up Schedule or
+	// Cancel.
+	pending, _ := r.detectFn()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.detectedPending = pending
+	r.detectedAt = time.Now()
+	r.state.PendingReboot = pending
+	return r.state
+}
+
+// PendingReboot returns the last pending reboot detection without waiting
+// for a new one. A detection older than rebootDetectInterval is refreshed
+// in the background, so the result may lag by one call.
+func (r *RebootManager) PendingReboot() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.detectedAt) >= rebootDetectInterval {
+		r.refreshLocked()
+	}
+	return r.detectedPending
+}
+
+// RefreshPendingReboot starts a new pending reboot detection, for use after
+// patches were installed or rolled back.
+func (r *RebootManager) RefreshPendingReboot() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refreshLocked()
+}
+
+func (r *RebootManager) refreshLocked() {
+	if r.detecting || r.stopped {
+		return
+	}
+	r.detecting = true
+	go func() {
+		pending, _ := r.detectFn()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.detecting = false
+		r.detectedPending = pending
+		r.detectedAt = time.Now()
+	}()
+}
+
+// Schedule schedules a reboot after the given delay with a hard deadline.
+// A deadline earlier than the delay brings the reboot forward to it.
+func (r *RebootManager) Schedule(delay time.Duration, deadline time.Time, reason, source string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return fmt.Errorf("reboot manager is stopped")
+	}
+
+	now := time.Now()
+	if !deadline.IsZero() && !deadline.After(now) {
+		return fmt.Errorf("reboot deadline %s has already passed", deadline.Format(time.RFC3339))
+	}
+	if !deadline.IsZero() && deadline.Before(now.Add(delay)) {
+		delay = deadline.Sub(now)
+	}
+
+	// Cancel any existing schedule
+	r.cancelLocked()
+
+	rebootAt := now.Add(delay)
+	r.state = RebootState{
+		PendingReboot:   true,
+		RebootScheduled: true,
+		ScheduledAt:     rebootAt,
+		Deadline:        deadline,
+		Reason:          reason,
+		Source:          source,
+	}
+	r.armLocked(delay)
+	r.saveStateLocked()
+
+	return nil
+}
+
+// armLocked starts the reboot and user notification timers.
+func (r *RebootManager) armLocked(delay time.Duration) {
+	r.scheduledTimer = time.AfterFunc(delay, func() {
+		r.executeReboot()
+	})
+	r.scheduleNotifications(delay)
+}
+
+// restoreSchedule re-arms a reboot scheduled before the agent restarted.
+// A schedule saved before the machine last booted has been overtaken by
+// that boot and is dropped.
+func (r *RebootManager) restoreSchedule(bootTime time.Time) {
+	data, err := os.ReadFile(r.statePath)
+	if err != nil {
+		return
+	}
+	var saved savedReboot
+	if err := json.Unmarshal(data, &saved); err != nil || !saved.RebootScheduled || saved.SavedAt.Before(bootTime) {
+		os.Remove(r.statePath)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delay := time.Until(saved.ScheduledAt)
+	if delay < missedRebootDelay {
+		delay = missedRebootDelay
+		saved.ScheduledAt = time.Now().Add(delay)
+	}
+	r.state = saved.RebootState
+	r.armLocked(delay)
+	log.Info("restored scheduled reboot", "scheduledAt", r.state.ScheduledAt, "reason", r.state.Reason)
+}
+
+// saveStateLocked persists a scheduled reboot so that an agent restart
+// does not cancel it, and removes the record once nothing is scheduled.
+func (r *RebootManager) saveStateLocked() {
+	if !r.state.RebootScheduled {
+		if err := os.Remove(r.statePath); err != nil && !os.IsNotExist(err) {
+			log.Warn("failed to remove reboot state", "error", err)
+		}
+		return
+	}
+	data, err := json.Marshal(savedReboot{RebootState: r.state, SavedAt: time.Now()})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(r.statePath), 0700); err != nil {
+		log.Warn("failed to create reboot state dir", "error", err)
+		return
+	}
+	if err := os.WriteFile(r.statePath, data, 0600); err != nil {
+		log.Warn("failed to save reboot state", "error", err)
+	}
+}
+
+// Cancel cancels a scheduled reboot.
+func (r *RebootManager) Cancel() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.state.RebootScheduled {
+		return fmt.Errorf("no reboot scheduled")
+	}
+
+	r.cancelLocked()
+
+	// Abort any shutdown the OS has already started counting down
+	abortSystemReboot()
+
+	r.state.RebootScheduled = false
+	r.state.ScheduledAt = time.Time{}
+	r.state.Deadline = time.Time{}
+	r.saveStateLocked()
+
+	return nil
+}
+
+// Stop stops the reboot manager's timers. A scheduled reboot stays saved
+// and is restored when the agent starts again.
+func (r *RebootManager) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return // already stopped, avoid double-close on stopChan
+	}
+	r.stopped = true
+	r.cancelLocked()
+	close(r.stopChan)
+}
+
+func (r *RebootManager) cancelLocked() {
+	if r.scheduledTimer != nil {
+		r.scheduledTimer.Stop()
+		r.scheduledTimer = nil
+	}
+	for _, t := range r.notifyTimers {
+		t.Stop()
+	}
+	r.notifyTimers = nil
+}
+
+func (r *RebootManager) scheduleNotifications(totalDelay time.Duration) {
+	type notification struct {
+		before  time.Duration
+		title   string
+		body    string
+		urgency string
+	}
+
+	notifications := []notification{
+		{60 * time.Minute, "Reboot Scheduled", "A system reboot is scheduled in 1 hour for system updates. Please save your work.", "normal"},
+		{15 * time.Minute, "Reboot Soon", "A system reboot is scheduled in 15 minutes. Please save your work.", "normal"},
+		{5 * time.Minute, "Reboot Imminent", "System will reboot in 5 minutes. Save all work now.", "critical"},
+	}
+
+	for _, n := range notifications {
+		if totalDelay > n.before {
+			delay := totalDelay - n.before
+			notif := n // capture for closure
+			timer := time.AfterFunc(delay, func() {
+				if r.notifyFn != nil {
+					r.notifyFn(notif.title, notif.body, notif.urgency)
+				}
+				r.mu.Lock()
+				r.state.NotifiedUser = true
+				r.state.NotificationSent = time.Now()
+				r.mu.Unlock()
+			})
+			r.notifyTimers = append(r.notifyTimers, timer)
+		}
+	}
+}
+
+func (r *RebootManager) executeReboot() {
+	r.mu.Lock()
+
+	if r.stopped {
+		r.mu.Unlock()
+		return
+	}
+
+	// Circuit breaker: check reboot frequency
+	now := time.Now()
+	cutoff := now.Add(-24 * time.Hour)
+	recentCount := 0
+	for _, t := range r.rebootHistory {
+		if t.After(cutoff) {
+			recentCount++
+		}
+	}
+
+	if recentCount >= r.maxRebootsPerDay {
+		r.state.RebootScheduled = false
+		r.saveStateLocked()
+		r.mu.Unlock()
+
+		log.Warn("reboot blocked by circuit breaker",
+			"recentReboots", recentCount, "maxPerDay", r.maxRebootsPerDay)
+
+		if r.notifyFn != nil {
+			r.notifyFn("Reboot Blocked",
+				fmt.Sprintf("Too many reboots detected (%d in 24h, max %d). Reboot cancelled to prevent reboot loop.",
+					recentCount, r.maxRebootsPerDay),
+				"critical")
+		}
+		return
+	}
+
+	// Record this reboot
+	r.rebootHistory = append(r.rebootHistory, now)
+	r.state.RebootScheduled = false
+	r.saveStateLocked()
+	r.mu.Unlock()
+
+	// Persist history before rebooting
+	r.saveRebootHistory()
+
+	// Notify user of imminent reboot
+	if r.notifyFn != nil {
+		r.notifyFn("Rebooting Now", "System is rebooting for updates.", "critical")
+	}
+
+	if err := r.rebootFn(); err != nil {
+		log.Error("reboot command failed", "error", err.Error())
+	}
+}
+
+func (r *RebootManager) loadRebootHistory() {
+	data, err := os.ReadFile(r.historyPath)
+	if err != nil {
+		return
+	}
+
+	var history []time.Time
+	if err := json.Unmarshal(data, &history); err != nil {
+		return
+	}
+
+	// Only keep entries from last 24 hours
+	cutoff := time.Now().Add(-24 * time.Hour)
+	filtered := make([]time.Time, 0, len(history))
+	for _, t := range history {
+		if t.After(cutoff) {
+			filtered = append(filtered, t)
+		}
+	}
+
+	r.rebootHistory = filtered
+}
+
+func (r *RebootManager) saveRebootHistory() {
+	r.mu.Lock()
+	history := make([]time.Time, len(r.rebootHistory))
+	copy(history, r.rebootHistory)
+	r.mu.Unlock()
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		return
+	}
+
+	dir := filepath.Dir(r.historyPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Debug("failed to create reboot history dir", "error", err)
+		return
+	}
+	if err := os.WriteFile(r.historyPath, data, 0600); err != nil {
+		log.Debug("failed to write reboot history", "error", err)
+	}
+}
+
+func lastBootTime() time.Time {
+	bootTime, err := host.BootTime()
+	if err != nil || bootTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(bootTime), 0)
+}
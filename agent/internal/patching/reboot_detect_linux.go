@@ -0,0 +1,177 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	rebootRequiredPath     = "/var/run/reboot-required"
+	rebootRequiredPkgsPath = "/var/run/reboot-required.pkgs"
+	kernelReleasePath      = "/proc/sys/kernel/osrelease"
+	kernelModulesDir       = "/lib/modules"
+)
+
+// needsRestartingTimeout bounds needs-restarting, which reads the whole
+// RPM database.
+const needsRestartingTimeout = 30 * time.Second
+
+// DetectPendingReboot checks multiple sources to determine if a reboot is pending.
+// Returns true if any source indicates a pending reboot, along with the reasons.
+func DetectPendingReboot() (bool, []string) {
+	var reasons []string
+
+	// 1. Debian/Ubuntu flag file written by package maintainer scripts
+	if _, err := os.Stat(rebootRequiredPath); err == nil {
+		reason := "System restart required"
+		if pkgs := readRebootRequiredPkgs(rebootRequiredPkgsPath); len(pkgs) > 0 {
+			reason += " by " + strings.Join(pkgs, ", ")
+		}
+		reasons = append(reasons, reason)
+	}
+
+	// 2. A newer kernel than the running one is installed
+	kernelPending := false
+	if running, err := os.ReadFile(kernelReleasePath); err == nil {
+		release := strings.TrimSpace(string(running))
+		if newest := newestKernel(release, installedKernels()); newest != "" {
+			kernelPending = true
+			reasons = append(reasons, fmt.Sprintf("Running kernel %s, newer kernel %s installed", release, newest))
+		}
+	}
+
+	// 3. RHEL-family needs-restarting, which also covers core libraries. It
+	// repeats the kernel check, so skip it when that already fired.
+	if !kernelPending && needsRestarting() {
+		reasons = append(reasons, "needs-restarting reports core libraries or services updated")
+	}
+
+	// 4. Patch installs the agent recorded as needing a reboot
+	reasons = append(reasons, markedRebootReasons()...)
+
+	return len(reasons) > 0, reasons
+}
+
+// readRebootRequiredPkgs returns the distinct package names listed in
+// reboot-required.pkgs, in file order.
+func readRebootRequiredPkgs(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var pkgs []string
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		pkgs = append(pkgs, name)
+	}
+	return pkgs
+}
+
+// installedKernels lists the kernel releases with a modules directory.
+func installedKernels() []string {
+	entries, err := os.ReadDir(kernelModulesDir)
+	if err != nil {
+		return nil
+	}
+	var releases []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			releases = append(releases, entry.Name())
+		}
+	}
+	return releases
+}
+
+// newestKernel returns the newest installed kernel of the running kernel's
+// flavour if it is newer than the running one, or "" otherwise. Flavours
+// such as -generic and -lowlatency, or linux and linux-lts, are compared
+// separately so a second installed flavour is not mistaken for an update.
+func newestKernel(running string, installed []string) string {
+	flavour := kernelFlavour(running)
+	newest := ""
+	for _, release := range installed {
+		if kernelFlavour(release) != flavour {
+			continue
+		}
+		if newest == "" || compareKernelVersions(release, newest) > 0 {
+			newest = release
+		}
+	}
+	if newest == "" || compareKernelVersions(newest, running) <= 0 {
+		return ""
+	}
+	return newest
+}
+
+// kernelFlavour returns what follows the last digit of a kernel release,
+// e.g. "-generic" for "6.8.0-45-generic" and ".x86_64" for
+// "5.14.0-427.el9.x86_64".
+func kernelFlavour(release string) string {
+	last := strings.LastIndexFunc(release, isASCIIDigit)
+	return release[last+1:]
+}
+
+// compareKernelVersions compares kernel releases piecewise, treating runs
+// of digits as numbers so that "-101" sorts after "-91".
+func compareKernelVersions(a, b string) int {
+	for a != "" && b != "" {
+		var pa, pb string
+		pa, a = splitVersionRun(a)
+		pb, b = splitVersionRun(b)
+		if isASCIIDigit(rune(pa[0])) && isASCIIDigit(rune(pb[0])) {
+			pa, pb = strings.TrimLeft(pa, "0"), strings.TrimLeft(pb, "0")
+			if c := cmp.Compare(len(pa), len(pb)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(pa, pb); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// splitVersionRun splits off the leading run of digits or non-digits.
+func splitVersionRun(s string) (string, string) {
+	digits := isASCIIDigit(rune(s[0]))
+	end := strings.IndexFunc(s, func(r rune) bool { return isASCIIDigit(r) != digits })
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
+
+func isASCIIDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// needsRestarting reports whether needs-restarting -r, from yum-utils or
+// dnf-utils, says a reboot is required.
+func needsRestarting() bool {
+	if _, err := exec.LookPath("needs-restarting"); err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), needsRestartingTimeout)
+	defer cancel()
+
+	// needs-restarting -r exits 1 when a reboot is required.
+	err := exec.CommandContext(ctx, "needs-restarting", "-r").Run()
+	exitErr, ok := err.(*exec.ExitError)
+	return ok && exitErr.ExitCode() == 1
+}
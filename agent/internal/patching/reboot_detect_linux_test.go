@@ -0,0 +1,94 @@
+//go:build linux
+
+package patching
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewestKernel(t *testing.T) {
+	tests := []struct {
+		name      string
+		running   string
+		installed []string
+		want      string
+	}{
+		{
+			name:      "ubuntu newer abi",
+			running:   "5.15.0-91-generic",
+			installed: []string{"5.15.0-91-generic", "5.15.0-101-generic", "5.15.0-94-lowlatency"},
+			want:      "5.15.0-101-generic",
+		},
+		{
+			name:      "ubuntu running newest",
+			running:   "5.15.0-101-generic",
+			installed: []string{"5.15.0-91-generic", "5.15.0-101-generic"},
+		},
+		{
+			name:      "rhel",
+			running:   "4.18.0-477.27.1.el8_8.x86_64",
+			installed: []string{"4.18.0-477.27.1.el8_8.x86_64", "4.18.0-513.9.1.el8_9.x86_64"},
+			want:      "4.18.0-513.9.1.el8_9.x86_64",
+		},
+		{
+			name:      "arch removes running modules",
+			running:   "6.6.7-arch1-1",
+			installed: []string{"6.6.8-arch1-1", "6.1.69-1-lts"},
+			want:      "6.6.8-arch1-1",
+		},
+		{
+			name:      "container without modules",
+			running:   "6.8.0-45-generic",
+			installed: nil,
+		},
+		{
+			name:      "custom kernel newer than packages",
+			running:   "6.10.0-custom",
+			installed: []string{"6.8.0-custom"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newestKernel(tt.running, tt.installed); got != tt.want {
+				t.Fatalf("newestKernel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareKernelVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"6.1.0-17-amd64", "6.1.0-9-amd64", 1},
+		{"5.14.0-362.el9", "5.14.0-427.el9", -1},
+		{"6.6.8-arch1-1", "6.6.8-arch1-1", 0},
+		{"6.6.8-arch2-1", "6.6.8-arch10-1", -1},
+		{"6.6.8", "6.6.8.1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareKernelVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareKernelVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestReadRebootRequiredPkgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reboot-required.pkgs")
+	if err := os.WriteFile(path, []byte("linux-image-5.15.0-101-generic\nlibc6\n\nlinux-image-5.15.0-101-generic\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"linux-image-5.15.0-101-generic", "libc6"}
+	if got := readRebootRequiredPkgs(path); !reflect.DeepEqual(got, want) {
+		t.Fatalf("readRebootRequiredPkgs() = %v, want %v", got, want)
+	}
+	if got := readRebootRequiredPkgs(filepath.Join(t.TempDir(), "missing")); got != nil {
+		t.Fatalf("missing file = %v, want nil", got)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !linux
+
+package patching
+
+// DetectPendingReboot reports the patch installs the agent recorded as
+// needing a reboot since the last boot. macOS keeps no system-wide record
+// of this, so softwareupdate installs are tracked through their results.
+func DetectPendingReboot() (bool, []string) {
+	reasons := markedRebootReasons()
+	return len(reasons) > 0, reasons
+}
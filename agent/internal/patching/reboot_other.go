@@ -2,37 +2,86 @@
 
 package patching
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
 
-// DetectPendingReboot is a no-op on non-Windows platforms.
-func DetectPendingReboot() (bool, []string) {
-	return false, nil
+	"github.com/breeze-rmm/agent/internal/config"
+)
+
+// systemReboot restarts the machine immediately.
+func systemReboot() error {
+	if _, err := exec.LookPath("shutdown"); err != nil {
+		// BusyBox systems such as Alpine may ship reboot without shutdown.
+		return exec.Command("reboot").Run()
+	}
+	return exec.Command("shutdown", "-r", "now").Run()
+}
+
+// abortSystemReboot is a no-op: reboots are issued with no OS-side delay,
+// so there is never a countdown to abort.
+func abortSystemReboot() {}
+
+// rebootMarker records patch installs that need a reboot to take effect,
+// for package managers that leave no trace of it on the system.
+type rebootMarker struct {
+	RecordedAt time.Time `json:"recordedAt"`
+	Reasons    []string  `json:"reasons"`
 }
 
-// RebootState tracks the current reboot scheduling state.
-type RebootState struct {
-	PendingReboot    bool      `json:"pendingReboot"`
-	RebootScheduled  bool      `json:"rebootScheduled"`
-	ScheduledAt      time.Time `json:"scheduledAt,omitempty"`
-	Deadline         time.Time `json:"deadline,omitempty"`
-	Reason           string    `json:"reason,omitempty"`
-	NotifiedUser     bool      `json:"notifiedUser"`
-	NotificationSent time.Time `json:"notificationSent,omitempty"`
-	Source           string    `json:"source"`
+func rebootMarkerPath() string {
+	return filepath.Join(config.GetDataDir(), "reboot_required.json")
 }
 
-// NotifyFunc is called to send a notification to the logged-in user.
-type NotifyFunc func(title, body, urgency string)
+// recordPendingReboot notes that a patch install needs a reboot. The note
+// lapses once the machine has booted after it was written.
+func recordPendingReboot(patchID string) {
+	if err := writeRebootMarker(rebootMarkerPath(), lastBootTime(), time.Now(), patchID+" requires reboot"); err != nil {
+		log.Debug("failed to record pending reboot", "error", err)
+	}
+}
 
-// RebootManager handles reboot scheduling on non-Windows (stub).
-type RebootManager struct{}
+// markedRebootReasons returns the reasons recorded since the last boot.
+func markedRebootReasons() []string {
+	return readRebootMarker(rebootMarkerPath(), lastBootTime())
+}
 
-// NewRebootManager creates a no-op RebootManager on non-Windows.
-func NewRebootManager(_ NotifyFunc, _ int) *RebootManager {
-	return &RebootManager{}
+// readRebootMarker returns the marker's reasons, or nil if the marker is
+// missing or was written before bootTime.
+func readRebootMarker(path string, bootTime time.Time) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var marker rebootMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		return nil
+	}
+	if marker.RecordedAt.Before(bootTime) {
+		return nil
+	}
+	return marker.Reasons
 }
 
-func (r *RebootManager) State() RebootState                                             { return RebootState{} }
-func (r *RebootManager) Schedule(_ time.Duration, _ time.Time, _, _ string) error { return nil }
-func (r *RebootManager) Cancel() error                                                   { return nil }
-func (r *RebootManager) Stop()                                                           {}
+// writeRebootMarker adds reason to the marker, starting a new one if the
+// existing marker predates bootTime.
+func writeRebootMarker(path string, bootTime, now time.Time, reason string) error {
+	reasons := readRebootMarker(path, bootTime)
+	if !slices.Contains(reasons, reason) {
+		reasons = append(reasons, reason)
+	}
+
+	data, err := json.Marshal(rebootMarker{RecordedAt: now, Reasons: reasons})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("create reboot marker dir: %w", err)
+	}
+	return os.WriteFile(path, data, 0600)
+}
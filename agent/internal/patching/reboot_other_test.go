@@ -0,0 +1,40 @@
+//go:build !windows
+
+package patching
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRebootMarkerLapsesAfterBoot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "reboot_required.json")
+	boot := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	if got := readRebootMarker(path, boot); got != nil {
+		t.Fatalf("missing marker = %v, want nil", got)
+	}
+
+	for _, reason := range []string{"apk:linux-lts requires reboot", "apk:linux-lts requires reboot", "pacman:systemd requires reboot"} {
+		if err := writeRebootMarker(path, boot, boot.Add(time.Hour), reason); err != nil {
+			t.Fatalf("writeRebootMarker: %v", err)
+		}
+	}
+	want := []string{"apk:linux-lts requires reboot", "pacman:systemd requires reboot"}
+	if got := readRebootMarker(path, boot); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reasons = %v, want %v", got, want)
+	}
+
+	nextBoot := boot.Add(2 * time.Hour)
+	if got := readRebootMarker(path, nextBoot); got != nil {
+		t.Fatalf("reasons after reboot = %v, want nil", got)
+	}
+	if err := writeRebootMarker(path, nextBoot, nextBoot.Add(time.Minute), "snap:core22 requires reboot"); err != nil {
+		t.Fatalf("writeRebootMarker: %v", err)
+	}
+	if got := readRebootMarker(path, nextBoot); !reflect.DeepEqual(got, []string{"snap:core22 requires reboot"}) {
+		t.Fatalf("reasons after new install = %v", got)
+	}
+}
@@ -0,0 +1,195 @@
+package patching
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRebootManager(t *testing.T, maxPerDay int) (*RebootManager, *[]string, *int) {
+	t.Helper()
+	var notified []string
+	reboots := 0
+	rm := newRebootManager(func(title, _, _ string) {
+		notified = append(notified, title)
+	}, maxPerDay, t.TempDir())
+	rm.rebootFn = func() error {
+		reboots++
+		return nil
+	}
+	t.Cleanup(rm.Stop)
+	return rm, &notified, &reboots
+}
+
+func TestRebootManagerScheduleBringsRebootForwardToDeadline(t *testing.T) {
+	rm, _, _ := newTestRebootManager(t, 3)
+
+	deadline := time.Now().Add(30 * time.Minute)
+	if err := rm.Schedule(2*time.Hour, deadline, "patches", "manual"); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+
+	rm.mu.Lock()
+	state := rm.state
+	notifications := len(rm.notifyTimers)
+	rm.mu.Unlock()
+	if !state.RebootScheduled || !state.ScheduledAt.Equal(deadline) {
+		t.Fatalf("scheduled at %v, want deadline %v", state.ScheduledAt, deadline)
+	}
+	// Only the 15 and 5 minute warnings fit before a 30 minute deadline.
+	if notifications != 2 {
+		t.Fatalf("notification timers = %d, want 2", notifications)
+	}
+}
+
+func TestRebootManagerScheduleRejectsPastDeadline(t *testing.T) {
+	rm, _, _ := newTestRebootManager(t, 3)
+
+	if err := rm.Schedule(time.Hour, time.Now().Add(-time.Minute), "patches", "manual"); err == nil {
+		t.Fatal("expected error for a deadline in the past")
+	}
+	if err := rm.Cancel(); err == nil {
+		t.Fatal("expected Cancel to fail with nothing scheduled")
+	}
+}
+
+func TestRebootManagerExecuteRebootRecordsHistory(t *testing.T) {
+	rm, notified, reboots := newTestRebootManager(t, 3)
+
+	rm.executeReboot()
+	if *reboots != 1 {
+		t.Fatalf("reboots = %d, want 1", *reboots)
+	}
+	if len(*notified) != 1 || (*notified)[0] != "Rebooting Now" {
+		t.Fatalf("notifications = %v", *notified)
+	}
+
+	reloaded := newRebootManager(nil, 3, filepath.Dir(rm.historyPath))
+	defer reloaded.Stop()
+	if len(reloaded.rebootHistory) != 1 {
+		t.Fatalf("reloaded history = %v, want one entry", reloaded.rebootHistory)
+	}
+}
+
+func TestRebootManagerCircuitBreakerBlocksReboot(t *testing.T) {
+	rm, notified, reboots := newTestRebootManager(t, 2)
+	rm.rebootHistory = []time.Time{
+		time.Now().Add(-2 * time.Hour),
+		time.Now().Add(-time.Hour),
+		time.Now().Add(-25 * time.Hour),
+	}
+	rm.state.RebootScheduled = true
+
+	rm.executeReboot()
+	if *reboots != 0 {
+		t.Fatalf("reboots = %d, want 0", *reboots)
+	}
+	if rm.state.RebootScheduled {
+		t.Fatal("blocked reboot should clear the schedule")
+	}
+	if len(*notified) != 1 || (*notified)[0] != "Reboot Blocked" {
+		t.Fatalf("notifications = %v", *notified)
+	}
+}
+
+func TestRebootManagerStateDetectsOutsideLock(t *testing.T) {
+	rm, _, _ := newTestRebootManager(t, 3)
+	detecting, release := make(chan struct{}), make(chan struct{})
+	rm.detectFn = func() (bool, []string) {
+		close(detecting)
+		<-release
+		return true, []string{"test"}
+	}
+
+	done := make(chan RebootState)
+	go func() { done <- rm.State() }()
+	<-detecting
+	if err := rm.Schedule(time.Hour, time.Time{}, "patches", "manual"); err != nil {
+		t.Fatalf("Schedule during detection: %v", err)
+	}
+	close(release)
+	if state := <-done; !state.PendingReboot || !state.RebootScheduled {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func TestRebootManagerRestoresScheduleAfterRestart(t *testing.T) {
+	rm, _, _ := newTestRebootManager(t, 3)
+	if err := rm.Schedule(2*time.Hour, time.Time{}, "patches", "manual"); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	scheduledAt := rm.State().ScheduledAt
+	rm.Stop()
+
+	dataDir := filepath.Dir(rm.historyPath)
+	restarted := newRebootManager(nil, 3, dataDir)
+	restarted.rebootFn = func() error { return nil }
+	defer restarted.Stop()
+	restarted.mu.Lock()
+	state, armed := restarted.state, restarted.scheduledTimer != nil
+	restarted.mu.Unlock()
+	if !armed || !state.RebootScheduled || !state.ScheduledAt.Equal(scheduledAt) || state.Reason != "patches" {
+		t.Fatalf("restored %+v (armed %v), want the reboot at %v", state, armed, scheduledAt)
+	}
+
+	if err := restarted.Cancel(); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	again := newRebootManager(nil, 3, dataDir)
+	defer again.Stop()
+	if again.state.RebootScheduled {
+		t.Fatal("cancelled reboot was restored")
+	}
+}
+
+func TestRebootManagerDropsScheduleOvertakenByBoot(t *testing.T) {
+	rm, _, _ := newTestRebootManager(t, 3)
+	if err := rm.Schedule(time.Hour, time.Time{}, "patches", "manual"); err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	rm.Stop()
+
+	// The machine booted after the reboot was scheduled.
+	restarted := &RebootManager{statePath: rm.statePath}
+	restarted.restoreSchedule(time.Now().Add(time.Minute))
+	if restarted.state.RebootScheduled || restarted.scheduledTimer != nil {
+		t.Fatalf("restored a reboot the machine already went through: %+v", restarted.state)
+	}
+	if _, err := os.Stat(rm.statePath); !os.IsNotExist(err) {
+		t.Fatalf("stale reboot state kept: %v", err)
+	}
+}
+
+func TestRebootManagerPendingRebootIsCached(t *testing.T) {
+	rm, _, _ := newTestRebootManager(t, 3)
+	calls := make(chan struct{}, 10)
+	rm.detectFn = func() (bool, []string) {
+		calls <- struct{}{}
+		return true, []string{"test"}
+	}
+
+	// The first call starts a detection in the background.
+	rm.PendingReboot()
+	<-calls
+	deadline := time.Now().Add(5 * time.Second)
+	for !rm.PendingReboot() {
+		if time.Now().After(deadline) {
+			t.Fatal("detection result never cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 5; i++ {
+		rm.PendingReboot()
+	}
+	if len(calls) != 0 {
+		t.Fatalf("detected %d more times within the cache interval", len(calls))
+	}
+
+	rm.RefreshPendingReboot()
+	select {
+	case <-calls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RefreshPendingReboot did not detect again")
+	}
+}
@@ -0,0 +1,438 @@
+package patching
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxRollbackManifests is how many manifests are kept on disk; older ones
+// are pruned as new jobs complete.
+const maxRollbackManifests = 20
+
+// maxLVMSnapshots is how many LVM snapshots are kept. Every classic LVM
+// snapshot adds a copy-on-write to each write to the root volume and
+// fills up as the origin changes, so only the newest is kept; older
+// manifests lose their snapshot but keep their package changes.
+const maxLVMSnapshots = 1
+
+// PackageChange is one package version changed by a patch job.
+type PackageChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"` // empty if the job installed the package
+	To   string `json:"to,omitempty"`   // empty if the job removed the package
+}
+
+// ProviderRollback records what a patch job changed through one provider.
+type ProviderRollback struct {
+	Provider     string          `json:"provider"`
+	Changes      []PackageChange `json:"changes"`
+	Transactions []int           `json:"transactions,omitempty"` // package manager history IDs, oldest first
+}
+
+// FilesystemSnapshot identifies a snapshot taken before a patch job.
+type FilesystemSnapshot struct {
+	Type string `json:"type"` // "snapper", "btrfs" or "lvm"
+	Name string `json:"name"` // snapper number, subvolume path or vg/lv
+}
+
+// RollbackManifest records everything a patch job changed so that it can
+// be reverted later, possibly long after the job ran.
+type RollbackManifest struct {
+	ID        string              `json:"id"`
+	CreatedAt time.Time           `json:"createdAt"`
+	Providers []ProviderRollback  `json:"providers"`
+	Snapshot  *FilesystemSnapshot `json:"snapshot,omitempty"`
+}
+
+// RollbackResult captures the outcome of reverting one provider's changes.
+type RollbackResult struct {
+	Provider string
+	Success  bool
+	Message  string
+}
+
+// VersionRestorer is implemented by providers that can put packages back
+// at exact earlier versions, so rollback downgrades instead of uninstalling.
+type VersionRestorer interface {
+	RestoreVersions(changes []PackageChange) error
+}
+
+// TransactionalProvider is implemented by providers whose package manager
+// keeps an undoable transaction history.
+type TransactionalProvider interface {
+	LastTransaction() (int, error)
+	UndoTransaction(id int) error
+	// TransactionPackages returns the names of the packages a history
+	// transaction changed.
+	TransactionPackages(id int) ([]string, error)
+}
+
+// Transaction captures installed package versions before a patch job so
+// Commit can record what the job changed.
+type Transaction struct {
+	dir       string
+	id        string
+	started   time.Time
+	providers []PatchProvider
+	before    map[string][]InstalledPatch
+	lastTx    map[string]int
+	snapshot  *FilesystemSnapshot
+}
+
+// BeginTransaction records the installed packages of every provider able
+// to restore them. Providers whose state cannot be read are left out.
+func (m *PatchManager) BeginTransaction() *Transaction {
+	tx := &Transaction{
+		dir:     m.rollbackDir,
+		id:      newRollbackID(),
+		started: time.Now().UTC(),
+		before:  map[string][]InstalledPatch{},
+		lastTx:  map[string]int{},
+	}
+
+	for _, provider := range m.providers {
+		_, restorer := provider.(VersionRestorer)
+		transactional, hasHistory := provider.(TransactionalProvider)
+		if !restorer && !hasHistory {
+			continue
+		}
+
+		installed, err := provider.GetInstalled()
+		if err != nil {
+			log.Warn("rollback capture failed", "provider", provider.ID(), "error", err.Error())
+			continue
+		}
+		tx.providers = append(tx.providers, provider)
+		tx.before[provider.ID()] = installed
+
+		if hasHistory {
+			if last, err := transactional.LastTransaction(); err == nil {
+				tx.lastTx[provider.ID()] = last
+			} else {
+				log.Warn("transaction history unavailable", "provider", provider.ID(), "error", err.Error())
+			}
+		}
+	}
+
+	return tx
+}
+
+// ID returns the ID the transaction's manifest will be saved under.
+func (t *Transaction) ID() string {
+	return t.id
+}
+
+// SetSnapshot attaches a filesystem snapshot taken before the job.
+func (t *Transaction) SetSnapshot(snapshot *FilesystemSnapshot) {
+	t.snapshot = snapshot
+}
+
+// Commit compares installed packages with those recorded at the start and
+// saves a manifest of the differences. It returns nil if nothing changed.
+func (t *Transaction) Commit() (*RollbackManifest, error) {
+	manifest := RollbackManifest{
+		ID:        t.id,
+		CreatedAt: t.started,
+		Snapshot:  t.snapshot,
+	}
+
+	for _, provider := range t.providers {
+		after, err := provider.GetInstalled()
+		if err != nil {
+			log.Warn("rollback capture failed", "provider", provider.ID(), "error", err.Error())
+			continue
+		}
+		changes := diffInstalled(t.before[provider.ID()], after)
+		if len(changes) == 0 {
+			continue
+		}
+
+		entry := ProviderRollback{Provider: provider.ID(), Changes: changes}
+		if before, ok := t.lastTx[provider.ID()]; ok {
+			entry.Transactions = jobTransactions(provider.(TransactionalProvider), before, changes)
+		}
+		manifest.Providers = append(manifest.Providers, entry)
+	}
+
+	if len(manifest.Providers) == 0 && manifest.Snapshot == nil {
+		return nil, nil
+	}
+	if err := saveRollbackManifest(t.dir, manifest); err != nil {
+		return &manifest, err
+	}
+	return &manifest, nil
+}
+
+// jobTransactions returns the history IDs after before that changed only
+// packages the job changed. Transactions run by anything else while the job
+// was in progress are left out so that rollback does not undo them.
+func jobTransactions(provider TransactionalProvider, before int, changes []PackageChange) []int {
+	last, err := provider.LastTransaction()
+	if err != nil {
+		return nil
+	}
+	changed := make(map[string]bool, len(changes))
+	for _, change := range changes {
+		changed[change.Name] = true
+	}
+
+	var ids []int
+	for id := before + 1; id <= last; id++ {
+		packages, err := provider.TransactionPackages(id)
+		if err != nil {
+			log.Warn("transaction packages unavailable", "transaction", id, "error", err.Error())
+			continue
+		}
+		if len(packages) > 0 && !slices.ContainsFunc(packages, func(name string) bool { return !changed[name] }) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Rollback reverts every provider's changes in a manifest, newest first,
+// undoing package manager transactions where they were recorded and
+// restoring exact versions otherwise.
+func (m *PatchManager) Rollback(manifest RollbackManifest) []RollbackResult {
+	results := make([]RollbackResult, 0, len(manifest.Providers))
+	for i := len(manifest.Providers) - 1; i >= 0; i-- {
+		entry := manifest.Providers[i]
+		result := RollbackResult{Provider: entry.Provider}
+		if err := m.rollbackProvider(entry); err != nil {
+			result.Message = err.Error()
+		} else {
+			result.Success = true
+			result.Message = fmt.Sprintf("restored %d packages", len(entry.Changes))
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (m *PatchManager) rollbackProvider(entry ProviderRollback) error {
+	provider, ok := m.providerIndex[entry.Provider]
+	if !ok {
+		return fmt.Errorf("unknown patch provider: %s", entry.Provider)
+	}
+
+	if transactional, ok := provider.(TransactionalProvider); ok && len(entry.Transactions) > 0 {
+		var undoErr error
+		for i := len(entry.Transactions) - 1; i >= 0; i-- {
+			if undoErr = transactional.UndoTransaction(entry.Transactions[i]); undoErr != nil {
+				break
+			}
+		}
+		if undoErr == nil {
+			return nil
+		}
+		// History may have been pruned or rewritten since; fall back to
+		// restoring versions directly.
+		log.Warn("transaction undo failed", "provider", entry.Provider, "error", undoErr.Error())
+	}
+
+	restorer, ok := provider.(VersionRestorer)
+	if !ok {
+		return fmt.Errorf("provider %s cannot restore previous versions", entry.Provider)
+	}
+	return restorer.RestoreVersions(entry.Changes)
+}
+
+// RollbackPatch reverts a single patch. If a saved manifest recorded the
+// package's previous version, that version is restored; otherwise the
+// provider uninstalls the patch.
+func (m *PatchManager) RollbackPatch(patchID string) error {
+	providerID, localID, err := m.splitPatchID(patchID)
+	if err != nil {
+		return err
+	}
+	provider, ok := m.providerIndex[providerID]
+	if !ok {
+		return fmt.Errorf("unknown patch provider: %s", providerID)
+	}
+
+	if restorer, ok := provider.(VersionRestorer); ok {
+		if change, found := findPackageChange(m.rollbackDir, providerID, localID); found {
+			return restorer.RestoreVersions([]PackageChange{change})
+		}
+	}
+	return provider.Uninstall(localID)
+}
+
+// LoadRollbackManifest reads a saved manifest by ID.
+func (m *PatchManager) LoadRollbackManifest(id string) (RollbackManifest, error) {
+	return loadRollbackManifest(m.rollbackDir, id)
+}
+
+// diffInstalled returns the package changes between two installed lists.
+// Packages installed at several versions at once, such as kernels, are
+// compared as sets so that a new kernel shows as an addition.
+func diffInstalled(before, after []InstalledPatch) []PackageChange {
+	versions := func(installed []InstalledPatch) map[string][]string {
+		byName := map[string][]string{}
+		for _, pkg := range installed {
+			byName[pkg.ID] = append(byName[pkg.ID], pkg.Version)
+		}
+		return byName
+	}
+	beforeVersions, afterVersions := versions(before), versions(after)
+
+	names := make([]string, 0, len(beforeVersions)+len(afterVersions))
+	for name := range beforeVersions {
+		names = append(names, name)
+	}
+	for name := range afterVersions {
+		if _, ok := beforeVersions[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var changes []PackageChange
+	for _, name := range names {
+		var removed, added []string
+		for _, v := range beforeVersions[name] {
+			if !slices.Contains(afterVersions[name], v) {
+				removed = append(removed, v)
+			}
+		}
+		for _, v := range afterVersions[name] {
+			if !slices.Contains(beforeVersions[name], v) {
+				added = append(added, v)
+			}
+		}
+
+		if len(removed) == 1 && len(added) == 1 {
+			changes = append(changes, PackageChange{Name: name, From: removed[0], To: added[0]})
+			continue
+		}
+		for _, v := range removed {
+			changes = append(changes, PackageChange{Name: name, From: v})
+		}
+		for _, v := range added {
+			changes = append(changes, PackageChange{Name: name, To: v})
+		}
+	}
+	return changes
+}
+
+func rollbackManifestDir(dataDir string) string {
+	return filepath.Join(dataDir, "patch_rollback")
+}
+
+func newRollbackID() string {
+	random := make([]byte, 4)
+	_, _ = rand.Read(random)
+	return fmt.Sprintf("rollback-%s-%x", time.Now().UTC().Format("20060102T150405Z"), random)
+}
+
+// deleteSnapshotFunc is swapped out in tests.
+var deleteSnapshotFunc = DeleteSnapshot
+
+// saveRollbackManifest writes a manifest and prunes all but the newest
+// maxRollbackManifests, deleting the filesystem snapshots they recorded.
+// LVM snapshots beyond maxLVMSnapshots are deleted as well.
+func saveRollbackManifest(dir string, manifest RollbackManifest) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create rollback manifest dir: %w", err)
+	}
+	if err := writeRollbackManifest(dir, manifest); err != nil {
+		return err
+	}
+
+	manifests := listRollbackManifests(dir)
+	for _, old := range manifests[min(len(manifests), maxRollbackManifests):] {
+		if old.Snapshot != nil {
+			if err := deleteSnapshotFunc(*old.Snapshot); err != nil {
+				log.Warn("failed to delete pruned snapshot", "manifest", old.ID, "snapshot", old.Snapshot.Name, "error", err.Error())
+			}
+		}
+		os.Remove(filepath.Join(dir, old.ID+".json"))
+	}
+
+	lvmSnapshots := 0
+	for _, kept := range manifests[:min(len(manifests), maxRollbackManifests)] {
+		if kept.Snapshot == nil || kept.Snapshot.Type != "lvm" {
+			continue
+		}
+		if lvmSnapshots++; lvmSnapshots <= maxLVMSnapshots {
+			continue
+		}
+		// A snapshot that failed to delete stays recorded so the next
+		// save retries it.
+		if err := deleteSnapshotFunc(*kept.Snapshot); err != nil {
+			log.Warn("failed to delete superseded LVM snapshot", "manifest", kept.ID, "snapshot", kept.Snapshot.Name, "error", err.Error())
+			continue
+		}
+		kept.Snapshot = nil
+		if err := writeRollbackManifest(dir, kept); err != nil {
+			log.Warn("failed to update rollback manifest", "manifest", kept.ID, "error", err.Error())
+		}
+	}
+	return nil
+}
+
+func writeRollbackManifest(dir string, manifest RollbackManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifest.ID+".json"), data, 0600); err != nil {
+		return fmt.Errorf("write rollback manifest: %w", err)
+	}
+	return nil
+}
+
+func loadRollbackManifest(dir, id string) (RollbackManifest, error) {
+	// IDs come from the server; keep them inside the manifest directory.
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return RollbackManifest{}, fmt.Errorf("invalid rollback manifest id %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return RollbackManifest{}, fmt.Errorf("rollback manifest %s not found: %w", id, err)
+	}
+	var manifest RollbackManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return RollbackManifest{}, fmt.Errorf("rollback manifest %s is corrupt: %w", id, err)
+	}
+	return manifest, nil
+}
+
+// listRollbackManifests returns the saved manifests, newest first.
+func listRollbackManifests(dir string) []RollbackManifest {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	manifests := make([]RollbackManifest, 0, len(paths))
+	for _, path := range paths {
+		manifest, err := loadRollbackManifest(dir, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	slices.SortFunc(manifests, func(a, b RollbackManifest) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return manifests
+}
+
+// findPackageChange returns the newest recorded upgrade of a package
+// through a provider.
+func findPackageChange(dir, providerID, name string) (PackageChange, bool) {
+	for _, manifest := range listRollbackManifests(dir) {
+		for _, entry := range manifest.Providers {
+			if entry.Provider != providerID {
+				continue
+			}
+			for _, change := range entry.Changes {
+				if change.Name == name && change.From != "" && change.To != "" {
+					return change, true
+				}
+			}
+		}
+	}
+	return PackageChange{}, false
+}
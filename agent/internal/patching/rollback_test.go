@@ -0,0 +1,296 @@
+package patching
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// restoringProvider is a fakeProvider whose installed packages change on
+// Install and which records restores and transaction undos.
+type restoringProvider struct {
+	fakeProvider
+	upgrades map[string]string
+	restored [][]PackageChange
+	history  int
+	undone   []int
+	undoErr  error
+	// txPackages maps each history ID to the packages it changed.
+	txPackages map[int][]string
+}
+
+func (p *restoringProvider) Install(patchID string) (InstallResult, error) {
+	var changed []string
+	for i, pkg := range p.installed {
+		if version, ok := p.upgrades[pkg.ID]; ok {
+			p.installed[i].Version = version
+			changed = append(changed, pkg.ID)
+		}
+	}
+	p.record(changed...)
+	return p.fakeProvider.Install(patchID)
+}
+
+// record adds a history transaction that changed names.
+func (p *restoringProvider) record(names ...string) {
+	p.history++
+	if p.txPackages == nil {
+		p.txPackages = map[int][]string{}
+	}
+	p.txPackages[p.history] = names
+}
+
+func (p *restoringProvider) GetInstalled() ([]InstalledPatch, error) {
+	return slices.Clone(p.installed), nil
+}
+
+func (p *restoringProvider) RestoreVersions(changes []PackageChange) error {
+	p.restored = append(p.restored, changes)
+	return nil
+}
+
+// transactionalProvider adds a transaction history to restoringProvider.
+type transactionalProvider struct {
+	*restoringProvider
+}
+
+func (p transactionalProvider) LastTransaction() (int, error) { return p.history, nil }
+
+func (p transactionalProvider) UndoTransaction(id int) error {
+	p.undone = append(p.undone, id)
+	return p.undoErr
+}
+
+func (p transactionalProvider) TransactionPackages(id int) ([]string, error) {
+	return p.txPackages[id], nil
+}
+
+func TestDiffInstalled(t *testing.T) {
+	before := []InstalledPatch{
+		{ID: "openssl", Version: "3.0.2-0ubuntu1.12"},
+		{ID: "kernel", Version: "5.14.0-362.el9"},
+		{ID: "curl", Version: "7.81.0-1"},
+		{ID: "unchanged", Version: "1.0"},
+	}
+	after := []InstalledPatch{
+		{ID: "openssl", Version: "3.0.2-0ubuntu1.15"},
+		{ID: "kernel", Version: "5.14.0-362.el9"},
+		{ID: "kernel", Version: "5.14.0-427.el9"},
+		{ID: "libnghttp2", Version: "1.43.0-1"},
+		{ID: "unchanged", Version: "1.0"},
+	}
+
+	want := []PackageChange{
+		{Name: "curl", From: "7.81.0-1"},
+		{Name: "kernel", To: "5.14.0-427.el9"},
+		{Name: "libnghttp2", To: "1.43.0-1"},
+		{Name: "openssl", From: "3.0.2-0ubuntu1.12", To: "3.0.2-0ubuntu1.15"},
+	}
+	if got := diffInstalled(before, after); !reflect.DeepEqual(got, want) {
+		t.Fatalf("diffInstalled() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTransactionCommitSavesManifest(t *testing.T) {
+	apt := &restoringProvider{
+		fakeProvider: fakeProvider{id: "apt", installed: []InstalledPatch{{ID: "openssl", Version: "1.0"}, {ID: "curl", Version: "7.0"}}},
+		upgrades:     map[string]string{"openssl": "1.1"},
+	}
+	other := &fakeProvider{id: "snap"}
+	mgr := NewPatchManager(apt, other)
+	mgr.SetDataDir(t.TempDir())
+
+	tx := mgr.BeginTransaction()
+	if _, err := mgr.Install("apt:openssl"); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := tx.Commit()
+	if err != nil || manifest == nil {
+		t.Fatalf("Commit() = %v, %v", manifest, err)
+	}
+
+	want := []ProviderRollback{{Provider: "apt", Changes: []PackageChange{{Name: "openssl", From: "1.0", To: "1.1"}}}}
+	if !reflect.DeepEqual(manifest.Providers, want) {
+		t.Fatalf("providers = %+v, want %+v", manifest.Providers, want)
+	}
+
+	loaded, err := mgr.LoadRollbackManifest(manifest.ID)
+	if err != nil || !reflect.DeepEqual(loaded.Providers, want) {
+		t.Fatalf("LoadRollbackManifest() = %+v, %v", loaded, err)
+	}
+
+	// A second job that changes nothing produces no manifest.
+	if manifest, err := mgr.BeginTransaction().Commit(); manifest != nil || err != nil {
+		t.Fatalf("empty Commit() = %+v, %v", manifest, err)
+	}
+}
+
+func TestRollbackUndoesTransactionsBeforeRestoringVersions(t *testing.T) {
+	inner := &restoringProvider{
+		fakeProvider: fakeProvider{id: "yum", installed: []InstalledPatch{{ID: "nginx", Version: "1.20"}}},
+		upgrades:     map[string]string{"nginx": "1.22"},
+		history:      40,
+	}
+	yum := transactionalProvider{inner}
+	mgr := NewPatchManager(yum)
+	mgr.SetDataDir(t.TempDir())
+
+	tx := mgr.BeginTransaction()
+	mgr.Install("yum:nginx")
+	mgr.Install("yum:nginx")
+	manifest, err := tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manifest.Providers[0].Transactions; !reflect.DeepEqual(got, []int{41, 42}) {
+		t.Fatalf("transactions = %v, want [41 42]", got)
+	}
+
+	results := mgr.Rollback(*manifest)
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("results = %+v", results)
+	}
+	if !reflect.DeepEqual(inner.undone, []int{42, 41}) || len(inner.restored) != 0 {
+		t.Fatalf("undone = %v, restored = %v", inner.undone, inner.restored)
+	}
+
+	inner.undone = nil
+	inner.undoErr = errors.New("history pruned")
+	if results := mgr.Rollback(*manifest); !results[0].Success || len(inner.restored) != 1 {
+		t.Fatalf("fallback results = %+v, restored = %v", results, inner.restored)
+	}
+}
+
+func TestTransactionCommitSkipsUnrelatedTransactions(t *testing.T) {
+	inner := &restoringProvider{
+		fakeProvider: fakeProvider{id: "yum", installed: []InstalledPatch{{ID: "nginx", Version: "1.20"}}},
+		upgrades:     map[string]string{"nginx": "1.22"},
+		history:      40,
+	}
+	mgr := NewPatchManager(transactionalProvider{inner})
+	mgr.SetDataDir(t.TempDir())
+
+	tx := mgr.BeginTransaction()
+	// Someone else installs vim while the job runs.
+	inner.record("vim")
+	mgr.Install("yum:nginx")
+	manifest, err := tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := manifest.Providers[0].Transactions; !reflect.DeepEqual(got, []int{42}) {
+		t.Fatalf("transactions = %v, want [42]", got)
+	}
+}
+
+func TestRollbackPatchRestoresRecordedVersion(t *testing.T) {
+	apt := &restoringProvider{fakeProvider: fakeProvider{id: "apt"}}
+	mgr := NewPatchManager(apt)
+	mgr.SetDataDir(t.TempDir())
+	for i, version := range []string{"1.1", "1.2"} {
+		err := saveRollbackManifest(mgr.rollbackDir, RollbackManifest{
+			ID:        fmt.Sprintf("rollback-%d", i),
+			CreatedAt: time.Date(2026, 3, 1+i, 0, 0, 0, 0, time.UTC),
+			Providers: []ProviderRollback{{Provider: "apt", Changes: []PackageChange{{Name: "openssl", From: version, To: version + ".1"}}}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mgr.RollbackPatch("apt:openssl"); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]PackageChange{{{Name: "openssl", From: "1.2", To: "1.2.1"}}}
+	if !reflect.DeepEqual(apt.restored, want) || apt.lastUninstID != "" {
+		t.Fatalf("restored = %+v, uninstalled %q", apt.restored, apt.lastUninstID)
+	}
+
+	if err := mgr.RollbackPatch("apt:curl"); err != nil {
+		t.Fatal(err)
+	}
+	if apt.lastUninstID != "curl" {
+		t.Fatalf("unrecorded package should be uninstalled, got %q", apt.lastUninstID)
+	}
+}
+
+func TestSaveRollbackManifestPrunesOldest(t *testing.T) {
+	var deleted []FilesystemSnapshot
+	deleteSnapshotFunc = func(snapshot FilesystemSnapshot) error {
+		deleted = append(deleted, snapshot)
+		return nil
+	}
+	t.Cleanup(func() { deleteSnapshotFunc = DeleteSnapshot })
+
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < maxRollbackManifests+2; i++ {
+		manifest := RollbackManifest{ID: fmt.Sprintf("rollback-%02d", i), CreatedAt: base.Add(time.Duration(i) * time.Hour)}
+		if i == 0 {
+			manifest.Snapshot = &FilesystemSnapshot{Type: "lvm", Name: "vg0/breeze-00"}
+		}
+		if err := saveRollbackManifest(dir, manifest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []FilesystemSnapshot{{Type: "lvm", Name: "vg0/breeze-00"}}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted snapshots = %+v, want %+v", deleted, want)
+	}
+
+	manifests := listRollbackManifests(dir)
+	if len(manifests) != maxRollbackManifests || manifests[0].ID != fmt.Sprintf("rollback-%02d", maxRollbackManifests+1) {
+		t.Fatalf("kept %d manifests, newest %q", len(manifests), manifests[0].ID)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rollback-00.json")); !os.IsNotExist(err) {
+		t.Fatalf("oldest manifest not pruned: %v", err)
+	}
+
+	for _, id := range []string{"", "../config", ".hidden"} {
+		if _, err := loadRollbackManifest(dir, id); err == nil {
+			t.Errorf("loadRollbackManifest(%q) should fail", id)
+		}
+	}
+}
+
+func TestSaveRollbackManifestKeepsNewestLVMSnapshot(t *testing.T) {
+	var deleted []string
+	deleteSnapshotFunc = func(snapshot FilesystemSnapshot) error {
+		deleted = append(deleted, snapshot.Name)
+		return nil
+	}
+	t.Cleanup(func() { deleteSnapshotFunc = DeleteSnapshot })
+
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		manifest := RollbackManifest{
+			ID:        fmt.Sprintf("rollback-%02d", i),
+			CreatedAt: base.Add(time.Duration(i) * time.Hour),
+			Snapshot:  &FilesystemSnapshot{Type: "lvm", Name: fmt.Sprintf("vg0/breeze-%02d", i)},
+		}
+		if err := saveRollbackManifest(dir, manifest); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"vg0/breeze-00", "vg0/breeze-01"}; !reflect.DeepEqual(deleted, want) {
+		t.Fatalf("deleted snapshots = %v, want %v", deleted, want)
+	}
+
+	manifests := listRollbackManifests(dir)
+	if len(manifests) != 3 {
+		t.Fatalf("kept %d manifests, want all 3", len(manifests))
+	}
+	if manifests[0].Snapshot == nil || manifests[0].Snapshot.Name != "vg0/breeze-02" {
+		t.Fatalf("newest manifest lost its snapshot: %+v", manifests[0].Snapshot)
+	}
+	for _, manifest := range manifests[1:] {
+		if manifest.Snapshot != nil {
+			t.Fatalf("manifest %s still records deleted snapshot %s", manifest.ID, manifest.Snapshot.Name)
+		}
+	}
+}
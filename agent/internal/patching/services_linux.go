@@ -0,0 +1,196 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// deletedSuffix marks mappings of files removed since they were mapped.
+const deletedSuffix = " (deleted)"
+
+// packagedPrefixes are the trees package managers install into; deleted
+// mappings elsewhere, such as memfd or /tmp files, are not stale code.
+var packagedPrefixes = []string{"/usr/", "/lib/", "/lib32/", "/lib64/", "/bin/", "/sbin/", "/opt/"}
+
+// unsafeRestartUnits are services whose restart ends user sessions or
+// disrupts the system, matching needrestart's defaults.
+var unsafeRestartUnits = []string{
+	"dbus.service",
+	"dbus-broker.service",
+	"systemd-logind.service",
+	"display-manager.service",
+	"gdm.service",
+	"gdm3.service",
+	"lightdm.service",
+	"sddm.service",
+	"xdm.service",
+	"getty@*.service",
+	"serial-getty@*.service",
+}
+
+// FindStaleServices returns system services with processes still mapping
+// packaged files that have since been replaced, needrestart-style.
+func FindStaleServices() []StaleService {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	byUnit := map[string]*StaleService{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		cgroup, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cgroup"))
+		if err != nil {
+			continue
+		}
+		unit := serviceUnitFromCgroup(cgroup)
+		if unit == "" {
+			continue
+		}
+		maps, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "maps"))
+		if err != nil {
+			continue
+		}
+		files := deletedMappings(maps)
+		if len(files) == 0 {
+			continue
+		}
+
+		service, ok := byUnit[unit]
+		if !ok {
+			service = &StaleService{Unit: unit}
+			byUnit[unit] = service
+		}
+		service.PIDs = append(service.PIDs, pid)
+		for _, file := range files {
+			if !slices.Contains(service.Files, file) {
+				service.Files = append(service.Files, file)
+			}
+		}
+	}
+
+	services := make([]StaleService, 0, len(byUnit))
+	for _, service := range byUnit {
+		slices.Sort(service.Files)
+		services = append(services, *service)
+	}
+	slices.SortFunc(services, func(a, b StaleService) int { return strings.Compare(a.Unit, b.Unit) })
+	return services
+}
+
+// RestartServices restarts units with systemctl try-restart, skipping
+// those unsafe to restart and the agent's own service.
+func RestartServices(units []string) []ServiceRestartResult {
+	self := ""
+	if cgroup, err := os.ReadFile("/proc/self/cgroup"); err == nil {
+		self = serviceUnitFromCgroup(cgroup)
+	}
+
+	results := make([]ServiceRestartResult, 0, len(units))
+	for _, unit := range units {
+		result := ServiceRestartResult{Unit: unit}
+		switch {
+		case unit == self:
+			result.Message = "skipped: agent service"
+		case unsafeToRestart(unit):
+			result.Message = "skipped: restarting would disrupt user sessions"
+		default:
+			output, err := cCommand("systemctl", "try-restart", unit).CombinedOutput()
+			if err != nil {
+				result.Message = fmt.Sprintf("systemctl try-restart failed: %v: %s", err, strings.TrimSpace(string(output)))
+			} else {
+				result.Success = true
+				result.Message = "restarted"
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func unsafeToRestart(unit string) bool {
+	for _, pattern := range unsafeRestartUnits {
+		if matched, _ := path.Match(pattern, unit); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceUnitFromCgroup returns the system service owning a process from
+// its /proc/<pid>/cgroup contents, or "" for processes outside
+// system.slice such as user sessions and containers.
+func serviceUnitFromCgroup(cgroup []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		line := scanner.Text()
+		// cgroup v2 unified hierarchy, or the v1 systemd hierarchy.
+		_, cgroupPath, ok := strings.Cut(line, "::")
+		if !ok {
+			_, cgroupPath, ok = strings.Cut(line, ":name=systemd:")
+		}
+		if !ok {
+			continue
+		}
+
+		segments := strings.Split(strings.Trim(cgroupPath, "/"), "/")
+		if len(segments) < 2 || segments[0] != "system.slice" {
+			return ""
+		}
+		// Services that delegate their cgroup nest sub-groups below it.
+		if strings.HasSuffix(segments[1], ".service") {
+			return segments[1]
+		}
+		return ""
+	}
+	return ""
+}
+
+// deletedMappings returns the distinct deleted packaged files in a
+// /proc/<pid>/maps listing.
+func deletedMappings(maps []byte) []string {
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(maps))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasSuffix(line, deletedSuffix) {
+			continue
+		}
+		// Fields: address perms offset dev inode pathname
+		fields := strings.SplitN(line, " ", 6)
+		if len(fields) < 6 {
+			continue
+		}
+		file := strings.TrimSuffix(strings.TrimLeft(fields[5], " "), deletedSuffix)
+		// rpm unpacks to "path;<hex>" before renaming into place.
+		if semi := strings.IndexByte(file, ';'); semi > 0 {
+			file = file[:semi]
+		}
+		if !isPackagedPath(file) || slices.Contains(files, file) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func isPackagedPath(file string) bool {
+	for _, prefix := range packagedPrefixes {
+		if strings.HasPrefix(file, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package patching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServiceUnitFromCgroup(t *testing.T) {
+	tests := map[string]string{
+		"0::/system.slice/nginx.service\n":                                                  "nginx.service",
+		"0::/system.slice/containerd.service/kubepods\n":                                    "containerd.service",
+		"0::/user.slice/user-1000.slice/session-3.scope\n":                                  "",
+		"0::/system.slice/docker-4f1c.scope\n":                                              "",
+		"12:memory:/system.slice/sshd.service\n1:name=systemd:/system.slice/sshd.service\n": "sshd.service",
+		"0::/\n": "",
+	}
+	for cgroup, want := range tests {
+		if got := serviceUnitFromCgroup([]byte(cgroup)); got != want {
+			t.Errorf("serviceUnitFromCgroup(%q) = %q, want %q", cgroup, got, want)
+		}
+	}
+}
+
+func TestDeletedMappings(t *testing.T) {
+	maps := `55d0c0a00000-55d0c0a26000 r--p 00000000 fd:01 1835267                    /usr/sbin/nginx
+7f3a1c000000-7f3a1c028000 r--p 00000000 fd:01 1837012                    /usr/lib/x86_64-linux-gnu/libssl.so.3 (deleted)
+7f3a1c028000-7f3a1c0a0000 r-xp 00028000 fd:01 1837012                    /usr/lib/x86_64-linux-gnu/libssl.so.3 (deleted)
+7f3a1d000000-7f3a1d010000 r--p 00000000 fd:01 1837555                    /usr/lib64/libcrypto.so.3.0.7;65e8a1b2 (deleted)
+7f3a1e000000-7f3a1e100000 rw-s 00000000 00:01 2048                       /memfd:pulseaudio (deleted)
+7f3a1f000000-7f3a1f001000 rw-s 00000000 00:1a 77                         /dev/shm/sem.lock (deleted)
+7ffd5e3c0000-7ffd5e3e1000 rw-p 00000000 00:00 0                          [stack]
+`
+	want := []string{"/usr/lib/x86_64-linux-gnu/libssl.so.3", "/usr/lib64/libcrypto.so.3.0.7"}
+	if got := deletedMappings([]byte(maps)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("deletedMappings() = %v, want %v", got, want)
+	}
+}
+
+func TestUnsafeToRestart(t *testing.T) {
+	for unit, want := range map[string]bool{
+		"dbus.service":               true,
+		"getty@tty1.service":         true,
+		"serial-getty@ttyS0.service": true,
+		"nginx.service":              false,
+		"getty.target":               false,
+	} {
+		if got := unsafeToRestart(unit); got != want {
+			t.Errorf("unsafeToRestart(%q) = %v, want %v", unit, got, want)
+		}
+	}
+}
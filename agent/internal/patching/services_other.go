@@ -0,0 +1,13 @@
+//go:build !linux
+
+package patching
+
+// FindStaleServices is a no-op on non-Linux platforms.
+func FindStaleServices() []StaleService {
+	return nil
+}
+
+// RestartServices is a no-op on non-Linux platforms.
+func RestartServices(_ []string) []ServiceRestartResult {
+	return nil
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SnapProvider integrates with snapd.
+type SnapProvider struct{}
+
+// NewSnapProvider creates a new SnapProvider.
+func NewSnapProvider() *SnapProvider {
+	return &SnapProvider{}
+}
+
+// ID returns the provider identifier.
+func (s *SnapProvider) ID() string {
+	return "snap"
+}
+
+// Name returns the human-readable provider name.
+func (s *SnapProvider) Name() string {
+	return "Snap"
+}
+
+// Scan returns snaps with a pending refresh.
+func (s *SnapProvider) Scan() ([]AvailablePatch, error) {
+	output, err := cCommand("snap", "refresh", "--list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("snap refresh --list failed: %w", err)
+	}
+
+	patches := []AvailablePatch{}
+	for _, row := range parseSnapTable(output) {
+		if row["Name"] == "" {
+			continue
+		}
+		patches = append(patches, AvailablePatch{
+			ID:      row["Name"],
+			Title:   row["Name"],
+			Version: row["Version"],
+			Size:    parseSize(row["Size"]),
+		})
+	}
+	return patches, nil
+}
+
+// Install refreshes a snap.
+func (s *SnapProvider) Install(patchID string) (InstallResult, error) {
+	output, err := cCommand("snap", "refresh", patchID).CombinedOutput()
+	if err != nil {
+		return InstallResult{}, fmt.Errorf("snap refresh failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	message := strings.TrimSpace(string(output))
+	return InstallResult{
+		PatchID:        patchID,
+		RebootRequired: strings.Contains(strings.ToLower(message), "reboot"),
+		Message:        message,
+	}, nil
+}
+
+// Uninstall reverts a snap to the revision it had before its last
+// refresh, which snapd keeps, rather than removing it.
+func (s *SnapProvider) Uninstall(patchID string) error {
+	output, err := cCommand("snap", "revert", patchID).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("snap revert failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GetInstalled returns installed snaps.
+func (s *SnapProvider) GetInstalled() ([]InstalledPatch, error) {
+	output, err := cCommand("snap", "list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("snap list failed: %w", err)
+	}
+
+	installed := []InstalledPatch{}
+	for _, row := range parseSnapTable(output) {
+		if row["Name"] == "" {
+			continue
+		}
+		installed = append(installed, InstalledPatch{
+			ID:      row["Name"],
+			Title:   row["Name"],
+			Version: row["Version"],
+		})
+	}
+	return installed, nil
+}
+
+// parseSnapTable parses the whitespace-aligned tables printed by snap list
+// and snap refresh --list into rows keyed by column header. Output without
+// a header, such as "All snaps up to date.", yields no rows.
+func parseSnapTable(output []byte) []map[string]string {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	var headers []string
+	rows := []map[string]string{}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if headers == nil {
+			if fields[0] == "Name" {
+				headers = fields
+			}
+			continue
+		}
+		row := make(map[string]string, len(headers))
+		for i, header := range headers {
+			if i < len(fields) {
+				row[header] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package patching
+
+import "testing"
+
+func TestParseSnapTable(t *testing.T) {
+	output := []byte(`Name     Version        Rev    Size   Publisher     Notes
+firefox  124.0-2        3941   272MB  mozilla✓      -
+lxd      5.21.0-eb655b  27948  92MB   canonical✓    -
+`)
+	rows := parseSnapTable(output)
+	if len(rows) != 2 || rows[0]["Name"] != "firefox" || rows[0]["Version"] != "124.0-2" || parseSize(rows[0]["Size"]) != 272e6 {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+	if rows := parseSnapTable([]byte("All snaps up to date.\n")); len(rows) != 0 {
+		t.Fatalf("expected no rows, got %v", rows)
+	}
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package patching
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// btrfsSnapshotDir holds read-only root snapshots on btrfs systems
+	// without snapper.
+	btrfsSnapshotDir = "/.breeze-snapshots"
+
+	// lvmSnapshotExtents sizes LVM snapshots relative to the origin; the
+	// snapshot only has to absorb blocks the patch job rewrites.
+	lvmSnapshotExtents = "20%ORIGIN"
+)
+
+// CreateSnapshot snapshots the root filesystem before a patch job: with
+// snapper or a read-only subvolume on btrfs, or as an LVM snapshot of the
+// root logical volume. name identifies the snapshot where the tool allows.
+func CreateSnapshot(name, description string) (*FilesystemSnapshot, error) {
+	mounts, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("read mounts: %w", err)
+	}
+	source, fstype := parseRootMount(mounts)
+
+	switch {
+	case fstype == "btrfs":
+		if _, err := exec.LookPath("snapper"); err == nil {
+			output, err := exec.Command("snapper", "create", "--type", "single", "--cleanup-algorithm", "number",
+				"--print-number", "--description", description).CombinedOutput()
+			if err != nil {
+				return nil, fmt.Errorf("snapper create failed: %w: %s", err, strings.TrimSpace(string(output)))
+			}
+			return &FilesystemSnapshot{Type: "snapper", Name: strings.TrimSpace(string(output))}, nil
+		}
+
+		path := filepath.Join(btrfsSnapshotDir, name)
+		if err := os.MkdirAll(btrfsSnapshotDir, 0700); err != nil {
+			return nil, fmt.Errorf("create snapshot dir: %w", err)
+		}
+		output, err := exec.Command("btrfs", "subvolume", "snapshot", "-r", "/", path).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("btrfs subvolume snapshot failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+		return &FilesystemSnapshot{Type: "btrfs", Name: path}, nil
+
+	case strings.HasPrefix(source, "/dev/mapper/") || strings.HasPrefix(source, "/dev/dm-"):
+		output, err := exec.Command("lvs", "--noheadings", "-o", "vg_name", source).Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an LVM volume: %w", source, err)
+		}
+		vg := strings.TrimSpace(string(output))
+		output, err = exec.Command("lvcreate", "--snapshot", "--extents", lvmSnapshotExtents, "--name", name, source).CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("lvcreate --snapshot failed: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+		return &FilesystemSnapshot{Type: "lvm", Name: vg + "/" + name}, nil
+
+	default:
+		return nil, fmt.Errorf("root filesystem %s on %s does not support snapshots", fstype, source)
+	}
+}
+
+// RestoreSnapshot rolls the root filesystem back to a snapshot. The
+// rollback takes effect on the next boot.
+func RestoreSnapshot(snapshot FilesystemSnapshot) error {
+	var output []byte
+	var err error
+	switch snapshot.Type {
+	case "snapper":
+		output, err = exec.Command("snapper", "rollback", snapshot.Name).CombinedOutput()
+	case "lvm":
+		// The merge starts when the origin is next activated, at boot for
+		// the root volume.
+		output, err = exec.Command("lvconvert", "--merge", snapshot.Name).CombinedOutput()
+	case "btrfs":
+		return fmt.Errorf("btrfs snapshot %s must be restored manually by booting from it", snapshot.Name)
+	default:
+		return fmt.Errorf("unknown snapshot type %q", snapshot.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s snapshot restore failed: %w: %s", snapshot.Type, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// DeleteSnapshot removes a snapshot that is no longer needed for rollback.
+// snapper snapshots are left to snapper's number cleanup.
+func DeleteSnapshot(snapshot FilesystemSnapshot) error {
+	var output []byte
+	var err error
+	switch snapshot.Type {
+	case "snapper":
+		return nil
+	case "lvm":
+		output, err = exec.Command("lvremove", "--yes", snapshot.Name).CombinedOutput()
+	case "btrfs":
+		output, err = exec.Command("btrfs", "subvolume", "delete", snapshot.Name).CombinedOutput()
+	default:
+		return fmt.Errorf("unknown snapshot type %q", snapshot.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("%s snapshot delete failed: %w: %s", snapshot.Type, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// parseRootMount returns the source and type of the filesystem mounted at
+// / from /proc/self/mounts, using the last entry since later mounts hide
+// earlier ones.
+func parseRootMount(mounts []byte) (string, string) {
+	var source, fstype string
+	scanner := bufio.NewScanner(bytes.NewReader(mounts))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[1] == "/" {
+			source, fstype = fields[0], fields[2]
+		}
+	}
+	return source, fstype
+}
@@ -0,0 +1,32 @@
+//go:build linux
+
+package patching
+
+import "testing"
+
+func TestParseRootMount(t *testing.T) {
+	tests := []struct {
+		name, mounts   string
+		source, fstype string
+	}{
+		{
+			name:   "lvm ext4",
+			mounts: "sysfs /sys sysfs rw 0 0\n/dev/mapper/ubuntu--vg-ubuntu--lv / ext4 rw,relatime 0 0\n/dev/sda2 /boot ext4 rw 0 0\n",
+			source: "/dev/mapper/ubuntu--vg-ubuntu--lv", fstype: "ext4",
+		},
+		{
+			name:   "btrfs overmounted",
+			mounts: "rootfs / rootfs rw 0 0\n/dev/vda3 / btrfs rw,subvol=/@/.snapshots/1/snapshot 0 0\n/dev/vda3 /home btrfs rw,subvol=/@/home 0 0\n",
+			source: "/dev/vda3", fstype: "btrfs",
+		},
+		{name: "no root", mounts: "proc /proc proc rw 0 0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, fstype := parseRootMount([]byte(tt.mounts))
+			if source != tt.source || fstype != tt.fstype {
+				t.Fatalf("parseRootMount() = %q, %q, want %q, %q", source, fstype, tt.source, tt.fstype)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package patching
+
+import "fmt"
+
+// CreateSnapshot is not supported on non-Linux platforms.
+func CreateSnapshot(_, _ string) (*FilesystemSnapshot, error) {
+	return nil, fmt.Errorf("filesystem snapshots are not supported on this platform")
+}
+
+// RestoreSnapshot is not supported on non-Linux platforms.
+func RestoreSnapshot(_ FilesystemSnapshot) error {
+	return fmt.Errorf("filesystem snapshots are not supported on this platform")
+}
+
+// DeleteSnapshot is not supported on non-Linux platforms.
+func DeleteSnapshot(_ FilesystemSnapshot) error {
+	return fmt.Errorf("filesystem snapshots are not supported on this platform")
+}
@@ -48,3 +48,18 @@ type PatchProvider interface {
 	Uninstall(patchID string) error
 	GetInstalled() ([]InstalledPatch, error)
 }
+
+// StaleService is a running systemd service still using files, usually
+// shared libraries, that a patch install replaced.
+type StaleService struct {
+	Unit  string
+	PIDs  []int
+	Files []string
+}
+
+// ServiceRestartResult captures the outcome of restarting a service.
+type ServiceRestartResult struct {
+	Unit    string
+	Success bool
+	Message string
+}
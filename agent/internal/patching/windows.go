@@ -12,11 +12,8 @@ import (
 	"github.com/go-ole/go-ole/oleutil"
 
 	"github.com/breeze-rmm/agent/internal/config"
-	"github.com/breeze-rmm/agent/internal/logging"
 )
 
-var log = logging.L("patching")
-
 // WUA OperationResultCode constants
 const (
 	wuaResultNotStarted       = 0
@@ -7,7 +7,10 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // YumProvider integrates with dnf/yum package managers.
@@ -25,6 +28,8 @@ func (y *YumProvider) Name() string {
 	return "YUM/DNF"
 }
 
+// Scan returns available updates using check-update, described by the
+// updateinfo advisories that cover them.
 func (y *YumProvider) Scan() ([]AvailablePatch, error) {
 	mgr, err := detectYumManager()
 	if err != nil {
@@ -66,6 +71,9 @@ func (y *YumProvider) Scan() ([]AvailablePatch, error) {
 		})
 	}
 
+	applyYumAdvisories(mgr, patches)
+	applyYumPackageInfo(mgr, patches)
+
 	return patches, nil
 }
 
@@ -105,6 +113,100 @@ func (y *YumProvider) Uninstall(patchID string) error {
 }
 
 func (y *YumProvider) GetInstalled() ([]InstalledPatch, error) {
+	return rpmInstalled()
+}
+
+// LastTransaction returns the newest dnf/yum history ID, or 0 if the
+// history is empty. Implements TransactionalProvider.
+func (y *YumProvider) LastTransaction() (int, error) {
+	mgr, err := detectYumManager()
+	if err != nil {
+		return 0, err
+	}
+
+	output, err := exec.Command(mgr, "-q", "history", "list").Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s history list failed: %w", mgr, err)
+	}
+
+	return parseYumHistoryLastID(output), nil
+}
+
+// UndoTransaction reverts a dnf/yum history transaction. Implements
+// TransactionalProvider.
+func (y *YumProvider) UndoTransaction(id int) error {
+	mgr, err := detectYumManager()
+	if err != nil {
+		return err
+	}
+
+	output, runErr := exec.Command(mgr, "-y", "history", "undo", strconv.Itoa(id)).CombinedOutput()
+	if runErr != nil {
+		return fmt.Errorf("%s history undo %d failed: %w: %s", mgr, id, runErr, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// TransactionPackages returns the names of the packages a dnf/yum history
+// transaction changed. Implements TransactionalProvider.
+func (y *YumProvider) TransactionPackages(id int) ([]string, error) {
+	mgr, err := detectYumManager()
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := exec.Command(mgr, "-q", "history", "info", strconv.Itoa(id)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s history info %d failed: %w", mgr, id, err)
+	}
+
+	return parseYumHistoryPackages(output), nil
+}
+
+// RestoreVersions downgrades packages to their recorded earlier versions,
+// reinstalls removed ones and removes added ones. Implements
+// VersionRestorer.
+func (y *YumProvider) RestoreVersions(changes []PackageChange) error {
+	mgr, err := detectYumManager()
+	if err != nil {
+		return err
+	}
+
+	var downgrade, install, remove []string
+	for _, change := range changes {
+		switch {
+		case change.From == "":
+			remove = append(remove, change.Name+"-"+change.To)
+		case change.To == "":
+			install = append(install, change.Name+"-"+change.From)
+		default:
+			downgrade = append(downgrade, change.Name+"-"+change.From)
+		}
+	}
+
+	for _, step := range []struct {
+		action   string
+		packages []string
+	}{
+		{"downgrade", downgrade},
+		{"install", install},
+		{"remove", remove},
+	} {
+		if len(step.packages) == 0 {
+			continue
+		}
+		args := append([]string{"-y", step.action}, step.packages...)
+		if output, runErr := exec.Command(mgr, args...).CombinedOutput(); runErr != nil {
+			return fmt.Errorf("%s %s failed: %w: %s", mgr, step.action, runErr, strings.TrimSpace(string(output)))
+		}
+	}
+
+	return nil
+}
+
+// rpmInstalled returns installed packages from the RPM database.
+func rpmInstalled() ([]InstalledPatch, error) {
 	output, err := exec.Command("rpm", "-qa", "--queryformat", "%{NAME}\t%{VERSION}-%{RELEASE}\n").Output()
 	if err != nil {
 		return nil, fmt.Errorf("rpm query failed: %w", err)
@@ -140,3 +242,378 @@ func detectYumManager() (string, error) {
 	}
 	return "", fmt.Errorf("neither dnf nor yum found")
 }
+
+// yumAdvisory is an updateinfo advisory such as RHSA-2024:0897.
+type yumAdvisory struct {
+	ID              string
+	Type            string // security, bugfix, enhancement, newpackage
+	Severity        string // AvailablePatch severity
+	Title           string
+	Issued          string // ISO 8601 date
+	CVEs            []string
+	RebootSuggested bool
+}
+
+// applyYumAdvisories fills in security metadata from updateinfo. Repos
+// without updateinfo, such as most third-party ones, leave patches as they
+// are.
+func applyYumAdvisories(mgr string, patches []AvailablePatch) {
+	if len(patches) == 0 {
+		return
+	}
+	output, err := exec.Command(mgr, "-q", "updateinfo", "list", yumUpdatesFilter(mgr)).Output()
+	if err != nil {
+		log.Warn("updateinfo list failed", "manager", mgr, "error", err.Error())
+		return
+	}
+	byPackage, advisories := parseYumUpdateinfoList(output)
+	if len(byPackage) == 0 {
+		return
+	}
+
+	if output, err := exec.Command(mgr, "-q", "updateinfo", "info", yumUpdatesFilter(mgr)).Output(); err != nil {
+		log.Warn("updateinfo info failed", "manager", mgr, "error", err.Error())
+	} else {
+		for id, details := range parseYumUpdateinfoInfo(output) {
+			if listed, ok := advisories[id]; ok {
+				details.Type = firstNonEmpty(details.Type, listed.Type)
+				details.Severity = firstNonEmpty(details.Severity, listed.Severity)
+				advisories[id] = details
+			}
+		}
+	}
+
+	for i := range patches {
+		var matched []*yumAdvisory
+		for _, id := range byPackage[patches[i].ID] {
+			matched = append(matched, advisories[id])
+		}
+		applyAdvisoriesToPatch(&patches[i], matched)
+	}
+}
+
+// yumUpdatesFilter limits updateinfo to advisories for available updates.
+func yumUpdatesFilter(mgr string) string {
+	if mgr == "yum" {
+		return "updates"
+	}
+	return "--updates"
+}
+
+// applyAdvisoriesToPatch describes patch by the most severe advisory
+// covering it, with the CVEs of all of them. The advisory ID goes in the
+// description rather than KBNumber: the server keys patches by external
+// ID, and one advisory usually covers several packages.
+func applyAdvisoriesToPatch(patch *AvailablePatch, advisories []*yumAdvisory) {
+	var primary *yumAdvisory
+	var cves []string
+	for _, advisory := range advisories {
+		cves = mergeCVEs(cves, advisory.CVEs)
+		patch.RebootRequired = patch.RebootRequired || advisory.RebootSuggested
+		switch {
+		case primary == nil,
+			advisory.Type == "security" && primary.Type != "security",
+			advisory.Type == primary.Type && moreSevere(advisory.Severity, primary.Severity):
+			primary = advisory
+		}
+	}
+	if primary == nil {
+		return
+	}
+
+	patch.Severity = primary.Severity
+	patch.ReleaseDate = primary.Issued
+	switch primary.Type {
+	case "security":
+		patch.Category = "security"
+	case "enhancement", "newpackage":
+		patch.Category = "feature"
+	}
+	summary := primary.ID
+	if primary.Title != "" {
+		summary = fmt.Sprintf("%s (%s)", primary.Title, primary.ID)
+	}
+	patch.Description = describeAdvisory(summary, cves)
+}
+
+// rpmSeverities maps updateinfo severities to patch severity.
+var rpmSeverities = map[string]string{
+	"critical":  "critical",
+	"important": "important",
+	"moderate":  "moderate",
+	"low":       "low",
+}
+
+// parseYumUpdateinfoList parses updateinfo list output into the advisory
+// IDs for each package name, and the advisories with the type and severity
+// the list shows. It reads both the dnf4/yum form
+//
+//	RHSA-2024:0897 Important/Sec. kernel-5.14.0-362.18.1.el9_3.x86_64
+//
+// and the dnf5 form
+//
+//	FEDORA-2024-1a2b3c security Moderate curl-8.6.0-7.fc40.x86_64 2024-03-01 01:02:03
+func parseYumUpdateinfoList(output []byte) (map[string][]string, map[string]*yumAdvisory) {
+	byPackage := map[string][]string{}
+	advisories := map[string]*yumAdvisory{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] == "Name" {
+			continue
+		}
+
+		advisory := &yumAdvisory{ID: fields[0]}
+		var nevra string
+		if kind, severity, ok := strings.Cut(fields[1], "/"); ok {
+			// "Important/Sec." or "Unknown/Sec."
+			advisory.Severity = rpmSeverities[strings.ToLower(kind)]
+			if strings.HasPrefix(severity, "Sec") {
+				advisory.Type = "security"
+			}
+			nevra = fields[2]
+		} else if len(fields) >= 4 && strings.Contains(fields[3], "-") {
+			advisory.Type = strings.ToLower(fields[1])
+			advisory.Severity = rpmSeverities[strings.ToLower(fields[2])]
+			nevra = fields[3]
+		} else {
+			// "bugfix" or "enhancement" in the dnf4 form.
+			advisory.Type = strings.ToLower(fields[1])
+			nevra = fields[2]
+		}
+
+		name := rpmPackageName(nevra)
+		if name == "" {
+			continue
+		}
+		if _, ok := advisories[advisory.ID]; !ok {
+			advisories[advisory.ID] = advisory
+		}
+		if !containsString(byPackage[name], advisory.ID) {
+			byPackage[name] = append(byPackage[name], advisory.ID)
+		}
+	}
+	return byPackage, advisories
+}
+
+// parseYumUpdateinfoInfo parses updateinfo info output, keyed by advisory
+// ID. dnf4 and yum print the title in a banner between rules, followed by
+// "Update ID: ..." fields; dnf5 prints "Name : ..." fields with references
+// drawn as a tree beneath them.
+func parseYumUpdateinfoInfo(output []byte) map[string]*yumAdvisory {
+	advisories := map[string]*yumAdvisory{}
+	var current *yumAdvisory
+	var block strings.Builder
+	var banner string
+	inBanner := false
+	flush := func() {
+		if current != nil {
+			current.CVEs = findCVEs(block.String())
+			advisories[current.ID] = current
+		}
+		current = nil
+		block.Reset()
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "=====") {
+			flush()
+			inBanner = !inBanner
+			continue
+		}
+		if inBanner {
+			banner = strings.TrimSpace(line)
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, ":")
+		nested := strings.ContainsAny(key, "│├└")
+		key = strings.ToLower(strings.TrimSpace(strings.TrimLeft(key, " \t│├└─")))
+		value = strings.TrimSpace(value)
+		if key == "update id" || key == "name" && !nested {
+			flush()
+			current = &yumAdvisory{ID: value, Title: bannerTitle(banner)}
+			banner = ""
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		block.WriteString(line)
+		block.WriteByte('\n')
+		if nested {
+			continue
+		}
+		switch key {
+		case "type":
+			current.Type = strings.ToLower(value)
+		case "title":
+			current.Title = value
+		case "severity":
+			current.Severity = rpmSeverities[strings.ToLower(value)]
+		case "issued":
+			current.Issued = firstNonEmpty(isoDate(value, yumDateLayouts...), current.Issued)
+		case "updated":
+			current.Issued = firstNonEmpty(current.Issued, isoDate(value, yumDateLayouts...))
+		case "reboot suggested", "reboot", "needs reboot":
+			switch strings.ToLower(value) {
+			case "true", "yes", "1", "system":
+				current.RebootSuggested = true
+			}
+		}
+	}
+	flush()
+	return advisories
+}
+
+var yumDateLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// bannerTitle strips the severity prefix from a dnf4 banner such as
+// "Important: kernel security update".
+func bannerTitle(banner string) string {
+	if prefix, title, ok := strings.Cut(banner, ": "); ok && !strings.Contains(prefix, " ") {
+		return title
+	}
+	return banner
+}
+
+// applyYumPackageInfo fills in download sizes and, for packages without
+// an advisory date, build dates. Only dnf has a built-in repoquery.
+func applyYumPackageInfo(mgr string, patches []AvailablePatch) {
+	if mgr != "dnf" || len(patches) == 0 {
+		return
+	}
+	output, err := exec.Command("dnf", "-q", "repoquery", "--upgrades", "--latest-limit", "1",
+		"--queryformat", "%{name}\t%{downloadsize}\t%{buildtime}\n").Output()
+	if err != nil {
+		log.Warn("dnf repoquery failed", "error", err.Error())
+		return
+	}
+	info := parseYumRepoquery(output)
+	for i := range patches {
+		pkg, ok := info[patches[i].ID]
+		if !ok {
+			continue
+		}
+		patches[i].Size = pkg.Size
+		if patches[i].ReleaseDate == "" {
+			patches[i].ReleaseDate = pkg.BuildDate
+		}
+	}
+}
+
+type yumPackage struct {
+	Size      int64
+	BuildDate string
+}
+
+// parseYumRepoquery parses name, download size and build time lines.
+// Build time is a Unix timestamp in dnf5 and a formatted date in dnf4.
+func parseYumRepoquery(output []byte) map[string]yumPackage {
+	packages := map[string]yumPackage{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		parts := strings.Split(strings.TrimSpace(scanner.Text()), "\t")
+		if len(parts) != 3 || parts[0] == "" {
+			continue
+		}
+		var pkg yumPackage
+		pkg.Size, _ = strconv.ParseInt(parts[1], 10, 64)
+		if secs, err := strconv.ParseInt(parts[2], 10, 64); err == nil {
+			pkg.BuildDate = time.Unix(secs, 0).UTC().Format("2006-01-02")
+		} else {
+			pkg.BuildDate = isoDate(parts[2], yumDateLayouts...)
+		}
+		packages[parts[0]] = pkg
+	}
+	return packages
+}
+
+// rpmPackageName returns the name from an RPM NEVRA such as
+// "openssl-1:3.0.7-25.el9_3.x86_64".
+func rpmPackageName(nevra string) string {
+	if dot := strings.LastIndex(nevra, "."); dot > strings.LastIndex(nevra, "-") {
+		nevra = nevra[:dot]
+	}
+	release := strings.LastIndex(nevra, "-")
+	if release <= 0 {
+		return ""
+	}
+	version := strings.LastIndex(nevra[:release], "-")
+	if version <= 0 {
+		return ""
+	}
+	return nevra[:version]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseYumHistoryLastID returns the highest transaction ID in history list
+// output, whose rows start with the ID followed by "|" (dnf4 and yum) or
+// whitespace (dnf5).
+func parseYumHistoryLastID(output []byte) int {
+	last := 0
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		field, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), "|")
+		fields := strings.Fields(field)
+		if len(fields) == 0 {
+			continue
+		}
+		if id, err := strconv.Atoi(fields[0]); err == nil && id > last {
+			last = id
+		}
+	}
+	return last
+}
+
+// parseYumHistoryPackages returns the package names listed under "Packages
+// Altered" in history info output. dnf4 and yum list an action and a NEVRA
+// per row; dnf5 adds a header row and reason and repository columns.
+func parseYumHistoryPackages(output []byte) []string {
+	var names []string
+	inPackages := false
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "packages altered") {
+			inPackages = true
+			continue
+		}
+		if !inPackages || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			// The next section, such as scriptlet output.
+			break
+		}
+		for _, field := range strings.Fields(line) {
+			if name := rpmPackageName(field); name != "" {
+				if !slices.Contains(names, name) {
+					names = append(names, name)
+				}
+				break
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,211 @@
+//go:build linux
+
+package patching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRPMPackageName(t *testing.T) {
+	tests := map[string]string{
+		"openssl-1:3.0.7-25.el9_3.x86_64":      "openssl",
+		"kernel-5.14.0-362.18.1.el9_3.x86_64":  "kernel",
+		"python3-libs-3.9.18-1.el9_3.1.x86_64": "python3-libs",
+		"tzdata-2024a-1.el9.noarch":            "tzdata",
+		"bogus":                                "",
+	}
+	for nevra, want := range tests {
+		if got := rpmPackageName(nevra); got != want {
+			t.Errorf("rpmPackageName(%q) = %q, want %q", nevra, got, want)
+		}
+	}
+}
+
+func TestParseYumUpdateinfoList(t *testing.T) {
+	dnf4 := []byte(`RHSA-2024:0897 Important/Sec. kernel-5.14.0-362.18.1.el9_3.x86_64
+RHSA-2024:0897 Important/Sec. kernel-core-5.14.0-362.18.1.el9_3.x86_64
+RHSA-2024:1234 Moderate/Sec.  openssl-1:3.0.7-25.el9_3.x86_64
+RHBA-2024:0001 bugfix         tzdata-2024a-1.el9.noarch
+`)
+	byPackage, advisories := parseYumUpdateinfoList(dnf4)
+	if !reflect.DeepEqual(byPackage["kernel"], []string{"RHSA-2024:0897"}) || len(byPackage) != 4 {
+		t.Fatalf("unexpected packages: %v", byPackage)
+	}
+	if a := advisories["RHSA-2024:1234"]; a.Type != "security" || a.Severity != "moderate" {
+		t.Fatalf("unexpected advisory: %+v", a)
+	}
+	if a := advisories["RHBA-2024:0001"]; a.Type != "bugfix" || a.Severity != "" {
+		t.Fatalf("unexpected advisory: %+v", a)
+	}
+
+	dnf5 := []byte(`Name               Type        Severity                  Package              Issued
+FEDORA-2024-1a2b3c security    Moderate    curl-8.6.0-7.fc40.x86_64 2024-03-01 01:02:03
+`)
+	byPackage, advisories = parseYumUpdateinfoList(dnf5)
+	if !reflect.DeepEqual(byPackage["curl"], []string{"FEDORA-2024-1a2b3c"}) {
+		t.Fatalf("unexpected packages: %v", byPackage)
+	}
+	if a := advisories["FEDORA-2024-1a2b3c"]; a.Type != "security" || a.Severity != "moderate" {
+		t.Fatalf("unexpected advisory: %+v", a)
+	}
+}
+
+func TestParseYumUpdateinfoInfoDnf4(t *testing.T) {
+	output := []byte(`===============================================================================
+  Important: kernel security update
+===============================================================================
+  Update ID: RHSA-2024:0897
+       Type: security
+    Updated: 2024-02-21 08:15:03
+       Bugs: 2253908 - CVE-2023-6546 kernel: GSM multiplexing race condition
+       CVEs: CVE-2023-6546
+           : CVE-2023-6931
+Description: The kernel packages contain the Linux kernel.
+           : 
+           : Security Fix(es):
+   Severity: Important
+   Reboot Suggested: True
+
+===============================================================================
+  tzdata bug fix and enhancement update
+===============================================================================
+  Update ID: RHBA-2024:0001
+       Type: bugfix
+     Issued: 2024-01-10 00:00:00
+Description: The tzdata packages contain data files.
+`)
+	advisories := parseYumUpdateinfoInfo(output)
+	kernel := advisories["RHSA-2024:0897"]
+	want := &yumAdvisory{
+		ID:              "RHSA-2024:0897",
+		Type:            "security",
+		Severity:        "important",
+		Title:           "kernel security update",
+		Issued:          "2024-02-21",
+		CVEs:            []string{"CVE-2023-6546", "CVE-2023-6931"},
+		RebootSuggested: true,
+	}
+	if !reflect.DeepEqual(kernel, want) {
+		t.Fatalf("got %+v, want %+v", kernel, want)
+	}
+	tz := advisories["RHBA-2024:0001"]
+	if tz == nil || tz.Type != "bugfix" || tz.Title != "tzdata bug fix and enhancement update" || tz.Issued != "2024-01-10" || len(tz.CVEs) != 0 {
+		t.Fatalf("unexpected tzdata advisory: %+v", tz)
+	}
+}
+
+func TestParseYumUpdateinfoInfoDnf5(t *testing.T) {
+	output := []byte(`Name               : FEDORA-2024-1a2b3c
+Title              : curl-8.6.0-7.fc40
+Id                 : FEDORA-2024-1a2b3c
+Type               : security
+Severity           : Moderate
+Status             : stable
+Issued             : 2024-03-01 01:02:03
+Description        : Fix for CVE-2024-2004.
+Reboot suggested   : false
+References         :
+  ├─ Title         : CVE-2024-2398 curl: HTTP/2 push headers memory-leak
+  │  Id            : 2270699
+  │  Type          : bugzilla
+`)
+	advisory := parseYumUpdateinfoInfo(output)["FEDORA-2024-1a2b3c"]
+	want := &yumAdvisory{
+		ID:       "FEDORA-2024-1a2b3c",
+		Type:     "security",
+		Severity: "moderate",
+		Title:    "curl-8.6.0-7.fc40",
+		Issued:   "2024-03-01",
+		CVEs:     []string{"CVE-2024-2004", "CVE-2024-2398"},
+	}
+	if !reflect.DeepEqual(advisory, want) {
+		t.Fatalf("got %+v, want %+v", advisory, want)
+	}
+}
+
+func TestApplyAdvisoriesToPatch(t *testing.T) {
+	patch := AvailablePatch{ID: "openssl", Title: "openssl", Version: "1:3.0.7-25.el9_3"}
+	applyAdvisoriesToPatch(&patch, []*yumAdvisory{
+		{ID: "RHBA-2024:0002", Type: "bugfix", Title: "openssl bug fix update"},
+		{ID: "RHSA-2024:1234", Type: "security", Severity: "moderate", Title: "openssl security update", Issued: "2024-03-01", CVEs: []string{"CVE-2023-6129"}},
+		{ID: "RHSA-2024:1300", Type: "security", Severity: "critical", Title: "openssl critical update", Issued: "2024-03-05", CVEs: []string{"CVE-2024-0727"}, RebootSuggested: true},
+	})
+	if patch.KBNumber != "" || patch.Severity != "critical" || patch.Category != "security" || patch.ReleaseDate != "2024-03-05" || !patch.RebootRequired {
+		t.Fatalf("unexpected patch: %+v", patch)
+	}
+	if patch.Description != "openssl critical update (RHSA-2024:1300)\n\nFixes CVE-2023-6129, CVE-2024-0727" {
+		t.Fatalf("unexpected description: %q", patch.Description)
+	}
+}
+
+func TestParseYumRepoquery(t *testing.T) {
+	output := []byte("openssl\t1534567\t1709251200\n\ntzdata\t480000\t2024-01-10 00:00\n")
+	packages := parseYumRepoquery(output)
+	if p := packages["openssl"]; p.Size != 1534567 || p.BuildDate != "2024-03-01" {
+		t.Fatalf("unexpected openssl: %+v", p)
+	}
+	if p := packages["tzdata"]; p.Size != 480000 || p.BuildDate != "2024-01-10" {
+		t.Fatalf("unexpected tzdata: %+v", p)
+	}
+}
+
+func TestParseYumHistoryLastID(t *testing.T) {
+	dnf4 := `ID     | Command line              | Date and time    | Action(s)      | Altered
+-------------------------------------------------------------------------------
+    14 | -y upgrade openssl        | 2026-03-02 10:14 | Upgrade        |    2
+    13 | install nginx             | 2026-02-27 09:01 | Install        |    1
+`
+	dnf5 := `ID Command line        Date and time       Action(s) Altered
+ 9 dnf5 -y upgrade curl 2026-03-02 10:14:03                 2
+ 8 dnf5 install nginx   2026-02-27 09:01:44                 1
+`
+	tests := []struct {
+		name, output string
+		want         int
+	}{
+		{"dnf4", dnf4, 14},
+		{"dnf5", dnf5, 9},
+		{"empty history", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseYumHistoryLastID([]byte(tt.output)); got != tt.want {
+				t.Fatalf("parseYumHistoryLastID() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYumHistoryPackages(t *testing.T) {
+	dnf4 := `Transaction ID : 14
+Command Line   : -y upgrade openssl
+Packages Altered:
+    Upgrade  openssl-1:3.0.7-27.el9.x86_64      @baseos
+    Upgraded openssl-1:3.0.7-25.el9.x86_64      @@System
+    Dep-Install openssl-libs-1:3.0.7-27.el9.x86_64 @baseos
+Scriptlet output:
+   1 warning: /etc/pki/tls/openssl.cnf created as /etc/pki/tls/openssl.cnf.rpmnew
+`
+	dnf5 := `Transaction ID : 9
+Packages altered:
+  Action   Package                    Reason     Repository
+  Upgrade  curl-8.6.0-2.fc40.x86_64   User       updates
+  Replaced curl-8.6.0-1.fc40.x86_64   User       @System
+`
+	tests := []struct {
+		name, output string
+		want         []string
+	}{
+		{"dnf4", dnf4, []string{"openssl", "openssl-libs"}},
+		{"dnf5", dnf5, []string{"curl"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseYumHistoryPackages([]byte(tt.output)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseYumHistoryPackages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
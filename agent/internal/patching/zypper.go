@@ -0,0 +1,256 @@
+//go:build linux
+
+package patching
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// zypperPatchPrefix marks patch IDs that name a SUSE patch rather than a
+// package.
+const zypperPatchPrefix = "patch:"
+
+// zypper exit codes at or above this value are informational, such as
+// updates or a reboot being needed.
+const (
+	zypperExitInfoMin      = 100
+	zypperExitRebootNeeded = 102
+)
+
+// ZypperProvider integrates with zypper on SUSE and openSUSE systems. It
+// reports both SUSE patches, which carry categories and severities, and
+// plain package updates.
+type ZypperProvider struct{}
+
+// NewZypperProvider creates a new ZypperProvider.
+func NewZypperProvider() *ZypperProvider {
+	return &ZypperProvider{}
+}
+
+// ID returns the provider identifier.
+func (z *ZypperProvider) ID() string {
+	return "zypper"
+}
+
+// Name returns the human-readable provider name.
+func (z *ZypperProvider) Name() string {
+	return "Zypper"
+}
+
+// Scan returns needed patches and package updates.
+func (z *ZypperProvider) Scan() ([]AvailablePatch, error) {
+	output, _, err := runZypper("--xmlout", "list-patches")
+	if err != nil {
+		return nil, fmt.Errorf("zypper list-patches failed: %w", err)
+	}
+	patches, err := parseZypperUpdates(output)
+	if err != nil {
+		return nil, err
+	}
+
+	output, _, err = runZypper("--xmlout", "list-updates")
+	if err != nil {
+		return nil, fmt.Errorf("zypper list-updates failed: %w", err)
+	}
+	packages, err := parseZypperUpdates(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(patches, packages...), nil
+}
+
+// Install applies a patch or updates a package.
+func (z *ZypperProvider) Install(patchID string) (InstallResult, error) {
+	output, reboot, err := runZypper(zypperInstallArgs(patchID, false)...)
+	if err != nil {
+		return InstallResult{}, fmt.Errorf("zypper install failed: %w", err)
+	}
+
+	return InstallResult{
+		PatchID:        patchID,
+		RebootRequired: reboot,
+		Message:        strings.TrimSpace(string(output)),
+	}, nil
+}
+
+// Download fetches the packages for patches without installing them.
+// Implements DownloadableProvider.
+func (z *ZypperProvider) Download(patchIDs []string, progress ProgressCallback) ([]DownloadResult, error) {
+	return downloadEach(patchIDs, progress, func(patchID string) error {
+		_, _, err := runZypper(zypperInstallArgs(patchID, true)...)
+		return err
+	}), nil
+}
+
+// InstallWithProgress installs a patch and reports progress.
+// Implements DownloadableProvider.
+func (z *ZypperProvider) InstallWithProgress(patchID string, progress ProgressCallback) (InstallResult, error) {
+	return installWithProgress(patchID, progress, z.Install)
+}
+
+// Uninstall removes a package. SUSE patches cannot be removed once
+// applied.
+func (z *ZypperProvider) Uninstall(patchID string) error {
+	if strings.HasPrefix(patchID, zypperPatchPrefix) {
+		return fmt.Errorf("zypper patches cannot be uninstalled: %s", patchID)
+	}
+	if _, _, err := runZypper("remove", patchID); err != nil {
+		return fmt.Errorf("zypper remove failed: %w", err)
+	}
+	return nil
+}
+
+// GetInstalled returns installed packages from the RPM database.
+func (z *ZypperProvider) GetInstalled() ([]InstalledPatch, error) {
+	return rpmInstalled()
+}
+
+// RestoreVersions reinstalls the recorded earlier versions of packages
+// and removes packages a patch job added. Implements VersionRestorer.
+func (z *ZypperProvider) RestoreVersions(changes []PackageChange) error {
+	var install, remove []string
+	for _, change := range changes {
+		if change.From == "" {
+			remove = append(remove, change.Name+"="+change.To)
+		} else {
+			install = append(install, change.Name+"="+change.From)
+		}
+	}
+
+	if len(install) > 0 {
+		args := append([]string{"install", "--oldpackage", "--auto-agree-with-licenses"}, install...)
+		if _, _, err := runZypper(args...); err != nil {
+			return fmt.Errorf("zypper install --oldpackage failed: %w", err)
+		}
+	}
+	if len(remove) > 0 {
+		if _, _, err := runZypper(append([]string{"remove"}, remove...)...); err != nil {
+			return fmt.Errorf("zypper remove failed: %w", err)
+		}
+	}
+	return nil
+}
+
+func zypperInstallArgs(patchID string, downloadOnly bool) []string {
+	var args []string
+	if name, ok := strings.CutPrefix(patchID, zypperPatchPrefix); ok {
+		args = []string{"install", "--auto-agree-with-licenses", "-t", "patch", name}
+	} else {
+		args = []string{"update", "--auto-agree-with-licenses", patchID}
+	}
+	if downloadOnly {
+		args = append(args, "--download-only")
+	}
+	return args
+}
+
+// runZypper runs zypper non-interactively, treating its informational
+// exit codes as success and reporting whether a reboot is needed.
+func runZypper(args ...string) ([]byte, bool, error) {
+	cmd := cCommand("zypper", append([]string{"--non-interactive"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= zypperExitInfoMin {
+		return output, exitErr.ExitCode() == zypperExitRebootNeeded, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return output, false, nil
+}
+
+// zypperStream is the --xmlout document for list-patches and list-updates.
+type zypperStream struct {
+	Messages []zypperMessage `xml:"message"`
+	Updates  []zypperUpdate  `xml:"update-status>update-list>update"`
+}
+
+type zypperMessage struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type zypperUpdate struct {
+	Kind        string `xml:"kind,attr"`
+	Name        string `xml:"name,attr"`
+	Edition     string `xml:"edition,attr"`
+	Category    string `xml:"category,attr"`
+	Severity    string `xml:"severity,attr"`
+	Restart     bool   `xml:"restart,attr"`
+	Summary     string `xml:"summary"`
+	Description string `xml:"description"`
+	IssueDate   struct {
+		Time int64 `xml:"time,attr"`
+	} `xml:"issue-date"`
+	Issues []struct {
+		Type string `xml:"type,attr"`
+		ID   string `xml:"id,attr"`
+	} `xml:"issue-list>issue"`
+}
+
+// zypperCategories maps SUSE patch categories to patch categories.
+var zypperCategories = map[string]string{
+	"security":    "security",
+	"recommended": "system",
+	"yast":        "system",
+	"optional":    "feature",
+	"feature":     "feature",
+}
+
+// parseZypperUpdates parses zypper --xmlout list-patches or list-updates
+// output. Patches get IDs prefixed with "patch:"; packages use their name.
+func parseZypperUpdates(output []byte) ([]AvailablePatch, error) {
+	var stream zypperStream
+	if err := xml.Unmarshal(output, &stream); err != nil {
+		return nil, fmt.Errorf("zypper xml failed: %w", err)
+	}
+	for _, msg := range stream.Messages {
+		if msg.Type == "error" {
+			return nil, fmt.Errorf("zypper: %s", strings.TrimSpace(msg.Text))
+		}
+	}
+
+	patches := []AvailablePatch{}
+	for _, update := range stream.Updates {
+		if update.Name == "" {
+			continue
+		}
+		patch := AvailablePatch{
+			ID:             update.Name,
+			Title:          update.Name,
+			Version:        update.Edition,
+			RebootRequired: update.Restart,
+			Description:    strings.TrimSpace(update.Summary),
+		}
+
+		if update.Kind == "patch" {
+			patch.ID = zypperPatchPrefix + update.Name
+			patch.Category = zypperCategories[update.Category]
+			if severity := strings.ToLower(update.Severity); severityRank[severity] > 0 {
+				patch.Severity = severity
+			}
+			if update.IssueDate.Time > 0 {
+				patch.ReleaseDate = time.Unix(update.IssueDate.Time, 0).UTC().Format("2006-01-02")
+			}
+
+			cves := findCVEs(update.Description)
+			for _, issue := range update.Issues {
+				if issue.Type == "cve" {
+					id := strings.ToUpper(issue.ID)
+					if !strings.HasPrefix(id, "CVE-") {
+						id = "CVE-" + id
+					}
+					cves = mergeCVEs(cves, []string{id})
+				}
+			}
+			patch.Description = describeAdvisory(patch.Description, cves)
+		}
+
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package patching
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseZypperListPatches(t *testing.T) {
+	output := []byte(`<?xml version='1.0'?>
+<stream>
+<message type="info">Loading repository data...</message>
+<update-status version="0.6">
+<update-list>
+<update name="SUSE-SLE-Module-Basesystem-15-SP5-2024-872" edition="1" arch="noarch" kind="patch" status="needed" category="security" severity="important" pkgmanager="false" restart="false" interactive="false">
+<summary>Security update for openssl-3</summary>
+<description>This update for openssl-3 fixes the following issues:
+- CVE-2024-0727: Fixed denial of service via null dereference.</description>
+<license></license>
+<source url="https://updates.suse.com/SUSE/Updates/SLE-Module-Basesystem/15-SP5/x86_64/update" alias="Basesystem_Module_15_SP5_x86_64:SLE-Module-Basesystem15-SP5-Updates"/>
+<issue-date time="1709251200"/>
+<issue-list>
+<issue type="bugzilla" id="1219243" title="VUL-0: CVE-2024-0727"/>
+<issue type="cve" id="2024-2511" title="CVE-2024-2511"/>
+</issue-list>
+</update>
+<update name="SUSE-SLE-Module-Basesystem-15-SP5-2024-900" edition="1" arch="noarch" kind="patch" status="needed" category="recommended" severity="moderate" pkgmanager="false" restart="true" interactive="false">
+<summary>Recommended update for systemd</summary>
+<description>Fixes a shutdown hang.</description>
+</update>
+</update-list>
+</update-status>
+</stream>`)
+	patches, err := parseZypperUpdates(output)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("expected 2 patches, got %d", len(patches))
+	}
+	want := AvailablePatch{
+		ID:          "patch:SUSE-SLE-Module-Basesystem-15-SP5-2024-872",
+		Title:       "SUSE-SLE-Module-Basesystem-15-SP5-2024-872",
+		Version:     "1",
+		Severity:    "important",
+		Category:    "security",
+		ReleaseDate: "2024-03-01",
+		Description: "Security update for openssl-3\n\nFixes CVE-2024-0727, CVE-2024-2511",
+	}
+	if !reflect.DeepEqual(patches[0], want) {
+		t.Fatalf("got %+v\nwant %+v", patches[0], want)
+	}
+	if p := patches[1]; p.Category != "system" || p.Severity != "moderate" || !p.RebootRequired {
+		t.Fatalf("unexpected recommended patch: %+v", p)
+	}
+}
+
+func TestParseZypperListUpdates(t *testing.T) {
+	output := []byte(`<?xml version='1.0'?>
+<stream>
+<update-status version="0.6">
+<update-list>
+<update name="vim" edition="9.1.0111-150500.20.9.1" arch="x86_64" kind="package" edition-old="9.0.2103-150500.20.6.1">
+<summary>Vi IMproved</summary>
+<description>Vim is an almost compatible version of the UNIX editor vi.</description>
+<license></license>
+<source url="https://download.opensuse.org/update/leap/15.5/sle" alias="repo-sle-update"/>
+</update>
+</update-list>
+</update-status>
+</stream>`)
+	patches, err := parseZypperUpdates(output)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := []AvailablePatch{{ID: "vim", Title: "vim", Version: "9.1.0111-150500.20.9.1", Description: "Vi IMproved"}}
+	if !reflect.DeepEqual(patches, want) {
+		t.Fatalf("got %+v, want %+v", patches, want)
+	}
+}
+
+func TestParseZypperError(t *testing.T) {
+	output := []byte(`<?xml version='1.0'?>
+<stream>
+<message type="error">System management is locked by the application with pid 1234 (zypper).</message>
+</stream>`)
+	if _, err := parseZypperUpdates(output); err == nil {
+		t.Fatal("expected zypper error message to be returned")
+	}
+}
+
+func TestZypperInstallArgs(t *testing.T) {
+	if got := zypperInstallArgs("patch:SUSE-2024-1", true); !reflect.DeepEqual(got, []string{"install", "--auto-agree-with-licenses", "-t", "patch", "SUSE-2024-1", "--download-only"}) {
+		t.Fatalf("unexpected patch args: %v", got)
+	}
+	if got := zypperInstallArgs("vim", false); !reflect.DeepEqual(got, []string{"update", "--auto-agree-with-licenses", "vim"}) {
+		t.Fatalf("unexpected package args: %v", got)
+	}
+}
@@ -136,12 +136,16 @@ const (
 	// Script management (executor)
 	CmdScriptCancel      = "script_cancel"
 	CmdScriptListRunning = "script_list_running"
+	CmdScriptInput       = "script_input"
+	CmdScriptAnalyze     = "script_analyze"
 
 	// Backup management
 	CmdBackupRun     = "backup_run"
 	CmdBackupList    = "backup_list"
 	CmdBackupStop    = "backup_stop"
 	CmdBackupRestore = "backup_restore"
+	CmdBackupVerify  = "backup_verify"
+	CmdBackupBrowse  = "backup_browse"
 
 	// Log shipping
 	CmdSetLogLevel = "set_log_level"
@@ -164,6 +168,11 @@ const (
 
 	// Peripheral control
 	CmdPeripheralPolicySync = "peripheral_policy_sync"
+
+	// Agent-side command scheduling
+	CmdScheduleCommand = "schedule_command"
+	CmdScheduleList    = "schedule_list"
+	CmdScheduleCancel  = "schedule_cancel"
 )
 
 // CommandResult represents the result of a command execution
@@ -174,6 +183,7 @@ type CommandResult struct {
 	Stderr     string `json:"stderr,omitempty"`
 	Error      string `json:"error,omitempty"`
 	DurationMs int64  `json:"durationMs,omitempty"`
+	Code       string `json:"code,omitempty"` // why a failed command did not complete, e.g. interrupted
 }
 
 // NewSuccessResult creates a successful command result with data
@@ -0,0 +1,138 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ordinalWords = map[string]string{
+	"first": "1", "1st": "1",
+	"second": "2", "2nd": "2",
+	"third": "3", "3rd": "3",
+	"fourth": "4", "4th": "4",
+	"fifth": "5", "5th": "5",
+	"last": "l",
+}
+
+// calendarToCron translates a calendar phrase into a cron expression.
+func calendarToCron(fields []string) (string, error) {
+	hour, minute := 0, 0
+	var days []string
+	var ordinal, dayOfMonth string
+	period := ""
+
+	for i := 0; i < len(fields); i++ {
+		word := strings.Trim(fields[i], ",")
+		switch {
+		case word == "at" && i+1 < len(fields):
+			i++
+			var err error
+			if hour, minute, err = parseClock(fields[i]); err != nil {
+				return "", err
+			}
+		case word == "every" || word == "on" || word == "the" || word == "of" || word == "month":
+		case word == "day":
+			// "every day" means daily; "monthly on day 15" keeps monthly.
+			if period == "" {
+				period = "daily"
+			}
+		case word == "hourly" || word == "daily" || word == "weekly" || word == "monthly":
+			if period != "monthly" {
+				period = word
+			}
+		case word == "weekdays":
+			days = append(days, "1-5")
+		case word == "weekends":
+			days = append(days, "0,6")
+		case ordinalWords[word] != "":
+			ordinal = ordinalWords[word]
+		case isNumber(word):
+			dayOfMonth = word
+		case strings.Contains(word, ":"):
+			var err error
+			if hour, minute, err = parseClock(word); err != nil {
+				return "", err
+			}
+		default:
+			weekday, ok := parseWeekdayWord(word)
+			if !ok {
+				return "", fmt.Errorf("unrecognized word %q", word)
+			}
+			days = append(days, strconv.Itoa(weekday))
+		}
+	}
+
+	dom, dow := "*", "*"
+	switch {
+	case ordinal != "":
+		if len(days) != 1 || strings.ContainsAny(days[0], ",-") {
+			return "", errors.New("an ordinal needs exactly one weekday, e.g. \"first sunday monthly\"")
+		}
+		if ordinal == "l" {
+			dow = days[0] + "l"
+		} else {
+			dow = days[0] + "#" + ordinal
+		}
+	case period == "monthly":
+		dom = "1"
+		if dayOfMonth != "" {
+			dom = dayOfMonth
+		}
+		if len(days) > 0 {
+			return "", errors.New("use an ordinal for monthly weekday schedules, e.g. \"first sunday monthly\"")
+		}
+	case period == "hourly":
+		return fmt.Sprintf("%d * * * *", minute), nil
+	case len(days) > 0:
+		dow = strings.Join(days, ",")
+	case period == "daily":
+	case period == "weekly":
+		dow = "0"
+	default:
+		return "", errors.New("schedule needs a period or day")
+	}
+	if dayOfMonth != "" && dom == "*" {
+		return "", fmt.Errorf("day %s is only valid with monthly schedules", dayOfMonth)
+	}
+	return fmt.Sprintf("%d %d %s * %s", minute, hour, dom, dow), nil
+}
+
+func parseClock(value string) (int, int, error) {
+	hourPart, minutePart, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid time %q (want HH:MM)", value)
+	}
+	hour, err := strconv.Atoi(hourPart)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid time %q (want HH:MM)", value)
+	}
+	minute, err := strconv.Atoi(minutePart)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time %q (want HH:MM)", value)
+	}
+	return hour, minute, nil
+}
+
+// parseWeekdayWord accepts full, plural and abbreviated weekday names.
+func parseWeekdayWord(word string) (int, bool) {
+	if len(word) < 3 {
+		return 0, false
+	}
+	weekday, ok := weekdayNames[word[:3]]
+	if !ok {
+		return 0, false
+	}
+	full := strings.ToLower(time.Weekday(weekday).String())
+	if word != word[:3] && word != full && word != full+"s" {
+		return 0, false
+	}
+	return weekday, true
+}
+
+func isNumber(value string) bool {
+	n, err := strconv.Atoi(value)
+	return err == nil && n >= 1 && n <= 31
+}
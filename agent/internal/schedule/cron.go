@@ -0,0 +1,247 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression evaluated in local
+// time.
+type cronSchedule struct {
+	minute  uint64 // bits 0-59
+	hour    uint64 // bits 0-23
+	dom     uint64 // bits 1-31
+	month   uint64 // bits 1-12
+	dow     uint64 // bits 0-6
+	dowNth  [7]uint8
+	domStar bool
+	dowStar bool
+}
+
+// dowNth bit for "last <weekday> of the month"; bits 1-5 select the nth
+// occurrence.
+const dowNthLast = 1 << 0
+
+// maxScheduleSearch bounds how far ahead Next looks for a matching time so
+// an impossible expression such as "0 0 31 2 *" terminates.
+const maxScheduleSearch = 5 * 366 * 24 * time.Hour
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(maxScheduleSearch)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	weekday := int(t.Weekday())
+	dowMatch := s.dow&(1<<uint(weekday)) != 0
+	if nth := s.dowNth[weekday]; nth != 0 {
+		occurrence := (t.Day()-1)/7 + 1
+		daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		if nth&(1<<uint(occurrence)) != 0 || (nth&dowNthLast != 0 && t.Day()+7 > daysInMonth) {
+			dowMatch = true
+		}
+	}
+
+	// Standard cron semantics: when both day fields are restricted a day
+	// matching either one fires.
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dowMatch
+	case s.dowStar:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+func isCronExpression(fields []string) bool {
+	if len(fields) == 1 {
+		_, ok := cronMacros[fields[0]]
+		return ok
+	}
+	if len(fields) != 5 {
+		return false
+	}
+	first := fields[0][0]
+	return first == '*' || (first >= '0' && first <= '9')
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression needs 5 fields, got %d", len(fields))
+	}
+
+	s := &cronSchedule{
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if err = s.parseDayOfWeek(fields[4]); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	return s, nil
+}
+
+func (s *cronSchedule) parseDayOfWeek(field string) error {
+	var plain []string
+	for _, part := range strings.Split(field, ",") {
+		base, nth, isNth := strings.Cut(part, "#")
+		isLast := !isNth && len(part) > 1 && strings.HasSuffix(part, "l")
+		if isLast {
+			base = strings.TrimSuffix(part, "l")
+		}
+		if !isNth && !isLast {
+			plain = append(plain, part)
+			continue
+		}
+		weekday, err := parseCronValue(base, 0, 7, weekdayNames)
+		if err != nil {
+			return err
+		}
+		weekday %= 7
+		if isLast {
+			s.dowNth[weekday] |= dowNthLast
+			continue
+		}
+		occurrence, err := strconv.Atoi(nth)
+		if err != nil || occurrence < 1 || occurrence > 5 {
+			return fmt.Errorf("invalid occurrence %q", part)
+		}
+		s.dowNth[weekday] |= 1 << uint(occurrence)
+	}
+	if len(plain) == 0 {
+		return nil
+	}
+	bits, err := parseCronField(strings.Join(plain, ","), 0, 7, weekdayNames)
+	if err != nil {
+		return err
+	}
+	// Both 0 and 7 mean Sunday.
+	if bits&(1<<7) != 0 {
+		bits = bits&^(1<<7) | 1
+	}
+	s.dow = bits
+	return nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges and steps
+// into a bitset.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			loPart, hiPart, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseCronValue(loPart, min, max, names); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(hiPart, min, max, names); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			value, err := parseCronValue(rangePart, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			lo = value
+			if !hasStep {
+				hi = value
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	if names != nil && len(value) >= 3 {
+		if n, ok := names[value[:3]]; ok {
+			return n, nil
+		}
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid value %q (want %d-%d)", value, min, max)
+	}
+	return n, nil
+}
@@ -0,0 +1,71 @@
+// Package schedule parses recurring run schedules: Go durations, five-field
+// cron expressions and calendar phrases such as "weekdays at 22:00". It is
+// shared by the backup scheduler and the agent-side command scheduler.
+package schedule
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Schedule computes run times.
+type Schedule interface {
+	// Next returns the first run time strictly after the given time, or the
+	// zero time if the schedule never fires again.
+	Next(after time.Time) time.Time
+}
+
+// Interval fires at a fixed interval after the previous run.
+type Interval struct {
+	Every time.Duration
+}
+
+func (s Interval) Next(after time.Time) time.Time {
+	return after.Add(s.Every)
+}
+
+// Parse parses a single schedule specification, which is one of:
+//
+//   - a Go duration such as "24h", run at that interval
+//   - a five-field cron expression ("0 22 * * 1-5") or macro ("@weekly");
+//     the day-of-week field also accepts "0#1" (first Sunday) and "5L"
+//     (last Friday)
+//   - a calendar phrase such as "weekdays at 22:00", "daily at 01:30",
+//     "sunday at 03:00", "monthly on day 15 at 02:00" or
+//     "first sunday monthly at 02:00"
+func Parse(spec string) (Schedule, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 {
+		return nil, errors.New("missing schedule")
+	}
+
+	if len(fields) == 1 {
+		if interval, err := time.ParseDuration(fields[0]); err == nil {
+			if interval <= 0 {
+				return nil, errors.New("interval must be positive")
+			}
+			return Interval{Every: interval}, nil
+		}
+	}
+
+	cronExpr := strings.Join(fields, " ")
+	if !isCronExpression(fields) {
+		var err error
+		cronExpr, err = calendarToCron(fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ParseCron(cronExpr)
+}
+
+// ParseCron parses a five-field cron expression or macro, evaluated in the
+// location of the time passed to Next.
+func ParseCron(expr string) (Schedule, error) {
+	s, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
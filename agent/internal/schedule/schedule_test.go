@@ -0,0 +1,52 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNext(t *testing.T) {
+	loc := time.Local
+	// Friday 2026-01-09 23:00 local.
+	from := time.Date(2026, 1, 9, 23, 0, 0, 0, loc)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"weekdays at 22:00", time.Date(2026, 1, 12, 22, 0, 0, 0, loc)},
+		{"0 2 * * sun#1", time.Date(2026, 2, 1, 2, 0, 0, 0, loc)},
+		{"0 18 * * 5L", time.Date(2026, 1, 30, 18, 0, 0, 0, loc)},
+		{"15 3 1,15 * *", time.Date(2026, 1, 15, 3, 15, 0, 0, loc)},
+		{"0 0 1 jan-mar *", time.Date(2026, 2, 1, 0, 0, 0, 0, loc)},
+		{"@monthly", time.Date(2026, 2, 1, 0, 0, 0, 0, loc)},
+		{"90m", from.Add(90 * time.Minute)},
+	}
+	for _, tc := range tests {
+		s, err := Parse(tc.spec)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tc.want) {
+			t.Errorf("%q: next %v, want %v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestParseCronImpossibleNeverFires(t *testing.T) {
+	s, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Fatalf("expected no run for February 31st, got %v", next)
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"", "sometimes", "60 * * * *", "* * * *", "0 0 * * 0#6", "-1h"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Package scriptast parses shell, PowerShell and batch scripts far enough
+// to know which commands they run: comments and quoting are understood,
+// wrapper commands such as sudo are looked through, variables assigned
+// literal values are resolved, and code passed to eval, bash -c,
+// powershell -EncodedCommand and similar is parsed in turn. It does not
+// execute or fully validate scripts; constructs it cannot resolve are
+// marked dynamic so policy can treat them with suspicion.
+package scriptast
+
+import (
+	"path"
+	"strings"
+)
+
+// Word is one argument after quote removal and expansion of known
+// variables.
+type Word struct {
+	Text string
+	// Dynamic is set when the word depends on something only known at run
+	// time, such as a parameter or command output.
+	Dynamic bool
+	Pos     Pos
+	// Commands are the commands run to produce the word, from command
+	// substitution or subexpressions.
+	Commands []*Command
+	// text is where Text begins when the word opens with a quote.
+	text Pos
+}
+
+// textPos returns the position of the first character of w.Text.
+func (w Word) textPos() Pos {
+	if w.text.Line > 0 {
+		return w.text
+	}
+	return w.Pos
+}
+
+// Pos is a 1-based line and column, counted in characters.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// Redirect is an input or output redirection.
+type Redirect struct {
+	Op     string // >, >>, <, <<, <<<, 2>, &> ...
+	Target Word
+	// Body holds the text of a here-document or here-string.
+	Body string
+}
+
+// Command is one simple command.
+type Command struct {
+	// Name is the resolved command name: wrappers are skipped, directories
+	// stripped and aliases expanded. It is empty when Dynamic is set.
+	Name    string
+	Dynamic bool
+	// Args are the arguments following Name.
+	Args      []Word
+	Redirects []Redirect
+	Pos       Pos
+	// PipedFrom is the command whose output feeds this one.
+	PipedFrom  *Command
+	Background bool
+	// Function is the name of the function whose body contains the command.
+	Function string
+	// Nested is set for commands parsed out of another command's
+	// arguments or input, such as bash -c or eval.
+	Nested bool
+}
+
+// Script is the result of parsing a script.
+type Script struct {
+	// Commands lists every command found, including those in function
+	// bodies, substitutions and nested code, in source order.
+	Commands []*Command
+	// Methods lists .NET method invocations in PowerShell scripts.
+	Methods []Word
+	// Errors lists constructs that could not be parsed. Parsing recovers
+	// and continues, so Commands may still be incomplete.
+	Errors []ParseError
+}
+
+// ParseError describes a syntax problem.
+type ParseError struct {
+	Pos     Pos
+	Message string
+}
+
+func (s *Script) errorf(pos Pos, msg string) {
+	s.Errors = append(s.Errors, ParseError{Pos: pos, Message: msg})
+}
+
+// merge appends the commands of a nested script, marking them nested.
+func (s *Script) merge(nested *Script) {
+	for _, c := range nested.Commands {
+		c.Nested = true
+		s.Commands = append(s.Commands, c)
+	}
+	s.Methods = append(s.Methods, nested.Methods...)
+	s.Errors = append(s.Errors, nested.Errors...)
+}
+
+// Flags returns the option arguments of c, those starting with a dash.
+func (c *Command) Flags() []string {
+	var flags []string
+	for _, a := range c.Args {
+		if strings.HasPrefix(a.Text, "-") && !a.Dynamic {
+			flags = append(flags, a.Text)
+		}
+	}
+	return flags
+}
+
+// HasShortFlag reports whether c has a single-dash option containing the
+// letter, including combined options such as -rf.
+func (c *Command) HasShortFlag(letter byte) bool {
+	for _, f := range c.Flags() {
+		if len(f) > 1 && f[1] != '-' && strings.IndexByte(f[1:], letter) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLongFlag reports whether c has the given option, compared without
+// regard to case.
+func (c *Command) HasLongFlag(name string) bool {
+	for _, f := range c.Flags() {
+		if flag, _, _ := strings.Cut(f, "="); strings.EqualFold(flag, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Operands returns the literal arguments of c that are not options.
+func (c *Command) Operands() []Word {
+	var operands []Word
+	for _, a := range c.Args {
+		if !strings.HasPrefix(a.Text, "-") || a.Dynamic {
+			operands = append(operands, a)
+		}
+	}
+	return operands
+}
+
+// baseName strips the directory and, for Windows, the executable extension
+// from a command name.
+func baseName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".exe", ".com", ".cmd", ".bat"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
@@ -0,0 +1,405 @@
+package scriptast
+
+import "strings"
+
+type batchParser struct {
+	r       *reader
+	s       *Script
+	depth   int
+	vars    map[string]string // lower-cased names with literal values
+	delayed bool              // !name! expansion is enabled
+	blocks  int               // open parenthesized blocks
+}
+
+func parseBatch(s *Script, content string, base Pos, depth int) {
+	p := &batchParser{r: newReader(content, base), s: s, depth: depth, vars: map[string]string{}}
+	for !p.r.eof() {
+		p.parseLine()
+	}
+}
+
+// parseLine parses the commands on one logical line.
+func (p *batchParser) parseLine() {
+	var pipedFrom *Command
+	for {
+		p.skipBlanks()
+		if p.r.eof() {
+			return
+		}
+		switch c := p.r.peek(); {
+		case c == '\n':
+			p.r.next()
+			return
+		case c == '|' && p.r.peekAt(1) != '|':
+			p.r.next()
+			continue
+		case c == '&' || c == '|':
+			p.r.next()
+			if p.r.peek() == c {
+				p.r.next()
+			}
+			pipedFrom = nil
+			continue
+		case c == '@':
+			p.r.next()
+			continue
+		case c == '(':
+			p.r.next()
+			p.blocks++
+			continue
+		case c == ')':
+			p.r.next()
+			if p.blocks > 0 {
+				p.blocks--
+			}
+			continue
+		case c == ':':
+			// Labels, and :: comments.
+			p.r.skipLine()
+			continue
+		}
+		cmd := p.parseCommand(pipedFrom)
+		pipedFrom = nil
+		if cmd != nil && p.r.peek() == '|' && p.r.peekAt(1) != '|' {
+			pipedFrom = cmd
+		}
+	}
+}
+
+// parseCommand parses a command and its arguments.
+func (p *batchParser) parseCommand(pipedFrom *Command) *Command {
+	pos := p.r.pos()
+	cmd := &Command{Pos: pos, PipedFrom: pipedFrom}
+	start := p.r.i
+	name, nameQuoted := p.readWord(true, false)
+	var args []Word
+	var quoted []bool
+	if p.r.i == start {
+		// The command starts with a redirection.
+		if args, quoted = p.readArgs(cmd); len(args) == 0 {
+			return nil
+		}
+		name, nameQuoted, args, quoted = args[0], quoted[0], args[1:], quoted[1:]
+		cmd.Pos = name.Pos
+	}
+	switch strings.ToLower(name.Text) {
+	case "rem":
+		p.r.skipLine()
+		return nil
+	case "if":
+		p.skipCondition()
+		return nil
+	case "else", "":
+		return nil
+	case "for":
+		p.skipForHead()
+		return nil
+	case "set":
+		p.parseSet()
+		return nil
+	}
+	more, moreQuoted := p.readArgs(cmd)
+	words := append(append([]Word{name}, args...), more...)
+	words = resolveBatchWrappers(words, append(append([]bool{nameQuoted}, quoted...), moreQuoted...))
+	if words == nil {
+		return nil
+	}
+	if words[0].Dynamic {
+		cmd.Dynamic = true
+	} else {
+		cmd.Name = baseName(words[0].Text)
+	}
+	cmd.Args = words[1:]
+	if strings.EqualFold(cmd.Name, "setlocal") {
+		for _, a := range cmd.Args {
+			if strings.EqualFold(a.Text, "EnableDelayedExpansion") {
+				p.delayed = true
+			}
+		}
+	}
+	p.s.Commands = append(p.s.Commands, cmd)
+	p.s.follow(cmd, p.depth)
+	return cmd
+}
+
+// resolveBatchWrappers drops call and start, returning the words of the
+// command they run, or nil for a call to a label.
+func resolveBatchWrappers(words []Word, quoted []bool) []Word {
+	for len(words) > 1 && !words[0].Dynamic {
+		switch strings.ToLower(baseName(words[0].Text)) {
+		case "call":
+			if strings.HasPrefix(words[1].Text, ":") {
+				return nil
+			}
+			words, quoted = words[1:], quoted[1:]
+		case "start":
+			i := 1
+			if quoted[1] {
+				i++ // window title
+			}
+			for i < len(words) && strings.HasPrefix(words[i].Text, "/") {
+				switch strings.ToLower(words[i].Text) {
+				case "/d", "/node", "/affinity":
+					i++
+				}
+				i++
+			}
+			if i >= len(words) {
+				return words
+			}
+			words, quoted = words[i:], quoted[i:]
+		default:
+			return words
+		}
+	}
+	return words
+}
+
+// readArgs reads the arguments of cmd up to the next command separator,
+// collecting its redirections. It also reports which arguments were quoted.
+func (p *batchParser) readArgs(cmd *Command) ([]Word, []bool) {
+	var args []Word
+	var quoted []bool
+	for {
+		p.skipBlanks()
+		if p.r.eof() {
+			return args, quoted
+		}
+		c := p.r.peek()
+		switch {
+		case c == '\n' || c == '&' || c == '|' || c == ')' && p.blocks > 0:
+			return args, quoted
+		case c == '>' || c == '<' || isDigit(c) && p.r.peekAt(1) == '>':
+			start := p.r.i
+			if isDigit(c) {
+				p.r.next()
+			}
+			p.r.next()
+			if p.r.peek() == '>' {
+				p.r.next()
+			}
+			if p.r.peek() == '&' && isDigit(p.r.peekAt(1)) {
+				p.r.skip(2)
+				cmd.Redirects = append(cmd.Redirects, Redirect{Op: p.r.since(start)})
+				continue
+			}
+			op := p.r.since(start)
+			p.skipBlanks()
+			target, _ := p.readWord(false, false)
+			cmd.Redirects = append(cmd.Redirects, Redirect{Op: op, Target: target})
+		default:
+			start := p.r.i
+			w, q := p.readWord(false, false)
+			if p.r.i == start {
+				p.r.next()
+				continue
+			}
+			args = append(args, w)
+			quoted = append(quoted, q)
+		}
+	}
+}
+
+// skipCondition skips the condition of an if statement, leaving the
+// command it guards.
+func (p *batchParser) skipCondition() {
+	for {
+		p.skipBlanks()
+		start := p.r.i
+		p.readWord(false, false)
+		switch lower := strings.ToLower(p.r.since(start)); {
+		case lower == "/i" || lower == "not":
+			continue
+		case lower == "exist" || lower == "defined" || lower == "errorlevel" || lower == "cmdextversion":
+			p.skipBlanks()
+			p.readWord(false, false)
+		case strings.HasSuffix(lower, "=="):
+			p.skipBlanks()
+			p.readWord(false, false)
+		case strings.Contains(lower, "=="):
+		default:
+			p.skipBlanks()
+			op, _ := p.readWord(false, false)
+			p.skipBlanks()
+			if op.Text != "==" {
+				switch strings.ToLower(op.Text) {
+				case "equ", "neq", "lss", "leq", "gtr", "geq":
+				default:
+					p.s.errorf(op.Pos, "malformed if condition")
+					return
+				}
+			}
+			p.readWord(false, false)
+		}
+		return
+	}
+}
+
+// skipForHead skips a for loop up to its do keyword.
+func (p *batchParser) skipForHead() {
+	for !p.r.eof() && p.r.peek() != '\n' {
+		p.skipBlanks()
+		start := p.r.i
+		w, _ := p.readWord(false, false)
+		if strings.EqualFold(w.Text, "do") {
+			return
+		}
+		if p.r.i == start {
+			p.r.next()
+		}
+	}
+	p.s.errorf(p.r.pos(), "for without do")
+}
+
+// parseSet records set name=value assignments.
+func (p *batchParser) parseSet() {
+	p.skipBlanks()
+	w, _ := p.readWord(false, true)
+	text := strings.TrimSpace(w.Text)
+	switch lower := strings.ToLower(text); {
+	case strings.HasPrefix(lower, "/a"), strings.HasPrefix(lower, "/p"):
+		name, _, _ := strings.Cut(strings.TrimSpace(text[2:]), "=")
+		delete(p.vars, strings.ToLower(strings.Trim(name, `" `)))
+		return
+	}
+	name, value, ok := strings.Cut(text, "=")
+	if !ok {
+		return
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if w.Dynamic {
+		delete(p.vars, name)
+		return
+	}
+	p.vars[name] = value
+}
+
+// readWord reads a word, expanding known variables and removing quotes.
+// The first word of a command also ends at ( and at a / following its
+// name, as in del/q. When spaces is set, blanks do not end the word.
+func (p *batchParser) readWord(first, spaces bool) (Word, bool) {
+	w := Word{Pos: p.r.pos()}
+	var sb strings.Builder
+	inQuotes, quoted := false, false
+	for !p.r.eof() {
+		c := p.r.peek()
+		if c == '\n' || c == '\r' && p.r.peekAt(1) == '\n' {
+			break
+		}
+		if !inQuotes {
+			if c == '&' || c == '|' || c == '<' || c == '>' || c == ')' && p.blocks > 0 {
+				break
+			}
+			if !spaces && (c == ' ' || c == '\t') {
+				break
+			}
+			if first && (c == '(' || c == '/' && sb.Len() > 0 && !strings.ContainsAny(sb.String(), `\:`)) {
+				break
+			}
+		}
+		switch {
+		case c == '"':
+			p.r.next()
+			markText(p.r, &w, &sb)
+			inQuotes, quoted = !inQuotes, true
+		case c == '^' && !inQuotes:
+			p.r.next()
+			if p.r.peek() == '\r' {
+				p.r.next()
+			}
+			if !p.r.eof() {
+				if n := p.r.next(); n != '\n' {
+					sb.WriteRune(n)
+				}
+			}
+		case c == '%':
+			p.readPercent(&sb, &w)
+		case c == '!' && p.delayed:
+			p.readDelayed(&sb, &w)
+		default:
+			sb.WriteRune(p.r.next())
+		}
+	}
+	w.Text = sb.String()
+	return w, quoted
+}
+
+// readPercent reads a %name% expansion or a %1 or %%i parameter.
+func (p *batchParser) readPercent(sb *strings.Builder, w *Word) {
+	start := p.r.i
+	p.r.next()
+	switch c := p.r.peek(); {
+	case c == '%':
+		// A for loop variable such as %%i or %%~fi.
+		p.r.next()
+		for isNameStart(p.r.peek()) || p.r.peek() == '~' || p.r.peek() == '$' || p.r.peek() == ':' {
+			p.r.next()
+		}
+	case isDigit(c) || c == '*':
+		p.r.next()
+	case c == '~':
+		for !p.r.eof() && !isDigit(p.r.peek()) && !strings.ContainsRune("% \t\n", p.r.peek()) {
+			p.r.next()
+		}
+		if isDigit(p.r.peek()) {
+			p.r.next()
+		}
+	default:
+		end := p.r.i
+		for end < len(p.r.src) && p.r.src[end] != '%' && p.r.src[end] != '\n' {
+			end++
+		}
+		if end >= len(p.r.src) || p.r.src[end] != '%' {
+			sb.WriteByte('%')
+			return
+		}
+		name := strings.ToLower(string(p.r.src[p.r.i:end]))
+		p.r.skip(end - p.r.i + 1)
+		if v, ok := p.vars[name]; ok {
+			sb.WriteString(v)
+			return
+		}
+		if v, ok := windowsEnv[name]; ok {
+			sb.WriteString(v)
+			return
+		}
+	}
+	sb.WriteString(p.r.since(start))
+	w.Dynamic = true
+}
+
+// readDelayed reads a !name! expansion.
+func (p *batchParser) readDelayed(sb *strings.Builder, w *Word) {
+	start := p.r.i
+	p.r.next()
+	end := p.r.i
+	for end < len(p.r.src) && p.r.src[end] != '!' && p.r.src[end] != '\n' {
+		end++
+	}
+	if end >= len(p.r.src) || p.r.src[end] != '!' {
+		sb.WriteByte('!')
+		return
+	}
+	name := strings.ToLower(string(p.r.src[p.r.i:end]))
+	p.r.skip(end - p.r.i + 1)
+	if v, ok := p.vars[name]; ok {
+		sb.WriteString(v)
+		return
+	}
+	sb.WriteString(p.r.since(start))
+	w.Dynamic = true
+}
+
+// skipBlanks skips blanks and ^ line continuations.
+func (p *batchParser) skipBlanks() {
+	for !p.r.eof() {
+		switch c := p.r.peek(); {
+		case c == ' ' || c == '\t' || c == '\r' || c == ',' || c == ';':
+			p.r.next()
+		case c == '^' && p.r.peekAt(1) == '\n':
+			p.r.skip(2)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package scriptast
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// Languages understood by Parse.
+const (
+	Shell      = "sh"
+	PowerShell = "powershell"
+	Batch      = "cmd"
+)
+
+// maxDepth bounds how deeply code nested in other code is followed.
+const maxDepth = 8
+
+// Parse parses content written in lang, which must be one of Shell,
+// PowerShell or Batch. Parsing never fails: problems are recorded in
+// Script.Errors and the rest of the script is still examined.
+func Parse(lang, content string) *Script {
+	return parse(lang, content, Pos{Line: 1, Column: 1}, 0)
+}
+
+func parse(lang, content string, base Pos, depth int) *Script {
+	s := &Script{}
+	if depth > maxDepth {
+		s.errorf(base, "code nested too deeply to analyze")
+		return s
+	}
+	switch lang {
+	case Shell:
+		parseShell(s, content, base, depth)
+	case PowerShell:
+		parsePowerShell(s, content, base, depth)
+	case Batch:
+		parseBatch(s, content, base, depth)
+	default:
+		s.errorf(base, "unsupported language "+lang)
+	}
+	return s
+}
+
+// follow parses literal code that c passes to an interpreter.
+func (s *Script) follow(c *Command, depth int) {
+	lang, code, ok := c.EmbeddedCode()
+	if !ok || len(code) == 0 {
+		return
+	}
+	text, dynamic := joinWords(code)
+	if dynamic {
+		return
+	}
+	s.merge(parse(lang, text, code[0].textPos(), depth+1))
+}
+
+// EmbeddedCode returns the code c hands to an interpreter as arguments,
+// as with bash -c, eval, cmd /c, Invoke-Expression or powershell -Command,
+// and the language of that code. Encoded PowerShell commands are decoded.
+func (c *Command) EmbeddedCode() (lang string, code []Word, ok bool) {
+	switch name := strings.ToLower(c.Name); {
+	case shellNames[name]:
+		code, _ := shellCode(c.Args)
+		return Shell, code, code != nil
+	case name == "eval":
+		return Shell, c.Args, len(c.Args) > 0
+	case name == "su":
+		for i, a := range c.Args {
+			if a.Text == "-c" || a.Text == "--command" {
+				if i+1 < len(c.Args) {
+					return Shell, c.Args[i+1 : i+2], true
+				}
+			} else if v, ok := strings.CutPrefix(a.Text, "--command="); ok {
+				a.Text = v
+				return Shell, []Word{a}, true
+			}
+		}
+	case name == "powershell" || name == "pwsh" || name == "powershell_ise":
+		code := psHostCode(c.Args)
+		return PowerShell, code, code != nil
+	case name == "invoke-expression":
+		var code []Word
+		for i := 0; i < len(c.Args); i++ {
+			a := c.Args[i]
+			if isParam(a) {
+				if strings.EqualFold(a.Text, "-Command") && i+1 < len(c.Args) {
+					return PowerShell, c.Args[i+1 : i+2], true
+				}
+				continue
+			}
+			code = append(code, a)
+		}
+		return PowerShell, code, code != nil
+	case name == "cmd":
+		for i, a := range c.Args {
+			if a.Dynamic {
+				break
+			}
+			switch strings.ToLower(a.Text) {
+			case "/c", "/k", "/r":
+				return Batch, c.Args[i+1:], i+1 < len(c.Args)
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// shellNames lists POSIX-style shells.
+var shellNames = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true,
+	"mksh": true, "ash": true, "rbash": true, "yash": true,
+}
+
+// shellCode returns the argument of a shell's -c option. stdin reports
+// whether the shell instead reads commands from standard input.
+func shellCode(args []Word) (code []Word, stdin bool) {
+	hasC := false
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a.Dynamic {
+			return nil, false
+		}
+		t := a.Text
+		switch {
+		case t == "--" || t == "-":
+			i++
+			if hasC && i < len(args) {
+				return args[i : i+1], false
+			}
+			return nil, i >= len(args)
+		case strings.HasPrefix(t, "--"):
+			if t == "--rcfile" || t == "--init-file" {
+				i++
+			}
+		case len(t) > 1 && (t[0] == '-' || t[0] == '+'):
+			for _, l := range t[1:] {
+				switch l {
+				case 'c':
+					hasC = hasC || t[0] == '-'
+				case 'o', 'O':
+					i++
+				}
+			}
+		default:
+			if hasC {
+				return args[i : i+1], false
+			}
+			return nil, false
+		}
+	}
+	return nil, !hasC
+}
+
+// psHostValueParams are powershell.exe and pwsh options taking a value.
+var psHostValueParams = []string{
+	"executionpolicy", "windowstyle", "version", "psconsolefile",
+	"configurationname", "workingdirectory", "outputformat", "inputformat",
+	"settingsfile", "custompipename",
+}
+
+// psHostCode returns the command a PowerShell host is asked to run.
+func psHostCode(args []Word) []Word {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a.Dynamic || a.Text == "-" {
+			return nil
+		}
+		if len(a.Text) < 2 || (a.Text[0] != '-' && a.Text[0] != '/') {
+			// Windows PowerShell treats leftover arguments as a command.
+			return args[i:]
+		}
+		opt := strings.ToLower(a.Text[1:])
+		switch {
+		case opt == "ec" || strings.HasPrefix("encodedcommand", opt):
+			if i+1 >= len(args) {
+				return nil
+			}
+			w := args[i+1]
+			text, ok := decodeUTF16Base64(w.Text)
+			if !ok {
+				// Undecodable input is reported as dynamic code.
+				w.Dynamic = true
+				return []Word{w}
+			}
+			w.Text = text
+			return []Word{w}
+		case strings.HasPrefix("command", opt):
+			return args[i+1:]
+		case strings.HasPrefix("file", opt):
+			return nil
+		}
+		for _, p := range psHostValueParams {
+			if strings.HasPrefix(p, opt) {
+				i++
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// decodeUTF16Base64 decodes the argument of -EncodedCommand.
+func decodeUTF16Base64(s string) (string, bool) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(raw)%2 != 0 {
+		return "", false
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[2*i:])
+	}
+	return string(utf16.Decode(units)), true
+}
+
+// isParam reports whether w is a PowerShell parameter name.
+func isParam(w Word) bool {
+	return !w.Dynamic && len(w.Text) > 1 && w.Text[0] == '-' && isNameStart(rune(w.Text[1]))
+}
@@ -0,0 +1,112 @@
+package scriptast
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// summary renders each command as "line:column name args", marking dynamic
+// words with * and nested commands with >.
+func summary(s *Script) []string {
+	var out []string
+	for _, c := range s.Commands {
+		var b strings.Builder
+		if c.Nested {
+			b.WriteString(">")
+		}
+		fmt.Fprintf(&b, "%d:%d ", c.Pos.Line, c.Pos.Column)
+		if c.Dynamic {
+			b.WriteString("*")
+		} else {
+			b.WriteString(c.Name)
+		}
+		for _, a := range c.Args {
+			b.WriteString(" " + a.Text)
+			if a.Dynamic {
+				b.WriteString("*")
+			}
+		}
+		out = append(out, b.String())
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		src  string
+		want []string
+	}{
+		{"sh comment and quotes", Shell, "# rm -rf /\necho 'rm -rf /'", []string{"2:1 echo rm -rf /"}},
+		{"sh variable", Shell, "c=rm; $c -rf /", []string{"1:7 rm -rf /"}},
+		{"sh unknown variable", Shell, `$1 -rf "$dir"`, []string{"1:1 * -rf $dir*"}},
+		{"sh wrappers", Shell, "sudo -u root env A=1 nohup rm -rf /usr", []string{"1:1 rm -rf /usr"}},
+		{"sh command lookup", Shell, "command -v rm", []string{"1:1 command -v rm"}},
+		{"sh bash -c", Shell, "bash -c 'rm -rf /'", []string{"1:1 bash -c rm -rf /", ">1:10 rm -rf /"}},
+		{"sh eval", Shell, `eval "echo hi; mkfs /dev/sda"`, []string{"1:1 eval echo hi; mkfs /dev/sda", ">1:7 echo hi", ">1:16 mkfs /dev/sda"}},
+		{"sh heredoc to shell", Shell, "cat <<EOF | sh\nrm -rf /\nEOF", []string{"1:1 cat", "1:13 sh", ">2:1 rm -rf /"}},
+		{"sh heredoc to cat", Shell, "cat <<EOF\nrm -rf /\nEOF", []string{"1:1 cat"}},
+		{"sh substitution", Shell, "echo $(whoami) `id`", []string{"1:8 whoami", "1:17 id", "1:1 echo $(whoami)* `id`*"}},
+		{"sh ansi-c", Shell, `$'\x72\x6d' -rf /`, []string{"1:1 rm -rf /"}},
+		{"sh control flow", Shell, "if true; then\n  for f in a b; do rm \"$f\"; done\nfi", []string{"1:4 true", "2:20 rm $f*"}},
+		{"sh case", Shell, "case $x in\n  a) rm a;;\n  *) ls;;\nesac", []string{"2:6 rm a", "3:6 ls"}},
+		{"sh function", Shell, "f() { rm -rf \"$1\"; }\nf /tmp", []string{"1:7 rm -rf $1*", "2:1 f /tmp"}},
+
+		{"ps alias", PowerShell, "rm -Recurse C:\\Windows", []string{"1:1 Remove-Item -Recurse C:\\Windows"}},
+		{"ps comments", PowerShell, "<# Format-Volume #>\n# Clear-Disk\nGet-Date", []string{"3:1 Get-Date"}},
+		{"ps call operator", PowerShell, "$c = 'Remove-Item'; & $c -Recurse C:\\", []string{"1:21 Remove-Item -Recurse C:\\"}},
+		{"ps backticks", PowerShell, "I`E`X 'Clear-Disk -Number 0'", []string{"1:1 Invoke-Expression Clear-Disk -Number 0", ">1:8 Clear-Disk -Number 0"}},
+		{"ps encoded", PowerShell, "powershell -nop -w hidden -enc UgBlAG0AbwB2AGUALQBJAHQAZQBtACAAQwA6AFwA", []string{"1:1 powershell -nop -w hidden -enc UgBlAG0AbwB2AGUALQBJAHQAZQBtACAAQwA6AFwA", ">1:32 Remove-Item C:\\"}},
+		{"ps set-alias", PowerShell, "Set-Alias zap Remove-Item\nzap C:\\x", []string{"1:1 Set-Alias zap Remove-Item", "2:1 Remove-Item C:\\x"}},
+		{"ps env", PowerShell, "Remove-Item -Path:$env:SystemRoot", []string{"1:1 Remove-Item -Path C:\\Windows"}},
+		{"ps subexpression", PowerShell, "Write-Host \"now $(Get-Date)\"", []string{"1:19 Get-Date", "1:1 Write-Host now $(Get-Date)*"}},
+		{"ps script block", PowerShell, "if ($x) {\n  Format-Volume -DriveLetter D\n}", []string{"2:3 Format-Volume -DriveLetter D"}},
+
+		{"cmd comments", Batch, "@echo off\r\nrem format C:\r\n:: del x\r\ndir", []string{"1:2 echo off", "4:1 dir"}},
+		{"cmd set", Batch, "set x=format\r\n%x% C: /q", []string{"2:1 format C: /q"}},
+		{"cmd unknown variable", Batch, "%tool% %1", []string{"1:1 * %1*"}},
+		{"cmd switches on name", Batch, "del/f/s C:\\x", []string{"1:1 del /f/s C:\\x"}},
+		{"cmd start and cmd /c", Batch, "start \"\" /wait cmd /c rd /s /q %SystemRoot%", []string{"1:1 cmd /c rd /s /q C:\\Windows", ">1:23 rd /s /q C:\\Windows"}},
+		{"cmd if", Batch, "if \"%1\"==\"\" goto end", []string{"1:13 goto end"}},
+		{"cmd for", Batch, "for %%f in (*.log) do del %%f", []string{"1:23 del %%f*"}},
+		{"cmd call label", Batch, "call :sub & call reg query HKLM\\X", []string{"1:13 reg query HKLM\\X"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summary(Parse(tt.lang, tt.src))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for lang, src := range map[string]string{
+		Shell:      "echo \"unterminated",
+		PowerShell: "Write-Host 'unterminated",
+	} {
+		if s := Parse(lang, src); len(s.Errors) == 0 {
+			t.Errorf("%s: no error for %q", lang, src)
+		}
+	}
+}
+
+func TestParseDepthLimit(t *testing.T) {
+	src := "rm -rf /"
+	for i := 0; i < maxDepth+4; i++ {
+		src = "bash -c " + shellQuote(src)
+	}
+	s := Parse(Shell, src)
+	if len(s.Commands) > maxDepth+1 {
+		t.Errorf("parsed %d levels, limit is %d", len(s.Commands), maxDepth)
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
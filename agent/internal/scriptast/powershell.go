@@ -0,0 +1,720 @@
+package scriptast
+
+import (
+	"strings"
+	"unicode"
+)
+
+type psParser struct {
+	r       *reader
+	s       *Script
+	depth   int
+	nesting int
+	vars    map[string]string // lower-cased variable names with literal values
+	aliases map[string]string // aliases defined by the script
+	fn      string
+}
+
+func parsePowerShell(s *Script, content string, base Pos, depth int) {
+	p := &psParser{
+		r:       newReader(content, base),
+		s:       s,
+		depth:   depth,
+		vars:    map[string]string{},
+		aliases: map[string]string{},
+	}
+	p.parseBlock(0, false)
+}
+
+// psAliases are the built-in aliases for cmdlets policy cares about.
+var psAliases = map[string]string{
+	"iex": "Invoke-Expression", "iwr": "Invoke-WebRequest", "irm": "Invoke-RestMethod",
+	"curl": "Invoke-WebRequest", "wget": "Invoke-WebRequest",
+	"rm": "Remove-Item", "ri": "Remove-Item", "del": "Remove-Item", "erase": "Remove-Item",
+	"rd": "Remove-Item", "rmdir": "Remove-Item",
+	"sp": "Set-ItemProperty", "gp": "Get-ItemProperty", "ni": "New-Item",
+	"cp": "Copy-Item", "copy": "Copy-Item", "cpi": "Copy-Item",
+	"mv": "Move-Item", "move": "Move-Item", "mi": "Move-Item",
+	"start": "Start-Process", "saps": "Start-Process", "icm": "Invoke-Command",
+	"sal": "Set-Alias", "nal": "New-Alias", "ii": "Invoke-Item",
+	"echo": "Write-Output", "write": "Write-Output",
+	"gc": "Get-Content", "cat": "Get-Content", "type": "Get-Content",
+	"sc": "Set-Content", "ac": "Add-Content",
+	"%": "ForEach-Object", "foreach": "ForEach-Object", "?": "Where-Object", "where": "Where-Object",
+}
+
+// psExpressionKeywords start statements that are not commands.
+var psExpressionKeywords = map[string]bool{
+	"if": true, "elseif": true, "else": true, "switch": true, "foreach": true,
+	"for": true, "while": true, "do": true, "until": true, "try": true,
+	"catch": true, "finally": true, "trap": true, "param": true, "begin": true,
+	"process": true, "end": true, "clean": true, "dynamicparam": true,
+	"break": true, "continue": true, "class": true, "enum": true, "data": true,
+	"using": true, "in": true,
+}
+
+// parseBlock parses statements until close, or the end of input when close
+// is 0. In expression mode statements start as expressions, as in the
+// entries of a hashtable.
+func (p *psParser) parseBlock(close rune, exprMode bool) {
+	for {
+		p.skipSpace()
+		if p.r.eof() {
+			if close != 0 {
+				p.s.errorf(p.r.pos(), "missing "+string(close))
+			}
+			return
+		}
+		switch c := p.r.peek(); {
+		case c == close:
+			p.r.next()
+			return
+		case c == '\n' || c == ';' || c == ',':
+			p.r.next()
+		case c == ')' || c == '}':
+			p.s.errorf(p.r.pos(), "unexpected "+string(c))
+			p.r.next()
+		case p.r.hasPrefix("&&") || p.r.hasPrefix("||"):
+			p.r.skip(2)
+		default:
+			p.parsePipeline(exprMode)
+		}
+	}
+}
+
+// block parses a nested block whose opening has been consumed, attaching
+// the commands found to w.
+func (p *psParser) block(w *Word, close rune, exprMode bool) {
+	if p.nesting >= maxSubstitution {
+		p.s.errorf(p.r.pos(), "blocks nested too deeply to analyze")
+		p.r.skip(len(p.r.src))
+		return
+	}
+	before := len(p.s.Commands)
+	p.nesting++
+	p.parseBlock(close, exprMode)
+	p.nesting--
+	if w != nil {
+		w.Commands = append(w.Commands, p.s.Commands[before:]...)
+		w.Dynamic = true
+	}
+}
+
+// parsePipeline parses one pipeline. When it consists of a lone literal
+// string, that string is returned.
+func (p *psParser) parsePipeline(exprMode bool) *Word {
+	var prev *Command
+	var prevLiteral *Word
+	for first := true; ; first = false {
+		cmd, literal := p.parseElement(exprMode && first, !first)
+		if cmd != nil {
+			cmd.PipedFrom = prev
+			if prevLiteral != nil && strings.EqualFold(cmd.Name, "Invoke-Expression") && len(cmd.Args) == 0 {
+				p.s.merge(parse(PowerShell, prevLiteral.Text, prevLiteral.Pos, p.depth+1))
+			}
+		}
+		p.skipSpace()
+		if p.r.peek() != '|' || p.r.peekAt(1) == '|' {
+			if first {
+				return literal
+			}
+			return nil
+		}
+		p.r.next()
+		p.skipSpaceAndNewlines()
+		prev, prevLiteral = cmd, literal
+	}
+}
+
+// parseElement parses a pipeline element: a command or an expression.
+func (p *psParser) parseElement(exprMode, inPipe bool) (*Command, *Word) {
+	p.skipSpace()
+	pos := p.r.pos()
+	if exprMode || p.r.eof() {
+		return nil, p.parseExpression()
+	}
+	c := p.r.peek()
+	switch {
+	case c == '&' && p.r.peekAt(1) != '&', c == '.' && (p.r.peekAt(1) == ' ' || p.r.peekAt(1) == '\t'):
+		// Call and dot-source operators.
+		p.r.next()
+		p.skipSpace()
+		return p.command(p.readArg(false), pos), nil
+	case inPipe && (c == '%' || c == '?'):
+		p.r.next()
+		return p.command(Word{Text: string(c), Pos: pos}, pos), nil
+	case isNameStart(c) || c == '\\' || c == '.' || c > unicode.MaxASCII && unicode.IsLetter(c):
+		name := p.readArg(true)
+		if name.Dynamic {
+			return p.command(name, pos), nil
+		}
+		keyword := strings.ToLower(name.Text)
+		switch {
+		case keyword == "function" || keyword == "filter" || keyword == "workflow" || keyword == "configuration":
+			p.function()
+			return nil, nil
+		case keyword == "return" || keyword == "throw" || keyword == "exit":
+			return p.parseElement(false, false)
+		case keyword == "param" && !inPipe:
+			p.skipSpace()
+			if p.r.peek() == '(' {
+				p.r.next()
+				p.block(nil, ')', true)
+			}
+			return nil, nil
+		case psExpressionKeywords[keyword] && !inPipe:
+			p.parseExpression()
+			return nil, nil
+		}
+		return p.command(name, pos), nil
+	}
+	return nil, p.parseExpression()
+}
+
+// function parses a function definition after its keyword.
+func (p *psParser) function() {
+	p.skipSpace()
+	name := p.readArg(true)
+	p.skipSpace()
+	if p.r.peek() == '(' {
+		p.r.next()
+		p.block(nil, ')', true)
+	}
+	p.skipSpaceAndNewlines()
+	if p.r.peek() != '{' {
+		p.s.errorf(p.r.pos(), "expected function body")
+		return
+	}
+	p.r.next()
+	outer := p.fn
+	p.fn = name.Text
+	p.block(nil, '}', false)
+	p.fn = outer
+}
+
+// command reads the arguments of a command called name.
+func (p *psParser) command(name Word, pos Pos) *Command {
+	cmd := &Command{Pos: pos, Function: p.fn}
+	if name.Dynamic {
+		cmd.Dynamic = true
+	} else {
+		cmd.Name = p.resolve(name.Text)
+	}
+	cmd.Args, cmd.Redirects = p.readArgs()
+	p.s.Commands = append(p.s.Commands, cmd)
+	p.trackAliases(cmd)
+	p.s.follow(cmd, p.depth)
+	return cmd
+}
+
+// resolve expands aliases and strips module qualifiers and directories.
+func (p *psParser) resolve(name string) string {
+	if !strings.ContainsAny(name, `\/.`) {
+		lower := strings.ToLower(name)
+		if a, ok := p.aliases[lower]; ok {
+			name = a
+		} else if a, ok := psAliases[lower]; ok {
+			name = a
+		}
+	}
+	return baseName(name)
+}
+
+// trackAliases records aliases the script defines.
+func (p *psParser) trackAliases(c *Command) {
+	if !strings.EqualFold(c.Name, "Set-Alias") && !strings.EqualFold(c.Name, "New-Alias") {
+		return
+	}
+	var name, value string
+	var positional []string
+	for i := 0; i < len(c.Args); i++ {
+		a := c.Args[i]
+		if isParam(a) {
+			if i+1 < len(c.Args) {
+				switch strings.ToLower(a.Text) {
+				case "-name", "-n":
+					name = c.Args[i+1].Text
+					i++
+				case "-value", "-v":
+					value = c.Args[i+1].Text
+					i++
+				}
+			}
+			continue
+		}
+		positional = append(positional, a.Text)
+	}
+	for _, v := range positional {
+		if name == "" {
+			name = v
+		} else if value == "" {
+			value = v
+		}
+	}
+	if name != "" && value != "" {
+		p.aliases[strings.ToLower(name)] = p.resolve(value)
+	}
+}
+
+// readArgs reads command arguments up to the end of the pipeline element.
+func (p *psParser) readArgs() ([]Word, []Redirect) {
+	var args []Word
+	var redirects []Redirect
+	for {
+		p.skipSpace()
+		if p.r.eof() {
+			return args, redirects
+		}
+		pos := p.r.pos()
+		switch c := p.r.peek(); {
+		case c == '\n' || c == ';' || c == ')' || c == '}' || c == '|':
+			return args, redirects
+		case c == '&':
+			if p.r.peekAt(1) != '&' {
+				p.r.next()
+			}
+			return args, redirects
+		case c == '>' || c == '<' || (isDigit(c) || c == '*') && p.r.peekAt(1) == '>':
+			redirects = append(redirects, p.readRedirect())
+		case p.r.hasPrefix("--%"):
+			// Stop-parsing token: the rest of the line is passed verbatim.
+			p.r.skip(3)
+			start := p.r.i
+			p.r.skipLine()
+			args = append(args, Word{Text: strings.TrimSpace(p.r.since(start)), Pos: pos})
+		case isDash(c) && (isNameStart(p.r.peekAt(1)) || p.r.peekAt(1) == '?'):
+			p.r.next()
+			start := p.r.i
+			for isNameChar(p.r.peek()) || p.r.peek() == '?' || p.r.peek() == '-' {
+				p.r.next()
+			}
+			args = append(args, Word{Text: "-" + p.r.since(start), Pos: pos})
+			if p.r.peek() == ':' {
+				p.r.next()
+				args = append(args, p.readArg(false))
+			}
+		default:
+			args = append(args, p.readArg(false))
+		}
+	}
+}
+
+func (p *psParser) readRedirect() Redirect {
+	start := p.r.i
+	if p.r.peek() != '>' && p.r.peek() != '<' {
+		p.r.next()
+	}
+	p.r.next()
+	if p.r.peek() == '>' {
+		p.r.next()
+	}
+	if p.r.peek() == '&' && isDigit(p.r.peekAt(1)) {
+		p.r.skip(2)
+		return Redirect{Op: p.r.since(start)}
+	}
+	op := p.r.since(start)
+	p.skipSpace()
+	return Redirect{Op: op, Target: p.readArg(false)}
+}
+
+func isDash(c rune) bool {
+	return c == '-' || c == '–' || c == '—' || c == '―'
+}
+
+func isSingleQuote(c rune) bool {
+	return c == '\'' || c == '‘' || c == '’' || c == '‚' || c == '‛'
+}
+
+func isDoubleQuote(c rune) bool {
+	return c == '"' || c == '“' || c == '”' || c == '„'
+}
+
+// isArgEnd reports whether c ends an argument in argument mode.
+func isArgEnd(c rune) bool {
+	switch c {
+	case '\n', ';', '|', ')', '}', '&', '>', '<':
+		return true
+	}
+	return c != '\n' && unicode.IsSpace(c)
+}
+
+// readArg reads one argument, or a command name when name is set. Parts
+// that are evaluated at run time keep their source text and make the word
+// dynamic.
+func (p *psParser) readArg(name bool) Word {
+	w := Word{Pos: p.r.pos()}
+	var sb strings.Builder
+	value := false // the last part was a value whose members may be used
+	for !p.r.eof() {
+		c := p.r.peek()
+		start := p.r.i
+		switch {
+		case isArgEnd(c) || name && (c == '(' || c == '{' || c == '='):
+			w.Text = sb.String()
+			return w
+		case isSingleQuote(c):
+			p.r.next()
+			markText(p.r, &w, &sb)
+			p.readSingleQuoted(&sb)
+			value = true
+			continue
+		case isDoubleQuote(c):
+			p.r.next()
+			markText(p.r, &w, &sb)
+			p.readDoubleQuoted(&sb, &w)
+			value = true
+			continue
+		case c == '@' && (isSingleQuote(p.r.peekAt(1)) || isDoubleQuote(p.r.peekAt(1))):
+			p.r.next()
+			p.readHereString(&sb, &w)
+			value = true
+			continue
+		case c == '@' && (p.r.peekAt(1) == '(' || p.r.peekAt(1) == '{'):
+			p.r.skip(2)
+			p.block(&w, closer(p.r.src[p.r.i-1]), p.r.src[p.r.i-1] == '{')
+		case c == '$':
+			value = p.readVariable(&sb, &w)
+			continue
+		case c == '(' || c == '{':
+			p.r.next()
+			p.block(&w, closer(c), false)
+		case c == '`':
+			p.r.next()
+			if !p.r.eof() && p.r.peek() != '\n' {
+				sb.WriteRune(p.r.next())
+			}
+			value = false
+			continue
+		case value && (c == '.' && isNameStart(p.r.peekAt(1)) || p.r.hasPrefix("::")):
+			p.readMember(&w)
+		default:
+			sb.WriteRune(p.r.next())
+			value = false
+			continue
+		}
+		sb.WriteString(p.r.since(start))
+		value = true
+	}
+	w.Text = sb.String()
+	return w
+}
+
+func closer(open rune) rune {
+	if open == '{' {
+		return '}'
+	}
+	return ')'
+}
+
+// readMember reads a .Name or ::Name member access, recording method
+// calls.
+func (p *psParser) readMember(w *Word) {
+	if p.r.peek() == ':' {
+		p.r.skip(2)
+	} else {
+		p.r.next()
+	}
+	pos := p.r.pos()
+	start := p.r.i
+	for isNameChar(p.r.peek()) {
+		p.r.next()
+	}
+	name := p.r.since(start)
+	if p.r.peek() == '(' {
+		p.s.Methods = append(p.s.Methods, Word{Text: name, Pos: pos})
+		p.r.next()
+		p.block(w, ')', true)
+	}
+	w.Dynamic = true
+}
+
+func (p *psParser) readSingleQuoted(sb *strings.Builder) {
+	for !p.r.eof() {
+		c := p.r.next()
+		if isSingleQuote(c) {
+			if !isSingleQuote(p.r.peek()) {
+				return
+			}
+			c = p.r.next()
+		}
+		sb.WriteRune(c)
+	}
+	p.s.errorf(p.r.pos(), "unterminated string")
+}
+
+func (p *psParser) readDoubleQuoted(sb *strings.Builder, w *Word) {
+	for !p.r.eof() {
+		c := p.r.peek()
+		switch {
+		case isDoubleQuote(c):
+			p.r.next()
+			if !isDoubleQuote(p.r.peek()) {
+				return
+			}
+			sb.WriteRune(p.r.next())
+		case c == '`':
+			p.r.next()
+			p.readEscape(sb)
+		case c == '$' && (isNameStart(p.r.peekAt(1)) || strings.ContainsRune("({_?", p.r.peekAt(1))):
+			p.readVariable(sb, w)
+		default:
+			sb.WriteRune(p.r.next())
+		}
+	}
+	p.s.errorf(p.r.pos(), "unterminated string")
+}
+
+// readEscape decodes the character after a backtick in an expandable
+// string.
+func (p *psParser) readEscape(sb *strings.Builder) {
+	if p.r.eof() {
+		return
+	}
+	switch c := p.r.next(); c {
+	case '0':
+		sb.WriteByte(0)
+	case 'a':
+		sb.WriteByte('\a')
+	case 'b':
+		sb.WriteByte('\b')
+	case 'e':
+		sb.WriteByte(0x1b)
+	case 'f':
+		sb.WriteByte('\f')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'r':
+		sb.WriteByte('\r')
+	case 't':
+		sb.WriteByte('\t')
+	case 'v':
+		sb.WriteByte('\v')
+	default:
+		sb.WriteRune(c)
+	}
+}
+
+// readHereString reads a here-string whose @ has been consumed.
+func (p *psParser) readHereString(sb *strings.Builder, w *Word) {
+	expand := isDoubleQuote(p.r.next())
+	p.r.skipLine()
+	if p.r.eof() {
+		p.s.errorf(p.r.pos(), "unterminated here-string")
+		return
+	}
+	p.r.next()
+	var body strings.Builder
+	for !p.r.eof() {
+		if p.r.col == 1 && (isSingleQuote(p.r.peek()) || isDoubleQuote(p.r.peek())) && p.r.peekAt(1) == '@' {
+			p.r.skip(2)
+			sb.WriteString(strings.TrimSuffix(strings.TrimSuffix(body.String(), "\n"), "\r"))
+			return
+		}
+		c := p.r.peek()
+		switch {
+		case expand && c == '`':
+			p.r.next()
+			p.readEscape(&body)
+		case expand && c == '$' && (isNameStart(p.r.peekAt(1)) || p.r.peekAt(1) == '('):
+			p.readVariable(&body, w)
+		default:
+			body.WriteRune(p.r.next())
+		}
+	}
+	p.s.errorf(p.r.pos(), "unterminated here-string")
+}
+
+// readVariable reads a $ expression: a variable, $( ) subexpression or
+// ${ } name. It reports whether a value was read.
+func (p *psParser) readVariable(sb *strings.Builder, w *Word) bool {
+	start := p.r.i
+	p.r.next()
+	var name string
+	switch c := p.r.peek(); {
+	case c == '(':
+		p.r.next()
+		p.block(w, ')', false)
+		sb.WriteString(p.r.since(start))
+		return true
+	case c == '{':
+		p.r.next()
+		for !p.r.eof() && p.r.peek() != '}' {
+			p.r.next()
+		}
+		name = p.r.since(start + 2)
+		p.r.next()
+	case isNameChar(c) || c > unicode.MaxASCII && unicode.IsLetter(c):
+		for isNameChar(p.r.peek()) || p.r.peek() > unicode.MaxASCII && unicode.IsLetter(p.r.peek()) ||
+			p.r.peek() == ':' && isNameStart(p.r.peekAt(1)) {
+			p.r.next()
+		}
+		name = p.r.since(start + 1)
+	case strings.ContainsRune("$?^_", c) && c != 0:
+		p.r.next()
+		sb.WriteString(p.r.since(start))
+		w.Dynamic = true
+		return true
+	default:
+		sb.WriteByte('$')
+		return false
+	}
+	lower := strings.ToLower(name)
+	if v, ok := p.vars[lower]; ok {
+		sb.WriteString(v)
+	} else if v, ok := windowsEnv[strings.TrimPrefix(lower, "env:")]; ok && strings.HasPrefix(lower, "env:") {
+		sb.WriteString(v)
+	} else if lower == "true" || lower == "false" || lower == "null" {
+		sb.WriteString(p.r.since(start))
+	} else {
+		sb.WriteString(p.r.since(start))
+		w.Dynamic = true
+	}
+	return true
+}
+
+// parseExpression parses an expression statement. When it consists of a
+// single literal string, that string is returned.
+func (p *psParser) parseExpression() *Word {
+	var literal *Word
+	tokens := 0
+	target := "" // variable assigned to, if the statement starts with one
+	for {
+		p.skipSpace()
+		if p.r.eof() {
+			break
+		}
+		c := p.r.peek()
+		if c == '\n' || c == ';' || c == ')' || c == '}' || c == ',' && tokens == 0 ||
+			c == '|' || p.r.hasPrefix("&&") {
+			break
+		}
+		tokens++
+		switch {
+		case c == '=' && p.r.peekAt(1) != '=':
+			p.r.next()
+			p.skipSpaceAndNewlines()
+			value := p.parsePipeline(false)
+			if target != "" {
+				if value != nil && !value.Dynamic && tokens == 2 {
+					p.vars[target] = value.Text
+				} else {
+					delete(p.vars, target)
+				}
+			}
+			return nil
+		case strings.ContainsRune("+-*/%?", c) && p.r.peekAt(1) == '=':
+			p.r.skip(2)
+			delete(p.vars, target)
+			p.skipSpaceAndNewlines()
+			p.parsePipeline(false)
+			return nil
+		case isSingleQuote(c) || isDoubleQuote(c) || c == '@' && (isSingleQuote(p.r.peekAt(1)) || isDoubleQuote(p.r.peekAt(1))):
+			w := Word{Pos: p.r.pos()}
+			var sb strings.Builder
+			switch {
+			case isSingleQuote(c):
+				p.r.next()
+				p.readSingleQuoted(&sb)
+			case isDoubleQuote(c):
+				p.r.next()
+				p.readDoubleQuoted(&sb, &w)
+			default:
+				p.r.next()
+				p.readHereString(&sb, &w)
+			}
+			w.Text = sb.String()
+			literal = &w
+		case c == '$':
+			var w Word
+			start := p.r.i
+			p.readVariable(&strings.Builder{}, &w)
+			if tokens == 1 {
+				target = strings.ToLower(strings.Trim(p.r.since(start+1), "{}"))
+			}
+		case c == '@' && (p.r.peekAt(1) == '(' || p.r.peekAt(1) == '{'):
+			p.r.skip(2)
+			open := p.r.src[p.r.i-1]
+			p.block(nil, closer(open), open == '{')
+		case c == '(' || c == '{':
+			p.r.next()
+			p.block(nil, closer(c), false)
+		case c == '[':
+			p.skipType()
+		case c == '.' && isNameStart(p.r.peekAt(1)) || p.r.hasPrefix("::"):
+			p.readMember(&Word{})
+		case c == '`':
+			p.r.skip(2)
+		case isNameChar(c) || isDash(c) && isNameStart(p.r.peekAt(1)):
+			p.r.next()
+			for isNameChar(p.r.peek()) || p.r.peek() == '-' {
+				p.r.next()
+			}
+		default:
+			p.r.next()
+		}
+	}
+	if tokens == 1 {
+		return literal
+	}
+	return nil
+}
+
+// skipType skips a [type] literal, including nested brackets and
+// attribute arguments.
+func (p *psParser) skipType() {
+	depth := 0
+	for !p.r.eof() {
+		switch c := p.r.next(); {
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth--; depth == 0 {
+				return
+			}
+		case c == '(':
+			p.block(nil, ')', true)
+		case isSingleQuote(c):
+			p.readSingleQuoted(&strings.Builder{})
+		case isDoubleQuote(c):
+			p.readDoubleQuoted(&strings.Builder{}, &Word{})
+		}
+	}
+	p.s.errorf(p.r.pos(), "missing ]")
+}
+
+// skipSpace skips blanks, comments and line continuations.
+func (p *psParser) skipSpace() {
+	for !p.r.eof() {
+		c := p.r.peek()
+		switch {
+		case c == '\n':
+			return
+		case unicode.IsSpace(c):
+			p.r.next()
+		case c == '`' && p.r.peekAt(1) == '\n':
+			p.r.skip(2)
+		case c == '`' && p.r.peekAt(1) == '\r' && p.r.peekAt(2) == '\n':
+			p.r.skip(3)
+		case p.r.hasPrefix("<#"):
+			p.r.skip(2)
+			for !p.r.eof() && !p.r.hasPrefix("#>") {
+				p.r.next()
+			}
+			p.r.skip(2)
+		case c == '#':
+			p.r.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *psParser) skipSpaceAndNewlines() {
+	for {
+		p.skipSpace()
+		if p.r.peek() != '\n' {
+			return
+		}
+		p.r.next()
+	}
+}
@@ -0,0 +1,136 @@
+package scriptast
+
+import "strings"
+
+// reader walks source text a character at a time, tracking the position.
+type reader struct {
+	src  []rune
+	i    int
+	line int
+	col  int
+}
+
+func newReader(text string, base Pos) *reader {
+	if base.Line < 1 {
+		base.Line = 1
+	}
+	if base.Column < 1 {
+		base.Column = 1
+	}
+	return &reader{src: []rune(text), line: base.Line, col: base.Column}
+}
+
+func (r *reader) eof() bool { return r.i >= len(r.src) }
+
+func (r *reader) pos() Pos { return Pos{Line: r.line, Column: r.col} }
+
+func (r *reader) peek() rune { return r.peekAt(0) }
+
+// peekAt returns the character k places ahead, or 0 past the end.
+func (r *reader) peekAt(k int) rune {
+	if r.i+k < len(r.src) {
+		return r.src[r.i+k]
+	}
+	return 0
+}
+
+func (r *reader) next() rune {
+	c := r.src[r.i]
+	r.i++
+	if c == '\n' {
+		r.line++
+		r.col = 1
+	} else {
+		r.col++
+	}
+	return c
+}
+
+func (r *reader) skip(n int) {
+	for ; n > 0 && !r.eof(); n-- {
+		r.next()
+	}
+}
+
+func (r *reader) hasPrefix(s string) bool {
+	i := r.i
+	for _, c := range s {
+		if i >= len(r.src) || r.src[i] != c {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// hasPrefixFold is hasPrefix ignoring ASCII case.
+func (r *reader) hasPrefixFold(s string) bool {
+	i := r.i
+	for _, c := range s {
+		if i >= len(r.src) || toLower(r.src[i]) != toLower(c) {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// since returns the source text from index start to the current position.
+func (r *reader) since(start int) string {
+	return string(r.src[start:r.i])
+}
+
+// skipLine consumes up to, but not including, the next newline.
+func (r *reader) skipLine() {
+	for !r.eof() && r.peek() != '\n' {
+		r.next()
+	}
+}
+
+// markText records where the text of w begins when it opens with a
+// quote, with r just past the quote.
+func markText(r *reader, w *Word, sb *strings.Builder) {
+	if sb.Len() == 0 && w.text.Line == 0 {
+		w.text = r.pos()
+	}
+}
+
+func toLower(c rune) rune {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func isNameStart(c rune) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c rune) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+func isDigit(c rune) bool { return c >= '0' && c <= '9' }
+
+// joinWords joins the text of words with spaces, reporting whether any of
+// them is dynamic.
+func joinWords(words []Word) (string, bool) {
+	parts := make([]string, len(words))
+	dynamic := false
+	for i, w := range words {
+		parts[i] = w.Text
+		dynamic = dynamic || w.Dynamic
+	}
+	return strings.Join(parts, " "), dynamic
+}
+
+// windowsEnv holds the usual values of environment variables that scripts
+// use to reach system locations.
+var windowsEnv = map[string]string{
+	"systemroot":        `C:\Windows`,
+	"windir":            `C:\Windows`,
+	"systemdrive":       `C:`,
+	"programfiles":      `C:\Program Files`,
+	"programfiles(x86)": `C:\Program Files (x86)`,
+	"programdata":       `C:\ProgramData`,
+}
@@ -0,0 +1,957 @@
+package scriptast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxSubstitution bounds nesting of command substitutions and groups.
+const maxSubstitution = 200
+
+// shStop says what ends a shell command list.
+type shStop int
+
+const (
+	stopEOF   shStop = iota
+	stopParen        // ) closing a subshell or substitution
+	stopBrace        // } closing a group or function body
+	stopCase         // ;; ending a case item, or esac
+)
+
+type shParser struct {
+	r        *reader
+	s        *Script
+	depth    int
+	nesting  int
+	vars     map[string]string // variables holding known literal values
+	fn       string
+	heredocs []pendingHeredoc
+}
+
+type pendingHeredoc struct {
+	cmd   *Command
+	index int
+	delim string
+	strip bool
+}
+
+// shBuilder collects the words of the simple command being read.
+type shBuilder struct {
+	cmd   *Command
+	words []Word
+}
+
+func (b *shBuilder) start(pos Pos) {
+	if b.cmd == nil {
+		b.cmd = &Command{Pos: pos}
+	}
+}
+
+func parseShell(s *Script, content string, base Pos, depth int) {
+	p := &shParser{r: newReader(content, base), s: s, depth: depth, vars: map[string]string{}}
+	p.parseList(stopEOF)
+	if len(p.heredocs) > 0 {
+		s.errorf(p.r.pos(), "unterminated here-document")
+	}
+}
+
+// shKeywords are reserved words with no effect on which commands run.
+var shKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"do": true, "done": true, "while": true, "until": true, "!": true,
+	"time": true, "in": true, "coproc": true,
+}
+
+// parseList parses commands until stop. It reports whether a case
+// statement ended with esac rather than ;;.
+func (p *shParser) parseList(stop shStop) (esac bool) {
+	var b shBuilder
+	var pipedFrom *Command
+	end := func() *Command {
+		c := p.finish(&b, pipedFrom)
+		pipedFrom = nil
+		return c
+	}
+	for {
+		p.skipBlanks()
+		if p.r.eof() {
+			end()
+			switch stop {
+			case stopParen:
+				p.s.errorf(p.r.pos(), "missing )")
+			case stopBrace:
+				p.s.errorf(p.r.pos(), "missing }")
+			case stopCase:
+				p.s.errorf(p.r.pos(), "missing esac")
+			}
+			return false
+		}
+		pos := p.r.pos()
+		switch c := p.r.peek(); {
+		case c == '#':
+			p.r.skipLine()
+		case c == '\n':
+			p.r.next()
+			end()
+			p.readHeredocs()
+		case c == ';':
+			if stop == stopCase && (p.r.hasPrefix(";;") || p.r.hasPrefix(";&")) {
+				end()
+				p.r.skip(2)
+				if p.r.peek() == '&' {
+					p.r.next()
+				}
+				return false
+			}
+			p.r.next()
+			end()
+		case c == '&' && p.r.peekAt(1) == '>':
+			b.start(pos)
+			p.readRedirect(&b)
+		case c == '&':
+			p.r.next()
+			if p.r.peek() == '&' {
+				p.r.next()
+				end()
+				continue
+			}
+			if cmd := end(); cmd != nil {
+				cmd.Background = true
+			}
+		case c == '|':
+			p.r.next()
+			if p.r.peek() == '|' {
+				p.r.next()
+				end()
+				continue
+			}
+			if p.r.peek() == '&' {
+				p.r.next()
+			}
+			from := end()
+			pipedFrom = from
+		case c == '(':
+			if len(b.words) == 1 && !b.words[0].Dynamic && p.atFunctionParens() {
+				name := b.words[0].Text
+				b = shBuilder{}
+				p.functionBody(name)
+				continue
+			}
+			if len(b.words) == 0 && p.r.peekAt(1) == '(' {
+				p.r.skip(2)
+				p.skipArithmetic()
+				continue
+			}
+			end()
+			p.r.next()
+			p.group(stopParen, pos)
+		case c == ')':
+			if stop == stopParen {
+				end()
+				p.r.next()
+				return false
+			}
+			p.s.errorf(pos, "unexpected )")
+			p.r.next()
+		case p.atRedirect():
+			b.start(pos)
+			p.readRedirect(&b)
+		default:
+			w := p.readWord()
+			if len(b.words) == 0 && !w.Dynamic && w.Commands == nil {
+				switch {
+				case w.Text == "}" && stop == stopBrace:
+					end()
+					return false
+				case w.Text == "esac" && stop == stopCase:
+					end()
+					return true
+				case w.Text == "{":
+					p.group(stopBrace, pos)
+					continue
+				case w.Text == "[[":
+					p.skipTest()
+					continue
+				case w.Text == "case":
+					p.parseCase()
+					continue
+				case w.Text == "for" || w.Text == "select":
+					p.parseFor()
+					continue
+				case w.Text == "function":
+					p.skipBlanks()
+					name := p.readWord()
+					p.skipBlanks()
+					p.atFunctionParens()
+					p.functionBody(name.Text)
+					continue
+				case shKeywords[w.Text]:
+					continue
+				}
+			}
+			if len(b.words) == 0 && p.assignment(w) {
+				b.start(pos)
+				continue
+			}
+			b.start(w.Pos)
+			b.words = append(b.words, w)
+		}
+	}
+}
+
+// group parses a subshell or brace group.
+func (p *shParser) group(stop shStop, pos Pos) {
+	if p.nesting >= maxSubstitution {
+		p.s.errorf(pos, "commands nested too deeply to analyze")
+		p.r.skip(len(p.r.src))
+		return
+	}
+	p.nesting++
+	p.parseList(stop)
+	p.nesting--
+}
+
+// atFunctionParens consumes the () of a function definition if present.
+func (p *shParser) atFunctionParens() bool {
+	i := 1
+	if p.r.peek() != '(' {
+		return false
+	}
+	for p.r.peekAt(i) == ' ' || p.r.peekAt(i) == '\t' {
+		i++
+	}
+	if p.r.peekAt(i) != ')' {
+		return false
+	}
+	p.r.skip(i + 1)
+	return true
+}
+
+// functionBody parses the body of function name.
+func (p *shParser) functionBody(name string) {
+	p.skipBlanksAndNewlines()
+	pos := p.r.pos()
+	outer := p.fn
+	p.fn = name
+	defer func() { p.fn = outer }()
+	switch {
+	case p.r.peek() == '{':
+		p.r.next()
+		p.group(stopBrace, pos)
+	case p.r.peek() == '(':
+		p.r.next()
+		p.group(stopParen, pos)
+	default:
+		p.s.errorf(pos, "expected function body")
+	}
+}
+
+// parseCase parses a case statement after the case keyword.
+func (p *shParser) parseCase() {
+	p.skipBlanks()
+	p.readWord()
+	p.skipBlanksAndNewlines()
+	if w := p.readWord(); w.Text != "in" {
+		p.s.errorf(w.Pos, "expected in after case")
+		return
+	}
+	for {
+		p.skipBlanksAndNewlines()
+		if p.r.eof() {
+			p.s.errorf(p.r.pos(), "missing esac")
+			return
+		}
+		if p.r.peek() == '#' {
+			p.r.skipLine()
+			continue
+		}
+		if p.r.hasPrefix("esac") && p.atWordEnd(4) {
+			p.r.skip(4)
+			return
+		}
+		if p.r.peek() == '(' {
+			p.r.next()
+		}
+		for !p.r.eof() {
+			p.skipBlanks()
+			c := p.r.peek()
+			if c == ')' {
+				p.r.next()
+				break
+			}
+			if c == '|' {
+				p.r.next()
+				continue
+			}
+			if c == '\n' || isShellMeta(c) {
+				p.s.errorf(p.r.pos(), "malformed case pattern")
+				p.r.next()
+				break
+			}
+			p.readWord()
+		}
+		if p.parseList(stopCase) {
+			return
+		}
+	}
+}
+
+// parseFor parses the head of a for or select loop, up to do.
+func (p *shParser) parseFor() {
+	p.skipBlanks()
+	if p.r.hasPrefix("((") {
+		p.r.skip(2)
+		p.skipArithmetic()
+		return
+	}
+	name := p.readWord()
+	delete(p.vars, name.Text)
+	for !p.r.eof() {
+		p.skipBlanks()
+		c := p.r.peek()
+		if c == ';' || c == '\n' || c == '#' {
+			return
+		}
+		if isShellMeta(c) {
+			p.r.next()
+			continue
+		}
+		if w := p.readWord(); w.Text == "do" {
+			return
+		}
+	}
+}
+
+// skipTest skips a [[ ]] conditional, whose operators are not command
+// separators or redirections. Substitutions inside are still parsed.
+func (p *shParser) skipTest() {
+	for !p.r.eof() {
+		p.skipBlanks()
+		c := p.r.peek()
+		if c == '\n' {
+			p.r.next()
+			continue
+		}
+		if isShellMeta(c) && !((c == '<' || c == '>') && p.r.peekAt(1) == '(') {
+			p.r.next()
+			continue
+		}
+		if w := p.readWord(); w.Text == "]]" {
+			return
+		}
+	}
+	p.s.errorf(p.r.pos(), "missing ]]")
+}
+
+// skipArithmetic skips the rest of an arithmetic expression whose opening
+// (( has been consumed.
+func (p *shParser) skipArithmetic() {
+	depth := 2
+	for !p.r.eof() {
+		switch p.r.next() {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+	p.s.errorf(p.r.pos(), "missing ))")
+}
+
+// assignment records a NAME=value word in command position.
+func (p *shParser) assignment(w Word) bool {
+	name, value, ok := splitAssignment(w.Text)
+	if !ok {
+		return false
+	}
+	name, appending := strings.CutSuffix(name, "+")
+	if w.Dynamic || appending || strings.HasPrefix(value, "(") {
+		delete(p.vars, name)
+	} else {
+		p.vars[name] = value
+	}
+	return true
+}
+
+// splitAssignment splits NAME=value or NAME+=value.
+func splitAssignment(text string) (name, value string, ok bool) {
+	name, value, ok = strings.Cut(text, "=")
+	if !ok || name == "" || !isNameStart(rune(name[0])) {
+		return "", "", false
+	}
+	for i, c := range strings.TrimSuffix(name, "+") {
+		if i > 0 && !isNameChar(c) {
+			return "", "", false
+		}
+	}
+	return name, value, true
+}
+
+// finish completes the simple command in b.
+func (p *shParser) finish(b *shBuilder, pipedFrom *Command) *Command {
+	cmd, words := b.cmd, b.words
+	*b = shBuilder{}
+	if len(words) == 0 {
+		return nil
+	}
+	cmd.Function = p.fn
+	cmd.PipedFrom = pipedFrom
+	words = resolveWrappers(words)
+	if words[0].Dynamic {
+		cmd.Dynamic = true
+		cmd.Pos = words[0].Pos
+	} else {
+		cmd.Name = baseName(words[0].Text)
+	}
+	cmd.Args = words[1:]
+	p.s.Commands = append(p.s.Commands, cmd)
+	p.trackVariables(cmd)
+	p.s.follow(cmd, p.depth)
+	if stdinShell(cmd) {
+		for _, r := range cmd.Redirects {
+			if r.Op == "<<<" && !r.Target.Dynamic {
+				p.s.merge(parse(Shell, r.Target.Text, r.Target.Pos, p.depth+1))
+			}
+		}
+		if pipedFrom != nil && (pipedFrom.Name == "echo" || pipedFrom.Name == "printf") {
+			if text, dynamic := joinWords(pipedFrom.Operands()); !dynamic {
+				p.s.merge(parse(Shell, text, pipedFrom.Pos, p.depth+1))
+			}
+		}
+	}
+	return cmd
+}
+
+// stdinShell reports whether c is a shell reading commands from stdin.
+func stdinShell(c *Command) bool {
+	if !shellNames[c.Name] {
+		return false
+	}
+	_, stdin := shellCode(c.Args)
+	return stdin
+}
+
+// trackVariables follows builtins that set or clear variables.
+func (p *shParser) trackVariables(c *Command) {
+	switch c.Name {
+	case "export", "declare", "local", "readonly", "typeset":
+		for _, a := range c.Args {
+			if !strings.HasPrefix(a.Text, "-") {
+				p.assignment(a)
+			}
+		}
+	case "read", "unset", "mapfile", "readarray", "getopts":
+		for _, a := range c.Operands() {
+			delete(p.vars, a.Text)
+		}
+	}
+}
+
+// shWrapper describes a command that runs another command given as its
+// arguments.
+type shWrapper struct {
+	valueOpts  string   // short options taking a value
+	longValue  []string // long options taking a separate value
+	assigns    bool     // NAME=value arguments precede the command
+	positional int      // operands before the command
+	notWrapper string   // short options meaning no command is run
+}
+
+var shWrappers = map[string]shWrapper{
+	"sudo":       {valueOpts: "CDghpRrtTUu", longValue: []string{"--user", "--group", "--chdir", "--prompt", "--chroot", "--role", "--type", "--host", "--close-from", "--command-timeout", "--other-user"}, notWrapper: "lvVeK"},
+	"doas":       {valueOpts: "uC"},
+	"env":        {valueOpts: "uCS", longValue: []string{"--unset", "--chdir", "--split-string"}, assigns: true},
+	"nohup":      {},
+	"setsid":     {},
+	"exec":       {valueOpts: "a"},
+	"builtin":    {},
+	"command":    {notWrapper: "vV"},
+	"time":       {valueOpts: "of"},
+	"nice":       {valueOpts: "n", longValue: []string{"--adjustment"}},
+	"ionice":     {valueOpts: "cnp"},
+	"timeout":    {valueOpts: "sk", longValue: []string{"--signal", "--kill-after"}, positional: 1},
+	"stdbuf":     {valueOpts: "ioe"},
+	"unbuffer":   {},
+	"caffeinate": {valueOpts: "tw"},
+	"chroot":     {positional: 1},
+	"flock":      {valueOpts: "wE", positional: 1},
+	"taskset":    {positional: 1},
+	"runuser":    {valueOpts: "ugG", longValue: []string{"--user", "--group"}},
+	"xargs":      {valueOpts: "aEIdLnPs", longValue: []string{"--arg-file", "--delimiter", "--max-args", "--max-procs", "--max-chars", "--replace"}},
+	"watch":      {valueOpts: "n", longValue: []string{"--interval"}},
+	"busybox":    {},
+}
+
+// resolveWrappers drops wrapper commands and their options, returning the
+// words of the command finally run.
+func resolveWrappers(words []Word) []Word {
+	for len(words) > 1 && !words[0].Dynamic {
+		w, ok := shWrappers[baseName(words[0].Text)]
+		if !ok {
+			break
+		}
+		rest, ok := skipWrapperOptions(w, words[1:])
+		if !ok || len(rest) == 0 {
+			break
+		}
+		words = rest
+	}
+	return words
+}
+
+func skipWrapperOptions(w shWrapper, args []Word) ([]Word, bool) {
+	i := 0
+options:
+	for i < len(args) {
+		a := args[i]
+		t := a.Text
+		switch {
+		case a.Dynamic:
+			break options
+		case t == "--":
+			i++
+			break options
+		case strings.HasPrefix(t, "--"):
+			i++
+			for _, l := range w.longValue {
+				if t == l {
+					i++
+				}
+			}
+		case len(t) > 1 && t[0] == '-':
+			i++
+			for j := 1; j < len(t); j++ {
+				if strings.IndexByte(w.notWrapper, t[j]) >= 0 {
+					return nil, false
+				}
+				if strings.IndexByte(w.valueOpts, t[j]) >= 0 {
+					if j == len(t)-1 {
+						i++
+					}
+					break
+				}
+			}
+		case w.assigns && strings.Contains(t, "="):
+			if _, _, ok := splitAssignment(t); !ok {
+				break options
+			}
+			i++
+		default:
+			break options
+		}
+	}
+	i += w.positional
+	if i > len(args) {
+		return nil, false
+	}
+	return args[i:], true
+}
+
+// isShellMeta reports whether c ends an unquoted word.
+func isShellMeta(c rune) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', ';', '&', '|', '<', '>', '(', ')':
+		return true
+	}
+	return false
+}
+
+// atWordEnd reports whether the character n ahead ends a word.
+func (p *shParser) atWordEnd(n int) bool {
+	return p.r.i+n >= len(p.r.src) || isShellMeta(p.r.peekAt(n))
+}
+
+func (p *shParser) skipBlanks() {
+	for !p.r.eof() {
+		switch c := p.r.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.r.next()
+		case c == '\\' && p.r.peekAt(1) == '\n':
+			p.r.skip(2)
+		default:
+			return
+		}
+	}
+}
+
+func (p *shParser) skipBlanksAndNewlines() {
+	for {
+		p.skipBlanks()
+		if p.r.peek() != '\n' {
+			return
+		}
+		p.r.next()
+		p.readHeredocs()
+	}
+}
+
+// atRedirect reports whether a redirection operator starts here.
+func (p *shParser) atRedirect() bool {
+	i := 0
+	for isDigit(p.r.peekAt(i)) {
+		i++
+	}
+	c := p.r.peekAt(i)
+	return (c == '<' || c == '>') && p.r.peekAt(i+1) != '('
+}
+
+var shRedirectOps = []string{"<<<", "<<-", "<<", "<>", "<&", "<", ">>", ">|", ">&", ">", "&>>", "&>"}
+
+func (p *shParser) readRedirect(b *shBuilder) {
+	for isDigit(p.r.peek()) {
+		p.r.next()
+	}
+	op := ""
+	for _, o := range shRedirectOps {
+		if p.r.hasPrefix(o) {
+			op = o
+			break
+		}
+	}
+	p.r.skip(len(op))
+	p.skipBlanks()
+	if p.r.eof() || isShellMeta(p.r.peek()) {
+		p.s.errorf(p.r.pos(), "missing redirection target")
+		return
+	}
+	redirect := Redirect{Op: op, Target: p.readWord()}
+	if op == "<<<" {
+		redirect.Body = redirect.Target.Text
+	}
+	b.cmd.Redirects = append(b.cmd.Redirects, redirect)
+	if op == "<<" || op == "<<-" {
+		p.heredocs = append(p.heredocs, pendingHeredoc{
+			cmd:   b.cmd,
+			index: len(b.cmd.Redirects) - 1,
+			delim: redirect.Target.Text,
+			strip: op == "<<-",
+		})
+	}
+}
+
+// readHeredocs reads the bodies of here-documents begun on the line just
+// ended.
+func (p *shParser) readHeredocs() {
+	pending := p.heredocs
+	p.heredocs = nil
+	for _, h := range pending {
+		pos := p.r.pos()
+		var body strings.Builder
+		found := false
+		for !p.r.eof() {
+			start := p.r.i
+			p.r.skipLine()
+			line := p.r.since(start)
+			if !p.r.eof() {
+				p.r.next()
+			}
+			if h.strip {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if strings.TrimSuffix(line, "\r") == h.delim {
+				found = true
+				break
+			}
+			body.WriteString(line)
+			body.WriteByte('\n')
+		}
+		if !found {
+			p.s.errorf(pos, "unterminated here-document")
+		}
+		h.cmd.Redirects[h.index].Body = body.String()
+		// The body reaches a shell directly or through a pipe, as in
+		// cat <<EOF | bash.
+		feedsShell := stdinShell(h.cmd)
+		for _, c := range p.s.Commands {
+			feedsShell = feedsShell || c.PipedFrom == h.cmd && stdinShell(c)
+		}
+		if feedsShell {
+			p.s.merge(parse(Shell, body.String(), pos, p.depth+1))
+		}
+	}
+}
+
+// readWord reads one word, removing quotes and expanding known variables.
+func (p *shParser) readWord() Word {
+	w := Word{Pos: p.r.pos()}
+	var sb strings.Builder
+	for !p.r.eof() {
+		c := p.r.peek()
+		switch {
+		case (c == '<' || c == '>') && p.r.peekAt(1) == '(' && sb.Len() == 0:
+			// Process substitution.
+			start := p.r.i
+			p.r.skip(2)
+			p.substitute(&w)
+			sb.WriteString(p.r.since(start))
+		case c == '(' && sb.Len() > 0 && strings.HasSuffix(sb.String(), "="):
+			// Array assignment.
+			start := p.r.i
+			p.r.next()
+			p.skipBalanced()
+			sb.WriteString(p.r.since(start))
+		case isShellMeta(c):
+			w.Text = sb.String()
+			return w
+		case c == '\'':
+			p.r.next()
+			markText(p.r, &w, &sb)
+			p.readSingle(&sb)
+		case c == '"':
+			p.r.next()
+			markText(p.r, &w, &sb)
+			p.readDouble(&sb, &w)
+		case c == '\\':
+			p.r.next()
+			if p.r.eof() {
+				break
+			}
+			if n := p.r.next(); n != '\n' {
+				sb.WriteRune(n)
+			}
+		case c == '$':
+			p.readDollar(&sb, &w, false)
+		case c == '`':
+			p.readBacktick(&sb, &w)
+		default:
+			sb.WriteRune(p.r.next())
+		}
+	}
+	w.Text = sb.String()
+	return w
+}
+
+func (p *shParser) readSingle(sb *strings.Builder) {
+	for !p.r.eof() {
+		c := p.r.next()
+		if c == '\'' {
+			return
+		}
+		sb.WriteRune(c)
+	}
+	p.s.errorf(p.r.pos(), "unterminated quoted string")
+}
+
+func (p *shParser) readDouble(sb *strings.Builder, w *Word) {
+	for !p.r.eof() {
+		switch c := p.r.peek(); c {
+		case '"':
+			p.r.next()
+			return
+		case '\\':
+			p.r.next()
+			switch n := p.r.peek(); n {
+			case '$', '`', '"', '\\':
+				sb.WriteRune(p.r.next())
+			case '\n':
+				p.r.next()
+			default:
+				sb.WriteRune('\\')
+			}
+		case '$':
+			p.readDollar(sb, w, true)
+		case '`':
+			p.readBacktick(sb, w)
+		default:
+			sb.WriteRune(p.r.next())
+		}
+	}
+	p.s.errorf(p.r.pos(), "unterminated quoted string")
+}
+
+// readDollar reads an expansion starting with $. Expansions that cannot
+// be resolved keep their source text and make the word dynamic.
+func (p *shParser) readDollar(sb *strings.Builder, w *Word, quoted bool) {
+	start := p.r.i
+	p.r.next()
+	switch c := p.r.peek(); {
+	case c == '\'' && !quoted:
+		p.r.next()
+		sb.WriteString(p.readANSIC())
+	case c == '"' && !quoted:
+		p.r.next()
+		p.readDouble(sb, w)
+	case c == '(' && p.r.peekAt(1) == '(':
+		p.r.skip(2)
+		p.skipArithmetic()
+		sb.WriteString(p.r.since(start))
+		w.Dynamic = true
+	case c == '(':
+		p.r.next()
+		p.substitute(w)
+		sb.WriteString(p.r.since(start))
+	case c == '{':
+		p.r.next()
+		p.skipBalancedBraces()
+		name := strings.TrimSuffix(p.r.since(start+2), "}")
+		p.expand(sb, w, name, p.r.since(start))
+	case isNameStart(c):
+		for isNameChar(p.r.peek()) {
+			p.r.next()
+		}
+		p.expand(sb, w, p.r.since(start+1), p.r.since(start))
+	case isDigit(c) || strings.ContainsRune("@*#?$!-", c) && c != 0:
+		p.r.next()
+		sb.WriteString(p.r.since(start))
+		w.Dynamic = true
+	default:
+		sb.WriteRune('$')
+	}
+}
+
+// expand writes the value of a variable, or its source text if unknown.
+func (p *shParser) expand(sb *strings.Builder, w *Word, name, source string) {
+	if v, ok := p.vars[name]; ok {
+		sb.WriteString(v)
+		return
+	}
+	sb.WriteString(source)
+	w.Dynamic = true
+}
+
+// substitute parses the commands of a $( ) or <( ) substitution whose
+// opening has been consumed.
+func (p *shParser) substitute(w *Word) {
+	before := len(p.s.Commands)
+	p.group(stopParen, p.r.pos())
+	w.Commands = append(w.Commands, p.s.Commands[before:]...)
+	w.Dynamic = true
+}
+
+func (p *shParser) readBacktick(sb *strings.Builder, w *Word) {
+	start := p.r.i
+	p.r.next()
+	pos := p.r.pos()
+	var inner strings.Builder
+	closed := false
+	for !p.r.eof() {
+		c := p.r.next()
+		if c == '`' {
+			closed = true
+			break
+		}
+		if c == '\\' && strings.ContainsRune("`\\$", p.r.peek()) && !p.r.eof() {
+			c = p.r.next()
+		}
+		inner.WriteRune(c)
+	}
+	if !closed {
+		p.s.errorf(pos, "unterminated backquote")
+	}
+	sub := &shParser{r: newReader(inner.String(), pos), s: p.s, depth: p.depth, vars: p.vars, fn: p.fn}
+	before := len(p.s.Commands)
+	sub.parseList(stopEOF)
+	w.Commands = append(w.Commands, p.s.Commands[before:]...)
+	w.Dynamic = true
+	sb.WriteString(p.r.since(start))
+}
+
+// skipBalanced skips to the ) matching an already consumed (.
+func (p *shParser) skipBalanced() {
+	depth := 1
+	for !p.r.eof() {
+		switch p.r.next() {
+		case '\\':
+			p.r.skip(1)
+		case '\'':
+			p.readSingle(&strings.Builder{})
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return
+			}
+		}
+	}
+	p.s.errorf(p.r.pos(), "missing )")
+}
+
+// skipBalancedBraces skips to the } matching an already consumed {.
+func (p *shParser) skipBalancedBraces() {
+	depth := 1
+	for !p.r.eof() {
+		switch p.r.next() {
+		case '\\':
+			p.r.skip(1)
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return
+			}
+		}
+	}
+	p.s.errorf(p.r.pos(), "missing }")
+}
+
+// readANSIC reads the rest of a $'...' string, decoding escapes.
+func (p *shParser) readANSIC() string {
+	var sb strings.Builder
+	for !p.r.eof() {
+		c := p.r.next()
+		if c == '\'' {
+			return sb.String()
+		}
+		if c != '\\' || p.r.eof() {
+			sb.WriteRune(c)
+			continue
+		}
+		switch e := p.r.next(); e {
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'e', 'E':
+			sb.WriteByte(0x1b)
+		case 'f':
+			sb.WriteByte('\f')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		case 'v':
+			sb.WriteByte('\v')
+		case 'x':
+			sb.WriteRune(p.readCode(2))
+		case 'u':
+			sb.WriteRune(p.readCode(4))
+		case 'U':
+			sb.WriteRune(p.readCode(8))
+		case 'c':
+			if !p.r.eof() {
+				sb.WriteRune(p.r.next() & 0x1f)
+			}
+		default:
+			if e >= '0' && e <= '7' {
+				digits := string(e)
+				for len(digits) < 3 && p.r.peek() >= '0' && p.r.peek() <= '7' {
+					digits += string(p.r.next())
+				}
+				n, _ := strconv.ParseUint(digits, 8, 8)
+				sb.WriteByte(byte(n))
+			} else {
+				sb.WriteRune(e)
+			}
+		}
+	}
+	p.s.errorf(p.r.pos(), "unterminated quoted string")
+	return sb.String()
+}
+
+// readCode reads up to max hexadecimal digits and returns the character.
+func (p *shParser) readCode(max int) rune {
+	digits := ""
+	for len(digits) < max && !p.r.eof() && strings.ContainsRune("0123456789abcdefABCDEF", p.r.peek()) {
+		digits += string(p.r.next())
+	}
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil {
+		return '?'
+	}
+	return rune(n)
+}
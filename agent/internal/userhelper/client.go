@@ -225,6 +225,9 @@ func (c *Client) commandLoop() error {
 		case ipc.TypeTrayUpdate:
 			go c.handleTrayUpdate(env)
 
+		case ipc.TypeConsentRequest:
+			go c.handleConsent(env)
+
 		case ipc.TypeDesktopStart:
 			go c.handleDesktopStart(env)
 
@@ -450,6 +453,25 @@ func (c *Client) handleNotify(env *ipc.Envelope) {
 	}
 }
 
+func (c *Client) handleConsent(env *ipc.Envelope) {
+	var req ipc.ConsentRequest
+	if err := json.Unmarshal(env.Payload, &req); err != nil {
+		log.Warn("invalid consent payload", "error", err)
+		if sendErr := c.conn.SendError(env.ID, ipc.TypeConsentResult, fmt.Sprintf("invalid payload: %v", err)); sendErr != nil {
+			log.Warn("failed to send consent error", "error", sendErr)
+		}
+		return
+	}
+
+	granted := promptConsent(req)
+	log.Info("consent prompt answered", "commandType", req.CommandType, "granted", granted)
+	if err := c.conn.SendTyped(env.ID, ipc.TypeConsentResult, ipc.ConsentResult{
+		Granted: granted,
+	}); err != nil {
+		log.Warn("failed to send consent result", "id", env.ID, "error", err)
+	}
+}
+
 func (c *Client) handleTrayUpdate(env *ipc.Envelope) {
 	var update ipc.TrayUpdate
 	if err := json.Unmarshal(env.Payload, &update); err != nil {
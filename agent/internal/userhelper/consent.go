@@ -0,0 +1,17 @@
+package userhelper
+
+import (
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/ipc"
+)
+
+// promptConsent asks the logged-in user to allow a command. Platform-specific.
+// Returns true only if the user explicitly allowed it; a dismissed, timed
+// out or failed prompt counts as a denial.
+func promptConsent(req ipc.ConsentRequest) bool {
+	if req.TimeoutSeconds <= 0 {
+		req.TimeoutSeconds = 60
+	}
+	return promptConsentOS(req, time.Duration(req.TimeoutSeconds)*time.Second)
+}
@@ -0,0 +1,29 @@
+//go:build darwin
+
+package userhelper
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/ipc"
+)
+
+// promptConsentOS shows an AppleScript dialog that defaults to Deny.
+func promptConsentOS(req ipc.ConsentRequest, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+5*time.Second)
+	defer cancel()
+
+	script := fmt.Sprintf(`display dialog "%s" with title "%s" buttons {"Deny", "Allow"} default button "Deny" cancel button "Deny" giving up after %d`,
+		escapeAppleScript(req.Body), escapeAppleScript(req.Title), int(timeout.Seconds()))
+	out, err := exec.CommandContext(ctx, "osascript", "-e", script).Output()
+	if err != nil {
+		// Deny (the cancel button) exits non-zero.
+		return false
+	}
+	result := string(out)
+	return strings.Contains(result, "button returned:Allow") && !strings.Contains(result, "gave up:true")
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package userhelper
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/ipc"
+)
+
+// promptConsentOS shows a yes/no dialog with zenity, falling back to kdialog.
+func promptConsentOS(req ipc.ConsentRequest, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+5*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if path, err := exec.LookPath("zenity"); err == nil {
+		cmd = exec.CommandContext(ctx, path, "--question",
+			"--title", req.Title,
+			"--text", req.Body,
+			"--ok-label", "Allow",
+			"--cancel-label", "Deny",
+			"--timeout", strconv.Itoa(int(timeout.Seconds())))
+	} else if path, err := exec.LookPath("kdialog"); err == nil {
+		cmd = exec.CommandContext(ctx, path, "--title", req.Title, "--yesno", req.Body,
+			"--yes-label", "Allow", "--no-label", "Deny")
+	} else {
+		log.Warn("no dialog tool (zenity or kdialog) available for consent prompt")
+		return false
+	}
+
+	// Both tools exit 0 only when the user chose Allow.
+	return cmd.Run() == nil
+}
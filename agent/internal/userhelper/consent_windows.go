@@ -0,0 +1,40 @@
+//go:build windows
+
+package userhelper
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/breeze-rmm/agent/internal/ipc"
+)
+
+// promptConsentOS shows a Yes/No message box that closes itself after the
+// timeout. Title and body reach the script through environment variables so
+// server-supplied text is never parsed as PowerShell.
+func promptConsentOS(req ipc.ConsentRequest, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+5*time.Second)
+	defer cancel()
+
+	// 4 = Yes/No buttons, 32 = question icon, 256 = No is the default.
+	// Popup returns 6 for Yes and -1 when the timeout expires.
+	script := `$shell = New-Object -ComObject WScript.Shell
+$shell.Popup($env:BREEZE_CONSENT_BODY, [int]$env:BREEZE_CONSENT_TIMEOUT, $env:BREEZE_CONSENT_TITLE, 4 + 32 + 256)`
+
+	cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Env = append(os.Environ(),
+		"BREEZE_CONSENT_TITLE="+req.Title,
+		"BREEZE_CONSENT_BODY="+req.Body,
+		"BREEZE_CONSENT_TIMEOUT="+strconv.Itoa(int(timeout.Seconds())),
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		log.Warn("consent prompt failed", "error", err)
+		return false
+	}
+	return strings.TrimSpace(string(out)) == "6"
+}
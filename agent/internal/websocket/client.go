@@ -12,6 +12,7 @@ import (
 
 	"github.com/gorilla/websocket"
 
+	"github.com/breeze-rmm/agent/internal/cmdsign"
 	"github.com/breeze-rmm/agent/internal/logging"
 	"github.com/breeze-rmm/agent/internal/secmem"
 )
@@ -39,9 +40,10 @@ type Config struct {
 
 // Command represents a command received via WebSocket
 type Command struct {
-	ID      string         `json:"id"`
-	Type    string         `json:"type"`
-	Payload map[string]any `json:"payload"`
+	ID        string             `json:"id"`
+	Type      string             `json:"type"`
+	Payload   map[string]any     `json:"payload"`
+	Signature *cmdsign.Signature `json:"signature,omitempty"`
 }
 
 // CommandResult represents the result of a command execution
@@ -51,6 +53,7 @@ type CommandResult struct {
 	Status    string `json:"status"`
 	Result    any    `json:"result,omitempty"`
 	Error     string `json:"error,omitempty"`
+	Code      string `json:"code,omitempty"`
 }
 
 // CommandHandler processes commands received via WebSocket
@@ -418,6 +421,53 @@ func (c *Client) SendPatchProgress(commandID string, event any) error {
 	}
 }
 
+// SendBackupProgress sends a backup restore progress event to the server.
+// Non-blocking: drops if send channel is full.
+func (c *Client) SendBackupProgress(commandID string, event any) error {
+	msg := map[string]any{
+		"type":      "backup_progress",
+		"commandId": commandID,
+		"progress":  event,
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup progress: %w", err)
+	}
+
+	select {
+	case c.sendChan <- msgBytes:
+		return nil
+	case <-c.done:
+		return fmt.Errorf("client is stopped")
+	default:
+		return fmt.Errorf("send channel full, dropping progress")
+	}
+}
+
+// SendScriptOutput streams a chunk of output from a running script to the
+// server. Non-blocking: drops if send channel is full; the chunk's sequence
+// number lets the server detect the gap.
+func (c *Client) SendScriptOutput(commandID string, chunk any) error {
+	msg := map[string]any{
+		"type":      "script_output",
+		"commandId": commandID,
+		"output":    chunk,
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal script output: %w", err)
+	}
+
+	select {
+	case c.sendChan <- msgBytes:
+		return nil
+	case <-c.done:
+		return fmt.Errorf("client is stopped")
+	default:
+		return fmt.Errorf("send channel full, dropping script output")
+	}
+}
+
 // SendTerminalOutput sends terminal output data to the server
 func (c *Client) SendTerminalOutput(sessionId string, data []byte) error {
 	msg := map[string]any{
@@ -49,13 +49,21 @@ type MtlsCertData struct {
 	SerialNumber string `json:"serialNumber"`
 }
 
+// CommandSigningData carries the org command signing key pinned at
+// enrollment.
+type CommandSigningData struct {
+	PublicKey string `json:"publicKey"`
+	Required  bool   `json:"required"`
+}
+
 type EnrollResponse struct {
-	AgentID   string        `json:"agentId"`
-	AuthToken string        `json:"authToken"`
-	OrgID     string        `json:"orgId"`
-	SiteID    string        `json:"siteId"`
-	Config    AgentConfig   `json:"config"`
-	Mtls      *MtlsCertData `json:"mtls"`
+	AgentID        string              `json:"agentId"`
+	AuthToken      string              `json:"authToken"`
+	OrgID          string              `json:"orgId"`
+	SiteID         string              `json:"siteId"`
+	Config         AgentConfig         `json:"config"`
+	Mtls           *MtlsCertData       `json:"mtls"`
+	CommandSigning *CommandSigningData `json:"commandSigning,omitempty"`
 }
 
 type RenewCertResponse struct {
@@ -0,0 +1,51 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS device_command_artifacts (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  command_id uuid NOT NULL REFERENCES device_commands(id),
+  device_id uuid NOT NULL REFERENCES devices(id),
+  org_id uuid NOT NULL REFERENCES organizations(id),
+  name varchar(1024) NOT NULL,
+  size bigint NOT NULL,
+  sha256 varchar(64) NOT NULL,
+  storage_key varchar(255) NOT NULL,
+  created_at timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT device_command_artifacts_command_name_uniq UNIQUE (command_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS device_command_artifacts_command_id_idx
+  ON device_command_artifacts (command_id);
+
+CREATE INDEX IF NOT EXISTS device_command_artifacts_org_id_idx
+  ON device_command_artifacts (org_id);
+
+ALTER TABLE device_command_artifacts ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_command_artifacts FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS breeze_org_isolation_select ON device_command_artifacts;
+DROP POLICY IF EXISTS breeze_org_isolation_insert ON device_command_artifacts;
+DROP POLICY IF EXISTS breeze_org_isolation_update ON device_command_artifacts;
+DROP POLICY IF EXISTS breeze_org_isolation_delete ON device_command_artifacts;
+
+CREATE POLICY breeze_org_isolation_select
+  ON device_command_artifacts
+  FOR SELECT
+  USING (public.breeze_has_org_access(org_id));
+
+CREATE POLICY breeze_org_isolation_insert
+  ON device_command_artifacts
+  FOR INSERT
+  WITH CHECK (public.breeze_has_org_access(org_id));
+
+CREATE POLICY breeze_org_isolation_update
+  ON device_command_artifacts
+  FOR UPDATE
+  USING (public.breeze_has_org_access(org_id))
+  WITH CHECK (public.breeze_has_org_access(org_id));
+
+CREATE POLICY breeze_org_isolation_delete
+  ON device_command_artifacts
+  FOR DELETE
+  USING (public.breeze_has_org_access(org_id));
+
+COMMIT;
@@ -0,0 +1,53 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS device_scheduled_job_runs (
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  device_id uuid NOT NULL REFERENCES devices(id),
+  org_id uuid NOT NULL REFERENCES organizations(id),
+  job_id varchar(255) NOT NULL,
+  run_id varchar(320) NOT NULL,
+  scheduled_at timestamp NOT NULL,
+  started_at timestamp,
+  missed boolean NOT NULL DEFAULT false,
+  status varchar(20) NOT NULL,
+  result jsonb,
+  created_at timestamp NOT NULL DEFAULT now(),
+  CONSTRAINT device_scheduled_job_runs_device_run_uniq UNIQUE (device_id, run_id)
+);
+
+CREATE INDEX IF NOT EXISTS device_scheduled_job_runs_device_job_idx
+  ON device_scheduled_job_runs (device_id, job_id, scheduled_at);
+
+CREATE INDEX IF NOT EXISTS device_scheduled_job_runs_org_id_idx
+  ON device_scheduled_job_runs (org_id);
+
+ALTER TABLE device_scheduled_job_runs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_scheduled_job_runs FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS breeze_org_isolation_select ON device_scheduled_job_runs;
+DROP POLICY IF EXISTS breeze_org_isolation_insert ON device_scheduled_job_runs;
+DROP POLICY IF EXISTS breeze_org_isolation_update ON device_scheduled_job_runs;
+DROP POLICY IF EXISTS breeze_org_isolation_delete ON device_scheduled_job_runs;
+
+CREATE POLICY breeze_org_isolation_select
+  ON device_scheduled_job_runs
+  FOR SELECT
+  USING (public.breeze_has_org_access(org_id));
+
+CREATE POLICY breeze_org_isolation_insert
+  ON device_scheduled_job_runs
+  FOR INSERT
+  WITH CHECK (public.breeze_has_org_access(org_id));
+
+CREATE POLICY breeze_org_isolation_update
+  ON device_scheduled_job_runs
+  FOR UPDATE
+  USING (public.breeze_has_org_access(org_id))
+  WITH CHECK (public.breeze_has_org_access(org_id));
+
+CREATE POLICY breeze_org_isolation_delete
+  ON device_scheduled_job_runs
+  FOR DELETE
+  USING (public.breeze_has_org_access(org_id));
+
+COMMIT;
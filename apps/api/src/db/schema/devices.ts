@@ -229,6 +229,42 @@ export const deviceCommands = pgTable('device_commands', {
   result: jsonb('result')
 });
 
+// Files a script declared as output artifacts, uploaded after it ran.
+export const deviceCommandArtifacts = pgTable('device_command_artifacts', {
+  id: uuid('id').primaryKey().defaultRandom(),
+  commandId: uuid('command_id').notNull().references(() => deviceCommands.id),
+  deviceId: uuid('device_id').notNull().references(() => devices.id),
+  orgId: uuid('org_id').notNull().references(() => organizations.id),
+  name: varchar('name', { length: 1024 }).notNull(),
+  size: bigint('size', { mode: 'number' }).notNull(),
+  sha256: varchar('sha256', { length: 64 }).notNull(),
+  storageKey: varchar('storage_key', { length: 255 }).notNull(),
+  createdAt: timestamp('created_at').defaultNow().notNull()
+}, (table) => ({
+  commandIdx: index('device_command_artifacts_command_id_idx').on(table.commandId),
+  orgIdIdx: index('device_command_artifacts_org_id_idx').on(table.orgId),
+  commandNameUnique: unique('device_command_artifacts_command_name_uniq').on(table.commandId, table.name)
+}));
+
+// One row per run of a job the agent schedules itself (schedule_command).
+export const deviceScheduledJobRuns = pgTable('device_scheduled_job_runs', {
+  id: uuid('id').primaryKey().defaultRandom(),
+  deviceId: uuid('device_id').notNull().references(() => devices.id),
+  orgId: uuid('org_id').notNull().references(() => organizations.id),
+  jobId: varchar('job_id', { length: 255 }).notNull(),
+  runId: varchar('run_id', { length: 320 }).notNull(),
+  scheduledAt: timestamp('scheduled_at').notNull(),
+  startedAt: timestamp('started_at'),
+  missed: boolean('missed').notNull().default(false),
+  status: varchar('status', { length: 20 }).notNull(),
+  result: jsonb('result'),
+  createdAt: timestamp('created_at').defaultNow().notNull()
+}, (table) => ({
+  deviceJobIdx: index('device_scheduled_job_runs_device_job_idx').on(table.deviceId, table.jobId, table.scheduledAt),
+  orgIdIdx: index('device_scheduled_job_runs_org_id_idx').on(table.orgId),
+  deviceRunUnique: unique('device_scheduled_job_runs_device_run_uniq').on(table.deviceId, table.runId)
+}));
+
 export const connectionProtocolEnum = pgEnum('connection_protocol', ['tcp', 'tcp6', 'udp', 'udp6']);
 
 export const deviceConnections = pgTable('device_connections', {
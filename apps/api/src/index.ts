@@ -213,6 +213,10 @@ app.use('*', async (c, next) => {
   if (c.req.path.startsWith('/api/v1/dev/push')) {
     return bodyLimit({ maxSize: 150 * 1024 * 1024, onError: (ctx) => ctx.json({ error: 'Binary too large (max 150MB)' }, 413) })(c, next);
   }
+  // Script artifact uploads are streamed to disk and capped by the route.
+  if (/^\/api\/v1\/agents\/[^/]+\/commands\/[^/]+\/artifacts$/.test(c.req.path)) {
+    return next();
+  }
   return bodyLimit({ maxSize: 1024 * 1024, onError: (ctx) => ctx.json({ error: 'Request body too large' }, 413) })(c, next);
 });
 app.use('*', globalRateLimit());
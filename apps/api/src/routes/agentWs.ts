@@ -52,6 +52,7 @@ const commandResultSchema = z.object({
   stderr: z.string().max(5_000_000).optional(),
   durationMs: z.number().int().optional(),
   error: z.string().max(10_000).optional(),
+  code: z.enum(['denied', 'interrupted']).optional(),
   result: z.any().optional()
 });
 
@@ -514,7 +515,8 @@ async function processCommandResult(
             stdout,
             stderr: result.stderr,
             durationMs: result.durationMs,
-            error: result.error
+            error: result.error,
+            code: result.code
           }
         })
         .where(
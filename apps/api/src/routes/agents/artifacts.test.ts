@@ -0,0 +1,115 @@
+import { beforeEach, describe, expect, it, vi } from 'vitest';
+import { Hono } from 'hono';
+
+vi.mock('../../db', () => ({
+  db: {
+    select: vi.fn(),
+    insert: vi.fn(),
+  },
+  runOutsideDbContext: vi.fn((fn) => fn()),
+}));
+
+vi.mock('../../db/schema', () => ({
+  deviceCommands: { id: 'id', deviceId: 'deviceId' },
+  deviceCommandArtifacts: { commandId: 'commandId', name: 'name' }
+}));
+
+vi.mock('../../services/artifactStorage', () => {
+  class ArtifactRejectedError extends Error {}
+  return {
+    ArtifactRejectedError,
+    MAX_ARTIFACT_SIZE_BYTES: 1024,
+    saveArtifact: vi.fn(),
+  };
+});
+
+import { db } from '../../db';
+import { ArtifactRejectedError, saveArtifact } from '../../services/artifactStorage';
+import { artifactsRoutes } from './artifacts';
+
+const COMMAND_ID = '11111111-1111-1111-1111-111111111111';
+const SHA256 = 'a'.repeat(64);
+
+function mockCommandLookup(commands: { id: string }[]) {
+  vi.mocked(db.select).mockReturnValueOnce({
+    from: vi.fn().mockReturnValue({
+      where: vi.fn().mockReturnValue({
+        limit: vi.fn().mockResolvedValue(commands)
+      })
+    })
+  } as any);
+}
+
+function mockUpsert() {
+  const values = vi.fn().mockReturnValue({
+    onConflictDoUpdate: vi.fn().mockResolvedValue(undefined)
+  });
+  vi.mocked(db.insert).mockReturnValue({ values } as any);
+  return values;
+}
+
+function upload(headers: Record<string, string> = {}) {
+  return {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/octet-stream', 'X-Artifact-SHA256': SHA256, ...headers },
+    body: 'report contents'
+  };
+}
+
+describe('agent artifact upload', () => {
+  let app: Hono;
+
+  beforeEach(() => {
+    vi.clearAllMocks();
+    app = new Hono();
+    app.use('*', async (c: any, next: any) => {
+      c.set('agent', { orgId: 'org-1', agentId: 'agent-1', deviceId: 'device-1' });
+      await next();
+    });
+    app.route('/agents', artifactsRoutes);
+  });
+
+  it('stores the artifact and records it against the command', async () => {
+    mockCommandLookup([{ id: COMMAND_ID }]);
+    vi.mocked(saveArtifact).mockResolvedValue({ size: 15, storageKey: `${COMMAND_ID}/${SHA256}` });
+    const values = mockUpsert();
+
+    const res = await app.request(`/agents/agent-1/commands/${COMMAND_ID}/artifacts?name=out%2Freport.txt`, upload());
+
+    expect(res.status).toBe(200);
+    expect(saveArtifact).toHaveBeenCalledWith(COMMAND_ID, SHA256, expect.anything());
+    expect(values).toHaveBeenCalledWith(expect.objectContaining({
+      commandId: COMMAND_ID,
+      deviceId: 'device-1',
+      orgId: 'org-1',
+      name: 'out/report.txt',
+      size: 15
+    }));
+  });
+
+  it('rejects uploads for commands of another device', async () => {
+    mockCommandLookup([]);
+
+    const res = await app.request(`/agents/agent-1/commands/${COMMAND_ID}/artifacts?name=report.txt`, upload());
+
+    expect(res.status).toBe(404);
+    expect(saveArtifact).not.toHaveBeenCalled();
+  });
+
+  it('requires a SHA-256 digest', async () => {
+    const res = await app.request(`/agents/agent-1/commands/${COMMAND_ID}/artifacts?name=report.txt`, upload({ 'X-Artifact-SHA256': 'abc' }));
+
+    expect(res.status).toBe(400);
+    expect(db.select).not.toHaveBeenCalled();
+  });
+
+  it('reports a checksum mismatch without recording the artifact', async () => {
+    mockCommandLookup([{ id: COMMAND_ID }]);
+    vi.mocked(saveArtifact).mockRejectedValue(new ArtifactRejectedError('Artifact checksum mismatch'));
+
+    const res = await app.request(`/agents/agent-1/commands/${COMMAND_ID}/artifacts?name=report.txt`, upload());
+
+    expect(res.status).toBe(400);
+    expect(db.insert).not.toHaveBeenCalled();
+  });
+});
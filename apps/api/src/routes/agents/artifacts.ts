@@ -0,0 +1,98 @@
+import { Hono } from 'hono';
+import { zValidator } from '@hono/zod-validator';
+import { z } from 'zod';
+import { and, eq } from 'drizzle-orm';
+import { db, runOutsideDbContext } from '../../db';
+import { deviceCommandArtifacts, deviceCommands } from '../../db/schema';
+import { ArtifactRejectedError, MAX_ARTIFACT_SIZE_BYTES, saveArtifact } from '../../services/artifactStorage';
+
+const artifactParamSchema = z.object({
+  id: z.string().min(1),
+  commandId: z.string().uuid()
+});
+
+const artifactQuerySchema = z.object({
+  name: z.string().min(1).max(1024)
+});
+
+const sha256Regex = /^[0-9a-f]{64}$/i;
+
+export const artifactsRoutes = new Hono();
+
+// Output artifacts declared by a script, streamed up by the agent one file
+// per request once the script has finished.
+artifactsRoutes.post(
+  '/:id/commands/:commandId/artifacts',
+  zValidator('param', artifactParamSchema),
+  zValidator('query', artifactQuerySchema),
+  async (c) => {
+    const { commandId } = c.req.valid('param');
+    const { name } = c.req.valid('query');
+    const agent = c.get('agent') as { orgId?: string; agentId?: string; deviceId?: string } | undefined;
+
+    if (!agent?.deviceId || !agent.orgId) {
+      return c.json({ error: 'Agent context not found' }, 401);
+    }
+
+    const sha256 = c.req.header('x-artifact-sha256') ?? '';
+    if (!sha256Regex.test(sha256)) {
+      return c.json({ error: 'X-Artifact-SHA256 header must be a hex SHA-256 digest' }, 400);
+    }
+    const declaredSize = Number(c.req.header('content-length') ?? '0');
+    if (declaredSize > MAX_ARTIFACT_SIZE_BYTES) {
+      return c.json({ error: `Artifact exceeds ${MAX_ARTIFACT_SIZE_BYTES} bytes` }, 413);
+    }
+    const body = c.req.raw.body;
+    if (!body) {
+      return c.json({ error: 'Artifact body is empty' }, 400);
+    }
+
+    // device_commands has no RLS; see the command result route.
+    const [command] = await runOutsideDbContext(() =>
+      db
+        .select({ id: deviceCommands.id })
+        .from(deviceCommands)
+        .where(
+          and(
+            eq(deviceCommands.id, commandId),
+            eq(deviceCommands.deviceId, agent.deviceId!)
+          )
+        )
+        .limit(1)
+    );
+
+    if (!command) {
+      return c.json({ error: 'Command not found' }, 404);
+    }
+
+    let stored: { size: number; storageKey: string };
+    try {
+      stored = await saveArtifact(commandId, sha256, body);
+    } catch (err) {
+      if (err instanceof ArtifactRejectedError) {
+        return c.json({ error: err.message }, 400);
+      }
+      console.error(`[agents] failed to store artifact ${name} for command ${commandId}:`, err);
+      return c.json({ error: 'Failed to store artifact' }, 500);
+    }
+
+    const values = {
+      commandId,
+      deviceId: agent.deviceId,
+      orgId: agent.orgId,
+      name,
+      size: stored.size,
+      sha256: sha256.toLowerCase(),
+      storageKey: stored.storageKey
+    };
+    await db
+      .insert(deviceCommandArtifacts)
+      .values(values)
+      .onConflictDoUpdate({
+        target: [deviceCommandArtifacts.commandId, deviceCommandArtifacts.name],
+        set: { size: values.size, sha256: values.sha256, storageKey: values.storageKey }
+      });
+
+    return c.json({ success: true, size: stored.size });
+  }
+);
@@ -83,7 +83,8 @@ commandsRoutes.post(
             stdout: data.stdout,
             stderr: data.stderr,
             durationMs: data.durationMs,
-            error: data.error
+            error: data.error,
+            code: data.code
           }
         })
         .where(eq(deviceCommands.id, commandId))
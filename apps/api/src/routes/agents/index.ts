@@ -17,6 +17,8 @@ import { bootPerformanceRoutes } from './bootPerformance';
 import { reliabilityRoutes } from './reliability';
 import { changesRoutes } from './changes';
 import { peripheralRoutes } from './peripherals';
+import { scheduledJobsRoutes } from './scheduledJobs';
+import { artifactsRoutes } from './artifacts';
 
 export const agentRoutes = new Hono();
 
@@ -64,3 +66,5 @@ agentRoutes.route('/', bootPerformanceRoutes);
 agentRoutes.route('/', reliabilityRoutes);
 agentRoutes.route('/', changesRoutes);
 agentRoutes.route('/', peripheralRoutes);
+agentRoutes.route('/', scheduledJobsRoutes);
+agentRoutes.route('/', artifactsRoutes);
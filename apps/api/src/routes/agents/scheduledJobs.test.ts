@@ -0,0 +1,111 @@
+import { beforeEach, describe, expect, it, vi } from 'vitest';
+import { Hono } from 'hono';
+
+vi.mock('../../db', () => ({
+  db: {
+    select: vi.fn(),
+    insert: vi.fn(),
+  }
+}));
+
+vi.mock('../../db/schema', () => ({
+  devices: { id: 'id', orgId: 'orgId', agentId: 'agentId' },
+  deviceScheduledJobRuns: { id: 'id', deviceId: 'deviceId', runId: 'runId' }
+}));
+
+import { db } from '../../db';
+import { scheduledJobsRoutes } from './scheduledJobs';
+
+function mockDeviceLookup(devices: { id: string; orgId: string }[]) {
+  vi.mocked(db.select).mockReturnValueOnce({
+    from: vi.fn().mockReturnValue({
+      where: vi.fn().mockReturnValue({
+        limit: vi.fn().mockResolvedValue(devices)
+      })
+    })
+  } as any);
+}
+
+function mockInsert(insertedRows: { id: string }[]) {
+  const values = vi.fn().mockReturnValue({
+    onConflictDoNothing: vi.fn().mockReturnValue({
+      returning: vi.fn().mockResolvedValue(insertedRows)
+    })
+  });
+  vi.mocked(db.insert).mockReturnValue({ values } as any);
+  return values;
+}
+
+function postRun(body: Record<string, unknown>) {
+  return {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({
+      runId: 'sched:inventory:1772445600',
+      scheduledAt: '2026-03-02T10:00:00Z',
+      startedAt: '2026-03-02T10:00:01Z',
+      result: { status: 'failed', error: 'collect_software is denied by local command policy', code: 'denied' },
+      ...body
+    })
+  };
+}
+
+describe('agent scheduled job runs', () => {
+  let app: Hono;
+
+  beforeEach(() => {
+    vi.clearAllMocks();
+    app = new Hono();
+    app.use('*', async (c: any, next: any) => {
+      c.set('agent', { orgId: 'org-1', agentId: 'agent-1' });
+      await next();
+    });
+    app.route('/agents', scheduledJobsRoutes);
+  });
+
+  it('records a run with its result', async () => {
+    mockDeviceLookup([{ id: 'device-1', orgId: 'org-1' }]);
+    const values = mockInsert([{ id: 'run-1' }]);
+
+    const res = await app.request('/agents/agent-1/scheduled-jobs/inventory/runs', postRun({ missed: true }));
+
+    expect(res.status).toBe(200);
+    expect(await res.json()).toEqual({ success: true, duplicate: false });
+    expect(values).toHaveBeenCalledWith(expect.objectContaining({
+      deviceId: 'device-1',
+      orgId: 'org-1',
+      jobId: 'inventory',
+      runId: 'sched:inventory:1772445600',
+      missed: true,
+      status: 'failed'
+    }));
+  });
+
+  it('acknowledges a redelivered run without inserting it twice', async () => {
+    mockDeviceLookup([{ id: 'device-1', orgId: 'org-1' }]);
+    mockInsert([]);
+
+    const res = await app.request('/agents/agent-1/scheduled-jobs/inventory/runs', postRun({}));
+
+    expect(res.status).toBe(200);
+    expect(await res.json()).toEqual({ success: true, duplicate: true });
+  });
+
+  it('rejects runs for a device in another organization', async () => {
+    mockDeviceLookup([{ id: 'device-1', orgId: 'org-2' }]);
+
+    const res = await app.request('/agents/agent-1/scheduled-jobs/inventory/runs', postRun({}));
+
+    expect(res.status).toBe(403);
+    expect(db.insert).not.toHaveBeenCalled();
+  });
+
+  it('rejects results with an unknown status', async () => {
+    const res = await app.request('/agents/agent-1/scheduled-jobs/inventory/runs', postRun({
+      result: { status: 'denied' }
+    }));
+
+    expect(res.status).toBe(400);
+    expect(db.select).not.toHaveBeenCalled();
+  });
+});
@@ -0,0 +1,69 @@
+import { Hono } from 'hono';
+import { zValidator } from '@hono/zod-validator';
+import { eq } from 'drizzle-orm';
+import { z } from 'zod';
+import { db } from '../../db';
+import { devices, deviceScheduledJobRuns } from '../../db/schema';
+import { commandResultSchema } from './schemas';
+
+const scheduledRunParamSchema = z.object({
+  id: z.string().min(1),
+  jobId: z.string().min(1).max(255)
+});
+
+const submitScheduledRunSchema = z.object({
+  runId: z.string().min(1).max(320),
+  scheduledAt: z.string().datetime({ offset: true }),
+  startedAt: z.string().datetime({ offset: true }).optional(),
+  missed: z.boolean().optional(),
+  result: commandResultSchema
+});
+
+export const scheduledJobsRoutes = new Hono();
+
+// Runs of jobs scheduled on the agent itself. The agent retries through its
+// outbox, so a run that is already recorded is acknowledged, not duplicated.
+scheduledJobsRoutes.post(
+  '/:id/scheduled-jobs/:jobId/runs',
+  zValidator('param', scheduledRunParamSchema),
+  zValidator('json', submitScheduledRunSchema),
+  async (c) => {
+    const { id: agentId, jobId } = c.req.valid('param');
+    const data = c.req.valid('json');
+    const agent = c.get('agent') as { orgId?: string; agentId?: string } | undefined;
+
+    const [device] = await db
+      .select({ id: devices.id, orgId: devices.orgId })
+      .from(devices)
+      .where(eq(devices.agentId, agentId))
+      .limit(1);
+
+    if (!device) {
+      return c.json({ error: 'Device not found' }, 404);
+    }
+
+    if (agent?.orgId && agent.orgId !== device.orgId) {
+      return c.json({ error: 'Organization mismatch' }, 403);
+    }
+
+    const inserted = await db
+      .insert(deviceScheduledJobRuns)
+      .values({
+        deviceId: device.id,
+        orgId: device.orgId,
+        jobId,
+        runId: data.runId,
+        scheduledAt: new Date(data.scheduledAt),
+        startedAt: data.startedAt ? new Date(data.startedAt) : null,
+        missed: data.missed ?? false,
+        status: data.result.status,
+        result: data.result
+      })
+      .onConflictDoNothing({
+        target: [deviceScheduledJobRuns.deviceId, deviceScheduledJobRuns.runId]
+      })
+      .returning({ id: deviceScheduledJobRuns.id });
+
+    return c.json({ success: true, duplicate: inserted.length === 0 });
+  }
+);
@@ -147,7 +147,9 @@ export const commandResultSchema = z.object({
   stdout: z.string().max(5_000_000).optional(),
   stderr: z.string().max(5_000_000).optional(),
   durationMs: z.number().int().optional(),
-  error: z.string().max(10_000).optional()
+  error: z.string().max(10_000).optional(),
+  // Why a failed command did not run to completion on the agent.
+  code: z.enum(['denied', 'interrupted']).optional()
 });
 
 // ============================================
@@ -2,12 +2,14 @@ import { Hono } from 'hono';
 import { zValidator } from '@hono/zod-validator';
 import { eq, sql, desc, and } from 'drizzle-orm';
 import { db } from '../../db';
-import { deviceCommands, devices } from '../../db/schema';
+import { deviceCommandArtifacts, deviceCommands, devices } from '../../db/schema';
 import { authMiddleware, requireScope, requirePermission } from '../../middleware/auth';
 import { PERMISSIONS } from '../../services/permissions';
 import { getPagination, getDeviceWithOrgCheck } from './helpers';
 import { createCommandSchema, bulkCommandSchema, maintenanceModeSchema } from './schemas';
 import { writeRouteAudit } from '../../services/auditEvents';
+import { getArtifactStream } from '../../services/artifactStorage';
+import { Readable } from 'stream';
 
 export const commandsRoutes = new Hono();
 
@@ -278,3 +280,85 @@ commandsRoutes.get(
     return c.json({ data: command });
   }
 );
+
+// GET /devices/:id/commands/:commandId/artifacts - List a script's uploaded artifacts
+commandsRoutes.get(
+  '/:id/commands/:commandId/artifacts',
+  requireScope('organization', 'partner', 'system'),
+  async (c) => {
+    const auth = c.get('auth');
+    const deviceId = c.req.param('id')!;
+    const commandId = c.req.param('commandId')!;
+
+    const device = await getDeviceWithOrgCheck(deviceId, auth);
+    if (!device) {
+      return c.json({ error: 'Device not found' }, 404);
+    }
+
+    const artifacts = await db
+      .select({
+        id: deviceCommandArtifacts.id,
+        name: deviceCommandArtifacts.name,
+        size: deviceCommandArtifacts.size,
+        sha256: deviceCommandArtifacts.sha256,
+        createdAt: deviceCommandArtifacts.createdAt
+      })
+      .from(deviceCommandArtifacts)
+      .where(
+        and(
+          eq(deviceCommandArtifacts.commandId, commandId),
+          eq(deviceCommandArtifacts.deviceId, deviceId)
+        )
+      )
+      .orderBy(deviceCommandArtifacts.name);
+
+    return c.json({ data: artifacts });
+  }
+);
+
+// GET /devices/:id/commands/:commandId/artifacts/:artifactId/download - Download an artifact
+commandsRoutes.get(
+  '/:id/commands/:commandId/artifacts/:artifactId/download',
+  requireScope('organization', 'partner', 'system'),
+  async (c) => {
+    const auth = c.get('auth');
+    const deviceId = c.req.param('id')!;
+    const commandId = c.req.param('commandId')!;
+    const artifactId = c.req.param('artifactId')!;
+
+    const device = await getDeviceWithOrgCheck(deviceId, auth);
+    if (!device) {
+      return c.json({ error: 'Device not found' }, 404);
+    }
+
+    const [artifact] = await db
+      .select()
+      .from(deviceCommandArtifacts)
+      .where(
+        and(
+          eq(deviceCommandArtifacts.id, artifactId),
+          eq(deviceCommandArtifacts.commandId, commandId),
+          eq(deviceCommandArtifacts.deviceId, deviceId)
+        )
+      )
+      .limit(1);
+
+    if (!artifact) {
+      return c.json({ error: 'Artifact not found' }, 404);
+    }
+
+    const file = getArtifactStream(artifact.storageKey);
+    if (!file) {
+      return c.json({ error: 'Artifact not found in storage' }, 404);
+    }
+
+    const fileName = artifact.name.split('/').pop() || artifact.name;
+    return new Response(Readable.toWeb(file.stream) as ReadableStream, {
+      headers: {
+        'Content-Type': 'application/octet-stream',
+        'Content-Disposition': `attachment; filename="${encodeURIComponent(fileName)}"`,
+        'Content-Length': String(file.size),
+      },
+    });
+  }
+);
@@ -0,0 +1,84 @@
+import { createHash, randomUUID } from 'crypto';
+import { createReadStream, createWriteStream, existsSync, mkdirSync, renameSync, statSync, unlinkSync } from 'fs';
+import { once } from 'events';
+import { finished } from 'stream/promises';
+import { join } from 'path';
+import type { Readable } from 'stream';
+
+const STORAGE_PATH = process.env.ARTIFACT_STORAGE_PATH || './data/artifacts';
+const MAX_ARTIFACT_SIZE_MB = parseInt(process.env.MAX_ARTIFACT_SIZE_MB || '256', 10);
+
+export const MAX_ARTIFACT_SIZE_BYTES = MAX_ARTIFACT_SIZE_MB * 1024 * 1024;
+
+/**
+ * Raised when an upload is refused because of its content rather than a
+ * storage failure.
+ */
+export class ArtifactRejectedError extends Error {}
+
+function artifactDir(commandId: string): string {
+  return join(STORAGE_PATH, commandId);
+}
+
+/**
+ * Stream an uploaded script artifact to storage, enforcing the size limit and
+ * checking the SHA-256 the agent computed. Files are stored by content hash,
+ * so the script-chosen name never becomes part of a path.
+ */
+export async function saveArtifact(
+  commandId: string,
+  expectedSha256: string,
+  body: ReadableStream<Uint8Array>
+): Promise<{ size: number; storageKey: string }> {
+  const dir = artifactDir(commandId);
+  if (!existsSync(dir)) {
+    mkdirSync(dir, { recursive: true });
+  }
+  const tmpPath = join(dir, `.upload-${randomUUID()}`);
+  const out = createWriteStream(tmpPath);
+  const hash = createHash('sha256');
+  let size = 0;
+
+  try {
+    const reader = body.getReader();
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      size += value.length;
+      if (size > MAX_ARTIFACT_SIZE_BYTES) {
+        await reader.cancel();
+        throw new ArtifactRejectedError(`Artifact exceeds ${MAX_ARTIFACT_SIZE_BYTES} bytes`);
+      }
+      hash.update(value);
+      if (!out.write(value)) {
+        await once(out, 'drain');
+      }
+    }
+    out.end();
+    await finished(out);
+
+    const digest = hash.digest('hex');
+    if (digest !== expectedSha256.toLowerCase()) {
+      throw new ArtifactRejectedError('Artifact checksum mismatch');
+    }
+    renameSync(tmpPath, join(dir, digest));
+    return { size, storageKey: `${commandId}/${digest}` };
+  } catch (err) {
+    out.destroy();
+    try {
+      unlinkSync(tmpPath);
+    } catch {
+      // Ignore
+    }
+    throw err;
+  }
+}
+
+/**
+ * Get a readable stream and size for a stored artifact.
+ */
+export function getArtifactStream(storageKey: string): { stream: Readable; size: number } | null {
+  const path = join(STORAGE_PATH, storageKey);
+  if (!existsSync(path)) return null;
+  return { stream: createReadStream(path), size: statSync(path).size };
+}